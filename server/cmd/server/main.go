@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
@@ -15,7 +16,9 @@ import (
 	"github.com/server/internal/config"
 	"github.com/server/internal/database"
 	"github.com/server/internal/handlers"
+	"github.com/server/internal/jobs"
 	"github.com/server/internal/middleware"
+	"github.com/server/internal/payments"
 )
 
 func main() {
@@ -28,6 +31,11 @@ func main() {
 	// Connect to Redis
 	cache.Connect(config.RedisAddr(), config.RedisPassword(), config.RedisDB())
 
+	// Configure online payment provider
+	if err := payments.Init(config.PaymentProvider(), config.RazorpayKeyID(), config.RazorpayKeySecret(), config.PaymentWebhookSecret()); err != nil {
+		log.Fatalf("Payment provider error: %v", err)
+	}
+
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
 		AppName:      config.AppName(),
@@ -51,7 +59,8 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigins,
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS,PATCH",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Request-ID",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,X-Request-ID,Range,If-Range,If-None-Match",
+		ExposeHeaders:    "Content-Range,Accept-Ranges,Content-Length,ETag,Content-Disposition",
 		AllowCredentials: allowCredentials,
 	}))
 	app.Use(middleware.RequestID())
@@ -67,6 +76,14 @@ func main() {
 	// Setup routes
 	setupRoutes(app)
 
+	// Background jobs
+	jobs.RegisterMaintenance()
+	jobs.RegisterAccounts()
+	jobs.RegisterRides()
+	jobs.RegisterCourses()
+	jobs.RegisterStatements()
+	jobs.Start(context.Background())
+
 	// Graceful shutdown
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -102,6 +119,9 @@ func setupRoutes(app *fiber.App) {
 	authRoutes.Post("/send-otp", handlers.SendOTP)
 	authRoutes.Post("/verify-otp", handlers.VerifyOTP)
 
+	// Payment gateway webhooks (public, verified by HMAC signature)
+	api.Post("/payments/webhook", handlers.PaymentWebhook)
+
 	// Protected routes
 	protected := api.Group("", middleware.RequireAuth())
 
@@ -123,6 +143,65 @@ func setupRoutes(app *fiber.App) {
 	protected.Get("/ride-locations/:id", handlers.GetRideLocationByID)
 	protected.Get("/my-ride-bills", handlers.GetMyRideBills)
 	protected.Post("/ride-bills", handlers.CreateRideBill) // Students can book rides
+	protected.Post("/ride-bills/:id/payment-order", handlers.CreateRideBillPaymentOrder)
+	protected.Get("/ride-bills/:id/rating", handlers.GetRideBillRating)
+	protected.Post("/ride-bills/:id/rating", handlers.RateRideBill)
+	protected.Get("/feedback-tags", handlers.GetFeedbackTags)
+	protected.Post("/ride-bills/:id/sos", handlers.RaiseRideSOS)
+	protected.Post("/incidents", handlers.ReportIncident)
+	protected.Get("/my-incidents", handlers.GetMyIncidents)
+
+	// Recurring ride bookings
+	protected.Get("/my-ride-series", handlers.GetMyRideSeries)
+	protected.Post("/ride-series", handlers.CreateRideSeries)
+	protected.Get("/ride-series/:id", handlers.GetRideSeries)
+	protected.Put("/ride-series/:id", handlers.UpdateRideSeries)
+	protected.Delete("/ride-series/:id", handlers.CancelRideSeries)
+	protected.Post("/ride-series/:id/pause", handlers.PauseRideSeries)
+	protected.Post("/ride-series/:id/resume", handlers.ResumeRideSeries)
+	protected.Post("/ride-series/:id/skips", handlers.SkipRideSeriesOccurrence)
+	protected.Get("/holidays", handlers.GetHolidays)
+
+	// Accessibility requirements
+	protected.Get("/accessibility-features", handlers.GetAccessibilityFeatures)
+	protected.Get("/me/accessibility", handlers.GetMyAccessibilityProfile)
+	protected.Put("/me/accessibility", handlers.UpdateMyAccessibilityProfile)
+
+	// Monthly ride statements
+	protected.Get("/my-statements", handlers.GetMyStatements)
+	protected.Get("/my-statements/:period", handlers.GetMyStatement)
+	protected.Get("/my-statements/:period/pdf", handlers.DownloadMyStatement)
+
+	// Enrolled courses and their books
+	protected.Get("/my-courses", handlers.GetMyCourses)
+	protected.Get("/my-courses/:id", handlers.GetMyCourse)
+	protected.Get("/my-courses/:id/book", handlers.DownloadMyCourseBook)
+	protected.Get("/my-courses/:id/materials", handlers.GetMyCourseMaterials)
+	protected.Get("/my-courses/:id/materials/:materialId/file", handlers.DownloadMyCourseMaterial)
+	protected.Get("/my-courses/:id/reading", handlers.GetMyReadingState)
+	protected.Put("/my-courses/:id/reading/progress", handlers.UpdateMyReadingProgress)
+	protected.Post("/my-courses/:id/reading/sync", handlers.SyncMyReading)
+	protected.Get("/my-courses/:id/reading/export", handlers.ExportMyReading)
+
+	// Course and book requests
+	protected.Get("/course-catalog", handlers.GetCourseCatalog)
+	protected.Post("/course-requests", handlers.SubmitCourseRequest)
+	protected.Get("/my-course-requests", handlers.GetMyCourseRequests)
+	protected.Delete("/my-course-requests/:id", handlers.CancelMyCourseRequest)
+	if config.PaymentSimulation() {
+		// Development only (PAYMENT_SIMULATION=true): complete fake gateway payments
+		protected.Post("/payments/fake/orders/:orderId/complete", handlers.SimulateFakePayment)
+	}
+
+	// Driver routes (registered before the admin group so its role check doesn't apply)
+	driver := api.Group("/driver", middleware.RequireRole("Driver"))
+	driver.Get("/duty", handlers.GetMyDutyStatus)
+	driver.Put("/duty", handlers.UpdateMyDutyStatus)
+	driver.Get("/shifts", handlers.GetMyShifts)
+	driver.Get("/rides", handlers.GetMyDriverRides)
+	driver.Post("/rides/:id/accept", handlers.AcceptRideOffer)
+	driver.Post("/rides/:id/decline", handlers.DeclineRideOffer)
+	driver.Post("/rides/:id/report", handlers.ReportPassenger)
 
 	// Admin routes
 	admin := api.Group("", middleware.RequireRole("Admin", "SuperAdmin"))
@@ -131,8 +210,26 @@ func setupRoutes(app *fiber.App) {
 	admin.Get("/users", handlers.GetUsers)
 	admin.Get("/users/:id", handlers.GetUserByID)
 	admin.Post("/users", handlers.CreateUser)
+	admin.Post("/users/reactivate", handlers.BulkReactivateUsers)
 	admin.Put("/users/:id", handlers.UpdateUser)
 	admin.Delete("/users/:id", handlers.DeleteUser)
+	admin.Get("/users/:id/accessibility", handlers.GetUserAccessibilityProfile)
+	admin.Put("/users/:id/accessibility", handlers.UpdateUserAccessibilityProfile)
+	admin.Get("/users/:id/vehicle-assignments", handlers.GetUserVehicleAssignments)
+	admin.Get("/users/:id/shifts", handlers.GetDriverShifts)
+	admin.Put("/users/:id/shifts", handlers.UpdateDriverShifts)
+	admin.Put("/users/:id/duty", handlers.UpdateDriverDuty)
+	admin.Get("/duty-roster", handlers.GetDriverAvailability)
+
+	// Fleet vehicles (admin only)
+	admin.Get("/vehicles", handlers.GetVehicles)
+	admin.Get("/vehicles/:id", handlers.GetVehicle)
+	admin.Post("/vehicles", handlers.CreateVehicle)
+	admin.Put("/vehicles/:id", handlers.UpdateVehicle)
+	admin.Delete("/vehicles/:id", handlers.DeleteVehicle)
+	admin.Get("/vehicles/:id/assignments", handlers.GetVehicleAssignments)
+	admin.Post("/vehicles/:id/assignments", handlers.AssignVehicleDriver)
+	admin.Delete("/vehicles/:id/assignments/:assignmentId", handlers.EndVehicleAssignment)
 
 	// Ride locations (admin only)
 	admin.Get("/ride-locations", handlers.GetRideLocations)
@@ -144,9 +241,43 @@ func setupRoutes(app *fiber.App) {
 	// Ride bills (admin only)
 	admin.Get("/ride-bills", handlers.GetRideBills)
 	admin.Get("/ride-bills/stats", handlers.GetRideBillStatistics)
+	admin.Get("/ride-bills/reconciliation", handlers.GetPaymentReconciliation)
+	admin.Get("/ride-bills/analytics", handlers.GetRideBillAnalytics)
 	admin.Get("/ride-bills/:id", handlers.GetRideBillByID)
 	admin.Put("/ride-bills/:id", handlers.UpdateRideBill)
 	admin.Delete("/ride-bills/:id", handlers.DeleteRideBill)
+	admin.Get("/ride-bills/:id/driver-matches", handlers.GetRideBillDriverMatches)
+	admin.Post("/ride-bills/:id/assign-driver", handlers.AssignRideBillDriver)
+	admin.Post("/ride-bills/:id/dispatch", handlers.DispatchRideBill)
+
+	// Ride feedback (admin only)
+	admin.Get("/ratings/drivers", handlers.GetDriverRatingSummaries)
+	admin.Get("/ratings/drivers/:id", handlers.GetDriverRatings)
+	admin.Get("/ratings/alerts", handlers.GetLowRatingAlerts)
+	admin.Get("/passenger-reports", handlers.GetPassengerReports)
+
+	// Incidents and SOS alerts (admin only)
+	admin.Get("/incidents", handlers.GetIncidents)
+	admin.Get("/incidents/stream", handlers.StreamIncidents)
+	admin.Get("/incidents/:id", handlers.GetIncident)
+	admin.Put("/incidents/:id", handlers.UpdateIncident)
+	admin.Put("/users/:id/on-call", handlers.UpdateUserOnCall)
+
+	// Payment ledger (admin only)
+	admin.Get("/ride-bills/:id/payments", handlers.GetRideBillPayments)
+	admin.Post("/ride-bills/:id/payments", handlers.RecordRideBillPayment)
+	admin.Post("/ride-bills/:id/refunds", handlers.RecordRideBillRefund)
+	admin.Get("/ride-bills/:id/payment-orders", handlers.GetRideBillPaymentOrders)
+
+	// Holidays (admin only)
+	admin.Post("/holidays", handlers.CreateHoliday)
+	admin.Delete("/holidays/:id", handlers.DeleteHoliday)
+
+	// Ride statements (admin only)
+	admin.Get("/users/:id/statements/:period/pdf", handlers.DownloadUserStatement)
+	admin.Get("/ride-statements/runs", handlers.GetStatementRuns)
+	admin.Get("/ride-statements/runs/:id", handlers.GetStatementRun)
+	admin.Post("/ride-statements/runs", handlers.StartStatementRun)
 
 	// Courses (admin only)
 	admin.Get("/courses", handlers.GetCourses)
@@ -157,20 +288,64 @@ func setupRoutes(app *fiber.App) {
 	admin.Put("/courses/:id/with-pdf", handlers.UpdateCourseWithPdf)
 	admin.Delete("/courses/:id", handlers.DeleteCourse)
 
+	// Course materials (admin only)
+	admin.Get("/courses/:id/materials", handlers.GetCourseMaterials)
+	admin.Post("/courses/:id/materials", handlers.CreateCourseMaterial)
+	admin.Put("/courses/:id/materials/order", handlers.ReorderCourseMaterials)
+	admin.Get("/course-materials/:id", handlers.GetCourseMaterial)
+	admin.Put("/course-materials/:id", handlers.UpdateCourseMaterial)
+	admin.Delete("/course-materials/:id", handlers.DeleteCourseMaterial)
+	admin.Get("/course-materials/:id/versions", handlers.GetCourseMaterialVersions)
+	admin.Post("/course-materials/:id/versions", handlers.AddCourseMaterialVersion)
+	admin.Post("/course-materials/:id/versions/:version/restore", handlers.RestoreCourseMaterialVersion)
+
+	// Accessible course book formats (admin only)
+	admin.Get("/courses/:id/formats", handlers.GetCourseBookFormats)
+	admin.Post("/courses/:id/formats/retry", handlers.RetryCourseBookFormats)
+	admin.Get("/course-book-formats", handlers.GetBookFormatsByStatus)
+
 	// Enrollments (admin only)
 	admin.Get("/courses/:id/enrollments", handlers.GetCourseEnrollments)
 	admin.Get("/courses/:id/available-students", handlers.GetAvailableStudents)
 	admin.Post("/courses/:id/enroll", handlers.EnrollStudent)
+	admin.Post("/courses/:id/enroll/bulk", handlers.BulkEnrollStudents)
 	admin.Put("/enrollments/:id", handlers.UpdateEnrollment)
 	admin.Delete("/enrollments/:id", handlers.UnenrollStudent)
 
+	// Course capacity and waitlist (admin only)
+	admin.Put("/courses/:id/capacity", handlers.UpdateCourseCapacity)
+	admin.Get("/courses/:id/waitlist", handlers.GetCourseWaitlist)
+	admin.Put("/courses/:id/waitlist/order", handlers.ReorderCourseWaitlist)
+	admin.Delete("/course-waitlist/:id", handlers.RemoveFromWaitlist)
+
+	// Course and book requests (admin only)
+	admin.Get("/course-requests", handlers.GetCourseRequests)
+	admin.Get("/course-requests/:id", handlers.GetCourseRequest)
+	admin.Post("/course-requests/:id/approve", handlers.ApproveCourseRequest)
+	admin.Post("/course-requests/:id/reject", handlers.RejectCourseRequest)
+
+	// Enrollment expiry reminders (admin only)
+	admin.Get("/enrollment-settings", handlers.GetEnrollmentSettings)
+	admin.Put("/enrollment-settings", handlers.UpdateEnrollmentSettings)
+	admin.Get("/courses/:id/renewal-windows", handlers.GetCourseRenewalWindows)
+	admin.Put("/courses/:id/renewal-windows", handlers.UpdateCourseRenewalWindows)
+
+	// Background jobs (admin only)
+	admin.Get("/jobs", handlers.GetJobs)
+	admin.Get("/jobs/:name/runs", handlers.GetJobRuns)
+	admin.Post("/jobs/:name/run", handlers.RunJob)
+	admin.Post("/jobs/:name/pause", handlers.PauseJob)
+	admin.Post("/jobs/:name/resume", handlers.ResumeJob)
+
 	// File uploads (admin only)
 	admin.Post("/upload", handlers.UploadFile)
 	admin.Get("/files/:category/:filename", handlers.GetFile)
 	admin.Delete("/files/:category/:filename", handlers.DeleteFile)
 
-	// Static file serving for uploads
-	app.Static("/uploads", "./uploads")
+	// Static file serving for public uploads only
+	for _, category := range handlers.PublicUploadCategories {
+		app.Static("/uploads/"+category, "./uploads/"+category)
+	}
 }
 
 func customErrorHandler(c *fiber.Ctx, err error) error {
@@ -8,12 +8,19 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
 	"github.com/server/internal/database"
 )
 
+// sessionRefreshInterval throttles how often activity extends a session, so
+// a burst of requests costs one Redis and one database write
+const sessionRefreshInterval = time.Minute
+
 var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserNotFound       = errors.New("user not found")
@@ -21,28 +28,40 @@ var (
 
 // User represents a user in the system
 type User struct {
-	ID           int       `json:"id"`
-	Username     string    `json:"username"`
-	Email        string    `json:"email"`
-	PasswordHash string    `json:"-"`
-	Role         string    `json:"role"`
-	Phone        *string   `json:"phone,omitempty"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	PasswordHash string     `json:"-"`
+	Role         string     `json:"role"`
+	Phone        *string    `json:"phone,omitempty"`
+	Status       string     `json:"status"`
+	ExpiryDate   *time.Time `json:"expiry_date,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
 }
 
-// Session represents a user session
+// Session represents a user session. A session expires after the idle
+// timeout without activity, and at AbsoluteExpiresAt however active it is.
 type Session struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
 	Email    string `json:"email"`
 	Role     string `json:"role"`
+
+	RememberMe        bool      `json:"remember_me"`
+	ExpiresAt         time.Time `json:"expires_at"`
+	AbsoluteExpiresAt time.Time `json:"absolute_expires_at"`
+	LastActiveAt      time.Time `json:"last_active_at"`
+	Version           int64     `json:"version"` // User's session version when the claims were read
+
+	AccountExpiresAt *time.Time `json:"account_expires_at,omitempty"` // Students only
 }
 
 // GetUserByUsernameOrEmail retrieves a user by username or email
 func GetUserByUsernameOrEmail(ctx context.Context, identifier string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, role, phone, created_at, updated_at
+		SELECT id, username, email, password_hash, role, phone,
+		       COALESCE(status, 'active'), expiry_date, created_at, updated_at
 		FROM users
 		WHERE username = $1 OR email = $1
 		LIMIT 1
@@ -56,6 +75,8 @@ func GetUserByUsernameOrEmail(ctx context.Context, identifier string) (*User, er
 		&user.PasswordHash,
 		&user.Role,
 		&user.Phone,
+		&user.Status,
+		&user.ExpiryDate,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -75,8 +96,30 @@ func VerifyPassword(hashedPassword, password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 }
 
-// Login authenticates a user and creates a session
-func Login(ctx context.Context, identifier, password string) (*Session, string, error) {
+// sessionTimeouts returns the idle timeout and the absolute lifetime of a
+// new session. Remember-me sessions last their whole lifetime without
+// needing activity.
+func sessionTimeouts(rememberMe bool) (idle, absolute time.Duration) {
+	if rememberMe {
+		d := config.SessionRememberMe()
+		return d, d
+	}
+	return config.SessionIdleTimeout(), config.SessionAbsoluteTimeout()
+}
+
+// slidingExpiry returns when a session active at now expires: the idle
+// timeout from now, but never past its absolute expiry
+func slidingExpiry(now time.Time, idle time.Duration, absoluteExpiresAt time.Time) time.Time {
+	expiresAt := now.Add(idle)
+	if expiresAt.After(absoluteExpiresAt) {
+		return absoluteExpiresAt
+	}
+	return expiresAt
+}
+
+// Login authenticates a user and creates a session. A remember-me session
+// lasts longer and doesn't end when idle.
+func Login(ctx context.Context, identifier, password string, rememberMe bool) (*Session, string, error) {
 	// Get user by username or email
 	user, err := GetUserByUsernameOrEmail(ctx, identifier)
 	if err != nil {
@@ -98,16 +141,39 @@ func Login(ctx context.Context, identifier, password string) (*Session, string,
 
 	log.Printf("[Auth] Password verified successfully for user: %s", user.Username)
 
+	// Only active, unexpired accounts can sign in
+	accountExpires := accountExpiresAt(user.Role, user.ExpiryDate)
+	if err := checkAccount(user.Status, accountExpires, clock.Now()); err != nil {
+		log.Printf("[Auth] Login refused for user %s: %v", user.Username, err)
+		return nil, "", err
+	}
+
+	version, err := cache.GetSessionVersion(ctx, user.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
 	// Create session
+	now := clock.Now()
+	idle, absolute := sessionTimeouts(rememberMe)
 	session := &Session{
-		UserID:   user.ID,
-		Username: user.Username,
-		Email:    user.Email,
-		Role:     user.Role,
+		UserID:            user.ID,
+		Username:          user.Username,
+		Email:             user.Email,
+		Role:              user.Role,
+		RememberMe:        rememberMe,
+		AbsoluteExpiresAt: now.Add(absolute),
+		LastActiveAt:      now,
+		Version:           version,
+		AccountExpiresAt:  accountExpires,
 	}
+	session.ExpiresAt = slidingExpiry(now, idle, session.AbsoluteExpiresAt)
 
 	sessionID := uuid.New().String()
-	if err := cache.SetSession(ctx, sessionID, session, 24*time.Hour); err != nil {
+	if err := cache.SetSession(ctx, sessionID, session, session.ExpiresAt.Sub(now)); err != nil {
+		return nil, "", err
+	}
+	if err := cache.AddUserSession(ctx, user.ID, sessionID); err != nil {
 		return nil, "", err
 	}
 
@@ -123,9 +189,81 @@ func GetSession(ctx context.Context, sessionID string) (*Session, error) {
 	return &session, nil
 }
 
-// Logout removes a session from Redis
+// Touch records activity on a session, extending its idle timeout in Redis
+// and its expiry in the database. Activity within a minute of the last
+// refresh is not recorded again.
+func Touch(ctx context.Context, sessionID string, session *Session) error {
+	if session.AbsoluteExpiresAt.IsZero() {
+		// Created before sliding expiry; it keeps its original TTL
+		return database.UpdateSessionLastActive(ctx, sessionID)
+	}
+
+	now := clock.Now()
+	if now.Sub(session.LastActiveAt) < sessionRefreshInterval {
+		return nil
+	}
+	idle, _ := sessionTimeouts(session.RememberMe)
+	refreshed := *session
+	refreshed.LastActiveAt = now
+	refreshed.ExpiresAt = slidingExpiry(now, idle, session.AbsoluteExpiresAt)
+	ttl := refreshed.ExpiresAt.Sub(now)
+	if ttl <= 0 {
+		return nil // Expiring this instant; Redis drops it
+	}
+
+	ok, err := cache.RefreshSession(ctx, sessionID, &refreshed, ttl)
+	if err != nil || !ok {
+		return err
+	}
+	return database.UpdateSessionExpiry(ctx, sessionID, refreshed.ExpiresAt)
+}
+
+// Logout removes a session from Redis and from its user's session set
 func Logout(ctx context.Context, sessionID string) error {
-	return cache.DeleteSession(ctx, sessionID)
+	session, getErr := GetSession(ctx, sessionID)
+	if getErr == redis.Nil {
+		return nil // Already expired or logged out
+	}
+	if err := cache.DeleteSession(ctx, sessionID); err != nil {
+		return err
+	}
+	if getErr != nil {
+		return nil // Owner unknown; readers prune it from the set
+	}
+	return cache.RemoveUserSessions(ctx, session.UserID, sessionID)
+}
+
+// OwnsSession reports whether a live session belongs to the user
+func OwnsSession(ctx context.Context, userID int, sessionID string) (bool, error) {
+	member, err := cache.IsUserSession(ctx, userID, sessionID)
+	if err != nil || !member {
+		return false, err
+	}
+	live, err := cache.ExistingSessions(ctx, []string{sessionID})
+	if err != nil {
+		return false, err
+	}
+	return live[sessionID], nil
+}
+
+// LogoutOthers removes every session of the user except one from Redis and
+// returns the IDs it removed
+func LogoutOthers(ctx context.Context, userID int, exceptSessionID string) ([]string, error) {
+	ids, err := cache.GetUserSessionIDs(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	revoked := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == exceptSessionID {
+			continue
+		}
+		if err := cache.DeleteSession(ctx, id); err != nil {
+			return revoked, err
+		}
+		revoked = append(revoked, id)
+	}
+	return revoked, cache.RemoveUserSessions(ctx, userID, revoked...)
 }
 
 // HashPassword creates a bcrypt hash from a password
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"testing"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -175,3 +176,89 @@ func BenchmarkVerifyPassword(b *testing.B) {
 		_ = VerifyPassword(hash, password)
 	}
 }
+
+func TestSlidingExpiry(t *testing.T) {
+	login := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	absolute := login.Add(24 * time.Hour)
+	idle := 2 * time.Hour
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"at login", login, login.Add(idle)},
+		{"activity slides the expiry", login.Add(5 * time.Hour), login.Add(7 * time.Hour)},
+		{"capped at the absolute expiry", login.Add(23 * time.Hour), absolute},
+		{"after the absolute expiry", absolute.Add(time.Minute), absolute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slidingExpiry(tt.now, idle, absolute); !got.Equal(tt.want) {
+				t.Errorf("slidingExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActionFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		change UserChange
+		policy string
+		want   sessionAction
+	}{
+		{"nothing session related", UserChange{}, "refresh", keepSessions},
+		{"password", UserChange{Password: true}, "refresh", revokeSessions},
+		{"deleted", UserChange{Deleted: true}, "refresh", revokeSessions},
+		{"role with refresh policy", UserChange{Role: true}, "refresh", refreshSessions},
+		{"role with revoke policy", UserChange{Role: true}, "revoke", revokeSessions},
+		{"status", UserChange{Status: true}, "revoke", refreshSessions},
+		{"username or email", UserChange{Identity: true}, "refresh", refreshSessions},
+		{"password and role", UserChange{Password: true, Role: true}, "refresh", revokeSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := actionFor(tt.change, tt.policy); got != tt.want {
+				t.Errorf("actionFor(%+v, %q) = %v, want %v", tt.change, tt.policy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckAccount(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name      string
+		status    string
+		expiresAt *time.Time
+		want      error
+	}{
+		{"active", "active", nil, nil},
+		{"active before expiry", "Active", &future, nil},
+		{"active after expiry", "active", &past, ErrAccountExpired},
+		{"suspended", "suspended", nil, ErrAccountSuspended},
+		{"inactive", "inactive", nil, ErrAccountSuspended},
+		{"pending", "pending", nil, ErrAccountPending},
+		{"graduated", "graduated", &future, ErrAccountGraduated},
+		{"expired", "expired", nil, ErrAccountExpired},
+		{"closed", "closed", nil, ErrAccountClosed},
+		{"unknown", "banned", nil, ErrAccountClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := checkAccount(tt.status, tt.expiresAt, now); got != tt.want {
+				t.Errorf("checkAccount(%q) = %v, want %v", tt.status, got, tt.want)
+			}
+			if tt.want != nil && ErrorCode(tt.want) == "" {
+				t.Errorf("ErrorCode(%v) is empty", tt.want)
+			}
+		})
+	}
+}
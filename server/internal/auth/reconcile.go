@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/database"
+)
+
+// reconcileBatchSize is how many sessions reconciliation handles per round
+// trip to Redis and the database
+const reconcileBatchSize = 500
+
+// ReconcileResult counts what a reconciliation fixed
+type ReconcileResult struct {
+	Closed   int64 // Rows of sessions that no longer exist in Redis
+	Revoked  int   // Sessions still in Redis after their row was logged out
+	Restored int   // Rows written for sessions that only existed in Redis
+	Indexed  int   // Sessions checked and kept in their user's session set
+}
+
+func (r ReconcileResult) String() string {
+	return fmt.Sprintf("closed %d, revoked %d, restored %d, indexed %d sessions",
+		r.Closed, r.Revoked, r.Restored, r.Indexed)
+}
+
+// ReconcileSessions brings the sessions table in line with Redis, which is
+// what authenticates requests:
+//   - rows of sessions that are gone from Redis are marked logged out
+//   - sessions whose row was logged out are removed from Redis
+//   - sessions without a row (the login couldn't write it) get one
+//   - every session is added to its user's session set
+func ReconcileSessions(ctx context.Context) (ReconcileResult, error) {
+	var result ReconcileResult
+	if err := closeOrphanedRows(ctx, &result); err != nil {
+		return result, err
+	}
+	err := reconcileRedisSessions(ctx, &result)
+	return result, err
+}
+
+// closeOrphanedRows marks open rows whose session no longer exists in Redis
+// as logged out
+func closeOrphanedRows(ctx context.Context, result *ReconcileResult) error {
+	afterID := 0
+	for {
+		ids, lastID, err := database.GetActiveSessionIDs(ctx, afterID, reconcileBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		afterID = lastID
+
+		live, err := cache.ExistingSessions(ctx, ids)
+		if err != nil {
+			return err
+		}
+		var gone []string
+		for _, id := range ids {
+			if !live[id] {
+				gone = append(gone, id)
+			}
+		}
+		if len(gone) > 0 {
+			n, err := database.MarkSessionsLoggedOut(ctx, gone)
+			if err != nil {
+				return err
+			}
+			result.Closed += n
+		}
+	}
+}
+
+// reconcileRedisSessions walks the sessions in Redis, removing revoked ones,
+// restoring missing rows and rebuilding the per-user session sets
+func reconcileRedisSessions(ctx context.Context, result *ReconcileResult) error {
+	var cursor uint64
+	for {
+		ids, next, err := cache.ScanSessions(ctx, cursor, reconcileBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 {
+			if err := reconcileSessionBatch(ctx, ids, result); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+func reconcileSessionBatch(ctx context.Context, ids []string, result *ReconcileResult) error {
+	loggedOut, err := database.GetSessionsLoggedOut(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		session, err := GetSession(ctx, id)
+		if err == redis.Nil {
+			continue // Expired since the scan
+		}
+		if err != nil {
+			log.Printf("[Auth] Reconcile: skipping unreadable session: %v", err)
+			continue
+		}
+
+		out, hasRow := loggedOut[id]
+		switch {
+		case out:
+			// The row was logged out but deleting the session failed
+			if err := Logout(ctx, id); err != nil {
+				return err
+			}
+			result.Revoked++
+			continue
+		case !hasRow && !session.ExpiresAt.IsZero():
+			// Sessions from before sliding expiry don't know their expiry;
+			// they run out within a day anyway
+			if err := database.RestoreSession(ctx, session.UserID, id, session.LastActiveAt, session.ExpiresAt); err != nil {
+				log.Printf("[Auth] Reconcile: failed to restore session of user %d: %v", session.UserID, err)
+			} else {
+				result.Restored++
+			}
+		}
+
+		if err := cache.AddUserSession(ctx, session.UserID, id); err != nil {
+			return err
+		}
+		result.Indexed++
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+// Errors for accounts that can't sign in, checked after the password so
+// they don't reveal whether an account exists
+var (
+	ErrAccountSuspended = errors.New("account suspended")
+	ErrAccountPending   = errors.New("account pending approval")
+	ErrAccountGraduated = errors.New("account closed after graduation")
+	ErrAccountExpired   = errors.New("account expired")
+	ErrAccountClosed    = errors.New("account closed")
+)
+
+// errorCodes are the codes clients get with auth errors to pick a message
+var errorCodes = map[error]string{
+	ErrInvalidCredentials: "invalid_credentials",
+	ErrSessionRevoked:     "session_revoked",
+	ErrAccountSuspended:   "account_suspended",
+	ErrAccountPending:     "account_pending",
+	ErrAccountGraduated:   "account_graduated",
+	ErrAccountExpired:     "account_expired",
+	ErrAccountClosed:      "account_closed",
+}
+
+// ErrorCode returns the client-facing code of an auth error, or "" for
+// other errors
+func ErrorCode(err error) string {
+	return errorCodes[err]
+}
+
+// accountExpiresAt is when the account of a user with the role and expiry
+// date stops working: the end of the expiry date in the institution
+// timezone. Only students expire.
+func accountExpiresAt(role string, expiryDate *time.Time) *time.Time {
+	if expiryDate == nil || !database.IsStudentRole(role) {
+		return nil
+	}
+	expiresAt := clock.EndOfDay(*expiryDate)
+	return &expiresAt
+}
+
+// checkAccount returns the error for an account that can't be used at now,
+// or nil for an active account that hasn't expired
+func checkAccount(status string, expiresAt *time.Time, now time.Time) error {
+	switch strings.ToLower(status) {
+	case database.UserActive, "":
+		if expiresAt != nil && now.After(*expiresAt) {
+			return ErrAccountExpired
+		}
+		return nil
+	case database.UserSuspended, database.UserInactive:
+		return ErrAccountSuspended
+	case database.UserPending:
+		return ErrAccountPending
+	case database.UserGraduated:
+		return ErrAccountGraduated
+	case database.UserExpired:
+		return ErrAccountExpired
+	}
+	return ErrAccountClosed
+}
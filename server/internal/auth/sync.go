@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+)
+
+// ErrSessionRevoked is returned for a stale session whose user was deleted
+var ErrSessionRevoked = errors.New("session revoked")
+
+// UserChange says what an update changed about a user
+type UserChange struct {
+	Password bool
+	Role     bool
+	Status   bool
+	Identity bool // Username or email, shown from the session
+	Expiry   bool
+	Deleted  bool
+}
+
+// sessionAction is what a user change does to the user's sessions
+type sessionAction int
+
+const (
+	keepSessions sessionAction = iota
+	refreshSessions
+	revokeSessions
+)
+
+// actionFor decides what a change does to the user's sessions. Password
+// changes and deletion end them; a role change follows the configured
+// policy; other claim changes rewrite them, which ends them too if the
+// account can no longer be used.
+func actionFor(change UserChange, roleChangePolicy string) sessionAction {
+	switch {
+	case change.Password || change.Deleted:
+		return revokeSessions
+	case change.Role && roleChangePolicy == "revoke":
+		return revokeSessions
+	case change.Role || change.Status || change.Identity || change.Expiry:
+		return refreshSessions
+	}
+	return keepSessions
+}
+
+// ApplyUserChange brings the user's live sessions in line with a change an
+// admin made. The session making the change, if it is the user's own, is
+// kept when the others are revoked.
+func ApplyUserChange(ctx context.Context, userID int, change UserChange, currentSessionID string) error {
+	switch actionFor(change, config.SessionRoleChangePolicy()) {
+	case revokeSessions:
+		return RevokeUserSessions(ctx, userID, currentSessionID)
+	case refreshSessions:
+		return RefreshUserSessions(ctx, userID)
+	}
+	return nil
+}
+
+// claims are the user fields a session carries, with the account status
+type claims struct {
+	username, email, role string
+	status                string
+	accountExpiresAt      *time.Time
+}
+
+// apply copies the claims and the session version into a session
+func (c *claims) apply(session *Session, version int64) {
+	session.Username, session.Email, session.Role = c.username, c.email, c.role
+	session.AccountExpiresAt = c.accountExpiresAt
+	session.Version = version
+}
+
+// sessionClaims reads a user's current claims
+func sessionClaims(ctx context.Context, userID int) (*claims, error) {
+	query := `SELECT username, email, role, COALESCE(status, 'active'), expiry_date FROM users WHERE id = $1`
+	var c claims
+	var expiryDate *time.Time
+	err := database.GetPool().QueryRow(ctx, query, userID).Scan(&c.username, &c.email, &c.role, &c.status, &expiryDate)
+	if err == pgx.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.accountExpiresAt = accountExpiresAt(c.role, expiryDate)
+	return &c, nil
+}
+
+// RevokeUserSessions ends every session of the user except one (none if
+// exceptSessionID is empty)
+func RevokeUserSessions(ctx context.Context, userID int, exceptSessionID string) error {
+	// Bumping first makes sessions missing from the session set stale too
+	if _, err := cache.BumpSessionVersion(ctx, userID); err != nil {
+		return err
+	}
+	if _, err := LogoutOthers(ctx, userID, exceptSessionID); err != nil {
+		return err
+	}
+	return database.MarkUserSessionsLoggedOutExcept(ctx, userID, exceptSessionID)
+}
+
+// RefreshUserSessions rewrites the user's live sessions with fresh claims,
+// or ends them if the user was deleted or the account can no longer be used
+func RefreshUserSessions(ctx context.Context, userID int) error {
+	version, err := cache.BumpSessionVersion(ctx, userID)
+	if err != nil {
+		return err
+	}
+	fresh, err := sessionClaims(ctx, userID)
+	if err == ErrUserNotFound || (err == nil && checkAccount(fresh.status, fresh.accountExpiresAt, clock.Now()) != nil) {
+		return RevokeUserSessions(ctx, userID, "")
+	}
+	if err != nil {
+		return err
+	}
+
+	ids, err := cache.GetUserSessionIDs(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		session, err := GetSession(ctx, id)
+		if err != nil {
+			continue // Expired meanwhile
+		}
+		fresh.apply(session, version)
+		if _, err := cache.RewriteSession(ctx, id, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckSession makes sure a session can still be used. A session of an
+// expired account is logged out with ErrAccountExpired. A session older than
+// its user's session version is rewritten with fresh claims, or logged out
+// with ErrSessionRevoked if the user was deleted, or with the account's
+// error if it can no longer be used.
+func CheckSession(ctx context.Context, sessionID string, session *Session) (*Session, error) {
+	now := clock.Now()
+	if err := checkAccount(database.UserActive, session.AccountExpiresAt, now); err != nil {
+		return nil, endSession(ctx, sessionID, err)
+	}
+
+	version, err := cache.GetSessionVersion(ctx, session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Version >= version {
+		return session, nil
+	}
+
+	fresh, err := sessionClaims(ctx, session.UserID)
+	if err == ErrUserNotFound {
+		return nil, endSession(ctx, sessionID, ErrSessionRevoked)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccount(fresh.status, fresh.accountExpiresAt, now); err != nil {
+		return nil, endSession(ctx, sessionID, err)
+	}
+
+	updated := *session
+	fresh.apply(&updated, version)
+	if _, err := cache.RewriteSession(ctx, sessionID, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// endSession logs a session out and returns reason, or the error logging out
+func endSession(ctx context.Context, sessionID string, reason error) error {
+	_ = database.MarkSessionLoggedOut(ctx, sessionID)
+	if err := Logout(ctx, sessionID); err != nil {
+		return err
+	}
+	return reason
+}
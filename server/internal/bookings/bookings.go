@@ -0,0 +1,98 @@
+package bookings
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+)
+
+// Materialize books the upcoming rides of a series up to the configured
+// horizon. Dates that were already booked are skipped, so it is safe to run
+// repeatedly. Returns the number of rides created.
+func Materialize(ctx context.Context, s database.RideSeries) (int, error) {
+	now := clock.Now()
+	today := Today(now)
+	horizon := today.AddDate(0, 0, config.RideBookingHorizonDays())
+
+	from := today
+	if s.MaterializedThrough != nil {
+		if next := dateOnly(*s.MaterializedThrough).AddDate(0, 0, 1); next.After(from) {
+			from = next
+		}
+	}
+	if from.After(horizon) {
+		return 0, nil
+	}
+
+	skipped := map[string]bool{}
+	skips, err := database.GetRideSeriesSkips(ctx, s.ID, from)
+	if err != nil {
+		return 0, err
+	}
+	booked, err := database.GetSeriesBookedDates(ctx, s.ID, from)
+	if err != nil {
+		return 0, err
+	}
+	for _, d := range append(skips, booked...) {
+		skipped[DateKey(d)] = true
+	}
+
+	holidays := map[string]bool{}
+	if s.SkipHolidays {
+		list, err := database.GetHolidays(ctx, from, horizon)
+		if err != nil {
+			return 0, err
+		}
+		for _, h := range list {
+			holidays[DateKey(h.Date)] = true
+		}
+	}
+
+	occurrences, err := Occurrences(Schedule{
+		DaysOfWeek:   s.DaysOfWeek,
+		RideTime:     s.RideTime,
+		StartDate:    s.StartDate,
+		EndDate:      s.EndDate,
+		SkipHolidays: s.SkipHolidays,
+	}, from, horizon, now, holidays, skipped)
+	if err != nil {
+		return 0, err
+	}
+
+	return database.MaterializeRideSeries(ctx, s.ID, occurrences, horizon)
+}
+
+// MaterializeAll books upcoming rides for every active series and returns
+// the number of rides created. Series that fail are logged and skipped.
+func MaterializeAll(ctx context.Context) (int, error) {
+	series, err := database.GetActiveRideSeries(ctx, Today(clock.Now()))
+	if err != nil {
+		return 0, fmt.Errorf("load active ride series: %w", err)
+	}
+
+	total, failed := 0, 0
+	for _, s := range series {
+		created, err := Materialize(ctx, s)
+		if err != nil {
+			log.Printf("[bookings] Failed to materialize ride series %d: %v", s.ID, err)
+			failed++
+			continue
+		}
+		total += created
+	}
+	if total > 0 {
+		log.Printf("[bookings] Booked %d recurring rides", total)
+		if err := cache.InvalidateRideBillAnalytics(ctx); err != nil && err != cache.ErrCacheUnavailable {
+			log.Printf("[bookings] Failed to invalidate analytics cache: %v", err)
+		}
+	}
+	if failed > 0 {
+		return total, fmt.Errorf("%d of %d ride series failed", failed, len(series))
+	}
+	return total, nil
+}
@@ -0,0 +1,111 @@
+package bookings
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/server/internal/clock"
+)
+
+// Schedule describes when a recurring ride happens
+type Schedule struct {
+	DaysOfWeek   []int32    // 0 = Sunday ... 6 = Saturday
+	RideTime     string     // HH:MM in the institution timezone
+	StartDate    time.Time  // Only the date part is used
+	EndDate      *time.Time // Inclusive, nil for open-ended series
+	SkipHolidays bool
+}
+
+// DateKey formats the calendar date of t as YYYY-MM-DD
+func DateKey(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// ParseDate parses a YYYY-MM-DD date
+func ParseDate(value string) (time.Time, error) {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q. Use YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+// ParseRideTime parses an HH:MM ride time
+func ParseRideTime(value string) (hour, minute int, err error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid rideTime %q. Use HH:MM", value)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// NormalizeDays validates days of week and returns them sorted without duplicates
+func NormalizeDays(days []int32) ([]int32, error) {
+	seen := map[int32]bool{}
+	result := []int32{}
+	for _, d := range days {
+		if d < 0 || d > 6 {
+			return nil, fmt.Errorf("invalid day of week %d. Use 0 (Sunday) to 6 (Saturday)", d)
+		}
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("at least one day of week is required")
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result, nil
+}
+
+// Occurrences returns the ride times of a schedule on the dates from..to
+// (inclusive) that are after the given instant. Dates in skipped are left out,
+// as are holidays when the schedule skips them. Both maps are keyed by DateKey.
+func Occurrences(s Schedule, from, to, after time.Time, holidays, skipped map[string]bool) ([]time.Time, error) {
+	hour, minute, err := ParseRideTime(s.RideTime)
+	if err != nil {
+		return nil, err
+	}
+
+	onDay := map[time.Weekday]bool{}
+	for _, d := range s.DaysOfWeek {
+		onDay[time.Weekday(d)] = true
+	}
+
+	start := dateOnly(from)
+	if first := dateOnly(s.StartDate); first.After(start) {
+		start = first
+	}
+	end := dateOnly(to)
+	if s.EndDate != nil {
+		if last := dateOnly(*s.EndDate); last.Before(end) {
+			end = last
+		}
+	}
+
+	loc := clock.Location()
+	result := []time.Time{}
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		key := DateKey(day)
+		if !onDay[day.Weekday()] || skipped[key] || (s.SkipHolidays && holidays[key]) {
+			continue
+		}
+		at := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		if at.After(after) {
+			result = append(result, at)
+		}
+	}
+	return result, nil
+}
+
+// dateOnly returns midnight UTC on t's calendar date, for day arithmetic
+func dateOnly(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Today returns the current date in the institution timezone
+func Today(now time.Time) time.Time {
+	return dateOnly(now.In(clock.Location()))
+}
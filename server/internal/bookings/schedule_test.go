@@ -0,0 +1,129 @@
+package bookings
+
+import (
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+)
+
+func date(value string) time.Time {
+	t, _ := time.Parse("2006-01-02", value)
+	return t
+}
+
+func TestOccurrences(t *testing.T) {
+	// 2025-03-03 is a Monday
+	weekdays := []int32{1, 2, 3, 4, 5}
+	end := date("2025-03-05")
+
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from, to string
+		after    time.Time
+		holidays map[string]bool
+		skipped  map[string]bool
+		expected []string
+	}{
+		{
+			name:     "weekdays only",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-01")},
+			from:     "2025-03-01", to: "2025-03-09",
+			expected: []string{"2025-03-03", "2025-03-04", "2025-03-05", "2025-03-06", "2025-03-07"},
+		},
+		{
+			name:     "starts later than range",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-06")},
+			from:     "2025-03-01", to: "2025-03-09",
+			expected: []string{"2025-03-06", "2025-03-07"},
+		},
+		{
+			name:     "ends inside range",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-01"), EndDate: &end},
+			from:     "2025-03-01", to: "2025-03-09",
+			expected: []string{"2025-03-03", "2025-03-04", "2025-03-05"},
+		},
+		{
+			name:     "holidays skipped",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-01"), SkipHolidays: true},
+			from:     "2025-03-03", to: "2025-03-05",
+			holidays: map[string]bool{"2025-03-04": true},
+			expected: []string{"2025-03-03", "2025-03-05"},
+		},
+		{
+			name:     "holidays kept when not skipping",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-01")},
+			from:     "2025-03-03", to: "2025-03-05",
+			holidays: map[string]bool{"2025-03-04": true},
+			expected: []string{"2025-03-03", "2025-03-04", "2025-03-05"},
+		},
+		{
+			name:     "skipped occurrence",
+			schedule: Schedule{DaysOfWeek: []int32{3}, RideTime: "17:00", StartDate: date("2025-03-01")},
+			from:     "2025-03-01", to: "2025-03-31",
+			skipped:  map[string]bool{"2025-03-12": true},
+			expected: []string{"2025-03-05", "2025-03-19", "2025-03-26"},
+		},
+		{
+			name:     "past ride times excluded",
+			schedule: Schedule{DaysOfWeek: weekdays, RideTime: "08:30", StartDate: date("2025-03-01")},
+			from:     "2025-03-03", to: "2025-03-04",
+			after:    time.Date(2025, 3, 3, 9, 0, 0, 0, clock.Location()),
+			expected: []string{"2025-03-04"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Occurrences(tt.schedule, date(tt.from), date(tt.to), tt.after, tt.holidays, tt.skipped)
+			if err != nil {
+				t.Fatalf("Occurrences returned error: %v", err)
+			}
+			if len(result) != len(tt.expected) {
+				t.Fatalf("got %d occurrences %v, want %v", len(result), result, tt.expected)
+			}
+			for i, at := range result {
+				if DateKey(at) != tt.expected[i] {
+					t.Errorf("occurrence %d = %s, want %s", i, DateKey(at), tt.expected[i])
+				}
+				if at.Location().String() != clock.Location().String() {
+					t.Errorf("occurrence %d is in %s, want institution timezone", i, at.Location())
+				}
+			}
+		})
+	}
+}
+
+func TestOccurrencesRideTime(t *testing.T) {
+	s := Schedule{DaysOfWeek: []int32{1}, RideTime: "07:45", StartDate: date("2025-03-03")}
+	result, err := Occurrences(s, date("2025-03-03"), date("2025-03-03"), time.Time{}, nil, nil)
+	if err != nil || len(result) != 1 {
+		t.Fatalf("expected one occurrence, got %v (err %v)", result, err)
+	}
+	if result[0].Hour() != 7 || result[0].Minute() != 45 {
+		t.Errorf("occurrence at %s, want 07:45", result[0].Format("15:04"))
+	}
+
+	s.RideTime = "7.45am"
+	if _, err := Occurrences(s, date("2025-03-03"), date("2025-03-03"), time.Time{}, nil, nil); err == nil {
+		t.Error("expected error for invalid ride time")
+	}
+}
+
+func TestNormalizeDays(t *testing.T) {
+	days, err := NormalizeDays([]int32{5, 1, 3, 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(days) != 3 || days[0] != 1 || days[1] != 3 || days[2] != 5 {
+		t.Errorf("NormalizeDays = %v, want [1 3 5]", days)
+	}
+
+	if _, err := NormalizeDays([]int32{7}); err == nil {
+		t.Error("expected error for day 7")
+	}
+	if _, err := NormalizeDays(nil); err == nil {
+		t.Error("expected error for no days")
+	}
+}
@@ -0,0 +1,79 @@
+package bookings
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+)
+
+// notifyTimeout bounds emailing drivers about withdrawn rides
+const notifyTimeout = time.Minute
+
+// FormatWithdrawn builds the subject and body of the email telling a driver
+// that recurring rides they were offered or had accepted were cancelled.
+// rides all belong to the same driver.
+func FormatWithdrawn(rides []database.WithdrawnRide) (string, string) {
+	subject := "A ride assigned to you was cancelled"
+	if len(rides) > 1 {
+		subject = fmt.Sprintf("%d rides assigned to you were cancelled", len(rides))
+	}
+
+	var b strings.Builder
+	b.WriteString("These recurring rides were cancelled after being assigned to you:\n\n")
+	for _, r := range rides {
+		fmt.Fprintf(&b, "- Ride #%d on %s: %s to %s\n", r.BillID,
+			r.RideAt.In(clock.Location()).Format("Mon 02 Jan 2006 15:04"), r.FromLocation, r.ToLocation)
+	}
+	b.WriteString("\nYou don't need to do anything.\n")
+	return subject, b.String()
+}
+
+// NotifyWithdrawn emails each driver about their rides that were cancelled
+// when a ride series or holiday changed. It runs in the background so the
+// request is never kept waiting on SMTP.
+func NotifyWithdrawn(rides []database.WithdrawnRide) {
+	if len(rides) == 0 {
+		return
+	}
+
+	byDriver := map[int][]database.WithdrawnRide{}
+	var drivers []int
+	for _, r := range rides {
+		if _, ok := byDriver[r.DriverID]; !ok {
+			drivers = append(drivers, r.DriverID)
+		}
+		byDriver[r.DriverID] = append(byDriver[r.DriverID], r)
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		for _, driverID := range drivers {
+			driverRides := byDriver[driverID]
+			first := driverRides[0]
+			if first.DriverEmail == "" {
+				log.Printf("[bookings] Driver %d of withdrawn ride %d has no email", driverID, first.BillID)
+				continue
+			}
+			subject, body := FormatWithdrawn(driverRides)
+			userID := driverID
+			err := email.Send(ctx, email.Message{
+				To:      first.DriverEmail,
+				UserID:  &userID,
+				Subject: subject,
+				Body:    fmt.Sprintf("Hello %s,\n\n%s", first.DriverName, body),
+				Type:    "ride_withdrawn",
+			})
+			if err != nil {
+				log.Printf("[bookings] Failed to notify %s of %d withdrawn rides: %v", first.DriverEmail, len(driverRides), err)
+			}
+		}
+	}()
+}
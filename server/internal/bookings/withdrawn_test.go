@@ -0,0 +1,27 @@
+package bookings
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func TestFormatWithdrawn(t *testing.T) {
+	rideAt := time.Date(2026, 3, 2, 3, 0, 0, 0, time.UTC) // 08:30 on Monday in IST
+	ride := database.WithdrawnRide{BillID: 42, FromLocation: "Hostel", ToLocation: "Campus", RideAt: rideAt}
+
+	subject, body := FormatWithdrawn([]database.WithdrawnRide{ride})
+	if subject != "A ride assigned to you was cancelled" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "- Ride #42 on Mon 02 Mar 2026 08:30: Hostel to Campus") {
+		t.Errorf("body does not list the ride:\n%s", body)
+	}
+
+	subject, _ = FormatWithdrawn([]database.WithdrawnRide{ride, ride})
+	if subject != "2 rides assigned to you were cancelled" {
+		t.Errorf("subject = %q", subject)
+	}
+}
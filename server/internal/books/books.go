@@ -0,0 +1,153 @@
+// Package books delivers course books to students as personal copies
+// watermarked with the student's identity, as required by our publishers.
+package books
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/pdf"
+	"github.com/server/internal/storage"
+)
+
+// StorageCategory is the storage category personal copies are cached under
+const StorageCategory = "books"
+
+// inflight tracks copies being generated so concurrent requests for the same
+// enrollment wait for one another instead of each watermarking the book
+var (
+	inflightMu sync.Mutex
+	inflight   = map[string]chan struct{}{}
+)
+
+// PersonalCopy returns the student's watermarked copy of a book stored at
+// category/filename, generating and storing it on first use. The copy is
+// regenerated whenever the source book or the student's name changes.
+func PersonalCopy(ctx context.Context, sc database.StudentCourse, category, filename string) (*storage.Object, error) {
+	key := cacheName(sc, category, filename)
+	return personalFile(ctx, key, "application/pdf", func() ([]byte, error) {
+		src, err := storage.Read(ctx, category, filename)
+		if err != nil {
+			return nil, err
+		}
+		return pdf.AddWatermark(src, watermark(sc, clock.Now()))
+	})
+}
+
+// PersonalFormat returns the student's copy of an accessible format of a
+// book stored at category/filename, with the licence notice of their PDF
+// copy embedded. Like PersonalCopy it is generated and stored on first use.
+func PersonalFormat(ctx context.Context, sc database.StudentCourse, format, category, filename string) (*storage.Object, error) {
+	key := strings.TrimSuffix(cacheName(sc, category, filename), ".pdf") + "." + format
+	return personalFile(ctx, key, ContentTypes[format], func() ([]byte, error) {
+		src, err := storage.Read(ctx, category, filename)
+		if err != nil {
+			return nil, err
+		}
+		return license(format, src, sc, clock.Now())
+	})
+}
+
+// personalFile returns the stored file key, generating it with render when
+// it doesn't exist yet
+func personalFile(ctx context.Context, key, contentType string, render func() ([]byte, error)) (*storage.Object, error) {
+	for {
+		if obj, err := storage.Open(ctx, StorageCategory, key); err == nil {
+			return obj, nil
+		} else if err != storage.ErrNotFound {
+			log.Printf("[books] Error opening cached copy %s: %v", key, err)
+		}
+
+		inflightMu.Lock()
+		wait, busy := inflight[key]
+		if !busy {
+			done := make(chan struct{})
+			inflight[key] = done
+			inflightMu.Unlock()
+
+			obj, err := generate(ctx, key, contentType, render)
+
+			inflightMu.Lock()
+			delete(inflight, key)
+			inflightMu.Unlock()
+			close(done)
+			return obj, err
+		}
+		inflightMu.Unlock()
+
+		select {
+		case <-wait:
+			// Check the cache again; if generation failed this request tries itself
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// generate renders a student's copy and stores the result under key
+func generate(ctx context.Context, key, contentType string, render func() ([]byte, error)) (*storage.Object, error) {
+	data, err := render()
+	if err != nil {
+		return nil, err
+	}
+
+	// A failed save only costs regenerating the copy on the next request
+	if _, err := storage.Save(ctx, StorageCategory, key, data, contentType); err != nil {
+		log.Printf("[books] Error caching copy %s: %v", key, err)
+		return storage.NewObject(data), nil
+	}
+	if obj, err := storage.Open(ctx, StorageCategory, key); err == nil {
+		return obj, nil
+	}
+	return storage.NewObject(data), nil
+}
+
+// licensee is how a student is named on their copies
+func licensee(sc database.StudentCourse) string {
+	if sc.EnrollmentNumber != nil && *sc.EnrollmentNumber != "" {
+		return fmt.Sprintf("%s (%s)", sc.StudentName, *sc.EnrollmentNumber)
+	}
+	return sc.StudentName
+}
+
+// licenseNotice is the notice on every page or section of a student's copy
+func licenseNotice(sc database.StudentCourse, now time.Time) string {
+	return fmt.Sprintf("Licensed to %s for personal study · Issued %s · Do not distribute",
+		licensee(sc), now.In(clock.Location()).Format("02 Jan 2006 15:04 MST"))
+}
+
+// watermark builds the visible and metadata watermark for a student's copy
+func watermark(sc database.StudentCourse, now time.Time) pdf.Watermark {
+	issued := now.In(clock.Location())
+	info := map[string]string{
+		"LicensedTo":    sc.StudentName,
+		"LicenseID":     fmt.Sprintf("enrollment-%d", sc.EnrollmentID),
+		"WatermarkedAt": issued.Format(time.RFC3339),
+	}
+	if sc.EnrollmentNumber != nil && *sc.EnrollmentNumber != "" {
+		info["EnrollmentNumber"] = *sc.EnrollmentNumber
+	}
+
+	return pdf.Watermark{
+		Text:   licensee(sc),
+		Footer: licenseNotice(sc, now),
+		Info:   info,
+		Date:   now,
+	}
+}
+
+// cacheName is the storage file name of a student's copy. It includes a hash
+// of the source location and the student's identity so a replaced book or a
+// corrected name produces a fresh copy.
+func cacheName(sc database.StudentCourse, category, filename string) string {
+	sum := sha256.Sum256([]byte(category + "/" + filename + "\x00" + licensee(sc)))
+	return fmt.Sprintf("enrollment_%d_%s.pdf", sc.EnrollmentID, hex.EncodeToString(sum[:6]))
+}
@@ -0,0 +1,90 @@
+package books
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestWatermark(t *testing.T) {
+	now := time.Date(2026, 3, 4, 5, 6, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		sc         database.StudentCourse
+		wantText   string
+		wantFooter string
+		wantNumber bool
+	}{
+		{
+			name:       "with enrollment number",
+			sc:         database.StudentCourse{EnrollmentID: 7, StudentName: "Asha Rao", EnrollmentNumber: strPtr("EN2026-01")},
+			wantText:   "Asha Rao (EN2026-01)",
+			wantFooter: "Licensed to Asha Rao (EN2026-01) for personal study · Issued 04 Mar 2026 10:36 IST · Do not distribute",
+			wantNumber: true,
+		},
+		{
+			name:       "without enrollment number",
+			sc:         database.StudentCourse{EnrollmentID: 7, StudentName: "asha"},
+			wantText:   "asha",
+			wantFooter: "Licensed to asha for personal study · Issued 04 Mar 2026 10:36 IST · Do not distribute",
+		},
+		{
+			name:       "empty enrollment number",
+			sc:         database.StudentCourse{EnrollmentID: 7, StudentName: "asha", EnrollmentNumber: strPtr("")},
+			wantText:   "asha",
+			wantFooter: "Licensed to asha for personal study · Issued 04 Mar 2026 10:36 IST · Do not distribute",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wm := watermark(tt.sc, now)
+			if wm.Text != tt.wantText {
+				t.Errorf("Text = %q, want %q", wm.Text, tt.wantText)
+			}
+			if wm.Footer != tt.wantFooter {
+				t.Errorf("Footer = %q, want %q", wm.Footer, tt.wantFooter)
+			}
+			if !wm.Date.Equal(now) {
+				t.Errorf("Date = %v, want %v", wm.Date, now)
+			}
+			if got := wm.Info["LicenseID"]; got != "enrollment-7" {
+				t.Errorf("LicenseID = %q, want enrollment-7", got)
+			}
+			if got := wm.Info["LicensedTo"]; got != tt.sc.StudentName {
+				t.Errorf("LicensedTo = %q, want %q", got, tt.sc.StudentName)
+			}
+			if got := wm.Info["WatermarkedAt"]; got != "2026-03-04T10:36:00+05:30" {
+				t.Errorf("WatermarkedAt = %q", got)
+			}
+			if _, ok := wm.Info["EnrollmentNumber"]; ok != tt.wantNumber {
+				t.Errorf("EnrollmentNumber present = %v, want %v", ok, tt.wantNumber)
+			}
+		})
+	}
+}
+
+func TestCacheName(t *testing.T) {
+	sc := database.StudentCourse{EnrollmentID: 12, StudentName: "Asha Rao", EnrollmentNumber: strPtr("EN1")}
+
+	name := cacheName(sc, "courses", "book.pdf")
+	if !strings.HasPrefix(name, "enrollment_12_") || !strings.HasSuffix(name, ".pdf") {
+		t.Fatalf("cacheName = %q", name)
+	}
+	if again := cacheName(sc, "courses", "book.pdf"); again != name {
+		t.Errorf("cacheName not stable: %q vs %q", again, name)
+	}
+	if other := cacheName(sc, "courses", "book-v2.pdf"); other == name {
+		t.Error("cacheName should change with the source book")
+	}
+	renamed := sc
+	renamed.StudentName = "Asha R. Rao"
+	if other := cacheName(renamed, "courses", "book.pdf"); other == name {
+		t.Error("cacheName should change with the student's name")
+	}
+}
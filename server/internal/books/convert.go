@@ -0,0 +1,228 @@
+package books
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+	"github.com/server/internal/pdf"
+	"github.com/server/internal/storage"
+)
+
+const (
+	// convertTimeout bounds converting one course book to every format
+	convertTimeout = 10 * time.Minute
+	// staleConversion is how long a conversion can be processing before it
+	// is assumed lost with a stopped server and queued again
+	staleConversion = 30 * time.Minute
+)
+
+// ConverterJob is the name of the background job that converts queued books
+const ConverterJob = "convert_course_books"
+
+// errNotInStorage is reported for books linked from outside our storage
+var errNotInStorage = errors.New("book is not in server storage")
+
+// QueueConversion queues the accessible formats of a course's book for
+// conversion after its PDF was uploaded or replaced
+func QueueConversion(ctx context.Context, courseID int) {
+	n, err := database.SyncCourseBookFormats(ctx, &courseID)
+	if err != nil {
+		log.Printf("[books] Failed to queue conversion of course %d: %v", courseID, err)
+		return
+	}
+	if n > 0 {
+		Wake(ctx)
+	}
+}
+
+// Wake has the converter job run on queued conversions without waiting for
+// its next scheduled run
+func Wake(ctx context.Context) {
+	if err := database.RunJobSoon(ctx, ConverterJob); err != nil {
+		log.Printf("[books] Failed to wake the converter: %v", err)
+	}
+}
+
+// Run queues books that were added or replaced and converts every pending
+// book. Returns the number of books converted or attempted.
+func Run(ctx context.Context) (int, error) {
+	syncCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	n, err := database.SyncCourseBookFormats(syncCtx, nil)
+	cancel()
+	if err != nil {
+		log.Printf("[books] Failed to sync course book formats: %v", err)
+	} else if n > 0 {
+		log.Printf("[books] Queued %d book formats for conversion", n)
+	}
+
+	converted := 0
+	for ctx.Err() == nil {
+		claimCtx, cancel := context.WithTimeout(ctx, time.Minute)
+		job, err := database.ClaimBookConversion(claimCtx, clock.Now().Add(-staleConversion))
+		cancel()
+		if err != nil {
+			return converted, fmt.Errorf("claim a book conversion: %w", err)
+		}
+		if job == nil {
+			break
+		}
+
+		jobCtx, cancel := context.WithTimeout(ctx, convertTimeout)
+		Convert(jobCtx, job)
+		cancel()
+		converted++
+	}
+	return converted, ctx.Err()
+}
+
+// Convert generates the claimed formats of a course book, storing each next
+// to the original PDF. Failures are recorded per format and reported to admins.
+func Convert(ctx context.Context, job *database.BookConversion) {
+	log.Printf("[books] Converting course %d book to %s", job.CourseID, strings.Join(job.Formats, ", "))
+
+	fail := func(formats []string, err error) {
+		reason := failureReason(err)
+		var failed []string
+		for _, format := range formats {
+			ok, dbErr := database.FailBookFormat(ctx, job.CourseID, format, job.Source, reason)
+			if dbErr != nil {
+				log.Printf("[books] Failed to record %s failure for course %d: %v", format, job.CourseID, dbErr)
+				continue
+			}
+			if ok {
+				failed = append(failed, format)
+			}
+		}
+		log.Printf("[books] Course %d book conversion failed: %v", job.CourseID, err)
+		if len(failed) > 0 {
+			notifyFailure(ctx, job, failed, reason)
+		}
+	}
+
+	category, filename, ok := storage.Locate(job.Source)
+	if !ok {
+		fail(job.Formats, errNotInStorage)
+		return
+	}
+	src, err := storage.Read(ctx, category, filename)
+	if err != nil {
+		fail(job.Formats, err)
+		return
+	}
+	content, err := pdf.Extract(src)
+	if err != nil {
+		fail(job.Formats, err)
+		return
+	}
+
+	ed := bookEdition(job, content)
+	base := strings.TrimSuffix(filename, path.Ext(filename))
+	var failed []string
+	var lastErr error
+	for _, format := range job.Formats {
+		var data []byte
+		switch format {
+		case database.BookFormatText:
+			data = renderText(content, ed)
+		case database.BookFormatHTML:
+			data = renderHTML(content, ed)
+		case database.BookFormatEPUB:
+			data, err = renderEPUB(content, ed)
+		default:
+			err = fmt.Errorf("unknown format %q", format)
+		}
+		if err == nil {
+			name := base + "." + format
+			var url string
+			if url, err = storage.Save(ctx, category, name, data, ContentTypes[format]); err == nil {
+				err = database.CompleteBookFormat(ctx, job.CourseID, format, job.Source, name, url, int64(len(data)))
+			}
+		}
+		if err != nil {
+			failed = append(failed, format)
+			lastErr = err
+			err = nil
+		}
+	}
+	if len(failed) > 0 {
+		fail(failed, lastErr)
+		return
+	}
+	log.Printf("[books] Course %d book converted", job.CourseID)
+}
+
+// bookEdition describes a course book from its document information,
+// falling back to the course details
+func bookEdition(job *database.BookConversion, c *pdf.Content) edition {
+	sum := sha256.Sum256([]byte(job.Source))
+	ed := edition{
+		ID:       fmt.Sprintf("urn:odi:course-book:%d:%s", job.CourseID, hex.EncodeToString(sum[:6])),
+		Title:    c.Title,
+		Author:   c.Author,
+		Language: c.Language,
+		Modified: clock.Now(),
+	}
+	if ed.Title == "" {
+		ed.Title = job.CourseName
+	}
+	if ed.Author == "" && job.Author != nil {
+		ed.Author = *job.Author
+	}
+	if ed.Language == "" {
+		ed.Language = "en"
+	}
+	return ed
+}
+
+// failureReason explains a conversion failure to admins
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, errNotInStorage):
+		return "The book is linked from outside server storage; upload the PDF to convert it."
+	case errors.Is(err, storage.ErrNotFound):
+		return "The book PDF could not be found in storage."
+	case errors.Is(err, pdf.ErrEncrypted):
+		return "The PDF is password protected; upload an unprotected copy."
+	case errors.Is(err, pdf.ErrNoText):
+		return "No text could be extracted. The PDF appears to be scanned images and needs OCR before it can be converted."
+	}
+	return "Conversion failed: " + err.Error()
+}
+
+// notifyFailure emails every admin about formats that could not be generated
+func notifyFailure(ctx context.Context, job *database.BookConversion, formats []string, reason string) {
+	recipients, err := database.GetAdminRecipients(ctx)
+	if err != nil {
+		log.Printf("[books] Failed to load admins to notify about course %d: %v", job.CourseID, err)
+		return
+	}
+
+	subject := fmt.Sprintf("Book conversion failed for %s (%s)", job.CourseName, job.CourseCode)
+	body := fmt.Sprintf("The accessible formats (%s) of the book for %s (%s) could not be generated.\n\nReason: %s\n\n"+
+		"Retry the conversion from the admin dashboard once the problem is fixed.\n",
+		strings.Join(formats, ", "), job.CourseName, job.CourseCode, reason)
+
+	for _, r := range recipients {
+		userID := r.UserID
+		err := email.Send(ctx, email.Message{
+			To:      r.Email,
+			UserID:  &userID,
+			Subject: subject,
+			Body:    fmt.Sprintf("Hello %s,\n\n%s", r.Name, body),
+			Type:    "book_conversion",
+		})
+		if err != nil {
+			log.Printf("[books] Failed to notify %s about course %d: %v", r.Email, job.CourseID, err)
+		}
+	}
+}
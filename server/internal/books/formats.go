@@ -0,0 +1,446 @@
+package books
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/pdf"
+)
+
+// ContentTypes maps each accessible format to its MIME type
+var ContentTypes = map[string]string{
+	database.BookFormatText: "text/plain; charset=utf-8",
+	database.BookFormatHTML: "text/html; charset=utf-8",
+	database.BookFormatEPUB: "application/epub+zip",
+}
+
+// edition describes the book a format is rendered for
+type edition struct {
+	ID       string // Stable identifier of the source book
+	Title    string
+	Author   string
+	Language string
+	Modified time.Time
+}
+
+// tocEntry is an entry of a table of contents
+type tocEntry struct {
+	Level int
+	Title string
+	Page  int    // Index of the page the entry starts on
+	ID    string // Anchor of a heading, or "" to link to the page
+}
+
+// pageID is the anchor of a page break
+func pageID(page int) string {
+	return fmt.Sprintf("page-%d", page+1)
+}
+
+// headingID is the anchor of a heading block
+func headingID(page, block int) string {
+	return fmt.Sprintf("h-%d-%d", page+1, block+1)
+}
+
+// tableOfContents lists the document's bookmarks, or its headings when it
+// has no bookmarks
+func tableOfContents(c *pdf.Content) []tocEntry {
+	var entries []tocEntry
+	for _, o := range c.Outline {
+		if o.Page >= 0 {
+			entries = append(entries, tocEntry{Level: o.Level, Title: o.Title, Page: o.Page})
+		}
+	}
+	if len(entries) > 0 {
+		return entries
+	}
+	for p, page := range c.Pages {
+		for i, b := range page.Blocks {
+			if b.Level == 1 || b.Level == 2 {
+				entries = append(entries, tocEntry{Level: b.Level, Title: b.Text, Page: p, ID: headingID(p, i)})
+			}
+		}
+	}
+	return entries
+}
+
+// renderText renders a book as plain text: one paragraph per line, blank
+// lines between blocks and a marker at the start of each printed page
+func renderText(c *pdf.Content, ed edition) []byte {
+	var b strings.Builder
+	b.WriteString(ed.Title + "\n")
+	if ed.Author != "" {
+		b.WriteString("by " + ed.Author + "\n")
+	}
+	for p, page := range c.Pages {
+		fmt.Fprintf(&b, "\n[Page %d]\n", p+1)
+		for _, block := range page.Blocks {
+			b.WriteString("\n")
+			if block.ListItem {
+				b.WriteString("- ")
+			}
+			b.WriteString(block.Text + "\n")
+		}
+	}
+	return []byte(b.String())
+}
+
+// htmlStyle keeps the HTML and EPUB formats readable when enlarged
+const htmlStyle = `body { max-width: 42em; margin: 0 auto; padding: 1em; font-family: sans-serif; line-height: 1.6; }
+.pagebreak { display: block; margin: 2em 0 0.5em; color: #555; font-size: 0.85em; border-top: 1px solid #ccc; }
+.license { color: #555; font-size: 0.85em; }
+`
+
+// writeTOC writes entries as nested ordered lists
+func writeTOC(b *strings.Builder, entries []tocEntry, href func(tocEntry) string) {
+	depth := 0
+	for _, e := range entries {
+		// Levels can only go one deeper at a time
+		level := max(min(e.Level, depth+1), 1)
+		if level > depth {
+			b.WriteString("<ol>")
+			depth = level
+		} else {
+			b.WriteString("</li>")
+			for ; depth > level; depth-- {
+				b.WriteString("</ol></li>")
+			}
+		}
+		fmt.Fprintf(b, "\n<li><a href=\"%s\">%s</a>", html.EscapeString(href(e)), html.EscapeString(e.Title))
+	}
+	for ; depth > 0; depth-- {
+		b.WriteString("</li></ol>")
+	}
+	b.WriteString("\n")
+}
+
+// writePages writes the blocks of pages [from, to) as HTML. Extracted
+// heading levels are shifted down one, below the book title.
+func writePages(b *strings.Builder, c *pdf.Content, from, to int, epub bool) {
+	for p := from; p < to; p++ {
+		label := fmt.Sprintf("Page %d", p+1)
+		if epub {
+			fmt.Fprintf(b, "<span class=\"pagebreak\" epub:type=\"pagebreak\" role=\"doc-pagebreak\" id=\"%s\" aria-label=\"%s\">%s</span>\n", pageID(p), label, label)
+		} else {
+			fmt.Fprintf(b, "<span class=\"pagebreak\" role=\"doc-pagebreak\" id=\"%s\" aria-label=\"%s\">%s</span>\n", pageID(p), label, label)
+		}
+
+		inList := false
+		for i, block := range c.Pages[p].Blocks {
+			if block.ListItem != inList {
+				if inList {
+					b.WriteString("</ul>\n")
+				} else {
+					b.WriteString("<ul>\n")
+				}
+				inList = block.ListItem
+			}
+			text := html.EscapeString(block.Text)
+			switch {
+			case block.ListItem:
+				fmt.Fprintf(b, "<li>%s</li>\n", text)
+			case block.Level > 0:
+				fmt.Fprintf(b, "<h%d id=\"%s\">%s</h%d>\n", block.Level+1, headingID(p, i), text, block.Level+1)
+			default:
+				fmt.Fprintf(b, "<p>%s</p>\n", text)
+			}
+		}
+		if inList {
+			b.WriteString("</ul>\n")
+		}
+	}
+}
+
+// renderHTML renders a book as a single HTML page with a table of contents
+// and page break markers screen readers can navigate by
+func renderHTML(c *pdf.Content, ed edition) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!DOCTYPE html>\n<html lang=\"%s\">\n<head>\n<meta charset=\"utf-8\">\n", html.EscapeString(ed.Language))
+	b.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n", html.EscapeString(ed.Title), htmlStyle)
+
+	fmt.Fprintf(&b, "<header>\n<h1>%s</h1>\n", html.EscapeString(ed.Title))
+	if ed.Author != "" {
+		fmt.Fprintf(&b, "<p>by %s</p>\n", html.EscapeString(ed.Author))
+	}
+	b.WriteString("</header>\n")
+
+	if toc := tableOfContents(c); len(toc) > 0 {
+		b.WriteString("<nav role=\"doc-toc\" aria-labelledby=\"toc-title\">\n<h2 id=\"toc-title\">Contents</h2>\n")
+		writeTOC(&b, toc, func(e tocEntry) string {
+			if e.ID != "" {
+				return "#" + e.ID
+			}
+			return "#" + pageID(e.Page)
+		})
+		b.WriteString("</nav>\n")
+	}
+
+	b.WriteString("<main>\n")
+	writePages(&b, c, 0, len(c.Pages), false)
+	b.WriteString("</main>\n</body>\n</html>\n")
+	return []byte(b.String())
+}
+
+// chapter is a range of pages rendered as one EPUB content document
+type chapter struct {
+	Title      string
+	First, End int // Pages [First, End)
+}
+
+// chapters splits a book at its top-level bookmarks, or at its top-level
+// headings when it has no bookmarks
+func chapters(c *pdf.Content, title string) []chapter {
+	var starts []chapter
+	add := func(page int, name string) {
+		if len(starts) > 0 && starts[len(starts)-1].First >= page {
+			return
+		}
+		starts = append(starts, chapter{Title: name, First: page})
+	}
+	for _, o := range c.Outline {
+		if o.Level == 1 && o.Page >= 0 {
+			add(o.Page, o.Title)
+		}
+	}
+	if len(starts) == 0 {
+		for p, page := range c.Pages {
+			for _, b := range page.Blocks {
+				if b.Level == 1 {
+					add(p, b.Text)
+					break
+				}
+			}
+		}
+	}
+
+	if len(starts) == 0 || starts[0].First > 0 {
+		starts = append([]chapter{{Title: title, First: 0}}, starts...)
+	}
+	for i := range starts {
+		if i+1 < len(starts) {
+			starts[i].End = starts[i+1].First
+		} else {
+			starts[i].End = len(c.Pages)
+		}
+	}
+	return starts
+}
+
+// chapterFile is the content document name of a chapter
+func chapterFile(i int) string {
+	return fmt.Sprintf("chapter-%03d.xhtml", i+1)
+}
+
+// xhtmlDocument wraps body content in an EPUB content document
+func xhtmlDocument(title, language, body string) string {
+	return fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE html>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops" lang="%[2]s" xml:lang="%[2]s">
+<head>
+<meta charset="utf-8"/>
+<title>%[1]s</title>
+<link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+%[3]s</body>
+</html>
+`, html.EscapeString(title), html.EscapeString(language), body)
+}
+
+// renderEPUB renders a book as an EPUB 3 publication split into chapters,
+// with a navigation document listing the contents and printed page numbers
+func renderEPUB(c *pdf.Content, ed edition) ([]byte, error) {
+	chs := chapters(c, ed.Title)
+	pageChapter := make([]int, len(c.Pages))
+	for i, ch := range chs {
+		for p := ch.First; p < ch.End; p++ {
+			pageChapter[p] = i
+		}
+	}
+
+	files := []struct {
+		name, body string
+	}{
+		{"META-INF/container.xml", `<?xml version="1.0" encoding="utf-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+<rootfiles>
+<rootfile full-path="EPUB/package.opf" media-type="application/oebps-package+xml"/>
+</rootfiles>
+</container>
+`},
+		{"EPUB/style.css", htmlStyle},
+	}
+
+	// Navigation document: table of contents and page list
+	var nav strings.Builder
+	nav.WriteString("<nav epub:type=\"toc\" role=\"doc-toc\" id=\"toc\">\n<h1>Contents</h1>\n")
+	toc := tableOfContents(c)
+	if len(toc) == 0 {
+		for _, ch := range chs {
+			toc = append(toc, tocEntry{Level: 1, Title: ch.Title, Page: ch.First})
+		}
+	}
+	writeTOC(&nav, toc, func(e tocEntry) string {
+		anchor := e.ID
+		if anchor == "" {
+			anchor = pageID(e.Page)
+		}
+		return chapterFile(pageChapter[e.Page]) + "#" + anchor
+	})
+	nav.WriteString("</nav>\n<nav epub:type=\"page-list\" role=\"doc-pagelist\" id=\"page-list\" hidden=\"hidden\">\n<h1>Pages</h1>\n<ol>\n")
+	for p := range c.Pages {
+		fmt.Fprintf(&nav, "<li><a href=\"%s#%s\">%d</a></li>\n", chapterFile(pageChapter[p]), pageID(p), p+1)
+	}
+	nav.WriteString("</ol>\n</nav>\n")
+	files = append(files, struct{ name, body string }{"EPUB/nav.xhtml", xhtmlDocument(ed.Title, ed.Language, nav.String())})
+
+	var manifest, spine strings.Builder
+	for i, ch := range chs {
+		var body strings.Builder
+		if i == 0 {
+			fmt.Fprintf(&body, "<h1>%s</h1>\n", html.EscapeString(ed.Title))
+			if ed.Author != "" {
+				fmt.Fprintf(&body, "<p>by %s</p>\n", html.EscapeString(ed.Author))
+			}
+		}
+		writePages(&body, c, ch.First, ch.End, true)
+		files = append(files, struct{ name, body string }{"EPUB/" + chapterFile(i), xhtmlDocument(ch.Title, ed.Language, body.String())})
+		fmt.Fprintf(&manifest, "<item id=\"ch%d\" href=\"%s\" media-type=\"application/xhtml+xml\"/>\n", i+1, chapterFile(i))
+		fmt.Fprintf(&spine, "<itemref idref=\"ch%d\"/>\n", i+1)
+	}
+
+	creator := ""
+	if ed.Author != "" {
+		creator = fmt.Sprintf("<dc:creator>%s</dc:creator>\n", html.EscapeString(ed.Author))
+	}
+	pkg := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%[3]s">
+<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:identifier id="book-id">%[1]s</dc:identifier>
+<dc:title>%[2]s</dc:title>
+<dc:language>%[3]s</dc:language>
+%[4]s<meta property="dcterms:modified">%[5]s</meta>
+<meta property="schema:accessMode">textual</meta>
+<meta property="schema:accessModeSufficient">textual</meta>
+<meta property="schema:accessibilityFeature">structuralNavigation</meta>
+<meta property="schema:accessibilityFeature">tableOfContents</meta>
+<meta property="schema:accessibilityFeature">printPageNumbers</meta>
+<meta property="schema:accessibilityHazard">none</meta>
+<meta property="schema:accessibilitySummary">Text converted from the printed edition, with headings, a table of contents and page numbers for navigation. Images are not included.</meta>
+</metadata>
+<manifest>
+<item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+<item id="style" href="style.css" media-type="text/css"/>
+%[6]s</manifest>
+<spine>
+%[7]s</spine>
+</package>
+`, html.EscapeString(ed.ID), html.EscapeString(ed.Title), html.EscapeString(ed.Language), creator,
+		ed.Modified.UTC().Format("2006-01-02T15:04:05Z"), manifest.String(), spine.String())
+	files = append(files, struct{ name, body string }{"EPUB/package.opf", pkg})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// The mimetype entry must come first and be stored uncompressed
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write([]byte("application/epub+zip")); err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: ed.Modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(f.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// license embeds a student's licence notice in a converted format: at the
+// start and end of the text and HTML versions, and at the start of every
+// EPUB chapter with the rights in the package metadata
+func license(format string, data []byte, sc database.StudentCourse, now time.Time) ([]byte, error) {
+	notice := licenseNotice(sc, now)
+	switch format {
+	case database.BookFormatText:
+		return []byte(notice + "\n\n" + string(data) + "\n" + notice + "\n"), nil
+	case database.BookFormatHTML:
+		doc := string(data)
+		doc = strings.Replace(doc, "<meta charset=\"utf-8\">\n",
+			fmt.Sprintf("<meta charset=\"utf-8\">\n<meta name=\"rights\" content=\"%s\">\n", html.EscapeString(notice)), 1)
+		doc = insertNotice(doc, notice, true)
+		return []byte(doc), nil
+	case database.BookFormatEPUB:
+		return licenseEPUB(data, notice)
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// insertNotice adds the licence notice at the start of an HTML body, and at
+// its end too if atEnd is set
+func insertNotice(doc, notice string, atEnd bool) string {
+	p := fmt.Sprintf("<p class=\"license\" role=\"note\">%s</p>\n", html.EscapeString(notice))
+	doc = strings.Replace(doc, "<body>\n", "<body>\n"+p, 1)
+	if i := strings.LastIndex(doc, "</body>"); atEnd && i >= 0 {
+		doc = doc[:i] + p + doc[i:]
+	}
+	return doc
+}
+
+// licenseEPUB copies an EPUB publication, adding the notice to its chapters
+// and package metadata
+func licenseEPUB(data []byte, notice string) ([]byte, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case f.Name == "EPUB/package.opf":
+			body = []byte(strings.Replace(string(body), "</metadata>",
+				fmt.Sprintf("<dc:rights>%s</dc:rights>\n</metadata>", html.EscapeString(notice)), 1))
+		case strings.HasPrefix(f.Name, "EPUB/chapter-"):
+			body = []byte(insertNotice(string(body), notice, false))
+		}
+
+		// Keeps the mimetype entry first and stored uncompressed
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.Name, Method: f.Method, Modified: f.Modified})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(body); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,246 @@
+package books
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/pdf"
+)
+
+func testContent() *pdf.Content {
+	return &pdf.Content{
+		Title: "Algebra Notes",
+		Pages: []pdf.PageContent{
+			{Blocks: []pdf.Block{{Text: "Preface & thanks."}}},
+			{Blocks: []pdf.Block{
+				{Level: 1, Text: "Chapter 1"},
+				{Text: "Linear equations."},
+				{ListItem: true, Text: "First <point>"},
+				{ListItem: true, Text: "Second point"},
+				{Level: 2, Text: "1.1 Examples"},
+			}},
+			{Blocks: []pdf.Block{{Level: 1, Text: "Chapter 2"}, {Text: "Quadratics."}}},
+		},
+	}
+}
+
+var testEdition = edition{
+	ID:       "urn:odi:course-book:3:abc",
+	Title:    "Algebra Notes",
+	Author:   "R. Sharma",
+	Language: "en",
+	Modified: time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+}
+
+func TestRenderText(t *testing.T) {
+	got := string(renderText(testContent(), testEdition))
+	want := `Algebra Notes
+by R. Sharma
+
+[Page 1]
+
+Preface & thanks.
+
+[Page 2]
+
+Chapter 1
+
+Linear equations.
+
+- First <point>
+
+- Second point
+
+1.1 Examples
+
+[Page 3]
+
+Chapter 2
+
+Quadratics.
+`
+	if got != want {
+		t.Errorf("renderText() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestRenderHTML(t *testing.T) {
+	got := string(renderHTML(testContent(), testEdition))
+	for _, want := range []string{
+		`<html lang="en">`,
+		`<h1>Algebra Notes</h1>`,
+		`<li><a href="#h-2-1">Chapter 1</a><ol>`,
+		`<li><a href="#h-2-5">1.1 Examples</a></li></ol></li>`,
+		`<span class="pagebreak" role="doc-pagebreak" id="page-2" aria-label="Page 2">Page 2</span>`,
+		`<h2 id="h-2-1">Chapter 1</h2>`,
+		"<ul>\n<li>First &lt;point&gt;</li>\n<li>Second point</li>\n</ul>\n<h3 id=\"h-2-5\">",
+		`<p>Preface &amp; thanks.</p>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("renderHTML() missing %q", want)
+		}
+	}
+}
+
+func TestWriteTOC(t *testing.T) {
+	entries := []tocEntry{
+		{Level: 1, Title: "A"},
+		{Level: 3, Title: "A.1"}, // Skipped levels nest one deeper
+		{Level: 2, Title: "A.2"},
+		{Level: 1, Title: "B"},
+	}
+	var b strings.Builder
+	writeTOC(&b, entries, func(e tocEntry) string { return "#" + e.Title })
+
+	want := `<ol>
+<li><a href="#A">A</a><ol>
+<li><a href="#A.1">A.1</a></li>
+<li><a href="#A.2">A.2</a></li></ol></li>
+<li><a href="#B">B</a></li></ol>
+`
+	if b.String() != want {
+		t.Errorf("writeTOC() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestChapters(t *testing.T) {
+	c := testContent()
+	want := []chapter{
+		{Title: "Algebra Notes", First: 0, End: 1},
+		{Title: "Chapter 1", First: 1, End: 2},
+		{Title: "Chapter 2", First: 2, End: 3},
+	}
+	if got := chapters(c, "Algebra Notes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters() = %+v, want %+v", got, want)
+	}
+
+	// Bookmarks take precedence over headings
+	c.Outline = []pdf.OutlineEntry{
+		{Title: "Part I", Level: 1, Page: 0},
+		{Title: "Section", Level: 2, Page: 1},
+		{Title: "Part II", Level: 1, Page: 2},
+	}
+	want = []chapter{
+		{Title: "Part I", First: 0, End: 2},
+		{Title: "Part II", First: 2, End: 3},
+	}
+	if got := chapters(c, "Algebra Notes"); !reflect.DeepEqual(got, want) {
+		t.Errorf("chapters() with outline = %+v, want %+v", got, want)
+	}
+}
+
+func TestRenderEPUB(t *testing.T) {
+	data, err := renderEPUB(testContent(), testEdition)
+	if err != nil {
+		t.Fatalf("renderEPUB() error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry = %s (method %d), want stored mimetype", first.Name, first.Method)
+	}
+	if !bytes.HasPrefix(data[30:], []byte("mimetypeapplication/epub+zip")) {
+		t.Error("mimetype content does not follow its local header")
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+
+		// Every document must be well-formed XML
+		if f.Name == "mimetype" || strings.HasSuffix(f.Name, ".css") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		d := xml.NewDecoder(bytes.NewReader(body))
+		d.Strict = true
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Errorf("%s is not well-formed: %v", f.Name, err)
+				break
+			}
+		}
+	}
+	want := []string{
+		"mimetype",
+		"META-INF/container.xml",
+		"EPUB/style.css",
+		"EPUB/nav.xhtml",
+		"EPUB/chapter-001.xhtml",
+		"EPUB/chapter-002.xhtml",
+		"EPUB/chapter-003.xhtml",
+		"EPUB/package.opf",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %q, want %q", names, want)
+	}
+}
+
+func TestLicense(t *testing.T) {
+	sc := database.StudentCourse{EnrollmentID: 7, StudentName: "Asha Rao", EnrollmentNumber: strPtr("EN2026-01")}
+	now := time.Date(2026, 3, 4, 5, 6, 0, 0, time.UTC)
+	want := "Licensed to Asha Rao (EN2026-01)"
+
+	text, err := license(database.BookFormatText, renderText(testContent(), testEdition), sc, now)
+	if err != nil {
+		t.Fatalf("license(txt) error = %v", err)
+	}
+	if !strings.HasPrefix(string(text), want) || strings.Count(string(text), want) != 2 {
+		t.Errorf("text copy should start and end with the notice:\n%s", text)
+	}
+
+	page, err := license(database.BookFormatHTML, renderHTML(testContent(), testEdition), sc, now)
+	if err != nil {
+		t.Fatalf("license(html) error = %v", err)
+	}
+	if !strings.Contains(string(page), `<meta name="rights" content="`+want) || strings.Count(string(page), `<p class="license" role="note">`+want) != 2 {
+		t.Errorf("HTML copy is missing the notice:\n%s", page)
+	}
+
+	master, err := renderEPUB(testContent(), testEdition)
+	if err != nil {
+		t.Fatalf("renderEPUB() error = %v", err)
+	}
+	data, err := license(database.BookFormatEPUB, master, sc, now)
+	if err != nil {
+		t.Fatalf("license(epub) error = %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	if first := zr.File[0]; first.Name != "mimetype" || first.Method != zip.Store {
+		t.Errorf("first entry = %s (method %d), want stored mimetype", first.Name, first.Method)
+	}
+	for _, f := range zr.File {
+		if f.Name != "EPUB/package.opf" && !strings.HasPrefix(f.Name, "EPUB/chapter-") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("Open(%s) error = %v", f.Name, err)
+		}
+		body, _ := io.ReadAll(rc)
+		rc.Close()
+		if !strings.Contains(string(body), want) {
+			t.Errorf("%s is missing the notice", f.Name)
+		}
+	}
+}
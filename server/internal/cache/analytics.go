@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	analyticsPrefix     = "analytics:ride_bills:"
+	analyticsVersionKey = analyticsPrefix + "version"
+	analyticsTTL        = 10 * time.Minute
+)
+
+var (
+	// ErrCacheUnavailable is returned when Redis has not been connected
+	ErrCacheUnavailable = errors.New("cache unavailable")
+	// ErrAnalyticsMiss is returned when no analytics result is cached for a query
+	ErrAnalyticsMiss = errors.New("analytics not cached")
+)
+
+// Cached analytics are keyed by a version number. Any change to ride bills or
+// payments bumps the version, so stale results are never read and simply expire.
+
+// analyticsKey builds the cache key for a query at a given version
+func analyticsKey(version int64, query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return analyticsPrefix + "v" + strconv.FormatInt(version, 10) + ":" + hex.EncodeToString(sum[:16])
+}
+
+// analyticsVersion returns the current analytics cache version
+func analyticsVersion(ctx context.Context) (int64, error) {
+	if client == nil {
+		return 0, ErrCacheUnavailable
+	}
+	version, err := client.Get(ctx, analyticsVersionKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return 0, err
+	}
+	return version, nil
+}
+
+// GetRideBillAnalytics loads a cached analytics result for query into dest.
+// It returns the cache version it looked at: on ErrAnalyticsMiss the result
+// should be computed and stored at that version, so a change to the bills
+// made while it was being computed invalidates it.
+func GetRideBillAnalytics(ctx context.Context, query string, dest interface{}) (int64, error) {
+	version, err := analyticsVersion(ctx)
+	if err != nil {
+		return 0, err
+	}
+	data, err := client.Get(ctx, analyticsKey(version, query)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return version, ErrAnalyticsMiss
+	}
+	if err != nil {
+		return version, err
+	}
+	return version, json.Unmarshal(data, dest)
+}
+
+// SetRideBillAnalytics caches an analytics result for query at the version
+// returned by GetRideBillAnalytics before the result was computed
+func SetRideBillAnalytics(ctx context.Context, version int64, query string, data interface{}) error {
+	if client == nil {
+		return ErrCacheUnavailable
+	}
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, analyticsKey(version, query), jsonData, analyticsTTL).Err()
+}
+
+// InvalidateRideBillAnalytics discards all cached ride bill analytics
+func InvalidateRideBillAnalytics(ctx context.Context) error {
+	if client == nil {
+		return ErrCacheUnavailable
+	}
+	return client.Incr(ctx, analyticsVersionKey).Err()
+}
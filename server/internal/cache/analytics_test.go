@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAnalyticsKey(t *testing.T) {
+	key := analyticsKey(3, "groupBy=route&from=2026-01-01")
+
+	if !strings.HasPrefix(key, "analytics:ride_bills:v3:") {
+		t.Errorf("Expected versioned analytics key, got %s", key)
+	}
+	if key != analyticsKey(3, "groupBy=route&from=2026-01-01") {
+		t.Error("Expected the same query to produce the same key")
+	}
+	if key == analyticsKey(4, "groupBy=route&from=2026-01-01") {
+		t.Error("Expected a new version to produce a different key")
+	}
+	if key == analyticsKey(3, "groupBy=driver&from=2026-01-01") {
+		t.Error("Expected different queries to produce different keys")
+	}
+}
+
+func TestAnalyticsWithoutClient(t *testing.T) {
+	ctx := context.Background()
+	var dest map[string]interface{}
+
+	if _, err := GetRideBillAnalytics(ctx, "q", &dest); err != ErrCacheUnavailable {
+		t.Errorf("Expected ErrCacheUnavailable, got %v", err)
+	}
+	if err := SetRideBillAnalytics(ctx, 0, "q", dest); err != ErrCacheUnavailable {
+		t.Errorf("Expected ErrCacheUnavailable, got %v", err)
+	}
+	if err := InvalidateRideBillAnalytics(ctx); err != ErrCacheUnavailable {
+		t.Errorf("Expected ErrCacheUnavailable, got %v", err)
+	}
+}
+
+func TestIncidentsWithoutClient(t *testing.T) {
+	ctx := context.Background()
+
+	if err := PublishIncident(ctx, map[string]int{"id": 1}); err != ErrCacheUnavailable {
+		t.Errorf("Expected ErrCacheUnavailable, got %v", err)
+	}
+	if _, err := SubscribeIncidents(ctx); err != ErrCacheUnavailable {
+		t.Errorf("Expected ErrCacheUnavailable, got %v", err)
+	}
+}
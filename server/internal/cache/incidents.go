@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// incidentChannel is the pub/sub channel new and updated incidents are published on
+const incidentChannel = "incidents"
+
+// PublishIncident broadcasts an incident to realtime subscribers
+func PublishIncident(ctx context.Context, incident interface{}) error {
+	if client == nil {
+		return ErrCacheUnavailable
+	}
+	data, err := json.Marshal(incident)
+	if err != nil {
+		return err
+	}
+	return client.Publish(ctx, incidentChannel, data).Err()
+}
+
+// SubscribeIncidents subscribes to incident broadcasts. The caller must close
+// the subscription.
+func SubscribeIncidents(ctx context.Context) (*redis.PubSub, error) {
+	if client == nil {
+		return nil, ErrCacheUnavailable
+	}
+	sub := client.Subscribe(ctx, incidentChannel)
+	// Wait for the subscription to be confirmed so no messages are missed
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	return sub, nil
+}
@@ -3,7 +3,11 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 const (
@@ -43,27 +47,147 @@ func DeleteSession(ctx context.Context, sessionID string) error {
 	return Delete(ctx, key)
 }
 
-// RefreshSession extends the TTL of a session
-func RefreshSession(ctx context.Context, sessionID string, ttl time.Duration) error {
+// RefreshSession replaces the data of an existing session and resets its
+// TTL. A session that was deleted in the meantime (logged out) is not
+// recreated; ok reports whether the session still existed.
+func RefreshSession(ctx context.Context, sessionID string, data interface{}, ttl time.Duration) (ok bool, err error) {
 	if ttl == 0 {
 		ttl = defaultTTL
 	}
 
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
 	key := sessionPrefix + sessionID
-	exists, err := Exists(ctx, key)
+	return client.SetXX(ctx, key, jsonData, ttl).Result()
+}
+
+// userSessionsPrefix keys the set of session IDs each user has. Members can
+// outlive their session, which expires on its own, so readers prune them.
+const userSessionsPrefix = "user_sessions:"
+
+func userSessionsKey(userID int) string {
+	return userSessionsPrefix + strconv.Itoa(userID)
+}
+
+// AddUserSession adds a session to the user's session set
+func AddUserSession(ctx context.Context, userID int, sessionID string) error {
+	return client.SAdd(ctx, userSessionsKey(userID), sessionID).Err()
+}
+
+// RemoveUserSessions removes sessions from the user's session set
+func RemoveUserSessions(ctx context.Context, userID int, sessionIDs ...string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	members := make([]interface{}, len(sessionIDs))
+	for i, id := range sessionIDs {
+		members[i] = id
+	}
+	return client.SRem(ctx, userSessionsKey(userID), members...).Err()
+}
+
+// IsUserSession reports whether a session is in the user's session set
+func IsUserSession(ctx context.Context, userID int, sessionID string) (bool, error) {
+	return client.SIsMember(ctx, userSessionsKey(userID), sessionID).Result()
+}
+
+// GetUserSessionIDs returns the user's live sessions, dropping members of the
+// set whose session has expired
+func GetUserSessionIDs(ctx context.Context, userID int) ([]string, error) {
+	members, err := client.SMembers(ctx, userSessionsKey(userID)).Result()
 	if err != nil {
-		return err
+		return nil, err
+	}
+	live, err := ExistingSessions(ctx, members)
+	if err != nil {
+		return nil, err
 	}
 
-	if !exists {
-		return nil // Session doesn't exist, nothing to refresh
+	ids := make([]string, 0, len(members))
+	var dead []string
+	for _, id := range members {
+		if live[id] {
+			ids = append(ids, id)
+		} else {
+			dead = append(dead, id)
+		}
 	}
+	if err := RemoveUserSessions(ctx, userID, dead...); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
 
-	// Get current value and re-set with new TTL
-	value, err := Get(ctx, key)
+// ExistingSessions reports which of the given sessions exist
+func ExistingSessions(ctx context.Context, sessionIDs []string) (map[string]bool, error) {
+	exists := make(map[string]bool, len(sessionIDs))
+	if len(sessionIDs) == 0 {
+		return exists, nil
+	}
+
+	pipe := client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(sessionIDs))
+	for i, id := range sessionIDs {
+		cmds[i] = pipe.Exists(ctx, sessionPrefix+id)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	for i, id := range sessionIDs {
+		exists[id] = cmds[i].Val() > 0
+	}
+	return exists, nil
+}
+
+// ScanSessions returns a batch of session IDs and the cursor to pass for the
+// next batch; the scan is complete when the returned cursor is 0
+func ScanSessions(ctx context.Context, cursor uint64, count int64) ([]string, uint64, error) {
+	keys, next, err := client.Scan(ctx, cursor, sessionPrefix+"*", count).Result()
 	if err != nil {
-		return err
+		return nil, 0, err
+	}
+	ids := make([]string, len(keys))
+	for i, key := range keys {
+		ids[i] = strings.TrimPrefix(key, sessionPrefix)
+	}
+	return ids, next, nil
+}
+
+// sessionVersionPrefix keys a counter per user that is bumped whenever the
+// user's sessions must pick up changed claims. A session stamped with an
+// older version is stale.
+const sessionVersionPrefix = "session_version:"
+
+// GetSessionVersion returns the user's current session version
+func GetSessionVersion(ctx context.Context, userID int) (int64, error) {
+	version, err := client.Get(ctx, sessionVersionPrefix+strconv.Itoa(userID)).Int64()
+	if err == redis.Nil {
+		return 0, nil
 	}
+	return version, err
+}
 
-	return Set(ctx, key, value, ttl)
+// BumpSessionVersion makes every session of the user stale and returns the
+// new version
+func BumpSessionVersion(ctx context.Context, userID int) (int64, error) {
+	return client.Incr(ctx, sessionVersionPrefix+strconv.Itoa(userID)).Result()
+}
+
+// RewriteSession replaces the data of an existing session, keeping its TTL.
+// ok is false if the session no longer exists.
+func RewriteSession(ctx context.Context, sessionID string, data interface{}) (ok bool, err error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+
+	key := sessionPrefix + sessionID
+	err = client.SetArgs(ctx, key, jsonData, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil, err
 }
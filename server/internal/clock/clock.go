@@ -0,0 +1,131 @@
+// Package clock is the source of the current time and of the institution
+// timezone that calendar dates (expiry days, statement months, shifts) are
+// worked out in.
+package clock
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	// Embed the timezone database so configured zones load on hosts without tzdata
+	_ "time/tzdata"
+)
+
+// DefaultTimezone is the institution timezone when none is configured
+const DefaultTimezone = "Asia/Kolkata"
+
+// Clock tells the current time. Tests replace it with a fixed clock.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+// Fixed returns a clock that is always at t
+func Fixed(t time.Time) Clock {
+	return fixedClock(t)
+}
+
+var (
+	mu       sync.RWMutex
+	current  Clock = systemClock{}
+	location       = mustLoadLocation(DefaultTimezone)
+)
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// LoadLocation loads an IANA timezone such as Europe/London. Empty and
+// "Local" are rejected so the zone never depends on the host's settings.
+func LoadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, errors.New("timezone must be an IANA name such as Asia/Kolkata")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", name)
+	}
+	return loc, nil
+}
+
+// SetLocation sets the institution timezone
+func SetLocation(name string) error {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	location = loc
+	mu.Unlock()
+	return nil
+}
+
+// Location returns the institution timezone
+func Location() *time.Location {
+	mu.RLock()
+	defer mu.RUnlock()
+	return location
+}
+
+// UserLocation returns a user's preferred timezone, or the institution
+// timezone when they have none or it no longer loads
+func UserLocation(name *string) *time.Location {
+	if name != nil {
+		if loc, err := LoadLocation(*name); err == nil {
+			return loc
+		}
+	}
+	return Location()
+}
+
+// Set replaces the clock, returning a function that restores the previous one
+func Set(c Clock) (restore func()) {
+	mu.Lock()
+	previous := current
+	current = c
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		current = previous
+		mu.Unlock()
+	}
+}
+
+// Now returns the current time in the institution timezone
+func Now() time.Time {
+	mu.RLock()
+	c, loc := current, location
+	mu.RUnlock()
+	return c.Now().In(loc)
+}
+
+// StartOfDay returns midnight at the start of t's day in the institution timezone
+func StartOfDay(t time.Time) time.Time {
+	t = t.In(Location())
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// Today returns midnight at the start of the current day in the institution timezone
+func Today() time.Time {
+	return StartOfDay(Now())
+}
+
+// EndOfDay returns the last second (23:59:59) of a calendar date in the
+// institution timezone. Only the year, month and day of date are used, so a
+// date parsed from YYYY-MM-DD means that day at the institution.
+func EndOfDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 23, 59, 59, 0, Location())
+}
@@ -0,0 +1,93 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{"Asia/Kolkata", false},
+		{"America/New_York", false},
+		{"UTC", false},
+		{"", true},
+		{"Local", true},
+		{"Mars/Olympus_Mons", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadLocation(tt.name); (err != nil) != tt.wantErr {
+				t.Errorf("LoadLocation(%q) error = %v, want error %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEndOfDay(t *testing.T) {
+	defer func() {
+		if err := SetLocation(DefaultTimezone); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	date := time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		timezone string
+		want     time.Time
+	}{
+		{"Asia/Kolkata", time.Date(2026, 3, 31, 18, 29, 59, 0, time.UTC)},
+		{"Europe/London", time.Date(2026, 3, 31, 22, 59, 59, 0, time.UTC)}, // BST
+		{"America/Chicago", time.Date(2026, 4, 1, 4, 59, 59, 0, time.UTC)}, // CDT
+	}
+	for _, tt := range tests {
+		t.Run(tt.timezone, func(t *testing.T) {
+			if err := SetLocation(tt.timezone); err != nil {
+				t.Fatal(err)
+			}
+			if got := EndOfDay(date); !got.Equal(tt.want) {
+				t.Errorf("EndOfDay() = %v, want %v", got.UTC(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNowAndToday(t *testing.T) {
+	defer func() {
+		if err := SetLocation(DefaultTimezone); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	restore := Set(Fixed(time.Date(2026, 1, 15, 20, 0, 0, 0, time.UTC)))
+	defer restore()
+
+	// 20:00 UTC is already the next day in Kolkata but not in New York
+	if got := Today(); got.Day() != 16 || got.Hour() != 0 || got.Location().String() != "Asia/Kolkata" {
+		t.Errorf("Today() in Kolkata = %v", got)
+	}
+	if err := SetLocation("America/New_York"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Today(); got.Day() != 15 {
+		t.Errorf("Today() in New York = %v", got)
+	}
+	if got := Now().Format(time.RFC3339); got != "2026-01-15T15:00:00-05:00" {
+		t.Errorf("Now() = %s, want the offset of the institution timezone", got)
+	}
+}
+
+func TestUserLocation(t *testing.T) {
+	tokyo := "Asia/Tokyo"
+	unknown := "Nowhere/Town"
+	if got := UserLocation(&tokyo).String(); got != tokyo {
+		t.Errorf("UserLocation(%q) = %s", tokyo, got)
+	}
+	if got := UserLocation(&unknown); got != Location() {
+		t.Errorf("UserLocation(%q) = %s, want the institution timezone", unknown, got)
+	}
+	if got := UserLocation(nil); got != Location() {
+		t.Errorf("UserLocation(nil) = %s, want the institution timezone", got)
+	}
+}
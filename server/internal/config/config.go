@@ -3,9 +3,14 @@ package config
 import (
 	"log"
 	"os"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
+
+	"github.com/server/internal/clock"
 )
 
 type config struct {
@@ -28,10 +33,54 @@ type config struct {
 	smtpPassword   string
 	smtpFromEmail  string
 	smtpFromName   string
+
+	paymentProvider       string
+	razorpayKeyID         string
+	razorpayKeySecret     string
+	razorpayWebhookSecret string
+	fakeWebhookSecret     string
+	paymentSimulation     bool
+	paymentCurrency       string
+
+	institutionName    string
+	institutionAddress string
+	institutionContact string
+	invoicePrefix      string
+	timezone           string
+	locale             string
+
+	rideBookingHorizonDays int
+
+	dispatchAcceptTimeoutMinutes int
+	dispatchLeadMinutes          int
+
+	sessionIdleTimeoutMinutes   int
+	sessionAbsoluteTimeoutHours int
+	sessionRememberMeDays       int
+	sessionRoleChangePolicy     string
 }
 
 var cfg *config
 
+const defaultRideBookingHorizonDays = 14
+
+const defaultLocale = "en-IN"
+
+// localePattern matches BCP 47 language tags such as en, en-IN or pt-BR
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+const (
+	defaultDispatchAcceptTimeoutMinutes = 5
+	defaultDispatchLeadMinutes          = 30
+)
+
+const (
+	defaultSessionIdleTimeoutMinutes   = 120
+	defaultSessionAbsoluteTimeoutHours = 24
+	defaultSessionRememberMeDays       = 30
+	defaultSessionRoleChangePolicy     = "refresh"
+)
+
 // Init initializes the configuration from environment variables
 func Init() {
 	if err := godotenv.Load(); err != nil {
@@ -119,6 +168,91 @@ func Init() {
 		smtpFromName = "ODI Server" // Default from name
 	}
 
+	// Payment gateway configuration
+	// The fake gateway is opt-in only and never runs in production; completing
+	// fake payments from the API needs a second explicit flag
+	paymentProvider := strings.ToLower(strings.TrimSpace(os.Getenv("PAYMENT_PROVIDER")))
+	if paymentProvider == "fake" && os.Getenv("APP_ENV") == "production" {
+		log.Fatal("PAYMENT_PROVIDER=fake is not allowed when APP_ENV=production")
+	}
+	paymentSimulation := strings.TrimSpace(os.Getenv("PAYMENT_SIMULATION")) == "true"
+	if paymentSimulation && paymentProvider != "fake" {
+		log.Fatal("PAYMENT_SIMULATION requires PAYMENT_PROVIDER=fake")
+	}
+	paymentCurrency := strings.ToUpper(strings.TrimSpace(os.Getenv("PAYMENT_CURRENCY")))
+	if paymentCurrency == "" {
+		paymentCurrency = "INR"
+	}
+
+	// Institution branding used on generated documents
+	institutionName := strings.TrimSpace(os.Getenv("INSTITUTION_NAME"))
+	if institutionName == "" {
+		institutionName = smtpFromName
+	}
+	invoicePrefix := strings.ToUpper(strings.TrimSpace(os.Getenv("INVOICE_PREFIX")))
+	if invoicePrefix == "" {
+		invoicePrefix = "INV"
+	}
+
+	// Calendar dates (enrollment expiry, statement months, shifts) are worked
+	// out in the institution timezone
+	timezone := strings.TrimSpace(os.Getenv("INSTITUTION_TIMEZONE"))
+	if timezone == "" {
+		timezone = clock.DefaultTimezone
+	}
+	if err := clock.SetLocation(timezone); err != nil {
+		log.Fatalf("INSTITUTION_TIMEZONE: %v", err)
+	}
+	locale := strings.TrimSpace(os.Getenv("INSTITUTION_LOCALE"))
+	if locale == "" {
+		locale = defaultLocale
+	}
+	if !localePattern.MatchString(locale) {
+		log.Fatalf("INSTITUTION_LOCALE must be a language tag such as en-IN, got %q", locale)
+	}
+
+	// Recurring ride bookings are materialized this many days ahead
+	rideBookingHorizonDays, err := strconv.Atoi(strings.TrimSpace(os.Getenv("RIDE_BOOKING_HORIZON_DAYS")))
+	if err != nil || rideBookingHorizonDays <= 0 {
+		rideBookingHorizonDays = defaultRideBookingHorizonDays
+	}
+
+	// Drivers have this long to accept an offered ride before it is re-dispatched
+	dispatchAcceptTimeoutMinutes, err := strconv.Atoi(strings.TrimSpace(os.Getenv("DISPATCH_ACCEPT_TIMEOUT_MINUTES")))
+	if err != nil || dispatchAcceptTimeoutMinutes <= 0 {
+		dispatchAcceptTimeoutMinutes = defaultDispatchAcceptTimeoutMinutes
+	}
+
+	// Scheduled rides are dispatched this long before their ride time
+	dispatchLeadMinutes, err := strconv.Atoi(strings.TrimSpace(os.Getenv("DISPATCH_LEAD_MINUTES")))
+	if err != nil || dispatchLeadMinutes <= 0 {
+		dispatchLeadMinutes = defaultDispatchLeadMinutes
+	}
+
+	// Sessions end after this long without a request, or this long after
+	// login whatever the activity; remember-me sessions last a number of days
+	sessionIdleTimeoutMinutes, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SESSION_IDLE_TIMEOUT_MINUTES")))
+	if err != nil || sessionIdleTimeoutMinutes < 5 {
+		sessionIdleTimeoutMinutes = defaultSessionIdleTimeoutMinutes
+	}
+	sessionAbsoluteTimeoutHours, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SESSION_ABSOLUTE_TIMEOUT_HOURS")))
+	if err != nil || sessionAbsoluteTimeoutHours <= 0 {
+		sessionAbsoluteTimeoutHours = defaultSessionAbsoluteTimeoutHours
+	}
+	sessionRememberMeDays, err := strconv.Atoi(strings.TrimSpace(os.Getenv("SESSION_REMEMBER_ME_DAYS")))
+	if err != nil || sessionRememberMeDays <= 0 {
+		sessionRememberMeDays = defaultSessionRememberMeDays
+	}
+	// Whether a user whose role changes keeps their sessions with the new
+	// role (refresh) or has to log in again (revoke)
+	sessionRoleChangePolicy := strings.ToLower(strings.TrimSpace(os.Getenv("SESSION_ROLE_CHANGE_POLICY")))
+	if sessionRoleChangePolicy == "" {
+		sessionRoleChangePolicy = defaultSessionRoleChangePolicy
+	}
+	if sessionRoleChangePolicy != "refresh" && sessionRoleChangePolicy != "revoke" {
+		log.Fatalf("SESSION_ROLE_CHANGE_POLICY must be refresh or revoke, got %q", sessionRoleChangePolicy)
+	}
+
 	cfg = &config{
 		appName:        os.Getenv("APP_NAME"),
 		env:            os.Getenv("APP_ENV"),
@@ -139,6 +273,31 @@ func Init() {
 		smtpPassword:   smtpPassword,
 		smtpFromEmail:  smtpFromEmail,
 		smtpFromName:   smtpFromName,
+
+		paymentProvider:       paymentProvider,
+		razorpayKeyID:         strings.TrimSpace(os.Getenv("RAZORPAY_KEY_ID")),
+		razorpayKeySecret:     strings.TrimSpace(os.Getenv("RAZORPAY_KEY_SECRET")),
+		razorpayWebhookSecret: strings.TrimSpace(os.Getenv("RAZORPAY_WEBHOOK_SECRET")),
+		fakeWebhookSecret:     strings.TrimSpace(os.Getenv("FAKE_PAYMENT_WEBHOOK_SECRET")),
+		paymentSimulation:     paymentSimulation,
+		paymentCurrency:       paymentCurrency,
+
+		institutionName:    institutionName,
+		institutionAddress: strings.TrimSpace(os.Getenv("INSTITUTION_ADDRESS")),
+		institutionContact: strings.TrimSpace(os.Getenv("INSTITUTION_CONTACT")),
+		invoicePrefix:      invoicePrefix,
+		timezone:           timezone,
+		locale:             locale,
+
+		rideBookingHorizonDays: rideBookingHorizonDays,
+
+		dispatchAcceptTimeoutMinutes: dispatchAcceptTimeoutMinutes,
+		dispatchLeadMinutes:          dispatchLeadMinutes,
+
+		sessionIdleTimeoutMinutes:   sessionIdleTimeoutMinutes,
+		sessionAbsoluteTimeoutHours: sessionAbsoluteTimeoutHours,
+		sessionRememberMeDays:       sessionRememberMeDays,
+		sessionRoleChangePolicy:     sessionRoleChangePolicy,
 	}
 }
 
@@ -237,3 +396,135 @@ func SMTPFromEmail() string {
 func SMTPFromName() string {
 	return cfg.smtpFromName
 }
+
+// PaymentProvider returns the online payment provider (razorpay, fake or empty when disabled)
+func PaymentProvider() string {
+	return cfg.paymentProvider
+}
+
+// PaymentWebhookSecret returns the secret that signs webhooks of the configured provider
+func PaymentWebhookSecret() string {
+	if cfg.paymentProvider == "fake" {
+		return cfg.fakeWebhookSecret
+	}
+	return cfg.razorpayWebhookSecret
+}
+
+// PaymentSimulation reports whether the development endpoint that completes
+// fake gateway payments is enabled
+func PaymentSimulation() bool {
+	return cfg.paymentSimulation
+}
+
+// RazorpayKeyID returns the Razorpay key ID
+func RazorpayKeyID() string {
+	return cfg.razorpayKeyID
+}
+
+// RazorpayKeySecret returns the Razorpay key secret
+func RazorpayKeySecret() string {
+	return cfg.razorpayKeySecret
+}
+
+// RazorpayWebhookSecret returns the secret used to sign Razorpay webhooks
+func RazorpayWebhookSecret() string {
+	return cfg.razorpayWebhookSecret
+}
+
+// PaymentCurrency returns the currency used for online payment orders
+func PaymentCurrency() string {
+	return cfg.paymentCurrency
+}
+
+// InstitutionName returns the institution name shown on generated documents
+func InstitutionName() string {
+	return cfg.institutionName
+}
+
+// InstitutionAddress returns the institution address shown on generated documents
+func InstitutionAddress() string {
+	return cfg.institutionAddress
+}
+
+// InstitutionContact returns the contact line (email/phone) shown on generated documents
+func InstitutionContact() string {
+	return cfg.institutionContact
+}
+
+// InvoicePrefix returns the prefix used for invoice numbers
+func InvoicePrefix() string {
+	return cfg.invoicePrefix
+}
+
+// Timezone returns the IANA name of the institution timezone
+func Timezone() string {
+	if cfg.timezone == "" {
+		return clock.DefaultTimezone
+	}
+	return cfg.timezone
+}
+
+// Locale returns the language tag clients format dates and numbers with
+func Locale() string {
+	if cfg.locale == "" {
+		return defaultLocale
+	}
+	return cfg.locale
+}
+
+// RideBookingHorizonDays returns how many days ahead recurring ride bookings are materialized
+func RideBookingHorizonDays() int {
+	if cfg.rideBookingHorizonDays <= 0 {
+		return defaultRideBookingHorizonDays
+	}
+	return cfg.rideBookingHorizonDays
+}
+
+// DispatchAcceptTimeout returns how long a driver has to accept an offered ride
+func DispatchAcceptTimeout() time.Duration {
+	if cfg.dispatchAcceptTimeoutMinutes <= 0 {
+		return defaultDispatchAcceptTimeoutMinutes * time.Minute
+	}
+	return time.Duration(cfg.dispatchAcceptTimeoutMinutes) * time.Minute
+}
+
+// DispatchLead returns how long before their ride time scheduled rides are dispatched
+func DispatchLead() time.Duration {
+	if cfg.dispatchLeadMinutes <= 0 {
+		return defaultDispatchLeadMinutes * time.Minute
+	}
+	return time.Duration(cfg.dispatchLeadMinutes) * time.Minute
+}
+
+// SessionIdleTimeout returns how long a session lasts without a request
+func SessionIdleTimeout() time.Duration {
+	if cfg.sessionIdleTimeoutMinutes <= 0 {
+		return defaultSessionIdleTimeoutMinutes * time.Minute
+	}
+	return time.Duration(cfg.sessionIdleTimeoutMinutes) * time.Minute
+}
+
+// SessionAbsoluteTimeout returns how long after login a session ends, however active it is
+func SessionAbsoluteTimeout() time.Duration {
+	if cfg.sessionAbsoluteTimeoutHours <= 0 {
+		return defaultSessionAbsoluteTimeoutHours * time.Hour
+	}
+	return time.Duration(cfg.sessionAbsoluteTimeoutHours) * time.Hour
+}
+
+// SessionRememberMe returns how long a session started with remember me lasts
+func SessionRememberMe() time.Duration {
+	if cfg.sessionRememberMeDays <= 0 {
+		return defaultSessionRememberMeDays * 24 * time.Hour
+	}
+	return time.Duration(cfg.sessionRememberMeDays) * 24 * time.Hour
+}
+
+// SessionRoleChangePolicy returns what happens to a user's sessions when
+// their role changes: refresh rewrites them with the new role, revoke ends them
+func SessionRoleChangePolicy() string {
+	if cfg.sessionRoleChangePolicy == "" {
+		return defaultSessionRoleChangePolicy
+	}
+	return cfg.sessionRoleChangePolicy
+}
@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// AccessibilityFeatures is the vocabulary shared by student needs and vehicle
+// capabilities, with the label shown to admins
+var AccessibilityFeatures = map[string]string{
+	"wheelchair_ramp":  "wheelchair ramp or lift",
+	"wheelchair_space": "space for a wheelchair",
+	"escort_seat":      "seat for an escort",
+	"guide_dog_space":  "space for a guide dog",
+	"step_free_entry":  "step-free entry",
+}
+
+var ErrDriverNotFound = errors.New("driver not found")
+
+// AccessibilityMismatchError is returned when a driver's vehicle can't serve a ride's needs
+type AccessibilityMismatchError struct {
+	Missing []string
+}
+
+func (e *AccessibilityMismatchError) Error() string {
+	return AccessibilityMismatchReason(e.Missing)
+}
+
+// AccessibilityProfile holds a student's accessibility requirements
+type AccessibilityProfile struct {
+	UserID    int        `json:"userId"`
+	Needs     []string   `json:"needs"`
+	Notes     *string    `json:"notes"`
+	UpdatedAt *time.Time `json:"updatedAt"`
+}
+
+// DriverMatch describes how well a driver's vehicle serves a ride
+type DriverMatch struct {
+	DriverID      int      `json:"driverId"`
+	Name          string   `json:"name"`
+	VehicleID     *int     `json:"vehicleId"`
+	VehicleNumber *string  `json:"vehicleNumber"`
+	VehicleType   *string  `json:"vehicleType"`
+	Capabilities  []string `json:"capabilities"`
+	Missing       []string `json:"missing"`
+	ActiveRides   int      `json:"activeRides"`
+}
+
+// Compatible reports whether the driver's vehicle serves every need
+func (m DriverMatch) Compatible() bool {
+	return len(m.Missing) == 0
+}
+
+// NormalizeAccessibilityTags validates tags against AccessibilityFeatures and
+// returns them sorted without duplicates
+func NormalizeAccessibilityTags(tags []string) ([]string, error) {
+	return normalizeTags(tags, AccessibilityFeatures, "accessibility feature")
+}
+
+// normalizeTags validates tags against a vocabulary and returns them sorted
+// without duplicates
+func normalizeTags(tags []string, vocabulary map[string]string, kind string) ([]string, error) {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, ok := vocabulary[tag]; !ok {
+			return nil, fmt.Errorf("unknown %s %q", kind, tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// MissingCapabilities returns the needs a vehicle with the given capabilities can't serve
+func MissingCapabilities(needs, capabilities []string) []string {
+	has := map[string]bool{}
+	for _, c := range capabilities {
+		has[c] = true
+	}
+	missing := []string{}
+	for _, n := range needs {
+		if !has[n] {
+			missing = append(missing, n)
+		}
+	}
+	return missing
+}
+
+// AccessibilityMismatchReason describes missing capabilities for admins
+func AccessibilityMismatchReason(missing []string) string {
+	labels := make([]string, 0, len(missing))
+	for _, m := range missing {
+		if label, ok := AccessibilityFeatures[m]; ok {
+			labels = append(labels, label)
+		} else {
+			labels = append(labels, m)
+		}
+	}
+	return "vehicle does not have: " + strings.Join(labels, ", ")
+}
+
+// GetAccessibilityProfile returns a user's profile, or an empty one if none was saved
+func GetAccessibilityProfile(ctx context.Context, userID int) (*AccessibilityProfile, error) {
+	p := AccessibilityProfile{UserID: userID}
+	err := GetPool().QueryRow(ctx, `
+		SELECT needs, notes, updated_at FROM accessibility_profiles WHERE user_id = $1
+	`, userID).Scan(&p.Needs, &p.Notes, &p.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		p.Needs = []string{}
+		return &p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SaveAccessibilityProfile creates or replaces a user's profile
+func SaveAccessibilityProfile(ctx context.Context, p AccessibilityProfile) (*AccessibilityProfile, error) {
+	saved := AccessibilityProfile{UserID: p.UserID}
+	err := GetPool().QueryRow(ctx, `
+		INSERT INTO accessibility_profiles (user_id, needs, notes)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id) DO UPDATE SET needs = EXCLUDED.needs, notes = EXCLUDED.notes
+		RETURNING needs, notes, updated_at
+	`, p.UserID, p.Needs, p.Notes).Scan(&saved.Needs, &saved.Notes, &saved.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+const driverMatchColumns = `u.id, COALESCE(u.name, u.username), v.id, v.registration_number, v.vehicle_type,
+	COALESCE(v.accessibility_features, '{}'),
+	(SELECT COUNT(*) FROM ride_bills a
+	 WHERE a.driver_id = u.id
+	   AND a.status NOT IN ('cancelled', 'refunded')
+	   AND (COALESCE(a.scheduled_for, a.created_at) AT TIME ZONE current_setting('TimeZone'))::date = (NOW() AT TIME ZONE current_setting('TimeZone'))::date)`
+
+// driverMatchFrom joins drivers to the active vehicle they currently drive
+const driverMatchFrom = `users u
+	LEFT JOIN driver_vehicle_assignments dva ON dva.driver_id = u.id AND dva.ends_at IS NULL
+	LEFT JOIN vehicles v ON v.id = dva.vehicle_id AND v.status = 'active'`
+
+// scanDriverMatch scans a row selected with driverMatchColumns and checks it against needs
+func scanDriverMatch(row pgx.Row, needs []string) (*DriverMatch, error) {
+	var m DriverMatch
+	err := row.Scan(&m.DriverID, &m.Name, &m.VehicleID, &m.VehicleNumber, &m.VehicleType, &m.Capabilities, &m.ActiveRides)
+	if err != nil {
+		return nil, err
+	}
+	m.Missing = MissingCapabilities(needs, m.Capabilities)
+	return &m, nil
+}
+
+// GetDriverMatches checks every active driver against a ride's needs.
+// Compatible drivers come first, least busy first.
+func GetDriverMatches(ctx context.Context, needs []string) ([]DriverMatch, error) {
+	query := `SELECT ` + driverMatchColumns + `
+		FROM ` + driverMatchFrom + `
+		WHERE LOWER(u.role) = 'driver' AND COALESCE(u.status, 'active') = 'active'
+		ORDER BY u.id`
+
+	rows, err := GetPool().Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []DriverMatch{}
+	for rows.Next() {
+		m, err := scanDriverMatch(rows, needs)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	SortDriverMatches(matches)
+	return matches, nil
+}
+
+// SortDriverMatches orders compatible drivers first, then by fewest missing
+// features and current load
+func SortDriverMatches(matches []DriverMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		return lessDriverMatch(matches[i], matches[j])
+	})
+}
+
+// lessDriverMatch reports whether driver a is a better fit than driver b
+func lessDriverMatch(a, b DriverMatch) bool {
+	if len(a.Missing) != len(b.Missing) {
+		return len(a.Missing) < len(b.Missing)
+	}
+	return a.ActiveRides < b.ActiveRides
+}
+
+// GetRideBillNeeds returns the accessibility needs recorded on a ride bill
+func GetRideBillNeeds(ctx context.Context, billID int) ([]string, error) {
+	var needs []string
+	err := GetPool().QueryRow(ctx, `SELECT accessibility_needs FROM ride_bills WHERE id = $1`, billID).Scan(&needs)
+	if err == pgx.ErrNoRows {
+		return nil, ErrBillNotFound
+	}
+	return needs, err
+}
+
+// AssignDriver assigns a driver and their current vehicle to a ride bill,
+// overriding automatic dispatch: the ride counts as accepted and any open
+// offer is withdrawn. The assignment is rejected with an
+// AccessibilityMismatchError if the driver's vehicle can't serve the ride's
+// accessibility needs.
+func AssignDriver(ctx context.Context, billID, driverID int) (*DriverMatch, error) {
+	var match *DriverMatch
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		match, err = assignDriverTx(ctx, tx, billID, driverID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// assignDriverTx assigns a driver to a ride bill within tx
+func assignDriverTx(ctx context.Context, tx pgx.Tx, billID, driverID int) (*DriverMatch, error) {
+	var needs []string
+	err := tx.QueryRow(ctx,
+		`SELECT accessibility_needs FROM ride_bills WHERE id = $1 FOR UPDATE`, billID,
+	).Scan(&needs)
+	if err == pgx.ErrNoRows {
+		return nil, ErrBillNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := lockDriverMatch(ctx, tx, driverID, needs)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE ride_dispatch_attempts SET outcome = 'overridden', responded_at = NOW()
+		WHERE ride_bill_id = $1 AND outcome = 'offered'
+	`, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE ride_bills
+		SET driver_id = $1, driver = $2, vehicle_id = $3,
+		    dispatch_status = 'accepted', accepted_at = NOW()
+		WHERE id = $4
+	`, driverID, match.Name, match.VehicleID, billID)
+	if err != nil {
+		return nil, err
+	}
+	return match, nil
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeAccessibilityTags(t *testing.T) {
+	tags, err := NormalizeAccessibilityTags([]string{" Wheelchair_Ramp", "escort_seat", "wheelchair_ramp", ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"escort_seat", "wheelchair_ramp"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("NormalizeAccessibilityTags = %v, want %v", tags, want)
+	}
+
+	if _, err := NormalizeAccessibilityTags([]string{"jetpack"}); err == nil {
+		t.Error("expected error for unknown feature")
+	}
+
+	tags, err = NormalizeAccessibilityTags(nil)
+	if err != nil || tags == nil || len(tags) != 0 {
+		t.Errorf("NormalizeAccessibilityTags(nil) = %v, %v; want empty slice", tags, err)
+	}
+}
+
+func TestMissingCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		needs        []string
+		capabilities []string
+		expected     []string
+	}{
+		{"no needs", nil, []string{"wheelchair_ramp"}, []string{}},
+		{"all served", []string{"wheelchair_ramp"}, []string{"escort_seat", "wheelchair_ramp"}, []string{}},
+		{"car without ramp", []string{"wheelchair_ramp", "escort_seat"}, []string{"escort_seat"}, []string{"wheelchair_ramp"}},
+		{"no capabilities", []string{"guide_dog_space"}, nil, []string{"guide_dog_space"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing := MissingCapabilities(tt.needs, tt.capabilities)
+			if !reflect.DeepEqual(missing, tt.expected) {
+				t.Errorf("MissingCapabilities(%v, %v) = %v, want %v", tt.needs, tt.capabilities, missing, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAccessibilityMismatchReason(t *testing.T) {
+	reason := AccessibilityMismatchReason([]string{"wheelchair_ramp", "guide_dog_space"})
+	want := "vehicle does not have: wheelchair ramp or lift, space for a guide dog"
+	if reason != want {
+		t.Errorf("AccessibilityMismatchReason = %q, want %q", reason, want)
+	}
+}
+
+func TestSortDriverMatches(t *testing.T) {
+	matches := []DriverMatch{
+		{DriverID: 1, Missing: []string{"wheelchair_ramp"}, ActiveRides: 0},
+		{DriverID: 2, Missing: []string{}, ActiveRides: 5},
+		{DriverID: 3, Missing: []string{}, ActiveRides: 1},
+		{DriverID: 4, Missing: []string{"wheelchair_ramp", "escort_seat"}, ActiveRides: 0},
+	}
+	SortDriverMatches(matches)
+
+	order := []int{}
+	for _, m := range matches {
+		order = append(order, m.DriverID)
+	}
+	if want := []int{3, 2, 1, 4}; !reflect.DeepEqual(order, want) {
+		t.Errorf("SortDriverMatches order = %v, want %v", order, want)
+	}
+	if !matches[0].Compatible() || matches[2].Compatible() {
+		t.Error("Compatible() should report whether anything is missing")
+	}
+}
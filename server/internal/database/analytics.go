@@ -0,0 +1,180 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Valid analytics groupings and intervals
+var (
+	AnalyticsGroupings = map[string]bool{
+		"time":      true,
+		"route":     true,
+		"driver":    true,
+		"programme": true,
+		"hostel":    true,
+		"status":    true,
+	}
+	AnalyticsIntervals = map[string]bool{
+		"day":   true,
+		"week":  true,
+		"month": true,
+	}
+)
+
+// AnalyticsQuery selects ride bills created in [From, To] (inclusive dates in
+// the institution timezone) and groups them by a dimension, a time interval or both
+type AnalyticsQuery struct {
+	GroupBy  string
+	Interval string // Optional for dimensions, defaults to "day" for time
+	From     time.Time
+	To       time.Time
+}
+
+// AnalyticsRow is one group of ride bills.
+// Collected is the net amount paid on the group's bills (payments minus refunds).
+type AnalyticsRow struct {
+	Period         string  `json:"period,omitempty"`
+	Group          string  `json:"group,omitempty"`
+	Rides          int     `json:"rides"`
+	CancelledRides int     `json:"cancelledRides"`
+	Billed         float64 `json:"billed"`
+	Collected      float64 `json:"collected"`
+	Outstanding    float64 `json:"outstanding"`
+}
+
+// analyticsGroupExpr returns the SQL expression for a grouping dimension
+func analyticsGroupExpr(groupBy string) (string, error) {
+	switch groupBy {
+	case "time":
+		return "", nil
+	case "route":
+		return "rb.from_location || ' → ' || rb.to_location", nil
+	case "driver":
+		return "COALESCE(NULLIF(TRIM(rb.driver), ''), 'Unassigned')", nil
+	case "programme":
+		return "COALESCE(NULLIF(TRIM(u.programme), ''), 'Unknown')", nil
+	case "hostel":
+		return "COALESCE(NULLIF(TRIM(u.hostel), ''), 'Unknown')", nil
+	case "status":
+		return "rb.status", nil
+	}
+	return "", fmt.Errorf("invalid groupBy %q", groupBy)
+}
+
+// buildAnalyticsSQL builds the grouping query. The interval and groupBy values
+// must be validated against AnalyticsIntervals and AnalyticsGroupings.
+func buildAnalyticsSQL(q AnalyticsQuery) (string, error) {
+	groupExpr, err := analyticsGroupExpr(q.GroupBy)
+	if err != nil {
+		return "", err
+	}
+	interval := q.Interval
+	if q.GroupBy == "time" && interval == "" {
+		interval = "day"
+	}
+	if interval != "" && !AnalyticsIntervals[interval] {
+		return "", fmt.Errorf("invalid interval %q", interval)
+	}
+
+	periodExpr := "NULL::date"
+	if interval != "" {
+		periodExpr = "date_trunc('" + interval + "', rb.created_at AT TIME ZONE current_setting('TimeZone'))::date"
+	}
+	if groupExpr == "" {
+		groupExpr = "NULL::text"
+	}
+
+	// Bills are filtered on created_at (indexed) using the bounds of the local
+	// dates; payments are aggregated per bill through idx_payments_ride_bill_covering
+	base := `
+		WITH bills AS (
+			SELECT ` + periodExpr + ` AS period,
+			       ` + groupExpr + ` AS grp,
+			       rb.status,
+			       rb.fare,
+			       COALESCE(p.net_paid, 0) AS net_paid
+			FROM ride_bills rb
+			LEFT JOIN users u ON u.id = rb.user_id
+			LEFT JOIN LATERAL (
+				SELECT SUM(CASE WHEN kind = 'refund' THEN -amount ELSE amount END) AS net_paid
+				FROM payments
+				WHERE ride_bill_id = rb.id
+			) p ON true
+			WHERE rb.created_at >= ($1::date)::timestamp AT TIME ZONE current_setting('TimeZone')
+			  AND rb.created_at < ($2::date + 1)::timestamp AT TIME ZONE current_setting('TimeZone')
+		),
+		grouped AS (
+			SELECT period, grp,
+			       COUNT(*) FILTER (WHERE status <> 'cancelled') AS rides,
+			       COUNT(*) FILTER (WHERE status = 'cancelled') AS cancelled_rides,
+			       COALESCE(SUM(fare) FILTER (WHERE status <> 'cancelled'), 0) AS billed,
+			       COALESCE(SUM(net_paid), 0) AS collected,
+			       COALESCE(SUM(fare - net_paid) FILTER (WHERE status <> 'cancelled'), 0) AS outstanding
+			FROM bills
+			GROUP BY period, grp
+		)`
+
+	if q.GroupBy == "time" {
+		// Fill empty periods so charts get a continuous series
+		return base + `,
+		periods AS (
+			SELECT generate_series(
+				date_trunc('` + interval + `', $1::date::timestamp),
+				date_trunc('` + interval + `', $2::date::timestamp),
+				INTERVAL '1 ` + interval + `'
+			)::date AS period
+		)
+		SELECT ps.period, NULL::text,
+		       COALESCE(g.rides, 0), COALESCE(g.cancelled_rides, 0),
+		       COALESCE(g.billed, 0), COALESCE(g.collected, 0), COALESCE(g.outstanding, 0)
+		FROM periods ps
+		LEFT JOIN grouped g ON g.period = ps.period
+		ORDER BY ps.period ASC`, nil
+	}
+
+	return base + `
+		SELECT period, grp, rides, cancelled_rides, billed, collected, outstanding
+		FROM grouped
+		ORDER BY period ASC NULLS FIRST, billed DESC, grp ASC`, nil
+}
+
+// GetRideBillAnalytics groups ride bills for the analytics endpoint
+func GetRideBillAnalytics(ctx context.Context, q AnalyticsQuery) ([]AnalyticsRow, error) {
+	query, err := buildAnalyticsSQL(q)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := GetPool().Query(ctx, query, q.From.Format("2006-01-02"), q.To.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []AnalyticsRow{}
+	for rows.Next() {
+		var (
+			r      AnalyticsRow
+			period *time.Time
+			group  *string
+		)
+		err := rows.Scan(&period, &group, &r.Rides, &r.CancelledRides, &r.Billed, &r.Collected, &r.Outstanding)
+		if err != nil {
+			return nil, err
+		}
+		if period != nil {
+			r.Period = period.Format("2006-01-02")
+		}
+		if group != nil {
+			r.Group = *group
+		}
+		r.Billed = RoundCents(r.Billed)
+		r.Collected = RoundCents(r.Collected)
+		r.Outstanding = RoundCents(r.Outstanding)
+		result = append(result, r)
+	}
+
+	return result, rows.Err()
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildAnalyticsSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    AnalyticsQuery
+		wantErr  bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "time defaults to daily buckets with gap filling",
+			query:    AnalyticsQuery{GroupBy: "time"},
+			contains: []string{"date_trunc('day'", "generate_series", "INTERVAL '1 day'"},
+		},
+		{
+			name:     "time by month",
+			query:    AnalyticsQuery{GroupBy: "time", Interval: "month"},
+			contains: []string{"date_trunc('month'", "INTERVAL '1 month'"},
+		},
+		{
+			name:     "route without interval",
+			query:    AnalyticsQuery{GroupBy: "route"},
+			contains: []string{"rb.from_location || ' → ' || rb.to_location", "NULL::date AS period"},
+			excludes: []string{"generate_series"},
+		},
+		{
+			name:     "hostel by week",
+			query:    AnalyticsQuery{GroupBy: "hostel", Interval: "week"},
+			contains: []string{"u.hostel", "date_trunc('week'"},
+			excludes: []string{"generate_series"},
+		},
+		{name: "unknown groupBy", query: AnalyticsQuery{GroupBy: "fare"}, wantErr: true},
+		{name: "unknown interval", query: AnalyticsQuery{GroupBy: "time", Interval: "hour"}, wantErr: true},
+		{name: "injection in interval", query: AnalyticsQuery{GroupBy: "status", Interval: "day'; DROP TABLE users; --"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sql, err := buildAnalyticsSQL(tt.query)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("buildAnalyticsSQL(%+v) expected error", tt.query)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("buildAnalyticsSQL(%+v) unexpected error: %v", tt.query, err)
+			}
+			for _, s := range tt.contains {
+				if !strings.Contains(sql, s) {
+					t.Errorf("query should contain %q", s)
+				}
+			}
+			for _, s := range tt.excludes {
+				if strings.Contains(sql, s) {
+					t.Errorf("query should not contain %q", s)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyticsGroupingsHaveExpressions(t *testing.T) {
+	for groupBy := range AnalyticsGroupings {
+		if _, err := analyticsGroupExpr(groupBy); err != nil {
+			t.Errorf("grouping %q has no SQL expression: %v", groupBy, err)
+		}
+	}
+}
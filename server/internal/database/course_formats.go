@@ -0,0 +1,276 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Accessible formats course books are converted to
+const (
+	BookFormatText = "txt"
+	BookFormatHTML = "html"
+	BookFormatEPUB = "epub"
+)
+
+// BookFormats lists the formats generated for every course book
+var BookFormats = []string{BookFormatText, BookFormatHTML, BookFormatEPUB}
+
+// Conversion statuses of a book format
+const (
+	BookFormatPending    = "pending"
+	BookFormatProcessing = "processing"
+	BookFormatReady      = "ready"
+	BookFormatFailed     = "failed"
+)
+
+var (
+	ErrBookFormatNotFound = errors.New("this format is not available for the course")
+	ErrBookFormatNotReady = errors.New("this format is still being prepared")
+)
+
+// courseBookSourceSQL is the stored location of a course's book, preferring
+// the path over the URL
+const courseBookSourceSQL = `COALESCE(NULLIF(c.book_pdf_path, ''), NULLIF(c.book_pdf_url, ''))`
+
+// ValidBookFormat reports whether format is one books are converted to
+func ValidBookFormat(format string) bool {
+	for _, f := range BookFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// CourseBookFormat is the conversion status of one format of a course book
+type CourseBookFormat struct {
+	ID           int
+	CourseID     int
+	CourseCode   string
+	CourseName   string
+	Format       string
+	Source       string
+	Status       string
+	FileName     *string
+	FileURL      *string
+	FileSize     *int64
+	ErrorMessage *string
+	Attempts     int
+	StartedAt    *time.Time
+	CompletedAt  *time.Time
+	UpdatedAt    time.Time
+}
+
+const courseBookFormatColumns = `f.id, f.course_id, c.code, c.name, f.format, f.source, f.status,
+	f.file_name, f.file_url, f.file_size, f.error_message, f.attempts,
+	f.started_at, f.completed_at, f.updated_at`
+
+// scanCourseBookFormat scans a row selected with courseBookFormatColumns
+func scanCourseBookFormat(row pgx.Row) (*CourseBookFormat, error) {
+	var f CourseBookFormat
+	err := row.Scan(
+		&f.ID, &f.CourseID, &f.CourseCode, &f.CourseName, &f.Format, &f.Source, &f.Status,
+		&f.FileName, &f.FileURL, &f.FileSize, &f.ErrorMessage, &f.Attempts,
+		&f.StartedAt, &f.CompletedAt, &f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// queryCourseBookFormats runs a query selecting courseBookFormatColumns
+func queryCourseBookFormats(ctx context.Context, query string, args ...interface{}) ([]CourseBookFormat, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	formats := []CourseBookFormat{}
+	for rows.Next() {
+		f, err := scanCourseBookFormat(rows)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, *f)
+	}
+	return formats, rows.Err()
+}
+
+// SyncCourseBookFormats queues conversions for course books that have none
+// yet or whose book was replaced, and drops the formats of courses that no
+// longer have a book. With courseID nil every course is synced. Returns the
+// number of formats queued.
+func SyncCourseBookFormats(ctx context.Context, courseID *int) (int64, error) {
+	if _, err := GetPool().Exec(ctx, `
+		DELETE FROM course_book_formats f
+		USING courses c
+		WHERE c.id = f.course_id AND `+courseBookSourceSQL+` IS NULL
+		  AND ($1::int IS NULL OR c.id = $1)
+	`, courseID); err != nil {
+		return 0, err
+	}
+
+	tag, err := GetPool().Exec(ctx, `
+		INSERT INTO course_book_formats (course_id, format, source)
+		SELECT c.id, f.format, `+courseBookSourceSQL+`
+		FROM courses c
+		CROSS JOIN UNNEST($2::text[]) AS f(format)
+		WHERE `+courseBookSourceSQL+` IS NOT NULL
+		  AND ($1::int IS NULL OR c.id = $1)
+		ON CONFLICT (course_id, format) DO UPDATE
+		SET source = EXCLUDED.source, status = 'pending', error_message = NULL,
+		    attempts = 0, started_at = NULL, completed_at = NULL
+		WHERE course_book_formats.source <> EXCLUDED.source
+	`, courseID, BookFormats)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// BookConversion is a course book claimed for conversion
+type BookConversion struct {
+	CourseID   int
+	CourseCode string
+	CourseName string
+	Author     *string
+	Source     string
+	Formats    []string
+}
+
+// ClaimBookConversion marks the pending formats of the next course book as
+// processing and returns them, or nil when nothing is pending. Conversions
+// left processing since before staleBefore, by a server that stopped, are
+// queued again first.
+func ClaimBookConversion(ctx context.Context, staleBefore time.Time) (*BookConversion, error) {
+	if _, err := GetPool().Exec(ctx, `
+		UPDATE course_book_formats SET status = 'pending'
+		WHERE status = 'processing' AND started_at < $1
+	`, staleBefore); err != nil {
+		return nil, err
+	}
+
+	rows, err := GetPool().Query(ctx, `
+		UPDATE course_book_formats f
+		SET status = 'processing', attempts = f.attempts + 1, started_at = NOW(), error_message = NULL
+		FROM (
+			SELECT course_id, source FROM course_book_formats
+			WHERE status = 'pending'
+			ORDER BY updated_at, course_id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		) next, courses c
+		WHERE f.course_id = next.course_id AND f.source = next.source AND f.status = 'pending'
+		  AND c.id = f.course_id
+		RETURNING f.course_id, c.code, c.name, c.author, f.source, f.format
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var job *BookConversion
+	for rows.Next() {
+		var claimed BookConversion
+		var format string
+		if err := rows.Scan(&claimed.CourseID, &claimed.CourseCode, &claimed.CourseName, &claimed.Author, &claimed.Source, &format); err != nil {
+			return nil, err
+		}
+		if job == nil {
+			job = &claimed
+		}
+		job.Formats = append(job.Formats, format)
+	}
+	return job, rows.Err()
+}
+
+// CompleteBookFormat records a generated format. It is ignored when the book
+// was replaced while it was being converted.
+func CompleteBookFormat(ctx context.Context, courseID int, format, source, fileName, fileURL string, size int64) error {
+	_, err := GetPool().Exec(ctx, `
+		UPDATE course_book_formats
+		SET status = 'ready', file_name = $4, file_url = $5, file_size = $6,
+		    error_message = NULL, completed_at = NOW()
+		WHERE course_id = $1 AND format = $2 AND source = $3 AND status = 'processing'
+	`, courseID, format, source, fileName, fileURL, size)
+	return err
+}
+
+// FailBookFormat records why a format could not be generated. Returns false
+// when the book was replaced while it was being converted.
+func FailBookFormat(ctx context.Context, courseID int, format, source, reason string) (bool, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE course_book_formats
+		SET status = 'failed', error_message = $4, completed_at = NOW()
+		WHERE course_id = $1 AND format = $2 AND source = $3 AND status = 'processing'
+	`, courseID, format, source, reason)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// RetryBookFormats queues the failed formats of a course book again. Returns
+// the number of formats queued.
+func RetryBookFormats(ctx context.Context, courseID int) (int64, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE course_book_formats
+		SET status = 'pending', error_message = NULL, started_at = NULL, completed_at = NULL
+		WHERE course_id = $1 AND status = 'failed'
+	`, courseID)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// GetCourseBookFormats returns the conversion status of every format of a course book
+func GetCourseBookFormats(ctx context.Context, courseID int) ([]CourseBookFormat, error) {
+	return queryCourseBookFormats(ctx, `
+		SELECT `+courseBookFormatColumns+`
+		FROM course_book_formats f
+		JOIN courses c ON c.id = f.course_id
+		WHERE f.course_id = $1
+		ORDER BY f.format
+	`, courseID)
+}
+
+// GetBookFormatsByStatus returns book formats in a status across all
+// courses, most recently updated first
+func GetBookFormatsByStatus(ctx context.Context, status string) ([]CourseBookFormat, error) {
+	return queryCourseBookFormats(ctx, `
+		SELECT `+courseBookFormatColumns+`
+		FROM course_book_formats f
+		JOIN courses c ON c.id = f.course_id
+		WHERE f.status = $1
+		ORDER BY f.updated_at DESC, f.id
+	`, status)
+}
+
+// GetReadyBookFormat returns a generated format of a course book
+func GetReadyBookFormat(ctx context.Context, courseID int, format string) (*CourseBookFormat, error) {
+	f, err := scanCourseBookFormat(GetPool().QueryRow(ctx, `
+		SELECT `+courseBookFormatColumns+`
+		FROM course_book_formats f
+		JOIN courses c ON c.id = f.course_id
+		WHERE f.course_id = $1 AND f.format = $2
+	`, courseID, format))
+	if err == pgx.ErrNoRows {
+		return nil, ErrBookFormatNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Status != BookFormatReady || f.FileURL == nil {
+		if f.Status == BookFormatFailed {
+			return nil, ErrBookFormatNotFound
+		}
+		return nil, ErrBookFormatNotReady
+	}
+	return f, nil
+}
@@ -0,0 +1,342 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Valid course material kinds
+var ValidMaterialKinds = map[string]bool{
+	"chapter": true,
+	"notes":   true,
+	"audio":   true,
+	"other":   true,
+}
+
+var (
+	ErrMaterialNotFound        = errors.New("course material not found")
+	ErrMaterialVersionNotFound = errors.New("material version not found")
+)
+
+// materialVisibleSQL matches materials students can currently see
+const materialVisibleSQL = `(m.visible_from IS NULL OR m.visible_from <= NOW())
+	AND (m.visible_until IS NULL OR m.visible_until > NOW())`
+
+// MaterialVersion is an uploaded file of a course material
+type MaterialVersion struct {
+	ID          int
+	MaterialID  int
+	Version     int
+	FileName    string // Name of the uploaded file
+	FileURL     string
+	ContentType string
+	FileSize    int64
+	Notes       *string
+	UploadedBy  *int
+	CreatedAt   time.Time
+}
+
+// CourseMaterial is a file attached to a course, with its current version
+type CourseMaterial struct {
+	ID           int
+	CourseID     int
+	Title        string
+	Description  *string
+	Kind         string
+	Position     int
+	VisibleFrom  *time.Time
+	VisibleUntil *time.Time
+	Versions     int // Number of uploaded versions
+	Current      MaterialVersion
+	CreatedBy    *int
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// VisibleAt reports whether students can see the material at t
+func (m CourseMaterial) VisibleAt(t time.Time) bool {
+	if m.VisibleFrom != nil && t.Before(*m.VisibleFrom) {
+		return false
+	}
+	return m.VisibleUntil == nil || t.Before(*m.VisibleUntil)
+}
+
+const materialVersionColumns = `v.id, v.material_id, v.version, v.file_name, v.file_url, v.content_type,
+	v.file_size, v.notes, v.uploaded_by, v.created_at`
+
+const courseMaterialColumns = `m.id, m.course_id, m.title, m.description, m.kind, m.position,
+	m.visible_from, m.visible_until,
+	(SELECT COUNT(*) FROM course_material_versions cv WHERE cv.material_id = m.id),
+	m.created_by, m.created_at, m.updated_at, ` + materialVersionColumns
+
+const courseMaterialFrom = `course_materials m
+	JOIN course_material_versions v ON v.material_id = m.id AND v.version = m.current_version`
+
+// scanCourseMaterial scans a row selected with courseMaterialColumns
+func scanCourseMaterial(row pgx.Row) (*CourseMaterial, error) {
+	var m CourseMaterial
+	v := &m.Current
+	err := row.Scan(
+		&m.ID, &m.CourseID, &m.Title, &m.Description, &m.Kind, &m.Position,
+		&m.VisibleFrom, &m.VisibleUntil, &m.Versions,
+		&m.CreatedBy, &m.CreatedAt, &m.UpdatedAt,
+		&v.ID, &v.MaterialID, &v.Version, &v.FileName, &v.FileURL, &v.ContentType,
+		&v.FileSize, &v.Notes, &v.UploadedBy, &v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// queryCourseMaterials runs a query selecting courseMaterialColumns
+func queryCourseMaterials(ctx context.Context, query string, args ...interface{}) ([]CourseMaterial, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	materials := []CourseMaterial{}
+	for rows.Next() {
+		m, err := scanCourseMaterial(rows)
+		if err != nil {
+			return nil, err
+		}
+		materials = append(materials, *m)
+	}
+	return materials, rows.Err()
+}
+
+// GetCourseMaterials returns all materials of a course in order
+func GetCourseMaterials(ctx context.Context, courseID int) ([]CourseMaterial, error) {
+	return queryCourseMaterials(ctx, `
+		SELECT `+courseMaterialColumns+`
+		FROM `+courseMaterialFrom+`
+		WHERE m.course_id = $1
+		ORDER BY m.position, m.id
+	`, courseID)
+}
+
+// GetVisibleCourseMaterials returns the materials of a course students can
+// currently see, in order
+func GetVisibleCourseMaterials(ctx context.Context, courseID int) ([]CourseMaterial, error) {
+	return queryCourseMaterials(ctx, `
+		SELECT `+courseMaterialColumns+`
+		FROM `+courseMaterialFrom+`
+		WHERE m.course_id = $1 AND `+materialVisibleSQL+`
+		ORDER BY m.position, m.id
+	`, courseID)
+}
+
+// GetCourseMaterial returns a material by ID
+func GetCourseMaterial(ctx context.Context, id int) (*CourseMaterial, error) {
+	m, err := scanCourseMaterial(GetPool().QueryRow(ctx, `
+		SELECT `+courseMaterialColumns+`
+		FROM `+courseMaterialFrom+`
+		WHERE m.id = $1
+	`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrMaterialNotFound
+	}
+	return m, err
+}
+
+// CreateCourseMaterial adds a material to a course with its first version.
+// A material without a position is placed after the course's other materials.
+func CreateCourseMaterial(ctx context.Context, m CourseMaterial, v MaterialVersion) (*CourseMaterial, error) {
+	var id int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		// Lock the course so concurrent uploads get distinct positions
+		err := tx.QueryRow(ctx, `SELECT id FROM courses WHERE id = $1 FOR UPDATE`, m.CourseID).Scan(&id)
+		if err == pgx.ErrNoRows {
+			return ErrCourseNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO course_materials (course_id, title, description, kind, position,
+			                              visible_from, visible_until, created_by)
+			VALUES ($1, $2, $3, $4,
+			        CASE WHEN $5 > 0 THEN $5
+			             ELSE (SELECT COALESCE(MAX(position), 0) + 1 FROM course_materials WHERE course_id = $1) END,
+			        $6, $7, $8)
+			RETURNING id
+		`, m.CourseID, m.Title, m.Description, m.Kind, m.Position,
+			m.VisibleFrom, m.VisibleUntil, m.CreatedBy,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO course_material_versions (material_id, version, file_name, file_url,
+			                                      content_type, file_size, notes, uploaded_by)
+			VALUES ($1, 1, $2, $3, $4, $5, $6, $7)
+		`, id, v.FileName, v.FileURL, v.ContentType, v.FileSize, v.Notes, v.UploadedBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCourseMaterial(ctx, id)
+}
+
+// UpdateCourseMaterial saves the editable details of a material
+func UpdateCourseMaterial(ctx context.Context, m CourseMaterial) (*CourseMaterial, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE course_materials
+		SET title = $1, description = $2, kind = $3, position = $4,
+		    visible_from = $5, visible_until = $6
+		WHERE id = $7
+	`, m.Title, m.Description, m.Kind, m.Position, m.VisibleFrom, m.VisibleUntil, m.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrMaterialNotFound
+	}
+	return GetCourseMaterial(ctx, m.ID)
+}
+
+// AddMaterialVersion uploads a new version of a material and makes it current
+func AddMaterialVersion(ctx context.Context, materialID int, v MaterialVersion) (*CourseMaterial, error) {
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var latest int
+		err := tx.QueryRow(ctx, `
+			SELECT (SELECT COALESCE(MAX(version), 0) FROM course_material_versions WHERE material_id = m.id)
+			FROM course_materials m
+			WHERE m.id = $1
+			FOR UPDATE
+		`, materialID).Scan(&latest)
+		if err == pgx.ErrNoRows {
+			return ErrMaterialNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO course_material_versions (material_id, version, file_name, file_url,
+			                                      content_type, file_size, notes, uploaded_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, materialID, latest+1, v.FileName, v.FileURL, v.ContentType, v.FileSize, v.Notes, v.UploadedBy)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE course_materials SET current_version = $1 WHERE id = $2`, latest+1, materialID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCourseMaterial(ctx, materialID)
+}
+
+// GetMaterialVersions returns the version history of a material, newest first
+func GetMaterialVersions(ctx context.Context, materialID int) ([]MaterialVersion, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT `+materialVersionColumns+`
+		FROM course_material_versions v
+		WHERE v.material_id = $1
+		ORDER BY v.version DESC
+	`, materialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []MaterialVersion{}
+	for rows.Next() {
+		var v MaterialVersion
+		err := rows.Scan(&v.ID, &v.MaterialID, &v.Version, &v.FileName, &v.FileURL, &v.ContentType,
+			&v.FileSize, &v.Notes, &v.UploadedBy, &v.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// RestoreMaterialVersion makes an earlier version of a material current again.
+// Later versions stay in the history.
+func RestoreMaterialVersion(ctx context.Context, materialID, version int) (*CourseMaterial, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE course_materials m SET current_version = $2
+		WHERE m.id = $1
+		  AND EXISTS (SELECT 1 FROM course_material_versions v WHERE v.material_id = m.id AND v.version = $2)
+	`, materialID, version)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		if _, err := GetCourseMaterial(ctx, materialID); err != nil {
+			return nil, err
+		}
+		return nil, ErrMaterialVersionNotFound
+	}
+	return GetCourseMaterial(ctx, materialID)
+}
+
+// ReorderCourseMaterials sets the order of a course's materials to the order
+// of materialIDs. Materials left out keep their position.
+func ReorderCourseMaterials(ctx context.Context, courseID int, materialIDs []int) error {
+	return WithTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE course_materials m SET position = o.position
+			FROM UNNEST($2::int[]) WITH ORDINALITY AS o(id, position)
+			WHERE m.id = o.id AND m.course_id = $1
+		`, courseID, materialIDs)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(len(materialIDs)) {
+			return ErrMaterialNotFound
+		}
+		return nil
+	})
+}
+
+// DeleteCourseMaterial removes a material with its version history. Returns
+// the file URLs of every version so the stored files can be removed.
+func DeleteCourseMaterial(ctx context.Context, id int) ([]string, error) {
+	var fileURLs []string
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT file_url FROM course_material_versions WHERE material_id = $1`, id)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var url string
+			if err := rows.Scan(&url); err != nil {
+				rows.Close()
+				return err
+			}
+			fileURLs = append(fileURLs, url)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, `DELETE FROM course_materials WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrMaterialNotFound
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fileURLs, nil
+}
@@ -0,0 +1,31 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCourseMaterialVisibleAt(t *testing.T) {
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		material CourseMaterial
+		at       time.Time
+		want     bool
+	}{
+		{"always visible", CourseMaterial{}, from, true},
+		{"before visible from", CourseMaterial{VisibleFrom: &from}, from.Add(-time.Second), false},
+		{"at visible from", CourseMaterial{VisibleFrom: &from}, from, true},
+		{"before visible until", CourseMaterial{VisibleFrom: &from, VisibleUntil: &until}, until.Add(-time.Second), true},
+		{"at visible until", CourseMaterial{VisibleFrom: &from, VisibleUntil: &until}, until, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.material.VisibleAt(tt.at); got != tt.want {
+				t.Errorf("VisibleAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
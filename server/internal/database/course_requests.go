@@ -0,0 +1,352 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Course request statuses
+const (
+	CourseRequestPending   = "pending"
+	CourseRequestApproved  = "approved"
+	CourseRequestRejected  = "rejected"
+	CourseRequestCancelled = "cancelled"
+)
+
+// ValidCourseRequestStatuses lists course request statuses
+var ValidCourseRequestStatuses = map[string]bool{
+	CourseRequestPending:   true,
+	CourseRequestApproved:  true,
+	CourseRequestRejected:  true,
+	CourseRequestCancelled: true,
+}
+
+var (
+	ErrCourseRequestNotFound    = errors.New("course request not found")
+	ErrCourseRequestNotPending  = errors.New("course request has already been reviewed")
+	ErrCourseRequestDuplicate   = errors.New("you already have a pending request for this course")
+	ErrCourseRequestNeedsCourse = errors.New("courseId is required to approve a request for a book that is not in the system")
+)
+
+// CourseRequest is a student's request to join a course or for a new book
+type CourseRequest struct {
+	ID               int
+	UserID           int
+	UserName         string
+	Email            string
+	EnrollmentNumber *string
+	CourseID         *int
+	CourseName       *string
+	CourseCode       *string
+	CourseTitle      *string // As students see it, respecting name and code visibility
+	Title            *string // Requested book when it is not in the system
+	Author           *string
+	Code             *string
+	Reason           string
+	Status           string
+	AdminComment     *string
+	ReviewedBy       *int
+	ReviewerName     *string
+	ReviewedAt       *time.Time
+	Outcome          *string // enrolled or waitlisted once approved
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// CourseRequestFilter selects course requests
+type CourseRequestFilter struct {
+	Status string
+	UserID *int
+}
+
+const courseRequestColumns = `r.id, r.user_id, COALESCE(NULLIF(u.name, ''), u.username), COALESCE(u.email, ''), u.enrollment_number,
+	r.course_id, c.name, c.code, CASE WHEN c.id IS NOT NULL THEN ` + courseTitleSQL + ` END,
+	r.title, r.author, r.code, r.reason, r.status,
+	r.admin_comment, r.reviewed_by, COALESCE(NULLIF(a.name, ''), a.username), r.reviewed_at, r.outcome,
+	r.created_at, r.updated_at`
+
+const courseRequestFrom = `course_requests r
+	JOIN users u ON u.id = r.user_id
+	LEFT JOIN courses c ON c.id = r.course_id
+	LEFT JOIN users a ON a.id = r.reviewed_by`
+
+// scanCourseRequest scans a row selected with courseRequestColumns
+func scanCourseRequest(row pgx.Row) (*CourseRequest, error) {
+	var r CourseRequest
+	err := row.Scan(
+		&r.ID, &r.UserID, &r.UserName, &r.Email, &r.EnrollmentNumber,
+		&r.CourseID, &r.CourseName, &r.CourseCode, &r.CourseTitle,
+		&r.Title, &r.Author, &r.Code, &r.Reason, &r.Status,
+		&r.AdminComment, &r.ReviewedBy, &r.ReviewerName, &r.ReviewedAt, &r.Outcome,
+		&r.CreatedAt, &r.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// getCourseRequest returns a course request by ID using q
+func getCourseRequest(ctx context.Context, q rowQuerier, id int) (*CourseRequest, error) {
+	r, err := scanCourseRequest(q.QueryRow(ctx, `SELECT `+courseRequestColumns+` FROM `+courseRequestFrom+` WHERE r.id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrCourseRequestNotFound
+	}
+	return r, err
+}
+
+// GetCourseRequest returns a course request by ID
+func GetCourseRequest(ctx context.Context, id int) (*CourseRequest, error) {
+	return getCourseRequest(ctx, GetPool(), id)
+}
+
+// GetCourseRequests returns course requests matching a filter. Pending
+// requests come first, oldest first so they are reviewed in turn, then the
+// rest newest first.
+func GetCourseRequests(ctx context.Context, f CourseRequestFilter) ([]CourseRequest, error) {
+	query := `SELECT ` + courseRequestColumns + ` FROM ` + courseRequestFrom + ` WHERE 1=1`
+	var args []interface{}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		query += ` AND ` + clause + ` $` + strconv.Itoa(len(args))
+	}
+	if f.Status != "" {
+		add(`r.status =`, f.Status)
+	}
+	if f.UserID != nil {
+		add(`r.user_id =`, *f.UserID)
+	}
+	query += `
+		ORDER BY r.status <> 'pending',
+		         CASE WHEN r.status = 'pending' THEN r.created_at END,
+		         r.created_at DESC, r.id DESC
+		LIMIT 500`
+
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	requests := []CourseRequest{}
+	for rows.Next() {
+		r, err := scanCourseRequest(rows)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, *r)
+	}
+	return requests, rows.Err()
+}
+
+// CreateCourseRequest records a student's request to join an existing course
+// (courseID) or for a book that is not in the system (title, author, code)
+func CreateCourseRequest(ctx context.Context, userID int, courseID *int, title, author, code *string, reason string) (*CourseRequest, error) {
+	var request *CourseRequest
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		if courseID != nil {
+			var enrolled, waitlisted, pending bool
+			err := tx.QueryRow(ctx, `
+				SELECT EXISTS (SELECT 1 FROM course_students cs WHERE cs.course_id = c.id AND cs.user_id = $2 AND `+enrollmentActiveSQL+`),
+				       EXISTS (SELECT 1 FROM course_waitlist w WHERE w.course_id = c.id AND w.user_id = $2),
+				       EXISTS (SELECT 1 FROM course_requests r WHERE r.course_id = c.id AND r.user_id = $2 AND r.status = 'pending')
+				FROM courses c WHERE c.id = $1
+			`, *courseID, userID).Scan(&enrolled, &waitlisted, &pending)
+			if err == pgx.ErrNoRows {
+				return ErrCourseNotFound
+			}
+			if err != nil {
+				return err
+			}
+			switch {
+			case enrolled:
+				return ErrAlreadyEnrolled
+			case waitlisted:
+				return ErrAlreadyWaitlisted
+			case pending:
+				return ErrCourseRequestDuplicate
+			}
+		}
+
+		var id int
+		err := tx.QueryRow(ctx, `
+			INSERT INTO course_requests (user_id, course_id, title, author, code, reason)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id
+		`, userID, courseID, title, author, code, reason).Scan(&id)
+		if err != nil {
+			return err
+		}
+		request, err = getCourseRequest(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// lockPendingCourseRequest locks a course request for review, which must
+// still be pending
+func lockPendingCourseRequest(ctx context.Context, tx pgx.Tx, id int) (int, *int, error) {
+	var userID int
+	var courseID *int
+	var status string
+	err := tx.QueryRow(ctx, `SELECT user_id, course_id, status FROM course_requests WHERE id = $1 FOR UPDATE`, id).
+		Scan(&userID, &courseID, &status)
+	if err == pgx.ErrNoRows {
+		return 0, nil, ErrCourseRequestNotFound
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if status != CourseRequestPending {
+		return 0, nil, ErrCourseRequestNotPending
+	}
+	return userID, courseID, nil
+}
+
+// CancelCourseRequest withdraws a student's own pending request
+func CancelCourseRequest(ctx context.Context, id, userID int) (*CourseRequest, error) {
+	var request *CourseRequest
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM course_requests WHERE id = $1 AND user_id = $2 FOR UPDATE`, id, userID).Scan(&status)
+		if err == pgx.ErrNoRows {
+			return ErrCourseRequestNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != CourseRequestPending {
+			return ErrCourseRequestNotPending
+		}
+		if _, err := tx.Exec(ctx, `UPDATE course_requests SET status = 'cancelled' WHERE id = $1`, id); err != nil {
+			return err
+		}
+		request, err = getCourseRequest(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// ApproveCourseRequest approves a pending request and enrolls the student the
+// same way an admin enrolling them would, waitlisting them when the course is
+// full. A request for a book that is not in the system needs the course
+// created for it.
+func ApproveCourseRequest(ctx context.Context, id int, courseID *int, expiry *time.Time, reviewerID int, comment *string) (*CourseRequest, *EnrollmentResult, error) {
+	var request *CourseRequest
+	var result *EnrollmentResult
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		userID, requestedID, err := lockPendingCourseRequest(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if courseID == nil {
+			courseID = requestedID
+		}
+		if courseID == nil {
+			return ErrCourseRequestNeedsCourse
+		}
+
+		result, err = enrollStudent(ctx, tx, *courseID, userID, expiry, &reviewerID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE course_requests
+			SET status = 'approved', course_id = $2, outcome = $3,
+			    admin_comment = $4, reviewed_by = $5, reviewed_at = NOW()
+			WHERE id = $1
+		`, id, *courseID, result.Status, comment, reviewerID)
+		if err != nil {
+			return err
+		}
+		request, err = getCourseRequest(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return request, result, nil
+}
+
+// RejectCourseRequest rejects a pending request with a comment for the student
+func RejectCourseRequest(ctx context.Context, id, reviewerID int, comment string) (*CourseRequest, error) {
+	var request *CourseRequest
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		if _, _, err := lockPendingCourseRequest(ctx, tx, id); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE course_requests
+			SET status = 'rejected', admin_comment = $2, reviewed_by = $3, reviewed_at = NOW()
+			WHERE id = $1
+		`, id, comment, reviewerID)
+		if err != nil {
+			return err
+		}
+		request, err = getCourseRequest(ctx, tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// CatalogCourse is a course students can ask to join
+type CatalogCourse struct {
+	ID         int
+	Title      string // As students see it, respecting name and code visibility
+	Author     *string
+	Department *string
+	ToDate     *time.Time
+	HasBook    bool
+	Enrolled   bool // The student has an unexpired enrollment
+	Waitlisted bool
+	Requested  bool // The student has a pending request
+}
+
+// GetCourseCatalog returns the courses that have not ended, with the
+// student's standing in each, optionally filtered by title, author or
+// department
+func GetCourseCatalog(ctx context.Context, userID int, search string) ([]CatalogCourse, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT c.id, `+courseTitleSQL+` AS title, c.author, c.department, c.to_date,
+		       `+courseBookSourceSQL+` IS NOT NULL,
+		       EXISTS (SELECT 1 FROM course_students cs WHERE cs.course_id = c.id AND cs.user_id = $1 AND `+enrollmentActiveSQL+`),
+		       EXISTS (SELECT 1 FROM course_waitlist w WHERE w.course_id = c.id AND w.user_id = $1),
+		       EXISTS (SELECT 1 FROM course_requests r WHERE r.course_id = c.id AND r.user_id = $1 AND r.status = 'pending')
+		FROM courses c
+		WHERE NOT `+courseEndedSQL+`
+		  AND ($2 = '' OR LOWER(`+courseTitleSQL+`) LIKE LOWER('%' || $2 || '%')
+		       OR LOWER(COALESCE(c.author, '')) LIKE LOWER('%' || $2 || '%')
+		       OR LOWER(COALESCE(c.department, '')) LIKE LOWER('%' || $2 || '%'))
+		ORDER BY title, c.id
+	`, userID, search)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []CatalogCourse{}
+	for rows.Next() {
+		var cc CatalogCourse
+		err := rows.Scan(&cc.ID, &cc.Title, &cc.Author, &cc.Department, &cc.ToDate, &cc.HasBook,
+			&cc.Enrolled, &cc.Waitlisted, &cc.Requested)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, cc)
+	}
+	return courses, rows.Err()
+}
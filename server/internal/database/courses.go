@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrCourseNotFound     = errors.New("course not found")
+	ErrNotEnrolled        = errors.New("you are not enrolled in this course")
+	ErrEnrollmentExpired  = errors.New("your enrollment in this course has expired")
+	ErrCourseEnded        = errors.New("this course has ended")
+	ErrCourseBookNotFound = errors.New("this course has no book")
+)
+
+// Enrollments are active until their expiry_date (end of day in the
+// institution timezone) and courses run until the end of their to_date there.
+// Sessions run in the institution timezone (see Connect).
+const (
+	enrollmentActiveSQL = `(cs.expiry_date IS NULL OR cs.expiry_date > NOW())`
+	courseEndedSQL      = `(c.to_date IS NOT NULL AND c.to_date < (NOW() AT TIME ZONE current_setting('TimeZone'))::date)`
+)
+
+// StudentCourse is a course a student is enrolled in
+type StudentCourse struct {
+	ID               int
+	EnrollmentID     int
+	UserID           int
+	StudentName      string
+	EnrollmentNumber *string
+	Code             string
+	Name             string
+	Author           *string
+	Department       *string
+	ShowCourseName   bool
+	ShowCourseCode   bool
+	ToDate           *time.Time
+	ExpiryDate       *time.Time
+	EnrolledAt       time.Time
+	HasBook          bool
+	Active           bool // Enrollment not expired
+	Ended            bool // Course past its to_date
+}
+
+// Accessible reports whether the student can currently open the course
+func (c StudentCourse) Accessible() bool {
+	return c.Active && !c.Ended
+}
+
+// AccessError explains why the student cannot open the course, or nil
+func (c StudentCourse) AccessError() error {
+	if !c.Active {
+		return ErrEnrollmentExpired
+	}
+	if c.Ended {
+		return ErrCourseEnded
+	}
+	return nil
+}
+
+const studentCourseColumns = `c.id, cs.id, u.id, COALESCE(NULLIF(u.name, ''), u.username), u.enrollment_number, c.code, c.name, c.author, c.department,
+	COALESCE(c.show_course_name, true), COALESCE(c.show_course_code, true), c.to_date,
+	cs.expiry_date, cs.created_at,
+	` + courseBookSourceSQL + ` IS NOT NULL,
+	` + enrollmentActiveSQL + `, ` + courseEndedSQL
+
+// scanStudentCourse scans a row selected with studentCourseColumns
+func scanStudentCourse(row pgx.Row) (*StudentCourse, error) {
+	var sc StudentCourse
+	err := row.Scan(
+		&sc.ID, &sc.EnrollmentID, &sc.UserID, &sc.StudentName, &sc.EnrollmentNumber, &sc.Code, &sc.Name, &sc.Author, &sc.Department,
+		&sc.ShowCourseName, &sc.ShowCourseCode, &sc.ToDate,
+		&sc.ExpiryDate, &sc.EnrolledAt, &sc.HasBook, &sc.Active, &sc.Ended,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &sc, nil
+}
+
+// GetStudentCourses returns the courses a student is enrolled in. Expired
+// enrollments and ended courses are only included when includeInactive is set.
+func GetStudentCourses(ctx context.Context, userID int, includeInactive bool) ([]StudentCourse, error) {
+	query := `
+		SELECT ` + studentCourseColumns + `
+		FROM course_students cs
+		JOIN courses c ON c.id = cs.course_id
+		JOIN users u ON u.id = cs.user_id
+		WHERE cs.user_id = $1`
+	if !includeInactive {
+		query += ` AND ` + enrollmentActiveSQL + ` AND NOT ` + courseEndedSQL
+	}
+	query += ` ORDER BY c.name, c.id`
+
+	rows, err := GetPool().Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	courses := []StudentCourse{}
+	for rows.Next() {
+		sc, err := scanStudentCourse(rows)
+		if err != nil {
+			return nil, err
+		}
+		courses = append(courses, *sc)
+	}
+	return courses, rows.Err()
+}
+
+// GetStudentCourse returns a course the student is enrolled in, whether or
+// not the enrollment is still active
+func GetStudentCourse(ctx context.Context, courseID, userID int) (*StudentCourse, error) {
+	sc, err := scanStudentCourse(GetPool().QueryRow(ctx, `
+		SELECT `+studentCourseColumns+`
+		FROM course_students cs
+		JOIN courses c ON c.id = cs.course_id
+		JOIN users u ON u.id = cs.user_id
+		WHERE cs.course_id = $1 AND cs.user_id = $2
+	`, courseID, userID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrNotEnrolled
+	}
+	return sc, err
+}
+
+// CourseBook is where a course's book PDF is stored
+type CourseBook struct {
+	CourseID int
+	Code     string
+	Name     string
+	URL      *string
+	Path     *string
+}
+
+// GetCourseBook returns the stored location of a course's book
+func GetCourseBook(ctx context.Context, courseID int) (*CourseBook, error) {
+	var b CourseBook
+	err := GetPool().QueryRow(ctx, `
+		SELECT id, code, name, NULLIF(book_pdf_url, ''), NULLIF(book_pdf_path, '')
+		FROM courses WHERE id = $1
+	`, courseID).Scan(&b.CourseID, &b.Code, &b.Name, &b.URL, &b.Path)
+	if err == pgx.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if b.URL == nil && b.Path == nil {
+		return nil, ErrCourseBookNotFound
+	}
+	return &b, nil
+}
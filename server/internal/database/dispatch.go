@@ -0,0 +1,463 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrRideNotDispatchable = errors.New("ride is not waiting for a driver")
+	ErrOfferNotFound       = errors.New("no open offer for this ride")
+)
+
+// DriverShift is a weekly shift in the institution timezone. A shift ending
+// at or before its start time runs past midnight.
+type DriverShift struct {
+	ID        int    `json:"id"`
+	DriverID  int    `json:"driverId"`
+	DayOfWeek int32  `json:"dayOfWeek"` // 0 = Sunday ... 6 = Saturday
+	StartTime string `json:"startTime"` // HH:MM
+	EndTime   string `json:"endTime"`   // HH:MM
+}
+
+// DriverAvailability is a driver's duty state, shifts and current vehicle
+type DriverAvailability struct {
+	DriverMatch
+	OnDuty      bool          `json:"onDuty"`
+	OnDutySince *time.Time    `json:"onDutySince"`
+	Shifts      []DriverShift `json:"shifts"`
+}
+
+// DispatchRide is a ride bill as seen by the dispatcher
+type DispatchRide struct {
+	ID             int
+	Needs          []string
+	RideAt         time.Time // Scheduled time, or the booking time for immediate rides
+	Status         string
+	DispatchStatus string
+}
+
+// DriverRide is a ride offered to or accepted by a driver
+type DriverRide struct {
+	BillID             int        `json:"billId"`
+	StudentName        string     `json:"studentName"`
+	FromLocation       string     `json:"fromLocation"`
+	ToLocation         string     `json:"toLocation"`
+	RideAt             time.Time  `json:"rideAt"`
+	AccessibilityNeeds []string   `json:"accessibilityNeeds"`
+	DispatchStatus     string     `json:"dispatchStatus"`
+	OfferedAt          *time.Time `json:"offeredAt"`
+	AcceptedAt         *time.Time `json:"acceptedAt"`
+}
+
+// GetDriverShifts returns a driver's weekly shifts
+func GetDriverShifts(ctx context.Context, driverID int) ([]DriverShift, error) {
+	byDriver, err := getShiftsByDriver(ctx, []int{driverID})
+	if err != nil {
+		return nil, err
+	}
+	if shifts, ok := byDriver[driverID]; ok {
+		return shifts, nil
+	}
+	return []DriverShift{}, nil
+}
+
+// getShiftsByDriver loads the shifts of several drivers at once
+func getShiftsByDriver(ctx context.Context, driverIDs []int) (map[int][]DriverShift, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT id, driver_id, day_of_week, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI')
+		FROM driver_shifts
+		WHERE driver_id = ANY($1)
+		ORDER BY driver_id, day_of_week, start_time
+	`, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shifts := map[int][]DriverShift{}
+	for rows.Next() {
+		var s DriverShift
+		if err := rows.Scan(&s.ID, &s.DriverID, &s.DayOfWeek, &s.StartTime, &s.EndTime); err != nil {
+			return nil, err
+		}
+		shifts[s.DriverID] = append(shifts[s.DriverID], s)
+	}
+	return shifts, rows.Err()
+}
+
+// ReplaceDriverShifts replaces a driver's weekly shift schedule
+func ReplaceDriverShifts(ctx context.Context, driverID int, shifts []DriverShift) ([]DriverShift, error) {
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var isDriver bool
+		err := tx.QueryRow(ctx, `SELECT LOWER(role) = 'driver' FROM users WHERE id = $1`, driverID).Scan(&isDriver)
+		if err == pgx.ErrNoRows || (err == nil && !isDriver) {
+			return ErrDriverNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(ctx, `DELETE FROM driver_shifts WHERE driver_id = $1`, driverID); err != nil {
+			return err
+		}
+		for _, s := range shifts {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO driver_shifts (driver_id, day_of_week, start_time, end_time)
+				VALUES ($1, $2, $3::time, $4::time)
+			`, driverID, s.DayOfWeek, s.StartTime, s.EndTime)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetDriverShifts(ctx, driverID)
+}
+
+// SetDriverOnDuty puts a driver on or off duty
+func SetDriverOnDuty(ctx context.Context, driverID int, onDuty bool) (*DriverAvailability, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE users
+		SET on_duty_since = CASE WHEN $1 THEN COALESCE(CASE WHEN on_duty THEN on_duty_since END, NOW()) END,
+		    on_duty = $1
+		WHERE id = $2 AND LOWER(role) = 'driver'
+	`, onDuty, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrDriverNotFound
+	}
+	return GetDriverAvailabilityByID(ctx, driverID)
+}
+
+const driverAvailabilityColumns = driverMatchColumns + `, u.on_duty, u.on_duty_since`
+
+// queryDriverAvailability runs a query selecting driverAvailabilityColumns
+// and attaches each driver's shifts
+func queryDriverAvailability(ctx context.Context, needs []string, query string, args ...interface{}) ([]DriverAvailability, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	drivers := []DriverAvailability{}
+	var ids []int
+	for rows.Next() {
+		var d DriverAvailability
+		err := rows.Scan(&d.DriverID, &d.Name, &d.VehicleID, &d.VehicleNumber, &d.VehicleType,
+			&d.Capabilities, &d.ActiveRides, &d.OnDuty, &d.OnDutySince)
+		if err != nil {
+			return nil, err
+		}
+		d.Missing = MissingCapabilities(needs, d.Capabilities)
+		d.Shifts = []DriverShift{}
+		drivers = append(drivers, d)
+		ids = append(ids, d.DriverID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return drivers, nil
+	}
+	shifts, err := getShiftsByDriver(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range drivers {
+		if s, ok := shifts[drivers[i].DriverID]; ok {
+			drivers[i].Shifts = s
+		}
+	}
+	return drivers, nil
+}
+
+// GetDriverAvailability returns active drivers with their duty state, shifts
+// and vehicle, checked against needs. Compatible, least busy drivers come first.
+func GetDriverAvailability(ctx context.Context, needs []string, onDutyOnly bool) ([]DriverAvailability, error) {
+	query := `SELECT ` + driverAvailabilityColumns + `
+		FROM ` + driverMatchFrom + `
+		WHERE LOWER(u.role) = 'driver' AND COALESCE(u.status, 'active') = 'active'`
+	if onDutyOnly {
+		query += ` AND u.on_duty`
+	}
+	query += ` ORDER BY u.id`
+
+	drivers, err := queryDriverAvailability(ctx, needs, query)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(drivers, func(i, j int) bool {
+		return lessDriverMatch(drivers[i].DriverMatch, drivers[j].DriverMatch)
+	})
+	return drivers, nil
+}
+
+// GetDriverAvailabilityByID returns a single driver's availability
+func GetDriverAvailabilityByID(ctx context.Context, driverID int) (*DriverAvailability, error) {
+	query := `SELECT ` + driverAvailabilityColumns + `
+		FROM ` + driverMatchFrom + `
+		WHERE u.id = $1 AND LOWER(u.role) = 'driver'`
+	drivers, err := queryDriverAvailability(ctx, nil, query, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if len(drivers) == 0 {
+		return nil, ErrDriverNotFound
+	}
+	return &drivers[0], nil
+}
+
+const dispatchRideColumns = `id, accessibility_needs, COALESCE(scheduled_for, created_at), status, dispatch_status`
+
+// GetDispatchRide returns the dispatch state of a ride bill
+func GetDispatchRide(ctx context.Context, billID int) (*DispatchRide, error) {
+	var r DispatchRide
+	err := GetPool().QueryRow(ctx, `SELECT `+dispatchRideColumns+` FROM ride_bills WHERE id = $1`, billID).
+		Scan(&r.ID, &r.Needs, &r.RideAt, &r.Status, &r.DispatchStatus)
+	if err == pgx.ErrNoRows {
+		return nil, ErrBillNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// GetDueDispatchRides returns rides waiting for a driver whose ride time is
+// between from and to, earliest first
+func GetDueDispatchRides(ctx context.Context, from, to time.Time) ([]DispatchRide, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT `+dispatchRideColumns+`
+		FROM ride_bills
+		WHERE dispatch_status = 'unassigned'
+		  AND status NOT IN ('cancelled', 'refunded')
+		  AND COALESCE(scheduled_for, created_at) BETWEEN $1 AND $2
+		ORDER BY COALESCE(scheduled_for, created_at), id
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rides := []DispatchRide{}
+	for rows.Next() {
+		var r DispatchRide
+		if err := rows.Scan(&r.ID, &r.Needs, &r.RideAt, &r.Status, &r.DispatchStatus); err != nil {
+			return nil, err
+		}
+		rides = append(rides, r)
+	}
+	return rides, rows.Err()
+}
+
+// GetRejectedDrivers returns the drivers who declined a ride or let its offer time out
+func GetRejectedDrivers(ctx context.Context, billID int) (map[int]bool, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT DISTINCT driver_id FROM ride_dispatch_attempts
+		WHERE ride_bill_id = $1 AND outcome IN ('declined', 'timed_out')
+	`, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rejected := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		rejected[id] = true
+	}
+	return rejected, rows.Err()
+}
+
+// lockDriverMatch checks an active driver against needs inside a transaction
+func lockDriverMatch(ctx context.Context, tx pgx.Tx, driverID int, needs []string) (*DriverMatch, error) {
+	query := `SELECT ` + driverMatchColumns + `
+		FROM ` + driverMatchFrom + `
+		WHERE u.id = $1 AND LOWER(u.role) = 'driver' AND COALESCE(u.status, 'active') = 'active'`
+	match, err := scanDriverMatch(tx.QueryRow(ctx, query, driverID), needs)
+	if err == pgx.ErrNoRows {
+		return nil, ErrDriverNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !match.Compatible() {
+		return nil, &AccessibilityMismatchError{Missing: match.Missing}
+	}
+	return match, nil
+}
+
+// OfferRide offers a ride waiting for a driver to the given driver
+func OfferRide(ctx context.Context, billID, driverID int) (*DriverMatch, error) {
+	var match *DriverMatch
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var needs []string
+		var status, dispatchStatus string
+		err := tx.QueryRow(ctx,
+			`SELECT accessibility_needs, status, dispatch_status FROM ride_bills WHERE id = $1 FOR UPDATE`, billID,
+		).Scan(&needs, &status, &dispatchStatus)
+		if err == pgx.ErrNoRows {
+			return ErrBillNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if dispatchStatus != "unassigned" || status == "cancelled" || status == "refunded" {
+			return ErrRideNotDispatchable
+		}
+
+		match, err = lockDriverMatch(ctx, tx, driverID, needs)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE ride_bills
+			SET driver_id = $1, driver = $2, vehicle_id = $3,
+			    dispatch_status = 'offered', offered_at = NOW(), accepted_at = NULL
+			WHERE id = $4
+		`, driverID, match.Name, match.VehicleID, billID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO ride_dispatch_attempts (ride_bill_id, driver_id) VALUES ($1, $2)
+		`, billID, driverID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return match, nil
+}
+
+// RespondToOffer records a driver accepting or declining a ride offered to
+// them. A declined ride goes back to waiting for a driver.
+func RespondToOffer(ctx context.Context, billID, driverID int, accept bool) error {
+	return WithTransaction(ctx, func(tx pgx.Tx) error {
+		outcome := "declined"
+		if accept {
+			outcome = "accepted"
+		}
+
+		var attemptID int
+		err := tx.QueryRow(ctx, `
+			UPDATE ride_dispatch_attempts
+			SET outcome = $1, responded_at = NOW()
+			WHERE ride_bill_id = $2 AND driver_id = $3 AND outcome = 'offered'
+			RETURNING id
+		`, outcome, billID, driverID).Scan(&attemptID)
+		if err == pgx.ErrNoRows {
+			return ErrOfferNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if accept {
+			_, err = tx.Exec(ctx, `
+				UPDATE ride_bills SET dispatch_status = 'accepted', accepted_at = NOW()
+				WHERE id = $1 AND driver_id = $2 AND dispatch_status = 'offered'
+			`, billID, driverID)
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+			UPDATE ride_bills
+			SET dispatch_status = 'unassigned', driver_id = NULL, driver = NULL, vehicle_id = NULL, offered_at = NULL
+			WHERE id = $1 AND driver_id = $2 AND dispatch_status = 'offered'
+		`, billID, driverID)
+		return err
+	})
+}
+
+// ExpireOffers times out offers made before the given time and puts their
+// rides back to waiting for a driver. Returns the affected ride bill IDs.
+func ExpireOffers(ctx context.Context, offeredBefore time.Time) ([]int, error) {
+	var billIDs []int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			UPDATE ride_dispatch_attempts
+			SET outcome = 'timed_out', responded_at = NOW()
+			WHERE outcome = 'offered' AND offered_at < $1
+			RETURNING ride_bill_id
+		`, offeredBefore)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			billIDs = append(billIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(billIDs) == 0 {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE ride_bills
+			SET dispatch_status = 'unassigned', driver_id = NULL, driver = NULL, vehicle_id = NULL, offered_at = NULL
+			WHERE id = ANY($1) AND dispatch_status = 'offered'
+		`, billIDs)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return billIDs, nil
+}
+
+// GetDriverRides returns the upcoming rides offered to or accepted by a driver
+func GetDriverRides(ctx context.Context, driverID int, since time.Time) ([]DriverRide, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT rb.id, COALESCE(u.name, u.username, ''), rb.from_location, rb.to_location,
+		       COALESCE(rb.scheduled_for, rb.created_at), rb.accessibility_needs,
+		       rb.dispatch_status, rb.offered_at, rb.accepted_at
+		FROM ride_bills rb
+		LEFT JOIN users u ON u.id = rb.user_id
+		WHERE rb.driver_id = $1
+		  AND rb.dispatch_status IN ('offered', 'accepted')
+		  AND rb.status NOT IN ('cancelled', 'refunded')
+		  AND COALESCE(rb.scheduled_for, rb.created_at) >= $2
+		ORDER BY COALESCE(rb.scheduled_for, rb.created_at), rb.id
+	`, driverID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rides := []DriverRide{}
+	for rows.Next() {
+		var r DriverRide
+		err := rows.Scan(&r.BillID, &r.StudentName, &r.FromLocation, &r.ToLocation,
+			&r.RideAt, &r.AccessibilityNeeds, &r.DispatchStatus, &r.OfferedAt, &r.AcceptedAt)
+		if err != nil {
+			return nil, err
+		}
+		rides = append(rides, r)
+	}
+	return rides, rows.Err()
+}
@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Limits on renewal windows
+const (
+	MaxRenewalWindowDays = 365
+	MaxRenewalWindows    = 10
+)
+
+var (
+	ErrInvalidRenewalWindow  = errors.New("renewal windows must be between 1 and 365 days")
+	ErrTooManyRenewalWindows = errors.New("at most 10 renewal windows are allowed")
+)
+
+// expiryNoticeWindow is how long after expiring an enrollment is still worth
+// telling the student about; older expiries are recorded silently, such as
+// those from before the expiry job ran for the first time
+const expiryNoticeWindow = "7 days"
+
+// NormalizeRenewalWindows validates renewal windows given in days before
+// expiry and returns them deduplicated, largest first
+func NormalizeRenewalWindows(days []int) ([]int, error) {
+	seen := make(map[int]bool, len(days))
+	windows := []int{}
+	for _, d := range days {
+		if d < 1 || d > MaxRenewalWindowDays {
+			return nil, ErrInvalidRenewalWindow
+		}
+		if !seen[d] {
+			seen[d] = true
+			windows = append(windows, d)
+		}
+	}
+	if len(windows) > MaxRenewalWindows {
+		return nil, ErrTooManyRenewalWindows
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(windows)))
+	return windows, nil
+}
+
+// EnrollmentSettings are the institution-wide enrollment expiry settings
+type EnrollmentSettings struct {
+	RenewalWindowDays []int // Days before expiry students are reminded
+	NotifyAdmins      bool
+	UpdatedBy         *int
+	UpdatedAt         time.Time
+}
+
+// GetEnrollmentSettings returns the institution-wide enrollment settings
+func GetEnrollmentSettings(ctx context.Context) (*EnrollmentSettings, error) {
+	var s EnrollmentSettings
+	err := GetPool().QueryRow(ctx, `
+		SELECT renewal_window_days, notify_admins, updated_by, updated_at
+		FROM enrollment_settings WHERE id
+	`).Scan(&s.RenewalWindowDays, &s.NotifyAdmins, &s.UpdatedBy, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// UpdateEnrollmentSettings replaces the institution-wide enrollment settings.
+// An empty list of renewal windows turns reminders off.
+func UpdateEnrollmentSettings(ctx context.Context, windows []int, notifyAdmins bool, updatedBy *int) (*EnrollmentSettings, error) {
+	windows, err := NormalizeRenewalWindows(windows)
+	if err != nil {
+		return nil, err
+	}
+	var s EnrollmentSettings
+	err = GetPool().QueryRow(ctx, `
+		INSERT INTO enrollment_settings (id, renewal_window_days, notify_admins, updated_by)
+		VALUES (TRUE, $1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET
+			renewal_window_days = EXCLUDED.renewal_window_days,
+			notify_admins = EXCLUDED.notify_admins,
+			updated_by = EXCLUDED.updated_by
+		RETURNING renewal_window_days, notify_admins, updated_by, updated_at
+	`, windows, notifyAdmins, updatedBy).Scan(&s.RenewalWindowDays, &s.NotifyAdmins, &s.UpdatedBy, &s.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// CourseRenewalWindows are the renewal windows that apply to a course
+type CourseRenewalWindows struct {
+	Days      []int
+	Inherited bool // The course uses the institution default
+}
+
+// GetCourseRenewalWindows returns the renewal windows that apply to a course
+func GetCourseRenewalWindows(ctx context.Context, courseID int) (*CourseRenewalWindows, error) {
+	var w CourseRenewalWindows
+	err := GetPool().QueryRow(ctx, `
+		SELECT COALESCE(c.renewal_window_days, s.renewal_window_days), c.renewal_window_days IS NULL
+		FROM courses c CROSS JOIN enrollment_settings s
+		WHERE c.id = $1
+	`, courseID).Scan(&w.Days, &w.Inherited)
+	if err == pgx.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// SetCourseRenewalWindows overrides the renewal windows of a course. Nil
+// windows go back to the institution default; an empty list turns reminders
+// off for the course.
+func SetCourseRenewalWindows(ctx context.Context, courseID int, windows []int) error {
+	if windows != nil {
+		var err error
+		if windows, err = NormalizeRenewalWindows(windows); err != nil {
+			return err
+		}
+	}
+	tag, err := GetPool().Exec(ctx, `UPDATE courses SET renewal_window_days = $1 WHERE id = $2`, windows, courseID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCourseNotFound
+	}
+	return nil
+}
+
+// EnrollmentExpiry is an enrollment that is about to expire or has expired
+type EnrollmentExpiry struct {
+	EnrollmentID      int
+	CourseID          int
+	CourseTitle       string // As students see it, respecting name and code visibility
+	UserID            int
+	UserName          string
+	Email             string
+	ExpiryDate        time.Time
+	DaysLeft          int   // Calendar days in the institution timezone until expiry, 0 on the last day
+	RemindedDays      *int  // Smallest renewal window already reminded
+	RenewalWindowDays []int // Renewal windows of the course, largest first
+	Notify            bool  // Expired recently enough to tell the student
+}
+
+// GetExpiringEnrollments returns active enrollments that are inside one of
+// their course's renewal windows, soonest expiry first. Enrollments in
+// courses that have ended are left out since they cannot be renewed.
+func GetExpiringEnrollments(ctx context.Context) ([]EnrollmentExpiry, error) {
+	rows, err := GetPool().Query(ctx, `
+		WITH expiring AS (
+			SELECT cs.id, cs.course_id, `+courseTitleSQL+` AS title, cs.user_id,
+			       COALESCE(NULLIF(u.name, ''), u.username) AS user_name, COALESCE(u.email, '') AS email,
+			       cs.expiry_date,
+			       (cs.expiry_date AT TIME ZONE current_setting('TimeZone'))::date - (NOW() AT TIME ZONE current_setting('TimeZone'))::date AS days_left,
+			       cs.renewal_reminded_days,
+			       COALESCE(c.renewal_window_days, s.renewal_window_days) AS windows
+			FROM course_students cs
+			JOIN courses c ON c.id = cs.course_id
+			JOIN users u ON u.id = cs.user_id
+			CROSS JOIN enrollment_settings s
+			WHERE cs.status = 'active' AND cs.expiry_date IS NOT NULL
+			  AND `+enrollmentActiveSQL+` AND NOT `+courseEndedSQL+`
+		)
+		SELECT id, course_id, title, user_id, user_name, email, expiry_date, days_left, renewal_reminded_days, windows
+		FROM expiring
+		WHERE days_left <= (SELECT COALESCE(MAX(d), -1) FROM UNNEST(windows) d)
+		ORDER BY expiry_date, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiring := []EnrollmentExpiry{}
+	for rows.Next() {
+		var e EnrollmentExpiry
+		err := rows.Scan(&e.EnrollmentID, &e.CourseID, &e.CourseTitle, &e.UserID, &e.UserName, &e.Email,
+			&e.ExpiryDate, &e.DaysLeft, &e.RemindedDays, &e.RenewalWindowDays)
+		if err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, e)
+	}
+	return expiring, rows.Err()
+}
+
+// MarkRenewalReminded records that a student was reminded in the given
+// renewal window. It reports false when another run already reminded them
+// in that window or the expiry date changed since it was read.
+func MarkRenewalReminded(ctx context.Context, enrollmentID, windowDays int, expiry time.Time) (bool, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE course_students SET renewal_reminded_days = $2
+		WHERE id = $1 AND status = 'active' AND expiry_date = $3
+		  AND (renewal_reminded_days IS NULL OR renewal_reminded_days > $2)
+	`, enrollmentID, windowDays, expiry)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ExpireEnrollments marks active enrollments whose expiry date has passed as
+// expired and returns them
+func ExpireEnrollments(ctx context.Context) ([]EnrollmentExpiry, error) {
+	rows, err := GetPool().Query(ctx, `
+		UPDATE course_students cs SET status = 'expired', expired_at = NOW()
+		FROM courses c, users u
+		WHERE c.id = cs.course_id AND u.id = cs.user_id
+		  AND cs.status = 'active' AND cs.expiry_date IS NOT NULL
+		  AND NOT `+enrollmentActiveSQL+`
+		RETURNING cs.id, cs.course_id, `+courseTitleSQL+`, cs.user_id,
+		          COALESCE(NULLIF(u.name, ''), u.username), COALESCE(u.email, ''),
+		          cs.expiry_date, cs.expiry_date > NOW() - INTERVAL '`+expiryNoticeWindow+`'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := []EnrollmentExpiry{}
+	for rows.Next() {
+		var e EnrollmentExpiry
+		err := rows.Scan(&e.EnrollmentID, &e.CourseID, &e.CourseTitle, &e.UserID, &e.UserName, &e.Email,
+			&e.ExpiryDate, &e.Notify)
+		if err != nil {
+			return nil, err
+		}
+		expired = append(expired, e)
+	}
+	return expired, rows.Err()
+}
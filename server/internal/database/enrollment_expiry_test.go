@@ -0,0 +1,35 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeRenewalWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		days    []int
+		want    []int
+		wantErr error
+	}{
+		{"empty turns reminders off", []int{}, []int{}, nil},
+		{"sorted largest first", []int{1, 14, 7}, []int{14, 7, 1}, nil},
+		{"duplicates removed", []int{7, 1, 7}, []int{7, 1}, nil},
+		{"zero rejected", []int{7, 0}, nil, ErrInvalidRenewalWindow},
+		{"negative rejected", []int{-3}, nil, ErrInvalidRenewalWindow},
+		{"over a year rejected", []int{366}, nil, ErrInvalidRenewalWindow},
+		{"too many", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, nil, ErrTooManyRenewalWindows},
+		{"duplicates do not count towards the limit", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 10}, []int{10, 9, 8, 7, 6, 5, 4, 3, 2, 1}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeRenewalWindows(tt.days)
+			if err != tt.wantErr {
+				t.Fatalf("NormalizeRenewalWindows() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NormalizeRenewalWindows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
+)
+
+var (
+	ErrUserNotFound          = errors.New("user not found")
+	ErrEnrollmentNotFound    = errors.New("enrollment not found")
+	ErrAlreadyEnrolled       = errors.New("user is already enrolled in this course")
+	ErrAlreadyWaitlisted     = errors.New("user is already on the waitlist for this course")
+	ErrCourseFull            = errors.New("course is full")
+	ErrWaitlistEntryNotFound = errors.New("waitlist entry not found")
+	ErrWaitlistIncomplete    = errors.New("waitlistIds must list every waitlisted student once")
+)
+
+// enrollmentRenewedSQL resets expiry tracking when the expiry date of an
+// enrollment changes, so reminders start over for the new date
+const enrollmentRenewedSQL = `status = 'active', expired_at = NULL, renewal_reminded_days = NULL`
+
+// courseTitleSQL is the title of course c as students see it, respecting
+// name and code visibility
+const courseTitleSQL = `CASE WHEN COALESCE(c.show_course_name, true) THEN c.name
+	WHEN COALESCE(c.show_course_code, true) THEN c.code
+	ELSE 'Course ' || c.id END`
+
+// Outcomes of enrolling a student
+const (
+	EnrollmentEnrolled   = "enrolled"
+	EnrollmentWaitlisted = "waitlisted"
+)
+
+// EnrollmentResult is the outcome of enrolling a student in a course
+type EnrollmentResult struct {
+	Status       string
+	EnrollmentID int // Set when enrolled
+	WaitlistID   int // Set when waitlisted
+	Position     int // Place on the waitlist, from 1
+}
+
+// hasFreePlace reports whether a course with capacity (nil for no limit) and
+// active unexpired enrollments has a place for a student with waiting
+// students ahead of them
+func hasFreePlace(capacity *int, active, waiting int) bool {
+	return capacity == nil || active+waiting < *capacity
+}
+
+// lockCourseCapacity locks a course against concurrent enrollment changes and
+// returns its capacity and number of unexpired enrollments
+func lockCourseCapacity(ctx context.Context, tx pgx.Tx, courseID int) (*int, int, error) {
+	var capacity *int
+	err := tx.QueryRow(ctx, `SELECT max_students FROM courses WHERE id = $1 FOR UPDATE`, courseID).Scan(&capacity)
+	if err == pgx.ErrNoRows {
+		return nil, 0, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var active int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM course_students cs
+		WHERE cs.course_id = $1 AND `+enrollmentActiveSQL, courseID).Scan(&active)
+	return capacity, active, err
+}
+
+// enrollStudent enrolls a student, or adds them to the end of the waitlist
+// when the course has no free place. Students on the waitlist keep their
+// claim on places that become free, so a new student is only enrolled when
+// there are more free places than waiting students. An expired enrollment of
+// the student is renewed rather than duplicated.
+func enrollStudent(ctx context.Context, tx pgx.Tx, courseID, userID int, expiry *time.Time, addedBy *int) (*EnrollmentResult, error) {
+	capacity, active, err := lockCourseCapacity(ctx, tx, courseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+
+	var existingID *int
+	var existingActive bool
+	err = tx.QueryRow(ctx, `
+		SELECT cs.id, `+enrollmentActiveSQL+`
+		FROM course_students cs
+		WHERE cs.course_id = $1 AND cs.user_id = $2
+	`, courseID, userID).Scan(&existingID, &existingActive)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if existingID != nil && existingActive {
+		return nil, ErrAlreadyEnrolled
+	}
+
+	var waiting int
+	var waitlisted bool
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(user_id = $2), false)
+		FROM course_waitlist WHERE course_id = $1
+	`, courseID, userID).Scan(&waiting, &waitlisted)
+	if err != nil {
+		return nil, err
+	}
+	if waitlisted {
+		return nil, ErrAlreadyWaitlisted
+	}
+
+	if !hasFreePlace(capacity, active, waiting) {
+		result := &EnrollmentResult{Status: EnrollmentWaitlisted, Position: waiting + 1}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO course_waitlist (course_id, user_id, position, expiry_date, added_by)
+			VALUES ($1, $2, (SELECT COALESCE(MAX(position), 0) + 1 FROM course_waitlist WHERE course_id = $1), $3, $4)
+			RETURNING id
+		`, courseID, userID, expiry, addedBy).Scan(&result.WaitlistID)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	result := &EnrollmentResult{Status: EnrollmentEnrolled}
+	if existingID != nil {
+		result.EnrollmentID = *existingID
+		_, err = tx.Exec(ctx, `UPDATE course_students SET expiry_date = $1, `+enrollmentRenewedSQL+` WHERE id = $2`, expiry, *existingID)
+	} else {
+		err = tx.QueryRow(ctx, `
+			INSERT INTO course_students (course_id, user_id, expiry_date)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, courseID, userID, expiry).Scan(&result.EnrollmentID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// EnrollStudent enrolls a student in a course with an optional expiry, or
+// waitlists them when the course is full
+func EnrollStudent(ctx context.Context, courseID, userID int, expiry *time.Time, addedBy *int) (*EnrollmentResult, error) {
+	var result *EnrollmentResult
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		result, err = enrollStudent(ctx, tx, courseID, userID, expiry, addedBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateEnrollmentExpiry changes when an enrollment expires. Reactivating an
+// expired enrollment needs a free place like a new enrollment. Returns the
+// enrollment's course.
+func UpdateEnrollmentExpiry(ctx context.Context, enrollmentID int, expiry *time.Time) (int, error) {
+	var courseID int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		// Lock the course before the enrollment, in the order enrollStudent does
+		err := tx.QueryRow(ctx, `SELECT course_id FROM course_students WHERE id = $1`, enrollmentID).Scan(&courseID)
+		if err == pgx.ErrNoRows {
+			return ErrEnrollmentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		capacity, active, err := lockCourseCapacity(ctx, tx, courseID)
+		if err != nil {
+			return err
+		}
+
+		var wasActive bool
+		err = tx.QueryRow(ctx, `
+			SELECT `+enrollmentActiveSQL+` FROM course_students cs
+			WHERE cs.id = $1 FOR UPDATE
+		`, enrollmentID).Scan(&wasActive)
+		if err == pgx.ErrNoRows {
+			return ErrEnrollmentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if !wasActive && (expiry == nil || expiry.After(clock.Now())) {
+			var waiting int
+			err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM course_waitlist WHERE course_id = $1`, courseID).Scan(&waiting)
+			if err != nil {
+				return err
+			}
+			if !hasFreePlace(capacity, active, waiting) {
+				return ErrCourseFull
+			}
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE course_students SET expiry_date = $1, `+enrollmentRenewedSQL+` WHERE id = $2`, expiry, enrollmentID)
+		return err
+	})
+	return courseID, err
+}
+
+// UnenrollStudent removes an enrollment and returns its course
+func UnenrollStudent(ctx context.Context, enrollmentID int) (int, error) {
+	var courseID int
+	err := GetPool().QueryRow(ctx, `DELETE FROM course_students WHERE id = $1 RETURNING course_id`, enrollmentID).Scan(&courseID)
+	if err == pgx.ErrNoRows {
+		return 0, ErrEnrollmentNotFound
+	}
+	return courseID, err
+}
+
+// SetCourseCapacity sets the maximum number of unexpired enrollments of a
+// course, nil for no limit. Existing enrollments above a lowered capacity
+// are kept.
+func SetCourseCapacity(ctx context.Context, courseID int, capacity *int) error {
+	tag, err := GetPool().Exec(ctx, `UPDATE courses SET max_students = $1 WHERE id = $2`, capacity, courseID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCourseNotFound
+	}
+	return nil
+}
+
+// CourseCapacity is the enrollment capacity of a course and its use
+type CourseCapacity struct {
+	MaxStudents *int // nil for no limit
+	Active      int  // Unexpired enrollments
+	Waitlisted  int
+}
+
+// GetCourseCapacity returns the capacity of a course and how much is used
+func GetCourseCapacity(ctx context.Context, courseID int) (*CourseCapacity, error) {
+	var cc CourseCapacity
+	err := GetPool().QueryRow(ctx, `
+		SELECT c.max_students,
+		       (SELECT COUNT(*) FROM course_students cs WHERE cs.course_id = c.id AND `+enrollmentActiveSQL+`),
+		       (SELECT COUNT(*) FROM course_waitlist w WHERE w.course_id = c.id)
+		FROM courses c WHERE c.id = $1
+	`, courseID).Scan(&cc.MaxStudents, &cc.Active, &cc.Waitlisted)
+	if err == pgx.ErrNoRows {
+		return nil, ErrCourseNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cc, nil
+}
+
+// WaitlistEntry is a student waiting for a place in a course
+type WaitlistEntry struct {
+	ID               int
+	CourseID         int
+	UserID           int
+	Position         int // Place on the waitlist, from 1
+	UserName         string
+	Email            string
+	EnrollmentNumber *string
+	ExpiryDate       *time.Time // Expiry of the enrollment once promoted
+	AddedBy          *int
+	CreatedAt        time.Time
+}
+
+// GetCourseWaitlist returns the waitlist of a course in promotion order
+func GetCourseWaitlist(ctx context.Context, courseID int) ([]WaitlistEntry, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT w.id, w.course_id, w.user_id, ROW_NUMBER() OVER (ORDER BY w.position, w.id),
+		       COALESCE(NULLIF(u.name, ''), u.username), COALESCE(u.email, ''), u.enrollment_number,
+		       w.expiry_date, w.added_by, w.created_at
+		FROM course_waitlist w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.course_id = $1
+		ORDER BY w.position, w.id
+	`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []WaitlistEntry{}
+	for rows.Next() {
+		var e WaitlistEntry
+		err := rows.Scan(&e.ID, &e.CourseID, &e.UserID, &e.Position,
+			&e.UserName, &e.Email, &e.EnrollmentNumber,
+			&e.ExpiryDate, &e.AddedBy, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// ReorderWaitlist sets the promotion order of a course's waitlist to the
+// order of entryIDs, which must list every entry
+func ReorderWaitlist(ctx context.Context, courseID int, entryIDs []int) error {
+	return WithTransaction(ctx, func(tx pgx.Tx) error {
+		if _, _, err := lockCourseCapacity(ctx, tx, courseID); err != nil {
+			return err
+		}
+
+		var total int
+		if err := tx.QueryRow(ctx, `SELECT COUNT(*) FROM course_waitlist WHERE course_id = $1`, courseID).Scan(&total); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, `
+			UPDATE course_waitlist w SET position = o.position
+			FROM UNNEST($2::int[]) WITH ORDINALITY AS o(id, position)
+			WHERE w.id = o.id AND w.course_id = $1
+		`, courseID, entryIDs)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(total) || total != len(entryIDs) {
+			return ErrWaitlistIncomplete
+		}
+		return nil
+	})
+}
+
+// RemoveFromWaitlist removes a student from a course's waitlist
+func RemoveFromWaitlist(ctx context.Context, entryID int) error {
+	tag, err := GetPool().Exec(ctx, `DELETE FROM course_waitlist WHERE id = $1`, entryID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWaitlistEntryNotFound
+	}
+	return nil
+}
+
+// Promotion is a waitlisted student enrolled once a place became free
+type Promotion struct {
+	EnrollmentID int
+	CourseID     int
+	CourseTitle  string // As students see it, respecting name and code visibility
+	UserID       int
+	UserName     string
+	Email        string
+	ExpiryDate   *time.Time
+}
+
+// GetWaitlistedCourses returns the courses that have students waiting
+func GetWaitlistedCourses(ctx context.Context) ([]int, error) {
+	rows, err := GetPool().Query(ctx, `SELECT DISTINCT course_id FROM course_waitlist ORDER BY course_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courseIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		courseIDs = append(courseIDs, id)
+	}
+	return courseIDs, rows.Err()
+}
+
+// PromoteWaitlist enrolls waitlisted students into the free places of a
+// course in waitlist order. Students whose requested expiry has passed while
+// waiting are dropped from the waitlist. Ended courses promote no one.
+func PromoteWaitlist(ctx context.Context, courseID int) ([]Promotion, error) {
+	var promotions []Promotion
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		capacity, active, err := lockCourseCapacity(ctx, tx, courseID)
+		if err != nil {
+			return err
+		}
+
+		var title string
+		var ended bool
+		err = tx.QueryRow(ctx, `
+			SELECT `+courseTitleSQL+`, `+courseEndedSQL+`
+			FROM courses c WHERE c.id = $1
+		`, courseID).Scan(&title, &ended)
+		if err != nil {
+			return err
+		}
+		if ended {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			DELETE FROM course_waitlist
+			WHERE course_id = $1 AND expiry_date IS NOT NULL AND expiry_date <= NOW()
+		`, courseID)
+		if err != nil {
+			return err
+		}
+
+		var limit *int
+		if capacity != nil {
+			free := *capacity - active
+			if free <= 0 {
+				return nil
+			}
+			limit = &free
+		}
+
+		rows, err := tx.Query(ctx, `
+			SELECT w.id, w.user_id, COALESCE(NULLIF(u.name, ''), u.username), COALESCE(u.email, ''), w.expiry_date
+			FROM course_waitlist w
+			JOIN users u ON u.id = w.user_id
+			WHERE w.course_id = $1
+			ORDER BY w.position, w.id
+			LIMIT $2
+		`, courseID, limit)
+		if err != nil {
+			return err
+		}
+		var entryIDs []int
+		var waiting []Promotion
+		for rows.Next() {
+			var entryID int
+			p := Promotion{CourseID: courseID, CourseTitle: title}
+			if err := rows.Scan(&entryID, &p.UserID, &p.UserName, &p.Email, &p.ExpiryDate); err != nil {
+				rows.Close()
+				return err
+			}
+			entryIDs = append(entryIDs, entryID)
+			waiting = append(waiting, p)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for i, p := range waiting {
+			// Renew an expired enrollment of the student, never an active one
+			err := tx.QueryRow(ctx, `
+				INSERT INTO course_students (course_id, user_id, expiry_date)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (course_id, user_id) DO UPDATE SET expiry_date = EXCLUDED.expiry_date, `+enrollmentRenewedSQL+`
+				WHERE NOT (course_students.expiry_date IS NULL
+				           OR course_students.expiry_date > NOW())
+				RETURNING id
+			`, courseID, p.UserID, p.ExpiryDate).Scan(&p.EnrollmentID)
+			if err != nil && err != pgx.ErrNoRows {
+				return err
+			}
+			if _, err := tx.Exec(ctx, `DELETE FROM course_waitlist WHERE id = $1`, entryIDs[i]); err != nil {
+				return err
+			}
+			if p.EnrollmentID != 0 {
+				promotions = append(promotions, p)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// errDryRun rolls back the transaction of a dry run once its report is built
+var errDryRun = errors.New("dry run")
+
+// Outcomes of a row of a bulk enrollment
+const (
+	BulkEnrolled          = EnrollmentEnrolled
+	BulkWaitlisted        = EnrollmentWaitlisted
+	BulkAlreadyEnrolled   = "already_enrolled"
+	BulkAlreadyWaitlisted = "already_waitlisted"
+	BulkDuplicate         = "duplicate"  // The student appears on an earlier row
+	BulkNotFound          = "not_found"  // No user has the enrollment number or id
+	BulkAmbiguous         = "ambiguous"  // Several users share the enrollment number
+	BulkIneligible        = "ineligible" // The user is an admin or driver
+)
+
+// ineligibleRolesSQL are the roles of users that are never enrolled in courses
+const ineligibleRolesSQL = `('admin', 'superadmin', 'driver')`
+
+// CohortFilter selects students by profile. Empty fields match everyone.
+type CohortFilter struct {
+	Programme string
+	Course    string
+	Year      string
+	Hostel    string
+	Search    string // Name, email or enrollment number contains
+}
+
+// IsEmpty reports whether the filter would select every student
+func (f CohortFilter) IsEmpty() bool {
+	return strings.TrimSpace(f.Programme) == "" && strings.TrimSpace(f.Course) == "" &&
+		strings.TrimSpace(f.Year) == "" && strings.TrimSpace(f.Hostel) == "" &&
+		strings.TrimSpace(f.Search) == ""
+}
+
+// BulkEnrollTarget is a row of a bulk enrollment, naming a student by user
+// id or by enrollment number
+type BulkEnrollTarget struct {
+	Row              int    // Position in the request, such as the CSV line
+	UserID           int    // Set when the student is named by id
+	EnrollmentNumber string // Set when the student is named by enrollment number
+}
+
+// BulkEnrollRow is the outcome of a row of a bulk enrollment
+type BulkEnrollRow struct {
+	BulkEnrollTarget
+	UserName     string
+	Status       string
+	EnrollmentID int // Set when enrolled
+	WaitlistID   int // Set when waitlisted
+	Position     int // Place on the waitlist, from 1
+}
+
+// BulkEnrollReport is the outcome of a bulk enrollment
+type BulkEnrollReport struct {
+	DryRun bool
+	Rows   []BulkEnrollRow
+	Counts map[string]int // Rows by status
+}
+
+// FindCohort returns the active students matching a filter, by name, as
+// bulk enrollment targets
+func FindCohort(ctx context.Context, f CohortFilter) ([]BulkEnrollTarget, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT u.id FROM users u
+		WHERE LOWER(u.role) NOT IN `+ineligibleRolesSQL+`
+		  AND COALESCE(u.status, 'active') = 'active'
+		  AND ($1 = '' OR LOWER(TRIM(u.programme)) = LOWER($1))
+		  AND ($2 = '' OR LOWER(TRIM(u.course)) = LOWER($2))
+		  AND ($3 = '' OR LOWER(TRIM(u.year)) = LOWER($3))
+		  AND ($4 = '' OR LOWER(TRIM(u.hostel)) = LOWER($4))
+		  AND ($5 = '' OR LOWER(u.name) LIKE LOWER('%' || $5 || '%') OR LOWER(u.email) LIKE LOWER('%' || $5 || '%')
+		       OR LOWER(u.enrollment_number) LIKE LOWER('%' || $5 || '%'))
+		ORDER BY u.name, u.id
+	`, strings.TrimSpace(f.Programme), strings.TrimSpace(f.Course), strings.TrimSpace(f.Year),
+		strings.TrimSpace(f.Hostel), strings.TrimSpace(f.Search))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := []BulkEnrollTarget{}
+	for rows.Next() {
+		t := BulkEnrollTarget{Row: len(targets) + 1}
+		if err := rows.Scan(&t.UserID); err != nil {
+			return nil, err
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
+
+// bulkUser is a user a bulk enrollment row resolved to
+type bulkUser struct {
+	ID       int
+	Name     string
+	Eligible bool
+}
+
+// resolveBulkTargets looks up the users named by bulk enrollment rows, by
+// id and by lowercased enrollment number
+func resolveBulkTargets(ctx context.Context, tx pgx.Tx, targets []BulkEnrollTarget) (map[int]bulkUser, map[string][]bulkUser, error) {
+	var ids []int
+	var numbers []string
+	for _, t := range targets {
+		if t.EnrollmentNumber != "" {
+			numbers = append(numbers, strings.ToLower(t.EnrollmentNumber))
+		} else {
+			ids = append(ids, t.UserID)
+		}
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT u.id, COALESCE(NULLIF(u.name, ''), u.username), LOWER(COALESCE(u.enrollment_number, '')),
+		       LOWER(u.role) NOT IN `+ineligibleRolesSQL+`
+		FROM users u
+		WHERE u.id = ANY($1) OR LOWER(u.enrollment_number) = ANY($2)
+	`, ids, numbers)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	byID := make(map[int]bulkUser)
+	byNumber := make(map[string][]bulkUser)
+	for rows.Next() {
+		var u bulkUser
+		var number string
+		if err := rows.Scan(&u.ID, &u.Name, &number, &u.Eligible); err != nil {
+			return nil, nil, err
+		}
+		if wanted[u.ID] {
+			byID[u.ID] = u
+		}
+		if number != "" {
+			byNumber[number] = append(byNumber[number], u)
+		}
+	}
+	return byID, byNumber, rows.Err()
+}
+
+// BulkEnroll enrolls the students named by targets in a course with one
+// shared expiry, in a single transaction, waitlisting those who do not fit.
+// Each row is reported rather than failing the whole operation; only
+// database errors roll everything back. A dry run reports what would happen
+// without changing anything.
+func BulkEnroll(ctx context.Context, courseID int, targets []BulkEnrollTarget, expiry *time.Time, addedBy *int, dryRun bool) (*BulkEnrollReport, error) {
+	report := &BulkEnrollReport{DryRun: dryRun}
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		report.Rows = make([]BulkEnrollRow, 0, len(targets))
+		report.Counts = make(map[string]int)
+
+		if _, _, err := lockCourseCapacity(ctx, tx, courseID); err != nil {
+			return err
+		}
+		byID, byNumber, err := resolveBulkTargets(ctx, tx, targets)
+		if err != nil {
+			return err
+		}
+
+		seen := make(map[int]bool, len(targets))
+		for _, t := range targets {
+			row := BulkEnrollRow{BulkEnrollTarget: t}
+			var user bulkUser
+			var found bool
+			if t.EnrollmentNumber != "" {
+				matches := byNumber[strings.ToLower(t.EnrollmentNumber)]
+				switch len(matches) {
+				case 0:
+					row.Status = BulkNotFound
+				case 1:
+					user, found = matches[0], true
+				default:
+					row.Status = BulkAmbiguous
+				}
+			} else if user, found = byID[t.UserID]; !found {
+				row.Status = BulkNotFound
+			}
+
+			if found {
+				row.UserID = user.ID
+				row.UserName = user.Name
+				switch {
+				case !user.Eligible:
+					row.Status = BulkIneligible
+				case seen[user.ID]:
+					row.Status = BulkDuplicate
+				default:
+					seen[user.ID] = true
+					result, err := enrollStudent(ctx, tx, courseID, user.ID, expiry, addedBy)
+					switch err {
+					case nil:
+						row.Status = result.Status
+						row.EnrollmentID = result.EnrollmentID
+						row.WaitlistID = result.WaitlistID
+						row.Position = result.Position
+					case ErrAlreadyEnrolled:
+						row.Status = BulkAlreadyEnrolled
+					case ErrAlreadyWaitlisted:
+						row.Status = BulkAlreadyWaitlisted
+					default:
+						return err
+					}
+				}
+			}
+
+			report.Counts[row.Status]++
+			report.Rows = append(report.Rows, row)
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		return nil, err
+	}
+	return report, nil
+}
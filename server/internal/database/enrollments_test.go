@@ -0,0 +1,29 @@
+package database
+
+import "testing"
+
+func TestHasFreePlace(t *testing.T) {
+	capacity := func(n int) *int { return &n }
+
+	tests := []struct {
+		name     string
+		capacity *int
+		active   int
+		waiting  int
+		want     bool
+	}{
+		{"no limit", nil, 100, 10, true},
+		{"free place", capacity(5), 4, 0, true},
+		{"full", capacity(5), 5, 0, false},
+		{"free place claimed by waitlist", capacity(5), 4, 1, false},
+		{"more places than waiting students", capacity(5), 2, 2, true},
+		{"over capacity after lowering", capacity(3), 5, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasFreePlace(tt.capacity, tt.active, tt.waiting); got != tt.want {
+				t.Errorf("hasFreePlace() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
+)
+
+// Incident kinds
+const (
+	IncidentSOS    = "sos"
+	IncidentReport = "incident"
+)
+
+// Incident statuses
+const (
+	IncidentOpen         = "open"
+	IncidentAcknowledged = "acknowledged"
+	IncidentResolved     = "resolved"
+	IncidentClosed       = "closed"
+)
+
+// ValidIncidentSeverities lists incident severities, least severe first
+var ValidIncidentSeverities = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// incidentTransitions lists the statuses an incident can move to from each
+// status. Resolved incidents can be reopened; closed incidents are final.
+var incidentTransitions = map[string][]string{
+	IncidentOpen:         {IncidentAcknowledged, IncidentResolved},
+	IncidentAcknowledged: {IncidentResolved},
+	IncidentResolved:     {IncidentClosed, IncidentOpen},
+	IncidentClosed:       {},
+}
+
+// A ride counts as active for SOS alerts from activeRideBefore ahead of its
+// ride time until activeRideAfter after it
+const (
+	activeRideBefore = time.Hour
+	activeRideAfter  = 6 * time.Hour
+)
+
+var (
+	ErrIncidentNotFound          = errors.New("incident not found")
+	ErrRideNotActive             = errors.New("ride is not in progress")
+	ErrInvalidIncidentTransition = errors.New("invalid incident status change")
+	ErrResolutionNotesRequired   = errors.New("resolutionNotes are required to resolve an incident")
+	ErrUserNotAdmin              = errors.New("user is not an admin")
+)
+
+// IncidentLocation is where and when an incident happened, as reported by the device
+type IncidentLocation struct {
+	Latitude   *float64   `json:"latitude"`
+	Longitude  *float64   `json:"longitude"`
+	Accuracy   *float64   `json:"accuracy"` // Metres
+	Text       *string    `json:"text"`
+	OccurredAt *time.Time `json:"occurredAt"`
+}
+
+// Incident is an SOS alert or incident report, with the ride it happened on
+type Incident struct {
+	ID                  int              `json:"id"`
+	Kind                string           `json:"kind"`
+	RideBillID          *int             `json:"rideBillId"`
+	ReportedBy          *int             `json:"reportedBy"`
+	ReporterName        *string          `json:"reporterName"`
+	ReporterPhone       *string          `json:"reporterPhone"`
+	DriverID            *int             `json:"driverId"`
+	DriverName          *string          `json:"driverName"`
+	VehicleID           *int             `json:"vehicleId"`
+	VehicleRegistration *string          `json:"vehicleRegistration"`
+	FromLocation        *string          `json:"fromLocation"`
+	ToLocation          *string          `json:"toLocation"`
+	RideAt              *time.Time       `json:"rideAt"`
+	Severity            string           `json:"severity"`
+	Status              string           `json:"status"`
+	Description         *string          `json:"description"`
+	Location            IncidentLocation `json:"location"`
+	AcknowledgedBy      *int             `json:"acknowledgedBy"`
+	AcknowledgedAt      *time.Time       `json:"acknowledgedAt"`
+	ResolvedBy          *int             `json:"resolvedBy"`
+	ResolvedAt          *time.Time       `json:"resolvedAt"`
+	ResolutionNotes     *string          `json:"resolutionNotes"`
+	CreatedAt           time.Time        `json:"createdAt"`
+	UpdatedAt           time.Time        `json:"updatedAt"`
+}
+
+// IncidentUpdate is an entry in an incident's timeline
+type IncidentUpdate struct {
+	ID         int       `json:"id"`
+	UserID     *int      `json:"userId"`
+	UserName   *string   `json:"userName"`
+	FromStatus *string   `json:"fromStatus"`
+	ToStatus   *string   `json:"toStatus"`
+	Note       *string   `json:"note"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// IncidentFilter narrows an incident listing. Empty fields match everything.
+type IncidentFilter struct {
+	Status     string
+	Severity   string
+	Kind       string
+	ReportedBy *int
+}
+
+// IncidentChange is an admin update to an incident
+type IncidentChange struct {
+	Status          *string
+	Severity        *string
+	Note            *string
+	ResolutionNotes *string
+}
+
+// Recipient is an admin notified by email about incidents and other events
+type Recipient struct {
+	UserID int
+	Name   string
+	Email  string
+}
+
+// ValidIncidentTransition reports whether an incident can move between statuses
+func ValidIncidentTransition(from, to string) bool {
+	for _, next := range incidentTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// RideActive reports whether a ride is in progress for SOS purposes
+func RideActive(status string, rideAt, now time.Time) bool {
+	if status == "cancelled" || status == "refunded" {
+		return false
+	}
+	return !now.Before(rideAt.Add(-activeRideBefore)) && !now.After(rideAt.Add(activeRideAfter))
+}
+
+const incidentColumns = `i.id, i.kind, i.ride_bill_id, i.reported_by, COALESCE(r.name, r.username), r.phone,
+	i.driver_id, COALESCE(d.name, d.username, rb.driver), i.vehicle_id, v.registration_number,
+	rb.from_location, rb.to_location, COALESCE(rb.scheduled_for, rb.created_at),
+	i.severity, i.status, i.description,
+	i.latitude, i.longitude, i.location_accuracy, i.location_text, i.occurred_at,
+	i.acknowledged_by, i.acknowledged_at, i.resolved_by, i.resolved_at, i.resolution_notes,
+	i.created_at, i.updated_at`
+
+const incidentFrom = `incidents i
+	LEFT JOIN users r ON r.id = i.reported_by
+	LEFT JOIN users d ON d.id = i.driver_id
+	LEFT JOIN vehicles v ON v.id = i.vehicle_id
+	LEFT JOIN ride_bills rb ON rb.id = i.ride_bill_id`
+
+// scanIncident scans a row selected with incidentColumns
+func scanIncident(row pgx.Row) (*Incident, error) {
+	var i Incident
+	err := row.Scan(
+		&i.ID, &i.Kind, &i.RideBillID, &i.ReportedBy, &i.ReporterName, &i.ReporterPhone,
+		&i.DriverID, &i.DriverName, &i.VehicleID, &i.VehicleRegistration,
+		&i.FromLocation, &i.ToLocation, &i.RideAt,
+		&i.Severity, &i.Status, &i.Description,
+		&i.Location.Latitude, &i.Location.Longitude, &i.Location.Accuracy, &i.Location.Text, &i.Location.OccurredAt,
+		&i.AcknowledgedBy, &i.AcknowledgedAt, &i.ResolvedBy, &i.ResolvedAt, &i.ResolutionNotes,
+		&i.CreatedAt, &i.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &i, nil
+}
+
+// GetIncident returns an incident by ID
+func GetIncident(ctx context.Context, id int) (*Incident, error) {
+	incident, err := scanIncident(GetPool().QueryRow(ctx, `SELECT `+incidentColumns+` FROM `+incidentFrom+` WHERE i.id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrIncidentNotFound
+	}
+	return incident, err
+}
+
+// GetIncidents returns incidents matching a filter. Open incidents come
+// first, most severe first, then newest first.
+func GetIncidents(ctx context.Context, f IncidentFilter) ([]Incident, error) {
+	query := `SELECT ` + incidentColumns + ` FROM ` + incidentFrom + ` WHERE 1=1`
+	var args []interface{}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		query += ` AND ` + clause + ` $` + strconv.Itoa(len(args))
+	}
+	if f.Status != "" {
+		add(`i.status =`, f.Status)
+	}
+	if f.Severity != "" {
+		add(`i.severity =`, f.Severity)
+	}
+	if f.Kind != "" {
+		add(`i.kind =`, f.Kind)
+	}
+	if f.ReportedBy != nil {
+		add(`i.reported_by =`, *f.ReportedBy)
+	}
+	query += `
+		ORDER BY i.status IN ('resolved', 'closed'),
+		         CASE i.severity WHEN 'critical' THEN 4 WHEN 'high' THEN 3 WHEN 'medium' THEN 2 ELSE 1 END DESC,
+		         i.created_at DESC, i.id DESC
+		LIMIT 500`
+
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	incidents := []Incident{}
+	for rows.Next() {
+		incident, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		incidents = append(incidents, *incident)
+	}
+	return incidents, rows.Err()
+}
+
+// GetIncidentUpdates returns an incident's timeline, oldest first
+func GetIncidentUpdates(ctx context.Context, incidentID int) ([]IncidentUpdate, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT iu.id, iu.user_id, COALESCE(u.name, u.username), iu.from_status, iu.to_status, iu.note, iu.created_at
+		FROM incident_updates iu
+		LEFT JOIN users u ON u.id = iu.user_id
+		WHERE iu.incident_id = $1
+		ORDER BY iu.created_at, iu.id
+	`, incidentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	updates := []IncidentUpdate{}
+	for rows.Next() {
+		var u IncidentUpdate
+		if err := rows.Scan(&u.ID, &u.UserID, &u.UserName, &u.FromStatus, &u.ToStatus, &u.Note, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		updates = append(updates, u)
+	}
+	return updates, rows.Err()
+}
+
+// rideParticipants returns a ride bill's state and the people on it
+func rideParticipants(ctx context.Context, tx pgx.Tx, billID int) (userID int, driverID, vehicleID *int, status string, rideAt time.Time, err error) {
+	err = tx.QueryRow(ctx, `
+		SELECT user_id, driver_id, vehicle_id, status, COALESCE(scheduled_for, created_at)
+		FROM ride_bills WHERE id = $1
+	`, billID).Scan(&userID, &driverID, &vehicleID, &status, &rideAt)
+	if err == pgx.ErrNoRows {
+		err = ErrBillNotFound
+	}
+	return
+}
+
+// CreateIncident records an incident. When a ride bill is given, the
+// reporter must be its student or driver; SOS alerts additionally require
+// the ride to be in progress and are always critical.
+func CreateIncident(ctx context.Context, in Incident) (*Incident, error) {
+	var id int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		if in.RideBillID != nil {
+			userID, driverID, vehicleID, status, rideAt, err := rideParticipants(ctx, tx, *in.RideBillID)
+			if err != nil {
+				return err
+			}
+			reporter := *in.ReportedBy
+			if userID != reporter && (driverID == nil || *driverID != reporter) {
+				return ErrNotYourRide
+			}
+			if in.Kind == IncidentSOS && !RideActive(status, rideAt, clock.Now()) {
+				return ErrRideNotActive
+			}
+			in.DriverID, in.VehicleID = driverID, vehicleID
+		}
+		if in.Kind == IncidentSOS {
+			in.Severity = "critical"
+		}
+
+		err := tx.QueryRow(ctx, `
+			INSERT INTO incidents (kind, ride_bill_id, reported_by, driver_id, vehicle_id, severity, description,
+			                       latitude, longitude, location_accuracy, location_text, occurred_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, COALESCE($12, NOW()))
+			RETURNING id
+		`, in.Kind, in.RideBillID, in.ReportedBy, in.DriverID, in.VehicleID, in.Severity, in.Description,
+			in.Location.Latitude, in.Location.Longitude, in.Location.Accuracy, in.Location.Text, in.Location.OccurredAt,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		note := "Incident reported"
+		if in.Kind == IncidentSOS {
+			note = "SOS raised"
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO incident_updates (incident_id, user_id, to_status, note)
+			VALUES ($1, $2, $3, $4)
+		`, id, in.ReportedBy, IncidentOpen, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetIncident(ctx, id)
+}
+
+// UpdateIncident applies an admin's change to an incident and records it in
+// the timeline
+func UpdateIncident(ctx context.Context, id, actorID int, change IncidentChange) (*Incident, error) {
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var status string
+		var resolutionNotes *string
+		err := tx.QueryRow(ctx, `SELECT status, resolution_notes FROM incidents WHERE id = $1 FOR UPDATE`, id).
+			Scan(&status, &resolutionNotes)
+		if err == pgx.ErrNoRows {
+			return ErrIncidentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var fromStatus, toStatus *string
+		if change.Status != nil && *change.Status != status {
+			if !ValidIncidentTransition(status, *change.Status) {
+				return ErrInvalidIncidentTransition
+			}
+			if *change.Status == IncidentResolved && change.ResolutionNotes == nil && resolutionNotes == nil {
+				return ErrResolutionNotesRequired
+			}
+			fromStatus, toStatus = &status, change.Status
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE incidents SET
+				severity = COALESCE($1, severity),
+				resolution_notes = COALESCE($2, resolution_notes),
+				status = COALESCE($3, status),
+				acknowledged_by = CASE WHEN $3 = 'acknowledged' THEN $4 ELSE acknowledged_by END,
+				acknowledged_at = CASE WHEN $3 = 'acknowledged' THEN NOW() ELSE acknowledged_at END,
+				resolved_by = CASE WHEN $3 = 'resolved' THEN $4 WHEN $3 = 'open' THEN NULL ELSE resolved_by END,
+				resolved_at = CASE WHEN $3 = 'resolved' THEN NOW() WHEN $3 = 'open' THEN NULL ELSE resolved_at END
+			WHERE id = $5
+		`, change.Severity, change.ResolutionNotes, toStatus, actorID, id)
+		if err != nil {
+			return err
+		}
+
+		note := change.Note
+		if note == nil && toStatus != nil && *toStatus == IncidentResolved {
+			note = change.ResolutionNotes
+		}
+		if toStatus == nil && note == nil {
+			return nil
+		}
+		_, err = tx.Exec(ctx, `
+			INSERT INTO incident_updates (incident_id, user_id, from_status, to_status, note)
+			VALUES ($1, $2, $3, $4, $5)
+		`, id, actorID, fromStatus, toStatus, note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetIncident(ctx, id)
+}
+
+// GetIncidentRecipients returns the admins on call, or every active admin
+// when nobody is on call
+func GetIncidentRecipients(ctx context.Context) ([]Recipient, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT id, COALESCE(name, username), email
+		FROM users
+		WHERE LOWER(role) IN ('admin', 'superadmin')
+		  AND COALESCE(status, 'active') = 'active'
+		  AND email IS NOT NULL AND email <> ''
+		  AND (on_call OR NOT EXISTS (
+		      SELECT 1 FROM users oc
+		      WHERE oc.on_call AND LOWER(oc.role) IN ('admin', 'superadmin')
+		        AND COALESCE(oc.status, 'active') = 'active'
+		  ))
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []Recipient{}
+	for rows.Next() {
+		var r Recipient
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Email); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// GetAdminRecipients returns every active admin with an email address
+func GetAdminRecipients(ctx context.Context) ([]Recipient, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT id, COALESCE(name, username), email
+		FROM users
+		WHERE LOWER(role) IN ('admin', 'superadmin')
+		  AND COALESCE(status, 'active') = 'active'
+		  AND email IS NOT NULL AND email <> ''
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []Recipient{}
+	for rows.Next() {
+		var r Recipient
+		if err := rows.Scan(&r.UserID, &r.Name, &r.Email); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// SetAdminOnCall puts an admin on or off the incident on-call rota
+func SetAdminOnCall(ctx context.Context, userID int, onCall bool) error {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE users SET on_call = $1, updated_at = NOW()
+		WHERE id = $2 AND LOWER(role) IN ('admin', 'superadmin')
+	`, onCall, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotAdmin
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidIncidentTransition(t *testing.T) {
+	tests := []struct {
+		from, to string
+		expected bool
+	}{
+		{IncidentOpen, IncidentAcknowledged, true},
+		{IncidentOpen, IncidentResolved, true},
+		{IncidentOpen, IncidentClosed, false},
+		{IncidentAcknowledged, IncidentResolved, true},
+		{IncidentAcknowledged, IncidentOpen, false},
+		{IncidentResolved, IncidentClosed, true},
+		{IncidentResolved, IncidentOpen, true},
+		{IncidentClosed, IncidentOpen, false},
+		{"unknown", IncidentOpen, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+"->"+tt.to, func(t *testing.T) {
+			if got := ValidIncidentTransition(tt.from, tt.to); got != tt.expected {
+				t.Errorf("ValidIncidentTransition(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRideActive(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		status   string
+		rideAt   time.Time
+		expected bool
+	}{
+		{"ride starting soon", "pending", now.Add(30 * time.Minute), true},
+		{"ride under way", "paid", now.Add(-2 * time.Hour), true},
+		{"ride tomorrow", "pending", now.Add(24 * time.Hour), false},
+		{"ride long over", "paid", now.Add(-7 * time.Hour), false},
+		{"cancelled", "cancelled", now, false},
+		{"refunded", "refunded", now, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RideActive(tt.status, tt.rideAt, now); got != tt.expected {
+				t.Errorf("RideActive() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
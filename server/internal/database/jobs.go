@@ -0,0 +1,302 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Job run statuses
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// JobState is the shared schedule state of a background job
+type JobState struct {
+	Name           string
+	Schedule       string
+	NextRunAt      time.Time
+	Paused         bool
+	PausedBy       *int
+	PausedAt       *time.Time
+	LeaseOwner     *string
+	LeaseExpiresAt *time.Time
+	LastRunAt      *time.Time
+	LastStatus     *string
+}
+
+// Running reports whether an instance holds the job's lease
+func (s *JobState) Running(now time.Time) bool {
+	return s.LeaseOwner != nil && s.LeaseExpiresAt != nil && s.LeaseExpiresAt.After(now)
+}
+
+// JobRun is one attempt of a job run
+type JobRun struct {
+	ID           int
+	JobName      string
+	Trigger      string
+	Attempt      int
+	Status       string
+	Result       *string
+	ErrorMessage *string
+	Instance     string
+	TriggeredBy  *int
+	StartedAt    time.Time
+	FinishedAt   *time.Time
+}
+
+const jobStateColumns = `name, schedule, next_run_at, paused, paused_by, paused_at,
+	lease_owner, lease_expires_at, last_run_at, last_status`
+
+func scanJobState(row pgx.Row) (*JobState, error) {
+	var s JobState
+	err := row.Scan(&s.Name, &s.Schedule, &s.NextRunAt, &s.Paused, &s.PausedBy, &s.PausedAt,
+		&s.LeaseOwner, &s.LeaseExpiresAt, &s.LastRunAt, &s.LastStatus)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+const jobRunColumns = `id, job_name, trigger, attempt, status, result, error_message,
+	instance, triggered_by, started_at, finished_at`
+
+func scanJobRun(row pgx.Row) (*JobRun, error) {
+	var r JobRun
+	err := row.Scan(&r.ID, &r.JobName, &r.Trigger, &r.Attempt, &r.Status, &r.Result, &r.ErrorMessage,
+		&r.Instance, &r.TriggeredBy, &r.StartedAt, &r.FinishedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// EnsureJobState creates a job's state row. When the job's schedule changed
+// since the row was written, the next run is moved to nextRunAt.
+func EnsureJobState(ctx context.Context, name, schedule string, nextRunAt time.Time) error {
+	_, err := GetPool().Exec(ctx, `
+		INSERT INTO job_states (name, schedule, next_run_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE
+		SET schedule = EXCLUDED.schedule, next_run_at = EXCLUDED.next_run_at
+		WHERE job_states.schedule <> EXCLUDED.schedule
+	`, name, schedule, nextRunAt)
+	return err
+}
+
+// GetJobStates returns the state of every job, keyed by name
+func GetJobStates(ctx context.Context) (map[string]*JobState, error) {
+	rows, err := GetPool().Query(ctx, `SELECT `+jobStateColumns+` FROM job_states`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := map[string]*JobState{}
+	for rows.Next() {
+		s, err := scanJobState(rows)
+		if err != nil {
+			return nil, err
+		}
+		states[s.Name] = s
+	}
+	return states, rows.Err()
+}
+
+// GetJobState returns the state of a job
+func GetJobState(ctx context.Context, name string) (*JobState, error) {
+	s, err := scanJobState(GetPool().QueryRow(ctx, `SELECT `+jobStateColumns+` FROM job_states WHERE name = $1`, name))
+	if err == pgx.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	return s, err
+}
+
+// ClaimDueJob takes the lease of a job whose next run is due, unless it is
+// paused or another instance holds the lease, and moves its next run to
+// nextRunAt. Reports whether the lease was taken.
+func ClaimDueJob(ctx context.Context, name, owner string, lease time.Duration, nextRunAt time.Time) (bool, error) {
+	return claimJob(ctx, name, `
+		UPDATE job_states
+		SET lease_owner = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond', next_run_at = $4
+		WHERE name = $1 AND NOT paused AND next_run_at <= NOW()
+		  AND (lease_expires_at IS NULL OR lease_expires_at <= NOW())
+	`, name, owner, lease.Milliseconds(), nextRunAt)
+}
+
+// ClaimJob takes the lease of a job for a manual run, unless another
+// instance holds it. Paused jobs can still be run manually.
+func ClaimJob(ctx context.Context, name, owner string, lease time.Duration) (bool, error) {
+	return claimJob(ctx, name, `
+		UPDATE job_states
+		SET lease_owner = $2, lease_expires_at = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE name = $1 AND (lease_expires_at IS NULL OR lease_expires_at <= NOW())
+	`, name, owner, lease.Milliseconds())
+}
+
+// claimJob runs a query taking the lease of a job. Once the lease is taken
+// nothing else can be running the job, so runs still recorded as running were
+// left behind by an instance that stopped and are marked failed.
+func claimJob(ctx context.Context, name, query string, args ...any) (bool, error) {
+	claimed := false
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, query, args...)
+		if err != nil || tag.RowsAffected() != 1 {
+			return err
+		}
+		claimed = true
+		_, err = tx.Exec(ctx, `
+			UPDATE job_runs
+			SET status = 'failed', error_message = 'abandoned: the instance running it stopped', finished_at = NOW()
+			WHERE job_name = $1 AND status = 'running'
+		`, name)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	return claimed, nil
+}
+
+// RunJobSoon makes a job due now, so the next instance looking for due jobs
+// runs it. A job that is running is run again once it finishes.
+func RunJobSoon(ctx context.Context, name string) error {
+	_, err := GetPool().Exec(ctx, `
+		UPDATE job_states SET next_run_at = LEAST(next_run_at, NOW()) WHERE name = $1
+	`, name)
+	return err
+}
+
+// ReleaseJob gives up the lease of a job after a run and records its outcome
+func ReleaseJob(ctx context.Context, name, owner, status string) error {
+	_, err := GetPool().Exec(ctx, `
+		UPDATE job_states
+		SET lease_owner = NULL, lease_expires_at = NULL, last_run_at = NOW(), last_status = $3
+		WHERE name = $1 AND lease_owner = $2
+	`, name, owner, status)
+	return err
+}
+
+// SetJobPaused pauses or resumes the scheduled runs of a job
+func SetJobPaused(ctx context.Context, name string, paused bool, by int) (*JobState, error) {
+	s, err := scanJobState(GetPool().QueryRow(ctx, `
+		UPDATE job_states
+		SET paused = $2,
+		    paused_by = CASE WHEN $2 THEN $3::int END,
+		    paused_at = CASE WHEN $2 THEN NOW() END
+		WHERE name = $1
+		RETURNING `+jobStateColumns,
+		name, paused, by))
+	if err == pgx.ErrNoRows {
+		return nil, ErrJobNotFound
+	}
+	return s, err
+}
+
+// StartJobRun records the start of an attempt of a job run. The caller holds
+// the job's lease.
+func StartJobRun(ctx context.Context, name, trigger string, attempt int, instance string, triggeredBy *int) (int, error) {
+	var id int
+	err := GetPool().QueryRow(ctx, `
+		INSERT INTO job_runs (job_name, trigger, attempt, instance, triggered_by)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, name, trigger, attempt, instance, triggeredBy).Scan(&id)
+	return id, err
+}
+
+// FinishJobRun records the outcome of an attempt
+func FinishJobRun(ctx context.Context, runID int, result string, runErr error) error {
+	status := JobRunSucceeded
+	var errorMessage *string
+	if runErr != nil {
+		status = JobRunFailed
+		msg := runErr.Error()
+		errorMessage = &msg
+	}
+	var resultText *string
+	if result != "" {
+		resultText = &result
+	}
+	_, err := GetPool().Exec(ctx, `
+		UPDATE job_runs
+		SET status = $1, result = $2, error_message = $3, finished_at = NOW()
+		WHERE id = $4
+	`, status, resultText, errorMessage, runID)
+	return err
+}
+
+// GetJobRuns returns the most recent attempts of a job
+func GetJobRuns(ctx context.Context, name string, limit int) ([]JobRun, error) {
+	rows, err := GetPool().Query(ctx,
+		`SELECT `+jobRunColumns+` FROM job_runs WHERE job_name = $1 ORDER BY started_at DESC, id DESC LIMIT $2`,
+		name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		r, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *r)
+	}
+	return runs, rows.Err()
+}
+
+// deleteInBatches runs a DELETE limited to batchSize rows until it deletes
+// fewer, so purging millions of rows never holds long locks. The query
+// takes the cutoff as $1 and the batch size as $2.
+func deleteInBatches(ctx context.Context, query string, before time.Time, batchSize int) (int, error) {
+	total := 0
+	for {
+		tag, err := GetPool().Exec(ctx, query, before, batchSize)
+		if err != nil {
+			return total, err
+		}
+		n := int(tag.RowsAffected())
+		total += n
+		if n < batchSize {
+			return total, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+	}
+}
+
+// PurgeJobRuns deletes job run history started before a cutoff
+func PurgeJobRuns(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	return deleteInBatches(ctx, `
+		DELETE FROM job_runs
+		WHERE id IN (SELECT id FROM job_runs WHERE started_at < $1 AND status <> 'running' LIMIT $2)
+	`, before, batchSize)
+}
+
+// PurgeExpiredSessions deletes sessions that expired before a cutoff. Unlike
+// cleanup_expired_sessions() it works in batches and keeps recent sessions
+// for the login history.
+func PurgeExpiredSessions(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	return deleteInBatches(ctx, `
+		DELETE FROM sessions
+		WHERE id IN (SELECT id FROM sessions WHERE expires_at < $1 LIMIT $2)
+	`, before, batchSize)
+}
+
+// PurgeExpiredOTPs deletes OTP codes that expired before a cutoff, in
+// batches. Verified codes go too; nothing reads a code once it has expired.
+func PurgeExpiredOTPs(ctx context.Context, before time.Time, batchSize int) (int, error) {
+	return deleteInBatches(ctx, `
+		DELETE FROM otp_codes
+		WHERE id IN (SELECT id FROM otp_codes WHERE expires_at < $1 LIMIT $2)
+	`, before, batchSize)
+}
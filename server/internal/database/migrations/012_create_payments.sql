@@ -0,0 +1,30 @@
+-- Create payments ledger for ride bills
+-- Each row is either a payment received against a bill or a refund issued from it.
+-- A bill's balance and status are derived from its ledger entries.
+CREATE TABLE IF NOT EXISTS payments (
+    id SERIAL PRIMARY KEY,
+    ride_bill_id INTEGER NOT NULL REFERENCES ride_bills(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL DEFAULT 'payment' CHECK (kind IN ('payment', 'refund')),
+    method VARCHAR(30) NOT NULL CHECK (method IN ('cash', 'upi', 'card', 'bank_transfer', 'other')),
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    reference VARCHAR(255),
+    notes TEXT,
+    recorded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    paid_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create indexes for faster lookups
+CREATE INDEX IF NOT EXISTS idx_payments_ride_bill_id ON payments(ride_bill_id);
+CREATE INDEX IF NOT EXISTS idx_payments_paid_at ON payments(paid_at);
+CREATE INDEX IF NOT EXISTS idx_payments_kind ON payments(kind);
+CREATE INDEX IF NOT EXISTS idx_payments_recorded_by ON payments(recorded_by);
+
+-- Backfill ledger entries for bills that were marked paid before the ledger existed
+-- so that revenue totals stay consistent
+INSERT INTO payments (ride_bill_id, kind, method, amount, notes, paid_at)
+SELECT rb.id, 'payment', 'other', rb.fare, 'Backfilled from ride bill status', rb.updated_at
+FROM ride_bills rb
+WHERE rb.status = 'paid'
+  AND rb.fare > 0
+  AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.ride_bill_id = rb.id);
@@ -0,0 +1,66 @@
+-- Create payment_orders table for online payments through a payment gateway
+CREATE TABLE IF NOT EXISTS payment_orders (
+    id SERIAL PRIMARY KEY,
+    ride_bill_id INTEGER NOT NULL REFERENCES ride_bills(id) ON DELETE CASCADE,
+    provider VARCHAR(30) NOT NULL,
+    provider_order_id VARCHAR(100) NOT NULL,
+    amount DECIMAL(10, 2) NOT NULL CHECK (amount > 0),
+    currency VARCHAR(3) NOT NULL DEFAULT 'INR',
+    status VARCHAR(20) NOT NULL DEFAULT 'created' CHECK (status IN ('created', 'paid', 'failed')),
+    provider_payment_id VARCHAR(100),
+    payment_id INTEGER REFERENCES payments(id) ON DELETE SET NULL,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    paid_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, provider_order_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_orders_ride_bill_id ON payment_orders(ride_bill_id);
+CREATE INDEX IF NOT EXISTS idx_payment_orders_status ON payment_orders(status);
+
+-- Record every webhook delivery so retries are processed only once
+CREATE TABLE IF NOT EXISTS payment_webhook_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(30) NOT NULL,
+    event_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    provider_order_id VARCHAR(100),
+    payload JSONB,
+    outcome VARCHAR(30),
+    received_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(provider, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_webhook_events_order ON payment_webhook_events(provider_order_id);
+
+-- A gateway payment can only ever be recorded once in the ledger
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS provider VARCHAR(30);
+ALTER TABLE payments ADD COLUMN IF NOT EXISTS provider_payment_id VARCHAR(100);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_payments_provider_payment_id
+    ON payments(provider, provider_payment_id)
+    WHERE provider_payment_id IS NOT NULL;
+
+-- Ride bill statuses, including those derived from the payment ledger.
+-- Bills with an open online payment order are awaiting payment. This is the
+-- only migration that defines the constraint: every migration re-runs, and
+-- an earlier, narrower definition would reject bills already in a newer status.
+ALTER TABLE ride_bills DROP CONSTRAINT IF EXISTS ride_bills_status_check;
+ALTER TABLE ride_bills ADD CONSTRAINT ride_bills_status_check
+    CHECK (status IN ('pending', 'awaiting_payment', 'partially_paid', 'paid', 'refunded', 'cancelled'));
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_payment_orders_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_payment_orders_updated_at ON payment_orders;
+CREATE TRIGGER trigger_update_payment_orders_updated_at
+    BEFORE UPDATE ON payment_orders
+    FOR EACH ROW
+    EXECUTE FUNCTION update_payment_orders_updated_at();
@@ -0,0 +1,72 @@
+-- Create ride_statements table for monthly ride statements / invoices per student
+CREATE TABLE IF NOT EXISTS ride_statements (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    period_start DATE NOT NULL, -- First day of the statement month
+    invoice_number VARCHAR(50) NOT NULL UNIQUE,
+    opening_balance DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    total_charges DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    total_payments DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    total_refunds DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    closing_balance DECIMAL(10, 2) NOT NULL DEFAULT 0.00,
+    ride_count INTEGER NOT NULL DEFAULT 0,
+    file_name VARCHAR(255),
+    file_url TEXT,
+    emailed_at TIMESTAMP WITH TIME ZONE,
+    email_error TEXT,
+    generated_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, period_start)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ride_statements_user_id ON ride_statements(user_id);
+CREATE INDEX IF NOT EXISTS idx_ride_statements_period_start ON ride_statements(period_start);
+
+-- Gapless invoice numbering per year
+CREATE TABLE IF NOT EXISTS invoice_counters (
+    year INTEGER PRIMARY KEY,
+    last_number INTEGER NOT NULL DEFAULT 0
+);
+
+-- Track bulk statement generation runs
+CREATE TABLE IF NOT EXISTS ride_statement_runs (
+    id SERIAL PRIMARY KEY,
+    period_start DATE NOT NULL,
+    trigger VARCHAR(20) NOT NULL DEFAULT 'manual' CHECK (trigger IN ('manual', 'scheduled')),
+    send_email BOOLEAN NOT NULL DEFAULT true,
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'completed', 'failed')),
+    total_students INTEGER NOT NULL DEFAULT 0,
+    generated_count INTEGER NOT NULL DEFAULT 0,
+    emailed_count INTEGER NOT NULL DEFAULT 0,
+    failed_count INTEGER NOT NULL DEFAULT 0,
+    error_message TEXT,
+    started_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_ride_statement_runs_period_start ON ride_statement_runs(period_start);
+-- Only one scheduled run per month, even with several server instances
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ride_statement_runs_scheduled
+    ON ride_statement_runs(period_start)
+    WHERE trigger = 'scheduled';
+
+-- Statements look up each student's bills by creation time
+CREATE INDEX IF NOT EXISTS idx_ride_bills_user_id_created_at ON ride_bills(user_id, created_at);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_ride_statements_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_ride_statements_updated_at ON ride_statements;
+CREATE TRIGGER trigger_update_ride_statements_updated_at
+    BEFORE UPDATE ON ride_statements
+    FOR EACH ROW
+    EXECUTE FUNCTION update_ride_statements_updated_at();
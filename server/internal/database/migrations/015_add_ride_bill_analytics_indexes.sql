@@ -0,0 +1,7 @@
+-- Indexes for ride bill analytics
+-- Analytics scan bills by created_at range and sum each bill's ledger entries.
+-- Covering indexes let both lookups be served from the index alone.
+CREATE INDEX IF NOT EXISTS idx_ride_bills_created_at_covering
+    ON ride_bills(created_at) INCLUDE (status, fare, user_id);
+CREATE INDEX IF NOT EXISTS idx_payments_ride_bill_covering
+    ON payments(ride_bill_id) INCLUDE (kind, amount);
@@ -0,0 +1,64 @@
+-- Create recurring ride bookings
+-- A series describes a regular commute (route, weekdays, pickup time and date range).
+-- The scheduler materializes its occurrences as ride bills a few days ahead.
+CREATE TABLE IF NOT EXISTS ride_series (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ride_id INTEGER NOT NULL REFERENCES ride_locations(id) ON DELETE CASCADE,
+    days_of_week INTEGER[] NOT NULL, -- 0 = Sunday ... 6 = Saturday
+    ride_time TIME NOT NULL,
+    start_date DATE NOT NULL,
+    end_date DATE,
+    skip_holidays BOOLEAN NOT NULL DEFAULT true,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'cancelled')),
+    materialized_through DATE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_date IS NULL OR end_date >= start_date)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ride_series_user_id ON ride_series(user_id);
+CREATE INDEX IF NOT EXISTS idx_ride_series_status ON ride_series(status);
+
+-- Single occurrences a student has skipped
+CREATE TABLE IF NOT EXISTS ride_series_skips (
+    id SERIAL PRIMARY KEY,
+    series_id INTEGER NOT NULL REFERENCES ride_series(id) ON DELETE CASCADE,
+    ride_date DATE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(series_id, ride_date)
+);
+
+-- Institution holidays, skipped by series with skip_holidays set
+CREATE TABLE IF NOT EXISTS holidays (
+    id SERIAL PRIMARY KEY,
+    holiday_date DATE NOT NULL UNIQUE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Ride bills materialized from a series
+ALTER TABLE ride_bills
+ADD COLUMN IF NOT EXISTS series_id INTEGER REFERENCES ride_series(id) ON DELETE SET NULL,
+ADD COLUMN IF NOT EXISTS scheduled_for TIMESTAMP WITH TIME ZONE;
+
+-- One bill per series occurrence, so materialization can safely be repeated
+CREATE UNIQUE INDEX IF NOT EXISTS idx_ride_bills_series_scheduled_for
+    ON ride_bills(series_id, scheduled_for)
+    WHERE series_id IS NOT NULL;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_ride_series_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_ride_series_updated_at ON ride_series;
+CREATE TRIGGER trigger_update_ride_series_updated_at
+    BEFORE UPDATE ON ride_series
+    FOR EACH ROW
+    EXECUTE FUNCTION update_ride_series_updated_at();
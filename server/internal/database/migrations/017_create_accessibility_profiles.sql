@@ -0,0 +1,33 @@
+-- Create accessibility requirement profiles
+-- Needs and vehicle accessibility features share one vocabulary of tags
+-- (wheelchair_ramp, wheelchair_space, escort_seat, guide_dog_space, step_free_entry).
+CREATE TABLE IF NOT EXISTS accessibility_profiles (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    needs TEXT[] NOT NULL DEFAULT '{}',
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Needs of each ride (copied from the profile when booked) and the driver assigned to it
+ALTER TABLE ride_bills
+ADD COLUMN IF NOT EXISTS accessibility_needs TEXT[] NOT NULL DEFAULT '{}',
+ADD COLUMN IF NOT EXISTS driver_id INTEGER REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ride_bills_driver_id ON ride_bills(driver_id);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_accessibility_profiles_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_accessibility_profiles_updated_at ON accessibility_profiles;
+CREATE TRIGGER trigger_update_accessibility_profiles_updated_at
+    BEFORE UPDATE ON accessibility_profiles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_accessibility_profiles_updated_at();
@@ -0,0 +1,86 @@
+-- Create fleet vehicles
+-- Vehicles are managed separately from driver users; drivers are assigned to
+-- vehicles over time and several drivers can share a vehicle across shifts.
+CREATE TABLE IF NOT EXISTS vehicles (
+    id SERIAL PRIMARY KEY,
+    registration_number VARCHAR(50) NOT NULL UNIQUE,
+    vehicle_type VARCHAR(50),
+    capacity INTEGER NOT NULL DEFAULT 4 CHECK (capacity > 0),
+    accessibility_features TEXT[] NOT NULL DEFAULT '{}',
+    insurance_expiry DATE,
+    fitness_expiry DATE,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'maintenance', 'retired')),
+    notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_vehicles_status ON vehicles(status);
+
+-- Driver-vehicle assignments; an assignment with no end is current
+CREATE TABLE IF NOT EXISTS driver_vehicle_assignments (
+    id SERIAL PRIMARY KEY,
+    driver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    vehicle_id INTEGER NOT NULL REFERENCES vehicles(id) ON DELETE CASCADE,
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP WITH TIME ZONE,
+    assigned_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at IS NULL OR ends_at >= starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_vehicle_assignments_vehicle_id ON driver_vehicle_assignments(vehicle_id);
+-- A driver drives one vehicle at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_driver_vehicle_assignments_current
+    ON driver_vehicle_assignments(driver_id)
+    WHERE ends_at IS NULL;
+
+-- Ride bills record the vehicle that served them
+ALTER TABLE ride_bills
+ADD COLUMN IF NOT EXISTS vehicle_id INTEGER REFERENCES vehicles(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ride_bills_vehicle_id ON ride_bills(vehicle_id);
+
+-- Migrate vehicles from driver user rows (only into an empty fleet, so
+-- re-running migrations doesn't bring back vehicles or assignments removed since)
+INSERT INTO vehicles (registration_number, vehicle_type)
+SELECT DISTINCT ON (UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')))
+       UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')),
+       NULLIF(TRIM(vehicle_type), '')
+FROM users
+WHERE NULLIF(TRIM(vehicle_number), '') IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM vehicles)
+ORDER BY UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')), updated_at DESC
+ON CONFLICT (registration_number) DO NOTHING;
+
+INSERT INTO driver_vehicle_assignments (driver_id, vehicle_id, starts_at)
+SELECT u.id, v.id, COALESCE(u.updated_at, CURRENT_TIMESTAMP)
+FROM users u
+JOIN vehicles v ON v.registration_number = UPPER(REGEXP_REPLACE(u.vehicle_number, '\s+', '', 'g'))
+WHERE LOWER(u.role) = 'driver'
+  AND NOT EXISTS (SELECT 1 FROM driver_vehicle_assignments);
+
+-- Record the vehicle of rides already assigned to a driver
+UPDATE ride_bills rb
+SET vehicle_id = a.vehicle_id
+FROM driver_vehicle_assignments a
+WHERE a.driver_id = rb.driver_id
+  AND a.ends_at IS NULL
+  AND rb.created_at >= a.starts_at
+  AND rb.vehicle_id IS NULL;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_vehicles_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_vehicles_updated_at ON vehicles;
+CREATE TRIGGER trigger_update_vehicles_updated_at
+    BEFORE UPDATE ON vehicles
+    FOR EACH ROW
+    EXECUTE FUNCTION update_vehicles_updated_at();
@@ -0,0 +1,49 @@
+-- Driver availability, shifts and automatic ride dispatch
+-- Drivers toggle themselves on or off duty
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS on_duty BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN IF NOT EXISTS on_duty_since TIMESTAMP WITH TIME ZONE;
+
+-- Weekly shift schedule of each driver, in the institution timezone.
+-- A shift ending at or before its start time runs past midnight.
+CREATE TABLE IF NOT EXISTS driver_shifts (
+    id SERIAL PRIMARY KEY,
+    driver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    day_of_week INTEGER NOT NULL CHECK (day_of_week BETWEEN 0 AND 6),
+    start_time TIME NOT NULL,
+    end_time TIME NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_shifts_driver_id ON driver_shifts(driver_id);
+
+-- Dispatch state of each ride: unassigned rides are waiting for a driver,
+-- offered rides wait for the driver to accept
+ALTER TABLE ride_bills
+ADD COLUMN IF NOT EXISTS dispatch_status VARCHAR(20) NOT NULL DEFAULT 'unassigned'
+    CHECK (dispatch_status IN ('unassigned', 'offered', 'accepted')),
+ADD COLUMN IF NOT EXISTS offered_at TIMESTAMP WITH TIME ZONE,
+ADD COLUMN IF NOT EXISTS accepted_at TIMESTAMP WITH TIME ZONE;
+
+-- Rides that already have a driver were assigned by hand
+UPDATE ride_bills
+SET dispatch_status = 'accepted', accepted_at = COALESCE(accepted_at, updated_at)
+WHERE driver_id IS NOT NULL AND dispatch_status = 'unassigned';
+
+CREATE INDEX IF NOT EXISTS idx_ride_bills_dispatch_status
+    ON ride_bills(dispatch_status)
+    WHERE dispatch_status <> 'accepted';
+
+-- Every offer made to a driver and how it ended
+CREATE TABLE IF NOT EXISTS ride_dispatch_attempts (
+    id SERIAL PRIMARY KEY,
+    ride_bill_id INTEGER NOT NULL REFERENCES ride_bills(id) ON DELETE CASCADE,
+    driver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    offered_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    responded_at TIMESTAMP WITH TIME ZONE,
+    outcome VARCHAR(20) NOT NULL DEFAULT 'offered'
+        CHECK (outcome IN ('offered', 'accepted', 'declined', 'timed_out', 'overridden'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_ride_dispatch_attempts_ride_bill_id ON ride_dispatch_attempts(ride_bill_id);
+CREATE INDEX IF NOT EXISTS idx_ride_dispatch_attempts_driver_id ON ride_dispatch_attempts(driver_id);
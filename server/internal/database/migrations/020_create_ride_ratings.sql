@@ -0,0 +1,28 @@
+-- Post-ride ratings by students, one per ride bill
+CREATE TABLE IF NOT EXISTS ride_ratings (
+    id SERIAL PRIMARY KEY,
+    ride_bill_id INTEGER NOT NULL UNIQUE REFERENCES ride_bills(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    driver_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    rating INTEGER NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_ride_ratings_driver_id ON ride_ratings(driver_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_ride_ratings_created_at ON ride_ratings(created_at);
+
+-- Issues drivers flag with a passenger, one per ride bill
+CREATE TABLE IF NOT EXISTS passenger_reports (
+    id SERIAL PRIMARY KEY,
+    ride_bill_id INTEGER NOT NULL UNIQUE REFERENCES ride_bills(id) ON DELETE CASCADE,
+    driver_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    tags TEXT[] NOT NULL DEFAULT '{}',
+    comment TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_passenger_reports_user_id ON passenger_reports(user_id);
+CREATE INDEX IF NOT EXISTS idx_passenger_reports_created_at ON passenger_reports(created_at);
@@ -0,0 +1,64 @@
+-- Create incidents raised during rides
+-- SOS alerts are critical incidents tied to an active ride; other incidents
+-- can be reported with or without a ride.
+CREATE TABLE IF NOT EXISTS incidents (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(20) NOT NULL DEFAULT 'incident' CHECK (kind IN ('sos', 'incident')),
+    ride_bill_id INTEGER REFERENCES ride_bills(id) ON DELETE SET NULL,
+    reported_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    driver_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    vehicle_id INTEGER REFERENCES vehicles(id) ON DELETE SET NULL,
+    severity VARCHAR(20) NOT NULL DEFAULT 'medium' CHECK (severity IN ('low', 'medium', 'high', 'critical')),
+    status VARCHAR(20) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'acknowledged', 'resolved', 'closed')),
+    description TEXT,
+    latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90),
+    longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180),
+    location_accuracy DOUBLE PRECISION CHECK (location_accuracy >= 0),
+    location_text TEXT,
+    occurred_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    acknowledged_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    acknowledged_at TIMESTAMP WITH TIME ZONE,
+    resolved_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    resolved_at TIMESTAMP WITH TIME ZONE,
+    resolution_notes TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_incidents_status ON incidents(status, severity);
+CREATE INDEX IF NOT EXISTS idx_incidents_ride_bill_id ON incidents(ride_bill_id);
+CREATE INDEX IF NOT EXISTS idx_incidents_reported_by ON incidents(reported_by);
+CREATE INDEX IF NOT EXISTS idx_incidents_created_at ON incidents(created_at);
+
+-- Timeline of status changes and notes on each incident
+CREATE TABLE IF NOT EXISTS incident_updates (
+    id SERIAL PRIMARY KEY,
+    incident_id INTEGER NOT NULL REFERENCES incidents(id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    from_status VARCHAR(20),
+    to_status VARCHAR(20),
+    note TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_incident_updates_incident_id ON incident_updates(incident_id);
+
+-- Admins on call are alerted about new incidents
+ALTER TABLE users
+ADD COLUMN IF NOT EXISTS on_call BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_incidents_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_incidents_updated_at ON incidents;
+CREATE TRIGGER trigger_update_incidents_updated_at
+    BEFORE UPDATE ON incidents
+    FOR EACH ROW
+    EXECUTE FUNCTION update_incidents_updated_at();
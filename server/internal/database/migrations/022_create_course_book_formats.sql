@@ -0,0 +1,37 @@
+-- Accessible variants of course books (plain text, HTML and EPUB) generated
+-- from the uploaded PDF, one row per course and format
+CREATE TABLE IF NOT EXISTS course_book_formats (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    format VARCHAR(10) NOT NULL CHECK (format IN ('txt', 'html', 'epub')),
+    source TEXT NOT NULL, -- Book path or URL the variant is generated from
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'processing', 'ready', 'failed')),
+    file_name VARCHAR(255),
+    file_url TEXT,
+    file_size BIGINT,
+    error_message TEXT,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP WITH TIME ZONE,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(course_id, format)
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_book_formats_status ON course_book_formats(status, updated_at);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_course_book_formats_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_course_book_formats_updated_at ON course_book_formats;
+CREATE TRIGGER trigger_update_course_book_formats_updated_at
+    BEFORE UPDATE ON course_book_formats
+    FOR EACH ROW
+    EXECUTE FUNCTION update_course_book_formats_updated_at();
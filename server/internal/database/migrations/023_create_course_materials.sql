@@ -0,0 +1,51 @@
+-- Course materials: any number of files per course (chapters, supplementary
+-- notes, audio) shown to enrolled students in order, alongside the course book
+CREATE TABLE IF NOT EXISTS course_materials (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    kind VARCHAR(20) NOT NULL DEFAULT 'chapter' CHECK (kind IN ('chapter', 'notes', 'audio', 'other')),
+    position INTEGER NOT NULL DEFAULT 0,
+    visible_from TIMESTAMP WITH TIME ZONE, -- Hidden from students before this time
+    visible_until TIMESTAMP WITH TIME ZONE, -- Hidden from students from this time
+    current_version INTEGER NOT NULL DEFAULT 1,
+    created_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (visible_until IS NULL OR visible_from IS NULL OR visible_until > visible_from)
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_materials_course ON course_materials(course_id, position);
+
+-- Every uploaded file of a material; older versions are kept when a new one
+-- is uploaded and the material points at its current version
+CREATE TABLE IF NOT EXISTS course_material_versions (
+    id SERIAL PRIMARY KEY,
+    material_id INTEGER NOT NULL REFERENCES course_materials(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL CHECK (version > 0),
+    file_name VARCHAR(255) NOT NULL, -- Name of the uploaded file
+    file_url TEXT NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    file_size BIGINT NOT NULL,
+    notes TEXT,
+    uploaded_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(material_id, version)
+);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_course_materials_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_course_materials_updated_at ON course_materials;
+CREATE TRIGGER trigger_update_course_materials_updated_at
+    BEFORE UPDATE ON course_materials
+    FOR EACH ROW
+    EXECUTE FUNCTION update_course_materials_updated_at();
@@ -0,0 +1,32 @@
+-- Waitlist of students to enroll once a full course has a free place.
+-- Capacity is courses.max_students counting only unexpired enrollments; a
+-- course without max_students has no limit.
+CREATE TABLE IF NOT EXISTS course_waitlist (
+    id SERIAL PRIMARY KEY,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL, -- Students are promoted in ascending order
+    expiry_date TIMESTAMP WITH TIME ZONE, -- Expiry of the enrollment once promoted
+    added_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(course_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_waitlist_course ON course_waitlist(course_id, position);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_course_waitlist_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_course_waitlist_updated_at ON course_waitlist;
+CREATE TRIGGER trigger_update_course_waitlist_updated_at
+    BEFORE UPDATE ON course_waitlist
+    FOR EACH ROW
+    EXECUTE FUNCTION update_course_waitlist_updated_at();
@@ -0,0 +1,44 @@
+-- Enrollment expiry tracking and renewal reminders.
+-- Access is still decided by course_students.expiry_date; status and
+-- expired_at record when the expiry job processed the enrollment.
+ALTER TABLE course_students ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active';
+ALTER TABLE course_students ADD COLUMN IF NOT EXISTS expired_at TIMESTAMP WITH TIME ZONE;
+-- Smallest renewal window (days before expiry) already reminded for the
+-- current expiry date; cleared whenever the expiry date changes
+ALTER TABLE course_students ADD COLUMN IF NOT EXISTS renewal_reminded_days INTEGER;
+
+ALTER TABLE course_students DROP CONSTRAINT IF EXISTS course_students_status_check;
+ALTER TABLE course_students ADD CONSTRAINT course_students_status_check CHECK (status IN ('active', 'expired'));
+
+CREATE INDEX IF NOT EXISTS idx_course_students_status ON course_students(status, expiry_date);
+
+-- Per-course renewal windows; NULL uses the institution default
+ALTER TABLE courses ADD COLUMN IF NOT EXISTS renewal_window_days INTEGER[];
+
+-- Institution-wide enrollment settings (single row)
+CREATE TABLE IF NOT EXISTS enrollment_settings (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    renewal_window_days INTEGER[] NOT NULL DEFAULT '{7,1}', -- Days before expiry students are reminded
+    notify_admins BOOLEAN NOT NULL DEFAULT TRUE, -- Email admins a digest of reminders and expiries
+    updated_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO enrollment_settings (id) VALUES (TRUE) ON CONFLICT (id) DO NOTHING;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_enrollment_settings_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_enrollment_settings_updated_at ON enrollment_settings;
+CREATE TRIGGER trigger_update_enrollment_settings_updated_at
+    BEFORE UPDATE ON enrollment_settings
+    FOR EACH ROW
+    EXECUTE FUNCTION update_enrollment_settings_updated_at();
@@ -0,0 +1,41 @@
+-- Requests from students to join an existing course or for a book that is
+-- not in the system yet. Approving a request enrolls the student.
+CREATE TABLE IF NOT EXISTS course_requests (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id INTEGER REFERENCES courses(id) ON DELETE SET NULL, -- Requested course, or the course created for a new book
+    title VARCHAR(255), -- Requested book when it is not in the system
+    author VARCHAR(255),
+    code VARCHAR(50),
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'rejected', 'cancelled')),
+    admin_comment TEXT,
+    reviewed_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    reviewed_at TIMESTAMP WITH TIME ZONE,
+    outcome VARCHAR(20), -- enrolled or waitlisted once approved
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (course_id IS NOT NULL OR title IS NOT NULL OR status <> 'pending')
+);
+
+CREATE INDEX IF NOT EXISTS idx_course_requests_status ON course_requests(status, created_at);
+CREATE INDEX IF NOT EXISTS idx_course_requests_user ON course_requests(user_id, created_at DESC);
+-- A student has at most one pending request per course
+CREATE UNIQUE INDEX IF NOT EXISTS idx_course_requests_pending_course
+    ON course_requests(user_id, course_id) WHERE status = 'pending' AND course_id IS NOT NULL;
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_course_requests_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_course_requests_updated_at ON course_requests;
+CREATE TRIGGER trigger_update_course_requests_updated_at
+    BEFORE UPDATE ON course_requests
+    FOR EACH ROW
+    EXECUTE FUNCTION update_course_requests_updated_at();
@@ -0,0 +1,78 @@
+-- Per-user reading state of course books, synced between devices.
+-- Rows carry the time the client made the change (client_updated_at) for
+-- last-write-wins conflict handling, and updated_at for incremental sync.
+-- Deleted bookmarks and highlights are kept as tombstones so the deletion
+-- reaches the student's other devices.
+CREATE TABLE IF NOT EXISTS reading_progress (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    last_page INTEGER NOT NULL CHECK (last_page >= 1),
+    page_count INTEGER CHECK (page_count >= 1),
+    percent NUMERIC(5,2) NOT NULL DEFAULT 0 CHECK (percent >= 0 AND percent <= 100),
+    client_updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(user_id, course_id)
+);
+
+CREATE TABLE IF NOT EXISTS reading_bookmarks (
+    id UUID PRIMARY KEY, -- Generated by the client so bookmarks can be made offline
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    page INTEGER NOT NULL CHECK (page >= 1),
+    label VARCHAR(200),
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    client_updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_bookmarks_user_course ON reading_bookmarks(user_id, course_id, updated_at);
+
+CREATE TABLE IF NOT EXISTS reading_highlights (
+    id UUID PRIMARY KEY, -- Generated by the client so highlights can be made offline
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id INTEGER NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    page INTEGER NOT NULL CHECK (page >= 1),
+    start_offset INTEGER NOT NULL CHECK (start_offset >= 0), -- Character offsets in the page text
+    end_offset INTEGER NOT NULL,
+    text TEXT, -- Highlighted text
+    note TEXT,
+    color VARCHAR(20) NOT NULL DEFAULT 'yellow',
+    deleted BOOLEAN NOT NULL DEFAULT false,
+    client_updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (end_offset > start_offset)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reading_highlights_user_course ON reading_highlights(user_id, course_id, updated_at);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_reading_state_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create triggers to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_reading_progress_updated_at ON reading_progress;
+CREATE TRIGGER trigger_update_reading_progress_updated_at
+    BEFORE UPDATE ON reading_progress
+    FOR EACH ROW
+    EXECUTE FUNCTION update_reading_state_updated_at();
+
+DROP TRIGGER IF EXISTS trigger_update_reading_bookmarks_updated_at ON reading_bookmarks;
+CREATE TRIGGER trigger_update_reading_bookmarks_updated_at
+    BEFORE UPDATE ON reading_bookmarks
+    FOR EACH ROW
+    EXECUTE FUNCTION update_reading_state_updated_at();
+
+DROP TRIGGER IF EXISTS trigger_update_reading_highlights_updated_at ON reading_highlights;
+CREATE TRIGGER trigger_update_reading_highlights_updated_at
+    BEFORE UPDATE ON reading_highlights
+    FOR EACH ROW
+    EXECUTE FUNCTION update_reading_state_updated_at();
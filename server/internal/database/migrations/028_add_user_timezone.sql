@@ -0,0 +1,3 @@
+-- Optional per-user timezone (IANA name) that times are shown to the user in.
+-- NULL means the institution timezone.
+ALTER TABLE user_preferences ADD COLUMN IF NOT EXISTS timezone VARCHAR(64);
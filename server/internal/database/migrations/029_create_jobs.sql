@@ -0,0 +1,50 @@
+-- Background jobs run by the jobs package. Each job has one row holding its
+-- schedule state and the lease that lets only one server instance run it.
+CREATE TABLE IF NOT EXISTS job_states (
+    name VARCHAR(100) PRIMARY KEY,
+    schedule VARCHAR(100) NOT NULL, -- Cron expression the next run was worked out from
+    next_run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    paused BOOLEAN NOT NULL DEFAULT false,
+    paused_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    paused_at TIMESTAMP WITH TIME ZONE,
+    lease_owner VARCHAR(255), -- Instance running the job
+    lease_expires_at TIMESTAMP WITH TIME ZONE,
+    last_run_at TIMESTAMP WITH TIME ZONE,
+    last_status VARCHAR(20),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- One row per attempt of a job run
+CREATE TABLE IF NOT EXISTS job_runs (
+    id SERIAL PRIMARY KEY,
+    job_name VARCHAR(100) NOT NULL,
+    trigger VARCHAR(20) NOT NULL DEFAULT 'scheduled' CHECK (trigger IN ('scheduled', 'manual')),
+    attempt INTEGER NOT NULL DEFAULT 1,
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+    result TEXT, -- Summary of what the run did
+    error_message TEXT,
+    instance VARCHAR(255) NOT NULL,
+    triggered_by INTEGER REFERENCES users(id) ON DELETE SET NULL,
+    started_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_name_started_at ON job_runs(job_name, started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_job_runs_started_at ON job_runs(started_at);
+
+-- Create function to update updated_at timestamp
+CREATE OR REPLACE FUNCTION update_job_states_updated_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Create trigger to automatically update updated_at
+DROP TRIGGER IF EXISTS trigger_update_job_states_updated_at ON job_states;
+CREATE TRIGGER trigger_update_job_states_updated_at
+    BEFORE UPDATE ON job_states
+    FOR EACH ROW
+    EXECUTE FUNCTION update_job_states_updated_at();
@@ -0,0 +1,3 @@
+-- Students past their expiry date are moved to the expired status by a
+-- daily job, which looks them up by expiry date
+CREATE INDEX IF NOT EXISTS idx_users_expiry_date ON users(expiry_date) WHERE expiry_date IS NOT NULL;
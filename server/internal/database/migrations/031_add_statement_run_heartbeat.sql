@@ -0,0 +1,4 @@
+-- Bulk statement runs move their heartbeat as they make progress. A run whose
+-- heartbeat hasn't moved for a while was interrupted (e.g. by a restart) and
+-- can be recovered.
+ALTER TABLE ride_statement_runs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
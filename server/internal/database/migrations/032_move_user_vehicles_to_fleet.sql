@@ -0,0 +1,28 @@
+-- Vehicles live in the fleet only. Move the vehicle number and type still
+-- kept on driver user rows into vehicles, make each driver without a current
+-- vehicle drive theirs, and clear the user columns, which are no longer used.
+INSERT INTO vehicles (registration_number, vehicle_type)
+SELECT DISTINCT ON (UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')))
+       UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')),
+       NULLIF(TRIM(vehicle_type), '')
+FROM users
+WHERE LOWER(role) = 'driver'
+  AND NULLIF(TRIM(vehicle_number), '') IS NOT NULL
+ORDER BY UPPER(REGEXP_REPLACE(vehicle_number, '\s+', '', 'g')), updated_at DESC
+ON CONFLICT (registration_number) DO UPDATE
+SET vehicle_type = COALESCE(vehicles.vehicle_type, EXCLUDED.vehicle_type);
+
+INSERT INTO driver_vehicle_assignments (driver_id, vehicle_id)
+SELECT u.id, v.id
+FROM users u
+JOIN vehicles v ON v.registration_number = UPPER(REGEXP_REPLACE(u.vehicle_number, '\s+', '', 'g'))
+WHERE LOWER(u.role) = 'driver'
+  AND v.status = 'active'
+  AND NOT EXISTS (
+      SELECT 1 FROM driver_vehicle_assignments a
+      WHERE a.driver_id = u.id AND a.ends_at IS NULL
+  );
+
+UPDATE users
+SET vehicle_number = NULL, vehicle_type = NULL
+WHERE vehicle_number IS NOT NULL OR vehicle_type IS NOT NULL;
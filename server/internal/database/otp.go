@@ -5,11 +5,13 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
 )
 
 // StoreOTP stores an OTP code in the database for audit purposes
 func StoreOTP(ctx context.Context, email, otp string, userID *int, purpose string) error {
-	expiresAt := time.Now().Add(5 * time.Minute)
+	expiresAt := clock.Now().Add(5 * time.Minute)
 
 	query := `
 		INSERT INTO otp_codes (email, otp_code, user_id, purpose, expires_at)
@@ -0,0 +1,278 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Payment order statuses
+const (
+	PaymentOrderCreated = "created"
+	PaymentOrderPaid    = "paid"
+	PaymentOrderFailed  = "failed"
+)
+
+// Gateway event types handled by ProcessGatewayEvent
+const (
+	GatewayEventCaptured = "payment.captured"
+	GatewayEventFailed   = "payment.failed"
+)
+
+// Webhook processing outcomes
+const (
+	WebhookOutcomeSettled        = "settled"
+	WebhookOutcomeAlreadySettled = "already_settled"
+	WebhookOutcomeFailed         = "failed"
+	WebhookOutcomeDuplicate      = "duplicate"
+	WebhookOutcomeUnknownOrder   = "unknown_order"
+	WebhookOutcomeIgnored        = "ignored"
+)
+
+// PaymentOrder is an online payment order created with a payment gateway
+type PaymentOrder struct {
+	ID                int        `json:"id"`
+	RideBillID        int        `json:"rideBillId"`
+	Provider          string     `json:"provider"`
+	ProviderOrderID   string     `json:"providerOrderId"`
+	Amount            float64    `json:"amount"`
+	Currency          string     `json:"currency"`
+	Status            string     `json:"status"`
+	ProviderPaymentID *string    `json:"providerPaymentId"`
+	PaymentID         *int       `json:"paymentId"`
+	CreatedBy         *int       `json:"createdBy"`
+	PaidAt            *time.Time `json:"paidAt"`
+	CreatedAt         time.Time  `json:"createdAt"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+}
+
+// GatewayEvent is a verified webhook event from a payment gateway
+type GatewayEvent struct {
+	Provider  string
+	EventID   string
+	Type      string
+	OrderID   string
+	PaymentID string
+	Amount    float64
+	Method    string
+	Payload   []byte
+}
+
+const paymentOrderColumns = `id, ride_bill_id, provider, provider_order_id, amount, currency, status,
+	provider_payment_id, payment_id, created_by, paid_at, created_at, updated_at`
+
+// scanPaymentOrder scans a row selected with paymentOrderColumns
+func scanPaymentOrder(row pgx.Row) (*PaymentOrder, error) {
+	var o PaymentOrder
+	err := row.Scan(
+		&o.ID, &o.RideBillID, &o.Provider, &o.ProviderOrderID, &o.Amount, &o.Currency, &o.Status,
+		&o.ProviderPaymentID, &o.PaymentID, &o.CreatedBy, &o.PaidAt, &o.CreatedAt, &o.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// GetOpenPaymentOrder returns the most recent unpaid order for a bill with the
+// given provider and amount, or nil if there is none
+func GetOpenPaymentOrder(ctx context.Context, billID int, provider string, amount float64) (*PaymentOrder, error) {
+	query := `SELECT ` + paymentOrderColumns + `
+		FROM payment_orders
+		WHERE ride_bill_id = $1 AND provider = $2 AND amount = $3 AND status = 'created'
+		ORDER BY created_at DESC
+		LIMIT 1`
+
+	order, err := scanPaymentOrder(GetPool().QueryRow(ctx, query, billID, provider, RoundCents(amount)))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return order, err
+}
+
+// SavePaymentOrder stores an order created with the gateway and marks an
+// unpaid bill as awaiting payment
+func SavePaymentOrder(ctx context.Context, o PaymentOrder) (*PaymentOrder, error) {
+	var saved *PaymentOrder
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		balance, err := getBillBalance(ctx, tx, o.RideBillID, true)
+		if err != nil {
+			return err
+		}
+		if balance.Status == "cancelled" {
+			return ErrBillCancelled
+		}
+
+		query := `
+			INSERT INTO payment_orders (ride_bill_id, provider, provider_order_id, amount, currency, status, created_by)
+			VALUES ($1, $2, $3, $4, $5, 'created', $6)
+			RETURNING ` + paymentOrderColumns
+		saved, err = scanPaymentOrder(tx.QueryRow(ctx, query,
+			o.RideBillID, o.Provider, o.ProviderOrderID, RoundCents(o.Amount), o.Currency, o.CreatedBy,
+		))
+		if err != nil {
+			return err
+		}
+
+		if balance.Status == "pending" {
+			_, err = tx.Exec(ctx, `UPDATE ride_bills SET status = 'awaiting_payment' WHERE id = $1`, o.RideBillID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// GetBillPaymentOrders returns all online payment orders for a bill, newest first
+func GetBillPaymentOrders(ctx context.Context, billID int) ([]PaymentOrder, error) {
+	query := `SELECT ` + paymentOrderColumns + `
+		FROM payment_orders
+		WHERE ride_bill_id = $1
+		ORDER BY created_at DESC, id DESC`
+
+	rows, err := GetPool().Query(ctx, query, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []PaymentOrder{}
+	for rows.Next() {
+		order, err := scanPaymentOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *order)
+	}
+
+	return orders, rows.Err()
+}
+
+// ProcessGatewayEvent applies a verified gateway webhook exactly once.
+// Captured payments are recorded in the ledger and settle the bill; failed
+// payments close the order and release the bill from awaiting_payment.
+// Redelivered events are detected by their event ID and return WebhookOutcomeDuplicate.
+func ProcessGatewayEvent(ctx context.Context, e GatewayEvent) (string, error) {
+	var outcome string
+
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var eventRowID int
+		err := tx.QueryRow(ctx, `
+			INSERT INTO payment_webhook_events (provider, event_id, event_type, provider_order_id, payload)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (provider, event_id) DO NOTHING
+			RETURNING id
+		`, e.Provider, e.EventID, e.Type, e.OrderID, e.Payload).Scan(&eventRowID)
+		if err == pgx.ErrNoRows {
+			outcome = WebhookOutcomeDuplicate
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		outcome, err = applyGatewayEvent(ctx, tx, e)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `UPDATE payment_webhook_events SET outcome = $1 WHERE id = $2`, outcome, eventRowID)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return outcome, nil
+}
+
+// applyGatewayEvent updates the order, ledger and bill for a new event
+func applyGatewayEvent(ctx context.Context, tx pgx.Tx, e GatewayEvent) (string, error) {
+	if e.Type != GatewayEventCaptured && e.Type != GatewayEventFailed {
+		return WebhookOutcomeIgnored, nil
+	}
+
+	query := `SELECT ` + paymentOrderColumns + `
+		FROM payment_orders
+		WHERE provider = $1 AND provider_order_id = $2
+		FOR UPDATE`
+	order, err := scanPaymentOrder(tx.QueryRow(ctx, query, e.Provider, e.OrderID))
+	if err == pgx.ErrNoRows {
+		return WebhookOutcomeUnknownOrder, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if order.Status == PaymentOrderPaid {
+		return WebhookOutcomeAlreadySettled, nil
+	}
+
+	if e.Type == GatewayEventFailed {
+		if _, err := tx.Exec(ctx, `UPDATE payment_orders SET status = 'failed' WHERE id = $1`, order.ID); err != nil {
+			return "", err
+		}
+		if err := releaseAwaitingPayment(ctx, tx, order.RideBillID); err != nil {
+			return "", err
+		}
+		return WebhookOutcomeFailed, nil
+	}
+
+	amount := e.Amount
+	if amount <= 0 {
+		amount = order.Amount
+	}
+	provider := e.Provider
+	paymentID := e.PaymentID
+	notes := "Online payment for order " + order.ProviderOrderID
+	payment, _, err := recordPaymentTx(ctx, tx, NewPayment{
+		RideBillID:        order.RideBillID,
+		Kind:              PaymentKindPayment,
+		Method:            e.Method,
+		Amount:            amount,
+		Reference:         &paymentID,
+		Notes:             &notes,
+		Provider:          &provider,
+		ProviderPaymentID: &paymentID,
+	}, false)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE payment_orders
+		SET status = 'paid', provider_payment_id = $1, payment_id = $2, paid_at = $3
+		WHERE id = $4
+	`, paymentID, payment.ID, payment.PaidAt, order.ID)
+	if err != nil {
+		return "", err
+	}
+
+	return WebhookOutcomeSettled, nil
+}
+
+// releaseAwaitingPayment moves a bill out of awaiting_payment once it has no open orders
+func releaseAwaitingPayment(ctx context.Context, tx pgx.Tx, billID int) error {
+	balance, err := getBillBalance(ctx, tx, billID, true)
+	if err != nil {
+		return err
+	}
+	if balance.Status != "awaiting_payment" {
+		return nil
+	}
+
+	var openOrders int
+	err = tx.QueryRow(ctx,
+		`SELECT COUNT(*) FROM payment_orders WHERE ride_bill_id = $1 AND status = 'created'`,
+		billID,
+	).Scan(&openOrders)
+	if err != nil || openOrders > 0 {
+		return err
+	}
+
+	status := DeriveBillStatus("", balance.Fare, balance.AmountPaid, balance.AmountRefunded)
+	_, err = tx.Exec(ctx, `UPDATE ride_bills SET status = $1 WHERE id = $2`, status, billID)
+	return err
+}
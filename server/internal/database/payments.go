@@ -0,0 +1,482 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
+)
+
+var (
+	ErrBillNotFound         = errors.New("ride bill not found")
+	ErrBillCancelled        = errors.New("ride bill is cancelled")
+	ErrAmountExceedsBalance = errors.New("amount exceeds outstanding balance")
+	ErrRefundExceedsPaid    = errors.New("refund exceeds amount paid")
+	ErrNothingOutstanding   = errors.New("ride bill has no outstanding balance")
+	ErrBillHasPayments      = errors.New("ride bill has recorded payments")
+)
+
+// Payment kinds
+const (
+	PaymentKindPayment = "payment"
+	PaymentKindRefund  = "refund"
+)
+
+// ValidPaymentMethods lists the accepted payment methods
+var ValidPaymentMethods = map[string]bool{
+	"cash":          true,
+	"upi":           true,
+	"card":          true,
+	"bank_transfer": true,
+	"other":         true,
+}
+
+// Payment represents a single ledger entry against a ride bill
+type Payment struct {
+	ID         int       `json:"id"`
+	RideBillID int       `json:"rideBillId"`
+	Kind       string    `json:"kind"`
+	Method     string    `json:"method"`
+	Amount     float64   `json:"amount"`
+	Reference  *string   `json:"reference"`
+	Notes      *string   `json:"notes"`
+	RecordedBy *int      `json:"recordedBy"`
+	PaidAt     time.Time `json:"paidAt"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// BillBalance summarizes the ledger for a single ride bill
+type BillBalance struct {
+	RideBillID     int     `json:"rideBillId"`
+	Fare           float64 `json:"fare"`
+	AmountPaid     float64 `json:"amountPaid"`
+	AmountRefunded float64 `json:"amountRefunded"`
+	NetPaid        float64 `json:"netPaid"`
+	Balance        float64 `json:"balance"`
+	Status         string  `json:"status"`
+}
+
+// NewPayment describes a ledger entry to be recorded
+type NewPayment struct {
+	RideBillID int
+	Kind       string
+	Method     string
+	Amount     float64
+	Reference  *string
+	Notes      *string
+	RecordedBy *int
+	PaidAt     time.Time
+
+	// Set for payments received through an online payment gateway
+	Provider          *string
+	ProviderPaymentID *string
+}
+
+// ReconciliationDay compares expected and collected totals for a single day
+type ReconciliationDay struct {
+	Date           string  `json:"date"`
+	BillCount      int     `json:"billCount"`
+	Expected       float64 `json:"expected"`
+	PaymentCount   int     `json:"paymentCount"`
+	Collected      float64 `json:"collected"`
+	Refunded       float64 `json:"refunded"`
+	NetCollected   float64 `json:"netCollected"`
+	Difference     float64 `json:"difference"`
+	CashCollected  float64 `json:"cashCollected"`
+	UPICollected   float64 `json:"upiCollected"`
+	CardCollected  float64 `json:"cardCollected"`
+	BankCollected  float64 `json:"bankTransferCollected"`
+	OtherCollected float64 `json:"otherCollected"`
+}
+
+// RoundCents rounds a monetary amount to two decimal places
+func RoundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// DeriveBillStatus computes a bill's status from its ledger totals.
+// Cancelled bills stay cancelled regardless of their ledger, bills with
+// nothing to pay are paid, and unpaid bills with an open online payment order
+// stay awaiting_payment.
+func DeriveBillStatus(currentStatus string, fare, paid, refunded float64) string {
+	if currentStatus == "cancelled" {
+		return "cancelled"
+	}
+	net := RoundCents(paid - refunded)
+	switch {
+	case net <= 0 && refunded > 0:
+		return "refunded"
+	case RoundCents(fare) <= 0:
+		return "paid"
+	case net <= 0 && currentStatus == "awaiting_payment":
+		return "awaiting_payment"
+	case net <= 0:
+		return "pending"
+	case net < RoundCents(fare):
+		return "partially_paid"
+	default:
+		return "paid"
+	}
+}
+
+// rowQuerier is satisfied by both the connection pool and transactions
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// getBillBalance loads a bill's ledger totals
+func getBillBalance(ctx context.Context, q rowQuerier, billID int, forUpdate bool) (*BillBalance, error) {
+	query := `SELECT id, fare, status FROM ride_bills WHERE id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE`
+	}
+
+	balance := BillBalance{}
+	err := q.QueryRow(ctx, query, billID).Scan(&balance.RideBillID, &balance.Fare, &balance.Status)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrBillNotFound
+		}
+		return nil, err
+	}
+
+	totalsQuery := `
+		SELECT COALESCE(SUM(amount) FILTER (WHERE kind = 'payment'), 0),
+		       COALESCE(SUM(amount) FILTER (WHERE kind = 'refund'), 0)
+		FROM payments
+		WHERE ride_bill_id = $1
+	`
+	if err := q.QueryRow(ctx, totalsQuery, billID).Scan(&balance.AmountPaid, &balance.AmountRefunded); err != nil {
+		return nil, err
+	}
+
+	balance.NetPaid = RoundCents(balance.AmountPaid - balance.AmountRefunded)
+	balance.Balance = RoundCents(balance.Fare - balance.NetPaid)
+	return &balance, nil
+}
+
+// syncBillStatus recomputes a bill's status from its ledger and persists it if changed
+func syncBillStatus(ctx context.Context, tx pgx.Tx, balance *BillBalance) error {
+	status := DeriveBillStatus(balance.Status, balance.Fare, balance.AmountPaid, balance.AmountRefunded)
+	if status == balance.Status {
+		return nil
+	}
+	_, err := tx.Exec(ctx, `UPDATE ride_bills SET status = $1 WHERE id = $2`, status, balance.RideBillID)
+	if err != nil {
+		return err
+	}
+	balance.Status = status
+	return nil
+}
+
+// RecordPayment adds a payment or refund to a bill's ledger and updates the bill status
+func RecordPayment(ctx context.Context, p NewPayment) (*Payment, *BillBalance, error) {
+	var payment *Payment
+	var balance *BillBalance
+
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		payment, balance, err = recordPaymentTx(ctx, tx, p, true)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payment, balance, nil
+}
+
+// recordPaymentTx records a ledger entry within tx. When enforceLimits is false
+// the entry is recorded even if it overpays or targets a cancelled bill, which is
+// needed for money the gateway has already collected.
+func recordPaymentTx(ctx context.Context, tx pgx.Tx, p NewPayment, enforceLimits bool) (*Payment, *BillBalance, error) {
+	balance, err := getBillBalance(ctx, tx, p.RideBillID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	amount := RoundCents(p.Amount)
+	if p.Kind == PaymentKindRefund {
+		if amount > balance.NetPaid {
+			return nil, nil, ErrRefundExceedsPaid
+		}
+	} else if enforceLimits {
+		if balance.Status == "cancelled" {
+			return nil, nil, ErrBillCancelled
+		}
+		if amount > balance.Balance {
+			return nil, nil, ErrAmountExceedsBalance
+		}
+	}
+
+	paidAt := p.PaidAt
+	if paidAt.IsZero() {
+		paidAt = clock.Now()
+	}
+
+	insertQuery := `
+		INSERT INTO payments (ride_bill_id, kind, method, amount, reference, notes, recorded_by, paid_at, provider, provider_payment_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id, ride_bill_id, kind, method, amount, reference, notes, recorded_by, paid_at, created_at
+	`
+	var payment Payment
+	err = tx.QueryRow(ctx, insertQuery,
+		p.RideBillID, p.Kind, p.Method, amount, p.Reference, p.Notes, p.RecordedBy, paidAt,
+		p.Provider, p.ProviderPaymentID,
+	).Scan(
+		&payment.ID, &payment.RideBillID, &payment.Kind, &payment.Method, &payment.Amount,
+		&payment.Reference, &payment.Notes, &payment.RecordedBy, &payment.PaidAt, &payment.CreatedAt,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.Kind == PaymentKindRefund {
+		balance.AmountRefunded = RoundCents(balance.AmountRefunded + amount)
+	} else {
+		balance.AmountPaid = RoundCents(balance.AmountPaid + amount)
+	}
+	balance.NetPaid = RoundCents(balance.AmountPaid - balance.AmountRefunded)
+	balance.Balance = RoundCents(balance.Fare - balance.NetPaid)
+
+	if err := syncBillStatus(ctx, tx, balance); err != nil {
+		return nil, nil, err
+	}
+	return &payment, balance, nil
+}
+
+// SettleBill records a payment for a bill's full outstanding balance.
+// It is a no-op when nothing is outstanding.
+func SettleBill(ctx context.Context, billID int, method string, recordedBy *int) (*BillBalance, error) {
+	var balance *BillBalance
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		balance, err = settleBillTx(ctx, tx, billID, method, recordedBy)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// settleBillTx settles a bill within tx
+func settleBillTx(ctx context.Context, tx pgx.Tx, billID int, method string, recordedBy *int) (*BillBalance, error) {
+	balance, err := getBillBalance(ctx, tx, billID, true)
+	if err != nil {
+		return nil, err
+	}
+	if balance.Status == "cancelled" {
+		return nil, ErrBillCancelled
+	}
+	if balance.Balance <= 0 {
+		// Nothing to collect, but a bill with nothing due is still paid
+		return balance, syncBillStatus(ctx, tx, balance)
+	}
+
+	notes := "Settled from ride bill status update"
+	_, balance, err = recordPaymentTx(ctx, tx, NewPayment{
+		RideBillID: billID,
+		Kind:       PaymentKindPayment,
+		Method:     method,
+		Amount:     balance.Balance,
+		Notes:      &notes,
+		RecordedBy: recordedBy,
+	}, true)
+	return balance, err
+}
+
+// SetBillCancelled cancels a bill or reopens a cancelled one, deriving the
+// reopened status from the ledger
+func SetBillCancelled(ctx context.Context, billID int, cancelled bool) (*BillBalance, error) {
+	var balance *BillBalance
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		balance, err = setBillCancelledTx(ctx, tx, billID, cancelled)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// setBillCancelledTx cancels or reopens a bill within tx
+func setBillCancelledTx(ctx context.Context, tx pgx.Tx, billID int, cancelled bool) (*BillBalance, error) {
+	balance, err := getBillBalance(ctx, tx, billID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	status := "cancelled"
+	if !cancelled {
+		status = DeriveBillStatus("", balance.Fare, balance.AmountPaid, balance.AmountRefunded)
+	}
+	if status == balance.Status {
+		return balance, nil
+	}
+	if _, err := tx.Exec(ctx, `UPDATE ride_bills SET status = $1 WHERE id = $2`, status, billID); err != nil {
+		return nil, err
+	}
+	balance.Status = status
+	return balance, nil
+}
+
+// RideBillUpdate is an admin's change to a ride bill. Nil fields are left
+// as they are.
+type RideBillUpdate struct {
+	DriverID      *int
+	Distance      *float64
+	Status        *string // pending, paid or cancelled
+	PaymentMethod string  // Method of the payment settling the bill
+	RecordedBy    *int
+}
+
+// UpdateRideBill applies an admin's change to a ride bill in one
+// transaction, so a change that fails part way leaves the bill untouched.
+// Assigning a driver fails like AssignDriver; changing the status settles,
+// cancels or reopens the bill. A bill with payments can't be reopened as
+// pending (ErrBillHasPayments).
+func UpdateRideBill(ctx context.Context, billID int, u RideBillUpdate) error {
+	return WithTransaction(ctx, func(tx pgx.Tx) error {
+		balance, err := getBillBalance(ctx, tx, billID, true)
+		if err != nil {
+			return err
+		}
+
+		if u.DriverID != nil {
+			if _, err := assignDriverTx(ctx, tx, billID, *u.DriverID); err != nil {
+				return err
+			}
+		}
+		if u.Distance != nil {
+			if _, err := tx.Exec(ctx, `UPDATE ride_bills SET distance = $1 WHERE id = $2`, *u.Distance, billID); err != nil {
+				return err
+			}
+		}
+
+		if u.Status == nil || *u.Status == balance.Status {
+			return nil
+		}
+		switch *u.Status {
+		case "paid":
+			_, err = settleBillTx(ctx, tx, billID, u.PaymentMethod, u.RecordedBy)
+		case "cancelled":
+			_, err = setBillCancelledTx(ctx, tx, billID, true)
+		case "pending":
+			if balance.NetPaid > 0 {
+				return ErrBillHasPayments
+			}
+			_, err = setBillCancelledTx(ctx, tx, billID, false)
+		}
+		return err
+	})
+}
+
+// GetBillBalance returns the ledger summary for a ride bill
+func GetBillBalance(ctx context.Context, billID int) (*BillBalance, error) {
+	return getBillBalance(ctx, GetPool(), billID, false)
+}
+
+// GetBillPayments returns all ledger entries for a ride bill in chronological order
+func GetBillPayments(ctx context.Context, billID int) ([]Payment, error) {
+	query := `
+		SELECT id, ride_bill_id, kind, method, amount, reference, notes, recorded_by, paid_at, created_at
+		FROM payments
+		WHERE ride_bill_id = $1
+		ORDER BY paid_at ASC, id ASC
+	`
+	rows, err := GetPool().Query(ctx, query, billID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := []Payment{}
+	for rows.Next() {
+		var p Payment
+		err := rows.Scan(
+			&p.ID, &p.RideBillID, &p.Kind, &p.Method, &p.Amount,
+			&p.Reference, &p.Notes, &p.RecordedBy, &p.PaidAt, &p.CreatedAt,
+		)
+		if err != nil {
+			continue
+		}
+		payments = append(payments, p)
+	}
+
+	return payments, rows.Err()
+}
+
+// GetReconciliationReport compares expected bill totals with collected ledger
+// totals for each day in the inclusive date range
+func GetReconciliationReport(ctx context.Context, from, to time.Time) ([]ReconciliationDay, error) {
+	query := `
+		WITH days AS (
+			SELECT generate_series($1::date, $2::date, INTERVAL '1 day')::date AS day
+		),
+		expected AS (
+			SELECT (created_at AT TIME ZONE current_setting('TimeZone'))::date AS day,
+			       COUNT(*) AS bill_count,
+			       SUM(fare) AS expected
+			FROM ride_bills
+			WHERE status <> 'cancelled'
+			  AND (created_at AT TIME ZONE current_setting('TimeZone'))::date BETWEEN $1::date AND $2::date
+			GROUP BY 1
+		),
+		collected AS (
+			SELECT (paid_at AT TIME ZONE current_setting('TimeZone'))::date AS day,
+			       COUNT(*) FILTER (WHERE kind = 'payment') AS payment_count,
+			       SUM(amount) FILTER (WHERE kind = 'payment') AS collected,
+			       SUM(amount) FILTER (WHERE kind = 'refund') AS refunded,
+			       SUM(amount) FILTER (WHERE kind = 'payment' AND method = 'cash') AS cash,
+			       SUM(amount) FILTER (WHERE kind = 'payment' AND method = 'upi') AS upi,
+			       SUM(amount) FILTER (WHERE kind = 'payment' AND method = 'card') AS card,
+			       SUM(amount) FILTER (WHERE kind = 'payment' AND method = 'bank_transfer') AS bank,
+			       SUM(amount) FILTER (WHERE kind = 'payment' AND method = 'other') AS other
+			FROM payments
+			WHERE (paid_at AT TIME ZONE current_setting('TimeZone'))::date BETWEEN $1::date AND $2::date
+			GROUP BY 1
+		)
+		SELECT d.day,
+		       COALESCE(e.bill_count, 0), COALESCE(e.expected, 0),
+		       COALESCE(c.payment_count, 0), COALESCE(c.collected, 0), COALESCE(c.refunded, 0),
+		       COALESCE(c.cash, 0), COALESCE(c.upi, 0), COALESCE(c.card, 0),
+		       COALESCE(c.bank, 0), COALESCE(c.other, 0)
+		FROM days d
+		LEFT JOIN expected e ON e.day = d.day
+		LEFT JOIN collected c ON c.day = d.day
+		ORDER BY d.day ASC
+	`
+
+	rows, err := GetPool().Query(ctx, query, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := []ReconciliationDay{}
+	for rows.Next() {
+		var day time.Time
+		var r ReconciliationDay
+		err := rows.Scan(
+			&day, &r.BillCount, &r.Expected,
+			&r.PaymentCount, &r.Collected, &r.Refunded,
+			&r.CashCollected, &r.UPICollected, &r.CardCollected,
+			&r.BankCollected, &r.OtherCollected,
+		)
+		if err != nil {
+			return nil, err
+		}
+		r.Date = day.Format("2006-01-02")
+		r.NetCollected = RoundCents(r.Collected - r.Refunded)
+		r.Difference = RoundCents(r.Expected - r.NetCollected)
+		report = append(report, r)
+	}
+
+	return report, rows.Err()
+}
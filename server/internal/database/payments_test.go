@@ -0,0 +1,71 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestDeriveBillStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		currentStatus string
+		fare          float64
+		paid          float64
+		refunded      float64
+		expected      string
+	}{
+		{"no payments", "pending", 100, 0, 0, "pending"},
+		{"partial payment", "pending", 100, 40, 0, "partially_paid"},
+		{"two partial payments add up", "partially_paid", 100, 100, 0, "paid"},
+		{"overpaid stays paid", "paid", 100, 120, 0, "paid"},
+		{"full refund", "paid", 100, 100, 100, "refunded"},
+		{"partial refund", "paid", 100, 100, 30, "partially_paid"},
+		{"cancelled stays cancelled", "cancelled", 100, 100, 0, "cancelled"},
+		{"cancelled and refunded stays cancelled", "cancelled", 100, 100, 100, "cancelled"},
+		{"zero fare bill with no payments", "pending", 0, 0, 0, "paid"},
+		{"zero fare bill awaiting online payment", "awaiting_payment", 0, 0, 0, "paid"},
+		{"floating point sums", "pending", 0.3, 0.1 + 0.2, 0, "paid"},
+		{"awaiting online payment", "awaiting_payment", 100, 0, 0, "awaiting_payment"},
+		{"awaiting online payment then paid", "awaiting_payment", 100, 100, 0, "paid"},
+		{"awaiting online payment then partially paid", "awaiting_payment", 100, 50, 0, "partially_paid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := DeriveBillStatus(tt.currentStatus, tt.fare, tt.paid, tt.refunded)
+			if result != tt.expected {
+				t.Errorf("DeriveBillStatus(%q, %v, %v, %v) = %q, want %q",
+					tt.currentStatus, tt.fare, tt.paid, tt.refunded, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRoundCents(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected float64
+	}{
+		{0, 0},
+		{10.005, 10.01},
+		{10.004, 10},
+		{0.1 + 0.2, 0.3},
+		{-5.555, -5.56},
+	}
+
+	for _, tt := range tests {
+		if result := RoundCents(tt.value); result != tt.expected {
+			t.Errorf("RoundCents(%v) = %v, want %v", tt.value, result, tt.expected)
+		}
+	}
+}
+
+func TestValidPaymentMethods(t *testing.T) {
+	for _, method := range []string{"cash", "upi", "card", "bank_transfer", "other"} {
+		if !ValidPaymentMethods[method] {
+			t.Errorf("Expected %q to be a valid payment method", method)
+		}
+	}
+	if ValidPaymentMethods["bitcoin"] {
+		t.Error("Expected bitcoin to be an invalid payment method")
+	}
+}
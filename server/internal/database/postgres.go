@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/server/internal/clock"
 )
 
 var pool *pgxpool.Pool
@@ -32,6 +34,10 @@ func Connect(dbURL string) {
 	config.MaxConnIdleTime = 30 * time.Minute
 	config.HealthCheckPeriod = time.Minute
 
+	// Run sessions in the institution timezone so SQL can work out local
+	// dates with AT TIME ZONE current_setting('TimeZone')
+	config.ConnConfig.RuntimeParams["timezone"] = clock.Location().String()
+
 	p, err := pgxpool.NewWithConfig(ctx, config)
 	if err != nil {
 		log.Fatal("failed to create connection pool:", err)
@@ -3,6 +3,8 @@ package database
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v5"
 )
 
 // UserPreferences represents user preferences stored in database
@@ -11,6 +13,7 @@ type UserPreferences struct {
 	UserID     int       `json:"userId"`
 	AccentColor string   `json:"accentColor"`
 	Theme      string    `json:"theme"`
+	Timezone   *string   `json:"timezone"`
 	CreatedAt  time.Time `json:"createdAt"`
 	UpdatedAt  time.Time `json:"updatedAt"`
 }
@@ -18,14 +21,14 @@ type UserPreferences struct {
 // GetUserPreferences retrieves user preferences, creating default if not exists
 func GetUserPreferences(ctx context.Context, userID int) (*UserPreferences, error) {
 	query := `
-		SELECT id, user_id, accent_color, theme, created_at, updated_at
+		SELECT id, user_id, accent_color, theme, timezone, created_at, updated_at
 		FROM user_preferences
 		WHERE user_id = $1
 	`
 
 	var prefs UserPreferences
 	err := GetPool().QueryRow(ctx, query, userID).Scan(
-		&prefs.ID, &prefs.UserID, &prefs.AccentColor, &prefs.Theme,
+		&prefs.ID, &prefs.UserID, &prefs.AccentColor, &prefs.Theme, &prefs.Timezone,
 		&prefs.CreatedAt, &prefs.UpdatedAt,
 	)
 
@@ -45,12 +48,12 @@ func CreateDefaultPreferences(ctx context.Context, userID int) (*UserPreferences
 		ON CONFLICT (user_id) DO UPDATE
 		SET accent_color = EXCLUDED.accent_color,
 		    theme = EXCLUDED.theme
-		RETURNING id, user_id, accent_color, theme, created_at, updated_at
+		RETURNING id, user_id, accent_color, theme, timezone, created_at, updated_at
 	`
 
 	var prefs UserPreferences
 	err := GetPool().QueryRow(ctx, query, userID).Scan(
-		&prefs.ID, &prefs.UserID, &prefs.AccentColor, &prefs.Theme,
+		&prefs.ID, &prefs.UserID, &prefs.AccentColor, &prefs.Theme, &prefs.Timezone,
 		&prefs.CreatedAt, &prefs.UpdatedAt,
 	)
 
@@ -89,3 +92,29 @@ func UpdateAccentColor(ctx context.Context, userID int, accentColor string) erro
 	_, err := GetPool().Exec(ctx, query, userID, accentColor)
 	return err
 }
+
+// UpdateUserTimezone updates only the timezone preference. Nil clears it so
+// the institution timezone is used.
+func UpdateUserTimezone(ctx context.Context, userID int, timezone *string) error {
+	query := `
+		INSERT INTO user_preferences (user_id, timezone)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET timezone = EXCLUDED.timezone,
+		    updated_at = CURRENT_TIMESTAMP
+	`
+
+	_, err := GetPool().Exec(ctx, query, userID, timezone)
+	return err
+}
+
+// GetUserTimezone returns a user's preferred timezone, or nil when they
+// have none
+func GetUserTimezone(ctx context.Context, userID int) (*string, error) {
+	var timezone *string
+	err := GetPool().QueryRow(ctx, `SELECT timezone FROM user_preferences WHERE user_id = $1`, userID).Scan(&timezone)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return timezone, err
+}
@@ -0,0 +1,415 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
+)
+
+// RatingTags are the tags students can add to a ride rating, with their labels
+var RatingTags = map[string]string{
+	"on_time":                "on time",
+	"late":                   "late",
+	"helpful":                "helpful driver",
+	"rude":                   "rude driver",
+	"safe_driving":           "safe driving",
+	"unsafe_driving":         "unsafe driving",
+	"clean_vehicle":          "clean vehicle",
+	"dirty_vehicle":          "vehicle not clean",
+	"vehicle_not_accessible": "vehicle not accessible",
+}
+
+// AlertRatingTags put a rating on the low-rating alert list whatever its score
+var AlertRatingTags = []string{"unsafe_driving", "vehicle_not_accessible"}
+
+// PassengerReportTags are the issues drivers can flag with a passenger
+var PassengerReportTags = map[string]string{
+	"no_show":          "passenger didn't show up",
+	"late":             "passenger was late",
+	"abusive":          "abusive behaviour",
+	"unsafe_behaviour": "unsafe behaviour",
+	"wrong_pickup":     "wrong pickup location",
+	"vehicle_damage":   "damaged the vehicle",
+}
+
+const (
+	// LowRating is the highest rating that counts as low
+	LowRating = 2
+
+	// Driver scores are averages smoothed towards ratingPriorMean, as if every
+	// driver started with ratingPriorWeight ratings of that value, so a single
+	// rating doesn't put a driver at the top or bottom of the list
+	ratingPriorMean   = 4.0
+	ratingPriorWeight = 5
+
+	// Drivers with at least flagMinRatings ratings and a score below
+	// flagScoreBelow are flagged for review
+	flagMinRatings = 3
+	flagScoreBelow = 3.5
+)
+
+var (
+	ErrRideNotCompleted = errors.New("ride hasn't taken place yet")
+	ErrNotYourRide      = errors.New("ride does not belong to you")
+	ErrAlreadyRated     = errors.New("ride has already been rated")
+	ErrAlreadyReported  = errors.New("an issue has already been reported for this ride")
+	ErrRatingNotFound   = errors.New("ride has not been rated")
+)
+
+// RideRating is a student's rating of a ride
+type RideRating struct {
+	ID           int       `json:"id"`
+	BillID       int       `json:"billId"`
+	UserID       int       `json:"userId"`
+	StudentName  string    `json:"studentName"`
+	DriverID     *int      `json:"driverId"`
+	DriverName   *string   `json:"driverName"`
+	Rating       int       `json:"rating"`
+	Tags         []string  `json:"tags"`
+	Comment      *string   `json:"comment"`
+	FromLocation string    `json:"fromLocation"`
+	ToLocation   string    `json:"toLocation"`
+	RideAt       time.Time `json:"rideAt"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// PassengerReport is an issue a driver flagged with a passenger
+type PassengerReport struct {
+	ID          int       `json:"id"`
+	BillID      int       `json:"billId"`
+	DriverID    int       `json:"driverId"`
+	DriverName  string    `json:"driverName"`
+	UserID      int       `json:"userId"`
+	StudentName string    `json:"studentName"`
+	Tags        []string  `json:"tags"`
+	Comment     *string   `json:"comment"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// DriverRatingSummary aggregates a driver's ratings
+type DriverRatingSummary struct {
+	DriverID     int            `json:"driverId"`
+	Name         string         `json:"name"`
+	Ratings      int            `json:"ratings"`
+	Average      float64        `json:"average"`
+	Score        float64        `json:"score"`
+	Distribution [5]int         `json:"distribution"` // Counts of 1 to 5 star ratings
+	LowRatings   int            `json:"lowRatings"`
+	Tags         map[string]int `json:"tags"`
+	Flagged      bool           `json:"flagged"`
+}
+
+// NormalizeRatingTags validates rating tags and returns them sorted without duplicates
+func NormalizeRatingTags(tags []string) ([]string, error) {
+	return normalizeTags(tags, RatingTags, "rating tag")
+}
+
+// NormalizePassengerReportTags validates passenger report tags and returns
+// them sorted without duplicates
+func NormalizePassengerReportTags(tags []string) ([]string, error) {
+	return normalizeTags(tags, PassengerReportTags, "issue")
+}
+
+// RideCompleted reports whether a ride has taken place and can be rated: a
+// driver accepted it, it wasn't cancelled or refunded and its time has passed
+func RideCompleted(status, dispatchStatus string, driverID *int, rideAt, now time.Time) bool {
+	return dispatchStatus == "accepted" && driverID != nil &&
+		status != "cancelled" && status != "refunded" && !rideAt.After(now)
+}
+
+// DriverScore smooths a driver's average rating towards the prior mean
+func DriverScore(sum, count int) float64 {
+	return RoundCents((float64(sum) + ratingPriorMean*ratingPriorWeight) / float64(count+ratingPriorWeight))
+}
+
+// summarize fills in the derived fields of a driver rating summary
+func (s *DriverRatingSummary) summarize() {
+	sum := 0
+	s.Ratings, s.LowRatings = 0, 0
+	for i, n := range s.Distribution {
+		s.Ratings += n
+		sum += (i + 1) * n
+		if i+1 <= LowRating {
+			s.LowRatings += n
+		}
+	}
+	s.Average = 0
+	if s.Ratings > 0 {
+		s.Average = RoundCents(float64(sum) / float64(s.Ratings))
+	}
+	s.Score = DriverScore(sum, s.Ratings)
+	s.Flagged = s.Ratings >= flagMinRatings && s.Score < flagScoreBelow
+}
+
+// completedRide is the part of a ride bill checked before rating or reporting it
+type completedRide struct {
+	userID         int
+	driverID       *int
+	status         string
+	dispatchStatus string
+	rideAt         time.Time
+}
+
+// lockCompletedRide loads a ride bill for rating or reporting
+func lockCompletedRide(ctx context.Context, tx pgx.Tx, billID int) (*completedRide, error) {
+	var r completedRide
+	err := tx.QueryRow(ctx, `
+		SELECT user_id, driver_id, status, dispatch_status, COALESCE(scheduled_for, created_at)
+		FROM ride_bills WHERE id = $1
+		FOR SHARE
+	`, billID).Scan(&r.userID, &r.driverID, &r.status, &r.dispatchStatus, &r.rideAt)
+	if err == pgx.ErrNoRows {
+		return nil, ErrBillNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+const rideRatingColumns = `r.id, r.ride_bill_id, r.user_id, COALESCE(s.name, s.username, ''),
+	r.driver_id, COALESCE(d.name, d.username), r.rating, r.tags, r.comment,
+	rb.from_location, rb.to_location, COALESCE(rb.scheduled_for, rb.created_at), r.created_at`
+
+const rideRatingFrom = `ride_ratings r
+	JOIN ride_bills rb ON rb.id = r.ride_bill_id
+	LEFT JOIN users s ON s.id = r.user_id
+	LEFT JOIN users d ON d.id = r.driver_id`
+
+// queryRideRatings runs a query selecting rideRatingColumns
+func queryRideRatings(ctx context.Context, query string, args ...interface{}) ([]RideRating, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ratings := []RideRating{}
+	for rows.Next() {
+		var r RideRating
+		err := rows.Scan(&r.ID, &r.BillID, &r.UserID, &r.StudentName, &r.DriverID, &r.DriverName,
+			&r.Rating, &r.Tags, &r.Comment, &r.FromLocation, &r.ToLocation, &r.RideAt, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ratings = append(ratings, r)
+	}
+	return ratings, rows.Err()
+}
+
+// GetRideRating returns the rating of a ride bill
+func GetRideRating(ctx context.Context, billID int) (*RideRating, error) {
+	ratings, err := queryRideRatings(ctx,
+		`SELECT `+rideRatingColumns+` FROM `+rideRatingFrom+` WHERE r.ride_bill_id = $1`, billID)
+	if err != nil {
+		return nil, err
+	}
+	if len(ratings) == 0 {
+		return nil, ErrRatingNotFound
+	}
+	return &ratings[0], nil
+}
+
+// CreateRideRating records a student's rating of a completed ride. Only the
+// student who booked the ride can rate it, once.
+func CreateRideRating(ctx context.Context, billID, userID, rating int, tags []string, comment *string) (*RideRating, error) {
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		ride, err := lockCompletedRide(ctx, tx, billID)
+		if err != nil {
+			return err
+		}
+		if ride.userID != userID {
+			return ErrNotYourRide
+		}
+		if !RideCompleted(ride.status, ride.dispatchStatus, ride.driverID, ride.rideAt, clock.Now()) {
+			return ErrRideNotCompleted
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO ride_ratings (ride_bill_id, user_id, driver_id, rating, tags, comment)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, billID, userID, ride.driverID, rating, tags, comment)
+		if isUniqueViolation(err) {
+			return ErrAlreadyRated
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetRideRating(ctx, billID)
+}
+
+// GetDriverRatings returns a driver's ratings since a time, newest first
+func GetDriverRatings(ctx context.Context, driverID int, since time.Time) ([]RideRating, error) {
+	query := `SELECT ` + rideRatingColumns + ` FROM ` + rideRatingFrom + `
+		WHERE r.driver_id = $1 AND r.created_at >= $2
+		ORDER BY r.created_at DESC, r.id DESC`
+	return queryRideRatings(ctx, query, driverID, since)
+}
+
+// GetLowRatingAlerts returns low ratings and ratings with alert tags since a
+// time, newest first
+func GetLowRatingAlerts(ctx context.Context, since time.Time) ([]RideRating, error) {
+	query := `SELECT ` + rideRatingColumns + ` FROM ` + rideRatingFrom + `
+		WHERE r.created_at >= $1 AND (r.rating <= $2 OR r.tags && $3)
+		ORDER BY r.created_at DESC, r.id DESC`
+	return queryRideRatings(ctx, query, since, LowRating, AlertRatingTags)
+}
+
+// GetDriverRatingSummaries aggregates the ratings of every active driver
+// since a time. Best scores come first; drivers without ratings come last.
+func GetDriverRatingSummaries(ctx context.Context, since time.Time) ([]DriverRatingSummary, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT u.id, COALESCE(u.name, u.username),
+		       COUNT(r.id) FILTER (WHERE r.rating = 1),
+		       COUNT(r.id) FILTER (WHERE r.rating = 2),
+		       COUNT(r.id) FILTER (WHERE r.rating = 3),
+		       COUNT(r.id) FILTER (WHERE r.rating = 4),
+		       COUNT(r.id) FILTER (WHERE r.rating = 5)
+		FROM users u
+		LEFT JOIN ride_ratings r ON r.driver_id = u.id AND r.created_at >= $1
+		WHERE LOWER(u.role) = 'driver' AND COALESCE(u.status, 'active') = 'active'
+		GROUP BY u.id
+		ORDER BY u.id
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []DriverRatingSummary{}
+	index := map[int]int{}
+	for rows.Next() {
+		var s DriverRatingSummary
+		d := &s.Distribution
+		if err := rows.Scan(&s.DriverID, &s.Name, &d[0], &d[1], &d[2], &d[3], &d[4]); err != nil {
+			return nil, err
+		}
+		s.Tags = map[string]int{}
+		s.summarize()
+		index[s.DriverID] = len(summaries)
+		summaries = append(summaries, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	tagRows, err := GetPool().Query(ctx, `
+		SELECT r.driver_id, t.tag, COUNT(*)
+		FROM ride_ratings r, unnest(r.tags) AS t(tag)
+		WHERE r.driver_id IS NOT NULL AND r.created_at >= $1
+		GROUP BY r.driver_id, t.tag
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var driverID, count int
+		var tag string
+		if err := tagRows.Scan(&driverID, &tag, &count); err != nil {
+			return nil, err
+		}
+		if i, ok := index[driverID]; ok {
+			summaries[i].Tags[tag] = count
+		}
+	}
+	if err := tagRows.Err(); err != nil {
+		return nil, err
+	}
+
+	SortDriverRatingSummaries(summaries)
+	return summaries, nil
+}
+
+// SortDriverRatingSummaries orders rated drivers by score, best first, then
+// drivers without ratings
+func SortDriverRatingSummaries(summaries []DriverRatingSummary) {
+	sort.SliceStable(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if (a.Ratings == 0) != (b.Ratings == 0) {
+			return a.Ratings > 0
+		}
+		return a.Score > b.Score
+	})
+}
+
+// CreatePassengerReport records an issue the driver of a completed ride
+// flagged with its passenger. Only the ride's accepted driver can report, once.
+func CreatePassengerReport(ctx context.Context, billID, driverID int, tags []string, comment *string) (*PassengerReport, error) {
+	var reportID int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		ride, err := lockCompletedRide(ctx, tx, billID)
+		if err != nil {
+			return err
+		}
+		if ride.driverID == nil || *ride.driverID != driverID || ride.dispatchStatus != "accepted" {
+			return ErrNotYourRide
+		}
+		if !RideCompleted(ride.status, ride.dispatchStatus, ride.driverID, ride.rideAt, clock.Now()) {
+			return ErrRideNotCompleted
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO passenger_reports (ride_bill_id, driver_id, user_id, tags, comment)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id
+		`, billID, driverID, ride.userID, tags, comment).Scan(&reportID)
+		if isUniqueViolation(err) {
+			return ErrAlreadyReported
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reports, err := queryPassengerReports(ctx, `WHERE pr.id = $1`, reportID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) == 0 {
+		return nil, ErrBillNotFound
+	}
+	return &reports[0], nil
+}
+
+// GetPassengerReports returns passenger reports since a time, newest first
+func GetPassengerReports(ctx context.Context, since time.Time) ([]PassengerReport, error) {
+	return queryPassengerReports(ctx, `WHERE pr.created_at >= $1 ORDER BY pr.created_at DESC, pr.id DESC`, since)
+}
+
+// queryPassengerReports selects passenger reports matching a WHERE clause
+func queryPassengerReports(ctx context.Context, where string, args ...interface{}) ([]PassengerReport, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT pr.id, pr.ride_bill_id, pr.driver_id, COALESCE(d.name, d.username, ''),
+		       pr.user_id, COALESCE(s.name, s.username, ''), pr.tags, pr.comment, pr.created_at
+		FROM passenger_reports pr
+		LEFT JOIN users d ON d.id = pr.driver_id
+		LEFT JOIN users s ON s.id = pr.user_id
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := []PassengerReport{}
+	for rows.Next() {
+		var r PassengerReport
+		err := rows.Scan(&r.ID, &r.BillID, &r.DriverID, &r.DriverName,
+			&r.UserID, &r.StudentName, &r.Tags, &r.Comment, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
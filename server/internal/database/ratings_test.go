@@ -0,0 +1,106 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRideCompleted(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	driverID := 7
+
+	tests := []struct {
+		name           string
+		status         string
+		dispatchStatus string
+		driverID       *int
+		rideAt         time.Time
+		expected       bool
+	}{
+		{"past pending ride", "pending", "accepted", &driverID, now.Add(-time.Hour), true},
+		{"past paid ride", "paid", "accepted", &driverID, now.Add(-time.Hour), true},
+		{"ride time now", "paid", "accepted", &driverID, now, true},
+		{"future ride", "paid", "accepted", &driverID, now.Add(time.Hour), false},
+		{"cancelled", "cancelled", "accepted", &driverID, now.Add(-time.Hour), false},
+		{"refunded", "refunded", "accepted", &driverID, now.Add(-time.Hour), false},
+		{"never dispatched", "paid", "unassigned", nil, now.Add(-time.Hour), false},
+		{"offer not accepted", "paid", "offered", nil, now.Add(-time.Hour), false},
+		{"accepted without a driver", "paid", "accepted", nil, now.Add(-time.Hour), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RideCompleted(tt.status, tt.dispatchStatus, tt.driverID, tt.rideAt, now); got != tt.expected {
+				t.Errorf("RideCompleted() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDriverRatingSummary(t *testing.T) {
+	tests := []struct {
+		name         string
+		distribution [5]int
+		ratings      int
+		average      float64
+		score        float64
+		lowRatings   int
+		flagged      bool
+	}{
+		{"no ratings", [5]int{}, 0, 0, 4, 0, false},
+		{"single five star", [5]int{0, 0, 0, 0, 1}, 1, 5, 4.17, 0, false},
+		{"single one star is not flagged", [5]int{1, 0, 0, 0, 0}, 1, 1, 3.5, 1, false},
+		{"consistently low", [5]int{3, 1, 0, 0, 0}, 4, 1.25, 2.78, 4, true},
+		{"mixed", [5]int{1, 0, 1, 2, 6}, 10, 4.2, 4.13, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := DriverRatingSummary{Distribution: tt.distribution}
+			s.summarize()
+			if s.Ratings != tt.ratings || s.Average != tt.average || s.Score != tt.score ||
+				s.LowRatings != tt.lowRatings || s.Flagged != tt.flagged {
+				t.Errorf("summarize() = ratings %d, average %v, score %v, low %d, flagged %v; want %d, %v, %v, %d, %v",
+					s.Ratings, s.Average, s.Score, s.LowRatings, s.Flagged,
+					tt.ratings, tt.average, tt.score, tt.lowRatings, tt.flagged)
+			}
+		})
+	}
+}
+
+func TestSortDriverRatingSummaries(t *testing.T) {
+	summaries := []DriverRatingSummary{
+		{DriverID: 1, Ratings: 0, Score: 4},
+		{DriverID: 2, Ratings: 3, Score: 3.2},
+		{DriverID: 3, Ratings: 8, Score: 4.6},
+		{DriverID: 4, Ratings: 0, Score: 4},
+	}
+	SortDriverRatingSummaries(summaries)
+
+	var ids []int
+	for _, s := range summaries {
+		ids = append(ids, s.DriverID)
+	}
+	if want := []int{3, 2, 1, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("SortDriverRatingSummaries order = %v, want %v", ids, want)
+	}
+}
+
+func TestNormalizeRatingTags(t *testing.T) {
+	tags, err := NormalizeRatingTags([]string{"Late", "vehicle_not_accessible", "late"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"late", "vehicle_not_accessible"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("NormalizeRatingTags = %v, want %v", tags, want)
+	}
+
+	if _, err := NormalizeRatingTags([]string{"no_show"}); err == nil {
+		t.Error("expected error for passenger report tag used as rating tag")
+	}
+	if _, err := NormalizePassengerReportTags([]string{"no_show"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
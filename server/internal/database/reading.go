@@ -0,0 +1,280 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ValidHighlightColors lists the colors highlights can have
+var ValidHighlightColors = map[string]bool{
+	"yellow": true,
+	"green":  true,
+	"blue":   true,
+	"pink":   true,
+	"orange": true,
+}
+
+// syncOverlap is subtracted from the since time of incremental syncs so
+// changes committed by transactions that started before the previous sync
+// are not missed. Clients receive a few changes twice, which is harmless.
+const syncOverlap = time.Minute
+
+// ReadingProgress is how far a student has read a course book
+type ReadingProgress struct {
+	CourseID  int
+	Page      int
+	PageCount *int
+	Percent   float64
+	UpdatedAt time.Time // When the client made the change
+	SyncedAt  time.Time // When the server stored it
+}
+
+// Bookmark is a labelled page of a course book
+type Bookmark struct {
+	ID        string // UUID chosen by the client
+	CourseID  int
+	Page      int
+	Label     *string
+	Deleted   bool
+	UpdatedAt time.Time // When the client made the change
+	SyncedAt  time.Time // When the server stored it
+}
+
+// Highlight is highlighted text of a course book with an optional note,
+// anchored to character offsets in the text of a page
+type Highlight struct {
+	ID          string // UUID chosen by the client
+	CourseID    int
+	Page        int
+	StartOffset int
+	EndOffset   int
+	Text        *string
+	Note        *string
+	Color       string
+	Deleted     bool
+	UpdatedAt   time.Time // When the client made the change
+	SyncedAt    time.Time // When the server stored it
+}
+
+// ReadingState is a student's reading state of a course book
+type ReadingState struct {
+	Progress   *ReadingProgress
+	Bookmarks  []Bookmark
+	Highlights []Highlight
+	ServerTime time.Time // Pass as since to fetch only later changes
+}
+
+// SyncResult counts the changes of a sync that were stored and those that
+// lost to a later change from another device
+type SyncResult struct {
+	Applied int
+	Stale   int
+}
+
+// GetReadingState returns a student's reading state of a course. With since,
+// only bookmarks and highlights changed after it are returned, deleted ones
+// included so other devices can drop them; otherwise deleted ones are left out.
+func GetReadingState(ctx context.Context, userID, courseID int, since *time.Time) (*ReadingState, error) {
+	state := &ReadingState{Bookmarks: []Bookmark{}, Highlights: []Highlight{}}
+	if err := GetPool().QueryRow(ctx, `SELECT NOW()`).Scan(&state.ServerTime); err != nil {
+		return nil, err
+	}
+
+	var p ReadingProgress
+	err := GetPool().QueryRow(ctx, `
+		SELECT course_id, last_page, page_count, percent::float8, client_updated_at, updated_at
+		FROM reading_progress WHERE user_id = $1 AND course_id = $2
+	`, userID, courseID).Scan(&p.CourseID, &p.Page, &p.PageCount, &p.Percent, &p.UpdatedAt, &p.SyncedAt)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		state.Progress = &p
+	}
+
+	var after *time.Time
+	if since != nil {
+		t := since.Add(-syncOverlap)
+		after = &t
+	}
+
+	rows, err := GetPool().Query(ctx, `
+		SELECT id::text, course_id, page, label, deleted, client_updated_at, updated_at
+		FROM reading_bookmarks
+		WHERE user_id = $1 AND course_id = $2
+		  AND (($3::timestamptz IS NULL AND NOT deleted) OR updated_at > $3)
+		ORDER BY page, created_at
+	`, userID, courseID, after)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var b Bookmark
+		if err := rows.Scan(&b.ID, &b.CourseID, &b.Page, &b.Label, &b.Deleted, &b.UpdatedAt, &b.SyncedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		state.Bookmarks = append(state.Bookmarks, b)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = GetPool().Query(ctx, `
+		SELECT id::text, course_id, page, start_offset, end_offset, text, note, color, deleted, client_updated_at, updated_at
+		FROM reading_highlights
+		WHERE user_id = $1 AND course_id = $2
+		  AND (($3::timestamptz IS NULL AND NOT deleted) OR updated_at > $3)
+		ORDER BY page, start_offset, created_at
+	`, userID, courseID, after)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var h Highlight
+		err := rows.Scan(&h.ID, &h.CourseID, &h.Page, &h.StartOffset, &h.EndOffset, &h.Text, &h.Note, &h.Color,
+			&h.Deleted, &h.UpdatedAt, &h.SyncedAt)
+		if err != nil {
+			return nil, err
+		}
+		state.Highlights = append(state.Highlights, h)
+	}
+	return state, rows.Err()
+}
+
+// saveReadingProgress stores reading progress unless a later change is
+// already stored. Reports whether it was stored.
+func saveReadingProgress(ctx context.Context, q rowQuerier, userID int, p ReadingProgress) (bool, error) {
+	var id int
+	err := q.QueryRow(ctx, `
+		INSERT INTO reading_progress (user_id, course_id, last_page, page_count, percent, client_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, course_id) DO UPDATE SET
+			last_page = EXCLUDED.last_page,
+			page_count = EXCLUDED.page_count,
+			percent = EXCLUDED.percent,
+			client_updated_at = EXCLUDED.client_updated_at
+		WHERE reading_progress.client_updated_at < EXCLUDED.client_updated_at
+		RETURNING id
+	`, userID, p.CourseID, p.Page, p.PageCount, p.Percent, p.UpdatedAt).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SaveReadingProgress stores a student's reading progress with
+// last-write-wins: a change made before the stored one is ignored. Returns
+// the progress stored afterwards and whether this change won.
+func SaveReadingProgress(ctx context.Context, userID int, p ReadingProgress) (*ReadingProgress, bool, error) {
+	applied, err := saveReadingProgress(ctx, GetPool(), userID, p)
+	if err != nil {
+		return nil, false, err
+	}
+	var stored ReadingProgress
+	err = GetPool().QueryRow(ctx, `
+		SELECT course_id, last_page, page_count, percent::float8, client_updated_at, updated_at
+		FROM reading_progress WHERE user_id = $1 AND course_id = $2
+	`, userID, p.CourseID).Scan(&stored.CourseID, &stored.Page, &stored.PageCount, &stored.Percent, &stored.UpdatedAt, &stored.SyncedAt)
+	if err != nil {
+		return nil, false, err
+	}
+	return &stored, applied, nil
+}
+
+// saveBookmark stores a bookmark unless a later change to it is already
+// stored. A bookmark id of another student or course is never overwritten.
+func saveBookmark(ctx context.Context, q rowQuerier, userID int, b Bookmark) (bool, error) {
+	var id string
+	err := q.QueryRow(ctx, `
+		INSERT INTO reading_bookmarks (id, user_id, course_id, page, label, deleted, client_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET
+			page = EXCLUDED.page,
+			label = EXCLUDED.label,
+			deleted = EXCLUDED.deleted,
+			client_updated_at = EXCLUDED.client_updated_at
+		WHERE reading_bookmarks.user_id = EXCLUDED.user_id
+		  AND reading_bookmarks.course_id = EXCLUDED.course_id
+		  AND reading_bookmarks.client_updated_at < EXCLUDED.client_updated_at
+		RETURNING id::text
+	`, b.ID, userID, b.CourseID, b.Page, b.Label, b.Deleted, b.UpdatedAt).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// saveHighlight stores a highlight unless a later change to it is already
+// stored. A highlight id of another student or course is never overwritten.
+func saveHighlight(ctx context.Context, q rowQuerier, userID int, h Highlight) (bool, error) {
+	var id string
+	err := q.QueryRow(ctx, `
+		INSERT INTO reading_highlights (id, user_id, course_id, page, start_offset, end_offset, text, note, color, deleted, client_updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET
+			page = EXCLUDED.page,
+			start_offset = EXCLUDED.start_offset,
+			end_offset = EXCLUDED.end_offset,
+			text = EXCLUDED.text,
+			note = EXCLUDED.note,
+			color = EXCLUDED.color,
+			deleted = EXCLUDED.deleted,
+			client_updated_at = EXCLUDED.client_updated_at
+		WHERE reading_highlights.user_id = EXCLUDED.user_id
+		  AND reading_highlights.course_id = EXCLUDED.course_id
+		  AND reading_highlights.client_updated_at < EXCLUDED.client_updated_at
+		RETURNING id::text
+	`, h.ID, userID, h.CourseID, h.Page, h.StartOffset, h.EndOffset, h.Text, h.Note, h.Color, h.Deleted, h.UpdatedAt).Scan(&id)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// SyncReading stores a batch of reading changes from a device in one
+// transaction, each with last-write-wins against changes from other devices
+func SyncReading(ctx context.Context, userID int, progress *ReadingProgress, bookmarks []Bookmark, highlights []Highlight) (*SyncResult, error) {
+	result := &SyncResult{}
+	count := func(applied bool) {
+		if applied {
+			result.Applied++
+		} else {
+			result.Stale++
+		}
+	}
+
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		*result = SyncResult{}
+		if progress != nil {
+			applied, err := saveReadingProgress(ctx, tx, userID, *progress)
+			if err != nil {
+				return err
+			}
+			count(applied)
+		}
+		for _, b := range bookmarks {
+			applied, err := saveBookmark(ctx, tx, userID, b)
+			if err != nil {
+				return err
+			}
+			count(applied)
+		}
+		for _, h := range highlights {
+			applied, err := saveHighlight(ctx, tx, userID, h)
+			if err != nil {
+				return err
+			}
+			count(applied)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,501 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Ride series statuses
+const (
+	RideSeriesActive    = "active"
+	RideSeriesPaused    = "paused"
+	RideSeriesCancelled = "cancelled"
+)
+
+var (
+	ErrSeriesNotFound  = errors.New("ride series not found")
+	ErrSeriesCancelled = errors.New("ride series is cancelled")
+	ErrHolidayExists   = errors.New("a holiday already exists on this date")
+)
+
+// RideSeries is a recurring ride booking. Route details are taken from the
+// ride location it books.
+type RideSeries struct {
+	ID                  int        `json:"id"`
+	UserID              int        `json:"userId"`
+	RideID              int        `json:"rideId"`
+	FromLocation        string     `json:"fromLocation"`
+	ToLocation          string     `json:"toLocation"`
+	Fare                float64    `json:"fare"`
+	DaysOfWeek          []int32    `json:"daysOfWeek"` // 0 = Sunday ... 6 = Saturday
+	RideTime            string     `json:"rideTime"`   // HH:MM in the institution timezone
+	StartDate           time.Time  `json:"startDate"`
+	EndDate             *time.Time `json:"endDate"`
+	SkipHolidays        bool       `json:"skipHolidays"`
+	Status              string     `json:"status"`
+	MaterializedThrough *time.Time `json:"materializedThrough"`
+	CreatedAt           time.Time  `json:"createdAt"`
+	UpdatedAt           time.Time  `json:"updatedAt"`
+}
+
+// Holiday is a date on which recurring rides are not booked
+type Holiday struct {
+	ID        int       `json:"id"`
+	Date      time.Time `json:"date"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+const rideSeriesColumns = `rs.id, rs.user_id, rs.ride_id, rl.from_location, rl.to_location, rl.fare,
+	rs.days_of_week, to_char(rs.ride_time, 'HH24:MI'), rs.start_date, rs.end_date, rs.skip_holidays,
+	rs.status, rs.materialized_through, rs.created_at, rs.updated_at`
+
+const rideSeriesFrom = `ride_series rs JOIN ride_locations rl ON rl.id = rs.ride_id`
+
+// scanRideSeries scans a row selected with rideSeriesColumns
+func scanRideSeries(row pgx.Row) (*RideSeries, error) {
+	var s RideSeries
+	err := row.Scan(
+		&s.ID, &s.UserID, &s.RideID, &s.FromLocation, &s.ToLocation, &s.Fare,
+		&s.DaysOfWeek, &s.RideTime, &s.StartDate, &s.EndDate, &s.SkipHolidays,
+		&s.Status, &s.MaterializedThrough, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// queryRideSeries runs a query selecting rideSeriesColumns
+func queryRideSeries(ctx context.Context, query string, args ...interface{}) ([]RideSeries, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []RideSeries{}
+	for rows.Next() {
+		s, err := scanRideSeries(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *s)
+	}
+	return result, rows.Err()
+}
+
+// GetRideSeries returns a ride series by ID
+func GetRideSeries(ctx context.Context, id int) (*RideSeries, error) {
+	query := `SELECT ` + rideSeriesColumns + ` FROM ` + rideSeriesFrom + ` WHERE rs.id = $1`
+	s, err := scanRideSeries(GetPool().QueryRow(ctx, query, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrSeriesNotFound
+	}
+	return s, err
+}
+
+// GetUserRideSeries returns a user's ride series, newest first
+func GetUserRideSeries(ctx context.Context, userID int) ([]RideSeries, error) {
+	query := `SELECT ` + rideSeriesColumns + ` FROM ` + rideSeriesFrom + `
+		WHERE rs.user_id = $1
+		ORDER BY rs.created_at DESC, rs.id DESC`
+	return queryRideSeries(ctx, query, userID)
+}
+
+// GetActiveRideSeries returns the series that still need materializing on or after the given date
+func GetActiveRideSeries(ctx context.Context, from time.Time) ([]RideSeries, error) {
+	query := `SELECT ` + rideSeriesColumns + ` FROM ` + rideSeriesFrom + `
+		WHERE rs.status = 'active'
+		  AND (rs.end_date IS NULL OR rs.end_date >= $1::date)
+		ORDER BY rs.id`
+	return queryRideSeries(ctx, query, from.Format("2006-01-02"))
+}
+
+// CreateRideSeries stores a new active ride series
+func CreateRideSeries(ctx context.Context, s RideSeries) (*RideSeries, error) {
+	var id int
+	err := GetPool().QueryRow(ctx, `
+		INSERT INTO ride_series (user_id, ride_id, days_of_week, ride_time, start_date, end_date, skip_holidays)
+		VALUES ($1, $2, $3, $4::time, $5::date, $6::date, $7)
+		RETURNING id
+	`, s.UserID, s.RideID, s.DaysOfWeek, s.RideTime, s.StartDate.Format("2006-01-02"), formatDate(s.EndDate), s.SkipHolidays).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+	return GetRideSeries(ctx, id)
+}
+
+// UpdateRideSeries changes a series' schedule. Upcoming unpaid rides are
+// removed so the scheduler books them again with the new schedule. Returns
+// the rides withdrawn from their drivers.
+func UpdateRideSeries(ctx context.Context, s RideSeries) (*RideSeries, []WithdrawnRide, error) {
+	var withdrawn []WithdrawnRide
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		status, err := lockRideSeries(ctx, tx, s.ID)
+		if err != nil {
+			return err
+		}
+		if status == RideSeriesCancelled {
+			return ErrSeriesCancelled
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE ride_series
+			SET ride_id = $1, days_of_week = $2, ride_time = $3::time, start_date = $4::date,
+			    end_date = $5::date, skip_holidays = $6, materialized_through = NULL
+			WHERE id = $7
+		`, s.RideID, s.DaysOfWeek, s.RideTime, s.StartDate.Format("2006-01-02"), formatDate(s.EndDate), s.SkipHolidays, s.ID)
+		if err != nil {
+			return err
+		}
+
+		withdrawn, err = removeUpcomingSeriesRides(ctx, tx, s.ID, nil)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := GetRideSeries(ctx, s.ID)
+	return updated, withdrawn, err
+}
+
+// SetRideSeriesStatus pauses, resumes or cancels a series. Pausing and
+// cancelling remove its upcoming unpaid rides; resuming books them again.
+// Returns the rides withdrawn from their drivers.
+func SetRideSeriesStatus(ctx context.Context, id int, status string) (*RideSeries, []WithdrawnRide, error) {
+	var withdrawn []WithdrawnRide
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		current, err := lockRideSeries(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if current == RideSeriesCancelled {
+			return ErrSeriesCancelled
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE ride_series SET status = $1, materialized_through = NULL WHERE id = $2`,
+			status, id,
+		)
+		if err != nil || status == RideSeriesActive {
+			return err
+		}
+
+		withdrawn, err = removeUpcomingSeriesRides(ctx, tx, id, nil)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	updated, err := GetRideSeries(ctx, id)
+	return updated, withdrawn, err
+}
+
+// SkipRideSeriesDate skips a single occurrence of a series and removes its
+// ride if it was already booked and is unpaid. Returns the rides withdrawn
+// from their drivers.
+func SkipRideSeriesDate(ctx context.Context, id int, date time.Time) ([]WithdrawnRide, error) {
+	var withdrawn []WithdrawnRide
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		status, err := lockRideSeries(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if status == RideSeriesCancelled {
+			return ErrSeriesCancelled
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO ride_series_skips (series_id, ride_date)
+			VALUES ($1, $2::date)
+			ON CONFLICT (series_id, ride_date) DO NOTHING
+		`, id, date.Format("2006-01-02"))
+		if err != nil {
+			return err
+		}
+
+		withdrawn, err = removeUpcomingSeriesRides(ctx, tx, id, &date)
+		return err
+	})
+	return withdrawn, err
+}
+
+// GetRideSeriesSkips returns the skipped dates of a series from the given date onwards
+func GetRideSeriesSkips(ctx context.Context, id int, from time.Time) ([]time.Time, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT ride_date FROM ride_series_skips
+		WHERE series_id = $1 AND ride_date >= $2::date
+		ORDER BY ride_date
+	`, id, from.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := []time.Time{}
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, rows.Err()
+}
+
+// GetSeriesBookedDates returns the local dates that already have a ride from the series
+func GetSeriesBookedDates(ctx context.Context, id int, from time.Time) ([]time.Time, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT DISTINCT (scheduled_for AT TIME ZONE current_setting('TimeZone'))::date
+		FROM ride_bills
+		WHERE series_id = $1 AND scheduled_for >= ($2::date)::timestamp AT TIME ZONE current_setting('TimeZone')
+	`, id, from.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := []time.Time{}
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			return nil, err
+		}
+		dates = append(dates, d)
+	}
+	return dates, rows.Err()
+}
+
+// MaterializeRideSeries books the given occurrences of a series as ride bills
+// at the route's current fare, with the student's accessibility needs, and records how far the series is booked.
+// Occurrences that already have a ride are left alone. Returns the number of
+// rides created.
+func MaterializeRideSeries(ctx context.Context, id int, occurrences []time.Time, through time.Time) (int, error) {
+	created := 0
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		created = 0
+		status, err := lockRideSeries(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if status != RideSeriesActive {
+			return nil // Paused or cancelled since it was loaded
+		}
+
+		for _, at := range occurrences {
+			tag, err := tx.Exec(ctx, `
+				INSERT INTO ride_bills (ride_id, user_id, from_location, to_location, fare, status,
+				                        series_id, scheduled_for, accessibility_needs, created_at, updated_at)
+				SELECT rl.id, rs.user_id, rl.from_location, rl.to_location, rl.fare,
+				       CASE WHEN rl.fare > 0 THEN 'pending' ELSE 'paid' END,
+				       rs.id, $2, COALESCE(ap.needs, '{}'), NOW(), NOW()
+				FROM ride_series rs
+				JOIN ride_locations rl ON rl.id = rs.ride_id
+				LEFT JOIN accessibility_profiles ap ON ap.user_id = rs.user_id
+				WHERE rs.id = $1
+				ON CONFLICT (series_id, scheduled_for) WHERE series_id IS NOT NULL DO NOTHING
+			`, id, at)
+			if err != nil {
+				return err
+			}
+			created += int(tag.RowsAffected())
+		}
+
+		_, err = tx.Exec(ctx,
+			`UPDATE ride_series SET materialized_through = $1::date WHERE id = $2`,
+			through.Format("2006-01-02"), id,
+		)
+		return err
+	})
+	return created, err
+}
+
+// lockRideSeries locks a series row and returns its status
+func lockRideSeries(ctx context.Context, tx pgx.Tx, id int) (string, error) {
+	var status string
+	err := tx.QueryRow(ctx, `SELECT status FROM ride_series WHERE id = $1 FOR UPDATE`, id).Scan(&status)
+	if err == pgx.ErrNoRows {
+		return "", ErrSeriesNotFound
+	}
+	return status, err
+}
+
+// WithdrawnRide is an upcoming series ride that was cancelled after a driver
+// had been offered it or had accepted it
+type WithdrawnRide struct {
+	BillID       int
+	DriverID     int
+	DriverName   string
+	DriverEmail  string
+	FromLocation string
+	ToLocation   string
+	RideAt       time.Time
+}
+
+// removeUpcomingSeriesRides removes the series' future rides that are still
+// pending without payments, optionally only those on a single local date.
+// Rides nobody has been dispatched to are deleted. Rides a driver has been
+// offered or has accepted are cancelled instead and returned so the driver
+// can be told; they are detached from the series so their dates can be
+// booked again like deleted rides. Rides that have been paid for are kept.
+func removeUpcomingSeriesRides(ctx context.Context, tx pgx.Tx, id int, date *time.Time) ([]WithdrawnRide, error) {
+	filter := `rb.series_id = $1`
+	args := []interface{}{id}
+	if date != nil {
+		filter += ` AND (rb.scheduled_for AT TIME ZONE current_setting('TimeZone'))::date = $2::date`
+		args = append(args, date.Format("2006-01-02"))
+	}
+	return removeUpcomingRides(ctx, tx, filter, args...)
+}
+
+// removeUpcomingRides removes the future series rides matching filter, a
+// condition on ride_bills rb, like removeUpcomingSeriesRides does
+func removeUpcomingRides(ctx context.Context, tx pgx.Tx, filter string, args ...interface{}) ([]WithdrawnRide, error) {
+	where := `
+		WHERE rb.series_id IS NOT NULL
+		  AND rb.scheduled_for > NOW()
+		  AND rb.status = 'pending'
+		  AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.ride_bill_id = rb.id)
+		  AND ` + filter
+
+	_, err := tx.Exec(ctx, `DELETE FROM ride_bills rb`+where+` AND rb.dispatch_status = 'unassigned'`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		WITH cancelled AS (
+			UPDATE ride_bills rb SET status = 'cancelled', series_id = NULL`+where+`
+			  AND rb.dispatch_status IN ('offered', 'accepted')
+			  AND rb.driver_id IS NOT NULL
+			RETURNING rb.id, rb.driver_id, rb.from_location, rb.to_location, rb.scheduled_for
+		)
+		SELECT c.id, c.driver_id, COALESCE(u.name, u.username, ''), COALESCE(u.email, ''),
+		       c.from_location, c.to_location, c.scheduled_for
+		FROM cancelled c
+		LEFT JOIN users u ON u.id = c.driver_id
+		ORDER BY c.scheduled_for, c.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	withdrawn := []WithdrawnRide{}
+	var billIDs []int
+	for rows.Next() {
+		var w WithdrawnRide
+		err := rows.Scan(&w.BillID, &w.DriverID, &w.DriverName, &w.DriverEmail,
+			&w.FromLocation, &w.ToLocation, &w.RideAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		withdrawn = append(withdrawn, w)
+		billIDs = append(billIDs, w.BillID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(billIDs) == 0 {
+		return withdrawn, nil
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE ride_dispatch_attempts SET outcome = 'overridden', responded_at = NOW()
+		WHERE ride_bill_id = ANY($1) AND outcome = 'offered'
+	`, billIDs)
+	if err != nil {
+		return nil, err
+	}
+	return withdrawn, nil
+}
+
+// formatDate formats an optional date for a DATE parameter
+func formatDate(d *time.Time) *string {
+	if d == nil {
+		return nil
+	}
+	s := d.Format("2006-01-02")
+	return &s
+}
+
+// GetHolidays returns holidays between two dates (inclusive)
+func GetHolidays(ctx context.Context, from, to time.Time) ([]Holiday, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT id, holiday_date, name, created_at
+		FROM holidays
+		WHERE holiday_date BETWEEN $1::date AND $2::date
+		ORDER BY holiday_date
+	`, from.Format("2006-01-02"), to.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holidays := []Holiday{}
+	for rows.Next() {
+		var h Holiday
+		if err := rows.Scan(&h.ID, &h.Date, &h.Name, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+		holidays = append(holidays, h)
+	}
+	return holidays, rows.Err()
+}
+
+// CreateHoliday adds a holiday and removes unpaid rides already booked on it
+// by series that skip holidays. Returns the rides withdrawn from their drivers.
+func CreateHoliday(ctx context.Context, date time.Time, name string) (*Holiday, []WithdrawnRide, error) {
+	var h Holiday
+	var withdrawn []WithdrawnRide
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO holidays (holiday_date, name)
+			VALUES ($1::date, $2)
+			ON CONFLICT (holiday_date) DO NOTHING
+			RETURNING id, holiday_date, name, created_at
+		`, date.Format("2006-01-02"), name).Scan(&h.ID, &h.Date, &h.Name, &h.CreatedAt)
+		if err == pgx.ErrNoRows {
+			return ErrHolidayExists
+		}
+		if err != nil {
+			return err
+		}
+
+		withdrawn, err = removeUpcomingRides(ctx, tx, `
+			rb.series_id IN (SELECT id FROM ride_series WHERE skip_holidays)
+			AND (rb.scheduled_for AT TIME ZONE current_setting('TimeZone'))::date = $1::date`,
+			date.Format("2006-01-02"))
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &h, withdrawn, nil
+}
+
+// DeleteHoliday removes a holiday and lets series that skip holidays book it
+// again. Returns false if it did not exist.
+func DeleteHoliday(ctx context.Context, id int) (bool, error) {
+	deleted := false
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `DELETE FROM holidays WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		deleted = tag.RowsAffected() > 0
+		if !deleted {
+			return nil
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE ride_series SET materialized_through = NULL
+			WHERE skip_holidays AND status = 'active'
+		`)
+		return err
+	})
+	return deleted, err
+}
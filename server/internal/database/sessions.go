@@ -143,6 +143,86 @@ func UpdateSessionLastActive(ctx context.Context, sessionID string) error {
 	return err
 }
 
+// UpdateSessionExpiry records activity on a session and moves its expiry,
+// keeping expires_at in step with the session's TTL in Redis
+func UpdateSessionExpiry(ctx context.Context, sessionID string, expiresAt time.Time) error {
+	query := `UPDATE sessions SET last_active = CURRENT_TIMESTAMP, expires_at = $2 WHERE session_id = $1`
+	_, err := GetPool().Exec(ctx, query, sessionID, expiresAt)
+	return err
+}
+
+// GetActiveSessionIDs returns a page of sessions that have neither expired
+// nor been logged out, ordered by row ID, and the ID to continue after
+func GetActiveSessionIDs(ctx context.Context, afterID, limit int) ([]string, int, error) {
+	query := `
+		SELECT id, session_id FROM sessions
+		WHERE logged_out_at IS NULL AND expires_at > CURRENT_TIMESTAMP AND id > $1
+		ORDER BY id
+		LIMIT $2
+	`
+	rows, err := GetPool().Query(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, afterID, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	lastID := afterID
+	for rows.Next() {
+		var sessionID string
+		if err := rows.Scan(&lastID, &sessionID); err != nil {
+			return nil, afterID, err
+		}
+		ids = append(ids, sessionID)
+	}
+	return ids, lastID, rows.Err()
+}
+
+// GetSessionsLoggedOut reports, for those of the given sessions that have a
+// row, whether they were logged out. Sessions without a row are left out.
+func GetSessionsLoggedOut(ctx context.Context, sessionIDs []string) (map[string]bool, error) {
+	query := `SELECT session_id, logged_out_at IS NOT NULL FROM sessions WHERE session_id = ANY($1)`
+	rows, err := GetPool().Query(ctx, query, sessionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	loggedOut := make(map[string]bool, len(sessionIDs))
+	for rows.Next() {
+		var sessionID string
+		var out bool
+		if err := rows.Scan(&sessionID, &out); err != nil {
+			return nil, err
+		}
+		loggedOut[sessionID] = out
+	}
+	return loggedOut, rows.Err()
+}
+
+// MarkSessionsLoggedOut marks sessions as logged out and returns how many
+// were still open
+func MarkSessionsLoggedOut(ctx context.Context, sessionIDs []string) (int64, error) {
+	query := `UPDATE sessions SET logged_out_at = CURRENT_TIMESTAMP WHERE session_id = ANY($1) AND logged_out_at IS NULL`
+	tag, err := GetPool().Exec(ctx, query, sessionIDs)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RestoreSession stores the row of a session whose metadata was never
+// written at login. Device details are unknown by then.
+func RestoreSession(ctx context.Context, userID int, sessionID string, lastActive, expiresAt time.Time) error {
+	query := `
+		INSERT INTO sessions (user_id, session_id, last_active, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (session_id) DO NOTHING
+	`
+	_, err := GetPool().Exec(ctx, query, userID, sessionID, lastActive, expiresAt)
+	return err
+}
+
 // CleanupExpiredSessions removes expired sessions from database
 func CleanupExpiredSessions(ctx context.Context) (int, error) {
 	query := `SELECT cleanup_expired_sessions()`
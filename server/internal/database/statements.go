@@ -0,0 +1,474 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrStatementNotFound = errors.New("statement not found")
+
+// StatementRide is a ride charged during a statement period
+type StatementRide struct {
+	BillID   int       `json:"billId"`
+	Date     time.Time `json:"date"`
+	From     string    `json:"fromLocation"`
+	To       string    `json:"toLocation"`
+	Driver   *string   `json:"driver"`
+	Distance *float64  `json:"distance"`
+	Fare     float64   `json:"fare"`
+	Status   string    `json:"status"`
+}
+
+// StatementPayment is a ledger entry recorded during a statement period
+type StatementPayment struct {
+	PaymentID int       `json:"paymentId"`
+	BillID    int       `json:"billId"`
+	Date      time.Time `json:"date"`
+	Kind      string    `json:"kind"`
+	Method    string    `json:"method"`
+	Amount    float64   `json:"amount"`
+	Reference *string   `json:"reference"`
+}
+
+// Statement is a student's account activity for one period.
+// Cancelled bills are not charged; payments and refunds always count.
+type Statement struct {
+	UserID           int                `json:"userId"`
+	Name             string             `json:"name"`
+	Email            string             `json:"email"`
+	EnrollmentNumber *string            `json:"enrollmentNumber"`
+	Programme        *string            `json:"programme"`
+	Hostel           *string            `json:"hostel"`
+	PeriodStart      time.Time          `json:"periodStart"`
+	PeriodEnd        time.Time          `json:"periodEnd"` // Exclusive
+	OpeningBalance   float64            `json:"openingBalance"`
+	TotalCharges     float64            `json:"totalCharges"`
+	TotalPayments    float64            `json:"totalPayments"`
+	TotalRefunds     float64            `json:"totalRefunds"`
+	ClosingBalance   float64            `json:"closingBalance"`
+	Rides            []StatementRide    `json:"rides"`
+	Payments         []StatementPayment `json:"payments"`
+}
+
+// IsEmpty reports whether the statement has no balance and no activity
+func (s *Statement) IsEmpty() bool {
+	return s.OpeningBalance == 0 && len(s.Rides) == 0 && len(s.Payments) == 0
+}
+
+// RideStatement is a generated statement with its invoice number and file
+type RideStatement struct {
+	ID             int        `json:"id"`
+	UserID         int        `json:"userId"`
+	PeriodStart    time.Time  `json:"periodStart"`
+	InvoiceNumber  string     `json:"invoiceNumber"`
+	OpeningBalance float64    `json:"openingBalance"`
+	TotalCharges   float64    `json:"totalCharges"`
+	TotalPayments  float64    `json:"totalPayments"`
+	TotalRefunds   float64    `json:"totalRefunds"`
+	ClosingBalance float64    `json:"closingBalance"`
+	RideCount      int        `json:"rideCount"`
+	FileName       *string    `json:"fileName"`
+	FileURL        *string    `json:"fileUrl"`
+	EmailedAt      *time.Time `json:"emailedAt"`
+	EmailError     *string    `json:"emailError"`
+	GeneratedAt    *time.Time `json:"generatedAt"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+}
+
+// StatementRun tracks a bulk statement generation job
+type StatementRun struct {
+	ID             int        `json:"id"`
+	PeriodStart    time.Time  `json:"periodStart"`
+	Trigger        string     `json:"trigger"`
+	SendEmail      bool       `json:"sendEmail"`
+	Status         string     `json:"status"`
+	TotalStudents  int        `json:"totalStudents"`
+	GeneratedCount int        `json:"generatedCount"`
+	EmailedCount   int        `json:"emailedCount"`
+	FailedCount    int        `json:"failedCount"`
+	ErrorMessage   *string    `json:"errorMessage"`
+	StartedBy      *int       `json:"startedBy"`
+	StartedAt      time.Time  `json:"startedAt"`
+	FinishedAt     *time.Time `json:"finishedAt"`
+}
+
+// ClosingBalance computes the amount owed at the end of a period
+func ClosingBalance(opening, charges, payments, refunds float64) float64 {
+	return RoundCents(opening + charges - payments + refunds)
+}
+
+// FormatInvoiceNumber formats a sequential invoice number, e.g. INV-2026-000042
+func FormatInvoiceNumber(prefix string, year, number int) string {
+	return fmt.Sprintf("%s-%d-%06d", prefix, year, number)
+}
+
+// BuildStatement collects a student's rides and ledger entries in [periodStart, periodEnd)
+func BuildStatement(ctx context.Context, userID int, periodStart, periodEnd time.Time) (*Statement, error) {
+	st := Statement{
+		UserID:      userID,
+		PeriodStart: periodStart,
+		PeriodEnd:   periodEnd,
+		Rides:       []StatementRide{},
+		Payments:    []StatementPayment{},
+	}
+
+	err := GetPool().QueryRow(ctx, `
+		SELECT COALESCE(name, username), email, enrollment_number, programme, hostel
+		FROM users WHERE id = $1
+	`, userID).Scan(&st.Name, &st.Email, &st.EnrollmentNumber, &st.Programme, &st.Hostel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Opening balance: charges before the period minus net payments before the period
+	err = GetPool().QueryRow(ctx, `
+		SELECT
+			COALESCE((SELECT SUM(fare) FROM ride_bills
+			          WHERE user_id = $1 AND status <> 'cancelled' AND created_at < $2), 0)
+			-
+			COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END)
+			          FROM payments p JOIN ride_bills rb ON rb.id = p.ride_bill_id
+			          WHERE rb.user_id = $1 AND p.paid_at < $2), 0)
+	`, userID, periodStart).Scan(&st.OpeningBalance)
+	if err != nil {
+		return nil, err
+	}
+	st.OpeningBalance = RoundCents(st.OpeningBalance)
+
+	rows, err := GetPool().Query(ctx, `
+		SELECT id, created_at, from_location, to_location, driver, distance, fare, status
+		FROM ride_bills
+		WHERE user_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at ASC, id ASC
+	`, userID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var r StatementRide
+		if err := rows.Scan(&r.BillID, &r.Date, &r.From, &r.To, &r.Driver, &r.Distance, &r.Fare, &r.Status); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if r.Status != "cancelled" {
+			st.TotalCharges += r.Fare
+		}
+		st.Rides = append(st.Rides, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = GetPool().Query(ctx, `
+		SELECT p.id, p.ride_bill_id, p.paid_at, p.kind, p.method, p.amount, p.reference
+		FROM payments p
+		JOIN ride_bills rb ON rb.id = p.ride_bill_id
+		WHERE rb.user_id = $1 AND p.paid_at >= $2 AND p.paid_at < $3
+		ORDER BY p.paid_at ASC, p.id ASC
+	`, userID, periodStart, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var p StatementPayment
+		if err := rows.Scan(&p.PaymentID, &p.BillID, &p.Date, &p.Kind, &p.Method, &p.Amount, &p.Reference); err != nil {
+			return nil, err
+		}
+		if p.Kind == PaymentKindRefund {
+			st.TotalRefunds += p.Amount
+		} else {
+			st.TotalPayments += p.Amount
+		}
+		st.Payments = append(st.Payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	st.TotalCharges = RoundCents(st.TotalCharges)
+	st.TotalPayments = RoundCents(st.TotalPayments)
+	st.TotalRefunds = RoundCents(st.TotalRefunds)
+	st.ClosingBalance = ClosingBalance(st.OpeningBalance, st.TotalCharges, st.TotalPayments, st.TotalRefunds)
+	return &st, nil
+}
+
+const rideStatementColumns = `id, user_id, period_start, invoice_number, opening_balance, total_charges,
+	total_payments, total_refunds, closing_balance, ride_count, file_name, file_url,
+	emailed_at, email_error, generated_at, created_at, updated_at`
+
+// scanRideStatement scans a row selected with rideStatementColumns
+func scanRideStatement(row pgx.Row) (*RideStatement, error) {
+	var s RideStatement
+	err := row.Scan(
+		&s.ID, &s.UserID, &s.PeriodStart, &s.InvoiceNumber, &s.OpeningBalance, &s.TotalCharges,
+		&s.TotalPayments, &s.TotalRefunds, &s.ClosingBalance, &s.RideCount, &s.FileName, &s.FileURL,
+		&s.EmailedAt, &s.EmailError, &s.GeneratedAt, &s.CreatedAt, &s.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ReserveStatement returns the statement row for a student and period,
+// allocating the next invoice number the first time. Regenerating a statement
+// keeps its invoice number.
+func ReserveStatement(ctx context.Context, userID int, periodStart time.Time, invoicePrefix string) (*RideStatement, error) {
+	var statement *RideStatement
+	period := periodStart.Format("2006-01-02")
+
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		// Serialize reservations for the same student
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(28, $1)`, userID); err != nil {
+			return err
+		}
+
+		var err error
+		statement, err = scanRideStatement(tx.QueryRow(ctx,
+			`SELECT `+rideStatementColumns+` FROM ride_statements WHERE user_id = $1 AND period_start = $2::date`,
+			userID, period))
+		if err != pgx.ErrNoRows {
+			return err
+		}
+
+		year := periodStart.Year()
+		var number int
+		err = tx.QueryRow(ctx, `
+			INSERT INTO invoice_counters (year, last_number) VALUES ($1, 1)
+			ON CONFLICT (year) DO UPDATE SET last_number = invoice_counters.last_number + 1
+			RETURNING last_number
+		`, year).Scan(&number)
+		if err != nil {
+			return err
+		}
+
+		statement, err = scanRideStatement(tx.QueryRow(ctx, `
+			INSERT INTO ride_statements (user_id, period_start, invoice_number)
+			VALUES ($1, $2::date, $3)
+			RETURNING `+rideStatementColumns,
+			userID, period, FormatInvoiceNumber(invoicePrefix, year, number)))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return statement, nil
+}
+
+// CompleteStatement stores the totals and file of a generated statement
+func CompleteStatement(ctx context.Context, statementID int, st *Statement, fileName, fileURL string) (*RideStatement, error) {
+	return scanRideStatement(GetPool().QueryRow(ctx, `
+		UPDATE ride_statements
+		SET opening_balance = $1, total_charges = $2, total_payments = $3, total_refunds = $4,
+		    closing_balance = $5, ride_count = $6, file_name = $7, file_url = $8, generated_at = CURRENT_TIMESTAMP
+		WHERE id = $9
+		RETURNING `+rideStatementColumns,
+		st.OpeningBalance, st.TotalCharges, st.TotalPayments, st.TotalRefunds,
+		st.ClosingBalance, len(st.Rides), fileName, fileURL, statementID))
+}
+
+// MarkStatementEmailed records the result of emailing a statement
+func MarkStatementEmailed(ctx context.Context, statementID int, emailErr error) error {
+	if emailErr != nil {
+		_, err := GetPool().Exec(ctx, `UPDATE ride_statements SET email_error = $1 WHERE id = $2`, emailErr.Error(), statementID)
+		return err
+	}
+	_, err := GetPool().Exec(ctx,
+		`UPDATE ride_statements SET emailed_at = CURRENT_TIMESTAMP, email_error = NULL WHERE id = $1`, statementID)
+	return err
+}
+
+// GetUserStatements returns a student's generated statements, newest first
+func GetUserStatements(ctx context.Context, userID int) ([]RideStatement, error) {
+	rows, err := GetPool().Query(ctx,
+		`SELECT `+rideStatementColumns+` FROM ride_statements WHERE user_id = $1 ORDER BY period_start DESC`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []RideStatement{}
+	for rows.Next() {
+		s, err := scanRideStatement(rows)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, *s)
+	}
+	return statements, rows.Err()
+}
+
+// GetUserStatement returns a student's generated statement for a period
+func GetUserStatement(ctx context.Context, userID int, periodStart time.Time) (*RideStatement, error) {
+	s, err := scanRideStatement(GetPool().QueryRow(ctx,
+		`SELECT `+rideStatementColumns+` FROM ride_statements WHERE user_id = $1 AND period_start = $2::date`,
+		userID, periodStart.Format("2006-01-02")))
+	if err == pgx.ErrNoRows {
+		return nil, ErrStatementNotFound
+	}
+	return s, err
+}
+
+// GetStatementRecipients returns the students with ride bills created before periodEnd
+func GetStatementRecipients(ctx context.Context, periodEnd time.Time) ([]int, error) {
+	rows, err := GetPool().Query(ctx, `
+		SELECT DISTINCT rb.user_id
+		FROM ride_bills rb
+		JOIN users u ON u.id = rb.user_id
+		WHERE rb.created_at < $1
+		ORDER BY rb.user_id
+	`, periodEnd)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var userIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIDs = append(userIDs, id)
+	}
+	return userIDs, rows.Err()
+}
+
+const statementRunColumns = `id, period_start, trigger, send_email, status, total_students,
+	generated_count, emailed_count, failed_count, error_message, started_by, started_at, finished_at`
+
+// scanStatementRun scans a row selected with statementRunColumns
+func scanStatementRun(row pgx.Row) (*StatementRun, error) {
+	var r StatementRun
+	err := row.Scan(
+		&r.ID, &r.PeriodStart, &r.Trigger, &r.SendEmail, &r.Status, &r.TotalStudents,
+		&r.GeneratedCount, &r.EmailedCount, &r.FailedCount, &r.ErrorMessage, &r.StartedBy, &r.StartedAt, &r.FinishedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// CreateStatementRun records the start of a bulk generation run. For scheduled
+// runs it returns nil when the period has already been scheduled.
+func CreateStatementRun(ctx context.Context, periodStart time.Time, trigger string, sendEmail bool, startedBy *int) (*StatementRun, error) {
+	run, err := scanStatementRun(GetPool().QueryRow(ctx, `
+		INSERT INTO ride_statement_runs (period_start, trigger, send_email, started_by)
+		VALUES ($1::date, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+		RETURNING `+statementRunColumns,
+		periodStart.Format("2006-01-02"), trigger, sendEmail, startedBy))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// UpdateStatementRunProgress stores the counters of a running job, showing
+// it is still alive
+func UpdateStatementRunProgress(ctx context.Context, runID, total, generated, emailed, failed int) error {
+	_, err := GetPool().Exec(ctx, `
+		UPDATE ride_statement_runs
+		SET total_students = $1, generated_count = $2, emailed_count = $3, failed_count = $4,
+		    heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, total, generated, emailed, failed, runID)
+	return err
+}
+
+// ResumeStatementRun takes over the scheduled run for a period if it is still
+// running but has made no progress for staleAfter, which means the server
+// running it stopped. Returns nil when there is no such run.
+func ResumeStatementRun(ctx context.Context, periodStart time.Time, staleAfter time.Duration) (*StatementRun, error) {
+	run, err := scanStatementRun(GetPool().QueryRow(ctx, `
+		UPDATE ride_statement_runs
+		SET heartbeat_at = CURRENT_TIMESTAMP
+		WHERE period_start = $1::date AND trigger = 'scheduled' AND status = 'running'
+		  AND COALESCE(heartbeat_at, started_at) < CURRENT_TIMESTAMP - make_interval(secs => $2)
+		RETURNING `+statementRunColumns,
+		periodStart.Format("2006-01-02"), staleAfter.Seconds()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return run, err
+}
+
+// FailStaleStatementRuns marks runs of a period that have made no progress
+// for staleAfter as failed, so they no longer block new runs
+func FailStaleStatementRuns(ctx context.Context, periodStart time.Time, staleAfter time.Duration) (int64, error) {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE ride_statement_runs
+		SET status = 'failed', error_message = 'interrupted before finishing', finished_at = CURRENT_TIMESTAMP
+		WHERE period_start = $1::date AND status = 'running'
+		  AND COALESCE(heartbeat_at, started_at) < CURRENT_TIMESTAMP - make_interval(secs => $2)
+	`, periodStart.Format("2006-01-02"), staleAfter.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// FinishStatementRun marks a run as completed or failed
+func FinishStatementRun(ctx context.Context, runID int, runErr error) error {
+	status := "completed"
+	var errorMessage *string
+	if runErr != nil {
+		status = "failed"
+		msg := runErr.Error()
+		errorMessage = &msg
+	}
+	_, err := GetPool().Exec(ctx, `
+		UPDATE ride_statement_runs
+		SET status = $1, error_message = $2, finished_at = CURRENT_TIMESTAMP
+		WHERE id = $3
+	`, status, errorMessage, runID)
+	return err
+}
+
+// GetStatementRuns returns the most recent bulk generation runs
+func GetStatementRuns(ctx context.Context, limit int) ([]StatementRun, error) {
+	rows, err := GetPool().Query(ctx,
+		`SELECT `+statementRunColumns+` FROM ride_statement_runs ORDER BY started_at DESC LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []StatementRun{}
+	for rows.Next() {
+		r, err := scanStatementRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *r)
+	}
+	return runs, rows.Err()
+}
+
+// GetStatementRun returns a bulk generation run by ID
+func GetStatementRun(ctx context.Context, runID int) (*StatementRun, error) {
+	run, err := scanStatementRun(GetPool().QueryRow(ctx,
+		`SELECT `+statementRunColumns+` FROM ride_statement_runs WHERE id = $1`, runID))
+	if err == pgx.ErrNoRows {
+		return nil, ErrStatementNotFound
+	}
+	return run, err
+}
+
+// HasRunningStatementRun reports whether a bulk run for the period is in progress
+func HasRunningStatementRun(ctx context.Context, periodStart time.Time) (bool, error) {
+	var running bool
+	err := GetPool().QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM ride_statement_runs WHERE period_start = $1::date AND status = 'running')
+	`, periodStart.Format("2006-01-02")).Scan(&running)
+	return running, err
+}
@@ -0,0 +1,157 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Account statuses of a user. Only active users can sign in.
+const (
+	UserActive    = "active"
+	UserSuspended = "suspended"
+	UserPending   = "pending"   // Awaiting approval
+	UserGraduated = "graduated" // A student who finished their programme
+	UserExpired   = "expired"   // A student past their expiry date
+	UserInactive  = "inactive"  // Older name for suspended
+	UserClosed    = "closed"
+)
+
+// ValidUserStatuses are the statuses a user can be given
+var ValidUserStatuses = map[string]bool{
+	UserActive:    true,
+	UserSuspended: true,
+	UserPending:   true,
+	UserGraduated: true,
+	UserExpired:   true,
+	UserInactive:  true,
+	UserClosed:    true,
+}
+
+// IsStudentRole reports whether users with the role are students, who have
+// an expiry date. It matches ineligibleRolesSQL.
+func IsStudentRole(role string) bool {
+	switch strings.ToLower(role) {
+	case "admin", "superadmin", "driver":
+		return false
+	}
+	return true
+}
+
+// Outcomes of a user of a bulk reactivation
+const (
+	ReactivateReactivated   = "reactivated"
+	ReactivateAlreadyActive = "already_active"
+	ReactivateNotFound      = "not_found"
+	ReactivateIneligible    = "ineligible"    // SuperAdmin statuses can't be changed
+	ReactivateExpiryPassed  = "expiry_passed" // A student needs a new expiry date
+)
+
+// ReactivateResult is the outcome of reactivating one user
+type ReactivateResult struct {
+	UserID         int
+	Status         string
+	PreviousStatus string
+}
+
+// ExpireStudentAccounts moves active students whose expiry date is before
+// today to the expired status and returns their ids
+func ExpireStudentAccounts(ctx context.Context, today time.Time) ([]int, error) {
+	query := `
+		UPDATE users SET status = '` + UserExpired + `', updated_at = CURRENT_TIMESTAMP
+		WHERE COALESCE(status, 'active') = 'active'
+		  AND expiry_date < $1::date
+		  AND LOWER(role) NOT IN ` + ineligibleRolesSQL + `
+		RETURNING id
+	`
+	rows, err := GetPool().Query(ctx, query, today.Format("2006-01-02"))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// ReactivateUsers makes users active again in one transaction. A new expiry
+// date, if given, is set for the students among them; a student whose
+// expiry date is before today is left alone, since they would expire again.
+func ReactivateUsers(ctx context.Context, userIDs []int, expiryDate *time.Time, today time.Time) ([]ReactivateResult, error) {
+	var expiry *string
+	if expiryDate != nil {
+		date := expiryDate.Format("2006-01-02")
+		expiry = &date
+	}
+	todayDate := today.Format("2006-01-02")
+
+	results := make([]ReactivateResult, 0, len(userIDs))
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		seen := make(map[int]bool, len(userIDs))
+		for _, id := range userIDs {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+
+			result := ReactivateResult{UserID: id}
+			var role string
+			var student bool
+			var currentExpiry *time.Time
+			err := tx.QueryRow(ctx, `
+				SELECT LOWER(role), LOWER(role) NOT IN `+ineligibleRolesSQL+`, COALESCE(status, 'active'), expiry_date
+				FROM users WHERE id = $1 FOR UPDATE
+			`, id).Scan(&role, &student, &result.PreviousStatus, &currentExpiry)
+			if err == pgx.ErrNoRows {
+				result.Status = ReactivateNotFound
+				results = append(results, result)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			newExpiry := expiry
+			if !student {
+				newExpiry = nil
+			} else if newExpiry == nil && currentExpiry != nil {
+				current := currentExpiry.Format("2006-01-02")
+				newExpiry = &current
+			}
+
+			switch {
+			case role == "superadmin":
+				result.Status = ReactivateIneligible
+			case student && newExpiry != nil && *newExpiry < todayDate:
+				result.Status = ReactivateExpiryPassed
+			case result.PreviousStatus == UserActive && (expiry == nil || !student):
+				result.Status = ReactivateAlreadyActive
+			default:
+				_, err := tx.Exec(ctx, `
+					UPDATE users
+					SET status = '`+UserActive+`', expiry_date = COALESCE($2::date, expiry_date), updated_at = CURRENT_TIMESTAMP
+					WHERE id = $1
+				`, id, newExpiry)
+				if err != nil {
+					return err
+				}
+				result.Status = ReactivateReactivated
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
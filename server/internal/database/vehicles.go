@@ -0,0 +1,399 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Valid vehicle statuses. Only active vehicles serve rides.
+var ValidVehicleStatuses = map[string]bool{
+	"active":      true,
+	"maintenance": true,
+	"retired":     true,
+}
+
+var (
+	ErrVehicleNotFound    = errors.New("vehicle not found")
+	ErrVehicleExists      = errors.New("a vehicle with this registration number already exists")
+	ErrVehicleInUse       = errors.New("vehicle has served rides. Retire it instead")
+	ErrVehicleInactive    = errors.New("vehicle is not active")
+	ErrAssignmentNotFound = errors.New("vehicle assignment not found")
+)
+
+// Vehicle is a fleet vehicle
+type Vehicle struct {
+	ID                    int        `json:"id"`
+	RegistrationNumber    string     `json:"registrationNumber"`
+	VehicleType           *string    `json:"vehicleType"`
+	Capacity              int        `json:"capacity"`
+	AccessibilityFeatures []string   `json:"accessibilityFeatures"`
+	InsuranceExpiry       *time.Time `json:"insuranceExpiry"`
+	FitnessExpiry         *time.Time `json:"fitnessExpiry"`
+	Status                string     `json:"status"`
+	Notes                 *string    `json:"notes"`
+	CurrentDrivers        []int32    `json:"currentDrivers"`
+	CreatedAt             time.Time  `json:"createdAt"`
+	UpdatedAt             time.Time  `json:"updatedAt"`
+}
+
+// VehicleAssignment is a period during which a driver drives a vehicle
+type VehicleAssignment struct {
+	ID                 int        `json:"id"`
+	DriverID           int        `json:"driverId"`
+	DriverName         string     `json:"driverName"`
+	VehicleID          int        `json:"vehicleId"`
+	RegistrationNumber string     `json:"registrationNumber"`
+	StartsAt           time.Time  `json:"startsAt"`
+	EndsAt             *time.Time `json:"endsAt"`
+	AssignedBy         *int       `json:"assignedBy"`
+}
+
+// Document expiry warnings returned by VehicleDocumentIssues
+const (
+	VehicleInsuranceExpired  = "insurance_expired"
+	VehicleInsuranceExpiring = "insurance_expiring"
+	VehicleFitnessExpired    = "fitness_expired"
+	VehicleFitnessExpiring   = "fitness_expiring"
+)
+
+// vehicleExpiryWarning is how far ahead expiring documents are flagged
+const vehicleExpiryWarning = 30 * 24 * time.Hour
+
+var registrationSpaces = regexp.MustCompile(`\s+`)
+
+// NormalizeRegistration uppercases a registration number and removes spaces
+func NormalizeRegistration(registration string) string {
+	return strings.ToUpper(registrationSpaces.ReplaceAllString(registration, ""))
+}
+
+// VehicleDocumentIssues lists expired or soon expiring vehicle documents
+func VehicleDocumentIssues(v Vehicle, now time.Time) []string {
+	issues := []string{}
+	check := func(expiry *time.Time, expired, expiring string) {
+		if expiry == nil {
+			return
+		}
+		// Documents are valid through their expiry date
+		end := expiry.AddDate(0, 0, 1)
+		if !now.Before(end) {
+			issues = append(issues, expired)
+		} else if end.Sub(now) <= vehicleExpiryWarning {
+			issues = append(issues, expiring)
+		}
+	}
+	check(v.InsuranceExpiry, VehicleInsuranceExpired, VehicleInsuranceExpiring)
+	check(v.FitnessExpiry, VehicleFitnessExpired, VehicleFitnessExpiring)
+	return issues
+}
+
+const vehicleColumns = `v.id, v.registration_number, v.vehicle_type, v.capacity, v.accessibility_features,
+	v.insurance_expiry, v.fitness_expiry, v.status, v.notes,
+	ARRAY(SELECT a.driver_id FROM driver_vehicle_assignments a WHERE a.vehicle_id = v.id AND a.ends_at IS NULL ORDER BY a.starts_at),
+	v.created_at, v.updated_at`
+
+// scanVehicle scans a row selected with vehicleColumns
+func scanVehicle(row pgx.Row) (*Vehicle, error) {
+	var v Vehicle
+	err := row.Scan(
+		&v.ID, &v.RegistrationNumber, &v.VehicleType, &v.Capacity, &v.AccessibilityFeatures,
+		&v.InsuranceExpiry, &v.FitnessExpiry, &v.Status, &v.Notes,
+		&v.CurrentDrivers, &v.CreatedAt, &v.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// isUniqueViolation reports whether err is a unique constraint violation
+func isUniqueViolation(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "duplicate key") || strings.Contains(err.Error(), "unique constraint"))
+}
+
+// GetVehicles returns vehicles, optionally filtered by status and a
+// registration or type search
+func GetVehicles(ctx context.Context, status, search string) ([]Vehicle, error) {
+	query := `SELECT ` + vehicleColumns + ` FROM vehicles v WHERE 1=1`
+	var args []interface{}
+	if status != "" && status != "all" {
+		args = append(args, status)
+		query += ` AND v.status = $` + strconv.Itoa(len(args))
+	}
+	if search != "" {
+		args = append(args, "%"+search+"%")
+		query += ` AND (v.registration_number ILIKE $` + strconv.Itoa(len(args)) +
+			` OR v.vehicle_type ILIKE $` + strconv.Itoa(len(args)) + `)`
+	}
+	query += ` ORDER BY v.registration_number`
+
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vehicles := []Vehicle{}
+	for rows.Next() {
+		v, err := scanVehicle(rows)
+		if err != nil {
+			return nil, err
+		}
+		vehicles = append(vehicles, *v)
+	}
+	return vehicles, rows.Err()
+}
+
+// GetVehicle returns a vehicle by ID
+func GetVehicle(ctx context.Context, id int) (*Vehicle, error) {
+	v, err := scanVehicle(GetPool().QueryRow(ctx, `SELECT `+vehicleColumns+` FROM vehicles v WHERE v.id = $1`, id))
+	if err == pgx.ErrNoRows {
+		return nil, ErrVehicleNotFound
+	}
+	return v, err
+}
+
+// CreateVehicle adds a vehicle to the fleet
+func CreateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error) {
+	var id int
+	err := GetPool().QueryRow(ctx, `
+		INSERT INTO vehicles (registration_number, vehicle_type, capacity, accessibility_features,
+		                      insurance_expiry, fitness_expiry, status, notes)
+		VALUES ($1, $2, $3, $4, $5::date, $6::date, $7, $8)
+		RETURNING id
+	`, NormalizeRegistration(v.RegistrationNumber), v.VehicleType, v.Capacity, v.AccessibilityFeatures,
+		formatDate(v.InsuranceExpiry), formatDate(v.FitnessExpiry), v.Status, v.Notes,
+	).Scan(&id)
+	if isUniqueViolation(err) {
+		return nil, ErrVehicleExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	return GetVehicle(ctx, id)
+}
+
+// UpdateVehicle saves all editable fields of a vehicle. Retiring a vehicle
+// ends its current driver assignments.
+func UpdateVehicle(ctx context.Context, v Vehicle) (*Vehicle, error) {
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, `
+			UPDATE vehicles
+			SET registration_number = $1, vehicle_type = $2, capacity = $3, accessibility_features = $4,
+			    insurance_expiry = $5::date, fitness_expiry = $6::date, status = $7, notes = $8
+			WHERE id = $9
+		`, NormalizeRegistration(v.RegistrationNumber), v.VehicleType, v.Capacity, v.AccessibilityFeatures,
+			formatDate(v.InsuranceExpiry), formatDate(v.FitnessExpiry), v.Status, v.Notes, v.ID,
+		)
+		if isUniqueViolation(err) {
+			return ErrVehicleExists
+		}
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrVehicleNotFound
+		}
+
+		if v.Status == "retired" {
+			_, err = tx.Exec(ctx, `
+				UPDATE driver_vehicle_assignments SET ends_at = NOW()
+				WHERE vehicle_id = $1 AND ends_at IS NULL
+			`, v.ID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetVehicle(ctx, v.ID)
+}
+
+// DeleteVehicle removes a vehicle that never served a ride
+func DeleteVehicle(ctx context.Context, id int) error {
+	var served bool
+	err := GetPool().QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM ride_bills WHERE vehicle_id = $1)`, id).Scan(&served)
+	if err != nil {
+		return err
+	}
+	if served {
+		return ErrVehicleInUse
+	}
+
+	tag, err := GetPool().Exec(ctx, `DELETE FROM vehicles WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+const vehicleAssignmentColumns = `a.id, a.driver_id, COALESCE(u.name, u.username), a.vehicle_id, v.registration_number,
+	a.starts_at, a.ends_at, a.assigned_by`
+
+const vehicleAssignmentFrom = `driver_vehicle_assignments a
+	JOIN users u ON u.id = a.driver_id
+	JOIN vehicles v ON v.id = a.vehicle_id`
+
+// queryVehicleAssignments runs a query selecting vehicleAssignmentColumns
+func queryVehicleAssignments(ctx context.Context, query string, args ...interface{}) ([]VehicleAssignment, error) {
+	rows, err := GetPool().Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []VehicleAssignment{}
+	for rows.Next() {
+		var a VehicleAssignment
+		err := rows.Scan(&a.ID, &a.DriverID, &a.DriverName, &a.VehicleID, &a.RegistrationNumber,
+			&a.StartsAt, &a.EndsAt, &a.AssignedBy)
+		if err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	return assignments, rows.Err()
+}
+
+// GetVehicleAssignments returns the driver assignment history of a vehicle, newest first
+func GetVehicleAssignments(ctx context.Context, vehicleID int) ([]VehicleAssignment, error) {
+	query := `SELECT ` + vehicleAssignmentColumns + ` FROM ` + vehicleAssignmentFrom + `
+		WHERE a.vehicle_id = $1
+		ORDER BY a.starts_at DESC, a.id DESC`
+	return queryVehicleAssignments(ctx, query, vehicleID)
+}
+
+// GetDriverAssignments returns the vehicle assignment history of a driver, newest first
+func GetDriverAssignments(ctx context.Context, driverID int) ([]VehicleAssignment, error) {
+	query := `SELECT ` + vehicleAssignmentColumns + ` FROM ` + vehicleAssignmentFrom + `
+		WHERE a.driver_id = $1
+		ORDER BY a.starts_at DESC, a.id DESC`
+	return queryVehicleAssignments(ctx, query, driverID)
+}
+
+// AssignVehicle makes a vehicle the driver's current vehicle, ending their
+// previous assignment. Other drivers sharing the vehicle are not affected.
+func AssignVehicle(ctx context.Context, vehicleID, driverID int, assignedBy *int) (*VehicleAssignment, error) {
+	var assignmentID int
+	err := WithTransaction(ctx, func(tx pgx.Tx) error {
+		var status string
+		err := tx.QueryRow(ctx, `SELECT status FROM vehicles WHERE id = $1 FOR UPDATE`, vehicleID).Scan(&status)
+		if err == pgx.ErrNoRows {
+			return ErrVehicleNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if status != "active" {
+			return ErrVehicleInactive
+		}
+
+		var isDriver bool
+		err = tx.QueryRow(ctx, `SELECT LOWER(role) = 'driver' FROM users WHERE id = $1 FOR UPDATE`, driverID).Scan(&isDriver)
+		if err == pgx.ErrNoRows || (err == nil && !isDriver) {
+			return ErrDriverNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE driver_vehicle_assignments SET ends_at = NOW()
+			WHERE driver_id = $1 AND ends_at IS NULL
+		`, driverID)
+		if err != nil {
+			return err
+		}
+
+		return tx.QueryRow(ctx, `
+			INSERT INTO driver_vehicle_assignments (driver_id, vehicle_id, assigned_by)
+			VALUES ($1, $2, $3)
+			RETURNING id
+		`, driverID, vehicleID, assignedBy).Scan(&assignmentID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	assignments, err := queryVehicleAssignments(ctx,
+		`SELECT `+vehicleAssignmentColumns+` FROM `+vehicleAssignmentFrom+` WHERE a.id = $1`, assignmentID)
+	if err != nil {
+		return nil, err
+	}
+	if len(assignments) == 0 {
+		return nil, ErrAssignmentNotFound
+	}
+	return &assignments[0], nil
+}
+
+// EndVehicleAssignment ends a current assignment of a vehicle
+func EndVehicleAssignment(ctx context.Context, vehicleID, assignmentID int) error {
+	tag, err := GetPool().Exec(ctx, `
+		UPDATE driver_vehicle_assignments SET ends_at = NOW()
+		WHERE id = $1 AND vehicle_id = $2 AND ends_at IS NULL
+	`, assignmentID, vehicleID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAssignmentNotFound
+	}
+	return nil
+}
+
+// SetDriverVehicle applies the vehicle number and type given on a driver's
+// user record to the fleet. A number makes that vehicle, created if needed,
+// the driver's current vehicle; a type alone changes the type of their
+// current vehicle.
+func SetDriverVehicle(ctx context.Context, driverID int, registration, vehicleType *string) error {
+	if registration == nil || NormalizeRegistration(*registration) == "" {
+		if vehicleType == nil {
+			return nil
+		}
+		_, err := GetPool().Exec(ctx, `
+			UPDATE vehicles SET vehicle_type = NULLIF(TRIM($2), '')
+			WHERE id = (
+				SELECT vehicle_id FROM driver_vehicle_assignments
+				WHERE driver_id = $1 AND ends_at IS NULL
+			)
+		`, driverID, *vehicleType)
+		return err
+	}
+
+	var vehicleID int
+	err := GetPool().QueryRow(ctx, `
+		INSERT INTO vehicles (registration_number, vehicle_type)
+		VALUES ($1, NULLIF(TRIM($2), ''))
+		ON CONFLICT (registration_number) DO UPDATE
+		SET vehicle_type = COALESCE(NULLIF(TRIM($2), ''), vehicles.vehicle_type)
+		RETURNING id
+	`, NormalizeRegistration(*registration), vehicleType).Scan(&vehicleID)
+	if err != nil {
+		return err
+	}
+
+	var current bool
+	err = GetPool().QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM driver_vehicle_assignments
+			WHERE driver_id = $1 AND vehicle_id = $2 AND ends_at IS NULL
+		)
+	`, driverID, vehicleID).Scan(&current)
+	if err != nil || current {
+		return err
+	}
+
+	_, err = AssignVehicle(ctx, vehicleID, driverID, nil)
+	if err == ErrDriverNotFound || err == ErrVehicleInactive {
+		return nil // Not a driver, or the vehicle is out of service
+	}
+	return err
+}
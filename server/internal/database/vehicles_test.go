@@ -0,0 +1,55 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNormalizeRegistration(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"DL 01 AB 1234", "DL01AB1234"},
+		{" ka05mn 9876 ", "KA05MN9876"},
+		{"MH\t12\nXY 1", "MH12XY1"},
+		{"   ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeRegistration(tt.input); got != tt.expected {
+			t.Errorf("NormalizeRegistration(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestVehicleDocumentIssues(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	date := func(y int, m time.Month, d int) *time.Time {
+		t := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+		return &t
+	}
+
+	tests := []struct {
+		name     string
+		vehicle  Vehicle
+		expected []string
+	}{
+		{"no dates", Vehicle{}, []string{}},
+		{"valid", Vehicle{InsuranceExpiry: date(2025, 12, 31), FitnessExpiry: date(2026, 1, 1)}, []string{}},
+		{"expires today is still valid", Vehicle{InsuranceExpiry: date(2025, 3, 10)}, []string{VehicleInsuranceExpiring}},
+		{"expired yesterday", Vehicle{InsuranceExpiry: date(2025, 3, 9)}, []string{VehicleInsuranceExpired}},
+		{"fitness expiring", Vehicle{FitnessExpiry: date(2025, 4, 1)}, []string{VehicleFitnessExpiring}},
+		{"both", Vehicle{InsuranceExpiry: date(2024, 1, 1), FitnessExpiry: date(2025, 3, 20)},
+			[]string{VehicleInsuranceExpired, VehicleFitnessExpiring}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VehicleDocumentIssues(tt.vehicle, now); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("VehicleDocumentIssues = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package dispatch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+)
+
+// staleRideWindow is how long after its ride time an unassigned ride is
+// still dispatched. Older rides are left for admins.
+const staleRideWindow = 2 * time.Hour
+
+// Dispatch offers a ride waiting for a driver to the best available driver.
+// Returns nil without error when no driver is available; the ride stays
+// unassigned and is retried on the next dispatcher run.
+func Dispatch(ctx context.Context, billID int) (*database.DriverMatch, error) {
+	ride, err := database.GetDispatchRide(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+	if ride.DispatchStatus != "unassigned" || ride.Status == "cancelled" || ride.Status == "refunded" {
+		return nil, database.ErrRideNotDispatchable
+	}
+
+	drivers, err := database.GetDriverAvailability(ctx, ride.Needs, true)
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := database.GetRejectedDrivers(ctx, billID)
+	if err != nil {
+		return nil, err
+	}
+
+	driver := PickDriver(drivers, ride.RideAt, rejected)
+	if driver == nil {
+		return nil, nil
+	}
+	return database.OfferRide(ctx, billID, driver.DriverID)
+}
+
+// DispatchIfDue dispatches a ride right away if its ride time is close
+// enough, returning the driver it was offered to. Failures are logged; the
+// dispatcher retries the ride later.
+func DispatchIfDue(ctx context.Context, billID int, rideAt time.Time) *database.DriverMatch {
+	if rideAt.After(clock.Now().Add(config.DispatchLead())) {
+		return nil
+	}
+	match, err := Dispatch(ctx, billID)
+	if err != nil {
+		log.Printf("[dispatch] Failed to dispatch ride bill %d: %v", billID, err)
+		return nil
+	}
+	if match != nil {
+		log.Printf("[dispatch] Offered ride bill %d to driver %d", billID, match.DriverID)
+	}
+	return match
+}
+
+// Run times out unanswered offers and dispatches every ride that is due.
+// Returns the number of rides offered to a driver.
+func Run(ctx context.Context) (int, error) {
+	now := clock.Now()
+
+	expired, err := database.ExpireOffers(ctx, now.Add(-config.DispatchAcceptTimeout()))
+	if err != nil {
+		log.Printf("[dispatch] Failed to expire offers: %v", err)
+	} else if len(expired) > 0 {
+		log.Printf("[dispatch] %d ride offers timed out", len(expired))
+	}
+
+	rides, err := database.GetDueDispatchRides(ctx, now.Add(-staleRideWindow), now.Add(config.DispatchLead()))
+	if err != nil {
+		return 0, fmt.Errorf("load rides to dispatch: %w", err)
+	}
+
+	offered := 0
+	for _, ride := range rides {
+		match, err := Dispatch(ctx, ride.ID)
+		if err != nil {
+			if err != database.ErrRideNotDispatchable {
+				log.Printf("[dispatch] Failed to dispatch ride bill %d: %v", ride.ID, err)
+			}
+			continue
+		}
+		if match != nil {
+			offered++
+		}
+	}
+	if offered > 0 || len(rides) > 0 {
+		log.Printf("[dispatch] Offered %d of %d waiting rides", offered, len(rides))
+	}
+	return offered, nil
+}
@@ -0,0 +1,126 @@
+package dispatch
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+const (
+	minutesPerDay  = 24 * 60
+	minutesPerWeek = 7 * minutesPerDay
+)
+
+// span is a half-open range of minutes since Sunday midnight
+type span struct {
+	start, end int
+}
+
+// parseClock parses an HH:MM time into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q. Use HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// shiftSpans returns the parts of the week a shift covers. Shifts ending at
+// or before their start time run past midnight, and Saturday night shifts
+// wrap around to Sunday morning.
+func shiftSpans(s database.DriverShift) ([]span, error) {
+	if s.DayOfWeek < 0 || s.DayOfWeek > 6 {
+		return nil, fmt.Errorf("invalid day of week %d. Use 0 (Sunday) to 6 (Saturday)", s.DayOfWeek)
+	}
+	start, err := parseClock(s.StartTime)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClock(s.EndTime)
+	if err != nil {
+		return nil, err
+	}
+	if end <= start {
+		end += minutesPerDay
+	}
+
+	offset := int(s.DayOfWeek) * minutesPerDay
+	start, end = start+offset, end+offset
+	if end <= minutesPerWeek {
+		return []span{{start, end}}, nil
+	}
+	return []span{{start, minutesPerWeek}, {0, end - minutesPerWeek}}, nil
+}
+
+// NormalizeShifts validates a weekly shift schedule and returns it sorted.
+// Shifts may not overlap.
+func NormalizeShifts(shifts []database.DriverShift) ([]database.DriverShift, error) {
+	result := make([]database.DriverShift, 0, len(shifts))
+	var spans []span
+	for _, s := range shifts {
+		parts, err := shiftSpans(s)
+		if err != nil {
+			return nil, err
+		}
+		spans = append(spans, parts...)
+		result = append(result, s)
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return nil, fmt.Errorf("shifts must not overlap")
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].DayOfWeek != result[j].DayOfWeek {
+			return result[i].DayOfWeek < result[j].DayOfWeek
+		}
+		return result[i].StartTime < result[j].StartTime
+	})
+	return result, nil
+}
+
+// OnShift reports whether t falls within one of the shifts. Drivers without
+// a schedule are available whenever they are on duty.
+func OnShift(shifts []database.DriverShift, t time.Time) bool {
+	if len(shifts) == 0 {
+		return true
+	}
+	local := t.In(clock.Location())
+	minute := int(local.Weekday())*minutesPerDay + local.Hour()*60 + local.Minute()
+	for _, s := range shifts {
+		parts, err := shiftSpans(s)
+		if err != nil {
+			continue
+		}
+		for _, p := range parts {
+			if minute >= p.start && minute < p.end {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PickDriver chooses the driver to offer a ride at rideAt to: the least busy
+// on-duty driver with a vehicle that serves the ride's needs, whose shift
+// covers the ride and who hasn't already turned it down. Drivers must be
+// sorted best first. Returns nil if nobody is available.
+func PickDriver(drivers []database.DriverAvailability, rideAt time.Time, rejected map[int]bool) *database.DriverAvailability {
+	for i := range drivers {
+		d := &drivers[i]
+		if !d.OnDuty || d.VehicleID == nil || !d.Compatible() || rejected[d.DriverID] {
+			continue
+		}
+		if !OnShift(d.Shifts, rideAt) {
+			continue
+		}
+		return d
+	}
+	return nil
+}
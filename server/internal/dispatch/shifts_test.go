@@ -0,0 +1,132 @@
+package dispatch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+func shift(day int32, start, end string) database.DriverShift {
+	return database.DriverShift{DayOfWeek: day, StartTime: start, EndTime: end}
+}
+
+// at returns a time in the institution timezone
+func at(value string) time.Time {
+	t, _ := time.ParseInLocation("2006-01-02 15:04", value, clock.Location())
+	return t
+}
+
+func TestNormalizeShifts(t *testing.T) {
+	tests := []struct {
+		name    string
+		shifts  []database.DriverShift
+		wantErr bool
+	}{
+		{"empty", nil, false},
+		{"separate days", []database.DriverShift{shift(1, "08:00", "16:00"), shift(2, "08:00", "16:00")}, false},
+		{"back to back", []database.DriverShift{shift(1, "08:00", "12:00"), shift(1, "12:00", "16:00")}, false},
+		{"overlapping", []database.DriverShift{shift(1, "08:00", "12:00"), shift(1, "11:00", "16:00")}, true},
+		{"overnight into next day", []database.DriverShift{shift(1, "22:00", "06:00"), shift(2, "05:00", "09:00")}, true},
+		{"saturday night wraps to sunday", []database.DriverShift{shift(6, "22:00", "06:00"), shift(0, "05:00", "09:00")}, true},
+		{"saturday night then sunday", []database.DriverShift{shift(6, "22:00", "06:00"), shift(0, "06:00", "09:00")}, false},
+		{"invalid day", []database.DriverShift{shift(7, "08:00", "16:00")}, true},
+		{"invalid time", []database.DriverShift{shift(1, "8am", "16:00")}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NormalizeShifts(tt.shifts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NormalizeShifts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	sorted, err := NormalizeShifts([]database.DriverShift{shift(3, "08:00", "10:00"), shift(1, "14:00", "16:00"), shift(1, "08:00", "10:00")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sorted[0].DayOfWeek != 1 || sorted[0].StartTime != "08:00" || sorted[2].DayOfWeek != 3 {
+		t.Errorf("NormalizeShifts did not sort shifts: %v", sorted)
+	}
+}
+
+func TestOnShift(t *testing.T) {
+	// 2025-03-03 is a Monday
+	shifts := []database.DriverShift{shift(1, "08:00", "16:00"), shift(6, "22:00", "06:00")}
+
+	tests := []struct {
+		name     string
+		shifts   []database.DriverShift
+		at       string
+		expected bool
+	}{
+		{"no schedule", nil, "2025-03-03 03:00", true},
+		{"start of shift", shifts, "2025-03-03 08:00", true},
+		{"end is exclusive", shifts, "2025-03-03 16:00", false},
+		{"other day", shifts, "2025-03-04 09:00", false},
+		{"saturday night", shifts, "2025-03-08 23:30", true},
+		{"sunday morning after saturday shift", shifts, "2025-03-09 05:59", true},
+		{"sunday after overnight shift ends", shifts, "2025-03-09 06:00", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OnShift(tt.shifts, at(tt.at)); got != tt.expected {
+				t.Errorf("OnShift(%s) = %v, want %v", tt.at, got, tt.expected)
+			}
+		})
+	}
+
+	// Times are compared in the institution timezone
+	if !OnShift(shifts, time.Date(2025, 3, 3, 3, 0, 0, 0, time.UTC)) {
+		t.Error("03:00 UTC is 08:30 IST and should be on shift")
+	}
+}
+
+func TestPickDriver(t *testing.T) {
+	vehicle := 1
+	rideAt := at("2025-03-03 09:00")
+	driver := func(id int, onDuty bool, missing []string, shifts ...database.DriverShift) database.DriverAvailability {
+		return database.DriverAvailability{
+			DriverMatch: database.DriverMatch{DriverID: id, VehicleID: &vehicle, Missing: missing},
+			OnDuty:      onDuty,
+			Shifts:      shifts,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		drivers  []database.DriverAvailability
+		rejected map[int]bool
+		expected int // 0 for no driver
+	}{
+		{"first available", []database.DriverAvailability{driver(1, true, nil), driver(2, true, nil)}, nil, 1},
+		{"skips off duty", []database.DriverAvailability{driver(1, false, nil), driver(2, true, nil)}, nil, 2},
+		{"skips incompatible", []database.DriverAvailability{driver(1, true, []string{"wheelchair_ramp"}), driver(2, true, nil)}, nil, 2},
+		{"skips rejected", []database.DriverAvailability{driver(1, true, nil), driver(2, true, nil)}, map[int]bool{1: true}, 2},
+		{"skips off shift", []database.DriverAvailability{driver(1, true, nil, shift(2, "08:00", "16:00")), driver(2, true, nil, shift(1, "08:00", "16:00"))}, nil, 2},
+		{"nobody available", []database.DriverAvailability{driver(1, false, nil)}, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := PickDriver(tt.drivers, rideAt, tt.rejected)
+			gotID := 0
+			if got != nil {
+				gotID = got.DriverID
+			}
+			if gotID != tt.expected {
+				t.Errorf("PickDriver() = %d, want %d", gotID, tt.expected)
+			}
+		})
+	}
+
+	noVehicle := driver(1, true, nil)
+	noVehicle.VehicleID = nil
+	if PickDriver([]database.DriverAvailability{noVehicle}, rideAt, nil) != nil {
+		t.Error("PickDriver picked a driver without a vehicle")
+	}
+}
@@ -0,0 +1,112 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+
+	"github.com/google/uuid"
+
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+)
+
+// Attachment is a file attached to an email
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a plain text email with optional attachments
+type Message struct {
+	To          string
+	UserID      *int
+	Subject     string
+	Body        string
+	Type        string // Stored as email_logs.email_type (e.g. "statement", "notification")
+	Attachments []Attachment
+}
+
+// Send delivers a message over SMTP and logs the attempt to email_logs
+func Send(ctx context.Context, m Message) error {
+	if m.Type == "" {
+		m.Type = "notification"
+	}
+
+	if !IsSMTPConfigured() {
+		log.Printf("[Email] SMTP not configured. Skipping %q email to %s", m.Subject, m.To)
+		errorMsg := "SMTP not configured"
+		_ = database.LogEmail(ctx, m.To, m.UserID, m.Subject, m.Type, "failed", &errorMsg)
+		return fmt.Errorf("SMTP not configured - check SMTP_HOST, SMTP_USERNAME, SMTP_PASSWORD environment variables")
+	}
+
+	smtpHost := config.SMTPHost()
+	fromEmail := config.SMTPFromEmail()
+	auth := smtp.PlainAuth("", config.SMTPUsername(), config.SMTPPassword(), smtpHost)
+	addr := fmt.Sprintf("%s:%s", smtpHost, config.SMTPPort())
+
+	err := smtp.SendMail(addr, auth, fromEmail, []string{m.To}, buildMessage(fromEmail, config.SMTPFromName(), m))
+	if err != nil {
+		log.Printf("[Email] Failed to send %q email to %s: %v", m.Type, m.To, err)
+		errorMsg := err.Error()
+		_ = database.LogEmail(ctx, m.To, m.UserID, m.Subject, m.Type, "failed", &errorMsg)
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	log.Printf("[Email] %s email sent successfully to %s", m.Type, m.To)
+	_ = database.LogEmail(ctx, m.To, m.UserID, m.Subject, m.Type, "sent", nil)
+	return nil
+}
+
+// buildMessage renders the MIME message for m
+func buildMessage(fromEmail, fromName string, m Message) []byte {
+	msg := bytes.NewBuffer(nil)
+	msg.WriteString(fmt.Sprintf("From: %s <%s>\r\n", mime.QEncoding.Encode("utf-8", fromName), fromEmail))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", m.To))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject)))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if len(m.Attachments) == 0 {
+		msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		msg.WriteString("\r\n")
+		msg.WriteString(m.Body)
+		return msg.Bytes()
+	}
+
+	boundary := "odi-" + uuid.NewString()
+	msg.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\n", boundary))
+	msg.WriteString("\r\n")
+
+	msg.WriteString("--" + boundary + "\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(m.Body)
+	msg.WriteString("\r\n")
+
+	for _, a := range m.Attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		msg.WriteString("--" + boundary + "\r\n")
+		msg.WriteString(fmt.Sprintf("Content-Type: %s; name=%q\r\n", contentType, a.Filename))
+		msg.WriteString("Content-Transfer-Encoding: base64\r\n")
+		msg.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=%q\r\n", a.Filename))
+		msg.WriteString("\r\n")
+
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			msg.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		msg.WriteString(encoded + "\r\n")
+	}
+	msg.WriteString("--" + boundary + "--\r\n")
+
+	return msg.Bytes()
+}
@@ -0,0 +1,67 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestBuildMessagePlainText(t *testing.T) {
+	msg := string(buildMessage("noreply@test.com", "Test App", Message{
+		To:      "student@test.com",
+		Subject: "Your statement",
+		Body:    "Hello",
+	}))
+
+	for _, want := range []string{
+		"From: Test App <noreply@test.com>\r\n",
+		"To: student@test.com\r\n",
+		"Subject: Your statement\r\n",
+		"Content-Type: text/plain; charset=UTF-8\r\n\r\nHello",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Expected message to contain %q, got:\n%s", want, msg)
+		}
+	}
+}
+
+func TestBuildMessageWithAttachment(t *testing.T) {
+	data := bytes.Repeat([]byte("%PDF-1.4 statement "), 20)
+	msg := string(buildMessage("noreply@test.com", "Test App", Message{
+		To:      "student@test.com",
+		Subject: "Your statement",
+		Body:    "Attached",
+		Attachments: []Attachment{
+			{Filename: "statement.pdf", ContentType: "application/pdf", Data: data},
+		},
+	}))
+
+	if !strings.Contains(msg, "Content-Type: multipart/mixed; boundary=") {
+		t.Fatal("Expected multipart message")
+	}
+	if !strings.Contains(msg, `Content-Disposition: attachment; filename="statement.pdf"`) {
+		t.Error("Expected attachment disposition")
+	}
+
+	// Decode the attachment body back and compare
+	start := strings.Index(msg, "Content-Transfer-Encoding: base64\r\n")
+	if start < 0 {
+		t.Fatal("Expected base64 attachment")
+	}
+	body := msg[start:]
+	body = body[strings.Index(body, "\r\n\r\n")+4:]
+	body = body[:strings.Index(body, "--")]
+	for _, line := range strings.Split(strings.TrimSpace(body), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("Base64 line exceeds 76 characters: %d", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\r\n", ""))
+	if err != nil {
+		t.Fatalf("Failed to decode attachment: %v", err)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Error("Decoded attachment does not match original data")
+	}
+}
@@ -0,0 +1,94 @@
+// Package enrollments keeps courses filled up to their capacity and tells
+// students when their access ends: waitlisted students are promoted into
+// places freed by unenrolled or expired students, and students are reminded
+// before their enrollment expires and told once it has.
+package enrollments
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+)
+
+const (
+	// promoteTimeout bounds promoting and notifying the waitlist of one course
+	promoteTimeout = 2 * time.Minute
+	// notifyTimeout bounds emailing about one course request
+	notifyTimeout = time.Minute
+)
+
+// FormatPromotion builds the subject and body of the email telling a student
+// they were enrolled from the waitlist
+func FormatPromotion(p database.Promotion) (string, string) {
+	subject := fmt.Sprintf("You're enrolled in %s", p.CourseTitle)
+	body := fmt.Sprintf("A place opened up in %s and you have been enrolled from the waitlist.\n\n", p.CourseTitle)
+	if p.ExpiryDate != nil {
+		body += fmt.Sprintf("Your access runs until %s.\n\n", p.ExpiryDate.In(clock.Location()).Format("02 Jan 2006"))
+	}
+	body += "The course and its book are now available under My Courses.\n"
+	return subject, body
+}
+
+// notify emails a promoted student
+func notify(ctx context.Context, p database.Promotion) {
+	if p.Email == "" {
+		log.Printf("[enrollments] User %d promoted in course %d has no email", p.UserID, p.CourseID)
+		return
+	}
+	subject, body := FormatPromotion(p)
+	userID := p.UserID
+	err := email.Send(ctx, email.Message{
+		To:      p.Email,
+		UserID:  &userID,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hello %s,\n\n%s", p.UserName, body),
+		Type:    "enrollment_promoted",
+	})
+	if err != nil {
+		log.Printf("[enrollments] Failed to notify %s of enrollment in course %d: %v", p.Email, p.CourseID, err)
+	}
+}
+
+// promote fills the free places of a course from its waitlist
+func promote(ctx context.Context, courseID int) {
+	promotions, err := database.PromoteWaitlist(ctx, courseID)
+	if err != nil {
+		log.Printf("[enrollments] Failed to promote waitlist of course %d: %v", courseID, err)
+		return
+	}
+	for _, p := range promotions {
+		log.Printf("[enrollments] Promoted user %d from the waitlist of course %d", p.UserID, courseID)
+		notify(ctx, p)
+	}
+}
+
+// Promote fills the free places of a course from its waitlist after a place
+// was freed. It runs in the background so admins are never kept waiting on SMTP.
+func Promote(courseID int) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), promoteTimeout)
+		defer cancel()
+		promote(ctx, courseID)
+	}()
+}
+
+// PromoteAll fills free places from the waitlist of every course with
+// students waiting, such as places freed by enrollments that expired
+func PromoteAll(ctx context.Context) error {
+	courseIDs, err := database.GetWaitlistedCourses(ctx)
+	if err != nil {
+		return fmt.Errorf("load waitlisted courses: %w", err)
+	}
+	for _, courseID := range courseIDs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		promote(ctx, courseID)
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package enrollments
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func TestFormatPromotion(t *testing.T) {
+	expiry := time.Date(2026, 5, 31, 18, 29, 59, 0, time.UTC) // End of 31 May in IST
+
+	subject, body := FormatPromotion(database.Promotion{CourseTitle: "Algebra", ExpiryDate: &expiry})
+	if subject != "You're enrolled in Algebra" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "Your access runs until 31 May 2026.") {
+		t.Errorf("body does not mention the expiry date:\n%s", body)
+	}
+
+	_, body = FormatPromotion(database.Promotion{CourseTitle: "Algebra"})
+	if strings.Contains(body, "access runs until") {
+		t.Errorf("body mentions an expiry for an enrollment without one:\n%s", body)
+	}
+}
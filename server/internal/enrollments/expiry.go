@@ -0,0 +1,210 @@
+package enrollments
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+)
+
+// dueRenewalWindow returns the renewal window, in days before expiry, an
+// enrollment with daysLeft is in: the smallest window not below daysLeft.
+// windows are sorted largest first. It returns 0 outside every window.
+func dueRenewalWindow(windows []int, daysLeft int) int {
+	due := 0
+	for _, w := range windows {
+		if w >= daysLeft {
+			due = w
+		}
+	}
+	return due
+}
+
+// remindDue reports whether a student should be reminded of an expiring
+// enrollment: it is in a renewal window smaller than the last one reminded
+func remindDue(e database.EnrollmentExpiry) (int, bool) {
+	due := dueRenewalWindow(e.RenewalWindowDays, e.DaysLeft)
+	if due == 0 {
+		return 0, false
+	}
+	return due, e.RemindedDays == nil || due < *e.RemindedDays
+}
+
+// whenLeft describes how long is left until expiry
+func whenLeft(daysLeft int) string {
+	switch daysLeft {
+	case 0:
+		return "today"
+	case 1:
+		return "tomorrow"
+	}
+	return fmt.Sprintf("in %d days", daysLeft)
+}
+
+// FormatReminder builds the subject and body of the email reminding a
+// student that their access to a course is about to end
+func FormatReminder(e database.EnrollmentExpiry) (string, string) {
+	subject := fmt.Sprintf("Your access to %s ends %s", e.CourseTitle, whenLeft(e.DaysLeft))
+	body := fmt.Sprintf("Your access to %s, including its book and materials, ends on %s.\n\n",
+		e.CourseTitle, e.ExpiryDate.In(clock.Location()).Format("02 Jan 2006"))
+	body += "If you still need it, please contact the administration to renew your enrollment before then.\n"
+	return subject, body
+}
+
+// FormatExpired builds the subject and body of the email telling a student
+// their access to a course has ended
+func FormatExpired(e database.EnrollmentExpiry) (string, string) {
+	subject := fmt.Sprintf("Your access to %s has ended", e.CourseTitle)
+	body := fmt.Sprintf("Your enrollment in %s expired on %s and its book and materials are no longer available to you.\n\n",
+		e.CourseTitle, e.ExpiryDate.In(clock.Location()).Format("02 Jan 2006"))
+	body += "If you still need access, please contact the administration to renew your enrollment.\n"
+	return subject, body
+}
+
+// FormatAdminDigest builds the subject and body of the email telling admins
+// which students were reminded and whose enrollments expired in a run
+func FormatAdminDigest(reminded, expired []database.EnrollmentExpiry) (string, string) {
+	subject := fmt.Sprintf("Enrollments: %d expiring, %d expired", len(reminded), len(expired))
+
+	var b strings.Builder
+	line := func(e database.EnrollmentExpiry) {
+		fmt.Fprintf(&b, "- %s <%s>, %s, %s\n", e.UserName, e.Email, e.CourseTitle,
+			e.ExpiryDate.In(clock.Location()).Format("02 Jan 2006"))
+	}
+	if len(reminded) > 0 {
+		b.WriteString("Students reminded that their access ends soon:\n")
+		for _, e := range reminded {
+			line(e)
+		}
+		b.WriteString("\n")
+	}
+	if len(expired) > 0 {
+		b.WriteString("Enrollments that expired:\n")
+		for _, e := range expired {
+			line(e)
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("Renew enrollments from the course's enrollment list.\n")
+	return subject, b.String()
+}
+
+// sendToStudent emails a student about their enrollment
+func sendToStudent(ctx context.Context, e database.EnrollmentExpiry, subject, body, emailType string) {
+	if e.Email == "" {
+		log.Printf("[enrollments] User %d enrolled in course %d has no email", e.UserID, e.CourseID)
+		return
+	}
+	userID := e.UserID
+	err := email.Send(ctx, email.Message{
+		To:      e.Email,
+		UserID:  &userID,
+		Subject: subject,
+		Body:    fmt.Sprintf("Hello %s,\n\n%s", e.UserName, body),
+		Type:    emailType,
+	})
+	if err != nil {
+		log.Printf("[enrollments] Failed to email %s about enrollment %d: %v", e.Email, e.EnrollmentID, err)
+	}
+}
+
+// remindExpiring reminds students whose enrollments entered a renewal window
+func remindExpiring(ctx context.Context) []database.EnrollmentExpiry {
+	expiring, err := database.GetExpiringEnrollments(ctx)
+	if err != nil {
+		log.Printf("[enrollments] Failed to load expiring enrollments: %v", err)
+		return nil
+	}
+
+	var reminded []database.EnrollmentExpiry
+	for _, e := range expiring {
+		window, due := remindDue(e)
+		if !due {
+			continue
+		}
+		// Claim the reminder first so concurrent runs never send it twice
+		marked, err := database.MarkRenewalReminded(ctx, e.EnrollmentID, window, e.ExpiryDate)
+		if err != nil {
+			log.Printf("[enrollments] Failed to record reminder for enrollment %d: %v", e.EnrollmentID, err)
+			continue
+		}
+		if !marked {
+			continue
+		}
+		subject, body := FormatReminder(e)
+		sendToStudent(ctx, e, subject, body, "enrollment_expiring")
+		reminded = append(reminded, e)
+	}
+	return reminded
+}
+
+// expireDue marks enrollments past their expiry date as expired and tells
+// the students
+func expireDue(ctx context.Context) []database.EnrollmentExpiry {
+	expired, err := database.ExpireEnrollments(ctx)
+	if err != nil {
+		log.Printf("[enrollments] Failed to expire enrollments: %v", err)
+		return nil
+	}
+
+	var notified []database.EnrollmentExpiry
+	for _, e := range expired {
+		log.Printf("[enrollments] Enrollment %d of user %d in course %d expired", e.EnrollmentID, e.UserID, e.CourseID)
+		if !e.Notify {
+			continue
+		}
+		subject, body := FormatExpired(e)
+		sendToStudent(ctx, e, subject, body, "enrollment_expired")
+		notified = append(notified, e)
+	}
+	return notified
+}
+
+// notifyAdmins emails admins a digest of a run's reminders and expiries
+func notifyAdmins(ctx context.Context, reminded, expired []database.EnrollmentExpiry) {
+	if len(reminded) == 0 && len(expired) == 0 {
+		return
+	}
+	settings, err := database.GetEnrollmentSettings(ctx)
+	if err != nil {
+		log.Printf("[enrollments] Failed to load enrollment settings: %v", err)
+		return
+	}
+	if !settings.NotifyAdmins {
+		return
+	}
+	admins, err := database.GetAdminRecipients(ctx)
+	if err != nil {
+		log.Printf("[enrollments] Failed to load admin recipients: %v", err)
+		return
+	}
+
+	subject, body := FormatAdminDigest(reminded, expired)
+	for _, admin := range admins {
+		userID := admin.UserID
+		err := email.Send(ctx, email.Message{
+			To:      admin.Email,
+			UserID:  &userID,
+			Subject: subject,
+			Body:    fmt.Sprintf("Hello %s,\n\n%s", admin.Name, body),
+			Type:    "enrollment_expiry_digest",
+		})
+		if err != nil {
+			log.Printf("[enrollments] Failed to send expiry digest to %s: %v", admin.Email, err)
+		}
+	}
+}
+
+// ProcessExpiries reminds students whose enrollments are about to expire,
+// marks expired enrollments and tells the students and admins. Returns how
+// many were reminded and expired.
+func ProcessExpiries(ctx context.Context) (int, int) {
+	reminded := remindExpiring(ctx)
+	expired := expireDue(ctx)
+	notifyAdmins(ctx, reminded, expired)
+	return len(reminded), len(expired)
+}
@@ -0,0 +1,78 @@
+package enrollments
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func TestRemindDue(t *testing.T) {
+	reminded := func(n int) *int { return &n }
+
+	tests := []struct {
+		name       string
+		windows    []int
+		daysLeft   int
+		reminded   *int
+		wantWindow int
+		wantDue    bool
+	}{
+		{"outside every window", []int{7, 1}, 8, nil, 0, false},
+		{"enters first window", []int{7, 1}, 7, nil, 7, true},
+		{"inside first window", []int{7, 1}, 3, nil, 7, true},
+		{"already reminded in window", []int{7, 1}, 3, reminded(7), 7, false},
+		{"enters next window", []int{7, 1}, 1, reminded(7), 1, true},
+		{"last day", []int{7, 1}, 0, reminded(7), 1, true},
+		{"missed windows remind once", []int{14, 7, 1}, 1, nil, 1, true},
+		{"reminded in smaller window", []int{14, 7, 1}, 5, reminded(1), 7, false},
+		{"reminders off", []int{}, 0, nil, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			window, due := remindDue(database.EnrollmentExpiry{
+				RenewalWindowDays: tt.windows,
+				DaysLeft:          tt.daysLeft,
+				RemindedDays:      tt.reminded,
+			})
+			if window != tt.wantWindow || due != tt.wantDue {
+				t.Errorf("remindDue() = (%d, %v), want (%d, %v)", window, due, tt.wantWindow, tt.wantDue)
+			}
+		})
+	}
+}
+
+func TestFormatReminder(t *testing.T) {
+	e := database.EnrollmentExpiry{
+		CourseTitle: "Algebra",
+		ExpiryDate:  time.Date(2026, 5, 31, 18, 29, 59, 0, time.UTC), // End of 31 May in IST
+	}
+
+	for daysLeft, want := range map[int]string{0: "today", 1: "tomorrow", 7: "in 7 days"} {
+		e.DaysLeft = daysLeft
+		subject, body := FormatReminder(e)
+		if subject != "Your access to Algebra ends "+want {
+			t.Errorf("subject = %q", subject)
+		}
+		if !strings.Contains(body, "ends on 31 May 2026.") {
+			t.Errorf("body does not mention the expiry date:\n%s", body)
+		}
+	}
+}
+
+func TestFormatAdminDigest(t *testing.T) {
+	expiry := time.Date(2026, 5, 31, 18, 29, 59, 0, time.UTC)
+	reminded := []database.EnrollmentExpiry{{UserName: "Asha", Email: "asha@example.com", CourseTitle: "Algebra", ExpiryDate: expiry}}
+
+	subject, body := FormatAdminDigest(reminded, nil)
+	if subject != "Enrollments: 1 expiring, 0 expired" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "- Asha <asha@example.com>, Algebra, 31 May 2026\n") {
+		t.Errorf("body does not list the reminded student:\n%s", body)
+	}
+	if strings.Contains(body, "expired:") {
+		t.Errorf("body lists expired enrollments when there are none:\n%s", body)
+	}
+}
@@ -0,0 +1,146 @@
+package enrollments
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+)
+
+// requestedBook describes what a course request asks for
+func requestedBook(r *database.CourseRequest) string {
+	if r.CourseID != nil && r.CourseName != nil {
+		if r.CourseCode != nil && *r.CourseCode != "" {
+			return fmt.Sprintf("%s (%s)", *r.CourseName, *r.CourseCode)
+		}
+		return *r.CourseName
+	}
+	var b strings.Builder
+	if r.Title != nil {
+		b.WriteString(*r.Title)
+	}
+	if r.Author != nil && *r.Author != "" {
+		fmt.Fprintf(&b, " by %s", *r.Author)
+	}
+	if r.Code != nil && *r.Code != "" {
+		fmt.Fprintf(&b, " (%s)", *r.Code)
+	}
+	return b.String()
+}
+
+// requestedTitle is the course or book of a request as the student sees it
+func requestedTitle(r *database.CourseRequest) string {
+	if r.CourseTitle != nil {
+		return *r.CourseTitle
+	}
+	if r.Title != nil {
+		return *r.Title
+	}
+	return "your course"
+}
+
+// FormatRequestSubmitted builds the subject and body of the email telling
+// admins about a new course request
+func FormatRequestSubmitted(r *database.CourseRequest) (string, string) {
+	kind := "Enrollment request"
+	if r.CourseID == nil {
+		kind = "New book request"
+	}
+	subject := fmt.Sprintf("%s: %s", kind, requestedBook(r))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s", r.UserName)
+	if r.EnrollmentNumber != nil && *r.EnrollmentNumber != "" {
+		fmt.Fprintf(&b, " (%s)", *r.EnrollmentNumber)
+	}
+	if r.CourseID != nil {
+		fmt.Fprintf(&b, " asked to be enrolled in %s.\n\n", requestedBook(r))
+	} else {
+		fmt.Fprintf(&b, " asked for a book that is not in the system: %s.\n\n", requestedBook(r))
+	}
+	fmt.Fprintf(&b, "Reason:\n%s\n\n", r.Reason)
+	b.WriteString("Approve or reject the request from the admin dashboard.\n")
+	return subject, b.String()
+}
+
+// FormatRequestReviewed builds the subject and body of the email telling a
+// student their course request was approved or rejected
+func FormatRequestReviewed(r *database.CourseRequest, result *database.EnrollmentResult) (string, string) {
+	title := requestedTitle(r)
+	var subject string
+	var b strings.Builder
+	if r.Status == database.CourseRequestApproved {
+		subject = fmt.Sprintf("Your request for %s was approved", title)
+		if result != nil && result.Status == database.EnrollmentWaitlisted {
+			fmt.Fprintf(&b, "Your request for %s was approved. The course is full, so you are number %d on its waitlist and will be enrolled automatically when a place opens up.\n\n",
+				title, result.Position)
+		} else {
+			fmt.Fprintf(&b, "Your request for %s was approved and you have been enrolled. The course and its book are now available under My Courses.\n\n", title)
+		}
+	} else {
+		subject = fmt.Sprintf("Your request for %s was not approved", title)
+		fmt.Fprintf(&b, "Your request for %s was not approved.\n\n", title)
+	}
+	if r.AdminComment != nil && *r.AdminComment != "" {
+		fmt.Fprintf(&b, "Comment from the administration:\n%s\n", *r.AdminComment)
+	}
+	return subject, b.String()
+}
+
+// NotifyRequestSubmitted emails admins about a new course request. It runs
+// in the background so the student is never kept waiting on SMTP.
+func NotifyRequestSubmitted(r *database.CourseRequest) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		admins, err := database.GetAdminRecipients(ctx)
+		if err != nil {
+			log.Printf("[enrollments] Failed to load admin recipients for course request %d: %v", r.ID, err)
+			return
+		}
+		subject, body := FormatRequestSubmitted(r)
+		for _, admin := range admins {
+			userID := admin.UserID
+			err := email.Send(ctx, email.Message{
+				To:      admin.Email,
+				UserID:  &userID,
+				Subject: subject,
+				Body:    fmt.Sprintf("Hello %s,\n\n%s", admin.Name, body),
+				Type:    "course_request",
+			})
+			if err != nil {
+				log.Printf("[enrollments] Failed to notify %s of course request %d: %v", admin.Email, r.ID, err)
+			}
+		}
+	}()
+}
+
+// NotifyRequestReviewed emails a student the decision on their course
+// request. It runs in the background so admins are never kept waiting on SMTP.
+func NotifyRequestReviewed(r *database.CourseRequest, result *database.EnrollmentResult) {
+	if r.Email == "" {
+		log.Printf("[enrollments] User %d of course request %d has no email", r.UserID, r.ID)
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		subject, body := FormatRequestReviewed(r, result)
+		userID := r.UserID
+		err := email.Send(ctx, email.Message{
+			To:      r.Email,
+			UserID:  &userID,
+			Subject: subject,
+			Body:    fmt.Sprintf("Hello %s,\n\n%s", r.UserName, body),
+			Type:    "course_request_" + r.Status,
+		})
+		if err != nil {
+			log.Printf("[enrollments] Failed to notify %s of course request %d: %v", r.Email, r.ID, err)
+		}
+	}()
+}
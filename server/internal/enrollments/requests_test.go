@@ -0,0 +1,51 @@
+package enrollments
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/server/internal/database"
+)
+
+func TestFormatRequestReviewed(t *testing.T) {
+	courseTitle := "Algebra"
+	comment := "Enjoy the course"
+	request := &database.CourseRequest{CourseTitle: &courseTitle, Status: database.CourseRequestApproved, AdminComment: &comment}
+
+	subject, body := FormatRequestReviewed(request, &database.EnrollmentResult{Status: database.EnrollmentEnrolled})
+	if subject != "Your request for Algebra was approved" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "you have been enrolled") || !strings.Contains(body, "Enjoy the course") {
+		t.Errorf("unexpected approval body:\n%s", body)
+	}
+
+	_, body = FormatRequestReviewed(request, &database.EnrollmentResult{Status: database.EnrollmentWaitlisted, Position: 4})
+	if !strings.Contains(body, "number 4 on its waitlist") {
+		t.Errorf("waitlisted body does not mention the position:\n%s", body)
+	}
+
+	title := "Topology"
+	rejected := &database.CourseRequest{Title: &title, Status: database.CourseRequestRejected}
+	subject, _ = FormatRequestReviewed(rejected, nil)
+	if subject != "Your request for Topology was not approved" {
+		t.Errorf("subject = %q", subject)
+	}
+}
+
+func TestFormatRequestSubmitted(t *testing.T) {
+	title, author, code := "Topology", "Munkres", "MTH301"
+	number := "EN001"
+	request := &database.CourseRequest{
+		UserName: "Asha", EnrollmentNumber: &number,
+		Title: &title, Author: &author, Code: &code, Reason: "Not in the library",
+	}
+
+	subject, body := FormatRequestSubmitted(request)
+	if subject != "New book request: Topology by Munkres (MTH301)" {
+		t.Errorf("subject = %q", subject)
+	}
+	if !strings.Contains(body, "Asha (EN001) asked for a book") || !strings.Contains(body, "Not in the library") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// accessibilityProfileToMap converts an accessibility profile to the API response format
+func accessibilityProfileToMap(p database.AccessibilityProfile) fiber.Map {
+	profileMap := fiber.Map{
+		"userId": strconv.Itoa(p.UserID),
+		"needs":  p.Needs,
+	}
+	if p.Notes != nil {
+		profileMap["notes"] = *p.Notes
+	}
+	if p.UpdatedAt != nil {
+		profileMap["updatedAt"] = p.UpdatedAt.Format(time.RFC3339)
+	}
+	return profileMap
+}
+
+// driverMatchToMap converts a driver match to the API response format
+func driverMatchToMap(m database.DriverMatch) fiber.Map {
+	matchMap := fiber.Map{
+		"driverId":     strconv.Itoa(m.DriverID),
+		"name":         m.Name,
+		"capabilities": m.Capabilities,
+		"activeRides":  m.ActiveRides,
+		"compatible":   m.Compatible(),
+	}
+	if m.VehicleID != nil {
+		matchMap["vehicleId"] = strconv.Itoa(*m.VehicleID)
+	}
+	if m.VehicleNumber != nil {
+		matchMap["vehicleNumber"] = *m.VehicleNumber
+	}
+	if m.VehicleType != nil {
+		matchMap["vehicleType"] = *m.VehicleType
+	}
+	if !m.Compatible() {
+		matchMap["missing"] = m.Missing
+		matchMap["reason"] = database.AccessibilityMismatchReason(m.Missing)
+	}
+	return matchMap
+}
+
+// assignDriverErrorResponse maps driver assignment errors to HTTP responses.
+// Accessibility mismatches include the reason so admins can pick another driver.
+func assignDriverErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	var mismatch *database.AccessibilityMismatchError
+	switch {
+	case errors.As(err, &mismatch):
+		return c.Status(409).JSON(fiber.Map{
+			"error":   "driver's vehicle can't serve this ride's accessibility needs",
+			"reason":  mismatch.Error(),
+			"missing": mismatch.Missing,
+		})
+	case err == database.ErrDriverNotFound:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "driver not found or not active",
+		})
+	case err == database.ErrBillNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride bill not found",
+		})
+	}
+	log.Printf("[%s] Assign driver error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to assign driver",
+	})
+}
+
+// GetAccessibilityFeatures returns the accessibility features students can
+// require and vehicles can offer
+func GetAccessibilityFeatures(c *fiber.Ctx) error {
+	keys := make([]string, 0, len(database.AccessibilityFeatures))
+	for key := range database.AccessibilityFeatures {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	features := make([]fiber.Map, 0, len(keys))
+	for _, key := range keys {
+		features = append(features, fiber.Map{
+			"key":   key,
+			"label": database.AccessibilityFeatures[key],
+		})
+	}
+	return c.JSON(features)
+}
+
+// AccessibilityProfileRequest represents an accessibility profile update
+type AccessibilityProfileRequest struct {
+	Needs []string `json:"needs"`
+	Notes *string  `json:"notes"`
+}
+
+// GetMyAccessibilityProfile returns the current user's accessibility requirements
+func GetMyAccessibilityProfile(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	return getAccessibilityProfile(c, session.UserID, "GetMyAccessibilityProfile")
+}
+
+// UpdateMyAccessibilityProfile replaces the current user's accessibility requirements
+func UpdateMyAccessibilityProfile(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	return saveAccessibilityProfile(c, session.UserID, "UpdateMyAccessibilityProfile")
+}
+
+// GetUserAccessibilityProfile returns a user's accessibility requirements (admin)
+func GetUserAccessibilityProfile(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+	return getAccessibilityProfile(c, userID, "GetUserAccessibilityProfile")
+}
+
+// UpdateUserAccessibilityProfile replaces a user's accessibility requirements (admin)
+func UpdateUserAccessibilityProfile(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+	return saveAccessibilityProfile(c, userID, "UpdateUserAccessibilityProfile")
+}
+
+// getAccessibilityProfile responds with a user's accessibility profile
+func getAccessibilityProfile(c *fiber.Ctx, userID int, logPrefix string) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	profile, err := database.GetAccessibilityProfile(ctx, userID)
+	if err != nil {
+		log.Printf("[%s] Query error: %v", logPrefix, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch accessibility profile",
+		})
+	}
+	return c.JSON(accessibilityProfileToMap(*profile))
+}
+
+// saveAccessibilityProfile validates and stores a user's accessibility profile
+func saveAccessibilityProfile(c *fiber.Ctx, userID int, logPrefix string) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req AccessibilityProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	needs, err := database.NormalizeAccessibilityTags(req.Needs)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.Notes != nil {
+		notes := strings.TrimSpace(*req.Notes)
+		req.Notes = &notes
+		if notes == "" {
+			req.Notes = nil
+		}
+	}
+
+	var exists bool
+	err = database.GetPool().QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists)
+	if err == nil && !exists {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "user not found",
+		})
+	}
+
+	profile, err := database.SaveAccessibilityProfile(ctx, database.AccessibilityProfile{
+		UserID: userID,
+		Needs:  needs,
+		Notes:  req.Notes,
+	})
+	if err != nil {
+		log.Printf("[%s] Save error: %v", logPrefix, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to save accessibility profile",
+		})
+	}
+	return c.JSON(accessibilityProfileToMap(*profile))
+}
+
+// GetRideBillDriverMatches lists drivers for a ride bill, compatible ones first.
+// Incompatible drivers include the reason they can't serve the ride.
+func GetRideBillDriverMatches(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	needs, err := database.GetRideBillNeeds(ctx, billID)
+	if err != nil {
+		return assignDriverErrorResponse(c, "GetRideBillDriverMatches", err)
+	}
+
+	matches, err := database.GetDriverMatches(ctx, needs)
+	if err != nil {
+		log.Printf("[GetRideBillDriverMatches] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch drivers",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(matches))
+	for _, m := range matches {
+		result = append(result, driverMatchToMap(m))
+	}
+	return c.JSON(fiber.Map{
+		"accessibilityNeeds": needs,
+		"drivers":            result,
+	})
+}
+
+// AssignRideBillDriverRequest represents a driver assignment request.
+// Without a driver ID the least busy compatible driver is chosen.
+type AssignRideBillDriverRequest struct {
+	DriverID *int `json:"driverId"`
+}
+
+// AssignRideBillDriver assigns a driver to a ride bill, blocking drivers whose
+// vehicle can't serve the ride's accessibility needs
+func AssignRideBillDriver(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var req AssignRideBillDriverRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	driverID := 0
+	if req.DriverID != nil {
+		driverID = *req.DriverID
+	} else {
+		needs, err := database.GetRideBillNeeds(ctx, billID)
+		if err != nil {
+			return assignDriverErrorResponse(c, "AssignRideBillDriver", err)
+		}
+		matches, err := database.GetDriverMatches(ctx, needs)
+		if err != nil {
+			return assignDriverErrorResponse(c, "AssignRideBillDriver", err)
+		}
+		if len(matches) == 0 || !matches[0].Compatible() {
+			return c.Status(409).JSON(fiber.Map{
+				"error":              "no active driver has a vehicle for this ride's accessibility needs",
+				"accessibilityNeeds": needs,
+			})
+		}
+		driverID = matches[0].DriverID
+	}
+
+	driver, err := database.AssignDriver(ctx, billID, driverID)
+	if err != nil {
+		return assignDriverErrorResponse(c, "AssignRideBillDriver", err)
+	}
+
+	return c.JSON(fiber.Map{
+		"rideBillId": strconv.Itoa(billID),
+		"driver":     driverMatchToMap(*driver),
+	})
+}
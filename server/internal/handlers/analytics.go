@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+// Maximum analytics date range per interval, so a single request can't
+// produce an unbounded number of buckets
+var analyticsMaxRange = map[string]time.Duration{
+	"day":   366 * 24 * time.Hour,
+	"week":  3 * 366 * 24 * time.Hour,
+	"month": 10 * 366 * 24 * time.Hour,
+}
+
+// analyticsResponse is the cached body of the analytics endpoint
+type analyticsResponse struct {
+	GroupBy  string                  `json:"groupBy"`
+	Interval string                  `json:"interval,omitempty"`
+	From     string                  `json:"from"`
+	To       string                  `json:"to"`
+	Rows     []database.AnalyticsRow `json:"rows"`
+	Totals   database.AnalyticsRow   `json:"totals"`
+}
+
+// GetRideBillAnalytics returns ride counts and revenue for bills created in a
+// date range, grouped by time (day, week or month), route, driver, programme,
+// hostel or status. Dimension groupings can also be split by interval.
+func GetRideBillAnalytics(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(30 * time.Second)
+	defer cancel()
+
+	groupBy := c.Query("groupBy", "time")
+	if !database.AnalyticsGroupings[groupBy] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid groupBy. Must be one of: time, route, driver, programme, hostel, status",
+		})
+	}
+
+	interval := c.Query("interval")
+	if groupBy == "time" && interval == "" {
+		interval = "day"
+	}
+	if interval != "" && !database.AnalyticsIntervals[interval] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid interval. Must be one of: day, week, month",
+		})
+	}
+
+	today := clock.Now()
+	to := time.Date(today.Year(), today.Month(), today.Day(), 0, 0, 0, 0, time.UTC)
+	from := to.AddDate(0, 0, -29)
+	var err error
+	if v := c.Query("to"); v != "" {
+		if to, err = time.Parse("2006-01-02", v); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid to date. Use YYYY-MM-DD",
+			})
+		}
+		if c.Query("from") == "" {
+			from = to.AddDate(0, 0, -29)
+		}
+	}
+	if v := c.Query("from"); v != "" {
+		if from, err = time.Parse("2006-01-02", v); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid from date. Use YYYY-MM-DD",
+			})
+		}
+	}
+	if from.After(to) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "from must not be after to",
+		})
+	}
+	maxRange := analyticsMaxRange["month"]
+	if interval != "" {
+		maxRange = analyticsMaxRange[interval]
+	}
+	if to.Sub(from) > maxRange {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "date range is too large for this interval",
+		})
+	}
+
+	response := analyticsResponse{
+		GroupBy:  groupBy,
+		Interval: interval,
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+	}
+	cacheKey := response.GroupBy + "|" + response.Interval + "|" + response.From + "|" + response.To
+
+	// The cache version is read before querying, so bills changed while the
+	// query runs invalidate the result instead of being hidden by it
+	var cached analyticsResponse
+	version, cacheErr := cache.GetRideBillAnalytics(ctx, cacheKey, &cached)
+	if cacheErr == nil {
+		c.Set("X-Cache", "HIT")
+		return c.JSON(cached)
+	}
+
+	rows, err := database.GetRideBillAnalytics(ctx, database.AnalyticsQuery{
+		GroupBy:  groupBy,
+		Interval: interval,
+		From:     from,
+		To:       to,
+	})
+	if err != nil {
+		log.Printf("[GetRideBillAnalytics] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch analytics",
+		})
+	}
+
+	response.Rows = rows
+	for _, r := range rows {
+		response.Totals.Rides += r.Rides
+		response.Totals.CancelledRides += r.CancelledRides
+		response.Totals.Billed += r.Billed
+		response.Totals.Collected += r.Collected
+		response.Totals.Outstanding += r.Outstanding
+	}
+	response.Totals.Billed = database.RoundCents(response.Totals.Billed)
+	response.Totals.Collected = database.RoundCents(response.Totals.Collected)
+	response.Totals.Outstanding = database.RoundCents(response.Totals.Outstanding)
+
+	if cacheErr == cache.ErrAnalyticsMiss {
+		if err := cache.SetRideBillAnalytics(ctx, version, cacheKey, response); err != nil {
+			log.Printf("[GetRideBillAnalytics] Cache write error: %v", err)
+		}
+	}
+
+	c.Set("X-Cache", "MISS")
+	return c.JSON(response)
+}
+
+// invalidateAnalytics discards cached analytics after ride bills or payments change
+func invalidateAnalytics(logPrefix string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := cache.InvalidateRideBillAnalytics(ctx); err != nil && err != cache.ErrCacheUnavailable {
+		log.Printf("[%s] Failed to invalidate analytics cache: %v", logPrefix, err)
+	}
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/server/internal/auth"
 	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
 	"github.com/server/internal/database"
 	"github.com/server/internal/email"
 	"github.com/server/internal/middleware"
@@ -24,6 +25,7 @@ import (
 type LoginRequest struct {
 	Identifier string `json:"identifier" validate:"required"` // username or email
 	Password   string `json:"password" validate:"required"`
+	RememberMe bool   `json:"rememberMe"` // longer-lived session that doesn't end when idle
 }
 
 // LoginResponse represents a login response
@@ -56,11 +58,19 @@ func Login(c *fiber.Ctx) error {
 	log.Printf("[Login] Attempting login for identifier: %s (password length: %d)", req.Identifier, len(req.Password))
 
 	// Authenticate user
-	session, sessionID, err := auth.Login(ctx, req.Identifier, req.Password)
+	session, sessionID, err := auth.Login(ctx, req.Identifier, req.Password, req.RememberMe)
 	if err != nil {
 		if err == auth.ErrInvalidCredentials {
 			return c.Status(401).JSON(fiber.Map{
 				"error": "invalid credentials",
+				"code":  auth.ErrorCode(err),
+			})
+		}
+		// Suspended, pending, graduated, expired or closed accounts
+		if code := auth.ErrorCode(err); code != "" {
+			return c.Status(403).JSON(fiber.Map{
+				"error": err.Error(),
+				"code":  code,
 			})
 		}
 		return c.Status(500).JSON(fiber.Map{
@@ -72,13 +82,12 @@ func Login(c *fiber.Ctx) error {
 	userAgent := c.Get("User-Agent", "Unknown")
 	ipAddress := c.IP()
 	deviceInfo := extractDeviceInfo(userAgent)
-	expiresAt := time.Now().Add(24 * time.Hour)
 
 	// Get location from IP address (non-blocking, runs in background)
 	location := getLocationFromIP(ipAddress)
 
 	// Store session metadata in database
-	if err := database.StoreSession(ctx, session.UserID, sessionID, deviceInfo, userAgent, ipAddress, location, expiresAt); err != nil {
+	if err := database.StoreSession(ctx, session.UserID, sessionID, deviceInfo, userAgent, ipAddress, location, session.ExpiresAt); err != nil {
 		log.Printf("[Login] Warning: Failed to store session in database: %v", err)
 		// Don't fail login if DB storage fails, Redis is primary
 	}
@@ -95,7 +104,7 @@ func Login(c *fiber.Ctx) error {
 	c.Cookie(&fiber.Cookie{
 		Name:     "session_id",
 		Value:    sessionID,
-		Expires:  expiresAt,
+		Expires:  session.AbsoluteExpiresAt, // Redis enforces the idle timeout
 		HTTPOnly: true,
 		Secure:   secure,
 		SameSite: sameSite,
@@ -118,7 +127,7 @@ func Logout(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	sessionID := c.Cookies("session_id")
+	sessionID := middleware.GetSessionID(c)
 	if sessionID != "" {
 		// Mark session as logged out in database (instead of deleting)
 		_ = database.MarkSessionLoggedOut(ctx, sessionID)
@@ -136,7 +145,7 @@ func Logout(c *fiber.Ctx) error {
 	c.Cookie(&fiber.Cookie{
 		Name:     "session_id",
 		Value:    "",
-		Expires:  time.Now().Add(-time.Hour),
+		Expires:  clock.Now().Add(-time.Hour),
 		HTTPOnly: true,
 		Secure:   secure,
 		SameSite: sameSite,
@@ -168,7 +177,7 @@ func Me(c *fiber.Ctx) error {
 		       enrollment_number, programme, course, year, expiry_date, hostel,
 		       profile_picture, disability_type, disability_percentage, udid_number,
 		       disability_certificate, id_proof_type, id_proof_document,
-		       license_number, vehicle_number, vehicle_type,
+		       license_number, ` + userVehicleColumns + `,
 		       created_at, updated_at
 		FROM users
 		WHERE id = $1
@@ -468,7 +477,7 @@ func GetSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	currentSessionID := c.Cookies("session_id")
+	currentSessionID := middleware.GetSessionID(c)
 	if currentSessionID == "" {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "unauthorized",
@@ -536,7 +545,7 @@ func GetLoginHistory(c *fiber.Ctx) error {
 		})
 	}
 
-	currentSessionID := c.Cookies("session_id")
+	currentSessionID := middleware.GetSessionID(c)
 	if currentSessionID == "" {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "unauthorized",
@@ -577,7 +586,7 @@ func GetLoginHistory(c *fiber.Ctx) error {
 		}
 
 		// Check if session is expired
-		isExpired := time.Now().After(s.ExpiresAt)
+		isExpired := clock.Now().After(s.ExpiresAt)
 
 		loggedOutAt := ""
 		if s.LoggedOutAt != nil {
@@ -634,33 +643,44 @@ func RevokeSession(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.SessionID == "" {
+		// Clients that can't send a DELETE body pass it in the path
+		req.SessionID = c.Params("id")
+	}
 	if req.SessionID == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "sessionId is required",
 		})
 	}
 
-	currentSessionID := c.Cookies("session_id")
+	currentSessionID := middleware.GetSessionID(c)
 	if req.SessionID == currentSessionID {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "cannot revoke current session",
 		})
 	}
 
-	// Verify session belongs to user
-	dbSessions, err := database.GetUserSessions(ctx, session.UserID, currentSessionID)
+	// Verify session belongs to user, by the user's session set in Redis or,
+	// for sessions from before the set, by its row
+	found, err := auth.OwnsSession(ctx, session.UserID, req.SessionID)
 	if err != nil {
+		log.Printf("[RevokeSession] Error checking session set: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "failed to verify session",
 		})
 	}
-
-	// Check if session belongs to user
-	found := false
-	for _, s := range dbSessions {
-		if s.SessionID == req.SessionID {
-			found = true
-			break
+	if !found {
+		dbSessions, err := database.GetUserSessions(ctx, session.UserID, currentSessionID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to verify session",
+			})
+		}
+		for _, s := range dbSessions {
+			if s.SessionID == req.SessionID {
+				found = true
+				break
+			}
 		}
 	}
 
@@ -697,7 +717,7 @@ func RevokeAllSessions(c *fiber.Ctx) error {
 		})
 	}
 
-	currentSessionID := c.Cookies("session_id")
+	currentSessionID := middleware.GetSessionID(c)
 	if currentSessionID == "" {
 		return c.Status(401).JSON(fiber.Map{
 			"error": "unauthorized",
@@ -717,7 +737,14 @@ func RevokeAllSessions(c *fiber.Ctx) error {
 		log.Printf("[RevokeAllSessions] Error marking sessions as logged out: %v", err)
 	}
 
-	// Delete from Redis (all except current)
+	// Delete from Redis (all except current), including sessions whose row
+	// was never written
+	if _, err := auth.LogoutOthers(ctx, session.UserID, currentSessionID); err != nil {
+		log.Printf("[RevokeAllSessions] Error deleting sessions: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to revoke sessions",
+		})
+	}
 	for _, s := range dbSessions {
 		if s.SessionID != currentSessionID {
 			_ = auth.Logout(ctx, s.SessionID)
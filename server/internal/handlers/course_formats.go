@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/books"
+	"github.com/server/internal/database"
+)
+
+// courseBookFormatToMap converts a book format's conversion status to the
+// admin API response format
+func courseBookFormatToMap(f database.CourseBookFormat) fiber.Map {
+	formatMap := fiber.Map{
+		"_id":        strconv.Itoa(f.ID),
+		"courseId":   strconv.Itoa(f.CourseID),
+		"courseCode": f.CourseCode,
+		"courseName": f.CourseName,
+		"format":     f.Format,
+		"status":     f.Status,
+		"attempts":   f.Attempts,
+		"updatedAt":  f.UpdatedAt.Format(time.RFC3339),
+	}
+	if f.FileURL != nil {
+		formatMap["fileUrl"] = *f.FileURL
+	}
+	if f.FileSize != nil {
+		formatMap["fileSize"] = *f.FileSize
+	}
+	if f.ErrorMessage != nil {
+		formatMap["error"] = *f.ErrorMessage
+	}
+	if f.StartedAt != nil {
+		formatMap["startedAt"] = f.StartedAt.Format(time.RFC3339)
+	}
+	if f.CompletedAt != nil {
+		formatMap["completedAt"] = f.CompletedAt.Format(time.RFC3339)
+	}
+	return formatMap
+}
+
+// GetCourseBookFormats returns the conversion status of each accessible
+// format of a course's book
+func GetCourseBookFormats(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	formats, err := database.GetCourseBookFormats(ctx, courseID)
+	if err != nil {
+		log.Printf("[GetCourseBookFormats] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch book formats",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(formats))
+	for _, f := range formats {
+		result = append(result, courseBookFormatToMap(f))
+	}
+	return c.JSON(result)
+}
+
+// GetBookFormatsByStatus returns book formats across all courses in a
+// conversion status, failed by default
+func GetBookFormatsByStatus(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	status := c.Query("status", database.BookFormatFailed)
+	switch status {
+	case database.BookFormatPending, database.BookFormatProcessing, database.BookFormatReady, database.BookFormatFailed:
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "status must be one of pending, processing, ready, failed",
+		})
+	}
+
+	formats, err := database.GetBookFormatsByStatus(ctx, status)
+	if err != nil {
+		log.Printf("[GetBookFormatsByStatus] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch book formats",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(formats))
+	for _, f := range formats {
+		result = append(result, courseBookFormatToMap(f))
+	}
+	return c.JSON(result)
+}
+
+// RetryCourseBookFormats queues the failed formats of a course's book for
+// conversion again, typically after the book was fixed or OCR'd
+func RetryCourseBookFormats(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	queued, err := database.RetryBookFormats(ctx, courseID)
+	if err != nil {
+		log.Printf("[RetryCourseBookFormats] Update error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to retry book conversion",
+		})
+	}
+	if queued > 0 {
+		books.Wake(ctx)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "book conversion queued",
+		"queued":  queued,
+	})
+}
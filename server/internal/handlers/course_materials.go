@@ -0,0 +1,712 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/server/internal/bookings"
+	"github.com/server/internal/books"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+	"github.com/server/internal/pdf"
+	"github.com/server/internal/storage"
+)
+
+// materialsCategory is the storage category of course material files
+const materialsCategory = "materials"
+
+// maxMaterialSize is the largest material file accepted; audio chapters are
+// much larger than documents
+const maxMaterialSize = 50 * 1024 * 1024
+
+// materialContentTypes maps the accepted material file extensions to their
+// MIME types
+var materialContentTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".epub": "application/epub+zip",
+	".txt":  "text/plain; charset=utf-8",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".wav":  "audio/wav",
+	".ogg":  "audio/ogg",
+}
+
+// materialVersionToMap converts a material version to the admin API response format
+func materialVersionToMap(v database.MaterialVersion) fiber.Map {
+	versionMap := fiber.Map{
+		"_id":         strconv.Itoa(v.ID),
+		"version":     v.Version,
+		"fileName":    v.FileName,
+		"fileUrl":     v.FileURL,
+		"contentType": v.ContentType,
+		"size":        v.FileSize,
+		"uploadedAt":  v.CreatedAt.Format(time.RFC3339),
+	}
+	if v.Notes != nil {
+		versionMap["notes"] = *v.Notes
+	}
+	if v.UploadedBy != nil {
+		versionMap["uploadedBy"] = strconv.Itoa(*v.UploadedBy)
+	}
+	return versionMap
+}
+
+// courseMaterialToMap converts a course material to the admin API response format
+func courseMaterialToMap(m database.CourseMaterial) fiber.Map {
+	materialMap := fiber.Map{
+		"_id":       strconv.Itoa(m.ID),
+		"courseId":  strconv.Itoa(m.CourseID),
+		"title":     m.Title,
+		"kind":      m.Kind,
+		"position":  m.Position,
+		"visible":   m.VisibleAt(clock.Now()),
+		"version":   m.Current.Version,
+		"versions":  m.Versions,
+		"file":      materialVersionToMap(m.Current),
+		"createdAt": m.CreatedAt.Format(time.RFC3339),
+		"updatedAt": m.UpdatedAt.Format(time.RFC3339),
+	}
+	if m.Description != nil {
+		materialMap["description"] = *m.Description
+	}
+	if m.VisibleFrom != nil {
+		materialMap["visibleFrom"] = m.VisibleFrom.Format(time.RFC3339)
+	}
+	if m.VisibleUntil != nil {
+		materialMap["visibleUntil"] = m.VisibleUntil.Format(time.RFC3339)
+	}
+	if m.CreatedBy != nil {
+		materialMap["createdBy"] = strconv.Itoa(*m.CreatedBy)
+	}
+	return materialMap
+}
+
+// studentMaterialToMap converts a course material to the student API response format
+func studentMaterialToMap(m database.CourseMaterial) fiber.Map {
+	materialMap := fiber.Map{
+		"_id":         strconv.Itoa(m.ID),
+		"title":       m.Title,
+		"kind":        m.Kind,
+		"position":    m.Position,
+		"version":     m.Current.Version,
+		"fileName":    m.Current.FileName,
+		"contentType": m.Current.ContentType,
+		"size":        m.Current.FileSize,
+		"updatedAt":   m.Current.CreatedAt.Format(time.RFC3339),
+		"url":         fmt.Sprintf("/api/my-courses/%d/materials/%d/file", m.CourseID, m.ID),
+	}
+	if m.Description != nil {
+		materialMap["description"] = *m.Description
+	}
+	if m.VisibleUntil != nil {
+		materialMap["visibleUntil"] = m.VisibleUntil.Format(time.RFC3339)
+	}
+	return materialMap
+}
+
+// courseMaterialErrorResponse maps course material errors to HTTP responses
+func courseMaterialErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case database.ErrMaterialNotFound, database.ErrMaterialVersionNotFound, database.ErrCourseNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Course material error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// CourseMaterialRequest represents a course material create or update request
+type CourseMaterialRequest struct {
+	Title        *string `json:"title"`
+	Description  *string `json:"description"`
+	Kind         *string `json:"kind"`
+	Position     *int    `json:"position"`
+	VisibleFrom  *string `json:"visibleFrom"`  // RFC3339 or YYYY-MM-DD, empty string to clear
+	VisibleUntil *string `json:"visibleUntil"` // RFC3339 or YYYY-MM-DD (through that day), empty string to clear
+}
+
+// apply validates the request and applies it to a material
+func (req CourseMaterialRequest) apply(m *database.CourseMaterial) string {
+	if req.Title != nil {
+		m.Title = strings.TrimSpace(*req.Title)
+	}
+	if m.Title == "" {
+		return "title is required"
+	}
+	if len(m.Title) > 255 {
+		return "title must be at most 255 characters"
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		m.Description = &description
+		if description == "" {
+			m.Description = nil
+		}
+	}
+	if req.Kind != nil {
+		kind := strings.ToLower(strings.TrimSpace(*req.Kind))
+		if !database.ValidMaterialKinds[kind] {
+			return "invalid kind. Must be one of: chapter, notes, audio, other"
+		}
+		m.Kind = kind
+	}
+	if req.Position != nil {
+		if *req.Position < 0 {
+			return "position must not be negative"
+		}
+		m.Position = *req.Position
+	}
+	for _, field := range []struct {
+		name     string
+		value    *string
+		endOfDay bool
+		dest     **time.Time
+	}{
+		{"visibleFrom", req.VisibleFrom, false, &m.VisibleFrom},
+		{"visibleUntil", req.VisibleUntil, true, &m.VisibleUntil},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if strings.TrimSpace(*field.value) == "" {
+			*field.dest = nil
+			continue
+		}
+		t, err := parseMaterialTime(strings.TrimSpace(*field.value), field.endOfDay)
+		if err != nil {
+			return field.name + ": " + err.Error()
+		}
+		*field.dest = &t
+	}
+	if m.VisibleFrom != nil && m.VisibleUntil != nil && !m.VisibleUntil.After(*m.VisibleFrom) {
+		return "visibleUntil must be after visibleFrom"
+	}
+	return ""
+}
+
+// parseMaterialTime parses a visibility time. A date alone means the start of
+// that day in the institution timezone, or with endOfDay the start of the next day so the material
+// stays visible through the date.
+func parseMaterialTime(value string, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	date, err := bookings.ParseDate(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q. Use YYYY-MM-DD or RFC3339", value)
+	}
+	t := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, clock.Location())
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// saveMaterialFile validates and stores the uploaded "file" of a material.
+// Returns a message for the client when the upload is invalid.
+func saveMaterialFile(ctx context.Context, c *fiber.Ctx, courseID int) (*database.MaterialVersion, string, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, "no file provided", nil
+	}
+	if file.Size > maxMaterialSize {
+		return nil, "file size exceeds 50MB limit", nil
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	contentType, ok := materialContentTypes[ext]
+	if !ok {
+		return nil, "invalid file type. Allowed: pdf, epub, txt, docx, pptx, jpg, jpeg, png, mp3, m4a, wav, ogg", nil
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	filename := fmt.Sprintf("course_%d_%s%s", courseID, uuid.New().String(), ext)
+	fileURL, err := storage.Save(ctx, materialsCategory, filename, data, contentType)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := filepath.Base(file.Filename)
+	if len(name) > 255 {
+		name = name[len(name)-255:]
+	}
+	v := &database.MaterialVersion{
+		FileName:    name,
+		FileURL:     fileURL,
+		ContentType: contentType,
+		FileSize:    int64(len(data)),
+	}
+	if notes := strings.TrimSpace(c.FormValue("notes")); notes != "" {
+		v.Notes = &notes
+	}
+	if session := middleware.GetSession(c); session != nil {
+		v.UploadedBy = &session.UserID
+	}
+	return v, "", nil
+}
+
+// removeMaterialFile deletes a stored material file, logging failures
+func removeMaterialFile(ctx context.Context, logPrefix, fileURL string) {
+	category, filename, ok := storage.Locate(fileURL)
+	if !ok {
+		return
+	}
+	if err := storage.Delete(ctx, category, filename); err != nil {
+		log.Printf("[%s] Failed to delete %s: %v", logPrefix, fileURL, err)
+	}
+}
+
+// optionalFormValue returns a form value, or nil when it is empty
+func optionalFormValue(c *fiber.Ctx, key string) *string {
+	return optionalText(c.FormValue(key))
+}
+
+// GetCourseMaterials returns all materials of a course, hidden ones included
+func GetCourseMaterials(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	materials, err := database.GetCourseMaterials(ctx, courseID)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "GetCourseMaterials", "fetch course materials", err)
+	}
+
+	result := make([]fiber.Map, 0, len(materials))
+	for _, m := range materials {
+		result = append(result, courseMaterialToMap(m))
+	}
+	return c.JSON(result)
+}
+
+// CreateCourseMaterial uploads a material to a course. The multipart form
+// carries the file with title, description, kind, position, visibleFrom,
+// visibleUntil and version notes.
+func CreateCourseMaterial(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(60 * time.Second)
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	req := CourseMaterialRequest{
+		Title:        optionalFormValue(c, "title"),
+		Description:  optionalFormValue(c, "description"),
+		Kind:         optionalFormValue(c, "kind"),
+		VisibleFrom:  optionalFormValue(c, "visibleFrom"),
+		VisibleUntil: optionalFormValue(c, "visibleUntil"),
+	}
+	if position := optionalFormValue(c, "position"); position != nil {
+		p, err := strconv.Atoi(*position)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "position must be a number",
+			})
+		}
+		req.Position = &p
+	}
+
+	material := database.CourseMaterial{CourseID: courseID, Kind: "chapter"}
+	if file, err := c.FormFile("file"); err == nil {
+		// Untitled uploads are named after the file, and audio files default
+		// to the audio kind
+		material.Title = strings.TrimSuffix(filepath.Base(file.Filename), filepath.Ext(file.Filename))
+		if strings.HasPrefix(materialContentTypes[strings.ToLower(filepath.Ext(file.Filename))], "audio/") {
+			material.Kind = "audio"
+		}
+	}
+	if msg := req.apply(&material); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	version, msg, err := saveMaterialFile(ctx, c, courseID)
+	if err != nil {
+		log.Printf("[CreateCourseMaterial] File upload error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to upload file",
+		})
+	}
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	material.CreatedBy = version.UploadedBy
+
+	created, err := database.CreateCourseMaterial(ctx, material, *version)
+	if err != nil {
+		removeMaterialFile(ctx, "CreateCourseMaterial", version.FileURL)
+		return courseMaterialErrorResponse(c, "CreateCourseMaterial", "create course material", err)
+	}
+	return c.Status(201).JSON(courseMaterialToMap(*created))
+}
+
+// GetCourseMaterial returns a course material
+func GetCourseMaterial(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	material, err := database.GetCourseMaterial(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "GetCourseMaterial", "fetch course material", err)
+	}
+	return c.JSON(courseMaterialToMap(*material))
+}
+
+// UpdateCourseMaterial updates the details of a course material. Files are
+// replaced by uploading a new version.
+func UpdateCourseMaterial(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	var req CourseMaterialRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	material, err := database.GetCourseMaterial(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "UpdateCourseMaterial", "update course material", err)
+	}
+	if msg := req.apply(material); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	updated, err := database.UpdateCourseMaterial(ctx, *material)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "UpdateCourseMaterial", "update course material", err)
+	}
+	return c.JSON(courseMaterialToMap(*updated))
+}
+
+// DeleteCourseMaterial removes a course material with all its versions
+func DeleteCourseMaterial(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	fileURLs, err := database.DeleteCourseMaterial(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "DeleteCourseMaterial", "delete course material", err)
+	}
+	for _, fileURL := range fileURLs {
+		removeMaterialFile(ctx, "DeleteCourseMaterial", fileURL)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Material deleted successfully",
+	})
+}
+
+// ReorderCourseMaterialsRequest represents a course material reorder request
+type ReorderCourseMaterialsRequest struct {
+	MaterialIDs []int `json:"materialIds"`
+}
+
+// ReorderCourseMaterials sets the order materials are listed in
+func ReorderCourseMaterials(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	var req ReorderCourseMaterialsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.MaterialIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "materialIds is required",
+		})
+	}
+	seen := make(map[int]bool, len(req.MaterialIDs))
+	for _, id := range req.MaterialIDs {
+		if seen[id] {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "materialIds must not contain duplicates",
+			})
+		}
+		seen[id] = true
+	}
+
+	if err := database.ReorderCourseMaterials(ctx, courseID, req.MaterialIDs); err != nil {
+		return courseMaterialErrorResponse(c, "ReorderCourseMaterials", "reorder course materials", err)
+	}
+	return GetCourseMaterials(c)
+}
+
+// GetCourseMaterialVersions returns the version history of a course material
+func GetCourseMaterialVersions(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	material, err := database.GetCourseMaterial(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "GetCourseMaterialVersions", "fetch material versions", err)
+	}
+	versions, err := database.GetMaterialVersions(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "GetCourseMaterialVersions", "fetch material versions", err)
+	}
+
+	result := make([]fiber.Map, 0, len(versions))
+	for _, v := range versions {
+		versionMap := materialVersionToMap(v)
+		versionMap["current"] = v.Version == material.Current.Version
+		result = append(result, versionMap)
+	}
+	return c.JSON(result)
+}
+
+// AddCourseMaterialVersion uploads a new version of a course material, which
+// students get from then on. Earlier versions are kept.
+func AddCourseMaterialVersion(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(60 * time.Second)
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	material, err := database.GetCourseMaterial(ctx, id)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "AddCourseMaterialVersion", "upload material version", err)
+	}
+
+	version, msg, err := saveMaterialFile(ctx, c, material.CourseID)
+	if err != nil {
+		log.Printf("[AddCourseMaterialVersion] File upload error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to upload file",
+		})
+	}
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	updated, err := database.AddMaterialVersion(ctx, id, *version)
+	if err != nil {
+		removeMaterialFile(ctx, "AddCourseMaterialVersion", version.FileURL)
+		return courseMaterialErrorResponse(c, "AddCourseMaterialVersion", "upload material version", err)
+	}
+	return c.Status(201).JSON(courseMaterialToMap(*updated))
+}
+
+// RestoreCourseMaterialVersion makes an earlier version of a course material
+// current again
+func RestoreCourseMaterialVersion(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+	version, err := strconv.Atoi(c.Params("version"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid version format",
+		})
+	}
+
+	updated, err := database.RestoreMaterialVersion(ctx, id, version)
+	if err != nil {
+		return courseMaterialErrorResponse(c, "RestoreCourseMaterialVersion", "restore material version", err)
+	}
+	return c.JSON(courseMaterialToMap(*updated))
+}
+
+// GetMyCourseMaterials lists the materials of a course the current user is
+// enrolled in that are currently visible
+func GetMyCourseMaterials(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "GetMyCourseMaterials", err)
+	}
+	if err := sc.AccessError(); err != nil {
+		return courseAccessErrorResponse(c, "GetMyCourseMaterials", err)
+	}
+
+	materials, err := database.GetVisibleCourseMaterials(ctx, courseID)
+	if err != nil {
+		log.Printf("[GetMyCourseMaterials] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch course materials",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(materials))
+	for _, m := range materials {
+		result = append(result, studentMaterialToMap(m))
+	}
+	return c.JSON(result)
+}
+
+// DownloadMyCourseMaterial streams the current version of a visible course
+// material. PDFs are watermarked personal copies like the course book.
+func DownloadMyCourseMaterial(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(60 * time.Second)
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+	materialID, err := strconv.Atoi(c.Params("materialId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid material id format",
+		})
+	}
+
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseMaterial", err)
+	}
+	if err := sc.AccessError(); err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseMaterial", err)
+	}
+
+	material, err := database.GetCourseMaterial(ctx, materialID)
+	if err == nil && (material.CourseID != courseID || !material.VisibleAt(clock.Now())) {
+		err = database.ErrMaterialNotFound
+	}
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseMaterial", err)
+	}
+
+	category, filename, ok := storage.Locate(material.Current.FileURL)
+	if !ok {
+		log.Printf("[DownloadMyCourseMaterial] Material %d is not in server storage", materialID)
+		return courseAccessErrorResponse(c, "DownloadMyCourseMaterial", database.ErrMaterialNotFound)
+	}
+
+	var obj *storage.Object
+	if material.Current.ContentType == "application/pdf" {
+		obj, err = books.PersonalCopy(ctx, *sc, category, filename)
+		if err == pdf.ErrEncrypted {
+			log.Printf("[DownloadMyCourseMaterial] Material %d is encrypted and can't be watermarked", materialID)
+			return c.Status(422).JSON(fiber.Map{
+				"error": "this material can't be prepared for download, please contact the administrator",
+			})
+		}
+	} else {
+		obj, err = storage.Open(ctx, category, filename)
+	}
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseMaterial", err)
+	}
+
+	c.Set("Content-Type", material.Current.ContentType)
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", unsafeFilenameChars.ReplaceAllString(material.Current.FileName, "_")))
+	c.Set("Cache-Control", "private, no-store")
+	return sendRanged(c, obj)
+}
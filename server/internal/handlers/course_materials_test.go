@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+func TestCourseMaterialRequestApply(t *testing.T) {
+	str := func(s string) *string { return &s }
+	ist := clock.Location()
+
+	tests := []struct {
+		name      string
+		req       CourseMaterialRequest
+		wantError string
+		wantFrom  *time.Time
+		wantUntil *time.Time
+	}{
+		{
+			name:      "dates cover whole days in IST",
+			req:       CourseMaterialRequest{VisibleFrom: str("2026-03-01"), VisibleUntil: str("2026-03-31")},
+			wantFrom:  ptrTime(time.Date(2026, 3, 1, 0, 0, 0, 0, ist)),
+			wantUntil: ptrTime(time.Date(2026, 4, 1, 0, 0, 0, 0, ist)),
+		},
+		{
+			name:     "RFC3339 times are exact",
+			req:      CourseMaterialRequest{VisibleFrom: str("2026-03-01T09:30:00Z")},
+			wantFrom: ptrTime(time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)),
+		},
+		{
+			name:      "same day from and until",
+			req:       CourseMaterialRequest{VisibleFrom: str("2026-03-01"), VisibleUntil: str("2026-03-01")},
+			wantFrom:  ptrTime(time.Date(2026, 3, 1, 0, 0, 0, 0, ist)),
+			wantUntil: ptrTime(time.Date(2026, 3, 2, 0, 0, 0, 0, ist)),
+		},
+		{
+			name:      "until before from",
+			req:       CourseMaterialRequest{VisibleFrom: str("2026-03-05"), VisibleUntil: str("2026-03-01T00:00:00Z")},
+			wantError: "visibleUntil must be after visibleFrom",
+		},
+		{
+			name:      "invalid date",
+			req:       CourseMaterialRequest{VisibleFrom: str("01/03/2026")},
+			wantError: `visibleFrom: invalid time "01/03/2026". Use YYYY-MM-DD or RFC3339`,
+		},
+		{
+			name:      "invalid kind",
+			req:       CourseMaterialRequest{Kind: str("video")},
+			wantError: "invalid kind. Must be one of: chapter, notes, audio, other",
+		},
+		{
+			name:      "blank title",
+			req:       CourseMaterialRequest{Title: str("  ")},
+			wantError: "title is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := database.CourseMaterial{Title: "Chapter 1", Kind: "chapter"}
+			if got := tt.req.apply(&m); got != tt.wantError {
+				t.Fatalf("apply() = %q, want %q", got, tt.wantError)
+			}
+			if tt.wantError != "" {
+				return
+			}
+			if !sameTime(m.VisibleFrom, tt.wantFrom) || !sameTime(m.VisibleUntil, tt.wantUntil) {
+				t.Errorf("visible = %v - %v, want %v - %v", m.VisibleFrom, m.VisibleUntil, tt.wantFrom, tt.wantUntil)
+			}
+		})
+	}
+
+	// Empty strings clear the visibility window
+	m := database.CourseMaterial{Title: "Notes", Kind: "notes", VisibleFrom: ptrTime(time.Now())}
+	if msg := (CourseMaterialRequest{VisibleFrom: str("")}).apply(&m); msg != "" || m.VisibleFrom != nil {
+		t.Errorf("clearing visibleFrom: apply() = %q, VisibleFrom = %v", msg, m.VisibleFrom)
+	}
+}
+
+func ptrTime(t time.Time) *time.Time { return &t }
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
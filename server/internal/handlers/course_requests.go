@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/enrollments"
+	"github.com/server/internal/middleware"
+)
+
+// Course request field limits
+const (
+	maxCourseRequestReason = 2000
+	maxCourseRequestTitle  = 255
+	maxCourseRequestCode   = 50
+	maxCourseRequestNote   = 2000
+)
+
+// courseRequestToMap converts a course request to its JSON representation.
+// Students only see the course as the course shows itself to them.
+func courseRequestToMap(r database.CourseRequest, forAdmin bool) fiber.Map {
+	m := fiber.Map{
+		"_id":       strconv.Itoa(r.ID),
+		"reason":    r.Reason,
+		"status":    r.Status,
+		"createdAt": r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.CourseID != nil {
+		m["courseId"] = strconv.Itoa(*r.CourseID)
+	}
+	if r.CourseTitle != nil {
+		m["courseTitle"] = *r.CourseTitle
+	}
+	if r.Title != nil {
+		m["title"] = *r.Title
+	}
+	if r.Author != nil {
+		m["author"] = *r.Author
+	}
+	if r.Code != nil {
+		m["code"] = *r.Code
+	}
+	if r.AdminComment != nil {
+		m["adminComment"] = *r.AdminComment
+	}
+	if r.ReviewedAt != nil {
+		m["reviewedAt"] = r.ReviewedAt.Format(time.RFC3339)
+	}
+	if r.Outcome != nil {
+		m["outcome"] = *r.Outcome
+	}
+	if r.UpdatedAt.After(r.CreatedAt) {
+		m["updatedAt"] = r.UpdatedAt.Format(time.RFC3339)
+	}
+
+	if forAdmin {
+		m["userId"] = strconv.Itoa(r.UserID)
+		m["userName"] = r.UserName
+		m["userEmail"] = r.Email
+		if r.EnrollmentNumber != nil {
+			m["enrollmentNumber"] = *r.EnrollmentNumber
+		}
+		if r.CourseName != nil {
+			m["courseName"] = *r.CourseName
+		}
+		if r.CourseCode != nil {
+			m["courseCode"] = *r.CourseCode
+		}
+		if r.ReviewedBy != nil {
+			m["reviewedBy"] = strconv.Itoa(*r.ReviewedBy)
+		}
+		if r.ReviewerName != nil {
+			m["reviewerName"] = *r.ReviewerName
+		}
+	}
+	return m
+}
+
+// courseRequestErrorResponse maps course request errors to HTTP responses
+func courseRequestErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case database.ErrCourseRequestNotFound, database.ErrCourseNotFound, database.ErrUserNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrCourseRequestNotPending, database.ErrCourseRequestDuplicate,
+		database.ErrAlreadyEnrolled, database.ErrAlreadyWaitlisted:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrCourseRequestNeedsCourse:
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Course request error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// optionalText trims a request field and returns nil when it is empty
+func optionalText(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	return &value
+}
+
+// GetCourseCatalog returns the courses students can ask to join, with the
+// current user's enrollment, waitlist and request standing in each
+func GetCourseCatalog(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courses, err := database.GetCourseCatalog(ctx, session.UserID, strings.TrimSpace(c.Query("search")))
+	if err != nil {
+		log.Printf("[GetCourseCatalog] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch courses",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(courses))
+	for _, cc := range courses {
+		m := fiber.Map{
+			"_id":        strconv.Itoa(cc.ID),
+			"title":      cc.Title,
+			"hasBook":    cc.HasBook,
+			"enrolled":   cc.Enrolled,
+			"waitlisted": cc.Waitlisted,
+			"requested":  cc.Requested,
+		}
+		if cc.Author != nil {
+			m["author"] = *cc.Author
+		}
+		if cc.Department != nil {
+			m["department"] = *cc.Department
+		}
+		if cc.ToDate != nil {
+			m["toDate"] = cc.ToDate.Format("2006-01-02")
+		}
+		result = append(result, m)
+	}
+	return c.JSON(result)
+}
+
+// StudentCourseRequest represents a student's course request: either an
+// existing courseId, or the title (with optional author and code) of a book
+// that is not in the system
+type StudentCourseRequest struct {
+	CourseID *int   `json:"courseId"`
+	Title    string `json:"title"`
+	Author   string `json:"author"`
+	Code     string `json:"code"`
+	Reason   string `json:"reason"`
+}
+
+// validate checks a course request. Returns a message for the client when
+// it is invalid.
+func (r *StudentCourseRequest) validate() string {
+	r.Title = strings.TrimSpace(r.Title)
+	r.Author = strings.TrimSpace(r.Author)
+	r.Code = strings.TrimSpace(r.Code)
+	r.Reason = strings.TrimSpace(r.Reason)
+
+	switch {
+	case r.Reason == "":
+		return "reason is required"
+	case len(r.Reason) > maxCourseRequestReason:
+		return "reason must be at most 2000 characters"
+	case r.CourseID != nil && (r.Title != "" || r.Author != "" || r.Code != ""):
+		return "provide either courseId or the title of a new book, not both"
+	case r.CourseID == nil && r.Title == "":
+		return "courseId or title is required"
+	case len(r.Title) > maxCourseRequestTitle || len(r.Author) > maxCourseRequestTitle:
+		return "title and author must be at most 255 characters"
+	case len(r.Code) > maxCourseRequestCode:
+		return "code must be at most 50 characters"
+	}
+	return ""
+}
+
+// SubmitCourseRequest lets the current user ask to join a course or for a
+// book that is not in the system. Admins are told by email.
+func SubmitCourseRequest(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req StudentCourseRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if msg := req.validate(); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	request, err := database.CreateCourseRequest(ctx, session.UserID, req.CourseID,
+		optionalText(req.Title), optionalText(req.Author), optionalText(req.Code), req.Reason)
+	if err != nil {
+		return courseRequestErrorResponse(c, "SubmitCourseRequest", "submit course request", err)
+	}
+	enrollments.NotifyRequestSubmitted(request)
+
+	return c.Status(201).JSON(courseRequestToMap(*request, false))
+}
+
+// GetMyCourseRequests returns the current user's course requests
+func GetMyCourseRequests(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	requests, err := database.GetCourseRequests(ctx, database.CourseRequestFilter{UserID: &session.UserID})
+	if err != nil {
+		return courseRequestErrorResponse(c, "GetMyCourseRequests", "fetch course requests", err)
+	}
+
+	result := make([]fiber.Map, 0, len(requests))
+	for _, r := range requests {
+		result = append(result, courseRequestToMap(r, false))
+	}
+	return c.JSON(result)
+}
+
+// CancelMyCourseRequest withdraws one of the current user's pending requests
+func CancelMyCourseRequest(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course request id format",
+		})
+	}
+
+	request, err := database.CancelCourseRequest(ctx, id, session.UserID)
+	if err != nil {
+		return courseRequestErrorResponse(c, "CancelMyCourseRequest", "cancel course request", err)
+	}
+	return c.JSON(courseRequestToMap(*request, false))
+}
+
+// GetCourseRequests returns course requests, pending ones first. The status
+// query parameter filters them.
+func GetCourseRequests(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	status := strings.ToLower(c.Query("status"))
+	if status != "" && !database.ValidCourseRequestStatuses[status] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid status",
+		})
+	}
+
+	requests, err := database.GetCourseRequests(ctx, database.CourseRequestFilter{Status: status})
+	if err != nil {
+		return courseRequestErrorResponse(c, "GetCourseRequests", "fetch course requests", err)
+	}
+
+	result := make([]fiber.Map, 0, len(requests))
+	for _, r := range requests {
+		result = append(result, courseRequestToMap(r, true))
+	}
+	return c.JSON(result)
+}
+
+// GetCourseRequest returns a course request
+func GetCourseRequest(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course request id format",
+		})
+	}
+
+	request, err := database.GetCourseRequest(ctx, id)
+	if err != nil {
+		return courseRequestErrorResponse(c, "GetCourseRequest", "fetch course request", err)
+	}
+	return c.JSON(courseRequestToMap(*request, true))
+}
+
+// ReviewCourseRequestRequest represents an admin decision on a course request
+type ReviewCourseRequestRequest struct {
+	Comment    string `json:"comment"`
+	CourseID   *int   `json:"courseId"`             // Course created for a new book; approval only
+	ExpiryDate string `json:"expiryDate,omitempty"` // Enrollment expiry; approval only
+}
+
+// ApproveCourseRequest approves a pending course request and enrolls the
+// student as EnrollStudent would, waitlisting them when the course is full.
+// A request for a new book needs the courseId of the course created for it.
+// The student is told by email.
+func ApproveCourseRequest(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course request id format",
+		})
+	}
+
+	var req ReviewCourseRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if len(req.Comment) > maxCourseRequestNote {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "comment must be at most 2000 characters",
+		})
+	}
+	expiryDate, err := parseEnrollmentExpiry(req.ExpiryDate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid expiry date format. Use YYYY-MM-DD",
+		})
+	}
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	request, result, err := database.ApproveCourseRequest(ctx, id, req.CourseID, expiryDate, session.UserID, optionalText(req.Comment))
+	if err != nil {
+		return courseRequestErrorResponse(c, "ApproveCourseRequest", "approve course request", err)
+	}
+	enrollments.NotifyRequestReviewed(request, result)
+
+	response := courseRequestToMap(*request, true)
+	if result.Status == database.EnrollmentWaitlisted {
+		response["waitlistId"] = strconv.Itoa(result.WaitlistID)
+		response["position"] = result.Position
+	} else {
+		response["enrollmentId"] = strconv.Itoa(result.EnrollmentID)
+	}
+	return c.JSON(response)
+}
+
+// RejectCourseRequest rejects a pending course request. The comment is
+// required and sent to the student by email.
+func RejectCourseRequest(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course request id format",
+		})
+	}
+
+	var req ReviewCourseRequestRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	req.Comment = strings.TrimSpace(req.Comment)
+	if req.Comment == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "comment is required to reject a request",
+		})
+	}
+	if len(req.Comment) > maxCourseRequestNote {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "comment must be at most 2000 characters",
+		})
+	}
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	request, err := database.RejectCourseRequest(ctx, id, session.UserID, req.Comment)
+	if err != nil {
+		return courseRequestErrorResponse(c, "RejectCourseRequest", "reject course request", err)
+	}
+	enrollments.NotifyRequestReviewed(request, nil)
+
+	return c.JSON(courseRequestToMap(*request, true))
+}
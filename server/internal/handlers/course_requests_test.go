@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStudentCourseRequestValidate(t *testing.T) {
+	courseID := 3
+
+	tests := []struct {
+		name    string
+		req     StudentCourseRequest
+		wantMsg string
+	}{
+		{"existing course", StudentCourseRequest{CourseID: &courseID, Reason: "Needed for my exam"}, ""},
+		{"new book", StudentCourseRequest{Title: " Linear Algebra ", Author: "Strang", Reason: "Not in the library"}, ""},
+		{"reason required", StudentCourseRequest{CourseID: &courseID, Reason: "  "}, "reason is required"},
+		{"course or title required", StudentCourseRequest{Author: "Strang", Reason: "Please"}, "courseId or title is required"},
+		{"not both", StudentCourseRequest{CourseID: &courseID, Title: "Algebra", Reason: "Please"}, "provide either courseId or the title of a new book, not both"},
+		{"long reason", StudentCourseRequest{CourseID: &courseID, Reason: strings.Repeat("a", 2001)}, "reason must be at most 2000 characters"},
+		{"long code", StudentCourseRequest{Title: "Algebra", Code: strings.Repeat("M", 51), Reason: "Please"}, "code must be at most 50 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.req.validate(); got != tt.wantMsg {
+				t.Errorf("validate() = %q, want %q", got, tt.wantMsg)
+			}
+		})
+	}
+}
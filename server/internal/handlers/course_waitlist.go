@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/enrollments"
+)
+
+// waitlistEntryToMap converts a waitlist entry to its JSON representation
+func waitlistEntryToMap(e database.WaitlistEntry) fiber.Map {
+	m := fiber.Map{
+		"_id":       strconv.Itoa(e.ID),
+		"courseId":  strconv.Itoa(e.CourseID),
+		"userId":    strconv.Itoa(e.UserID),
+		"position":  e.Position,
+		"userName":  e.UserName,
+		"userEmail": e.Email,
+		"createdAt": e.CreatedAt.Format(time.RFC3339),
+	}
+	if e.EnrollmentNumber != nil {
+		m["enrollmentNumber"] = *e.EnrollmentNumber
+	}
+	if e.ExpiryDate != nil {
+		m["expiryDate"] = e.ExpiryDate.In(clock.Location()).Format("2006-01-02")
+		m["expiryDateTime"] = e.ExpiryDate.UTC().Format(time.RFC3339)
+	}
+	if e.AddedBy != nil {
+		m["addedBy"] = strconv.Itoa(*e.AddedBy)
+	}
+	return m
+}
+
+// courseCapacityToMap converts the capacity of a course to its JSON representation
+func courseCapacityToMap(cc *database.CourseCapacity) fiber.Map {
+	m := fiber.Map{
+		"activeStudents": cc.Active,
+		"waitlistCount":  cc.Waitlisted,
+	}
+	if cc.MaxStudents != nil {
+		m["maxStudents"] = *cc.MaxStudents
+		m["freePlaces"] = max(*cc.MaxStudents-cc.Active, 0)
+	}
+	return m
+}
+
+// GetCourseWaitlist returns a course's capacity and its waitlist in promotion order
+func GetCourseWaitlist(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	capacity, err := database.GetCourseCapacity(ctx, courseID)
+	if err != nil {
+		return enrollmentErrorResponse(c, "GetCourseWaitlist", "fetch waitlist", err)
+	}
+	entries, err := database.GetCourseWaitlist(ctx, courseID)
+	if err != nil {
+		return enrollmentErrorResponse(c, "GetCourseWaitlist", "fetch waitlist", err)
+	}
+
+	waitlist := make([]fiber.Map, 0, len(entries))
+	for _, e := range entries {
+		waitlist = append(waitlist, waitlistEntryToMap(e))
+	}
+	return c.JSON(fiber.Map{
+		"capacity": courseCapacityToMap(capacity),
+		"waitlist": waitlist,
+	})
+}
+
+// ReorderWaitlistRequest represents a waitlist reorder request
+type ReorderWaitlistRequest struct {
+	WaitlistIDs []int `json:"waitlistIds"`
+}
+
+// ReorderCourseWaitlist sets the order in which waitlisted students are
+// promoted. The request must list every waitlist entry of the course.
+func ReorderCourseWaitlist(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	var req ReorderWaitlistRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.WaitlistIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "waitlistIds is required",
+		})
+	}
+	seen := make(map[int]bool, len(req.WaitlistIDs))
+	for _, id := range req.WaitlistIDs {
+		if seen[id] {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "waitlistIds must not contain duplicates",
+			})
+		}
+		seen[id] = true
+	}
+
+	if err := database.ReorderWaitlist(ctx, courseID, req.WaitlistIDs); err != nil {
+		return enrollmentErrorResponse(c, "ReorderCourseWaitlist", "reorder waitlist", err)
+	}
+	return GetCourseWaitlist(c)
+}
+
+// RemoveFromWaitlist takes a student off a course's waitlist
+func RemoveFromWaitlist(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid waitlist entry id format",
+		})
+	}
+
+	if err := database.RemoveFromWaitlist(ctx, id); err != nil {
+		return enrollmentErrorResponse(c, "RemoveFromWaitlist", "remove from waitlist", err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "student removed from the waitlist",
+	})
+}
+
+// CourseCapacityRequest represents a course capacity update. A null
+// maxStudents removes the limit.
+type CourseCapacityRequest struct {
+	MaxStudents *int `json:"maxStudents"`
+}
+
+// UpdateCourseCapacity sets the maximum number of students enrolled in a
+// course at once. Places added by raising the capacity are offered to the
+// waitlist; lowering it below the current enrollments keeps those students.
+func UpdateCourseCapacity(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	var req CourseCapacityRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.MaxStudents != nil && *req.MaxStudents < 1 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "maxStudents must be at least 1",
+		})
+	}
+
+	if err := database.SetCourseCapacity(ctx, courseID, req.MaxStudents); err != nil {
+		return enrollmentErrorResponse(c, "UpdateCourseCapacity", "update capacity", err)
+	}
+	enrollments.Promote(courseID)
+
+	capacity, err := database.GetCourseCapacity(ctx, courseID)
+	if err != nil {
+		return enrollmentErrorResponse(c, "UpdateCourseCapacity", "update capacity", err)
+	}
+	return c.JSON(fiber.Map{
+		"message":  "course capacity updated",
+		"capacity": courseCapacityToMap(capacity),
+	})
+}
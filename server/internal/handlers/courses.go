@@ -20,6 +20,8 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5"
 
+	"github.com/server/internal/books"
+	"github.com/server/internal/clock"
 	"github.com/server/internal/config"
 	"github.com/server/internal/database"
 )
@@ -60,9 +62,10 @@ func GetCourses(c *fiber.Ctx) error {
 		query = `
 			SELECT c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 			       c.show_course_name, c.show_course_code, c.to_date,
-			       c.created_at, c.updated_at,
+			       c.created_at, c.updated_at, c.max_students,
+			       (SELECT COUNT(*) FROM course_waitlist w WHERE w.course_id = c.id) as waitlist_count,
 			       COUNT(DISTINCT CASE
-			           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR (cs.expiry_date AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Kolkata') > (NOW() AT TIME ZONE 'Asia/Kolkata')) THEN cs.id
+			           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR cs.expiry_date > NOW()) THEN cs.id
 			           ELSE NULL
 			       END) as active_students
 			FROM courses c
@@ -70,7 +73,7 @@ func GetCourses(c *fiber.Ctx) error {
 			WHERE LOWER(c.code) LIKE LOWER($1) OR LOWER(c.name) LIKE LOWER($1) OR LOWER(c.department) LIKE LOWER($1)
 			GROUP BY c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 			         c.show_course_name, c.show_course_code, c.to_date,
-			         c.created_at, c.updated_at
+			         c.created_at, c.updated_at, c.max_students
 			ORDER BY c.created_at DESC
 		`
 		searchPattern := "%" + search + "%"
@@ -79,16 +82,17 @@ func GetCourses(c *fiber.Ctx) error {
 		query = `
 			SELECT c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 			       c.show_course_name, c.show_course_code, c.to_date,
-			       c.created_at, c.updated_at,
+			       c.created_at, c.updated_at, c.max_students,
+			       (SELECT COUNT(*) FROM course_waitlist w WHERE w.course_id = c.id) as waitlist_count,
 			       COUNT(DISTINCT CASE
-			           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR (cs.expiry_date AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Kolkata') > (NOW() AT TIME ZONE 'Asia/Kolkata')) THEN cs.id
+			           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR cs.expiry_date > NOW()) THEN cs.id
 			           ELSE NULL
 			       END) as active_students
 			FROM courses c
 			LEFT JOIN course_students cs ON c.id = cs.course_id
 			GROUP BY c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 			         c.show_course_name, c.show_course_code, c.to_date,
-			         c.created_at, c.updated_at
+			         c.created_at, c.updated_at, c.max_students
 			ORDER BY c.created_at DESC
 		`
 		rows, err = database.GetPool().Query(ctx, query)
@@ -124,13 +128,15 @@ func GetCourses(c *fiber.Ctx) error {
 			ToDate         *time.Time
 			CreatedAt      time.Time
 			UpdatedAt      time.Time
+			MaxStudents    *int
+			WaitlistCount  int
 			ActiveStudents int
 		)
 
 		err := rows.Scan(
 			&ID, &Code, &Name, &Author, &Department, &BookPdfURL, &BookPdfPath,
 			&ShowCourseName, &ShowCourseCode, &ToDate,
-			&CreatedAt, &UpdatedAt, &ActiveStudents,
+			&CreatedAt, &UpdatedAt, &MaxStudents, &WaitlistCount, &ActiveStudents,
 		)
 		if err != nil {
 			log.Printf("[GetCourses] Scan error: %v", err)
@@ -144,9 +150,14 @@ func GetCourses(c *fiber.Ctx) error {
 			"showCourseName": ShowCourseName,
 			"showCourseCode": ShowCourseCode,
 			"activeStudents": ActiveStudents,
+			"waitlistCount":  WaitlistCount,
 			"createdAt":      CreatedAt.Format(time.RFC3339),
 		}
 
+		if MaxStudents != nil {
+			courseMap["maxStudents"] = *MaxStudents
+		}
+
 		if Author != nil {
 			courseMap["author"] = *Author
 		}
@@ -196,9 +207,10 @@ func GetCourseByID(c *fiber.Ctx) error {
 	query := `
 		SELECT c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 		       c.show_course_name, c.show_course_code, c.to_date,
-		       c.created_at, c.updated_at,
+		       c.created_at, c.updated_at, c.max_students,
+		       (SELECT COUNT(*) FROM course_waitlist w WHERE w.course_id = c.id) as waitlist_count,
 		       COUNT(DISTINCT CASE
-		           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR (cs.expiry_date AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Kolkata') > (NOW() AT TIME ZONE 'Asia/Kolkata')) THEN cs.id
+		           WHEN cs.id IS NOT NULL AND (cs.expiry_date IS NULL OR cs.expiry_date > NOW()) THEN cs.id
 		           ELSE NULL
 		       END) as active_students
 		FROM courses c
@@ -206,7 +218,7 @@ func GetCourseByID(c *fiber.Ctx) error {
 		WHERE c.id = $1
 		GROUP BY c.id, c.code, c.name, c.author, c.department, c.book_pdf_url, c.book_pdf_path,
 		         c.show_course_name, c.show_course_code, c.to_date,
-		         c.created_at, c.updated_at
+		         c.created_at, c.updated_at, c.max_students
 		LIMIT 1
 	`
 
@@ -223,13 +235,15 @@ func GetCourseByID(c *fiber.Ctx) error {
 		ToDate         *time.Time
 		CreatedAt      time.Time
 		UpdatedAt      time.Time
+		MaxStudents    *int
+		WaitlistCount  int
 		ActiveStudents int
 	)
 
 	err := database.GetPool().QueryRow(ctx, query, id).Scan(
 		&ID, &Code, &Name, &Author, &Department, &BookPdfURL, &BookPdfPath,
 		&ShowCourseName, &ShowCourseCode, &ToDate,
-		&CreatedAt, &UpdatedAt, &ActiveStudents,
+		&CreatedAt, &UpdatedAt, &MaxStudents, &WaitlistCount, &ActiveStudents,
 	)
 
 	if err != nil {
@@ -251,9 +265,14 @@ func GetCourseByID(c *fiber.Ctx) error {
 		"showCourseName": ShowCourseName,
 		"showCourseCode": ShowCourseCode,
 		"activeStudents": ActiveStudents,
+		"waitlistCount":  WaitlistCount,
 		"createdAt":      CreatedAt.Format(time.RFC3339),
 	}
 
+	if MaxStudents != nil {
+		courseMap["maxStudents"] = *MaxStudents
+	}
+
 	if Author != nil {
 		courseMap["author"] = *Author
 	}
@@ -642,6 +661,9 @@ func CreateCourseWithPdf(c *fiber.Ctx) error {
 		courseMap["toDate"] = ToDate.Format("2006-01-02")
 	}
 
+	// Convert the book to accessible formats in the background
+	books.QueueConversion(ctx, ID)
+
 	return c.Status(201).JSON(courseMap)
 }
 
@@ -649,7 +671,7 @@ func CreateCourseWithPdf(c *fiber.Ctx) error {
 func uploadCoursePdf(c *fiber.Ctx, fileHeader *multipart.FileHeader) (string, string, error) {
 	// Generate unique filename
 	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
-	filename := fmt.Sprintf("course_%d_%d%s", time.Now().Unix(), time.Now().UnixNano()%1000000, ext)
+	filename := fmt.Sprintf("course_%d_%d%s", clock.Now().Unix(), clock.Now().UnixNano()%1000000, ext)
 
 	var fileURL string
 	var filePath string
@@ -1188,6 +1210,9 @@ func UpdateCourseWithPdf(c *fiber.Ctx) error {
 		})
 	}
 
+	// Convert a replaced book to accessible formats in the background
+	books.QueueConversion(ctx, existingID)
+
 	// Fetch updated course
 	return GetCourseByID(c)
 }
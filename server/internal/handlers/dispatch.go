@@ -0,0 +1,374 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/dispatch"
+	"github.com/server/internal/middleware"
+)
+
+// driverShiftToMap converts a driver shift to the API response format
+func driverShiftToMap(s database.DriverShift) fiber.Map {
+	return fiber.Map{
+		"_id":       strconv.Itoa(s.ID),
+		"dayOfWeek": s.DayOfWeek,
+		"startTime": s.StartTime,
+		"endTime":   s.EndTime,
+	}
+}
+
+// driverAvailabilityToMap converts a driver's availability to the API response format
+func driverAvailabilityToMap(d database.DriverAvailability, now time.Time) fiber.Map {
+	availabilityMap := driverMatchToMap(d.DriverMatch)
+	availabilityMap["onDuty"] = d.OnDuty
+	availabilityMap["onShift"] = dispatch.OnShift(d.Shifts, now)
+	if d.OnDutySince != nil {
+		availabilityMap["onDutySince"] = d.OnDutySince.Format(time.RFC3339)
+	}
+	shifts := make([]fiber.Map, 0, len(d.Shifts))
+	for _, s := range d.Shifts {
+		shifts = append(shifts, driverShiftToMap(s))
+	}
+	availabilityMap["shifts"] = shifts
+	return availabilityMap
+}
+
+// driverRideToMap converts a driver's ride to the API response format
+func driverRideToMap(r database.DriverRide) fiber.Map {
+	rideMap := fiber.Map{
+		"_id":                strconv.Itoa(r.BillID),
+		"studentName":        r.StudentName,
+		"fromLocation":       r.FromLocation,
+		"toLocation":         r.ToLocation,
+		"rideAt":             r.RideAt.Format(time.RFC3339),
+		"accessibilityNeeds": r.AccessibilityNeeds,
+		"dispatchStatus":     r.DispatchStatus,
+	}
+	if r.OfferedAt != nil {
+		rideMap["offeredAt"] = r.OfferedAt.Format(time.RFC3339)
+	}
+	if r.AcceptedAt != nil {
+		rideMap["acceptedAt"] = r.AcceptedAt.Format(time.RFC3339)
+	}
+	return rideMap
+}
+
+// dispatchErrorResponse maps dispatch errors to HTTP responses
+func dispatchErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrDriverNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "driver not found",
+		})
+	case database.ErrBillNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride bill not found",
+		})
+	case database.ErrOfferNotFound, database.ErrRideNotDispatchable:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Dispatch error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to update dispatch",
+	})
+}
+
+// DutyRequest represents an on/off duty toggle
+type DutyRequest struct {
+	OnDuty *bool `json:"onDuty"`
+}
+
+// setDriverDuty applies a duty toggle for the given driver
+func setDriverDuty(c *fiber.Ctx, logPrefix string, driverID int) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req DutyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.OnDuty == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "onDuty is required",
+		})
+	}
+
+	driver, err := database.SetDriverOnDuty(ctx, driverID, *req.OnDuty)
+	if err != nil {
+		return dispatchErrorResponse(c, logPrefix, err)
+	}
+	return c.JSON(driverAvailabilityToMap(*driver, clock.Now()))
+}
+
+// GetMyDutyStatus returns the current driver's duty state, shifts and vehicle
+func GetMyDutyStatus(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	driver, err := database.GetDriverAvailabilityByID(ctx, session.UserID)
+	if err != nil {
+		return dispatchErrorResponse(c, "GetMyDutyStatus", err)
+	}
+	return c.JSON(driverAvailabilityToMap(*driver, clock.Now()))
+}
+
+// UpdateMyDutyStatus puts the current driver on or off duty
+func UpdateMyDutyStatus(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	return setDriverDuty(c, "UpdateMyDutyStatus", session.UserID)
+}
+
+// GetMyDriverRides returns the upcoming rides offered to or accepted by the current driver
+func GetMyDriverRides(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	rides, err := database.GetDriverRides(ctx, session.UserID, clock.Now().Add(-12*time.Hour))
+	if err != nil {
+		log.Printf("[GetMyDriverRides] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch rides",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(rides))
+	for _, r := range rides {
+		result = append(result, driverRideToMap(r))
+	}
+	return c.JSON(result)
+}
+
+// respondToRideOffer records the current driver's answer to a ride offer
+func respondToRideOffer(c *fiber.Ctx, logPrefix string, accept bool) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	if err := database.RespondToOffer(ctx, billID, session.UserID, accept); err != nil {
+		return dispatchErrorResponse(c, logPrefix, err)
+	}
+
+	if accept {
+		return c.JSON(fiber.Map{
+			"message": "Ride accepted",
+		})
+	}
+
+	// Offer the ride to the next driver straight away
+	if ride, err := database.GetDispatchRide(ctx, billID); err == nil {
+		dispatch.DispatchIfDue(ctx, ride.ID, ride.RideAt)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Ride declined",
+	})
+}
+
+// AcceptRideOffer accepts a ride offered to the current driver
+func AcceptRideOffer(c *fiber.Ctx) error {
+	return respondToRideOffer(c, "AcceptRideOffer", true)
+}
+
+// DeclineRideOffer declines a ride offered to the current driver. The ride is
+// offered to the next available driver.
+func DeclineRideOffer(c *fiber.Ctx) error {
+	return respondToRideOffer(c, "DeclineRideOffer", false)
+}
+
+// GetMyShifts returns the current driver's weekly shifts
+func GetMyShifts(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	return driverShiftsResponse(c, "GetMyShifts", session.UserID)
+}
+
+// driverShiftsResponse writes a driver's weekly shifts
+func driverShiftsResponse(c *fiber.Ctx, logPrefix string, driverID int) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	shifts, err := database.GetDriverShifts(ctx, driverID)
+	if err != nil {
+		return dispatchErrorResponse(c, logPrefix, err)
+	}
+
+	result := make([]fiber.Map, 0, len(shifts))
+	for _, s := range shifts {
+		result = append(result, driverShiftToMap(s))
+	}
+	return c.JSON(result)
+}
+
+// GetDriverShifts returns a driver's weekly shifts
+func GetDriverShifts(c *fiber.Ctx) error {
+	driverID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+	return driverShiftsResponse(c, "GetDriverShifts", driverID)
+}
+
+// DriverShiftsRequest replaces a driver's weekly shift schedule
+type DriverShiftsRequest struct {
+	Shifts []struct {
+		DayOfWeek int32  `json:"dayOfWeek"` // 0 = Sunday ... 6 = Saturday
+		StartTime string `json:"startTime"` // HH:MM
+		EndTime   string `json:"endTime"`   // HH:MM, at or before startTime for overnight shifts
+	} `json:"shifts"`
+}
+
+// UpdateDriverShifts replaces a driver's weekly shift schedule. An empty
+// schedule makes the driver available whenever they are on duty.
+func UpdateDriverShifts(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	driverID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+
+	var req DriverShiftsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	shifts := make([]database.DriverShift, 0, len(req.Shifts))
+	for _, s := range req.Shifts {
+		shifts = append(shifts, database.DriverShift{
+			DayOfWeek: s.DayOfWeek,
+			StartTime: strings.TrimSpace(s.StartTime),
+			EndTime:   strings.TrimSpace(s.EndTime),
+		})
+	}
+	shifts, err = dispatch.NormalizeShifts(shifts)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	saved, err := database.ReplaceDriverShifts(ctx, driverID, shifts)
+	if err != nil {
+		return dispatchErrorResponse(c, "UpdateDriverShifts", err)
+	}
+
+	result := make([]fiber.Map, 0, len(saved))
+	for _, s := range saved {
+		result = append(result, driverShiftToMap(s))
+	}
+	return c.JSON(result)
+}
+
+// UpdateDriverDuty puts a driver on or off duty on their behalf
+func UpdateDriverDuty(c *fiber.Ctx) error {
+	driverID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+	return setDriverDuty(c, "UpdateDriverDuty", driverID)
+}
+
+// GetDriverAvailability lists active drivers with their duty state, shifts,
+// vehicle and load. Pass onDuty=true to only list drivers on duty.
+func GetDriverAvailability(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	drivers, err := database.GetDriverAvailability(ctx, nil, c.Query("onDuty") == "true")
+	if err != nil {
+		log.Printf("[GetDriverAvailability] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch drivers",
+		})
+	}
+
+	now := clock.Now()
+	result := make([]fiber.Map, 0, len(drivers))
+	for _, d := range drivers {
+		result = append(result, driverAvailabilityToMap(d, now))
+	}
+	return c.JSON(result)
+}
+
+// DispatchRideBill offers a ride waiting for a driver to the best available
+// driver right away, regardless of how far off the ride is
+func DispatchRideBill(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	match, err := dispatch.Dispatch(ctx, billID)
+	if err != nil {
+		return dispatchErrorResponse(c, "DispatchRideBill", err)
+	}
+	if match == nil {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "no available driver can serve this ride",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"message": "Ride offered to driver",
+		"driver":  driverMatchToMap(*match),
+	})
+}
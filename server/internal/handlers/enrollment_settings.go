@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// enrollmentSettingsToMap converts enrollment settings to their JSON representation
+func enrollmentSettingsToMap(s *database.EnrollmentSettings) fiber.Map {
+	m := fiber.Map{
+		"renewalWindowDays": s.RenewalWindowDays,
+		"notifyAdmins":      s.NotifyAdmins,
+		"updatedAt":         s.UpdatedAt.Format(time.RFC3339),
+	}
+	if s.UpdatedBy != nil {
+		m["updatedBy"] = strconv.Itoa(*s.UpdatedBy)
+	}
+	return m
+}
+
+// renewalWindowErrorResponse maps renewal window errors to HTTP responses
+func renewalWindowErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case database.ErrInvalidRenewalWindow, database.ErrTooManyRenewalWindows:
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrCourseNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Renewal window error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// GetEnrollmentSettings returns the institution-wide enrollment expiry settings
+func GetEnrollmentSettings(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	settings, err := database.GetEnrollmentSettings(ctx)
+	if err != nil {
+		log.Printf("[GetEnrollmentSettings] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch enrollment settings",
+		})
+	}
+	return c.JSON(enrollmentSettingsToMap(settings))
+}
+
+// EnrollmentSettingsRequest represents an enrollment settings update
+type EnrollmentSettingsRequest struct {
+	RenewalWindowDays []int `json:"renewalWindowDays"` // Days before expiry students are reminded; empty turns reminders off
+	NotifyAdmins      *bool `json:"notifyAdmins"`
+}
+
+// UpdateEnrollmentSettings replaces the institution-wide renewal windows and
+// whether admins receive a digest of reminders and expiries
+func UpdateEnrollmentSettings(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req EnrollmentSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.RenewalWindowDays == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "renewalWindowDays is required",
+		})
+	}
+
+	current, err := database.GetEnrollmentSettings(ctx)
+	if err != nil {
+		log.Printf("[UpdateEnrollmentSettings] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to update enrollment settings",
+		})
+	}
+	notifyAdmins := current.NotifyAdmins
+	if req.NotifyAdmins != nil {
+		notifyAdmins = *req.NotifyAdmins
+	}
+
+	var updatedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		updatedBy = &session.UserID
+	}
+
+	settings, err := database.UpdateEnrollmentSettings(ctx, req.RenewalWindowDays, notifyAdmins, updatedBy)
+	if err != nil {
+		return renewalWindowErrorResponse(c, "UpdateEnrollmentSettings", "update enrollment settings", err)
+	}
+	return c.JSON(enrollmentSettingsToMap(settings))
+}
+
+// GetCourseRenewalWindows returns the renewal windows that apply to a course
+func GetCourseRenewalWindows(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	windows, err := database.GetCourseRenewalWindows(ctx, courseID)
+	if err != nil {
+		return renewalWindowErrorResponse(c, "GetCourseRenewalWindows", "fetch renewal windows", err)
+	}
+	return c.JSON(fiber.Map{
+		"renewalWindowDays": windows.Days,
+		"inherited":         windows.Inherited,
+	})
+}
+
+// CourseRenewalWindowsRequest represents a course renewal windows update. A
+// null renewalWindowDays goes back to the institution default.
+type CourseRenewalWindowsRequest struct {
+	RenewalWindowDays *[]int `json:"renewalWindowDays"`
+}
+
+// UpdateCourseRenewalWindows overrides the renewal windows of a course
+func UpdateCourseRenewalWindows(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	var req CourseRenewalWindowsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	var windows []int
+	if req.RenewalWindowDays != nil {
+		windows = *req.RenewalWindowDays
+		if windows == nil {
+			windows = []int{}
+		}
+	}
+
+	if err := database.SetCourseRenewalWindows(ctx, courseID, windows); err != nil {
+		return renewalWindowErrorResponse(c, "UpdateCourseRenewalWindows", "update renewal windows", err)
+	}
+	return GetCourseRenewalWindows(c)
+}
@@ -9,12 +9,15 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5"
 
+	"github.com/server/internal/clock"
 	"github.com/server/internal/database"
+	"github.com/server/internal/enrollments"
+	"github.com/server/internal/middleware"
 )
 
-// All date/time operations in this file use IST (Indian Standard Time, Asia/Kolkata) timezone.
-// Expiry dates are stored as end-of-day (23:59:59) in IST, converted to UTC for database storage.
-// When retrieving, dates are converted back to IST for display and comparison.
+// Expiry dates are calendar dates in the institution timezone (see the clock
+// package). They are stored as the end of that day (23:59:59 local time) and
+// converted back to the institution timezone for display.
 
 // EnrollmentRequest represents an enrollment request
 type EnrollmentRequest struct {
@@ -27,7 +30,7 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	courseIDStr := c.Params("courseId")
+	courseIDStr := c.Params("id")
 	if courseIDStr == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "course id is required",
@@ -55,15 +58,14 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 		})
 	}
 
-	// Get all enrollments for the course
-	// Use IST timezone for all date comparisons
-	// Convert expiry_date (stored in UTC) to IST and compare with current IST time
+	// Get all enrollments for the course. expiry_date is the exact moment
+	// access ends, so it is compared with the current time directly.
 	enrollmentsQuery := `
-		SELECT cs.id, cs.user_id, cs.expiry_date, cs.created_at,
+		SELECT cs.id, cs.user_id, cs.expiry_date, cs.created_at, cs.status, cs.expired_at,
 		       u.name, u.email, u.enrollment_number,
 		       CASE
 		           WHEN cs.expiry_date IS NULL THEN true
-		           WHEN (cs.expiry_date AT TIME ZONE 'UTC' AT TIME ZONE 'Asia/Kolkata') > (NOW() AT TIME ZONE 'Asia/Kolkata') THEN true
+		           WHEN cs.expiry_date > NOW() THEN true
 		           ELSE false
 		       END as is_active
 		FROM course_students cs
@@ -89,13 +91,15 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 			UserID           int
 			ExpiryDate       *time.Time
 			CreatedAt        time.Time
+			Status           string
+			ExpiredAt        *time.Time
 			Name             string
 			Email            string
 			EnrollmentNumber *string
 			IsActive         bool
 		)
 
-		err := rows.Scan(&ID, &UserID, &ExpiryDate, &CreatedAt, &Name, &Email, &EnrollmentNumber, &IsActive)
+		err := rows.Scan(&ID, &UserID, &ExpiryDate, &CreatedAt, &Status, &ExpiredAt, &Name, &Email, &EnrollmentNumber, &IsActive)
 		if err != nil {
 			continue
 		}
@@ -107,6 +111,11 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 			"userEmail": Email,
 			"createdAt": CreatedAt.Format(time.RFC3339),
 			"isActive":  IsActive,
+			"status":    Status,
+		}
+
+		if ExpiredAt != nil {
+			enrollment["expiredAt"] = ExpiredAt.Format(time.RFC3339)
 		}
 
 		if EnrollmentNumber != nil {
@@ -114,16 +123,11 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 		}
 
 		if ExpiryDate != nil {
-			// Convert UTC timestamp back to IST to get the correct calendar date
-			// This ensures dates display correctly regardless of server timezone
-			istLocation, err := time.LoadLocation("Asia/Kolkata")
-			if err != nil {
-				// Fallback to UTC if IST can't be loaded
-				istLocation = time.UTC
-			}
-			expiryIST := ExpiryDate.In(istLocation)
-			enrollment["expiryDate"] = expiryIST.Format("2006-01-02")            // Date in IST format (YYYY-MM-DD)
-			enrollment["expiryDateTime"] = ExpiryDate.UTC().Format(time.RFC3339) // Full timestamp in UTC (for API consistency)
+			// The calendar date in the institution timezone, and the exact
+			// moment access ends with its offset
+			expiry := ExpiryDate.In(clock.Location())
+			enrollment["expiryDate"] = expiry.Format("2006-01-02")
+			enrollment["expiryDateTime"] = expiry.Format(time.RFC3339)
 		}
 
 		if IsActive {
@@ -145,12 +149,53 @@ func GetCourseEnrollments(c *fiber.Ctx) error {
 	})
 }
 
-// EnrollStudent enrolls a student in a course with optional expiry date
+// parseEnrollmentExpiry parses an expiry date (YYYY-MM-DD or RFC3339) to the
+// end of that day in the institution timezone. Empty means no expiry.
+func parseEnrollmentExpiry(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	endOfDay := clock.EndOfDay(parsed)
+	return &endOfDay, nil
+}
+
+// enrollmentErrorResponse maps enrollment and waitlist errors to HTTP responses
+func enrollmentErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case database.ErrCourseNotFound, database.ErrUserNotFound, database.ErrEnrollmentNotFound, database.ErrWaitlistEntryNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrAlreadyEnrolled, database.ErrAlreadyWaitlisted, database.ErrCourseFull:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrWaitlistIncomplete:
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Enrollment error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// EnrollStudent enrolls a student in a course with optional expiry date. When
+// the course is full the student is added to its waitlist instead and
+// enrolled automatically once a place becomes free.
 func EnrollStudent(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	courseIDStr := c.Params("courseId")
+	courseIDStr := c.Params("id")
 	if courseIDStr == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "course id is required",
@@ -178,101 +223,46 @@ func EnrollStudent(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if course exists
-	var courseExists int
-	err = database.GetPool().QueryRow(ctx, "SELECT id FROM courses WHERE id = $1", courseID).Scan(&courseExists)
+	expiryDate, err := parseEnrollmentExpiry(req.ExpiryDate)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "course not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check course",
-		})
-	}
-
-	// Check if user exists
-	var userExists int
-	err = database.GetPool().QueryRow(ctx, "SELECT id FROM users WHERE id = $1", req.UserID).Scan(&userExists)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "user not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check user",
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid expiry date format. Use YYYY-MM-DD",
 		})
 	}
 
-	// Check if user is already enrolled
-	var existingID int
-	checkQuery := `SELECT id FROM course_students WHERE course_id = $1 AND user_id = $2`
-	err = database.GetPool().QueryRow(ctx, checkQuery, courseID, req.UserID).Scan(&existingID)
-	if err == nil {
-		return c.Status(409).JSON(fiber.Map{
-			"error": "user is already enrolled in this course",
-		})
-	} else if err != pgx.ErrNoRows {
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check existing enrollment",
-		})
+	var addedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		addedBy = &session.UserID
 	}
 
-	// Parse expiry date if provided
-	var expiryDate *time.Time
-	if req.ExpiryDate != "" {
-		// Try different date formats
-		parsed, err := time.Parse("2006-01-02", req.ExpiryDate)
-		if err != nil {
-			parsed, err = time.Parse(time.RFC3339, req.ExpiryDate)
-		}
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid expiry date format. Use YYYY-MM-DD",
-			})
-		}
-		// Parse date components and set to end of day in IST (23:59:59 IST)
-		// Then convert to UTC for storage to avoid timezone issues
-		istLocation, err := time.LoadLocation("Asia/Kolkata")
-		if err != nil {
-			// Fallback to UTC if IST can't be loaded
-			istLocation = time.UTC
-		}
-		endOfDayIST := time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 23, 59, 59, 0, istLocation)
-		endOfDayUTC := endOfDayIST.UTC()
-		expiryDate = &endOfDayUTC
+	result, err := database.EnrollStudent(ctx, courseID, req.UserID, expiryDate, addedBy)
+	if err != nil {
+		return enrollmentErrorResponse(c, "EnrollStudent", "enroll student", err)
 	}
 
-	// Insert enrollment
-	insertQuery := `
-		INSERT INTO course_students (course_id, user_id, expiry_date)
-		VALUES ($1, $2, $3)
-		RETURNING id
-	`
-
-	var enrollmentID int
-	err = database.GetPool().QueryRow(ctx, insertQuery, courseID, req.UserID, expiryDate).Scan(&enrollmentID)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":   "failed to enroll student",
-			"details": err.Error(),
+	if result.Status == database.EnrollmentWaitlisted {
+		return c.Status(202).JSON(fiber.Map{
+			"message":    "course is full, student added to the waitlist",
+			"status":     result.Status,
+			"waitlistId": strconv.Itoa(result.WaitlistID),
+			"position":   result.Position,
 		})
 	}
-
 	return c.Status(201).JSON(fiber.Map{
 		"message":      "student enrolled successfully",
-		"enrollmentId": strconv.Itoa(enrollmentID),
+		"status":       result.Status,
+		"enrollmentId": strconv.Itoa(result.EnrollmentID),
 	})
 }
 
-// UpdateEnrollment updates an enrollment's expiry date
+// UpdateEnrollment updates an enrollment's expiry date. Renewing an expired
+// enrollment needs a free place in the course; ending one offers its place to
+// the waitlist.
 func UpdateEnrollment(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	enrollmentIDStr := c.Params("enrollmentId")
+	enrollmentIDStr := c.Params("id")
 	if enrollmentIDStr == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "enrollment id is required",
@@ -297,75 +287,31 @@ func UpdateEnrollment(c *fiber.Ctx) error {
 		})
 	}
 
-	// Parse expiry date
-	var expiryDate *time.Time
-	if req.ExpiryDate != "" {
-		parsed, err := time.Parse("2006-01-02", req.ExpiryDate)
-		if err != nil {
-			parsed, err = time.Parse(time.RFC3339, req.ExpiryDate)
-		}
-		if err != nil {
-			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid expiry date format. Use YYYY-MM-DD",
-			})
-		}
-		// Parse date components and set to end of day in IST (23:59:59 IST)
-		// Then convert to UTC for storage to avoid timezone issues
-		istLocation, err := time.LoadLocation("Asia/Kolkata")
-		if err != nil {
-			// Fallback to UTC if IST can't be loaded
-			istLocation = time.UTC
-		}
-		endOfDayIST := time.Date(parsed.Year(), parsed.Month(), parsed.Day(), 23, 59, 59, 0, istLocation)
-		endOfDayUTC := endOfDayIST.UTC()
-		expiryDate = &endOfDayUTC
-	}
-
-	// Check if enrollment exists
-	var exists int
-	err = database.GetPool().QueryRow(ctx, "SELECT id FROM course_students WHERE id = $1", enrollmentID).Scan(&exists)
+	expiryDate, err := parseEnrollmentExpiry(req.ExpiryDate)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "enrollment not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check enrollment",
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid expiry date format. Use YYYY-MM-DD",
 		})
 	}
 
-	// Update enrollment
-	var updateQuery string
-	var args []interface{}
-
-	if expiryDate != nil {
-		updateQuery = `UPDATE course_students SET expiry_date = $1 WHERE id = $2`
-		args = []interface{}{expiryDate, enrollmentID}
-	} else {
-		updateQuery = `UPDATE course_students SET expiry_date = NULL WHERE id = $1`
-		args = []interface{}{enrollmentID}
-	}
-
-	_, err = database.GetPool().Exec(ctx, updateQuery, args...)
+	courseID, err := database.UpdateEnrollmentExpiry(ctx, enrollmentID, expiryDate)
 	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":   "failed to update enrollment",
-			"details": err.Error(),
-		})
+		return enrollmentErrorResponse(c, "UpdateEnrollment", "update enrollment", err)
 	}
+	enrollments.Promote(courseID)
 
 	return c.JSON(fiber.Map{
 		"message": "enrollment updated successfully",
 	})
 }
 
-// UnenrollStudent removes a student from a course
+// UnenrollStudent removes a student from a course and offers their place to
+// the next student on the waitlist
 func UnenrollStudent(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	enrollmentIDStr := c.Params("enrollmentId")
+	enrollmentIDStr := c.Params("id")
 	if enrollmentIDStr == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "enrollment id is required",
@@ -379,41 +325,23 @@ func UnenrollStudent(c *fiber.Ctx) error {
 		})
 	}
 
-	// Check if enrollment exists
-	var exists int
-	err = database.GetPool().QueryRow(ctx, "SELECT id FROM course_students WHERE id = $1", enrollmentID).Scan(&exists)
+	courseID, err := database.UnenrollStudent(ctx, enrollmentID)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "enrollment not found",
-			})
-		}
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check enrollment",
-		})
-	}
-
-	// Delete enrollment
-	deleteQuery := `DELETE FROM course_students WHERE id = $1`
-	_, err = database.GetPool().Exec(ctx, deleteQuery, enrollmentID)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{
-			"error":   "failed to unenroll student",
-			"details": err.Error(),
-		})
+		return enrollmentErrorResponse(c, "UnenrollStudent", "unenroll student", err)
 	}
+	enrollments.Promote(courseID)
 
 	return c.JSON(fiber.Map{
 		"message": "student unenrolled successfully",
 	})
 }
 
-// GetAvailableStudents returns users who can be enrolled in a course (not already enrolled)
+// GetAvailableStudents returns users who can be enrolled in a course (not already enrolled or waitlisted)
 func GetAvailableStudents(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
 
-	courseIDStr := c.Params("courseId")
+	courseIDStr := c.Params("id")
 	if courseIDStr == "" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "course id is required",
@@ -439,6 +367,9 @@ func GetAvailableStudents(c *fiber.Ctx) error {
 			WHERE u.id NOT IN (
 				SELECT cs.user_id FROM course_students cs WHERE cs.course_id = $1
 			)
+			AND u.id NOT IN (
+				SELECT w.user_id FROM course_waitlist w WHERE w.course_id = $1
+			)
 			AND LOWER(u.role) NOT IN ('admin', 'driver')
 			AND (LOWER(u.name) LIKE LOWER($2) OR LOWER(u.email) LIKE LOWER($2) OR LOWER(u.enrollment_number) LIKE LOWER($2))
 			ORDER BY u.name
@@ -452,6 +383,9 @@ func GetAvailableStudents(c *fiber.Ctx) error {
 			WHERE u.id NOT IN (
 				SELECT cs.user_id FROM course_students cs WHERE cs.course_id = $1
 			)
+			AND u.id NOT IN (
+				SELECT w.user_id FROM course_waitlist w WHERE w.course_id = $1
+			)
 			AND LOWER(u.role) NOT IN ('admin', 'driver')
 			ORDER BY u.name
 		`
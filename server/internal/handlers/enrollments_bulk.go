@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+const (
+	// maxBulkEnrollRows bounds the students enrolled in one operation
+	maxBulkEnrollRows = 2000
+	// maxBulkEnrollCSVSize bounds uploaded enrollment number lists
+	maxBulkEnrollCSVSize = 1 << 20
+	// bulkEnrollTimeout bounds a bulk enrollment transaction
+	bulkEnrollTimeout = 30 * time.Second
+)
+
+// enrollmentNumberHeaders are the CSV headers recognised as the enrollment
+// number column, compared without case, spaces, dashes or underscores
+var enrollmentNumberHeaders = map[string]bool{
+	"enrollmentnumber": true,
+	"enrollmentno":     true,
+	"enrolmentnumber":  true,
+	"enrolmentno":      true,
+}
+
+// normalizeCSVHeader lowercases a CSV header and drops separators
+func normalizeCSVHeader(h string) string {
+	return strings.NewReplacer(" ", "", "_", "", "-", "", ".", "").Replace(strings.ToLower(strings.TrimSpace(h)))
+}
+
+// parseEnrollmentCSV reads enrollment numbers from a CSV file. The column is
+// found by its header; without a recognised header the first column is used
+// and the first line is data. Rows are numbered by CSV line.
+func parseEnrollmentCSV(r io.Reader) ([]database.BulkEnrollTarget, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	targets := []database.BulkEnrollTarget{}
+	column, first := 0, true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if first {
+			first = false
+			// Spreadsheet exports often start with a byte order mark
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			header := false
+			for i, h := range record {
+				if enrollmentNumberHeaders[normalizeCSVHeader(h)] {
+					column, header = i, true
+					break
+				}
+			}
+			if header {
+				continue
+			}
+		}
+
+		if column >= len(record) {
+			continue
+		}
+		number := strings.TrimSpace(record[column])
+		if number == "" {
+			continue
+		}
+		targets = append(targets, database.BulkEnrollTarget{Row: line, EnrollmentNumber: number})
+	}
+	return targets, nil
+}
+
+// CohortRequest selects students by profile for bulk enrollment
+type CohortRequest struct {
+	Programme string `json:"programme"`
+	Course    string `json:"course"`
+	Year      string `json:"year"`
+	Hostel    string `json:"hostel"`
+	Search    string `json:"search"`
+}
+
+// BulkEnrollRequest represents a bulk enrollment request. Exactly one of
+// userIds, enrollmentNumbers or cohort names the students; a CSV upload of
+// enrollment numbers can be sent instead as the multipart "file".
+type BulkEnrollRequest struct {
+	UserIDs           []int          `json:"userIds"`
+	EnrollmentNumbers []string       `json:"enrollmentNumbers"`
+	Cohort            *CohortRequest `json:"cohort"`
+	ExpiryDate        string         `json:"expiryDate,omitempty"` // Shared by every student
+	DryRun            bool           `json:"dryRun"`
+}
+
+// targets turns a JSON bulk enrollment request into bulk enrollment targets.
+// Returns a message for the client when the request is invalid.
+func (r *BulkEnrollRequest) targets() ([]database.BulkEnrollTarget, string, error) {
+	sources := 0
+	for _, given := range []bool{len(r.UserIDs) > 0, len(r.EnrollmentNumbers) > 0, r.Cohort != nil} {
+		if given {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, "provide exactly one of userIds, enrollmentNumbers, cohort or a CSV file", nil
+	}
+
+	targets := []database.BulkEnrollTarget{}
+	switch {
+	case len(r.UserIDs) > 0:
+		for i, id := range r.UserIDs {
+			targets = append(targets, database.BulkEnrollTarget{Row: i + 1, UserID: id})
+		}
+	case len(r.EnrollmentNumbers) > 0:
+		for i, number := range r.EnrollmentNumbers {
+			if number = strings.TrimSpace(number); number != "" {
+				targets = append(targets, database.BulkEnrollTarget{Row: i + 1, EnrollmentNumber: number})
+			}
+		}
+	default:
+		filter := database.CohortFilter{
+			Programme: r.Cohort.Programme,
+			Course:    r.Cohort.Course,
+			Year:      r.Cohort.Year,
+			Hostel:    r.Cohort.Hostel,
+			Search:    r.Cohort.Search,
+		}
+		if filter.IsEmpty() {
+			return nil, "cohort needs at least one of programme, course, year, hostel or search", nil
+		}
+		ctx, cancel := database.DefaultTimeout()
+		defer cancel()
+		cohort, err := database.FindCohort(ctx, filter)
+		if err != nil {
+			return nil, "", err
+		}
+		targets = cohort
+	}
+	return targets, "", nil
+}
+
+// csvBulkEnrollRequest reads a multipart bulk enrollment request with a CSV
+// of enrollment numbers. Returns a message for the client when it is invalid.
+func csvBulkEnrollRequest(c *fiber.Ctx) (*BulkEnrollRequest, []database.BulkEnrollTarget, string, error) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, "no file provided", nil
+	}
+	if file.Size > maxBulkEnrollCSVSize {
+		return nil, nil, "file size exceeds 1MB limit", nil
+	}
+
+	req := &BulkEnrollRequest{ExpiryDate: strings.TrimSpace(c.FormValue("expiryDate"))}
+	if v := c.FormValue("dryRun"); v != "" {
+		if req.DryRun, err = strconv.ParseBool(v); err != nil {
+			return nil, nil, "dryRun must be true or false", nil
+		}
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+	defer src.Close()
+	targets, err := parseEnrollmentCSV(src)
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, nil, "invalid CSV: " + parseErr.Error(), nil
+		}
+		return nil, nil, "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return req, targets, "", nil
+}
+
+// bulkEnrollRowToMap converts a bulk enrollment row to its JSON representation
+func bulkEnrollRowToMap(r database.BulkEnrollRow, dryRun bool) fiber.Map {
+	m := fiber.Map{
+		"row":    r.Row,
+		"status": r.Status,
+	}
+	if r.EnrollmentNumber != "" {
+		m["enrollmentNumber"] = r.EnrollmentNumber
+	}
+	if r.UserID != 0 {
+		m["userId"] = strconv.Itoa(r.UserID)
+	}
+	if r.UserName != "" {
+		m["userName"] = r.UserName
+	}
+	if r.Status == database.BulkWaitlisted {
+		m["position"] = r.Position
+	}
+	// Ids of a dry run were rolled back
+	if !dryRun {
+		if r.EnrollmentID != 0 {
+			m["enrollmentId"] = strconv.Itoa(r.EnrollmentID)
+		}
+		if r.WaitlistID != 0 {
+			m["waitlistId"] = strconv.Itoa(r.WaitlistID)
+		}
+	}
+	return m
+}
+
+// BulkEnrollStudents enrolls many students in a course at once with one
+// shared expiry date: a list of user ids or enrollment numbers, a cohort
+// selected by programme, course, year, hostel or search, or an uploaded CSV
+// of enrollment numbers. Students who do not fit in the course are
+// waitlisted. Everything runs in one transaction and every row is reported;
+// with dryRun nothing is changed.
+func BulkEnrollStudents(c *fiber.Ctx) error {
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	var req *BulkEnrollRequest
+	var targets []database.BulkEnrollTarget
+	var msg string
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+		req, targets, msg, err = csvBulkEnrollRequest(c)
+	} else {
+		req = &BulkEnrollRequest{}
+		if err := c.BodyParser(req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+		targets, msg, err = req.targets()
+	}
+	if err != nil {
+		log.Printf("[BulkEnrollStudents] Request error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to read students",
+		})
+	}
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if len(targets) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "no students to enroll",
+		})
+	}
+	if len(targets) > maxBulkEnrollRows {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("at most %d students can be enrolled at once", maxBulkEnrollRows),
+		})
+	}
+
+	expiryDate, err := parseEnrollmentExpiry(req.ExpiryDate)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid expiry date format. Use YYYY-MM-DD",
+		})
+	}
+
+	var addedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		addedBy = &session.UserID
+	}
+
+	ctx, cancel := database.Timeout(bulkEnrollTimeout)
+	defer cancel()
+
+	report, err := database.BulkEnroll(ctx, courseID, targets, expiryDate, addedBy, req.DryRun)
+	if err != nil {
+		return enrollmentErrorResponse(c, "BulkEnrollStudents", "enroll students", err)
+	}
+
+	rows := make([]fiber.Map, 0, len(report.Rows))
+	for _, r := range report.Rows {
+		rows = append(rows, bulkEnrollRowToMap(r, report.DryRun))
+	}
+	if !report.DryRun {
+		log.Printf("[BulkEnrollStudents] Course %d: %d enrolled, %d waitlisted of %d rows",
+			courseID, report.Counts[database.BulkEnrolled], report.Counts[database.BulkWaitlisted], len(report.Rows))
+	}
+	return c.JSON(fiber.Map{
+		"dryRun": report.DryRun,
+		"total":  len(report.Rows),
+		"counts": report.Counts,
+		"rows":   rows,
+	})
+}
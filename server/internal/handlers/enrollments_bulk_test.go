@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/server/internal/database"
+)
+
+func TestParseEnrollmentCSV(t *testing.T) {
+	target := func(row int, number string) database.BulkEnrollTarget {
+		return database.BulkEnrollTarget{Row: row, EnrollmentNumber: number}
+	}
+
+	tests := []struct {
+		name    string
+		csv     string
+		want    []database.BulkEnrollTarget
+		wantErr bool
+	}{
+		{
+			name: "no header",
+			csv:  "EN001\nEN002\n",
+			want: []database.BulkEnrollTarget{target(1, "EN001"), target(2, "EN002")},
+		},
+		{
+			name: "header picks the column",
+			csv:  "Name,Enrollment Number,Hostel\nAsha,EN001,H1\nRavi, EN002 ,H2\n",
+			want: []database.BulkEnrollTarget{target(2, "EN001"), target(3, "EN002")},
+		},
+		{
+			name: "byte order mark and underscore header",
+			csv:  "\ufeffenrollment_no\r\nEN001\r\n",
+			want: []database.BulkEnrollTarget{target(2, "EN001")},
+		},
+		{
+			name: "blank and short rows skipped",
+			csv:  "name,enrollmentNumber\nAsha,EN001\n\nRavi\nMeena,\nArun,EN004\n",
+			want: []database.BulkEnrollTarget{target(2, "EN001"), target(6, "EN004")},
+		},
+		{
+			name: "empty file",
+			csv:  "",
+			want: []database.BulkEnrollTarget{},
+		},
+		{
+			name:    "malformed quotes",
+			csv:     "\"EN001\nEN002\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEnrollmentCSV(strings.NewReader(tt.csv))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEnrollmentCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseEnrollmentCSV() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
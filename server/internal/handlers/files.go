@@ -19,10 +19,16 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 
+	"github.com/server/internal/clock"
 	"github.com/server/internal/config"
 	"github.com/server/internal/middleware"
 )
 
+// PublicUploadCategories are the local upload categories served statically
+// under /uploads. Course books, personal copies, materials, statements and
+// identity documents are only served through authenticated endpoints.
+var PublicUploadCategories = []string{"profile"}
+
 // UploadFile handles file uploads (S3 or local)
 func UploadFile(c *fiber.Ctx) error {
 	// Get category from query parameter (profile, document, certificate, courses, idproof)
@@ -67,7 +73,7 @@ func UploadFile(c *fiber.Ctx) error {
 	}
 
 	// Generate unique filename
-	filename := fmt.Sprintf("%s_%d%s", uuid.New().String(), time.Now().Unix(), ext)
+	filename := fmt.Sprintf("%s_%d%s", uuid.New().String(), clock.Now().Unix(), ext)
 
 	var fileURL string
 	storageType := config.StorageType()
@@ -214,8 +220,9 @@ func GetFile(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate category
-	if category != "profile" && category != "document" && category != "certificate" && category != "courses" {
+	// Validate category (statements are generated by the server and course
+	// materials are uploaded through their own endpoints)
+	if category != "profile" && category != "document" && category != "certificate" && category != "courses" && category != "statements" && category != "materials" {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "invalid category",
 		})
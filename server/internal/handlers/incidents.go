@@ -0,0 +1,631 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/incidents"
+	"github.com/server/internal/middleware"
+)
+
+// maxIncidentTextLength caps incident descriptions, notes and location text
+const maxIncidentTextLength = 2000
+
+// incidentStreamHeartbeat is how often the incident stream sends a comment to
+// keep idle connections open
+const incidentStreamHeartbeat = 25 * time.Second
+
+// incidentToMap converts an incident to the API response format
+func incidentToMap(i database.Incident) fiber.Map {
+	incidentMap := fiber.Map{
+		"_id":       strconv.Itoa(i.ID),
+		"kind":      i.Kind,
+		"severity":  i.Severity,
+		"status":    i.Status,
+		"createdAt": i.CreatedAt.Format(time.RFC3339),
+		"updatedAt": i.UpdatedAt.Format(time.RFC3339),
+	}
+
+	location := fiber.Map{}
+	if i.Location.Latitude != nil && i.Location.Longitude != nil {
+		location["latitude"] = *i.Location.Latitude
+		location["longitude"] = *i.Location.Longitude
+		location["mapUrl"] = incidents.MapsLink(i.Location)
+	}
+	if i.Location.Accuracy != nil {
+		location["accuracy"] = *i.Location.Accuracy
+	}
+	if i.Location.Text != nil {
+		location["text"] = *i.Location.Text
+	}
+	if i.Location.OccurredAt != nil {
+		incidentMap["occurredAt"] = i.Location.OccurredAt.Format(time.RFC3339)
+	}
+	incidentMap["location"] = location
+
+	if i.RideBillID != nil {
+		incidentMap["billId"] = strconv.Itoa(*i.RideBillID)
+		if i.FromLocation != nil {
+			incidentMap["fromLocation"] = *i.FromLocation
+		}
+		if i.ToLocation != nil {
+			incidentMap["toLocation"] = *i.ToLocation
+		}
+		if i.RideAt != nil {
+			incidentMap["rideAt"] = i.RideAt.Format(time.RFC3339)
+		}
+	}
+	if i.ReportedBy != nil {
+		incidentMap["reportedBy"] = strconv.Itoa(*i.ReportedBy)
+	}
+	if i.ReporterName != nil {
+		incidentMap["reporterName"] = *i.ReporterName
+	}
+	if i.ReporterPhone != nil {
+		incidentMap["reporterPhone"] = *i.ReporterPhone
+	}
+	if i.DriverID != nil {
+		incidentMap["driverId"] = strconv.Itoa(*i.DriverID)
+	}
+	if i.DriverName != nil {
+		incidentMap["driverName"] = *i.DriverName
+	}
+	if i.VehicleID != nil {
+		incidentMap["vehicleId"] = strconv.Itoa(*i.VehicleID)
+	}
+	if i.VehicleRegistration != nil {
+		incidentMap["vehicleRegistration"] = *i.VehicleRegistration
+	}
+	if i.Description != nil {
+		incidentMap["description"] = *i.Description
+	}
+	if i.AcknowledgedBy != nil {
+		incidentMap["acknowledgedBy"] = strconv.Itoa(*i.AcknowledgedBy)
+	}
+	if i.AcknowledgedAt != nil {
+		incidentMap["acknowledgedAt"] = i.AcknowledgedAt.Format(time.RFC3339)
+	}
+	if i.ResolvedBy != nil {
+		incidentMap["resolvedBy"] = strconv.Itoa(*i.ResolvedBy)
+	}
+	if i.ResolvedAt != nil {
+		incidentMap["resolvedAt"] = i.ResolvedAt.Format(time.RFC3339)
+	}
+	if i.ResolutionNotes != nil {
+		incidentMap["resolutionNotes"] = *i.ResolutionNotes
+	}
+	return incidentMap
+}
+
+// incidentUpdateToMap converts an incident timeline entry to the API response format
+func incidentUpdateToMap(u database.IncidentUpdate) fiber.Map {
+	updateMap := fiber.Map{
+		"_id":       strconv.Itoa(u.ID),
+		"createdAt": u.CreatedAt.Format(time.RFC3339),
+	}
+	if u.UserID != nil {
+		updateMap["userId"] = strconv.Itoa(*u.UserID)
+	}
+	if u.UserName != nil {
+		updateMap["userName"] = *u.UserName
+	}
+	if u.FromStatus != nil {
+		updateMap["fromStatus"] = *u.FromStatus
+	}
+	if u.ToStatus != nil {
+		updateMap["toStatus"] = *u.ToStatus
+	}
+	if u.Note != nil {
+		updateMap["note"] = *u.Note
+	}
+	return updateMap
+}
+
+// incidentErrorResponse maps incident errors to HTTP responses
+func incidentErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrBillNotFound, database.ErrNotYourRide:
+		// Don't reveal other users' rides
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride bill not found",
+		})
+	case database.ErrIncidentNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrRideNotActive, database.ErrInvalidIncidentTransition:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrResolutionNotesRequired, database.ErrUserNotAdmin:
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Incident error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to process incident",
+	})
+}
+
+// normalizeIncidentText trims optional free text and checks its length
+func normalizeIncidentText(field string, value *string) (*string, string) {
+	if value == nil {
+		return nil, ""
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" {
+		return nil, ""
+	}
+	if len(trimmed) > maxIncidentTextLength {
+		return nil, field + " must be at most " + strconv.Itoa(maxIncidentTextLength) + " characters"
+	}
+	return &trimmed, ""
+}
+
+// IncidentLocationRequest is where the reporter's device says they are
+type IncidentLocationRequest struct {
+	Latitude   *float64 `json:"latitude"`
+	Longitude  *float64 `json:"longitude"`
+	Accuracy   *float64 `json:"accuracy"` // Metres
+	Text       *string  `json:"text"`
+	OccurredAt *string  `json:"occurredAt"` // RFC3339, defaults to now
+}
+
+// parse validates the location and converts it for storage
+func (r IncidentLocationRequest) parse() (database.IncidentLocation, string) {
+	var loc database.IncidentLocation
+	if (r.Latitude == nil) != (r.Longitude == nil) {
+		return loc, "latitude and longitude must be given together"
+	}
+	if r.Latitude != nil && (*r.Latitude < -90 || *r.Latitude > 90) {
+		return loc, "latitude must be between -90 and 90"
+	}
+	if r.Longitude != nil && (*r.Longitude < -180 || *r.Longitude > 180) {
+		return loc, "longitude must be between -180 and 180"
+	}
+	if r.Accuracy != nil && *r.Accuracy < 0 {
+		return loc, "accuracy cannot be negative"
+	}
+	text, msg := normalizeIncidentText("location text", r.Text)
+	if msg != "" {
+		return loc, msg
+	}
+	loc.Latitude, loc.Longitude, loc.Accuracy, loc.Text = r.Latitude, r.Longitude, r.Accuracy, text
+
+	if r.OccurredAt != nil && *r.OccurredAt != "" {
+		occurredAt, err := time.Parse(time.RFC3339, *r.OccurredAt)
+		if err != nil {
+			return loc, "occurredAt must be an RFC3339 timestamp"
+		}
+		// Device clocks drift; never record an incident in the future
+		if now := clock.Now(); occurredAt.After(now) {
+			occurredAt = now
+		}
+		loc.OccurredAt = &occurredAt
+	}
+	return loc, ""
+}
+
+// SOSRequest is an emergency alert raised during a ride
+type SOSRequest struct {
+	IncidentLocationRequest
+	Description *string `json:"description"`
+}
+
+// RaiseRideSOS raises an emergency alert on a ride in progress. The student
+// or driver on the ride can raise it; on-call admins are alerted immediately.
+func RaiseRideSOS(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var req SOSRequest
+	// An empty body is fine: the alert matters more than the details
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+	loc, msg := req.parse()
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	description, msg := normalizeIncidentText("description", req.Description)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	reporter := session.UserID
+	incident, err := database.CreateIncident(ctx, database.Incident{
+		Kind:        database.IncidentSOS,
+		RideBillID:  &billID,
+		ReportedBy:  &reporter,
+		Description: description,
+		Location:    loc,
+	})
+	if err != nil {
+		return incidentErrorResponse(c, "RaiseRideSOS", err)
+	}
+
+	incidents.Notify(incident)
+	return c.Status(201).JSON(incidentToMap(*incident))
+}
+
+// IncidentRequest is an incident report, optionally about a ride
+type IncidentRequest struct {
+	IncidentLocationRequest
+	BillID      *string `json:"billId"`
+	Severity    string  `json:"severity"` // Defaults to medium
+	Description *string `json:"description"`
+}
+
+// ReportIncident records a non-emergency incident. When billId is given the
+// reporter must be the student or driver on that ride.
+func ReportIncident(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req IncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	var billID *int
+	if req.BillID != nil && *req.BillID != "" {
+		id, err := strconv.Atoi(*req.BillID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid ride bill id format",
+			})
+		}
+		billID = &id
+	}
+	severity := strings.ToLower(strings.TrimSpace(req.Severity))
+	if severity == "" {
+		severity = "medium"
+	}
+	if _, ok := database.ValidIncidentSeverities[severity]; !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "severity must be one of low, medium, high, critical",
+		})
+	}
+	description, msg := normalizeIncidentText("description", req.Description)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if description == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "description is required",
+		})
+	}
+	loc, msg := req.parse()
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	reporter := session.UserID
+	incident, err := database.CreateIncident(ctx, database.Incident{
+		Kind:        database.IncidentReport,
+		RideBillID:  billID,
+		ReportedBy:  &reporter,
+		Severity:    severity,
+		Description: description,
+		Location:    loc,
+	})
+	if err != nil {
+		return incidentErrorResponse(c, "ReportIncident", err)
+	}
+
+	incidents.Notify(incident)
+	return c.Status(201).JSON(incidentToMap(*incident))
+}
+
+// GetMyIncidents returns the SOS alerts and incidents the current user raised
+func GetMyIncidents(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	reporter := session.UserID
+	list, err := database.GetIncidents(ctx, database.IncidentFilter{ReportedBy: &reporter})
+	if err != nil {
+		log.Printf("[GetMyIncidents] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch incidents",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(list))
+	for _, i := range list {
+		result = append(result, incidentToMap(i))
+	}
+	return c.JSON(result)
+}
+
+// GetIncidents lists incidents, open and most severe first. Filter with the
+// status, severity and kind query parameters.
+func GetIncidents(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	filter := database.IncidentFilter{
+		Status:   strings.ToLower(c.Query("status")),
+		Severity: strings.ToLower(c.Query("severity")),
+		Kind:     strings.ToLower(c.Query("kind")),
+	}
+	if filter.Severity != "" {
+		if _, ok := database.ValidIncidentSeverities[filter.Severity]; !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid severity",
+			})
+		}
+	}
+
+	list, err := database.GetIncidents(ctx, filter)
+	if err != nil {
+		log.Printf("[GetIncidents] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch incidents",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(list))
+	for _, i := range list {
+		result = append(result, incidentToMap(i))
+	}
+	return c.JSON(result)
+}
+
+// GetIncident returns an incident with its timeline
+func GetIncident(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid incident id format",
+		})
+	}
+
+	incident, err := database.GetIncident(ctx, id)
+	if err != nil {
+		return incidentErrorResponse(c, "GetIncident", err)
+	}
+	updates, err := database.GetIncidentUpdates(ctx, id)
+	if err != nil {
+		return incidentErrorResponse(c, "GetIncident", err)
+	}
+
+	timeline := make([]fiber.Map, 0, len(updates))
+	for _, u := range updates {
+		timeline = append(timeline, incidentUpdateToMap(u))
+	}
+	incidentMap := incidentToMap(*incident)
+	incidentMap["timeline"] = timeline
+	return c.JSON(incidentMap)
+}
+
+// UpdateIncidentRequest is an admin's change to an incident
+type UpdateIncidentRequest struct {
+	Status          *string `json:"status"`
+	Severity        *string `json:"severity"`
+	Note            *string `json:"note"`
+	ResolutionNotes *string `json:"resolutionNotes"`
+}
+
+// UpdateIncident moves an incident through its workflow
+// (open → acknowledged → resolved → closed, with resolved incidents
+// reopenable), changes its severity or adds a note to its timeline
+func UpdateIncident(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid incident id format",
+		})
+	}
+
+	var req UpdateIncidentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	var change database.IncidentChange
+	if req.Status != nil {
+		status := strings.ToLower(strings.TrimSpace(*req.Status))
+		change.Status = &status
+	}
+	if req.Severity != nil {
+		severity := strings.ToLower(strings.TrimSpace(*req.Severity))
+		if _, ok := database.ValidIncidentSeverities[severity]; !ok {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "severity must be one of low, medium, high, critical",
+			})
+		}
+		change.Severity = &severity
+	}
+	var msg string
+	if change.Note, msg = normalizeIncidentText("note", req.Note); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if change.ResolutionNotes, msg = normalizeIncidentText("resolutionNotes", req.ResolutionNotes); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if change.Status == nil && change.Severity == nil && change.Note == nil && change.ResolutionNotes == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "status, severity, note or resolutionNotes is required",
+		})
+	}
+
+	incident, err := database.UpdateIncident(ctx, id, session.UserID, change)
+	if err != nil {
+		return incidentErrorResponse(c, "UpdateIncident", err)
+	}
+
+	incidents.Publish(ctx, "updated", incident)
+	return c.JSON(incidentToMap(*incident))
+}
+
+// StreamIncidents streams new and updated incidents to admin dashboards as
+// server-sent events
+func StreamIncidents(c *fiber.Ctx) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := cache.SubscribeIncidents(ctx)
+	if err != nil {
+		cancel()
+		if err == cache.ErrCacheUnavailable {
+			return c.Status(503).JSON(fiber.Map{
+				"error": "realtime incidents are unavailable",
+			})
+		}
+		log.Printf("[StreamIncidents] Subscribe error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to subscribe to incidents",
+		})
+	}
+
+	c.Set("Content-Type", "text/event-stream")
+	c.Set("Cache-Control", "no-cache")
+	c.Set("Connection", "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer cancel()
+		defer sub.Close()
+
+		heartbeat := time.NewTicker(incidentStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		fmt.Fprint(w, ": connected\n\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		messages := sub.Channel()
+		for {
+			select {
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event incidents.Event
+				if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil || event.Incident == nil {
+					log.Printf("[StreamIncidents] Invalid incident event: %v", err)
+					continue
+				}
+				data, err := json.Marshal(incidentToMap(*event.Incident))
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			}
+			// A failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+	return nil
+}
+
+// OnCallRequest puts an admin on or off the incident on-call rota
+type OnCallRequest struct {
+	OnCall *bool `json:"onCall"`
+}
+
+// UpdateUserOnCall sets whether an admin is alerted about new incidents.
+// When no admin is on call, every active admin is alerted.
+func UpdateUserOnCall(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+
+	var req OnCallRequest
+	if err := c.BodyParser(&req); err != nil || req.OnCall == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "onCall is required",
+		})
+	}
+
+	if err := database.SetAdminOnCall(ctx, userID, *req.OnCall); err != nil {
+		return incidentErrorResponse(c, "UpdateUserOnCall", err)
+	}
+	return c.JSON(fiber.Map{
+		"userId": strconv.Itoa(userID),
+		"onCall": *req.OnCall,
+	})
+}
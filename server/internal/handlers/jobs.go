@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/jobs"
+	"github.com/server/internal/middleware"
+)
+
+// jobStatusToMap converts a background job and its state to API response format
+func jobStatusToMap(s jobs.Status) fiber.Map {
+	m := fiber.Map{
+		"name":        s.Job.Name,
+		"description": s.Job.Description,
+		"schedule":    s.Job.Schedule,
+		"timeout":     s.Job.Timeout.String(),
+		"attempts":    s.Job.Attempts,
+		"paused":      false,
+		"running":     false,
+	}
+	if s.State == nil {
+		return m
+	}
+	m["paused"] = s.State.Paused
+	m["running"] = s.State.Running(clock.Now())
+	m["nextRunAt"] = s.State.NextRunAt.Format(time.RFC3339)
+	if s.State.PausedAt != nil {
+		m["pausedAt"] = s.State.PausedAt.Format(time.RFC3339)
+	}
+	if s.State.PausedBy != nil {
+		m["pausedBy"] = strconv.Itoa(*s.State.PausedBy)
+	}
+	if s.State.LastRunAt != nil {
+		m["lastRunAt"] = s.State.LastRunAt.Format(time.RFC3339)
+	}
+	if s.State.LastStatus != nil {
+		m["lastStatus"] = *s.State.LastStatus
+	}
+	return m
+}
+
+// jobRunToMap converts an attempt of a job run to API response format
+func jobRunToMap(r database.JobRun) fiber.Map {
+	m := fiber.Map{
+		"_id":       strconv.Itoa(r.ID),
+		"job":       r.JobName,
+		"trigger":   r.Trigger,
+		"attempt":   r.Attempt,
+		"status":    r.Status,
+		"instance":  r.Instance,
+		"startedAt": r.StartedAt.Format(time.RFC3339),
+	}
+	if r.Result != nil {
+		m["result"] = *r.Result
+	}
+	if r.ErrorMessage != nil {
+		m["error"] = *r.ErrorMessage
+	}
+	if r.TriggeredBy != nil {
+		m["triggeredBy"] = strconv.Itoa(*r.TriggeredBy)
+	}
+	if r.FinishedAt != nil {
+		m["finishedAt"] = r.FinishedAt.Format(time.RFC3339)
+		m["durationMs"] = r.FinishedAt.Sub(r.StartedAt).Milliseconds()
+	}
+	return m
+}
+
+// jobErrorResponse maps background job errors to HTTP responses
+func jobErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case jobs.ErrUnknownJob, database.ErrJobNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "job not found",
+		})
+	case jobs.ErrJobRunning:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// GetJobs lists the background jobs with their schedules and last runs
+func GetJobs(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	list, err := jobs.List(ctx)
+	if err != nil {
+		return jobErrorResponse(c, "GetJobs", "fetch jobs", err)
+	}
+	result := make([]fiber.Map, 0, len(list))
+	for _, s := range list {
+		result = append(result, jobStatusToMap(s))
+	}
+	return c.JSON(result)
+}
+
+// GetJobRuns returns the recent run history of a background job, one entry
+// per attempt
+func GetJobRuns(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	status, err := jobs.Get(ctx, c.Params("name"))
+	if err != nil {
+		return jobErrorResponse(c, "GetJobRuns", "fetch job runs", err)
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 500 {
+		limit = 50
+	}
+	runs, err := database.GetJobRuns(ctx, status.Job.Name, limit)
+	if err != nil {
+		return jobErrorResponse(c, "GetJobRuns", "fetch job runs", err)
+	}
+	result := make([]fiber.Map, 0, len(runs))
+	for _, r := range runs {
+		result = append(result, jobRunToMap(r))
+	}
+	return c.JSON(fiber.Map{
+		"job":  jobStatusToMap(*status),
+		"runs": result,
+	})
+}
+
+// RunJob starts a background job now. The run continues in the background;
+// its outcome shows up in the job's run history.
+func RunJob(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	name := c.Params("name")
+	if err := jobs.Trigger(ctx, name, session.UserID); err != nil {
+		return jobErrorResponse(c, "RunJob", "start job", err)
+	}
+	log.Printf("[RunJob] User %d started job %s", session.UserID, name)
+	return c.Status(202).JSON(fiber.Map{
+		"message": "job started",
+	})
+}
+
+// PauseJob stops the scheduled runs of a background job until it is resumed
+func PauseJob(c *fiber.Ctx) error {
+	return setJobPaused(c, "PauseJob", true)
+}
+
+// ResumeJob restarts the scheduled runs of a paused background job
+func ResumeJob(c *fiber.Ctx) error {
+	return setJobPaused(c, "ResumeJob", false)
+}
+
+func setJobPaused(c *fiber.Ctx, logPrefix string, paused bool) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	status, err := jobs.SetPaused(ctx, c.Params("name"), paused, session.UserID)
+	if err != nil {
+		return jobErrorResponse(c, logPrefix, "update job", err)
+	}
+	log.Printf("[%s] User %d set job %s paused=%v", logPrefix, session.UserID, status.Job.Name, paused)
+	return c.JSON(jobStatusToMap(*status))
+}
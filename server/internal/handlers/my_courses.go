@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/books"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+	"github.com/server/internal/pdf"
+	"github.com/server/internal/storage"
+)
+
+// unsafeFilenameChars matches characters replaced in download file names
+var unsafeFilenameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// studentCourseToMap converts an enrolled course to the student API response
+// format. The course name and code are only included when the course shows
+// them. The expiry date is the institution's calendar date; expiresAt is the
+// same moment in the student's own timezone.
+func studentCourseToMap(sc database.StudentCourse, loc *time.Location) fiber.Map {
+	courseMap := fiber.Map{
+		"_id":          strconv.Itoa(sc.ID),
+		"enrollmentId": strconv.Itoa(sc.EnrollmentID),
+		"title":        studentCourseTitle(sc),
+		"enrolledAt":   sc.EnrolledAt.Format(time.RFC3339),
+		"isActive":     sc.Accessible(),
+		"hasBook":      sc.HasBook,
+	}
+	if sc.ShowCourseName {
+		courseMap["name"] = sc.Name
+	}
+	if sc.ShowCourseCode {
+		courseMap["code"] = sc.Code
+	}
+	if sc.Author != nil {
+		courseMap["author"] = *sc.Author
+	}
+	if sc.Department != nil {
+		courseMap["department"] = *sc.Department
+	}
+	if sc.ToDate != nil {
+		courseMap["toDate"] = sc.ToDate.Format("2006-01-02")
+	}
+	if sc.ExpiryDate != nil {
+		courseMap["expiryDate"] = sc.ExpiryDate.In(clock.Location()).Format("2006-01-02")
+		courseMap["expiresAt"] = sc.ExpiryDate.In(loc).Format(time.RFC3339)
+	}
+	switch sc.AccessError() {
+	case database.ErrEnrollmentExpired:
+		courseMap["status"] = "expired"
+	case database.ErrCourseEnded:
+		courseMap["status"] = "ended"
+	default:
+		courseMap["status"] = "active"
+		if sc.HasBook {
+			courseMap["bookUrl"] = fmt.Sprintf("/api/my-courses/%d/book", sc.ID)
+		}
+	}
+	return courseMap
+}
+
+// studentCourseTitle is the label students see for a course, respecting the
+// course's name and code visibility
+func studentCourseTitle(sc database.StudentCourse) string {
+	switch {
+	case sc.ShowCourseName:
+		return sc.Name
+	case sc.ShowCourseCode:
+		return sc.Code
+	}
+	return "Course " + strconv.Itoa(sc.ID)
+}
+
+// userLocation returns the timezone times are shown to a user in: their
+// preferred one, or the institution timezone
+func userLocation(ctx context.Context, logPrefix string, userID int) *time.Location {
+	timezone, err := database.GetUserTimezone(ctx, userID)
+	if err != nil {
+		log.Printf("[%s] Failed to fetch timezone of user %d: %v", logPrefix, userID, err)
+	}
+	return clock.UserLocation(timezone)
+}
+
+// courseAccessErrorResponse maps course access errors to HTTP responses
+func courseAccessErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrNotEnrolled, database.ErrCourseNotFound:
+		// Don't reveal courses the student isn't enrolled in
+		return c.Status(404).JSON(fiber.Map{
+			"error": "course not found",
+		})
+	case database.ErrCourseBookNotFound, storage.ErrNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "book not available for this course",
+		})
+	case database.ErrBookFormatNotFound, database.ErrMaterialNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrBookFormatNotReady:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrEnrollmentExpired, database.ErrCourseEnded:
+		return c.Status(403).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Course access error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to fetch course",
+	})
+}
+
+// GetMyCourses returns the courses the current user is enrolled in. Expired
+// enrollments and ended courses are hidden unless includeInactive=true.
+func GetMyCourses(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courses, err := database.GetStudentCourses(ctx, session.UserID, c.Query("includeInactive") == "true")
+	if err != nil {
+		log.Printf("[GetMyCourses] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch courses",
+		})
+	}
+
+	loc := userLocation(ctx, "GetMyCourses", session.UserID)
+	result := make([]fiber.Map, 0, len(courses))
+	for _, sc := range courses {
+		result = append(result, studentCourseToMap(sc, loc))
+	}
+	return c.JSON(result)
+}
+
+// GetMyCourse returns a course the current user is enrolled in
+func GetMyCourse(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "GetMyCourse", err)
+	}
+
+	courseMap := studentCourseToMap(*sc, userLocation(ctx, "GetMyCourse", session.UserID))
+	if sc.HasBook && sc.AccessError() == nil {
+		formats, err := database.GetCourseBookFormats(ctx, courseID)
+		if err != nil {
+			log.Printf("[GetMyCourse] Failed to fetch book formats: %v", err)
+			formats = nil
+		}
+		courseMap["formats"] = studentBookFormats(courseID, formats)
+	}
+	return c.JSON(courseMap)
+}
+
+// studentBookFormats lists the formats a student can pick for a course book.
+// The PDF is always offered; accessible formats are listed with their status
+// and only linked once generated. Failed formats are left out.
+func studentBookFormats(courseID int, formats []database.CourseBookFormat) []fiber.Map {
+	bookURL := fmt.Sprintf("/api/my-courses/%d/book", courseID)
+	result := []fiber.Map{{
+		"format": "pdf",
+		"status": database.BookFormatReady,
+		"url":    bookURL,
+	}}
+	for _, f := range formats {
+		if f.Status == database.BookFormatFailed {
+			continue
+		}
+		formatMap := fiber.Map{
+			"format": f.Format,
+			"status": f.Status,
+		}
+		if f.Status == database.BookFormatReady {
+			formatMap["url"] = bookURL + "?format=" + f.Format
+			if f.FileSize != nil {
+				formatMap["size"] = *f.FileSize
+			}
+		} else {
+			// Queued and in-progress conversions are shown as pending
+			formatMap["status"] = database.BookFormatPending
+		}
+		result = append(result, formatMap)
+	}
+	return result
+}
+
+// DownloadMyCourseBook streams the current user's personal copy of a course
+// book, watermarked with their name and enrollment number. Range requests are
+// supported so readers can page through large books. Access is refused once
+// the enrollment has expired or the course has ended. format=txt, html or epub
+// selects an accessible version converted from the PDF instead.
+func DownloadMyCourseBook(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(60 * time.Second)
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+	if err := sc.AccessError(); err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+
+	if format := c.Query("format"); format != "" && format != "pdf" {
+		return sendBookFormat(ctx, c, *sc, format)
+	}
+
+	book, err := database.GetCourseBook(ctx, courseID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+
+	// Only books held in our own storage can be served; the stored path is
+	// preferred over the URL since it survives a change of API host
+	category, filename, ok := "", "", false
+	if book.Path != nil {
+		category, filename, ok = storage.Locate(*book.Path)
+	}
+	if !ok && book.URL != nil {
+		category, filename, ok = storage.Locate(*book.URL)
+	}
+	if !ok {
+		log.Printf("[DownloadMyCourseBook] Course %d book is not in server storage", courseID)
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", database.ErrCourseBookNotFound)
+	}
+
+	obj, err := books.PersonalCopy(ctx, *sc, category, filename)
+	if err == pdf.ErrEncrypted {
+		log.Printf("[DownloadMyCourseBook] Course %d book is encrypted and can't be watermarked", courseID)
+		return c.Status(422).JSON(fiber.Map{
+			"error": "this book can't be prepared for download, please contact the administrator",
+		})
+	}
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+
+	name := unsafeFilenameChars.ReplaceAllString(studentCourseTitle(*sc), "_") + ".pdf"
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", name))
+	c.Set("Cache-Control", "private, no-store")
+	return sendRanged(c, obj)
+}
+
+// sendBookFormat sends the student's copy of an accessible version of a
+// course book
+func sendBookFormat(ctx context.Context, c *fiber.Ctx, sc database.StudentCourse, format string) error {
+	if !database.ValidBookFormat(format) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format must be one of pdf, " + strings.Join(database.BookFormats, ", "),
+		})
+	}
+
+	f, err := database.GetReadyBookFormat(ctx, sc.ID, format)
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+	category, filename, ok := storage.Locate(*f.FileURL)
+	if !ok {
+		log.Printf("[DownloadMyCourseBook] Course %d %s book is not in server storage", sc.ID, format)
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", database.ErrBookFormatNotFound)
+	}
+	obj, err := books.PersonalFormat(ctx, sc, format, category, filename)
+	if err != nil {
+		return courseAccessErrorResponse(c, "DownloadMyCourseBook", err)
+	}
+
+	name := unsafeFilenameChars.ReplaceAllString(studentCourseTitle(sc), "_") + "." + format
+	disposition := "inline"
+	if format == database.BookFormatEPUB {
+		disposition = "attachment"
+	}
+	c.Set("Content-Type", books.ContentTypes[format])
+	c.Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, name))
+	c.Set("Cache-Control", "private, no-store")
+	return sendRanged(c, obj)
+}
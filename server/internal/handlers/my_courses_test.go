@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+func TestStudentCourseToMap(t *testing.T) {
+	tests := []struct {
+		name     string
+		course   database.StudentCourse
+		title    string
+		status   string
+		showName bool
+		showCode bool
+		bookURL  bool
+	}{
+		{
+			"active course with book",
+			database.StudentCourse{ID: 3, Name: "Algebra", Code: "MTH101", ShowCourseName: true, ShowCourseCode: true, HasBook: true, Active: true},
+			"Algebra", "active", true, true, true,
+		},
+		{
+			"hidden name falls back to code",
+			database.StudentCourse{ID: 3, Name: "Algebra", Code: "MTH101", ShowCourseCode: true, Active: true},
+			"MTH101", "active", false, true, false,
+		},
+		{
+			"hidden name and code",
+			database.StudentCourse{ID: 3, Name: "Algebra", Code: "MTH101", HasBook: true, Active: true},
+			"Course 3", "active", false, false, true,
+		},
+		{
+			"expired enrollment has no book link",
+			database.StudentCourse{ID: 3, Name: "Algebra", ShowCourseName: true, HasBook: true},
+			"Algebra", "expired", true, false, false,
+		},
+		{
+			"ended course has no book link",
+			database.StudentCourse{ID: 3, Name: "Algebra", ShowCourseName: true, HasBook: true, Active: true, Ended: true},
+			"Algebra", "ended", true, false, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := studentCourseToMap(tt.course, clock.Location())
+			if m["title"] != tt.title || m["status"] != tt.status {
+				t.Errorf("title, status = %v, %v; want %v, %v", m["title"], m["status"], tt.title, tt.status)
+			}
+			if _, ok := m["name"]; ok != tt.showName {
+				t.Errorf("name present = %v, want %v", ok, tt.showName)
+			}
+			if _, ok := m["code"]; ok != tt.showCode {
+				t.Errorf("code present = %v, want %v", ok, tt.showCode)
+			}
+			if _, ok := m["bookUrl"]; ok != tt.bookURL {
+				t.Errorf("bookUrl present = %v, want %v", ok, tt.bookURL)
+			}
+		})
+	}
+}
+
+func TestStudentCourseToMapExpiry(t *testing.T) {
+	expiry := clock.EndOfDay(time.Date(2026, 5, 31, 0, 0, 0, 0, time.UTC))
+	course := database.StudentCourse{ID: 1, Active: true, ExpiryDate: &expiry}
+
+	tokyo, err := clock.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := studentCourseToMap(course, tokyo)
+	// The institution's calendar date, with the moment access ends in the student's timezone
+	if m["expiryDate"] != "2026-05-31" || m["expiresAt"] != "2026-06-01T03:29:59+09:00" {
+		t.Errorf("expiryDate, expiresAt = %v, %v", m["expiryDate"], m["expiresAt"])
+	}
+}
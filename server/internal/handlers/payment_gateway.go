@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+	"github.com/server/internal/payments"
+)
+
+// paymentOrderToMap converts a payment order to the API response format
+func paymentOrderToMap(o database.PaymentOrder) fiber.Map {
+	orderMap := fiber.Map{
+		"_id":             strconv.Itoa(o.ID),
+		"rideBillId":      strconv.Itoa(o.RideBillID),
+		"provider":        o.Provider,
+		"providerOrderId": o.ProviderOrderID,
+		"amount":          o.Amount,
+		"currency":        o.Currency,
+		"status":          o.Status,
+		"createdAt":       o.CreatedAt.Format(time.RFC3339),
+		"updatedAt":       o.UpdatedAt.Format(time.RFC3339),
+	}
+	if o.ProviderPaymentID != nil {
+		orderMap["providerPaymentId"] = *o.ProviderPaymentID
+	}
+	if o.PaidAt != nil {
+		orderMap["paidAt"] = o.PaidAt.Format(time.RFC3339)
+	}
+	return orderMap
+}
+
+// CreateRideBillPaymentOrder creates an online payment order for a ride bill's
+// outstanding balance. Students can only pay their own bills.
+func CreateRideBillPaymentOrder(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	provider := payments.GetProvider()
+	if provider == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "online payments are not configured",
+		})
+	}
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var ownerID int
+	err = database.GetPool().QueryRow(ctx, `SELECT user_id FROM ride_bills WHERE id = $1`, billID).Scan(&ownerID)
+	if err == pgx.ErrNoRows {
+		err = database.ErrBillNotFound
+	}
+	if err != nil {
+		return paymentErrorResponse(c, "CreateRideBillPaymentOrder", err)
+	}
+
+	role := strings.ToLower(session.Role)
+	if ownerID != session.UserID && role != "admin" && role != "superadmin" {
+		// Don't reveal other users' bills
+		return paymentErrorResponse(c, "CreateRideBillPaymentOrder", database.ErrBillNotFound)
+	}
+
+	balance, err := database.GetBillBalance(ctx, billID)
+	if err != nil {
+		return paymentErrorResponse(c, "CreateRideBillPaymentOrder", err)
+	}
+	if balance.Status == "cancelled" {
+		return paymentErrorResponse(c, "CreateRideBillPaymentOrder", database.ErrBillCancelled)
+	}
+	if balance.Balance <= 0 {
+		return paymentErrorResponse(c, "CreateRideBillPaymentOrder", database.ErrNothingOutstanding)
+	}
+
+	// Reuse an open order for the same amount so retries from the client don't
+	// create duplicate orders with the gateway
+	order, err := database.GetOpenPaymentOrder(ctx, billID, provider.Name(), balance.Balance)
+	if err != nil {
+		log.Printf("[CreateRideBillPaymentOrder] Open order lookup error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to create payment order",
+		})
+	}
+
+	status := 200
+	if order == nil {
+		gatewayOrder, err := provider.CreateOrder(ctx, payments.OrderRequest{
+			RideBillID: billID,
+			Amount:     balance.Balance,
+			Currency:   config.PaymentCurrency(),
+			Receipt:    "ride_bill_" + strconv.Itoa(billID),
+			Notes: map[string]string{
+				"ride_bill_id": strconv.Itoa(billID),
+				"user_id":      strconv.Itoa(ownerID),
+			},
+		})
+		if err != nil {
+			log.Printf("[CreateRideBillPaymentOrder] Provider error: %v", err)
+			return c.Status(502).JSON(fiber.Map{
+				"error": "payment provider is unavailable. Please try again",
+			})
+		}
+
+		order, err = database.SavePaymentOrder(ctx, database.PaymentOrder{
+			RideBillID:      billID,
+			Provider:        provider.Name(),
+			ProviderOrderID: gatewayOrder.ID,
+			Amount:          gatewayOrder.Amount,
+			Currency:        gatewayOrder.Currency,
+			CreatedBy:       &session.UserID,
+		})
+		if err != nil {
+			return paymentErrorResponse(c, "CreateRideBillPaymentOrder", err)
+		}
+		status = 201
+		invalidateAnalytics("CreateRideBillPaymentOrder")
+	}
+
+	return c.Status(status).JSON(fiber.Map{
+		"order":   paymentOrderToMap(*order),
+		"keyId":   provider.PublicKey(),
+		"balance": balanceToMap(balance),
+	})
+}
+
+// GetRideBillPaymentOrders returns the online payment orders for a ride bill
+func GetRideBillPaymentOrders(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	orders, err := database.GetBillPaymentOrders(ctx, billID)
+	if err != nil {
+		log.Printf("[GetRideBillPaymentOrders] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch payment orders",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(orders))
+	for _, o := range orders {
+		result = append(result, paymentOrderToMap(o))
+	}
+
+	return c.JSON(result)
+}
+
+// PaymentWebhook receives payment gateway webhooks. It is a public route:
+// requests are authenticated by the provider's HMAC signature.
+func PaymentWebhook(c *fiber.Ctx) error {
+	provider := payments.GetProvider()
+	if provider == nil {
+		return c.Status(503).JSON(fiber.Map{
+			"error": "online payments are not configured",
+		})
+	}
+
+	return processPaymentWebhook(c, provider, c.Body(), func(name string) string {
+		return c.Get(name)
+	})
+}
+
+// processPaymentWebhook verifies and applies a webhook body
+func processPaymentWebhook(c *fiber.Ctx, provider payments.PaymentProvider, body []byte, header func(string) string) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	event, err := provider.ParseWebhook(body, header)
+	if err != nil {
+		if err == payments.ErrInvalidSignature {
+			log.Printf("[PaymentWebhook] Rejected webhook with invalid signature from %s", c.IP())
+			return c.Status(401).JSON(fiber.Map{
+				"error": "invalid signature",
+			})
+		}
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid webhook payload",
+		})
+	}
+
+	outcome, err := database.ProcessGatewayEvent(ctx, database.GatewayEvent{
+		Provider:  provider.Name(),
+		EventID:   event.ID,
+		Type:      event.Type,
+		OrderID:   event.OrderID,
+		PaymentID: event.PaymentID,
+		Amount:    event.Amount,
+		Method:    event.Method,
+		Payload:   event.Raw,
+	})
+	if err != nil {
+		// A non-2xx response makes the gateway retry the delivery later
+		log.Printf("[PaymentWebhook] Failed to process event %s: %v", event.ID, err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to process webhook",
+		})
+	}
+
+	switch outcome {
+	case database.WebhookOutcomeSettled, database.WebhookOutcomeFailed:
+		invalidateAnalytics("PaymentWebhook")
+	case database.WebhookOutcomeUnknownOrder:
+		log.Printf("[PaymentWebhook] Event %s references unknown order %s", event.ID, event.OrderID)
+	}
+
+	return c.JSON(fiber.Map{
+		"received": true,
+		"outcome":  outcome,
+	})
+}
+
+// SimulateFakePaymentRequest represents a request to complete a fake gateway payment
+type SimulateFakePaymentRequest struct {
+	Outcome string `json:"outcome"` // "captured" (default) or "failed"
+	Method  string `json:"method"`  // Gateway method, defaults to "upi"
+}
+
+// SimulateFakePayment completes a fake gateway order by sending it through the
+// webhook path, as the real gateway would. Only available with the fake provider.
+func SimulateFakePayment(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	fake, ok := payments.GetProvider().(*payments.FakeProvider)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "not found",
+		})
+	}
+
+	var req SimulateFakePaymentRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	eventType := payments.EventPaymentCaptured
+	switch req.Outcome {
+	case "", "captured":
+	case "failed":
+		eventType = payments.EventPaymentFailed
+	default:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid outcome. Must be one of: captured, failed",
+		})
+	}
+	if req.Method == "" {
+		req.Method = "upi"
+	}
+
+	orderID := c.Params("orderId")
+	order, ok := fake.GetOrder(orderID)
+	if !ok {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "payment order not found",
+		})
+	}
+
+	var ownerID int
+	err := database.GetPool().QueryRow(ctx, `
+		SELECT rb.user_id FROM payment_orders po
+		JOIN ride_bills rb ON rb.id = po.ride_bill_id
+		WHERE po.provider = $1 AND po.provider_order_id = $2
+	`, fake.Name(), orderID).Scan(&ownerID)
+	session := middleware.GetSession(c)
+	if err != nil || session == nil || ownerID != session.UserID {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "payment order not found",
+		})
+	}
+
+	body, headers, err := fake.BuildWebhook(eventType, orderID, req.Method, order.Amount)
+	if err != nil {
+		log.Printf("[SimulateFakePayment] Build webhook error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to simulate payment",
+		})
+	}
+
+	return processPaymentWebhook(c, fake, body, func(name string) string {
+		return headers[name]
+	})
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// RecordPaymentRequest represents a payment or refund ledger entry request
+type RecordPaymentRequest struct {
+	Method    string  `json:"method"`
+	Amount    float64 `json:"amount"`
+	Reference *string `json:"reference,omitempty"`
+	Notes     *string `json:"notes,omitempty"`
+	PaidAt    string  `json:"paidAt,omitempty"` // Optional RFC3339 timestamp, defaults to now
+}
+
+// paymentToMap converts a ledger entry to the API response format
+func paymentToMap(p database.Payment) fiber.Map {
+	paymentMap := fiber.Map{
+		"_id":        strconv.Itoa(p.ID),
+		"rideBillId": strconv.Itoa(p.RideBillID),
+		"kind":       p.Kind,
+		"method":     p.Method,
+		"amount":     p.Amount,
+		"paidAt":     p.PaidAt.Format(time.RFC3339),
+		"createdAt":  p.CreatedAt.Format(time.RFC3339),
+	}
+	if p.Reference != nil {
+		paymentMap["reference"] = *p.Reference
+	}
+	if p.Notes != nil {
+		paymentMap["notes"] = *p.Notes
+	}
+	if p.RecordedBy != nil {
+		paymentMap["recordedBy"] = strconv.Itoa(*p.RecordedBy)
+	}
+	return paymentMap
+}
+
+// balanceToMap converts a bill balance to the API response format
+func balanceToMap(b *database.BillBalance) fiber.Map {
+	return fiber.Map{
+		"fare":           b.Fare,
+		"amountPaid":     b.AmountPaid,
+		"amountRefunded": b.AmountRefunded,
+		"netPaid":        b.NetPaid,
+		"balance":        b.Balance,
+		"status":         b.Status,
+	}
+}
+
+// paymentErrorResponse maps ledger errors to HTTP responses
+func paymentErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrBillNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride bill not found",
+		})
+	case database.ErrBillCancelled:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "cannot record a payment against a cancelled ride bill",
+		})
+	case database.ErrAmountExceedsBalance:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "amount exceeds the outstanding balance",
+		})
+	case database.ErrNothingOutstanding:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ride bill has no outstanding balance",
+		})
+	case database.ErrRefundExceedsPaid:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "refund exceeds the amount paid",
+		})
+	}
+	log.Printf("[%s] Ledger error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to update payment ledger",
+	})
+}
+
+// GetRideBillPayments returns the payment ledger and balance for a ride bill
+func GetRideBillPayments(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	balance, err := database.GetBillBalance(ctx, billID)
+	if err != nil {
+		return paymentErrorResponse(c, "GetRideBillPayments", err)
+	}
+
+	payments, err := database.GetBillPayments(ctx, billID)
+	if err != nil {
+		log.Printf("[GetRideBillPayments] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch payments",
+		})
+	}
+
+	entries := make([]fiber.Map, 0, len(payments))
+	for _, p := range payments {
+		entries = append(entries, paymentToMap(p))
+	}
+
+	return c.JSON(fiber.Map{
+		"payments": entries,
+		"balance":  balanceToMap(balance),
+	})
+}
+
+// RecordRideBillPayment records a payment received against a ride bill
+func RecordRideBillPayment(c *fiber.Ctx) error {
+	return recordLedgerEntry(c, database.PaymentKindPayment, "RecordRideBillPayment")
+}
+
+// RecordRideBillRefund records a refund issued from a ride bill
+func RecordRideBillRefund(c *fiber.Ctx) error {
+	return recordLedgerEntry(c, database.PaymentKindRefund, "RecordRideBillRefund")
+}
+
+// recordLedgerEntry validates and records a payment or refund
+func recordLedgerEntry(c *fiber.Ctx, kind, logPrefix string) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var req RecordPaymentRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	method := strings.ToLower(strings.TrimSpace(req.Method))
+	if !database.ValidPaymentMethods[method] {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid method. Must be one of: cash, upi, card, bank_transfer, other",
+		})
+	}
+
+	if req.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "amount must be greater than zero",
+		})
+	}
+
+	var paidAt time.Time
+	if req.PaidAt != "" {
+		paidAt, err = time.Parse(time.RFC3339, req.PaidAt)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid paidAt format. Use RFC3339",
+			})
+		}
+		if paidAt.After(clock.Now().Add(5 * time.Minute)) {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "paidAt cannot be in the future",
+			})
+		}
+	}
+
+	var recordedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		recordedBy = &session.UserID
+	}
+
+	payment, balance, err := database.RecordPayment(ctx, database.NewPayment{
+		RideBillID: billID,
+		Kind:       kind,
+		Method:     method,
+		Amount:     req.Amount,
+		Reference:  req.Reference,
+		Notes:      req.Notes,
+		RecordedBy: recordedBy,
+		PaidAt:     paidAt,
+	})
+	if err != nil {
+		return paymentErrorResponse(c, logPrefix, err)
+	}
+
+	invalidateAnalytics(logPrefix)
+	requestID := middleware.GetRequestID(c)
+	return c.Status(201).JSON(fiber.Map{
+		"payment":    paymentToMap(*payment),
+		"balance":    balanceToMap(balance),
+		"request_id": requestID,
+	})
+}
+
+// GetPaymentReconciliation compares expected and collected totals per day
+func GetPaymentReconciliation(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	now := clock.Now()
+	from := now.AddDate(0, 0, -29)
+	to := now
+
+	if fromStr := c.Query("from"); fromStr != "" {
+		parsed, err := time.Parse("2006-01-02", fromStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid from date format. Use YYYY-MM-DD",
+			})
+		}
+		from = parsed
+	}
+	if toStr := c.Query("to"); toStr != "" {
+		parsed, err := time.Parse("2006-01-02", toStr)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid to date format. Use YYYY-MM-DD",
+			})
+		}
+		to = parsed
+	}
+
+	if to.Before(from) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "to date must not be before from date",
+		})
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "date range cannot exceed one year",
+		})
+	}
+
+	days, err := database.GetReconciliationReport(ctx, from, to)
+	if err != nil {
+		log.Printf("[GetPaymentReconciliation] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to build reconciliation report",
+		})
+	}
+
+	var totalExpected, totalCollected, totalRefunded float64
+	for _, d := range days {
+		totalExpected += d.Expected
+		totalCollected += d.Collected
+		totalRefunded += d.Refunded
+	}
+
+	return c.JSON(fiber.Map{
+		"from": from.Format("2006-01-02"),
+		"to":   to.Format("2006-01-02"),
+		"days": days,
+		"totals": fiber.Map{
+			"expected":     database.RoundCents(totalExpected),
+			"collected":    database.RoundCents(totalCollected),
+			"refunded":     database.RoundCents(totalRefunded),
+			"netCollected": database.RoundCents(totalCollected - totalRefunded),
+			"difference":   database.RoundCents(totalExpected - (totalCollected - totalRefunded)),
+		},
+	})
+}
@@ -5,6 +5,8 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
 	"github.com/server/internal/database"
 	"github.com/server/internal/middleware"
 )
@@ -34,15 +36,27 @@ func GetPreferences(c *fiber.Ctx) error {
 		"preferences": fiber.Map{
 			"accentColor": prefs.AccentColor,
 			"theme":       prefs.Theme,
+			"timezone":    prefs.Timezone,
 		},
-		"request_id": requestID,
+		"institution": institutionTimeMap(),
+		"request_id":  requestID,
 	})
 }
 
+// institutionTimeMap describes the institution timezone and locale clients
+// format dates with when the user has no timezone of their own
+func institutionTimeMap() fiber.Map {
+	return fiber.Map{
+		"timezone": clock.Location().String(),
+		"locale":   config.Locale(),
+	}
+}
+
 // UpdatePreferencesRequest represents a request to update user preferences
 type UpdatePreferencesRequest struct {
-	AccentColor string `json:"accentColor"`
-	Theme       string `json:"theme"`
+	AccentColor string  `json:"accentColor"`
+	Theme       string  `json:"theme"`
+	Timezone    *string `json:"timezone"` // IANA name; empty clears it
 }
 
 // UpdatePreferences updates the current user's preferences
@@ -102,6 +116,19 @@ func UpdatePreferences(c *fiber.Ctx) error {
 		})
 	}
 
+	// Validate timezone
+	var timezone *string
+	if req.Timezone != nil {
+		timezone = optionalText(*req.Timezone)
+		if timezone != nil {
+			if _, err := clock.LoadLocation(*timezone); err != nil {
+				return c.Status(400).JSON(fiber.Map{
+					"error": "invalid timezone. Must be an IANA name such as Asia/Kolkata",
+				})
+			}
+		}
+	}
+
 	// Use existing values if not provided
 	prefs, err := database.GetUserPreferences(ctx, session.UserID)
 	if err != nil {
@@ -132,13 +159,26 @@ func UpdatePreferences(c *fiber.Ctx) error {
 		})
 	}
 
+	if req.Timezone != nil {
+		if err := database.UpdateUserTimezone(ctx, session.UserID, timezone); err != nil {
+			log.Printf("[UpdatePreferences] Error updating timezone: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to update preferences",
+			})
+		}
+	} else {
+		timezone = prefs.Timezone
+	}
+
 	requestID := middleware.GetRequestID(c)
 	return c.JSON(fiber.Map{
 		"message": "Preferences updated successfully",
 		"preferences": fiber.Map{
 			"accentColor": accentColor,
 			"theme":       theme,
+			"timezone":    timezone,
 		},
-		"request_id": requestID,
+		"institution": institutionTimeMap(),
+		"request_id":  requestID,
 	})
 }
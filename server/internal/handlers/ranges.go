@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/storage"
+)
+
+// byteRange is an inclusive range of bytes within a response body
+type byteRange struct {
+	start, end int
+}
+
+// parseByteRange resolves a Range header against a body of size bytes. It
+// returns 206 with the range to send, 416 when the range can't be satisfied,
+// or 200 when the whole body should be sent. Only single ranges are served;
+// a multi-range or malformed header falls back to the whole body.
+func parseByteRange(header string, size int) (byteRange, int) {
+	spec, ok := strings.CutPrefix(strings.TrimSpace(header), "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return byteRange{}, 200
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return byteRange{}, 200
+	}
+
+	if first == "" {
+		// Suffix range: the final n bytes
+		n, err := strconv.Atoi(last)
+		if err != nil || n < 0 {
+			return byteRange{}, 200
+		}
+		if n == 0 || size == 0 {
+			return byteRange{}, 416
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{size - n, size - 1}, 206
+	}
+
+	start, err := strconv.Atoi(first)
+	if err != nil || start < 0 {
+		return byteRange{}, 200
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.Atoi(last)
+		if err != nil || end < start {
+			return byteRange{}, 200
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	if start >= size {
+		return byteRange{}, 416
+	}
+	return byteRange{start, end}, 206
+}
+
+// etagMatches reports whether an If-None-Match or If-Range header lists etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// sendRanged sends a stored file honouring Range, If-Range and If-None-Match
+// so clients can resume downloads and fetch large files piece by piece. Only
+// the requested bytes are read from storage. The Content-Type and other
+// headers should be set before calling.
+func sendRanged(c *fiber.Ctx, obj *storage.Object) error {
+	etag := obj.ETag
+	c.Set("ETag", etag)
+	c.Set("Accept-Ranges", "bytes")
+
+	if match := c.Get("If-None-Match"); match != "" && etagMatches(match, etag) {
+		return c.SendStatus(304)
+	}
+
+	size := int(obj.Size)
+	header := c.Get("Range")
+	// A range is only valid against the representation the client already
+	// holds; If-Range requires an exact strong match
+	if header == "" || c.Method() != fiber.MethodGet ||
+		(c.Get("If-Range") != "" && strings.TrimSpace(c.Get("If-Range")) != etag) {
+		return sendObjectRange(c, obj, 0, size)
+	}
+
+	r, status := parseByteRange(header, size)
+	switch status {
+	case 416:
+		c.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		return c.Status(416).JSON(fiber.Map{
+			"error": "requested range not satisfiable",
+		})
+	case 206:
+		c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", r.start, r.end, size))
+		c.Status(206)
+		return sendObjectRange(c, obj, r.start, r.end-r.start+1)
+	}
+	return sendObjectRange(c, obj, 0, size)
+}
+
+// sendObjectRange streams length bytes of obj starting at offset
+func sendObjectRange(c *fiber.Ctx, obj *storage.Object, offset, length int) error {
+	if c.Method() == fiber.MethodHead {
+		c.Response().Header.SetContentLength(length)
+		return nil
+	}
+	body, err := obj.NewRangeReader(c.UserContext(), int64(offset), int64(length))
+	if err != nil {
+		log.Printf("[sendRanged] Error reading stored file: %v", err)
+		c.Response().Header.Del("Content-Range")
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to read file",
+		})
+	}
+	// The response writer closes the body once it has been sent
+	return c.SendStream(body, length)
+}
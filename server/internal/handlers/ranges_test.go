@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/storage"
+)
+
+func TestParseByteRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		size   int
+		want   byteRange
+		status int
+	}{
+		{"closed range", "bytes=0-99", 1000, byteRange{0, 99}, 206},
+		{"open range", "bytes=900-", 1000, byteRange{900, 999}, 206},
+		{"suffix range", "bytes=-100", 1000, byteRange{900, 999}, 206},
+		{"suffix longer than body", "bytes=-5000", 1000, byteRange{0, 999}, 206},
+		{"end past body is clamped", "bytes=990-2000", 1000, byteRange{990, 999}, 206},
+		{"single byte", "bytes=5-5", 1000, byteRange{5, 5}, 206},
+		{"start past body", "bytes=1000-", 1000, byteRange{}, 416},
+		{"zero suffix", "bytes=-0", 1000, byteRange{}, 416},
+		{"empty body", "bytes=0-10", 0, byteRange{}, 416},
+		{"multiple ranges", "bytes=0-1,5-6", 1000, byteRange{}, 200},
+		{"other unit", "items=0-1", 1000, byteRange{}, 200},
+		{"end before start", "bytes=10-5", 1000, byteRange{}, 200},
+		{"not a number", "bytes=a-b", 1000, byteRange{}, 200},
+		{"missing dash", "bytes=10", 1000, byteRange{}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status := parseByteRange(tt.header, tt.size)
+			if status != tt.status || got != tt.want {
+				t.Errorf("parseByteRange(%q, %d) = %v, %d, want %v, %d",
+					tt.header, tt.size, got, status, tt.want, tt.status)
+			}
+		})
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	etag := storage.NewObject([]byte("%PDF-1.7")).ETag
+
+	tests := []struct {
+		name   string
+		header string
+		want   bool
+	}{
+		{"exact", etag, true},
+		{"in list", `"other", ` + etag, true},
+		{"weak form", "W/" + etag, true},
+		{"wildcard", "*", true},
+		{"different", `"00000000-1"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, etag); got != tt.want {
+				t.Errorf("etagMatches(%q) = %v, want %v", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSendRanged(t *testing.T) {
+	obj := storage.NewObject([]byte("%PDF-1.7 personal copy"))
+	app := fiber.New()
+	app.Get("/book", func(c *fiber.Ctx) error {
+		return sendRanged(c, obj)
+	})
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"whole body", nil, 200, "%PDF-1.7 personal copy"},
+		{"range", map[string]string{"Range": "bytes=9-16"}, 206, "personal"},
+		{"stale if-range", map[string]string{"Range": "bytes=9-16", "If-Range": `"other"`}, 200, "%PDF-1.7 personal copy"},
+		{"not modified", map[string]string{"If-None-Match": obj.ETag}, 304, ""},
+		{"unsatisfiable", map[string]string{"Range": "bytes=100-"}, 416, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/book", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if tt.body != "" && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
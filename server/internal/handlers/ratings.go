@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// maxFeedbackCommentLength caps rating and report comments
+const maxFeedbackCommentLength = 1000
+
+// rideRatingToMap converts a ride rating to the API response format
+func rideRatingToMap(r database.RideRating) fiber.Map {
+	ratingMap := fiber.Map{
+		"_id":          strconv.Itoa(r.ID),
+		"billId":       strconv.Itoa(r.BillID),
+		"userId":       strconv.Itoa(r.UserID),
+		"studentName":  r.StudentName,
+		"rating":       r.Rating,
+		"tags":         r.Tags,
+		"fromLocation": r.FromLocation,
+		"toLocation":   r.ToLocation,
+		"rideAt":       r.RideAt.Format(time.RFC3339),
+		"createdAt":    r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.DriverID != nil {
+		ratingMap["driverId"] = strconv.Itoa(*r.DriverID)
+	}
+	if r.DriverName != nil {
+		ratingMap["driverName"] = *r.DriverName
+	}
+	if r.Comment != nil {
+		ratingMap["comment"] = *r.Comment
+	}
+	return ratingMap
+}
+
+// passengerReportToMap converts a passenger report to the API response format
+func passengerReportToMap(r database.PassengerReport) fiber.Map {
+	reportMap := fiber.Map{
+		"_id":         strconv.Itoa(r.ID),
+		"billId":      strconv.Itoa(r.BillID),
+		"driverId":    strconv.Itoa(r.DriverID),
+		"driverName":  r.DriverName,
+		"userId":      strconv.Itoa(r.UserID),
+		"studentName": r.StudentName,
+		"tags":        r.Tags,
+		"createdAt":   r.CreatedAt.Format(time.RFC3339),
+	}
+	if r.Comment != nil {
+		reportMap["comment"] = *r.Comment
+	}
+	return reportMap
+}
+
+// feedbackErrorResponse maps rating and report errors to HTTP responses
+func feedbackErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrBillNotFound, database.ErrNotYourRide:
+		// Don't reveal other users' rides
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride bill not found",
+		})
+	case database.ErrRatingNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrRideNotCompleted, database.ErrAlreadyRated, database.ErrAlreadyReported:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	log.Printf("[%s] Feedback error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to save feedback",
+	})
+}
+
+// normalizeFeedbackComment trims a comment and checks its length
+func normalizeFeedbackComment(comment *string) (*string, string) {
+	if comment == nil {
+		return nil, ""
+	}
+	trimmed := strings.TrimSpace(*comment)
+	if trimmed == "" {
+		return nil, ""
+	}
+	if len(trimmed) > maxFeedbackCommentLength {
+		return nil, "comment must be at most " + strconv.Itoa(maxFeedbackCommentLength) + " characters"
+	}
+	return &trimmed, ""
+}
+
+// feedbackSince parses the days query parameter into the start of the period
+func feedbackSince(c *fiber.Ctx, defaultDays int) (time.Time, string) {
+	days := defaultDays
+	if value := c.Query("days"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > 365 {
+			return time.Time{}, "days must be between 1 and 365"
+		}
+		days = parsed
+	}
+	return clock.Now().AddDate(0, 0, -days), ""
+}
+
+// GetFeedbackTags returns the tags available for ride ratings and passenger reports
+func GetFeedbackTags(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"ratingTags":          database.RatingTags,
+		"passengerReportTags": database.PassengerReportTags,
+	})
+}
+
+// RideRatingRequest represents a student's rating of a ride
+type RideRatingRequest struct {
+	Rating  int      `json:"rating"` // 1 to 5
+	Tags    []string `json:"tags"`
+	Comment *string  `json:"comment"`
+}
+
+// RateRideBill rates a completed ride. Only the student who booked the ride
+// can rate it, once.
+func RateRideBill(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var req RideRatingRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.Rating < 1 || req.Rating > 5 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "rating must be between 1 and 5",
+		})
+	}
+	tags, err := database.NormalizeRatingTags(req.Tags)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	comment, msg := normalizeFeedbackComment(req.Comment)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	rating, err := database.CreateRideRating(ctx, billID, session.UserID, req.Rating, tags, comment)
+	if err != nil {
+		return feedbackErrorResponse(c, "RateRideBill", err)
+	}
+	return c.Status(201).JSON(rideRatingToMap(*rating))
+}
+
+// GetRideBillRating returns the rating of a ride. Students can only see
+// ratings of their own rides.
+func GetRideBillRating(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	rating, err := database.GetRideRating(ctx, billID)
+	if err != nil {
+		return feedbackErrorResponse(c, "GetRideBillRating", err)
+	}
+
+	role := strings.ToLower(session.Role)
+	if rating.UserID != session.UserID && role != "admin" && role != "superadmin" {
+		return feedbackErrorResponse(c, "GetRideBillRating", database.ErrNotYourRide)
+	}
+	return c.JSON(rideRatingToMap(*rating))
+}
+
+// PassengerReportRequest represents an issue a driver flags with a passenger
+type PassengerReportRequest struct {
+	Tags    []string `json:"tags"`
+	Comment *string  `json:"comment"`
+}
+
+// ReportPassenger flags an issue with the passenger of a completed ride the
+// current driver drove
+func ReportPassenger(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	billID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
+	var req PassengerReportRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	tags, err := database.NormalizePassengerReportTags(req.Tags)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	comment, msg := normalizeFeedbackComment(req.Comment)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if len(tags) == 0 && comment == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "tags or comment is required",
+		})
+	}
+
+	report, err := database.CreatePassengerReport(ctx, billID, session.UserID, tags, comment)
+	if err != nil {
+		return feedbackErrorResponse(c, "ReportPassenger", err)
+	}
+	return c.Status(201).JSON(passengerReportToMap(*report))
+}
+
+// GetDriverRatingSummaries returns aggregated scores of every active driver
+// over the last days (default 90). Drivers with consistently low scores are flagged.
+func GetDriverRatingSummaries(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	since, msg := feedbackSince(c, 90)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	summaries, err := database.GetDriverRatingSummaries(ctx, since)
+	if err != nil {
+		log.Printf("[GetDriverRatingSummaries] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch driver ratings",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(summaries))
+	for _, s := range summaries {
+		result = append(result, fiber.Map{
+			"driverId":     strconv.Itoa(s.DriverID),
+			"name":         s.Name,
+			"ratings":      s.Ratings,
+			"average":      s.Average,
+			"score":        s.Score,
+			"distribution": s.Distribution,
+			"lowRatings":   s.LowRatings,
+			"tags":         s.Tags,
+			"flagged":      s.Flagged,
+		})
+	}
+	return c.JSON(fiber.Map{
+		"since":   since.Format(time.RFC3339),
+		"drivers": result,
+	})
+}
+
+// GetDriverRatings returns a driver's individual ratings over the last days (default 90)
+func GetDriverRatings(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	driverID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid driver id format",
+		})
+	}
+	since, msg := feedbackSince(c, 90)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ratings, err := database.GetDriverRatings(ctx, driverID, since)
+	if err != nil {
+		log.Printf("[GetDriverRatings] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch driver ratings",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(ratings))
+	for _, r := range ratings {
+		result = append(result, rideRatingToMap(r))
+	}
+	return c.JSON(result)
+}
+
+// GetLowRatingAlerts returns low ratings and ratings reporting unsafe driving
+// or an inaccessible vehicle over the last days (default 30), newest first
+func GetLowRatingAlerts(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	since, msg := feedbackSince(c, 30)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ratings, err := database.GetLowRatingAlerts(ctx, since)
+	if err != nil {
+		log.Printf("[GetLowRatingAlerts] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch rating alerts",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(ratings))
+	for _, r := range ratings {
+		result = append(result, rideRatingToMap(r))
+	}
+	return c.JSON(result)
+}
+
+// GetPassengerReports returns issues drivers flagged with passengers over the
+// last days (default 30), newest first
+func GetPassengerReports(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	since, msg := feedbackSince(c, 30)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	reports, err := database.GetPassengerReports(ctx, since)
+	if err != nil {
+		log.Printf("[GetPassengerReports] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch passenger reports",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(reports))
+	for _, r := range reports {
+		result = append(result, passengerReportToMap(r))
+	}
+	return c.JSON(result)
+}
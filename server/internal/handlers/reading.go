@@ -0,0 +1,563 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+const (
+	// maxReadingSyncItems caps the bookmarks and highlights of one sync
+	maxReadingSyncItems = 500
+	maxBookmarkLabelLen = 200
+	maxHighlightTextLen = 5000
+	// clientClockSkew is how far ahead of the server a device's clock may
+	// run before the times it sends are clamped
+	clientClockSkew = 30 * time.Second
+)
+
+// readingProgressToMap converts reading progress to API response format
+func readingProgressToMap(p *database.ReadingProgress) fiber.Map {
+	progressMap := fiber.Map{
+		"page":      p.Page,
+		"percent":   p.Percent,
+		"updatedAt": p.UpdatedAt.Format(time.RFC3339Nano),
+		"syncedAt":  p.SyncedAt.Format(time.RFC3339),
+	}
+	if p.PageCount != nil {
+		progressMap["pageCount"] = *p.PageCount
+	}
+	return progressMap
+}
+
+// bookmarkToMap converts a bookmark to API response format
+func bookmarkToMap(b database.Bookmark) fiber.Map {
+	bookmarkMap := fiber.Map{
+		"id":        b.ID,
+		"page":      b.Page,
+		"deleted":   b.Deleted,
+		"updatedAt": b.UpdatedAt.Format(time.RFC3339Nano),
+		"syncedAt":  b.SyncedAt.Format(time.RFC3339),
+	}
+	if b.Label != nil {
+		bookmarkMap["label"] = *b.Label
+	}
+	return bookmarkMap
+}
+
+// highlightToMap converts a highlight to API response format
+func highlightToMap(h database.Highlight) fiber.Map {
+	highlightMap := fiber.Map{
+		"id":          h.ID,
+		"page":        h.Page,
+		"startOffset": h.StartOffset,
+		"endOffset":   h.EndOffset,
+		"color":       h.Color,
+		"deleted":     h.Deleted,
+		"updatedAt":   h.UpdatedAt.Format(time.RFC3339Nano),
+		"syncedAt":    h.SyncedAt.Format(time.RFC3339),
+	}
+	if h.Text != nil {
+		highlightMap["text"] = *h.Text
+	}
+	if h.Note != nil {
+		highlightMap["note"] = *h.Note
+	}
+	return highlightMap
+}
+
+// readingStateToMap converts a reading state to API response format
+func readingStateToMap(state *database.ReadingState) fiber.Map {
+	bookmarks := make([]fiber.Map, 0, len(state.Bookmarks))
+	for _, b := range state.Bookmarks {
+		bookmarks = append(bookmarks, bookmarkToMap(b))
+	}
+	highlights := make([]fiber.Map, 0, len(state.Highlights))
+	for _, h := range state.Highlights {
+		highlights = append(highlights, highlightToMap(h))
+	}
+	stateMap := fiber.Map{
+		"progress":   nil,
+		"bookmarks":  bookmarks,
+		"highlights": highlights,
+		"serverTime": state.ServerTime.Format(time.RFC3339Nano),
+	}
+	if state.Progress != nil {
+		stateMap["progress"] = readingProgressToMap(state.Progress)
+	}
+	return stateMap
+}
+
+// parseClientTime parses the time a client made a change. Empty means now.
+// Times more than clientClockSkew ahead of the server are clamped so a
+// device with a fast clock can't win every later conflict, while the order
+// of changes from a device that is only slightly ahead is kept.
+func parseClientTime(value string, now time.Time) (time.Time, bool) {
+	if value == "" {
+		return now, true
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if latest := now.Add(clientClockSkew); parsed.After(latest) {
+		return latest, true
+	}
+	return parsed, true
+}
+
+// ReadingProgressRequest is the last page a student read on a device
+type ReadingProgressRequest struct {
+	Page      int      `json:"page"`
+	PageCount *int     `json:"pageCount"`
+	Percent   *float64 `json:"percent"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+// progress validates the request and converts it for storage. The percent
+// is worked out from the page count when the client doesn't send it.
+func (r *ReadingProgressRequest) progress(courseID int, now time.Time) (database.ReadingProgress, string) {
+	p := database.ReadingProgress{CourseID: courseID, Page: r.Page, PageCount: r.PageCount}
+	if r.Page < 1 {
+		return p, "page must be at least 1"
+	}
+	if r.PageCount != nil && (*r.PageCount < 1 || r.Page > *r.PageCount) {
+		return p, "pageCount must be at least page"
+	}
+	switch {
+	case r.Percent != nil:
+		if math.IsNaN(*r.Percent) || *r.Percent < 0 || *r.Percent > 100 {
+			return p, "percent must be between 0 and 100"
+		}
+		p.Percent = *r.Percent
+	case r.PageCount != nil:
+		p.Percent = float64(r.Page) / float64(*r.PageCount) * 100
+	}
+	p.Percent = math.Round(p.Percent*100) / 100
+
+	updatedAt, ok := parseClientTime(r.UpdatedAt, now)
+	if !ok {
+		return p, "invalid updatedAt format, use RFC3339"
+	}
+	p.UpdatedAt = updatedAt
+	return p, ""
+}
+
+// BookmarkRequest is a bookmark made, changed or deleted on a device
+type BookmarkRequest struct {
+	ID        string  `json:"id"`
+	Page      int     `json:"page"`
+	Label     *string `json:"label"`
+	Deleted   bool    `json:"deleted"`
+	UpdatedAt string  `json:"updatedAt"`
+}
+
+// bookmark validates the request and converts it for storage
+func (r *BookmarkRequest) bookmark(courseID int, now time.Time) (database.Bookmark, string) {
+	b := database.Bookmark{CourseID: courseID, Page: r.Page, Deleted: r.Deleted}
+	id, err := uuid.Parse(r.ID)
+	if err != nil {
+		return b, "bookmark id must be a UUID"
+	}
+	b.ID = id.String()
+	if r.Page < 1 {
+		return b, "bookmark page must be at least 1"
+	}
+	if r.Label != nil {
+		b.Label = optionalText(*r.Label)
+		if b.Label != nil && utf8.RuneCountInString(*b.Label) > maxBookmarkLabelLen {
+			return b, fmt.Sprintf("bookmark label must be at most %d characters", maxBookmarkLabelLen)
+		}
+	}
+	updatedAt, ok := parseClientTime(r.UpdatedAt, now)
+	if !ok {
+		return b, "invalid bookmark updatedAt format, use RFC3339"
+	}
+	b.UpdatedAt = updatedAt
+	return b, ""
+}
+
+// HighlightRequest is a highlight made, changed or deleted on a device
+type HighlightRequest struct {
+	ID          string  `json:"id"`
+	Page        int     `json:"page"`
+	StartOffset int     `json:"startOffset"`
+	EndOffset   int     `json:"endOffset"`
+	Text        *string `json:"text"`
+	Note        *string `json:"note"`
+	Color       string  `json:"color"`
+	Deleted     bool    `json:"deleted"`
+	UpdatedAt   string  `json:"updatedAt"`
+}
+
+// highlight validates the request and converts it for storage
+func (r *HighlightRequest) highlight(courseID int, now time.Time) (database.Highlight, string) {
+	h := database.Highlight{
+		CourseID:    courseID,
+		Page:        r.Page,
+		StartOffset: r.StartOffset,
+		EndOffset:   r.EndOffset,
+		Color:       r.Color,
+		Deleted:     r.Deleted,
+	}
+	id, err := uuid.Parse(r.ID)
+	if err != nil {
+		return h, "highlight id must be a UUID"
+	}
+	h.ID = id.String()
+	if r.Page < 1 {
+		return h, "highlight page must be at least 1"
+	}
+	if r.StartOffset < 0 || r.EndOffset <= r.StartOffset {
+		return h, "highlight endOffset must be after startOffset"
+	}
+	if h.Color == "" {
+		h.Color = "yellow"
+	}
+	if !database.ValidHighlightColors[h.Color] {
+		return h, "invalid highlight color"
+	}
+	if r.Text != nil {
+		h.Text = optionalText(*r.Text)
+	}
+	if r.Note != nil {
+		h.Note = optionalText(*r.Note)
+	}
+	if (h.Text != nil && utf8.RuneCountInString(*h.Text) > maxHighlightTextLen) ||
+		(h.Note != nil && utf8.RuneCountInString(*h.Note) > maxHighlightTextLen) {
+		return h, fmt.Sprintf("highlight text and note must be at most %d characters", maxHighlightTextLen)
+	}
+	updatedAt, ok := parseClientTime(r.UpdatedAt, now)
+	if !ok {
+		return h, "invalid highlight updatedAt format, use RFC3339"
+	}
+	h.UpdatedAt = updatedAt
+	return h, ""
+}
+
+// ReadingSyncRequest is a batch of reading changes from a device. Since is
+// the serverTime of the device's previous sync; changes from other devices
+// after it are returned.
+type ReadingSyncRequest struct {
+	Progress   *ReadingProgressRequest `json:"progress"`
+	Bookmarks  []BookmarkRequest       `json:"bookmarks"`
+	Highlights []HighlightRequest      `json:"highlights"`
+	Since      string                  `json:"since"`
+}
+
+// parseReadingSince parses the since time of an incremental sync. Empty
+// means a full sync.
+func parseReadingSince(value string) (*time.Time, bool) {
+	if value == "" {
+		return nil, true
+	}
+	since, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, false
+	}
+	return &since, true
+}
+
+// readingCourseID checks the current user is enrolled in the course of the
+// request and returns its ID. With active, the enrollment must also still
+// give access, which writes need but reading back saved notes doesn't.
+// A zero ID means the error response was already sent.
+func readingCourseID(c *fiber.Ctx, logPrefix string, active bool) (int, int, error) {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return 0, 0, c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return 0, 0, c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return 0, 0, courseAccessErrorResponse(c, logPrefix, err)
+	}
+	if active {
+		if err := sc.AccessError(); err != nil {
+			return 0, 0, courseAccessErrorResponse(c, logPrefix, err)
+		}
+	}
+	return session.UserID, courseID, nil
+}
+
+// GetMyReadingState returns the current user's reading progress, bookmarks
+// and highlights in a course. With since (the serverTime of a previous
+// call), only later changes are returned, deletions included.
+func GetMyReadingState(c *fiber.Ctx) error {
+	userID, courseID, err := readingCourseID(c, "GetMyReadingState", false)
+	if courseID == 0 {
+		return err
+	}
+
+	since, ok := parseReadingSince(c.Query("since"))
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid since format, use RFC3339",
+		})
+	}
+
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	state, err := database.GetReadingState(ctx, userID, courseID, since)
+	if err != nil {
+		log.Printf("[GetMyReadingState] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch reading state",
+		})
+	}
+	return c.JSON(readingStateToMap(state))
+}
+
+// UpdateMyReadingProgress saves the current user's last page in a course.
+// A change made before the stored one loses; the stored progress is returned
+// either way with applied telling which happened.
+func UpdateMyReadingProgress(c *fiber.Ctx) error {
+	userID, courseID, err := readingCourseID(c, "UpdateMyReadingProgress", true)
+	if courseID == 0 {
+		return err
+	}
+
+	var req ReadingProgressRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	progress, msg := req.progress(courseID, clock.Now())
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	stored, applied, err := database.SaveReadingProgress(ctx, userID, progress)
+	if err != nil {
+		log.Printf("[UpdateMyReadingProgress] Save error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to save reading progress",
+		})
+	}
+	return c.JSON(fiber.Map{
+		"applied":  applied,
+		"progress": readingProgressToMap(stored),
+	})
+}
+
+// SyncMyReading saves a batch of reading changes from a device and returns
+// the reading state changed since the device's previous sync. Each change
+// is kept only if it was made after the stored one (last write wins).
+func SyncMyReading(c *fiber.Ctx) error {
+	userID, courseID, err := readingCourseID(c, "SyncMyReading", true)
+	if courseID == 0 {
+		return err
+	}
+
+	var req ReadingSyncRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.Bookmarks)+len(req.Highlights) > maxReadingSyncItems {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("at most %d bookmarks and highlights can be synced at once", maxReadingSyncItems),
+		})
+	}
+	since, ok := parseReadingSince(req.Since)
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid since format, use RFC3339",
+		})
+	}
+
+	now := clock.Now()
+	var progress *database.ReadingProgress
+	if req.Progress != nil {
+		p, msg := req.Progress.progress(courseID, now)
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": msg,
+			})
+		}
+		progress = &p
+	}
+	bookmarks := make([]database.Bookmark, 0, len(req.Bookmarks))
+	for i := range req.Bookmarks {
+		b, msg := req.Bookmarks[i].bookmark(courseID, now)
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": msg,
+				"index": i,
+			})
+		}
+		bookmarks = append(bookmarks, b)
+	}
+	highlights := make([]database.Highlight, 0, len(req.Highlights))
+	for i := range req.Highlights {
+		h, msg := req.Highlights[i].highlight(courseID, now)
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{
+				"error": msg,
+				"index": i,
+			})
+		}
+		highlights = append(highlights, h)
+	}
+
+	ctx, cancel := database.Timeout(15 * time.Second)
+	defer cancel()
+
+	result, err := database.SyncReading(ctx, userID, progress, bookmarks, highlights)
+	if err != nil {
+		log.Printf("[SyncMyReading] Sync error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to sync reading state",
+		})
+	}
+	state, err := database.GetReadingState(ctx, userID, courseID, since)
+	if err != nil {
+		log.Printf("[SyncMyReading] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch reading state",
+		})
+	}
+
+	response := readingStateToMap(state)
+	response["applied"] = result.Applied
+	response["stale"] = result.Stale
+	return c.JSON(response)
+}
+
+// formatReadingMarkdown renders a student's bookmarks and highlights of a
+// course as a Markdown document
+func formatReadingMarkdown(title string, state *database.ReadingState) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if state.Progress != nil {
+		p := state.Progress
+		if p.PageCount != nil {
+			fmt.Fprintf(&b, "Last read: page %d of %d (%.0f%%)\n\n", p.Page, *p.PageCount, p.Percent)
+		} else {
+			fmt.Fprintf(&b, "Last read: page %d (%.0f%%)\n\n", p.Page, p.Percent)
+		}
+	}
+
+	b.WriteString("## Bookmarks\n\n")
+	if len(state.Bookmarks) == 0 {
+		b.WriteString("No bookmarks.\n\n")
+	}
+	for _, bm := range state.Bookmarks {
+		if bm.Label != nil {
+			fmt.Fprintf(&b, "- Page %d: %s\n", bm.Page, *bm.Label)
+		} else {
+			fmt.Fprintf(&b, "- Page %d\n", bm.Page)
+		}
+	}
+	if len(state.Bookmarks) > 0 {
+		b.WriteString("\n")
+	}
+
+	b.WriteString("## Highlights and notes\n")
+	if len(state.Highlights) == 0 {
+		b.WriteString("\nNo highlights.\n")
+	}
+	page := 0
+	for _, h := range state.Highlights {
+		if h.Page != page {
+			page = h.Page
+			fmt.Fprintf(&b, "\n### Page %d\n", page)
+		}
+		b.WriteString("\n")
+		if h.Text != nil {
+			for _, line := range strings.Split(*h.Text, "\n") {
+				fmt.Fprintf(&b, "> %s\n", line)
+			}
+		} else {
+			fmt.Fprintf(&b, "> (characters %d-%d)\n", h.StartOffset, h.EndOffset)
+		}
+		if h.Note != nil {
+			fmt.Fprintf(&b, "\nNote: %s\n", *h.Note)
+		}
+	}
+	return b.String()
+}
+
+// ExportMyReading downloads the current user's reading progress, bookmarks
+// and highlights in a course as JSON (default) or Markdown (format=md). It
+// stays available after access to the course ends so notes aren't lost.
+func ExportMyReading(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	courseID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid course id format",
+		})
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "md" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "format must be json or md",
+		})
+	}
+
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	sc, err := database.GetStudentCourse(ctx, courseID, session.UserID)
+	if err != nil {
+		return courseAccessErrorResponse(c, "ExportMyReading", err)
+	}
+	state, err := database.GetReadingState(ctx, session.UserID, courseID, nil)
+	if err != nil {
+		log.Printf("[ExportMyReading] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch reading state",
+		})
+	}
+
+	title := studentCourseTitle(*sc)
+	name := unsafeFilenameChars.ReplaceAllString(title, "_") + "-notes." + format
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	if format == "md" {
+		c.Set("Content-Type", "text/markdown; charset=utf-8")
+		return c.SendString(formatReadingMarkdown(title, state))
+	}
+	export := readingStateToMap(state)
+	delete(export, "serverTime")
+	export["course"] = title
+	export["exportedAt"] = clock.Now().Format(time.RFC3339)
+	return c.JSON(export)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func TestParseClientTime(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		value  string
+		want   time.Time
+		wantOK bool
+	}{
+		{"empty is now", "", now, true},
+		{"past", "2026-03-10T11:59:00.5Z", time.Date(2026, 3, 10, 11, 59, 0, 500000000, time.UTC), true},
+		{"slightly ahead kept", "2026-03-10T12:00:10Z", now.Add(10 * time.Second), true},
+		{"future clamped", "2026-03-11T12:00:00Z", now.Add(clientClockSkew), true},
+		{"invalid", "yesterday", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseClientTime(tt.value, now)
+			if ok != tt.wantOK || !got.Equal(tt.want) {
+				t.Errorf("parseClientTime(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestReadingProgressRequest(t *testing.T) {
+	now := time.Now()
+	intPtr := func(v int) *int { return &v }
+	floatPtr := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name        string
+		req         ReadingProgressRequest
+		wantPercent float64
+		wantMsg     string
+	}{
+		{"percent from page count", ReadingProgressRequest{Page: 1, PageCount: intPtr(3)}, 33.33, ""},
+		{"percent given", ReadingProgressRequest{Page: 5, PageCount: intPtr(10), Percent: floatPtr(47.5)}, 47.5, ""},
+		{"page only", ReadingProgressRequest{Page: 5}, 0, ""},
+		{"page zero", ReadingProgressRequest{Page: 0}, 0, "page must be at least 1"},
+		{"page past end", ReadingProgressRequest{Page: 11, PageCount: intPtr(10)}, 0, "pageCount must be at least page"},
+		{"percent over 100", ReadingProgressRequest{Page: 1, Percent: floatPtr(101)}, 0, "percent must be between 0 and 100"},
+		{"bad time", ReadingProgressRequest{Page: 1, UpdatedAt: "now"}, 0, "invalid updatedAt format, use RFC3339"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, msg := tt.req.progress(7, now)
+			if msg != tt.wantMsg {
+				t.Fatalf("progress() message = %q, want %q", msg, tt.wantMsg)
+			}
+			if msg == "" && (p.Percent != tt.wantPercent || p.CourseID != 7) {
+				t.Errorf("progress() = %+v, want percent %v for course 7", p, tt.wantPercent)
+			}
+		})
+	}
+}
+
+func TestHighlightRequest(t *testing.T) {
+	now := time.Now()
+	id := "6f1c2a4e-93b5-4d1e-8a2f-0c7d5e9b1a34"
+	text := "  Force equals mass times acceleration  "
+
+	tests := []struct {
+		name    string
+		req     HighlightRequest
+		wantMsg string
+	}{
+		{"valid", HighlightRequest{ID: id, Page: 2, StartOffset: 10, EndOffset: 20, Text: &text}, ""},
+		{"bad id", HighlightRequest{ID: "42", Page: 2, StartOffset: 10, EndOffset: 20}, "highlight id must be a UUID"},
+		{"empty range", HighlightRequest{ID: id, Page: 2, StartOffset: 10, EndOffset: 10}, "highlight endOffset must be after startOffset"},
+		{"bad color", HighlightRequest{ID: id, Page: 2, StartOffset: 0, EndOffset: 1, Color: "purple"}, "invalid highlight color"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, msg := tt.req.highlight(7, now)
+			if msg != tt.wantMsg {
+				t.Fatalf("highlight() message = %q, want %q", msg, tt.wantMsg)
+			}
+			if msg == "" && (h.Color != "yellow" || *h.Text != "Force equals mass times acceleration") {
+				t.Errorf("highlight() = %+v, want default color and trimmed text", h)
+			}
+		})
+	}
+}
+
+func TestFormatReadingMarkdown(t *testing.T) {
+	label := "Newton's laws"
+	text := "F = ma\nfor constant mass"
+	note := "Revise before the exam"
+	pageCount := 120
+	state := &database.ReadingState{
+		Progress: &database.ReadingProgress{Page: 30, PageCount: &pageCount, Percent: 25},
+		Bookmarks: []database.Bookmark{
+			{Page: 12, Label: &label},
+			{Page: 40},
+		},
+		Highlights: []database.Highlight{
+			{Page: 12, StartOffset: 0, EndOffset: 6, Text: &text, Note: &note},
+			{Page: 12, StartOffset: 50, EndOffset: 60},
+		},
+	}
+
+	got := formatReadingMarkdown("Physics", state)
+	for _, want := range []string{
+		"# Physics\n",
+		"Last read: page 30 of 120 (25%)",
+		"- Page 12: Newton's laws\n",
+		"- Page 40\n",
+		"### Page 12\n",
+		"> F = ma\n> for constant mass\n",
+		"Note: Revise before the exam\n",
+		"> (characters 50-60)\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("formatReadingMarkdown() missing %q in:\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "### Page 12") != 1 {
+		t.Errorf("formatReadingMarkdown() should group highlights of a page under one heading:\n%s", got)
+	}
+
+	empty := formatReadingMarkdown("Physics", &database.ReadingState{})
+	if !strings.Contains(empty, "No bookmarks.") || !strings.Contains(empty, "No highlights.") {
+		t.Errorf("formatReadingMarkdown() of an empty state = %q", empty)
+	}
+}
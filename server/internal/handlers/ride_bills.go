@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"strconv"
 	"strings"
@@ -10,6 +11,8 @@ import (
 	"github.com/jackc/pgx/v5"
 
 	"github.com/server/internal/database"
+	"github.com/server/internal/dispatch"
+	"github.com/server/internal/middleware"
 )
 
 // GetRideBills returns all ride bills with optional filters
@@ -49,7 +52,9 @@ func GetRideBills(c *fiber.Ctx) error {
 			rb.id, rb.ride_id, rb.user_id, rb.from_location, rb.to_location,
 			rb.fare, rb.status, rb.driver, rb.distance, rb.created_at, rb.updated_at,
 			rl.id as rl_id, rl.from_location as rl_from, rl.to_location as rl_to, rl.fare as rl_fare,
-			u.id as u_id, u.username, u.email, u.name
+			u.id as u_id, u.username, u.email, u.name,
+			COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END) FROM payments p WHERE p.ride_bill_id = rb.id), 0) as amount_paid,
+			rb.accessibility_needs, rb.driver_id, rb.vehicle_id, rb.dispatch_status
 		FROM ride_bills rb
 		LEFT JOIN ride_locations rl ON rb.ride_id = rl.id
 		LEFT JOIN users u ON rb.user_id = u.id
@@ -98,32 +103,38 @@ func GetRideBills(c *fiber.Ctx) error {
 	var bills []fiber.Map
 	for rows.Next() {
 		var (
-			ID        int
-			RideID    int
-			UserID    int
-			FromLoc   string
-			ToLoc     string
-			Fare      float64
-			Status    string
-			Driver    *string
-			Distance  *float64
-			CreatedAt time.Time
-			UpdatedAt time.Time
-			RLID      *int
-			RLFrom    *string
-			RLTo      *string
-			RLFare    *float64
-			UID       *int
-			Username  *string
-			Email     *string
-			Name      *string
+			ID                 int
+			RideID             int
+			UserID             int
+			FromLoc            string
+			ToLoc              string
+			Fare               float64
+			Status             string
+			Driver             *string
+			Distance           *float64
+			CreatedAt          time.Time
+			UpdatedAt          time.Time
+			RLID               *int
+			RLFrom             *string
+			RLTo               *string
+			RLFare             *float64
+			UID                *int
+			Username           *string
+			Email              *string
+			Name               *string
+			AmountPaid         float64
+			AccessibilityNeeds []string
+			DriverID           *int
+			VehicleID          *int
+			DispatchStatus     string
 		)
 
 		err := rows.Scan(
 			&ID, &RideID, &UserID, &FromLoc, &ToLoc, &Fare, &Status, &Driver, &Distance,
 			&CreatedAt, &UpdatedAt,
 			&RLID, &RLFrom, &RLTo, &RLFare,
-			&UID, &Username, &Email, &Name,
+			&UID, &Username, &Email, &Name, &AmountPaid,
+			&AccessibilityNeeds, &DriverID, &VehicleID, &DispatchStatus,
 		)
 		if err != nil {
 			log.Printf("[GetRideBills] Scan error: %v", err)
@@ -136,6 +147,8 @@ func GetRideBills(c *fiber.Ctx) error {
 			"toLocation":   ToLoc,
 			"fare":         Fare,
 			"status":       Status,
+			"amountPaid":   AmountPaid,
+			"balance":      database.RoundCents(Fare - AmountPaid),
 			"createdAt":    CreatedAt.Format(time.RFC3339),
 			"updatedAt":    UpdatedAt.Format(time.RFC3339),
 		}
@@ -177,6 +190,14 @@ func GetRideBills(c *fiber.Ctx) error {
 		if Distance != nil {
 			billMap["distance"] = *Distance
 		}
+		billMap["accessibilityNeeds"] = AccessibilityNeeds
+		billMap["dispatchStatus"] = DispatchStatus
+		if DriverID != nil {
+			billMap["driverId"] = strconv.Itoa(*DriverID)
+		}
+		if VehicleID != nil {
+			billMap["vehicleId"] = strconv.Itoa(*VehicleID)
+		}
 
 		bills = append(bills, billMap)
 	}
@@ -212,7 +233,10 @@ func GetMyRideBills(c *fiber.Ctx) error {
 		SELECT 
 			rb.id, rb.ride_id, rb.user_id, rb.from_location, rb.to_location,
 			rb.fare, rb.status, rb.driver, rb.distance, rb.created_at, rb.updated_at,
-			rl.id as rl_id, rl.from_location as rl_from, rl.to_location as rl_to, rl.fare as rl_fare
+			rl.id as rl_id, rl.from_location as rl_from, rl.to_location as rl_to, rl.fare as rl_fare,
+			COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END) FROM payments p WHERE p.ride_bill_id = rb.id), 0) as amount_paid,
+			rb.series_id, rb.scheduled_for, rb.accessibility_needs, rb.dispatch_status,
+			EXISTS (SELECT 1 FROM ride_ratings r WHERE r.ride_bill_id = rb.id) as rated
 		FROM ride_bills rb
 		LEFT JOIN ride_locations rl ON rb.ride_id = rl.id
 		WHERE rb.user_id = $1
@@ -240,27 +264,34 @@ func GetMyRideBills(c *fiber.Ctx) error {
 	var bills []fiber.Map
 	for rows.Next() {
 		var (
-			ID        int
-			RideID    int
-			UserID    int
-			FromLoc   string
-			ToLoc     string
-			Fare      float64
-			Status    string
-			Driver    *string
-			Distance  *float64
-			CreatedAt time.Time
-			UpdatedAt time.Time
-			RLID      *int
-			RLFrom    *string
-			RLTo      *string
-			RLFare    *float64
+			ID                 int
+			RideID             int
+			UserID             int
+			FromLoc            string
+			ToLoc              string
+			Fare               float64
+			Status             string
+			Driver             *string
+			Distance           *float64
+			CreatedAt          time.Time
+			UpdatedAt          time.Time
+			RLID               *int
+			RLFrom             *string
+			RLTo               *string
+			RLFare             *float64
+			AmountPaid         float64
+			SeriesID           *int
+			ScheduledFor       *time.Time
+			AccessibilityNeeds []string
+			DispatchStatus     string
+			Rated              bool
 		)
 
 		err := rows.Scan(
 			&ID, &RideID, &UserID, &FromLoc, &ToLoc, &Fare, &Status, &Driver, &Distance,
 			&CreatedAt, &UpdatedAt,
-			&RLID, &RLFrom, &RLTo, &RLFare,
+			&RLID, &RLFrom, &RLTo, &RLFare, &AmountPaid,
+			&SeriesID, &ScheduledFor, &AccessibilityNeeds, &DispatchStatus, &Rated,
 		)
 		if err != nil {
 			log.Printf("[GetMyRideBills] Scan error: %v", err)
@@ -273,6 +304,8 @@ func GetMyRideBills(c *fiber.Ctx) error {
 			"toLocation":   ToLoc,
 			"fare":         Fare,
 			"status":       Status,
+			"amountPaid":   AmountPaid,
+			"balance":      database.RoundCents(Fare - AmountPaid),
 			"createdAt":    CreatedAt.Format(time.RFC3339),
 			"updatedAt":    UpdatedAt.Format(time.RFC3339),
 		}
@@ -294,6 +327,15 @@ func GetMyRideBills(c *fiber.Ctx) error {
 		if Distance != nil {
 			billMap["distance"] = *Distance
 		}
+		if SeriesID != nil {
+			billMap["seriesId"] = strconv.Itoa(*SeriesID)
+		}
+		if ScheduledFor != nil {
+			billMap["scheduledFor"] = ScheduledFor.Format(time.RFC3339)
+		}
+		billMap["accessibilityNeeds"] = AccessibilityNeeds
+		billMap["dispatchStatus"] = DispatchStatus
+		billMap["rated"] = Rated
 
 		bills = append(bills, billMap)
 	}
@@ -321,6 +363,8 @@ func CreateRideBill(c *fiber.Ctx) error {
 		Fare         float64  `json:"fare"`
 		Driver       *string  `json:"driver"`
 		Distance     *float64 `json:"distance"`
+		// Defaults to the user's accessibility profile when omitted
+		AccessibilityNeeds []string `json:"accessibilityNeeds"`
 	}
 
 	if err := c.BodyParser(&req); err != nil {
@@ -335,6 +379,23 @@ func CreateRideBill(c *fiber.Ctx) error {
 		})
 	}
 
+	needs, err := database.NormalizeAccessibilityTags(req.AccessibilityNeeds)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if req.AccessibilityNeeds == nil {
+		profile, err := database.GetAccessibilityProfile(ctx, userID.(int))
+		if err != nil {
+			log.Printf("[CreateRideBill] Accessibility profile error: %v", err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to create ride bill",
+			})
+		}
+		needs = profile.Needs
+	}
+
 	// If rideId is provided, fetch fare from ride_locations
 	if req.RideID > 0 && req.Fare == 0 {
 		var rideFare float64
@@ -345,17 +406,18 @@ func CreateRideBill(c *fiber.Ctx) error {
 		}
 	}
 
-	// Insert ride bill
+	// Insert ride bill. A free ride has nothing due, so it starts out paid.
+	status := database.DeriveBillStatus("pending", req.Fare, 0, 0)
 	query := `
-		INSERT INTO ride_bills (ride_id, user_id, from_location, to_location, fare, status, driver, distance, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, 'pending', $6, $7, NOW(), NOW())
+		INSERT INTO ride_bills (ride_id, user_id, from_location, to_location, fare, status, driver, distance, accessibility_needs, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW(), NOW())
 		RETURNING id, created_at, updated_at
 	`
 
 	var id int
 	var createdAt, updatedAt time.Time
-	err := database.GetPool().QueryRow(ctx, query,
-		req.RideID, userID, req.FromLocation, req.ToLocation, req.Fare, req.Driver, req.Distance,
+	err = database.GetPool().QueryRow(ctx, query,
+		req.RideID, userID, req.FromLocation, req.ToLocation, req.Fare, status, req.Driver, req.Distance, needs,
 	).Scan(&id, &createdAt, &updatedAt)
 
 	if err != nil {
@@ -365,18 +427,26 @@ func CreateRideBill(c *fiber.Ctx) error {
 		})
 	}
 
+	invalidateAnalytics("CreateRideBill")
+	dispatchStatus := "unassigned"
+	if dispatch.DispatchIfDue(ctx, id, createdAt) != nil {
+		dispatchStatus = "offered"
+	}
+
 	return c.Status(201).JSON(fiber.Map{
-		"_id":          strconv.Itoa(id),
-		"rideId":       req.RideID,
-		"userId":       userID,
-		"fromLocation": req.FromLocation,
-		"toLocation":   req.ToLocation,
-		"fare":         req.Fare,
-		"status":       "pending",
-		"driver":       req.Driver,
-		"distance":     req.Distance,
-		"createdAt":    createdAt.Format(time.RFC3339),
-		"updatedAt":    updatedAt.Format(time.RFC3339),
+		"_id":                strconv.Itoa(id),
+		"rideId":             req.RideID,
+		"userId":             userID,
+		"fromLocation":       req.FromLocation,
+		"toLocation":         req.ToLocation,
+		"fare":               req.Fare,
+		"status":             status,
+		"dispatchStatus":     dispatchStatus,
+		"driver":             req.Driver,
+		"distance":           req.Distance,
+		"accessibilityNeeds": needs,
+		"createdAt":          createdAt.Format(time.RFC3339),
+		"updatedAt":          updatedAt.Format(time.RFC3339),
 	})
 }
 
@@ -406,26 +476,43 @@ func GetRideBillStatistics(c *fiber.Ctx) error {
 		})
 	}
 
+	// Revenue is taken from the payment ledger (payments minus refunds)
 	query := `
 		SELECT 
 			COUNT(*) as total_bills,
-			COALESCE(SUM(CASE WHEN status = 'paid' THEN fare ELSE 0 END), 0) as total_revenue,
+			(SELECT COALESCE(SUM(CASE WHEN kind = 'refund' THEN -amount ELSE amount END), 0) FROM payments) as total_revenue,
 			COUNT(*) FILTER (WHERE status = 'pending') as pending_bills,
+			COUNT(*) FILTER (WHERE status = 'awaiting_payment') as awaiting_payment_bills,
+			COUNT(*) FILTER (WHERE status = 'partially_paid') as partially_paid_bills,
 			COUNT(*) FILTER (WHERE status = 'paid') as paid_bills,
-			COUNT(*) FILTER (WHERE status = 'cancelled') as cancelled_bills
+			COUNT(*) FILTER (WHERE status = 'refunded') as refunded_bills,
+			COUNT(*) FILTER (WHERE status = 'cancelled') as cancelled_bills,
+			(SELECT COALESCE(SUM(rb.fare - COALESCE(p.net_paid, 0)), 0)
+			 FROM ride_bills rb
+			 LEFT JOIN (
+			     SELECT ride_bill_id, SUM(CASE WHEN kind = 'refund' THEN -amount ELSE amount END) as net_paid
+			     FROM payments
+			     GROUP BY ride_bill_id
+			 ) p ON p.ride_bill_id = rb.id
+			 WHERE rb.status <> 'cancelled') as outstanding_balance
 		FROM ride_bills
 	`
 
 	var (
-		TotalBills     int
-		TotalRevenue   float64
-		PendingBills   int
-		PaidBills      int
-		CancelledBills int
+		TotalBills         int
+		TotalRevenue       float64
+		PendingBills       int
+		AwaitingBills      int
+		PartiallyPaidBills int
+		PaidBills          int
+		RefundedBills      int
+		CancelledBills     int
+		OutstandingBalance float64
 	)
 
 	err = database.GetPool().QueryRow(ctx, query).Scan(
-		&TotalBills, &TotalRevenue, &PendingBills, &PaidBills, &CancelledBills,
+		&TotalBills, &TotalRevenue, &PendingBills, &AwaitingBills, &PartiallyPaidBills, &PaidBills,
+		&RefundedBills, &CancelledBills, &OutstandingBalance,
 	)
 
 	if err != nil {
@@ -437,11 +524,15 @@ func GetRideBillStatistics(c *fiber.Ctx) error {
 	}
 
 	stats := fiber.Map{
-		"totalBills":     TotalBills,
-		"totalRevenue":   TotalRevenue,
-		"pendingBills":   PendingBills,
-		"paidBills":      PaidBills,
-		"cancelledBills": CancelledBills,
+		"totalBills":           TotalBills,
+		"totalRevenue":         TotalRevenue,
+		"pendingBills":         PendingBills,
+		"awaitingPaymentBills": AwaitingBills,
+		"partiallyPaidBills":   PartiallyPaidBills,
+		"paidBills":            PaidBills,
+		"refundedBills":        RefundedBills,
+		"cancelledBills":       CancelledBills,
+		"outstandingBalance":   OutstandingBalance,
 	}
 
 	return c.JSON(stats)
@@ -464,7 +555,9 @@ func GetRideBillByID(c *fiber.Ctx) error {
 			rb.id, rb.ride_id, rb.user_id, rb.from_location, rb.to_location,
 			rb.fare, rb.status, rb.driver, rb.distance, rb.created_at, rb.updated_at,
 			rl.id as rl_id, rl.from_location as rl_from, rl.to_location as rl_to, rl.fare as rl_fare,
-			u.id as u_id, u.username, u.email, u.name
+			u.id as u_id, u.username, u.email, u.name,
+			COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END) FROM payments p WHERE p.ride_bill_id = rb.id), 0) as amount_paid,
+			rb.accessibility_needs, rb.driver_id, rb.vehicle_id, rb.dispatch_status
 		FROM ride_bills rb
 		LEFT JOIN ride_locations rl ON rb.ride_id = rl.id
 		LEFT JOIN users u ON rb.user_id = u.id
@@ -473,32 +566,38 @@ func GetRideBillByID(c *fiber.Ctx) error {
 	`
 
 	var (
-		ID        int
-		RideID    int
-		UserID    int
-		FromLoc   string
-		ToLoc     string
-		Fare      float64
-		Status    string
-		Driver    *string
-		Distance  *float64
-		CreatedAt time.Time
-		UpdatedAt time.Time
-		RLID      *int
-		RLFrom    *string
-		RLTo      *string
-		RLFare    *float64
-		UID       *int
-		Username  *string
-		Email     *string
-		Name      *string
+		ID                 int
+		RideID             int
+		UserID             int
+		FromLoc            string
+		ToLoc              string
+		Fare               float64
+		Status             string
+		Driver             *string
+		Distance           *float64
+		CreatedAt          time.Time
+		UpdatedAt          time.Time
+		RLID               *int
+		RLFrom             *string
+		RLTo               *string
+		RLFare             *float64
+		UID                *int
+		Username           *string
+		Email              *string
+		Name               *string
+		AmountPaid         float64
+		AccessibilityNeeds []string
+		DriverID           *int
+		VehicleID          *int
+		DispatchStatus     string
 	)
 
 	err := database.GetPool().QueryRow(ctx, query, id).Scan(
 		&ID, &RideID, &UserID, &FromLoc, &ToLoc, &Fare, &Status, &Driver, &Distance,
 		&CreatedAt, &UpdatedAt,
 		&RLID, &RLFrom, &RLTo, &RLFare,
-		&UID, &Username, &Email, &Name,
+		&UID, &Username, &Email, &Name, &AmountPaid,
+		&AccessibilityNeeds, &DriverID, &VehicleID, &DispatchStatus,
 	)
 
 	if err != nil {
@@ -519,6 +618,8 @@ func GetRideBillByID(c *fiber.Ctx) error {
 		"toLocation":   ToLoc,
 		"fare":         Fare,
 		"status":       Status,
+		"amountPaid":   AmountPaid,
+		"balance":      database.RoundCents(Fare - AmountPaid),
 		"createdAt":    CreatedAt.Format(time.RFC3339),
 		"updatedAt":    UpdatedAt.Format(time.RFC3339),
 	}
@@ -558,18 +659,31 @@ func GetRideBillByID(c *fiber.Ctx) error {
 	if Distance != nil {
 		billMap["distance"] = *Distance
 	}
+	billMap["accessibilityNeeds"] = AccessibilityNeeds
+	billMap["dispatchStatus"] = DispatchStatus
+	if DriverID != nil {
+		billMap["driverId"] = strconv.Itoa(*DriverID)
+	}
+	if VehicleID != nil {
+		billMap["vehicleId"] = strconv.Itoa(*VehicleID)
+	}
 
 	return c.JSON(billMap)
 }
 
 // UpdateRideBillRequest represents a ride bill update request
 type UpdateRideBillRequest struct {
-	Status   *string  `json:"status,omitempty"`
-	Driver   *string  `json:"driver,omitempty"`
-	Distance *float64 `json:"distance,omitempty"`
+	Status        *string  `json:"status,omitempty"`
+	PaymentMethod *string  `json:"paymentMethod,omitempty"` // Used when settling a bill via status "paid"
+	Driver        *string  `json:"driver,omitempty"`        // Deprecated: ignored, drivers are assigned by dispatch or driverId
+	DriverID      *int     `json:"driverId,omitempty"`      // Overrides dispatch; checked against the ride's accessibility needs
+	Distance      *float64 `json:"distance,omitempty"`
 }
 
-// UpdateRideBill updates an existing ride bill
+// UpdateRideBill updates an existing ride bill.
+// Payment statuses are driven by the payment ledger: setting status to "paid"
+// records a ledger payment for the outstanding balance, "cancelled" cancels the
+// bill and "pending" reopens a cancelled bill with no net payments.
 func UpdateRideBill(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
 	defer cancel()
@@ -581,6 +695,13 @@ func UpdateRideBill(c *fiber.Ctx) error {
 		})
 	}
 
+	billID, err := strconv.Atoi(id)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride bill id format",
+		})
+	}
+
 	var req UpdateRideBillRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(400).JSON(fiber.Map{
@@ -588,96 +709,109 @@ func UpdateRideBill(c *fiber.Ctx) error {
 		})
 	}
 
-	// Build UPDATE query dynamically
-	var updates []string
-	var args []interface{}
-	argIndex := 1
-
 	if req.Status != nil {
-		validStatuses := map[string]bool{
-			"pending":   true,
-			"paid":      true,
-			"cancelled": true,
-		}
-		if !validStatuses[*req.Status] {
+		switch *req.Status {
+		case "pending", "paid", "cancelled":
+		case "awaiting_payment", "partially_paid", "refunded":
+			return c.Status(400).JSON(fiber.Map{
+				"error": "status " + *req.Status + " is derived from the payment ledger. Record a payment or refund instead",
+			})
+		default:
 			return c.Status(400).JSON(fiber.Map{
 				"error": "invalid status. Must be one of: pending, paid, cancelled",
 			})
 		}
-		updates = append(updates, "status = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Status)
-		argIndex++
 	}
 
-	if req.Driver != nil {
-		updates = append(updates, "driver = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Driver)
-		argIndex++
-	}
-
-	if req.Distance != nil {
-		if *req.Distance < 0 {
+	paymentMethod := "other"
+	if req.PaymentMethod != nil {
+		paymentMethod = strings.ToLower(strings.TrimSpace(*req.PaymentMethod))
+		if !database.ValidPaymentMethods[paymentMethod] {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "distance must be non-negative",
+				"error": "invalid paymentMethod. Must be one of: cash, upi, card, bank_transfer, other",
 			})
 		}
-		updates = append(updates, "distance = $"+strconv.Itoa(argIndex))
-		args = append(args, *req.Distance)
-		argIndex++
 	}
 
-	if len(updates) == 0 {
+	if req.Driver != nil {
+		// Older clients still send the driver's name. Ignore it until they
+		// have moved to driverId.
+		log.Printf("[UpdateRideBill] Warning: ignoring deprecated driver field for ride bill %d", billID)
+		c.Set(fiber.HeaderWarning, `299 - "driver is deprecated and ignored. Use driverId to assign a driver"`)
+	}
+
+	if req.Distance != nil && *req.Distance < 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "distance must be non-negative",
+		})
+	}
+
+	if req.Distance == nil && req.Status == nil && req.DriverID == nil && req.Driver == nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "no fields to update",
 		})
 	}
 
-	// Check if bill exists
-	var existingID int
-	checkQuery := `SELECT id FROM ride_bills WHERE id = $1 LIMIT 1`
-	err := database.GetPool().QueryRow(ctx, checkQuery, id).Scan(&existingID)
-	if err != nil {
-		if err == pgx.ErrNoRows {
-			return c.Status(404).JSON(fiber.Map{
-				"error": "ride bill not found",
-			})
-		}
-		log.Printf("[UpdateRideBill] Check query error: %v", err)
-		return c.Status(500).JSON(fiber.Map{
-			"error": "failed to check bill",
+	update := database.RideBillUpdate{
+		DriverID:      req.DriverID,
+		Distance:      req.Distance,
+		Status:        req.Status,
+		PaymentMethod: paymentMethod,
+	}
+	if session := middleware.GetSession(c); session != nil {
+		update.RecordedBy = &session.UserID
+	}
+
+	var mismatch *database.AccessibilityMismatchError
+	err = database.UpdateRideBill(ctx, billID, update)
+	switch {
+	case err == nil:
+	case errors.As(err, &mismatch), err == database.ErrDriverNotFound:
+		return assignDriverErrorResponse(c, "UpdateRideBill", err)
+	case err == database.ErrBillHasPayments:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ride bill has recorded payments. Issue a refund to reopen it",
 		})
+	default:
+		return paymentErrorResponse(c, "UpdateRideBill", err)
 	}
 
-	// Update the bill
-	updateQuery := `
-		UPDATE ride_bills
-		SET ` + strings.Join(updates, ", ") + `
-		WHERE id = $` + strconv.Itoa(argIndex) + `
-		RETURNING id, ride_id, user_id, from_location, to_location, fare, status, driver, distance, created_at, updated_at
+	invalidateAnalytics("UpdateRideBill")
+
+	selectQuery := `
+		SELECT id, ride_id, user_id, from_location, to_location, fare, status, driver, distance, created_at, updated_at,
+		       COALESCE((SELECT SUM(CASE WHEN p.kind = 'refund' THEN -p.amount ELSE p.amount END) FROM payments p WHERE p.ride_bill_id = ride_bills.id), 0) as amount_paid,
+		       accessibility_needs, driver_id, vehicle_id, dispatch_status
+		FROM ride_bills
+		WHERE id = $1
 	`
-	args = append(args, id)
 
 	var (
-		ID        int
-		RideID    int
-		UserID    int
-		FromLoc   string
-		ToLoc     string
-		Fare      float64
-		Status    string
-		Driver    *string
-		Distance  *float64
-		CreatedAt time.Time
-		UpdatedAt time.Time
+		ID                 int
+		RideID             int
+		UserID             int
+		FromLoc            string
+		ToLoc              string
+		Fare               float64
+		Status             string
+		Driver             *string
+		Distance           *float64
+		CreatedAt          time.Time
+		UpdatedAt          time.Time
+		AmountPaid         float64
+		AccessibilityNeeds []string
+		DriverID           *int
+		VehicleID          *int
+		DispatchStatus     string
 	)
 
-	err = database.GetPool().QueryRow(ctx, updateQuery, args...).Scan(
+	err = database.GetPool().QueryRow(ctx, selectQuery, billID).Scan(
 		&ID, &RideID, &UserID, &FromLoc, &ToLoc, &Fare, &Status, &Driver, &Distance,
-		&CreatedAt, &UpdatedAt,
+		&CreatedAt, &UpdatedAt, &AmountPaid, &AccessibilityNeeds, &DriverID, &VehicleID, &DispatchStatus,
 	)
 
 	if err != nil {
-		log.Printf("[UpdateRideBill] Update error: %v", err)
+		log.Printf("[UpdateRideBill] Fetch error: %v", err)
 		return c.Status(500).JSON(fiber.Map{
 			"error": "failed to update ride bill",
 		})
@@ -691,6 +825,8 @@ func UpdateRideBill(c *fiber.Ctx) error {
 		"toLocation":   ToLoc,
 		"fare":         Fare,
 		"status":       Status,
+		"amountPaid":   AmountPaid,
+		"balance":      database.RoundCents(Fare - AmountPaid),
 		"createdAt":    CreatedAt.Format(time.RFC3339),
 		"updatedAt":    UpdatedAt.Format(time.RFC3339),
 	}
@@ -701,6 +837,14 @@ func UpdateRideBill(c *fiber.Ctx) error {
 	if Distance != nil {
 		billMap["distance"] = *Distance
 	}
+	billMap["accessibilityNeeds"] = AccessibilityNeeds
+	billMap["dispatchStatus"] = DispatchStatus
+	if DriverID != nil {
+		billMap["driverId"] = strconv.Itoa(*DriverID)
+	}
+	if VehicleID != nil {
+		billMap["vehicleId"] = strconv.Itoa(*VehicleID)
+	}
 
 	return c.JSON(billMap)
 }
@@ -743,5 +887,6 @@ func DeleteRideBill(c *fiber.Ctx) error {
 		})
 	}
 
+	invalidateAnalytics("DeleteRideBill")
 	return c.Status(204).Send(nil)
 }
@@ -0,0 +1,554 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/bookings"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// rideSeriesToMap converts a ride series to the API response format
+func rideSeriesToMap(s database.RideSeries) fiber.Map {
+	seriesMap := fiber.Map{
+		"_id":          strconv.Itoa(s.ID),
+		"userId":       strconv.Itoa(s.UserID),
+		"rideId":       strconv.Itoa(s.RideID),
+		"fromLocation": s.FromLocation,
+		"toLocation":   s.ToLocation,
+		"fare":         s.Fare,
+		"daysOfWeek":   s.DaysOfWeek,
+		"rideTime":     s.RideTime,
+		"startDate":    bookings.DateKey(s.StartDate),
+		"skipHolidays": s.SkipHolidays,
+		"status":       s.Status,
+		"createdAt":    s.CreatedAt.Format(time.RFC3339),
+		"updatedAt":    s.UpdatedAt.Format(time.RFC3339),
+	}
+	if s.EndDate != nil {
+		seriesMap["endDate"] = bookings.DateKey(*s.EndDate)
+	}
+	if s.MaterializedThrough != nil {
+		seriesMap["bookedThrough"] = bookings.DateKey(*s.MaterializedThrough)
+	}
+	return seriesMap
+}
+
+// rideSeriesErrorResponse maps ride series errors to HTTP responses
+func rideSeriesErrorResponse(c *fiber.Ctx, logPrefix string, err error) error {
+	switch err {
+	case database.ErrSeriesNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": "ride series not found",
+		})
+	case database.ErrSeriesCancelled:
+		return c.Status(409).JSON(fiber.Map{
+			"error": "ride series is cancelled",
+		})
+	}
+	log.Printf("[%s] Ride series error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to update ride series",
+	})
+}
+
+// loadOwnedRideSeries loads the :id series, which must belong to the current
+// user unless they are an admin. Writes the error response if it can't be used.
+func loadOwnedRideSeries(ctx context.Context, c *fiber.Ctx, logPrefix string) (*database.RideSeries, error) {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return nil, c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{
+			"error": "invalid ride series id format",
+		})
+	}
+
+	series, err := database.GetRideSeries(ctx, id)
+	if err != nil {
+		return nil, rideSeriesErrorResponse(c, logPrefix, err)
+	}
+
+	role := strings.ToLower(session.Role)
+	if series.UserID != session.UserID && role != "admin" && role != "superadmin" {
+		// Don't reveal other users' series
+		return nil, rideSeriesErrorResponse(c, logPrefix, database.ErrSeriesNotFound)
+	}
+
+	return series, nil
+}
+
+// materializeRideSeries books a series' upcoming rides right away so they show
+// up without waiting for the scheduler
+func materializeRideSeries(ctx context.Context, s *database.RideSeries, logPrefix string) {
+	created, err := bookings.Materialize(ctx, *s)
+	if err != nil {
+		log.Printf("[%s] Failed to book rides for series %d: %v", logPrefix, s.ID, err)
+		return
+	}
+	if created > 0 {
+		invalidateAnalytics(logPrefix)
+	}
+}
+
+// RideSeriesRequest represents a request to create or edit a ride series.
+// All fields are optional when editing.
+type RideSeriesRequest struct {
+	RideID       *int    `json:"rideId"`
+	DaysOfWeek   []int32 `json:"daysOfWeek"` // 0 = Sunday ... 6 = Saturday
+	RideTime     *string `json:"rideTime"`   // HH:MM
+	StartDate    *string `json:"startDate"`  // YYYY-MM-DD, defaults to today
+	EndDate      *string `json:"endDate"`    // YYYY-MM-DD, empty string for no end date
+	SkipHolidays *bool   `json:"skipHolidays"`
+}
+
+// apply validates the request and applies it to a series
+func (req RideSeriesRequest) apply(ctx context.Context, s *database.RideSeries) (string, error) {
+	if req.RideID != nil {
+		var exists bool
+		err := database.GetPool().QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM ride_locations WHERE id = $1)`, *req.RideID,
+		).Scan(&exists)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return "ride location not found", nil
+		}
+		s.RideID = *req.RideID
+	}
+	if req.DaysOfWeek != nil {
+		days, err := bookings.NormalizeDays(req.DaysOfWeek)
+		if err != nil {
+			return err.Error(), nil
+		}
+		s.DaysOfWeek = days
+	}
+	if req.RideTime != nil {
+		if _, _, err := bookings.ParseRideTime(*req.RideTime); err != nil {
+			return err.Error(), nil
+		}
+		s.RideTime = *req.RideTime
+	}
+	if req.StartDate != nil {
+		start, err := bookings.ParseDate(*req.StartDate)
+		if err != nil {
+			return err.Error(), nil
+		}
+		s.StartDate = start
+	}
+	if req.EndDate != nil {
+		if *req.EndDate == "" {
+			s.EndDate = nil
+		} else {
+			end, err := bookings.ParseDate(*req.EndDate)
+			if err != nil {
+				return err.Error(), nil
+			}
+			s.EndDate = &end
+		}
+	}
+	if req.SkipHolidays != nil {
+		s.SkipHolidays = *req.SkipHolidays
+	}
+	if s.EndDate != nil && s.EndDate.Before(s.StartDate) {
+		return "endDate must not be before startDate", nil
+	}
+	return "", nil
+}
+
+// GetMyRideSeries returns the current user's recurring ride bookings
+func GetMyRideSeries(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	series, err := database.GetUserRideSeries(ctx, session.UserID)
+	if err != nil {
+		log.Printf("[GetMyRideSeries] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch ride series",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(series))
+	for _, s := range series {
+		result = append(result, rideSeriesToMap(s))
+	}
+	return c.JSON(result)
+}
+
+// CreateRideSeries creates a recurring ride booking for the current user and
+// books its upcoming rides
+func CreateRideSeries(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(15 * time.Second)
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	var req RideSeriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.RideID == nil || req.DaysOfWeek == nil || req.RideTime == nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "rideId, daysOfWeek and rideTime are required",
+		})
+	}
+
+	today := bookings.Today(clock.Now())
+	series := database.RideSeries{
+		UserID:       session.UserID,
+		StartDate:    today,
+		SkipHolidays: true,
+	}
+	msg, err := req.apply(ctx, &series)
+	if err != nil {
+		log.Printf("[CreateRideSeries] Validation error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to create ride series",
+		})
+	}
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+	if series.StartDate.Before(today) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "startDate cannot be in the past",
+		})
+	}
+
+	created, err := database.CreateRideSeries(ctx, series)
+	if err != nil {
+		log.Printf("[CreateRideSeries] Insert error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to create ride series",
+		})
+	}
+
+	materializeRideSeries(ctx, created, "CreateRideSeries")
+	if reloaded, err := database.GetRideSeries(ctx, created.ID); err == nil {
+		created = reloaded
+	}
+
+	return c.Status(201).JSON(rideSeriesToMap(*created))
+}
+
+// GetRideSeries returns a ride series with its upcoming skipped dates
+func GetRideSeries(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	series, err := loadOwnedRideSeries(ctx, c, "GetRideSeries")
+	if series == nil {
+		return err
+	}
+
+	skips, err := database.GetRideSeriesSkips(ctx, series.ID, bookings.Today(clock.Now()))
+	if err != nil {
+		log.Printf("[GetRideSeries] Skips query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch ride series",
+		})
+	}
+
+	skippedDates := make([]string, 0, len(skips))
+	for _, d := range skips {
+		skippedDates = append(skippedDates, bookings.DateKey(d))
+	}
+
+	response := rideSeriesToMap(*series)
+	response["skippedDates"] = skippedDates
+	return c.JSON(response)
+}
+
+// UpdateRideSeries edits a ride series. Upcoming unpaid rides are rebooked
+// with the new schedule.
+func UpdateRideSeries(c *fiber.Ctx) error {
+	ctx, cancel := database.Timeout(15 * time.Second)
+	defer cancel()
+
+	series, err := loadOwnedRideSeries(ctx, c, "UpdateRideSeries")
+	if series == nil {
+		return err
+	}
+
+	var req RideSeriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	msg, err := req.apply(ctx, series)
+	if err != nil {
+		return rideSeriesErrorResponse(c, "UpdateRideSeries", err)
+	}
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	updated, withdrawn, err := database.UpdateRideSeries(ctx, *series)
+	if err != nil {
+		return rideSeriesErrorResponse(c, "UpdateRideSeries", err)
+	}
+	invalidateAnalytics("UpdateRideSeries")
+	bookings.NotifyWithdrawn(withdrawn)
+
+	if updated.Status == database.RideSeriesActive {
+		materializeRideSeries(ctx, updated, "UpdateRideSeries")
+		if reloaded, err := database.GetRideSeries(ctx, updated.ID); err == nil {
+			updated = reloaded
+		}
+	}
+
+	return c.JSON(rideSeriesToMap(*updated))
+}
+
+// PauseRideSeries pauses a ride series and removes its upcoming unpaid rides
+func PauseRideSeries(c *fiber.Ctx) error {
+	return setRideSeriesStatus(c, database.RideSeriesPaused, "PauseRideSeries")
+}
+
+// ResumeRideSeries resumes a paused ride series and books its upcoming rides
+func ResumeRideSeries(c *fiber.Ctx) error {
+	return setRideSeriesStatus(c, database.RideSeriesActive, "ResumeRideSeries")
+}
+
+// CancelRideSeries cancels a ride series and removes its upcoming unpaid rides.
+// Cancelled series can't be resumed.
+func CancelRideSeries(c *fiber.Ctx) error {
+	return setRideSeriesStatus(c, database.RideSeriesCancelled, "CancelRideSeries")
+}
+
+// setRideSeriesStatus changes the status of the :id series
+func setRideSeriesStatus(c *fiber.Ctx, status, logPrefix string) error {
+	ctx, cancel := database.Timeout(15 * time.Second)
+	defer cancel()
+
+	series, err := loadOwnedRideSeries(ctx, c, logPrefix)
+	if series == nil {
+		return err
+	}
+
+	updated, withdrawn, err := database.SetRideSeriesStatus(ctx, series.ID, status)
+	if err != nil {
+		return rideSeriesErrorResponse(c, logPrefix, err)
+	}
+	bookings.NotifyWithdrawn(withdrawn)
+
+	if status == database.RideSeriesActive {
+		materializeRideSeries(ctx, updated, logPrefix)
+		if reloaded, err := database.GetRideSeries(ctx, updated.ID); err == nil {
+			updated = reloaded
+		}
+	} else {
+		invalidateAnalytics(logPrefix)
+	}
+
+	return c.JSON(rideSeriesToMap(*updated))
+}
+
+// SkipRideSeriesRequest represents a request to skip one occurrence of a series
+type SkipRideSeriesRequest struct {
+	Date string `json:"date"` // YYYY-MM-DD
+}
+
+// SkipRideSeriesOccurrence skips a single date of a ride series. A ride that
+// was already booked for that date is removed if it hasn't been paid for.
+func SkipRideSeriesOccurrence(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	series, err := loadOwnedRideSeries(ctx, c, "SkipRideSeriesOccurrence")
+	if series == nil {
+		return err
+	}
+
+	var req SkipRideSeriesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	date, err := bookings.ParseDate(req.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	if date.Before(bookings.Today(clock.Now())) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "date cannot be in the past",
+		})
+	}
+
+	withdrawn, err := database.SkipRideSeriesDate(ctx, series.ID, date)
+	if err != nil {
+		return rideSeriesErrorResponse(c, "SkipRideSeriesOccurrence", err)
+	}
+	invalidateAnalytics("SkipRideSeriesOccurrence")
+	bookings.NotifyWithdrawn(withdrawn)
+
+	return c.JSON(fiber.Map{
+		"message": "occurrence skipped",
+		"date":    bookings.DateKey(date),
+	})
+}
+
+// holidayToMap converts a holiday to the API response format
+func holidayToMap(h database.Holiday) fiber.Map {
+	return fiber.Map{
+		"_id":       strconv.Itoa(h.ID),
+		"date":      bookings.DateKey(h.Date),
+		"name":      h.Name,
+		"createdAt": h.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// GetHolidays returns holidays in a date range (defaults to the next year)
+func GetHolidays(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	from := bookings.Today(clock.Now())
+	to := from.AddDate(1, 0, 0)
+	var err error
+	if v := c.Query("from"); v != "" {
+		if from, err = bookings.ParseDate(v); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if to, err = bookings.ParseDate(v); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	holidays, err := database.GetHolidays(ctx, from, to)
+	if err != nil {
+		log.Printf("[GetHolidays] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch holidays",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(holidays))
+	for _, h := range holidays {
+		result = append(result, holidayToMap(h))
+	}
+	return c.JSON(result)
+}
+
+// CreateHolidayRequest represents a request to add a holiday
+type CreateHolidayRequest struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	Name string `json:"name"`
+}
+
+// CreateHoliday adds a holiday. Recurring rides that skip holidays are not
+// booked on it, and unpaid rides already booked for it are removed.
+func CreateHoliday(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req CreateHolidayRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "name is required",
+		})
+	}
+	date, err := bookings.ParseDate(req.Date)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	holiday, withdrawn, err := database.CreateHoliday(ctx, date, req.Name)
+	if err != nil {
+		if err == database.ErrHolidayExists {
+			return c.Status(409).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		log.Printf("[CreateHoliday] Insert error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to create holiday",
+		})
+	}
+	invalidateAnalytics("CreateHoliday")
+	bookings.NotifyWithdrawn(withdrawn)
+
+	return c.Status(201).JSON(holidayToMap(*holiday))
+}
+
+// DeleteHoliday removes a holiday. Recurring rides are booked on it again by
+// the next scheduler run.
+func DeleteHoliday(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid holiday id format",
+		})
+	}
+
+	deleted, err := database.DeleteHoliday(ctx, id)
+	if err != nil {
+		log.Printf("[DeleteHoliday] Delete error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to delete holiday",
+		})
+	}
+	if !deleted {
+		return c.Status(404).JSON(fiber.Map{
+			"error": "holiday not found",
+		})
+	}
+
+	return c.Status(204).Send(nil)
+}
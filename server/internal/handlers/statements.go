@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+	"github.com/server/internal/statements"
+)
+
+// statementRecordToMap converts a generated statement to the API response format
+func statementRecordToMap(s database.RideStatement) fiber.Map {
+	statementMap := fiber.Map{
+		"_id":            strconv.Itoa(s.ID),
+		"userId":         strconv.Itoa(s.UserID),
+		"period":         statements.FormatPeriod(s.PeriodStart),
+		"invoiceNumber":  s.InvoiceNumber,
+		"openingBalance": s.OpeningBalance,
+		"totalCharges":   s.TotalCharges,
+		"totalPayments":  s.TotalPayments,
+		"totalRefunds":   s.TotalRefunds,
+		"closingBalance": s.ClosingBalance,
+		"rideCount":      s.RideCount,
+		"createdAt":      s.CreatedAt.Format(time.RFC3339),
+		"updatedAt":      s.UpdatedAt.Format(time.RFC3339),
+	}
+	if s.GeneratedAt != nil {
+		statementMap["generatedAt"] = s.GeneratedAt.Format(time.RFC3339)
+	}
+	if s.EmailedAt != nil {
+		statementMap["emailedAt"] = s.EmailedAt.Format(time.RFC3339)
+	}
+	if s.EmailError != nil {
+		statementMap["emailError"] = *s.EmailError
+	}
+	return statementMap
+}
+
+// statementRunToMap converts a bulk generation run to the API response format
+func statementRunToMap(r database.StatementRun) fiber.Map {
+	runMap := fiber.Map{
+		"_id":            strconv.Itoa(r.ID),
+		"period":         statements.FormatPeriod(r.PeriodStart),
+		"trigger":        r.Trigger,
+		"sendEmail":      r.SendEmail,
+		"status":         r.Status,
+		"totalStudents":  r.TotalStudents,
+		"generatedCount": r.GeneratedCount,
+		"emailedCount":   r.EmailedCount,
+		"failedCount":    r.FailedCount,
+		"startedAt":      r.StartedAt.Format(time.RFC3339),
+	}
+	if r.ErrorMessage != nil {
+		runMap["errorMessage"] = *r.ErrorMessage
+	}
+	if r.StartedBy != nil {
+		runMap["startedBy"] = strconv.Itoa(*r.StartedBy)
+	}
+	if r.FinishedAt != nil {
+		runMap["finishedAt"] = r.FinishedAt.Format(time.RFC3339)
+	}
+	return runMap
+}
+
+// parseStatementPeriod parses the :period route parameter, rejecting future months
+func parseStatementPeriod(c *fiber.Ctx) (time.Time, error) {
+	periodStart, err := statements.ParsePeriod(c.Params("period"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if periodStart.After(clock.Now()) {
+		return time.Time{}, fmt.Errorf("statement period has not started yet")
+	}
+	return periodStart, nil
+}
+
+// GetMyStatements returns the generated statements of the current user
+func GetMyStatements(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	records, err := database.GetUserStatements(ctx, session.UserID)
+	if err != nil {
+		log.Printf("[GetMyStatements] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch statements",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(records))
+	for _, r := range records {
+		result = append(result, statementRecordToMap(r))
+	}
+	return c.JSON(result)
+}
+
+// GetMyStatement returns the current user's statement for a month (YYYY-MM)
+// with opening balance, rides, payments and closing balance
+func GetMyStatement(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+
+	periodStart, err := parseStatementPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	st, err := database.BuildStatement(ctx, session.UserID, periodStart, statements.PeriodEnd(periodStart))
+	if err != nil {
+		log.Printf("[GetMyStatement] Build error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to build statement",
+		})
+	}
+
+	response := fiber.Map{
+		"period":         statements.FormatPeriod(periodStart),
+		"periodStart":    st.PeriodStart.Format(time.RFC3339),
+		"periodEnd":      st.PeriodEnd.Format(time.RFC3339),
+		"openingBalance": st.OpeningBalance,
+		"totalCharges":   st.TotalCharges,
+		"totalPayments":  st.TotalPayments,
+		"totalRefunds":   st.TotalRefunds,
+		"closingBalance": st.ClosingBalance,
+		"rides":          st.Rides,
+		"payments":       st.Payments,
+	}
+
+	record, err := database.GetUserStatement(ctx, session.UserID, periodStart)
+	if err == nil {
+		response["invoiceNumber"] = record.InvoiceNumber
+	} else if err != database.ErrStatementNotFound {
+		log.Printf("[GetMyStatement] Record lookup error: %v", err)
+	}
+
+	return c.JSON(response)
+}
+
+// DownloadMyStatement returns the current user's statement PDF for a month
+func DownloadMyStatement(c *fiber.Ctx) error {
+	session := middleware.GetSession(c)
+	if session == nil {
+		return c.Status(401).JSON(fiber.Map{
+			"error": "unauthorized",
+		})
+	}
+	return sendStatementPDF(c, session.UserID, "DownloadMyStatement")
+}
+
+// DownloadUserStatement returns a student's statement PDF for a month (admin)
+func DownloadUserStatement(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+	return sendStatementPDF(c, userID, "DownloadUserStatement")
+}
+
+// sendStatementPDF serves the stored PDF for a closed month, generating it if
+// needed. The current month is rendered as an unnumbered draft, and months
+// with no balance or activity have no statement.
+func sendStatementPDF(c *fiber.Ctx, userID int, logPrefix string) error {
+	ctx, cancel := database.Timeout(30 * time.Second)
+	defer cancel()
+
+	periodStart, err := parseStatementPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	if statements.PeriodEnd(periodStart).After(clock.Now()) {
+		data, err := statements.Draft(ctx, userID, periodStart)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+		if err != nil {
+			log.Printf("[%s] Draft error: %v", logPrefix, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to generate statement",
+			})
+		}
+		return sendStatementFile(c, statements.DraftDownloadName(periodStart), data)
+	}
+
+	var data []byte
+	record, err := database.GetUserStatement(ctx, userID, periodStart)
+	if err == nil {
+		data, err = statements.Load(ctx, record)
+		if err != nil {
+			log.Printf("[%s] Stored statement %d unavailable, regenerating: %v", logPrefix, record.ID, err)
+			data = nil
+		}
+	}
+
+	if data == nil {
+		result, err := statements.Generate(ctx, userID, periodStart)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "user not found",
+			})
+		}
+		if errors.Is(err, statements.ErrNoActivity) {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "no statement for this period",
+			})
+		}
+		if err != nil {
+			log.Printf("[%s] Generate error: %v", logPrefix, err)
+			return c.Status(500).JSON(fiber.Map{
+				"error": "failed to generate statement",
+			})
+		}
+		record = result.Record
+		data = result.PDF
+	}
+
+	return sendStatementFile(c, statements.DownloadName(record), data)
+}
+
+// sendStatementFile sends a statement PDF as a download
+func sendStatementFile(c *fiber.Ctx, fileName string, data []byte) error {
+	c.Set("Content-Type", "application/pdf")
+	c.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fileName))
+	c.Set("Cache-Control", "private, no-store")
+	return c.Send(data)
+}
+
+// StartStatementRunRequest represents a bulk statement generation request
+type StartStatementRunRequest struct {
+	Period    string `json:"period"`              // YYYY-MM, defaults to the previous month
+	SendEmail *bool  `json:"sendEmail,omitempty"` // Defaults to true
+}
+
+// StartStatementRun starts a background job generating every student's
+// statement for a month and emailing it to them
+func StartStatementRun(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req StartStatementRunRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": "invalid request body",
+			})
+		}
+	}
+
+	periodStart := statements.PreviousMonth(clock.Now())
+	if req.Period != "" {
+		parsed, err := statements.ParsePeriod(req.Period)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		}
+		periodStart = parsed
+	}
+	if statements.PeriodEnd(periodStart).After(clock.Now()) {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "statement period has not ended yet",
+		})
+	}
+
+	sendEmail := true
+	if req.SendEmail != nil {
+		sendEmail = *req.SendEmail
+	}
+
+	if n, err := database.FailStaleStatementRuns(ctx, periodStart, statements.RunStaleAfter); err != nil {
+		log.Printf("[StartStatementRun] Stale run check error: %v", err)
+	} else if n > 0 {
+		log.Printf("[StartStatementRun] Marked %d interrupted runs for %s as failed", n, statements.FormatPeriod(periodStart))
+	}
+
+	running, err := database.HasRunningStatementRun(ctx, periodStart)
+	if err != nil {
+		log.Printf("[StartStatementRun] Running check error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to start statement run",
+		})
+	}
+	if running {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "a statement run for this period is already in progress",
+		})
+	}
+
+	var startedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		startedBy = &session.UserID
+	}
+
+	run, err := database.CreateStatementRun(ctx, periodStart, "manual", sendEmail, startedBy)
+	if err != nil || run == nil {
+		log.Printf("[StartStatementRun] Create error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to start statement run",
+		})
+	}
+
+	go statements.RunBulk(context.Background(), run)
+
+	requestID := middleware.GetRequestID(c)
+	return c.Status(202).JSON(fiber.Map{
+		"run":        statementRunToMap(*run),
+		"request_id": requestID,
+	})
+}
+
+// GetStatementRuns returns recent bulk statement runs
+func GetStatementRuns(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	runs, err := database.GetStatementRuns(ctx, 50)
+	if err != nil {
+		log.Printf("[GetStatementRuns] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch statement runs",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(runs))
+	for _, r := range runs {
+		result = append(result, statementRunToMap(r))
+	}
+	return c.JSON(result)
+}
+
+// GetStatementRun returns a bulk statement run with its progress
+func GetStatementRun(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	runID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid run id format",
+		})
+	}
+
+	run, err := database.GetStatementRun(ctx, runID)
+	if err != nil {
+		if err == database.ErrStatementNotFound {
+			return c.Status(404).JSON(fiber.Map{
+				"error": "statement run not found",
+			})
+		}
+		log.Printf("[GetStatementRun] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch statement run",
+		})
+	}
+
+	return c.JSON(statementRunToMap(*run))
+}
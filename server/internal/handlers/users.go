@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"log"
 	"strconv"
 	"strings"
@@ -25,7 +26,7 @@ func GetUsers(c *fiber.Ctx) error {
 		       enrollment_number, programme, course, year, expiry_date, hostel,
 		       profile_picture, disability_type, disability_percentage, udid_number,
 		       disability_certificate, id_proof_type, id_proof_document,
-		       license_number, vehicle_number, vehicle_type,
+		       license_number, ` + userVehicleColumns + `,
 		       created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
@@ -200,7 +201,7 @@ func GetUserByID(c *fiber.Ctx) error {
 		       enrollment_number, programme, course, year, expiry_date, hostel,
 		       profile_picture, disability_type, disability_percentage, udid_number,
 		       disability_certificate, id_proof_type, id_proof_document,
-		       license_number, vehicle_number, vehicle_type,
+		       license_number, ` + userVehicleColumns + `,
 		       created_at, updated_at
 		FROM users
 		WHERE id = $1
@@ -302,16 +303,10 @@ func CreateUser(c *fiber.Ctx) error {
 	var status string
 	if req.Status != nil {
 		// Validate status value
-		validStatuses := map[string]bool{
-			"active":   true,
-			"inactive": true,
-			"expired":  true,
-			"closed":   true,
-		}
 		statusValue := strings.ToLower(strings.TrimSpace(*req.Status))
-		if !validStatuses[statusValue] {
+		if !database.ValidUserStatuses[statusValue] {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid status. Must be one of: active, inactive, expired, closed",
+				"error": "invalid status. Must be one of: active, suspended, pending, graduated, expired, inactive, closed",
 			})
 		}
 		status = statusValue
@@ -361,9 +356,9 @@ func CreateUser(c *fiber.Ctx) error {
 			enrollment_number, programme, course, year, expiry_date, hostel,
 			profile_picture, disability_type, disability_percentage, udid_number,
 			disability_certificate, id_proof_type, id_proof_document,
-			license_number, vehicle_number, vehicle_type
+			license_number
 		) VALUES (
-			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21
 		) RETURNING id
 	`
 
@@ -373,7 +368,7 @@ func CreateUser(c *fiber.Ctx) error {
 		req.EnrollmentNumber, req.Programme, req.Course, req.Year, req.ExpiryDate, req.Hostel,
 		req.ProfilePicture, req.DisabilityType, req.DisabilityPercentage, req.UDIDNumber,
 		req.DisabilityCertificate, req.IDProofType, req.IDProofDocument,
-		req.LicenseNumber, req.VehicleNumber, req.VehicleType,
+		req.LicenseNumber,
 	).Scan(&userID)
 
 	if err != nil {
@@ -400,13 +395,15 @@ func CreateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	syncDriverVehicle(ctx, "CreateUser", userID, req.VehicleNumber, req.VehicleType)
+
 	// Fetch the created user
 	rows, err := database.GetPool().Query(ctx, `
 		SELECT id, username, email, role, phone, name, status, is_phone_verified,
 		       enrollment_number, programme, course, year, expiry_date, hostel,
 		       profile_picture, disability_type, disability_percentage, udid_number,
 		       disability_certificate, id_proof_type, id_proof_document,
-		       license_number, vehicle_number, vehicle_type,
+		       license_number, `+userVehicleColumns+`,
 		       created_at, updated_at
 		FROM users WHERE id = $1
 	`, userID)
@@ -511,6 +508,13 @@ func UpdateUser(c *fiber.Ctx) error {
 	args := []interface{}{}
 	argPos := 1
 
+	// What changed about the user's sessions
+	change := auth.UserChange{
+		Password: req.Password != nil,
+		Identity: req.Username != nil || req.Email != nil,
+		Expiry:   req.ExpiryDate != nil,
+	}
+
 	if req.Email != nil {
 		updates = append(updates, "email = $"+strconv.Itoa(argPos))
 		args = append(args, *req.Email)
@@ -557,26 +561,22 @@ func UpdateUser(c *fiber.Ctx) error {
 				updates = append(updates, "role = $"+strconv.Itoa(argPos))
 				args = append(args, *req.Role)
 				argPos++
+				change.Role = true
 			}
 		} else {
 			updates = append(updates, "role = $"+strconv.Itoa(argPos))
 			args = append(args, *req.Role)
 			argPos++
+			change.Role = true
 		}
 	}
 	// Handle status field (prioritize Status over IsActive for backward compatibility)
 	if req.Status != nil {
 		// Validate status value
-		validStatuses := map[string]bool{
-			"active":   true,
-			"inactive": true,
-			"expired":  true,
-			"closed":   true,
-		}
 		statusValue := strings.ToLower(strings.TrimSpace(*req.Status))
-		if !validStatuses[statusValue] {
+		if !database.ValidUserStatuses[statusValue] {
 			return c.Status(400).JSON(fiber.Map{
-				"error": "invalid status. Must be one of: active, inactive, expired, closed",
+				"error": "invalid status. Must be one of: active, suspended, pending, graduated, expired, inactive, closed",
 			})
 		}
 
@@ -601,6 +601,7 @@ func UpdateUser(c *fiber.Ctx) error {
 			updates = append(updates, "status = $"+strconv.Itoa(argPos))
 			args = append(args, statusValue)
 			argPos++
+			change.Status = true
 		}
 	} else if req.IsActive != nil {
 		// Backward compatibility: convert IsActive to status
@@ -623,6 +624,7 @@ func UpdateUser(c *fiber.Ctx) error {
 		updates = append(updates, "status = $"+strconv.Itoa(argPos))
 		args = append(args, status)
 		argPos++
+		change.Status = true
 	}
 	if req.Name != nil {
 		updates = append(updates, "name = $"+strconv.Itoa(argPos))
@@ -727,18 +729,7 @@ func UpdateUser(c *fiber.Ctx) error {
 		args = append(args, *req.LicenseNumber)
 		argPos++
 	}
-	if req.VehicleNumber != nil {
-		updates = append(updates, "vehicle_number = $"+strconv.Itoa(argPos))
-		args = append(args, *req.VehicleNumber)
-		argPos++
-	}
-	if req.VehicleType != nil {
-		updates = append(updates, "vehicle_type = $"+strconv.Itoa(argPos))
-		args = append(args, *req.VehicleType)
-		argPos++
-	}
-
-	if len(updates) == 0 {
+	if len(updates) == 0 && req.VehicleNumber == nil && req.VehicleType == nil {
 		return c.Status(400).JSON(fiber.Map{
 			"error": "no fields to update",
 		})
@@ -764,13 +755,20 @@ func UpdateUser(c *fiber.Ctx) error {
 		})
 	}
 
+	syncDriverVehicle(ctx, "UpdateUser", updatedID, req.VehicleNumber, req.VehicleType)
+
+	// Refresh or revoke the user's live sessions so the change applies now
+	if err := auth.ApplyUserChange(ctx, updatedID, change, middleware.GetSessionID(c)); err != nil {
+		log.Printf("[UpdateUser] Failed to update sessions of user %d: %v", updatedID, err)
+	}
+
 	// Fetch updated user
 	rows, err := database.GetPool().Query(ctx, `
 		SELECT id, username, email, role, phone, name, status, is_phone_verified,
 		       enrollment_number, programme, course, year, expiry_date, hostel,
 		       profile_picture, disability_type, disability_percentage, udid_number,
 		       disability_certificate, id_proof_type, id_proof_document,
-		       license_number, vehicle_number, vehicle_type,
+		       license_number, `+userVehicleColumns+`,
 		       created_at, updated_at
 		FROM users WHERE id = $1
 	`, updatedID)
@@ -803,6 +801,37 @@ func UpdateUser(c *fiber.Ctx) error {
 	})
 }
 
+// userVehicleColumns selects the registration number and type of a user's
+// current fleet vehicle, which the users API still reports as vehicleNumber
+// and vehicleType
+const userVehicleColumns = `(SELECT v.registration_number FROM driver_vehicle_assignments a
+		           JOIN vehicles v ON v.id = a.vehicle_id
+		           WHERE a.driver_id = users.id AND a.ends_at IS NULL) AS vehicle_number,
+		       (SELECT v.vehicle_type FROM driver_vehicle_assignments a
+		           JOIN vehicles v ON v.id = a.vehicle_id
+		           WHERE a.driver_id = users.id AND a.ends_at IS NULL) AS vehicle_type`
+
+// syncDriverVehicle applies a vehicle number and type given for a driver to
+// the fleet, where driver vehicles are kept. Failures are logged because the
+// user itself has already been saved.
+func syncDriverVehicle(ctx context.Context, logPrefix string, userID int, vehicleNumber, vehicleType *string) {
+	if vehicleNumber == nil && vehicleType == nil {
+		return
+	}
+	var role string
+	err := database.GetPool().QueryRow(ctx, `SELECT role FROM users WHERE id = $1`, userID).Scan(&role)
+	if err != nil {
+		log.Printf("[%s] Vehicle sync lookup error: %v", logPrefix, err)
+		return
+	}
+	if !strings.EqualFold(role, "driver") {
+		return
+	}
+	if err := database.SetDriverVehicle(ctx, userID, vehicleNumber, vehicleType); err != nil {
+		log.Printf("[%s] Vehicle sync error: %v", logPrefix, err)
+	}
+}
+
 // DeleteUser deletes a user by ID
 func DeleteUser(c *fiber.Ctx) error {
 	ctx, cancel := database.DefaultTimeout()
@@ -862,6 +891,11 @@ func DeleteUser(c *fiber.Ctx) error {
 		})
 	}
 
+	// End the deleted user's sessions; their rows went with the user
+	if err := auth.ApplyUserChange(ctx, deletedID, auth.UserChange{Deleted: true}, ""); err != nil {
+		log.Printf("[DeleteUser] Failed to revoke sessions of user %d: %v", deletedID, err)
+	}
+
 	requestID := middleware.GetRequestID(c)
 	return c.JSON(fiber.Map{
 		"message":    "user deleted successfully",
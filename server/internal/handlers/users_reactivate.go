@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/auth"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+const (
+	// maxBulkReactivateUsers bounds the users reactivated in one operation
+	maxBulkReactivateUsers = 2000
+	// bulkReactivateTimeout bounds a bulk reactivation transaction
+	bulkReactivateTimeout = 30 * time.Second
+)
+
+// BulkReactivateRequest represents a request to make suspended, expired or
+// otherwise inactive users active again
+type BulkReactivateRequest struct {
+	UserIDs    []int  `json:"userIds"`
+	ExpiryDate string `json:"expiryDate,omitempty"` // New expiry date for the students
+}
+
+// expiryDate parses the new expiry date. Returns a message for the client
+// when it is invalid.
+func (r *BulkReactivateRequest) expiryDate() (*time.Time, string) {
+	if r.ExpiryDate == "" {
+		return nil, ""
+	}
+	date, err := time.ParseInLocation("2006-01-02", r.ExpiryDate, clock.Location())
+	if err != nil {
+		return nil, "invalid expiry date format. Use YYYY-MM-DD"
+	}
+	if date.Before(clock.Today()) {
+		return nil, "expiry date cannot be in the past"
+	}
+	return &date, ""
+}
+
+// reactivateResultToMap converts the outcome of reactivating a user to its
+// JSON representation
+func reactivateResultToMap(r database.ReactivateResult) fiber.Map {
+	m := fiber.Map{
+		"userId": strconv.Itoa(r.UserID),
+		"status": r.Status,
+	}
+	if r.PreviousStatus != "" {
+		m["previousStatus"] = r.PreviousStatus
+	}
+	return m
+}
+
+// BulkReactivateUsers makes many users active again at once. Students whose
+// expiry date has passed need a new expiryDate, or they are left as they are
+// and reported, since they would expire again the next night. Every user is
+// reported. Live sessions of reactivated users pick up their new status and
+// expiry, like they do after UpdateUser.
+func BulkReactivateUsers(c *fiber.Ctx) error {
+	var req BulkReactivateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if len(req.UserIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "userIds is required",
+		})
+	}
+	if len(req.UserIDs) > maxBulkReactivateUsers {
+		return c.Status(400).JSON(fiber.Map{
+			"error": fmt.Sprintf("at most %d users can be reactivated at once", maxBulkReactivateUsers),
+		})
+	}
+	expiryDate, msg := req.expiryDate()
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	ctx, cancel := database.Timeout(bulkReactivateTimeout)
+	defer cancel()
+
+	results, err := database.ReactivateUsers(ctx, req.UserIDs, expiryDate, clock.Today())
+	if err != nil {
+		log.Printf("[BulkReactivateUsers] Error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to reactivate users",
+		})
+	}
+
+	counts := map[string]int{}
+	rows := make([]fiber.Map, 0, len(results))
+	for _, r := range results {
+		counts[r.Status]++
+		rows = append(rows, reactivateResultToMap(r))
+
+		if r.Status == database.ReactivateReactivated {
+			err := auth.ApplyUserChange(ctx, r.UserID, auth.UserChange{Status: true, Expiry: true}, "")
+			if err != nil {
+				log.Printf("[BulkReactivateUsers] Failed to update sessions of user %d: %v", r.UserID, err)
+			}
+		}
+	}
+	if session := middleware.GetSession(c); session != nil {
+		log.Printf("[BulkReactivateUsers] User %d reactivated %d of %d users",
+			session.UserID, counts[database.ReactivateReactivated], len(results))
+	}
+	return c.JSON(fiber.Map{
+		"total":  len(results),
+		"counts": counts,
+		"users":  rows,
+	})
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/server/internal/clock"
+)
+
+func TestBulkReactivateExpiryDate(t *testing.T) {
+	today := clock.Today()
+	tests := []struct {
+		name    string
+		value   string
+		wantNil bool
+		wantMsg bool
+	}{
+		{"not given", "", true, false},
+		{"today", today.Format("2006-01-02"), false, false},
+		{"next year", today.AddDate(1, 0, 0).Format("2006-01-02"), false, false},
+		{"yesterday", today.AddDate(0, 0, -1).Format("2006-01-02"), true, true},
+		{"bad format", "10/03/2026", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := BulkReactivateRequest{ExpiryDate: tt.value}
+			date, msg := req.expiryDate()
+			if (date == nil) != tt.wantNil || (msg != "") != tt.wantMsg {
+				t.Errorf("expiryDate(%q) = %v, %q", tt.value, date, msg)
+			}
+		})
+	}
+}
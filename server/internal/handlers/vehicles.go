@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/server/internal/bookings"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/middleware"
+)
+
+// vehicleToMap converts a vehicle to the API response format
+func vehicleToMap(v database.Vehicle) fiber.Map {
+	drivers := make([]string, 0, len(v.CurrentDrivers))
+	for _, id := range v.CurrentDrivers {
+		drivers = append(drivers, strconv.Itoa(int(id)))
+	}
+	vehicleMap := fiber.Map{
+		"_id":                   strconv.Itoa(v.ID),
+		"registrationNumber":    v.RegistrationNumber,
+		"capacity":              v.Capacity,
+		"accessibilityFeatures": v.AccessibilityFeatures,
+		"status":                v.Status,
+		"currentDriverIds":      drivers,
+		"documentIssues":        database.VehicleDocumentIssues(v, clock.Now()),
+		"createdAt":             v.CreatedAt.Format(time.RFC3339),
+		"updatedAt":             v.UpdatedAt.Format(time.RFC3339),
+	}
+	if v.VehicleType != nil {
+		vehicleMap["vehicleType"] = *v.VehicleType
+	}
+	if v.InsuranceExpiry != nil {
+		vehicleMap["insuranceExpiry"] = v.InsuranceExpiry.Format("2006-01-02")
+	}
+	if v.FitnessExpiry != nil {
+		vehicleMap["fitnessExpiry"] = v.FitnessExpiry.Format("2006-01-02")
+	}
+	if v.Notes != nil {
+		vehicleMap["notes"] = *v.Notes
+	}
+	return vehicleMap
+}
+
+// vehicleAssignmentToMap converts a vehicle assignment to the API response format
+func vehicleAssignmentToMap(a database.VehicleAssignment) fiber.Map {
+	assignmentMap := fiber.Map{
+		"_id":                strconv.Itoa(a.ID),
+		"driverId":           strconv.Itoa(a.DriverID),
+		"driverName":         a.DriverName,
+		"vehicleId":          strconv.Itoa(a.VehicleID),
+		"registrationNumber": a.RegistrationNumber,
+		"startsAt":           a.StartsAt.Format(time.RFC3339),
+		"current":            a.EndsAt == nil,
+	}
+	if a.EndsAt != nil {
+		assignmentMap["endsAt"] = a.EndsAt.Format(time.RFC3339)
+	}
+	if a.AssignedBy != nil {
+		assignmentMap["assignedBy"] = strconv.Itoa(*a.AssignedBy)
+	}
+	return assignmentMap
+}
+
+// vehicleErrorResponse maps vehicle errors to HTTP responses
+func vehicleErrorResponse(c *fiber.Ctx, logPrefix, action string, err error) error {
+	switch err {
+	case database.ErrVehicleNotFound, database.ErrAssignmentNotFound:
+		return c.Status(404).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrVehicleExists, database.ErrVehicleInUse, database.ErrVehicleInactive:
+		return c.Status(409).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case database.ErrDriverNotFound:
+		return c.Status(400).JSON(fiber.Map{
+			"error": "driver not found",
+		})
+	}
+	log.Printf("[%s] Vehicle error: %v", logPrefix, err)
+	return c.Status(500).JSON(fiber.Map{
+		"error": "failed to " + action,
+	})
+}
+
+// VehicleRequest represents a vehicle create or update request
+type VehicleRequest struct {
+	RegistrationNumber    *string  `json:"registrationNumber"`
+	VehicleType           *string  `json:"vehicleType"`
+	Capacity              *int     `json:"capacity"`
+	AccessibilityFeatures []string `json:"accessibilityFeatures"`
+	InsuranceExpiry       *string  `json:"insuranceExpiry"` // YYYY-MM-DD, empty string to clear
+	FitnessExpiry         *string  `json:"fitnessExpiry"`   // YYYY-MM-DD, empty string to clear
+	Status                *string  `json:"status"`
+	Notes                 *string  `json:"notes"`
+}
+
+// apply validates the request and applies it to a vehicle
+func (req VehicleRequest) apply(v *database.Vehicle) string {
+	if req.RegistrationNumber != nil {
+		v.RegistrationNumber = database.NormalizeRegistration(*req.RegistrationNumber)
+	}
+	if v.RegistrationNumber == "" {
+		return "registrationNumber is required"
+	}
+	if req.VehicleType != nil {
+		vehicleType := strings.TrimSpace(*req.VehicleType)
+		v.VehicleType = &vehicleType
+		if vehicleType == "" {
+			v.VehicleType = nil
+		}
+	}
+	if req.Capacity != nil {
+		if *req.Capacity <= 0 {
+			return "capacity must be greater than 0"
+		}
+		v.Capacity = *req.Capacity
+	}
+	if req.AccessibilityFeatures != nil {
+		features, err := database.NormalizeAccessibilityTags(req.AccessibilityFeatures)
+		if err != nil {
+			return err.Error()
+		}
+		v.AccessibilityFeatures = features
+	}
+	for _, field := range []struct {
+		name  string
+		value *string
+		dest  **time.Time
+	}{
+		{"insuranceExpiry", req.InsuranceExpiry, &v.InsuranceExpiry},
+		{"fitnessExpiry", req.FitnessExpiry, &v.FitnessExpiry},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if *field.value == "" {
+			*field.dest = nil
+			continue
+		}
+		date, err := bookings.ParseDate(*field.value)
+		if err != nil {
+			return field.name + ": " + err.Error()
+		}
+		*field.dest = &date
+	}
+	if req.Status != nil {
+		status := strings.ToLower(strings.TrimSpace(*req.Status))
+		if !database.ValidVehicleStatuses[status] {
+			return "invalid status. Must be one of: active, maintenance, retired"
+		}
+		v.Status = status
+	}
+	if req.Notes != nil {
+		v.Notes = req.Notes
+	}
+	return ""
+}
+
+// parseVehicleID parses the :id route parameter
+func parseVehicleID(c *fiber.Ctx) (int, error) {
+	return strconv.Atoi(c.Params("id"))
+}
+
+// GetVehicles returns fleet vehicles, optionally filtered by status and search
+func GetVehicles(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	vehicles, err := database.GetVehicles(ctx, strings.ToLower(c.Query("status")), strings.TrimSpace(c.Query("search")))
+	if err != nil {
+		log.Printf("[GetVehicles] Query error: %v", err)
+		return c.Status(500).JSON(fiber.Map{
+			"error": "failed to fetch vehicles",
+		})
+	}
+
+	result := make([]fiber.Map, 0, len(vehicles))
+	for _, v := range vehicles {
+		result = append(result, vehicleToMap(v))
+	}
+	return c.JSON(result)
+}
+
+// GetVehicle returns a single vehicle
+func GetVehicle(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+
+	vehicle, err := database.GetVehicle(ctx, id)
+	if err != nil {
+		return vehicleErrorResponse(c, "GetVehicle", "fetch vehicle", err)
+	}
+	return c.JSON(vehicleToMap(*vehicle))
+}
+
+// CreateVehicle adds a vehicle to the fleet
+func CreateVehicle(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	var req VehicleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	vehicle := database.Vehicle{
+		Capacity:              4,
+		AccessibilityFeatures: []string{},
+		Status:                "active",
+	}
+	if msg := req.apply(&vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	created, err := database.CreateVehicle(ctx, vehicle)
+	if err != nil {
+		return vehicleErrorResponse(c, "CreateVehicle", "create vehicle", err)
+	}
+	return c.Status(201).JSON(vehicleToMap(*created))
+}
+
+// UpdateVehicle updates a vehicle. Retiring a vehicle ends its driver assignments.
+func UpdateVehicle(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+
+	var req VehicleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	vehicle, err := database.GetVehicle(ctx, id)
+	if err != nil {
+		return vehicleErrorResponse(c, "UpdateVehicle", "update vehicle", err)
+	}
+	if msg := req.apply(vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{
+			"error": msg,
+		})
+	}
+
+	updated, err := database.UpdateVehicle(ctx, *vehicle)
+	if err != nil {
+		return vehicleErrorResponse(c, "UpdateVehicle", "update vehicle", err)
+	}
+	return c.JSON(vehicleToMap(*updated))
+}
+
+// DeleteVehicle removes a vehicle that never served a ride
+func DeleteVehicle(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+
+	if err := database.DeleteVehicle(ctx, id); err != nil {
+		return vehicleErrorResponse(c, "DeleteVehicle", "delete vehicle", err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Vehicle deleted successfully",
+	})
+}
+
+// GetVehicleAssignments returns the driver assignment history of a vehicle
+func GetVehicleAssignments(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+
+	if _, err := database.GetVehicle(ctx, id); err != nil {
+		return vehicleErrorResponse(c, "GetVehicleAssignments", "fetch vehicle assignments", err)
+	}
+	assignments, err := database.GetVehicleAssignments(ctx, id)
+	if err != nil {
+		return vehicleErrorResponse(c, "GetVehicleAssignments", "fetch vehicle assignments", err)
+	}
+
+	result := make([]fiber.Map, 0, len(assignments))
+	for _, a := range assignments {
+		result = append(result, vehicleAssignmentToMap(a))
+	}
+	return c.JSON(result)
+}
+
+// AssignVehicleRequest represents a driver assignment request
+type AssignVehicleRequest struct {
+	DriverID int `json:"driverId"`
+}
+
+// AssignVehicleDriver makes the vehicle the driver's current vehicle. The
+// driver's previous assignment ends; other drivers of the vehicle keep theirs.
+func AssignVehicleDriver(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+
+	var req AssignVehicleRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if req.DriverID <= 0 {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "driverId is required",
+		})
+	}
+
+	var assignedBy *int
+	if session := middleware.GetSession(c); session != nil {
+		assignedBy = &session.UserID
+	}
+
+	assignment, err := database.AssignVehicle(ctx, id, req.DriverID, assignedBy)
+	if err != nil {
+		return vehicleErrorResponse(c, "AssignVehicleDriver", "assign driver", err)
+	}
+	return c.Status(201).JSON(vehicleAssignmentToMap(*assignment))
+}
+
+// EndVehicleAssignment ends a driver's current assignment to a vehicle
+func EndVehicleAssignment(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	id, err := parseVehicleID(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid vehicle id format",
+		})
+	}
+	assignmentID, err := strconv.Atoi(c.Params("assignmentId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid assignment id format",
+		})
+	}
+
+	if err := database.EndVehicleAssignment(ctx, id, assignmentID); err != nil {
+		return vehicleErrorResponse(c, "EndVehicleAssignment", "end assignment", err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Assignment ended successfully",
+	})
+}
+
+// GetUserVehicleAssignments returns the vehicle assignment history of a driver
+func GetUserVehicleAssignments(c *fiber.Ctx) error {
+	ctx, cancel := database.DefaultTimeout()
+	defer cancel()
+
+	driverID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{
+			"error": "invalid user id format",
+		})
+	}
+
+	assignments, err := database.GetDriverAssignments(ctx, driverID)
+	if err != nil {
+		return vehicleErrorResponse(c, "GetUserVehicleAssignments", "fetch vehicle assignments", err)
+	}
+
+	result := make([]fiber.Map, 0, len(assignments))
+	for _, a := range assignments {
+		result = append(result, vehicleAssignmentToMap(a))
+	}
+	return c.JSON(result)
+}
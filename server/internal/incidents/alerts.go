@@ -0,0 +1,136 @@
+package incidents
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/server/internal/cache"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+)
+
+// notifyTimeout bounds how long alerting on a single incident can take
+const notifyTimeout = 2 * time.Minute
+
+// Event is broadcast on the realtime channel when an incident is raised or changes
+type Event struct {
+	Type     string             `json:"type"` // "created" or "updated"
+	Incident *database.Incident `json:"incident"`
+}
+
+// MapsLink returns a link to an incident's reported position, or "" when
+// the position is unknown
+func MapsLink(l database.IncidentLocation) string {
+	if l.Latitude == nil || l.Longitude == nil {
+		return ""
+	}
+	return "https://www.google.com/maps?q=" +
+		strconv.FormatFloat(*l.Latitude, 'f', 6, 64) + "," +
+		strconv.FormatFloat(*l.Longitude, 'f', 6, 64)
+}
+
+// FormatAlert builds the subject and body of the alert email for an incident
+func FormatAlert(i *database.Incident) (string, string) {
+	label := "Incident"
+	if i.Kind == database.IncidentSOS {
+		label = "SOS"
+	}
+	subject := fmt.Sprintf("[%s] %s #%d", strings.ToUpper(i.Severity), label, i.ID)
+	if i.RideBillID != nil {
+		subject += fmt.Sprintf(" on ride #%d", *i.RideBillID)
+	}
+
+	var b strings.Builder
+	line := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "%s: %s\n", name, value)
+		}
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return ""
+		}
+		return *s
+	}
+
+	fmt.Fprintf(&b, "A new %s has been raised and needs attention.\n\n", strings.ToLower(label))
+	line("Severity", i.Severity)
+	occurredAt := i.CreatedAt
+	if i.Location.OccurredAt != nil {
+		occurredAt = *i.Location.OccurredAt
+	}
+	line("Time", occurredAt.In(clock.Location()).Format("02 Jan 2006 15:04 MST"))
+	reporter := deref(i.ReporterName)
+	if phone := deref(i.ReporterPhone); phone != "" {
+		reporter += " (" + phone + ")"
+	}
+	line("Reported by", reporter)
+	if i.RideBillID != nil {
+		line("Ride", fmt.Sprintf("#%d", *i.RideBillID))
+		if i.FromLocation != nil && i.ToLocation != nil {
+			line("Route", *i.FromLocation+" → "+*i.ToLocation)
+		}
+	}
+	line("Driver", deref(i.DriverName))
+	line("Vehicle", deref(i.VehicleRegistration))
+	line("Location", deref(i.Location.Text))
+	line("Map", MapsLink(i.Location))
+	if i.Location.Accuracy != nil {
+		line("Accuracy", fmt.Sprintf("%.0f m", *i.Location.Accuracy))
+	}
+	if desc := deref(i.Description); desc != "" {
+		b.WriteString("\n" + desc + "\n")
+	}
+	b.WriteString("\nAcknowledge this incident from the admin dashboard.\n")
+
+	return subject, b.String()
+}
+
+// Publish broadcasts an incident event on the realtime channel
+func Publish(ctx context.Context, eventType string, i *database.Incident) {
+	if err := cache.PublishIncident(ctx, Event{Type: eventType, Incident: i}); err != nil && err != cache.ErrCacheUnavailable {
+		log.Printf("[incidents] Failed to publish incident %d: %v", i.ID, err)
+	}
+}
+
+// Notify alerts on-call admins about a new incident by email and on the
+// realtime channel. It runs in the background so the reporter is never kept
+// waiting on SMTP.
+func Notify(i *database.Incident) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		Publish(ctx, "created", i)
+
+		recipients, err := database.GetIncidentRecipients(ctx)
+		if err != nil {
+			log.Printf("[incidents] Failed to load recipients for incident %d: %v", i.ID, err)
+			return
+		}
+		if len(recipients) == 0 {
+			log.Printf("[incidents] No admins to alert about incident %d", i.ID)
+			return
+		}
+
+		subject, body := FormatAlert(i)
+		for _, r := range recipients {
+			userID := r.UserID
+			err := email.Send(ctx, email.Message{
+				To:      r.Email,
+				UserID:  &userID,
+				Subject: subject,
+				Body:    fmt.Sprintf("Hello %s,\n\n%s", r.Name, body),
+				Type:    "incident",
+			})
+			if err != nil {
+				log.Printf("[incidents] Failed to alert %s about incident %d: %v", r.Email, i.ID, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,66 @@
+package incidents
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/server/internal/database"
+)
+
+func TestMapsLink(t *testing.T) {
+	lat, lng := 28.5449, 77.1926
+	if got := MapsLink(database.IncidentLocation{Latitude: &lat, Longitude: &lng}); got != "https://www.google.com/maps?q=28.544900,77.192600" {
+		t.Errorf("MapsLink = %q", got)
+	}
+	if got := MapsLink(database.IncidentLocation{Latitude: &lat}); got != "" {
+		t.Errorf("MapsLink without longitude = %q, want empty", got)
+	}
+}
+
+func TestFormatAlert(t *testing.T) {
+	billID := 42
+	name, phone := "Asha", "9876543210"
+	driver, reg := "Ravi", "DL01AB1234"
+	from, to := "Hostel", "Library"
+	text := "Near gate 3"
+	lat, lng := 28.5449, 77.1926
+	occurred := time.Date(2025, 3, 10, 9, 30, 0, 0, time.UTC)
+
+	incident := &database.Incident{
+		ID:                  7,
+		Kind:                database.IncidentSOS,
+		RideBillID:          &billID,
+		ReporterName:        &name,
+		ReporterPhone:       &phone,
+		DriverName:          &driver,
+		VehicleRegistration: &reg,
+		FromLocation:        &from,
+		ToLocation:          &to,
+		Severity:            "critical",
+		Location:            database.IncidentLocation{Latitude: &lat, Longitude: &lng, Text: &text, OccurredAt: &occurred},
+	}
+
+	subject, body := FormatAlert(incident)
+	if subject != "[CRITICAL] SOS #7 on ride #42" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{
+		"Reported by: Asha (9876543210)",
+		"Route: Hostel → Library",
+		"Driver: Ravi",
+		"Vehicle: DL01AB1234",
+		"Location: Near gate 3",
+		"Time: 10 Mar 2025 15:00 IST",
+		"maps?q=28.544900,77.192600",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body missing %q:\n%s", want, body)
+		}
+	}
+
+	_, body = FormatAlert(&database.Incident{ID: 8, Kind: database.IncidentReport, Severity: "low", CreatedAt: occurred})
+	if strings.Contains(body, "Driver:") || strings.Contains(body, "Map:") {
+		t.Errorf("body should omit unknown fields:\n%s", body)
+	}
+}
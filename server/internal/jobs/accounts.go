@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/server/internal/auth"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+// RegisterAccounts registers the job that expires student accounts
+func RegisterAccounts() {
+	Register(Job{
+		Name:        "expire_student_accounts",
+		Description: "Moves students past their expiry date to the expired status and ends their sessions",
+		Schedule:    "5 0 * * *",
+		Run:         expireStudentAccounts,
+	})
+}
+
+// expireStudentAccounts expires the students whose expiry date has passed.
+// Their sessions already stop working at the end of the expiry date; ending
+// them here also clears them from the sessions list.
+func expireStudentAccounts(ctx context.Context) (string, error) {
+	ids, err := database.ExpireStudentAccounts(ctx, clock.Today())
+	if err != nil {
+		return "", err
+	}
+
+	failed := 0
+	for _, id := range ids {
+		if err := auth.RevokeUserSessions(ctx, id, ""); err != nil {
+			log.Printf("[jobs] Failed to end sessions of expired user %d: %v", id, err)
+			failed++
+		}
+	}
+	summary := fmt.Sprintf("expired %d students", len(ids))
+	if failed > 0 {
+		return summary, fmt.Errorf("ending the sessions of %d expired students failed", failed)
+	}
+	return summary, nil
+}
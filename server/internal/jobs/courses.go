@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/server/internal/books"
+	"github.com/server/internal/enrollments"
+)
+
+// RegisterCourses registers the jobs that convert course books and process
+// expiring enrollments and waitlists
+func RegisterCourses() {
+	Register(Job{
+		Name:        books.ConverterJob,
+		Description: "Converts course books to their accessible formats; also run as soon as a book is queued",
+		Schedule:    "*/5 * * * *",
+		Timeout:     time.Hour,
+		// Failed books are recorded per format and retried by admins
+		Attempts: 1,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := books.Run(ctx)
+			return fmt.Sprintf("converted %d books", n), err
+		},
+	})
+	Register(Job{
+		Name:        "process_enrollments",
+		Description: "Reminds students of expiring enrollments, expires enrollments and promotes waitlisted students",
+		Schedule:    "*/15 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			reminded, expired := enrollments.ProcessExpiries(ctx)
+			err := enrollments.PromoteAll(ctx)
+			return fmt.Sprintf("reminded %d and expired %d enrollments", reminded, expired), err
+		},
+	})
+}
@@ -0,0 +1,343 @@
+// Package jobs runs background jobs on cron schedules. A lease in the
+// job_states table makes sure only one server instance runs a job at a time,
+// failed attempts are retried with backoff, and every attempt is recorded in
+// job_runs. Attempts left running by an instance that stopped are marked
+// failed when the lease is taken again.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+const (
+	// pollInterval is how often each instance looks for due jobs
+	pollInterval = 30 * time.Second
+	// defaultTimeout bounds one attempt of a job without its own timeout
+	defaultTimeout = 5 * time.Minute
+	// defaultAttempts is how often a failing run is tried
+	defaultAttempts = 3
+	// retryBackoff is the wait before the first retry; it doubles each retry
+	retryBackoff = 30 * time.Second
+	maxBackoff   = 10 * time.Minute
+	// leaseMargin is added to the longest a run can take so the lease never
+	// runs out under a run that is still going
+	leaseMargin = time.Minute
+)
+
+var (
+	ErrUnknownJob = errors.New("job not found")
+	ErrJobRunning = errors.New("job is already running")
+)
+
+// Func does the work of a job and returns a short summary of what it did
+type Func func(ctx context.Context) (string, error)
+
+// Job is a background job
+type Job struct {
+	Name        string
+	Description string
+	Schedule    string        // Cron expression, see ParseSchedule
+	Timeout     time.Duration // Per attempt; defaults to 5 minutes
+	Attempts    int           // Tries per run; defaults to 3
+	Run         Func
+
+	schedule *Schedule
+}
+
+// Status is a job with its shared schedule state
+type Status struct {
+	Job   *Job
+	State *database.JobState // Nil until the scheduler first starts
+}
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]*Job{}
+	baseCtx  = context.Background()
+	// instance identifies this server instance as a lease owner
+	instance = instanceID()
+)
+
+func instanceID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+}
+
+// Register adds a job. It panics on an invalid or duplicate job, since jobs
+// are registered once at startup.
+func Register(job Job) {
+	schedule, err := ParseSchedule(job.Schedule)
+	if err != nil {
+		panic(fmt.Sprintf("jobs: %s: %v", job.Name, err))
+	}
+	if job.Name == "" || job.Run == nil {
+		panic("jobs: a job needs a name and a Run function")
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = defaultTimeout
+	}
+	if job.Attempts <= 0 {
+		job.Attempts = defaultAttempts
+	}
+	job.schedule = schedule
+
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := registry[job.Name]; ok {
+		panic(fmt.Sprintf("jobs: %s registered twice", job.Name))
+	}
+	registry[job.Name] = &job
+}
+
+// lookup returns a registered job
+func lookup(name string) (*Job, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	job, ok := registry[name]
+	if !ok {
+		return nil, ErrUnknownJob
+	}
+	return job, nil
+}
+
+// registered returns the registered jobs sorted by name
+func registered() []*Job {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*Job, 0, len(registry))
+	for _, job := range registry {
+		list = append(list, job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// backoff is the wait after a failed attempt before the next one
+func backoff(attempt int) time.Duration {
+	d := retryBackoff << uint(attempt-1)
+	if d <= 0 || d > maxBackoff {
+		return maxBackoff
+	}
+	return d
+}
+
+// leaseFor is how long a run of the job can take with all its retries
+func leaseFor(job *Job) time.Duration {
+	lease := time.Duration(job.Attempts)*job.Timeout + leaseMargin
+	for attempt := 1; attempt < job.Attempts; attempt++ {
+		lease += backoff(attempt)
+	}
+	return lease
+}
+
+// Start starts a background loop that runs registered jobs when they are due
+func Start(ctx context.Context) {
+	mu.Lock()
+	baseCtx = ctx
+	mu.Unlock()
+
+	go func() {
+		ensureStates(ctx)
+
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for {
+			runDue(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// ensureStates creates the state rows of registered jobs
+func ensureStates(ctx context.Context) {
+	now := clock.Now()
+	for _, job := range registered() {
+		stateCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		if err := database.EnsureJobState(stateCtx, job.Name, job.Schedule, job.schedule.Next(now)); err != nil {
+			log.Printf("[jobs] Failed to set up %s: %v", job.Name, err)
+		}
+		cancel()
+	}
+}
+
+// runDue starts every job whose next run is due and whose lease this
+// instance wins
+func runDue(ctx context.Context) {
+	now := clock.Now()
+	for _, job := range registered() {
+		if ctx.Err() != nil {
+			return
+		}
+		claimCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		claimed, err := database.ClaimDueJob(claimCtx, job.Name, instance, leaseFor(job), job.schedule.Next(now))
+		cancel()
+		if err != nil {
+			log.Printf("[jobs] Failed to claim %s: %v", job.Name, err)
+			continue
+		}
+		if claimed {
+			go execute(ctx, job, "scheduled", nil)
+		}
+	}
+}
+
+// Trigger runs a job now, in the background, unless it is already running.
+// Paused jobs can be triggered.
+func Trigger(ctx context.Context, name string, triggeredBy int) error {
+	job, err := lookup(name)
+	if err != nil {
+		return err
+	}
+	if err := database.EnsureJobState(ctx, job.Name, job.Schedule, job.schedule.Next(clock.Now())); err != nil {
+		return err
+	}
+	claimed, err := database.ClaimJob(ctx, job.Name, instance, leaseFor(job))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return ErrJobRunning
+	}
+
+	mu.RLock()
+	runCtx := baseCtx
+	mu.RUnlock()
+	go execute(runCtx, job, "manual", &triggeredBy)
+	return nil
+}
+
+// execute runs a job whose lease this instance holds, retrying failed
+// attempts, and releases the lease afterwards
+func execute(ctx context.Context, job *Job, trigger string, triggeredBy *int) {
+	status := database.JobRunFailed
+	for attempt := 1; attempt <= job.Attempts; attempt++ {
+		if attempt > 1 && !sleep(ctx, backoff(attempt-1)) {
+			break // Shutting down
+		}
+		if err := runAttempt(ctx, job, trigger, attempt, triggeredBy); err != nil {
+			log.Printf("[jobs] %s attempt %d/%d failed: %v", job.Name, attempt, job.Attempts, err)
+			continue
+		}
+		status = database.JobRunSucceeded
+		break
+	}
+
+	// The run's context may be cancelled by shutdown; the lease must still go
+	releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := database.ReleaseJob(releaseCtx, job.Name, instance, status); err != nil {
+		log.Printf("[jobs] Failed to release %s: %v", job.Name, err)
+	}
+}
+
+// sleep waits for d, returning false if ctx is done first
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// runAttempt runs one attempt of a job and records it in the run history
+func runAttempt(ctx context.Context, job *Job, trigger string, attempt int, triggeredBy *int) error {
+	recordCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	runID, err := database.StartJobRun(recordCtx, job.Name, trigger, attempt, instance, triggeredBy)
+	cancel()
+	if err != nil {
+		return fmt.Errorf("recording start: %w", err)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, job.Timeout)
+	result, runErr := safeRun(attemptCtx, job.Run)
+	cancel()
+
+	recordCtx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := database.FinishJobRun(recordCtx, runID, result, runErr); err != nil {
+		log.Printf("[jobs] Failed to record run %d of %s: %v", runID, job.Name, err)
+	}
+	if runErr == nil && result != "" {
+		log.Printf("[jobs] %s: %s", job.Name, result)
+	}
+	return runErr
+}
+
+// safeRun runs a job function, turning a panic into an error so one bad job
+// can't take the server down
+func safeRun(ctx context.Context, run Func) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run(ctx)
+}
+
+// List returns every registered job with its schedule state
+func List(ctx context.Context) ([]Status, error) {
+	states, err := database.GetJobStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs := registered()
+	list := make([]Status, 0, len(jobs))
+	for _, job := range jobs {
+		list = append(list, Status{Job: job, State: states[job.Name]})
+	}
+	return list, nil
+}
+
+// Get returns a registered job with its schedule state
+func Get(ctx context.Context, name string) (*Status, error) {
+	job, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	state, err := database.GetJobState(ctx, name)
+	if err != nil && err != database.ErrJobNotFound {
+		return nil, err
+	}
+	return &Status{Job: job, State: state}, nil
+}
+
+// SetPaused pauses or resumes the scheduled runs of a job. A run in
+// progress is not interrupted.
+func SetPaused(ctx context.Context, name string, paused bool, by int) (*Status, error) {
+	job, err := lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := database.EnsureJobState(ctx, job.Name, job.Schedule, job.schedule.Next(clock.Now())); err != nil {
+		return nil, err
+	}
+	state, err := database.SetJobPaused(ctx, name, paused, by)
+	if err != nil {
+		return nil, err
+	}
+	return &Status{Job: job, State: state}, nil
+}
@@ -0,0 +1,66 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/server/internal/auth"
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+const (
+	// sessionRetention keeps expired sessions this long for the login history
+	sessionRetention = 90 * 24 * time.Hour
+	// otpRetention keeps expired OTP codes this long for troubleshooting
+	otpRetention = 24 * time.Hour
+	// jobRunRetention keeps job run history this long
+	jobRunRetention = 90 * 24 * time.Hour
+	// purgeBatchSize is how many rows a purge deletes per statement
+	purgeBatchSize = 5000
+)
+
+// RegisterMaintenance registers the jobs that reconcile and purge sessions
+// and purge OTP codes and old job history
+func RegisterMaintenance() {
+	Register(Job{
+		Name:        "purge_expired_sessions",
+		Description: "Deletes sessions that expired more than 90 days ago",
+		Schedule:    "15 3 * * *",
+		Timeout:     30 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := database.PurgeExpiredSessions(ctx, clock.Now().Add(-sessionRetention), purgeBatchSize)
+			return fmt.Sprintf("deleted %d sessions", n), err
+		},
+	})
+	Register(Job{
+		Name:        "reconcile_sessions",
+		Description: "Brings the sessions table and per-user session sets in line with the sessions in Redis",
+		Schedule:    "*/15 * * * *",
+		Timeout:     10 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			result, err := auth.ReconcileSessions(ctx)
+			return result.String(), err
+		},
+	})
+	Register(Job{
+		Name:        "purge_expired_otps",
+		Description: "Deletes OTP codes that expired more than a day ago",
+		Schedule:    "45 * * * *",
+		Timeout:     15 * time.Minute,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := database.PurgeExpiredOTPs(ctx, clock.Now().Add(-otpRetention), purgeBatchSize)
+			return fmt.Sprintf("deleted %d OTP codes", n), err
+		},
+	})
+	Register(Job{
+		Name:        "purge_job_runs",
+		Description: "Deletes job run history older than 90 days",
+		Schedule:    "30 4 * * 0",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := database.PurgeJobRuns(ctx, clock.Now().Add(-jobRunRetention), purgeBatchSize)
+			return fmt.Sprintf("deleted %d job runs", n), err
+		},
+	})
+}
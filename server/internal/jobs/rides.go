@@ -0,0 +1,36 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/server/internal/bookings"
+	"github.com/server/internal/dispatch"
+)
+
+// RegisterRides registers the jobs that book recurring rides and dispatch
+// rides to drivers
+func RegisterRides() {
+	Register(Job{
+		Name:        "book_recurring_rides",
+		Description: "Books the upcoming rides of every active ride series up to the booking horizon",
+		Schedule:    "0 * * * *",
+		Run: func(ctx context.Context) (string, error) {
+			n, err := bookings.MaterializeAll(ctx)
+			return fmt.Sprintf("booked %d rides", n), err
+		},
+	})
+	Register(Job{
+		Name:        "dispatch_rides",
+		Description: "Offers due rides to drivers and re-offers rides whose offer timed out",
+		Schedule:    "* * * * *",
+		Timeout:     time.Minute,
+		// The next run is at most a minute away
+		Attempts: 1,
+		Run: func(ctx context.Context) (string, error) {
+			n, err := dispatch.Run(ctx)
+			return fmt.Sprintf("offered %d rides", n), err
+		},
+	})
+}
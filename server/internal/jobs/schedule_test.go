@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 * * * *", false},
+		{"30 2 * * 1-5", false},
+		{"0 9,17 1 */3 *", false},
+		{"5/10 * * * 7", false},
+		{"@daily", false},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"5-1 * * * *", true},
+		{"*/0 * * * *", true},
+		{"a * * * *", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			if _, err := ParseSchedule(tt.expr); (err != nil) != tt.wantErr {
+				t.Errorf("ParseSchedule(%q) error = %v, want error %v", tt.expr, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	loc := clock.Location()
+	at := func(value string) time.Time {
+		t, _ := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		return t
+	}
+
+	tests := []struct {
+		expr  string
+		after string
+		want  string
+	}{
+		{"*/15 * * * *", "2026-03-10 10:07", "2026-03-10 10:15"},
+		{"*/15 * * * *", "2026-03-10 10:15", "2026-03-10 10:30"},
+		{"15 3 * * *", "2026-03-10 10:07", "2026-03-11 03:15"},
+		{"45 * * * *", "2026-03-10 23:50", "2026-03-11 00:45"},
+		{"30 4 * * 0", "2026-03-10 10:00", "2026-03-15 04:30"}, // Next Sunday
+		{"0 0 1 * *", "2026-12-15 00:00", "2027-01-01 00:00"},
+		{"0 9 13 * 5", "2026-03-10 10:00", "2026-03-13 09:00"}, // 13th or Friday
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"@hourly", "2026-03-10 10:30", "2026-03-10 11:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+" after "+tt.after, func(t *testing.T) {
+			s, err := ParseSchedule(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := s.Next(at(tt.after)); !got.Equal(at(tt.want)) {
+				t.Errorf("Next(%s) = %s, want %s", tt.after, got.Format("2006-01-02 15:04"), tt.want)
+			}
+		})
+	}
+
+	never, _ := ParseSchedule("0 0 30 2 *")
+	if got := never.Next(at("2026-01-01 00:00")); !got.IsZero() {
+		t.Errorf("Next() of 30 February = %v, want zero time", got)
+	}
+}
+
+func TestLeaseCoversRetries(t *testing.T) {
+	job := &Job{Timeout: 5 * time.Minute, Attempts: 3}
+	// 3 attempts of 5 minutes, 30s and 1m backoff, 1m margin
+	if got, want := leaseFor(job), 17*time.Minute+30*time.Second; got != want {
+		t.Errorf("leaseFor() = %v, want %v", got, want)
+	}
+	if got := backoff(10); got != maxBackoff {
+		t.Errorf("backoff(10) = %v, want the %v cap", got, maxBackoff)
+	}
+}
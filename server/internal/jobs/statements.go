@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"time"
+
+	"github.com/server/internal/statements"
+)
+
+// RegisterStatements registers the month-end statement job
+func RegisterStatements() {
+	Register(Job{
+		Name:        "month_end_statements",
+		Description: "Generates and emails every student's statement for the previous month",
+		// Hourly through the first week, so a run missed or interrupted while
+		// the servers were down is caught up
+		Schedule: "0 * 1-7 * *",
+		Timeout:  6 * time.Hour,
+		// An interrupted run is resumed by the next hourly run
+		Attempts: 1,
+		Run:      statements.RunMonthEnd,
+	})
+}
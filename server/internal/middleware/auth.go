@@ -10,8 +10,8 @@ import (
 	"github.com/server/internal/database"
 )
 
-// getSessionID extracts session ID from cookie or Authorization header
-func getSessionID(c *fiber.Ctx) string {
+// requestSessionID extracts session ID from cookie or Authorization header
+func requestSessionID(c *fiber.Ctx) string {
 	// First, try cookie
 	sessionID := c.Cookies("session_id")
 	if sessionID != "" {
@@ -27,11 +27,42 @@ func getSessionID(c *fiber.Ctx) string {
 	return ""
 }
 
+// touchSession records activity on a session in the background. It works on
+// a copy, since the handler reads the session while the refresh runs.
+func touchSession(sessionID string, session *auth.Session) {
+	touched := *session
+	go func() {
+		ctx, cancel := database.DefaultTimeout()
+		defer cancel()
+		if err := auth.Touch(ctx, sessionID, &touched); err != nil {
+			log.Printf("[Auth] Failed to refresh session: %v", err)
+		}
+	}()
+}
+
+// sessionCheckFailed responds to a session that can't be used any more. The
+// code tells clients why, such as a suspended or expired account. Errors
+// without a code mean the session couldn't be checked, not that it is bad,
+// so clients are told to retry instead of being logged out.
+func sessionCheckFailed(c *fiber.Ctx, err error) error {
+	code := auth.ErrorCode(err)
+	if code == "" {
+		log.Printf("[Auth] Failed to check session: %v", err)
+		return c.Status(503).JSON(fiber.Map{
+			"error": "session check unavailable, please retry",
+		})
+	}
+	return c.Status(401).JSON(fiber.Map{
+		"error": "unauthorized",
+		"code":  code,
+	})
+}
+
 // RequireAuth middleware checks if the user is authenticated
 func RequireAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get session ID from cookie or Authorization header
-		sessionID := getSessionID(c)
+		sessionID := requestSessionID(c)
 
 		// Debug: log auth info
 		log.Printf("[Auth] Path: %s, SessionID: %q (from cookie or bearer)",
@@ -54,15 +85,18 @@ func RequireAuth() fiber.Handler {
 			})
 		}
 
-		// Update last active timestamp in database (non-blocking)
-		go func() {
-			updateCtx, cancel := database.DefaultTimeout()
-			defer cancel()
-			_ = database.UpdateSessionLastActive(updateCtx, sessionID)
-		}()
+		// Pick up role changes and revocations made since the session was read
+		session, err = auth.CheckSession(ctx, sessionID, session)
+		if err != nil {
+			return sessionCheckFailed(c, err)
+		}
+
+		// Extend the session on activity (non-blocking)
+		touchSession(sessionID, session)
 
 		// Store session in context
 		c.Locals("session", session)
+		c.Locals("sessionID", sessionID)
 		c.Locals("userID", session.UserID)
 		c.Locals("userRole", session.Role)
 
@@ -75,7 +109,7 @@ func RequireAuth() fiber.Handler {
 func RequireRole(roles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get session ID from cookie or Authorization header
-		sessionID := getSessionID(c)
+		sessionID := requestSessionID(c)
 
 		log.Printf("[Auth] RequireRole - Path: %s, SessionID: %q", c.Path(), sessionID)
 
@@ -97,15 +131,18 @@ func RequireRole(roles ...string) fiber.Handler {
 			})
 		}
 
-		// Update last active timestamp in database (non-blocking)
-		go func() {
-			updateCtx, cancel := database.DefaultTimeout()
-			defer cancel()
-			_ = database.UpdateSessionLastActive(updateCtx, sessionID)
-		}()
+		// Pick up role changes and revocations made since the session was read
+		session, err = auth.CheckSession(ctx, sessionID, session)
+		if err != nil {
+			return sessionCheckFailed(c, err)
+		}
+
+		// Extend the session on activity (non-blocking)
+		touchSession(sessionID, session)
 
 		// Store session in context
 		c.Locals("session", session)
+		c.Locals("sessionID", sessionID)
 		c.Locals("userID", session.UserID)
 		c.Locals("userRole", session.Role)
 
@@ -123,6 +160,15 @@ func RequireRole(roles ...string) fiber.Handler {
 	}
 }
 
+// GetSessionID returns the ID of the current session, from the context on
+// authenticated routes or else from the cookie or Authorization header
+func GetSessionID(c *fiber.Ctx) string {
+	if sessionID, ok := c.Locals("sessionID").(string); ok {
+		return sessionID
+	}
+	return requestSessionID(c)
+}
+
 // GetSession retrieves the session from the context
 func GetSession(c *fiber.Ctx) *auth.Session {
 	if session, ok := c.Locals("session").(*auth.Session); ok {
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"errors"
 	"io"
 	"net/http/httptest"
 	"strings"
@@ -283,3 +284,83 @@ func TestRoleCaseInsensitiveComparison(t *testing.T) {
 	}
 }
 
+
+func TestGetSessionIDFromRequest(t *testing.T) {
+	app := fiber.New()
+	app.Get("/session-id", func(c *fiber.Ctx) error {
+		return c.SendString(GetSessionID(c))
+	})
+	app.Get("/stored", func(c *fiber.Ctx) error {
+		c.Locals("sessionID", "from-context")
+		return c.SendString(GetSessionID(c))
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		value  string
+		want   string
+	}{
+		{"cookie", "/session-id", "Cookie", "session_id=from-cookie", "from-cookie"},
+		{"bearer token", "/session-id", "Authorization", "Bearer from-bearer", "from-bearer"},
+		{"none", "/session-id", "", "", ""},
+		{"authenticated route", "/stored", "Authorization", "Bearer from-bearer", "from-context"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tt.want {
+				t.Errorf("Expected session ID %q, got %q", tt.want, string(body))
+			}
+		})
+	}
+}
+
+func TestSessionCheckFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"revoked session", auth.ErrSessionRevoked, 401, "session_revoked"},
+		{"suspended account", auth.ErrAccountSuspended, 401, "account_suspended"},
+		{"store unavailable", errors.New("connection refused"), 503, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return sessionCheckFailed(c, tt.err)
+			})
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/test", nil))
+			if err != nil {
+				t.Fatalf("Failed to test: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if hasCode := strings.Contains(string(body), `"code"`); hasCode != (tt.code != "") ||
+				(tt.code != "" && !strings.Contains(string(body), tt.code)) {
+				t.Errorf("body = %s, want code %q", body, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"event":"payment.captured"}`)
+	secret := "webhook_secret"
+	signature := Sign(payload, secret)
+
+	tests := []struct {
+		name      string
+		payload   []byte
+		signature string
+		secret    string
+		expected  bool
+	}{
+		{"valid signature", payload, signature, secret, true},
+		{"wrong secret", payload, signature, "other_secret", false},
+		{"tampered payload", []byte(`{"event":"payment.failed"}`), signature, secret, false},
+		{"empty signature", payload, "", secret, false},
+		{"non-hex signature", payload, "not-hex", secret, false},
+		{"empty secret", payload, Sign(payload, ""), "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := VerifySignature(tt.payload, tt.signature, tt.secret); result != tt.expected {
+				t.Errorf("VerifySignature() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMinorUnits(t *testing.T) {
+	tests := []struct {
+		amount float64
+		minor  int64
+	}{
+		{0, 0},
+		{1, 100},
+		{99.99, 9999},
+		{0.1 + 0.2, 30},
+		{150.5, 15050},
+	}
+
+	for _, tt := range tests {
+		if result := ToMinorUnits(tt.amount); result != tt.minor {
+			t.Errorf("ToMinorUnits(%v) = %d, want %d", tt.amount, result, tt.minor)
+		}
+	}
+
+	if result := FromMinorUnits(15050); result != 150.5 {
+		t.Errorf("FromMinorUnits(15050) = %v, want 150.5", result)
+	}
+}
+
+func TestNormalizeMethod(t *testing.T) {
+	tests := map[string]string{
+		"upi":        "upi",
+		"card":       "card",
+		"emi":        "card",
+		"netbanking": "bank_transfer",
+		"wallet":     "other",
+		"":           "other",
+	}
+
+	for method, expected := range tests {
+		if result := NormalizeMethod(method); result != expected {
+			t.Errorf("NormalizeMethod(%q) = %q, want %q", method, result, expected)
+		}
+	}
+}
+
+func TestRazorpayCreateOrder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "key_id" || pass != "key_secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"Authentication failed"}}`))
+			return
+		}
+		if r.URL.Path != "/orders" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if body["amount"] != float64(12550) || body["receipt"] != "ride_bill_7" {
+			t.Errorf("Unexpected order request body: %v", body)
+		}
+
+		_, _ = w.Write([]byte(`{"id":"order_123","amount":12550,"currency":"INR","status":"created"}`))
+	}))
+	defer server.Close()
+
+	provider := NewRazorpayProvider("key_id", "key_secret", "webhook_secret")
+	provider.baseURL = server.URL
+
+	order, err := provider.CreateOrder(context.Background(), OrderRequest{
+		RideBillID: 7,
+		Amount:     125.5,
+		Currency:   "INR",
+		Receipt:    "ride_bill_7",
+	})
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+	if order.ID != "order_123" || order.Amount != 125.5 || order.Status != "created" {
+		t.Errorf("Unexpected order: %+v", order)
+	}
+
+	badProvider := NewRazorpayProvider("key_id", "wrong", "webhook_secret")
+	badProvider.baseURL = server.URL
+	if _, err := badProvider.CreateOrder(context.Background(), OrderRequest{Amount: 1, Currency: "INR"}); err == nil {
+		t.Error("Expected error for rejected credentials")
+	}
+}
+
+func TestRazorpayParseWebhook(t *testing.T) {
+	provider := NewRazorpayProvider("key_id", "key_secret", "webhook_secret")
+	body := []byte(`{"event":"payment.captured","payload":{"payment":{"entity":{"id":"pay_1","order_id":"order_1","amount":5000,"currency":"INR","method":"netbanking"}}}}`)
+
+	headers := map[string]string{
+		RazorpaySignatureHeader: Sign(body, "webhook_secret"),
+		RazorpayEventIDHeader:   "evt_1",
+	}
+	event, err := provider.ParseWebhook(body, func(name string) string { return headers[name] })
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if event.ID != "evt_1" || event.Type != EventPaymentCaptured || event.OrderID != "order_1" ||
+		event.PaymentID != "pay_1" || event.Amount != 50 || event.Method != "bank_transfer" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	headers[RazorpaySignatureHeader] = Sign(body, "wrong_secret")
+	if _, err := provider.ParseWebhook(body, func(name string) string { return headers[name] }); err != ErrInvalidSignature {
+		t.Errorf("ParseWebhook() error = %v, want %v", err, ErrInvalidSignature)
+	}
+
+	garbage := []byte(`not json`)
+	headers[RazorpaySignatureHeader] = Sign(garbage, "webhook_secret")
+	if _, err := provider.ParseWebhook(garbage, func(name string) string { return headers[name] }); err != ErrInvalidPayload {
+		t.Errorf("ParseWebhook() error = %v, want %v", err, ErrInvalidPayload)
+	}
+}
+
+func TestFakeProviderRoundTrip(t *testing.T) {
+	fake := NewFakeProvider("secret")
+
+	order, err := fake.CreateOrder(context.Background(), OrderRequest{RideBillID: 1, Amount: 80, Currency: "INR"})
+	if err != nil {
+		t.Fatalf("CreateOrder() error = %v", err)
+	}
+	if _, ok := fake.GetOrder(order.ID); !ok {
+		t.Fatal("Expected order to be stored")
+	}
+
+	body, headers, err := fake.BuildWebhook(EventPaymentCaptured, order.ID, "upi", order.Amount)
+	if err != nil {
+		t.Fatalf("BuildWebhook() error = %v", err)
+	}
+
+	event, err := fake.ParseWebhook(body, func(name string) string { return headers[name] })
+	if err != nil {
+		t.Fatalf("ParseWebhook() error = %v", err)
+	}
+	if event.OrderID != order.ID || event.Amount != 80 || event.Method != "upi" || event.ID == "" {
+		t.Errorf("Unexpected event: %+v", event)
+	}
+
+	if _, err := fake.CreateOrder(context.Background(), OrderRequest{Amount: 0}); err == nil {
+		t.Error("Expected error for zero amount order")
+	}
+}
+
+func TestInit(t *testing.T) {
+	defer SetProvider(nil)
+
+	if err := Init("", "", "", ""); err != nil || GetProvider() != nil {
+		t.Errorf("Expected payments to be disabled, got provider=%v err=%v", GetProvider(), err)
+	}
+	if err := Init("fake", "", "", ""); err == nil {
+		t.Error("Expected error for fake provider without a webhook secret")
+	}
+	if err := Init("fake", "", "", "webhook"); err != nil || GetProvider().Name() != "fake" {
+		t.Errorf("Expected fake provider, got err=%v", err)
+	}
+	if err := Init("razorpay", "key", "", ""); err == nil {
+		t.Error("Expected error for incomplete razorpay configuration")
+	}
+	if err := Init("razorpay", "key", "secret", "webhook"); err != nil || GetProvider().Name() != "razorpay" {
+		t.Errorf("Expected razorpay provider, got err=%v", err)
+	}
+	if err := Init("stripe", "", "", ""); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
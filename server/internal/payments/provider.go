@@ -0,0 +1,124 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidPayload   = errors.New("invalid webhook payload")
+	ErrNotConfigured    = errors.New("payment provider is not configured")
+)
+
+// Webhook event types understood by the server
+const (
+	EventPaymentCaptured = "payment.captured"
+	EventPaymentFailed   = "payment.failed"
+)
+
+// OrderRequest describes a payment order to create with the provider
+type OrderRequest struct {
+	RideBillID int
+	Amount     float64 // In major currency units (e.g. rupees)
+	Currency   string
+	Receipt    string
+	Notes      map[string]string
+}
+
+// Order is a payment order created with the provider
+type Order struct {
+	ID       string
+	Amount   float64
+	Currency string
+	Status   string
+}
+
+// WebhookEvent is a verified, provider-independent webhook notification
+type WebhookEvent struct {
+	ID        string // Provider event ID, used for idempotency
+	Type      string
+	OrderID   string
+	PaymentID string
+	Amount    float64
+	Currency  string
+	Method    string // Normalized to one of the ledger payment methods
+	Raw       []byte
+}
+
+// PaymentProvider is implemented by online payment gateways
+type PaymentProvider interface {
+	// Name returns the provider identifier stored with orders and events
+	Name() string
+	// PublicKey returns the key the client needs to open the provider checkout
+	PublicKey() string
+	// CreateOrder creates a payment order with the provider
+	CreateOrder(ctx context.Context, req OrderRequest) (*Order, error)
+	// ParseWebhook verifies the webhook signature and parses the event.
+	// header returns the value of the named request header.
+	ParseWebhook(body []byte, header func(string) string) (*WebhookEvent, error)
+}
+
+var provider PaymentProvider
+
+// GetProvider returns the configured payment provider, or nil when online payments are disabled
+func GetProvider() PaymentProvider {
+	return provider
+}
+
+// SetProvider replaces the configured payment provider
+func SetProvider(p PaymentProvider) {
+	provider = p
+}
+
+// Init configures the payment provider by name
+func Init(name, keyID, keySecret, webhookSecret string) error {
+	switch name {
+	case "":
+		provider = nil
+		log.Println("[payments] Online payments disabled (PAYMENT_PROVIDER not set)")
+		return nil
+	case "razorpay":
+		if keyID == "" || keySecret == "" || webhookSecret == "" {
+			return fmt.Errorf("razorpay requires RAZORPAY_KEY_ID, RAZORPAY_KEY_SECRET and RAZORPAY_WEBHOOK_SECRET")
+		}
+		provider = NewRazorpayProvider(keyID, keySecret, webhookSecret)
+	case "fake":
+		if webhookSecret == "" {
+			return fmt.Errorf("the fake provider requires FAKE_PAYMENT_WEBHOOK_SECRET")
+		}
+		provider = NewFakeProvider(webhookSecret)
+	default:
+		return fmt.Errorf("unknown payment provider %q", name)
+	}
+
+	log.Printf("✅ Payment provider configured: %s", provider.Name())
+	return nil
+}
+
+// ToMinorUnits converts an amount in major units to the smallest currency unit
+func ToMinorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromMinorUnits converts an amount in the smallest currency unit to major units
+func FromMinorUnits(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// NormalizeMethod maps a gateway payment method to a ledger payment method
+func NormalizeMethod(method string) string {
+	switch method {
+	case "upi":
+		return "upi"
+	case "card", "emi":
+		return "card"
+	case "netbanking", "bank_transfer":
+		return "bank_transfer"
+	default:
+		return "other"
+	}
+}
@@ -0,0 +1,169 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const razorpayBaseURL = "https://api.razorpay.com/v1"
+
+// Razorpay webhook headers
+const (
+	RazorpaySignatureHeader = "X-Razorpay-Signature"
+	RazorpayEventIDHeader   = "X-Razorpay-Event-Id"
+)
+
+// RazorpayProvider creates orders through the Razorpay Orders API and
+// verifies Razorpay webhooks
+type RazorpayProvider struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
+	httpClient    *http.Client
+}
+
+// NewRazorpayProvider creates a Razorpay provider
+func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvider {
+	return &RazorpayProvider{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		baseURL:       razorpayBaseURL,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// Name returns the provider identifier
+func (r *RazorpayProvider) Name() string {
+	return "razorpay"
+}
+
+// PublicKey returns the key ID used by Razorpay Checkout
+func (r *RazorpayProvider) PublicKey() string {
+	return r.keyID
+}
+
+type razorpayOrder struct {
+	ID       string `json:"id"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Status   string `json:"status"`
+}
+
+type razorpayError struct {
+	Error struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// CreateOrder creates a Razorpay order for the requested amount
+func (r *RazorpayProvider) CreateOrder(ctx context.Context, req OrderRequest) (*Order, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"amount":   ToMinorUnits(req.Amount),
+		"currency": req.Currency,
+		"receipt":  req.Receipt,
+		"notes":    req.Notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/orders", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.SetBasicAuth(r.keyID, r.keySecret)
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("razorpay: create order: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("razorpay: read response: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var apiErr razorpayError
+		if json.Unmarshal(respBody, &apiErr) == nil && apiErr.Error.Description != "" {
+			return nil, fmt.Errorf("razorpay: create order failed (%d): %s", resp.StatusCode, apiErr.Error.Description)
+		}
+		return nil, fmt.Errorf("razorpay: create order failed with status %d", resp.StatusCode)
+	}
+
+	var order razorpayOrder
+	if err := json.Unmarshal(respBody, &order); err != nil {
+		return nil, fmt.Errorf("razorpay: decode order: %w", err)
+	}
+
+	return &Order{
+		ID:       order.ID,
+		Amount:   FromMinorUnits(order.Amount),
+		Currency: order.Currency,
+		Status:   order.Status,
+	}, nil
+}
+
+type razorpayWebhook struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity struct {
+				ID       string `json:"id"`
+				OrderID  string `json:"order_id"`
+				Amount   int64  `json:"amount"`
+				Currency string `json:"currency"`
+				Method   string `json:"method"`
+			} `json:"entity"`
+		} `json:"payment"`
+	} `json:"payload"`
+}
+
+// ParseWebhook verifies the X-Razorpay-Signature header and parses the event
+func (r *RazorpayProvider) ParseWebhook(body []byte, header func(string) string) (*WebhookEvent, error) {
+	if !VerifySignature(body, header(RazorpaySignatureHeader), r.webhookSecret) {
+		return nil, ErrInvalidSignature
+	}
+	return parseRazorpayEvent(body, header(RazorpayEventIDHeader))
+}
+
+// parseRazorpayEvent converts a Razorpay webhook body to a WebhookEvent
+func parseRazorpayEvent(body []byte, eventID string) (*WebhookEvent, error) {
+	var hook razorpayWebhook
+	if err := json.Unmarshal(body, &hook); err != nil || hook.Event == "" {
+		return nil, ErrInvalidPayload
+	}
+
+	payment := hook.Payload.Payment.Entity
+	eventType := hook.Event
+	// order.paid is sent alongside payment.captured; both settle the order
+	if eventType == "order.paid" {
+		eventType = EventPaymentCaptured
+	}
+
+	if eventID == "" {
+		// Older webhook deliveries may not carry an event ID header
+		eventID = hook.Event + ":" + payment.ID
+	}
+
+	return &WebhookEvent{
+		ID:        eventID,
+		Type:      eventType,
+		OrderID:   payment.OrderID,
+		PaymentID: payment.ID,
+		Amount:    FromMinorUnits(payment.Amount),
+		Currency:  payment.Currency,
+		Method:    NormalizeMethod(payment.Method),
+		Raw:       body,
+	}, nil
+}
@@ -0,0 +1,338 @@
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// winAnsiHigh holds the characters of WinAnsiEncoding codes 0x80 to 0x9F.
+// Unused codes are zero.
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// macRomanHigh holds the characters of MacRomanEncoding codes 0x80 to 0xFF
+const macRomanHigh = "ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü" +
+	"†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø" +
+	"¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ" +
+	"‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ"
+
+// glyphNames lists the standard glyph names of WinAnsiEncoding codes 0x20
+// to 0x7E and 0x80 to 0xFF, used to resolve /Differences arrays
+var glyphNames = strings.Fields(`
+	space exclam quotedbl numbersign dollar percent ampersand quotesingle
+	parenleft parenright asterisk plus comma hyphen period slash
+	zero one two three four five six seven eight nine colon semicolon less equal greater question
+	at A B C D E F G H I J K L M N O P Q R S T U V W X Y Z
+	bracketleft backslash bracketright asciicircum underscore
+	grave a b c d e f g h i j k l m n o p q r s t u v w x y z
+	braceleft bar braceright asciitilde
+	Euro .notdef quotesinglbase florin quotedblbase ellipsis dagger daggerdbl
+	circumflex perthousand Scaron guilsinglleft OE .notdef Zcaron .notdef
+	.notdef quoteleft quoteright quotedblleft quotedblright bullet endash emdash
+	tilde trademark scaron guilsinglright oe .notdef zcaron Ydieresis
+	nbspace exclamdown cent sterling currency yen brokenbar section
+	dieresis copyright ordfeminine guillemotleft logicalnot sfthyphen registered macron
+	degree plusminus twosuperior threesuperior acute mu paragraph periodcentered
+	cedilla onesuperior ordmasculine guillemotright onequarter onehalf threequarters questiondown
+	Agrave Aacute Acircumflex Atilde Adieresis Aring AE Ccedilla
+	Egrave Eacute Ecircumflex Edieresis Igrave Iacute Icircumflex Idieresis
+	Eth Ntilde Ograve Oacute Ocircumflex Otilde Odieresis multiply
+	Oslash Ugrave Uacute Ucircumflex Udieresis Yacute Thorn germandbls
+	agrave aacute acircumflex atilde adieresis aring ae ccedilla
+	egrave eacute ecircumflex edieresis igrave iacute icircumflex idieresis
+	eth ntilde ograve oacute ocircumflex otilde odieresis divide
+	oslash ugrave uacute ucircumflex udieresis yacute thorn ydieresis
+`)
+
+// extraGlyphs are common glyph names outside WinAnsiEncoding
+var extraGlyphs = map[string]string{
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"minus": "−", "fraction": "⁄", "dotlessi": "ı", "Lslash": "Ł", "lslash": "ł",
+	"quoteleftreversed": "‛", "bulletoperator": "∙", "nbspace": " ",
+	"hyphentwo": "‐", "uni00A0": " ", "rupee": "₹", "rupeeindian": "₹",
+}
+
+// glyphRunes maps glyph names to the text they represent
+var glyphRunes = func() map[string]string {
+	m := make(map[string]string, len(glyphNames)+len(extraGlyphs))
+	for i, n := range glyphNames {
+		if n == ".notdef" {
+			continue
+		}
+		code := 0x20 + i
+		if i >= 0x7f-0x20 {
+			code = 0x80 + i - (0x7f - 0x20)
+		}
+		if s := decodeWinAnsi(byte(code)); s != 0 {
+			m[n] = string(s)
+		}
+	}
+	for n, s := range extraGlyphs {
+		m[n] = s
+	}
+	return m
+}()
+
+// decodeWinAnsi returns the character of a WinAnsiEncoding code, or 0
+func decodeWinAnsi(c byte) rune {
+	switch {
+	case c >= 0x80 && c < 0xa0:
+		return winAnsiHigh[c-0x80]
+	case c < 0x20 && c != '\t' && c != '\n' && c != '\r':
+		return 0
+	case c == 0x7f:
+		return 0
+	}
+	return rune(c)
+}
+
+// decodeMacRoman returns the character of a MacRomanEncoding code, or 0
+func decodeMacRoman(c byte) rune {
+	if c < 0x80 {
+		return decodeWinAnsi(c)
+	}
+	return []rune(macRomanHigh)[c-0x80]
+}
+
+// glyphText returns the text a glyph name represents, or "" if unknown.
+// Besides standard names it understands uniXXXX, uXXXX[XX], ligature names
+// joined with underscores and suffixed variants such as "a.sc".
+func glyphText(glyph string) string {
+	if s, ok := glyphRunes[glyph]; ok {
+		return s
+	}
+	if i := strings.IndexByte(glyph, '.'); i > 0 {
+		return glyphText(glyph[:i])
+	}
+	if strings.Contains(glyph, "_") {
+		var b strings.Builder
+		for _, part := range strings.Split(glyph, "_") {
+			s := glyphText(part)
+			if s == "" {
+				return ""
+			}
+			b.WriteString(s)
+		}
+		return b.String()
+	}
+	if hex, ok := strings.CutPrefix(glyph, "uni"); ok && len(hex) >= 4 && len(hex)%4 == 0 {
+		var units []uint16
+		for i := 0; i < len(hex); i += 4 {
+			v, err := strconv.ParseUint(hex[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(v))
+		}
+		return string(utf16.Decode(units))
+	}
+	if hex, ok := strings.CutPrefix(glyph, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if v, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(v)) {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+// decodeUTF16 decodes big-endian UTF-16 text
+func decodeUTF16(b []byte) string {
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// decodeTextString decodes a text string such as a document title, which is
+// either UTF-16 with a byte order mark, UTF-8 with one, or PDFDocEncoding
+func decodeTextString(s pdfString) string {
+	switch {
+	case bytes.HasPrefix(s, []byte{0xfe, 0xff}):
+		return decodeUTF16(s[2:])
+	case bytes.HasPrefix(s, []byte{0xef, 0xbb, 0xbf}):
+		return string(s[3:])
+	}
+	// PDFDocEncoding matches Latin-1 for printable text; its few
+	// differences are approximated with WinAnsiEncoding
+	var b strings.Builder
+	for _, c := range s {
+		if r := decodeWinAnsi(c); r != 0 {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// codeRange is a range of character codes of the same byte length
+type codeRange struct {
+	lo, hi []byte
+}
+
+// contains reports whether the leading bytes of s are a code in the range
+func (cr codeRange) contains(s []byte) bool {
+	if len(s) < len(cr.lo) {
+		return false
+	}
+	for i := range cr.lo {
+		if s[i] < cr.lo[i] || s[i] > cr.hi[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cmapRange maps a range of codes to consecutive text, or to a list of texts
+type cmapRange struct {
+	lo, hi uint32
+	size   int
+	dst    []byte   // UTF-16 text of lo, incremented for later codes
+	dsts   []string // Text of each code when mapped with an array
+}
+
+// cmap is a parsed CMap: the code space of a composite font's encoding and,
+// for ToUnicode CMaps, the text each code represents
+type cmap struct {
+	space  []codeRange
+	chars  map[string]string
+	ranges []cmapRange
+}
+
+// codeValue packs a code into an integer
+func codeValue(b []byte) uint32 {
+	var v uint32
+	for _, c := range b {
+		v = v<<8 | uint32(c)
+	}
+	return v
+}
+
+// parseCMap reads the code space and mappings of a CMap. Unknown operators
+// are skipped, so any CMap can be read for the parts we understand.
+func parseCMap(data []byte) *cmap {
+	m := &cmap{chars: make(map[string]string)}
+	l := &lexer{data: data}
+
+	var operands []interface{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			break
+		}
+		obj, err := l.object()
+		if err != nil {
+			l.pos++
+			operands = operands[:0]
+			continue
+		}
+		kw, ok := obj.(keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					m.space = append(m.space, codeRange{lo, hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m.chars[string(src)] = decodeUTF16(dst)
+				} else if n, ok := operands[i+1].(name); ok1 && ok {
+					m.chars[string(src)] = glyphText(string(n))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				cr := cmapRange{lo: codeValue(lo), hi: codeValue(hi), size: len(lo)}
+				if cr.hi < cr.lo {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					cr.dst = dst
+				case array:
+					for _, d := range dst {
+						s, _ := d.(pdfString)
+						cr.dsts = append(cr.dsts, decodeUTF16(s))
+					}
+				default:
+					continue
+				}
+				m.ranges = append(m.ranges, cr)
+			}
+		}
+		operands = operands[:0]
+	}
+	return m
+}
+
+// codeLength returns the byte length of the code at the start of s
+func (m *cmap) codeLength(s []byte, fallback int) int {
+	for _, cr := range m.space {
+		if cr.contains(s) {
+			return len(cr.lo)
+		}
+	}
+	// Codes outside the code space take the length of the shortest range
+	best := 0
+	for _, cr := range m.space {
+		if best == 0 || len(cr.lo) < best {
+			best = len(cr.lo)
+		}
+	}
+	if best == 0 {
+		best = fallback
+	}
+	if best > len(s) {
+		best = len(s)
+	}
+	return best
+}
+
+// lookup returns the text of a code
+func (m *cmap) lookup(code []byte) (string, bool) {
+	if s, ok := m.chars[string(code)]; ok {
+		return s, true
+	}
+	v := codeValue(code)
+	for _, cr := range m.ranges {
+		if cr.size != len(code) || v < cr.lo || v > cr.hi {
+			continue
+		}
+		offset := v - cr.lo
+		if cr.dsts != nil {
+			if int(offset) < len(cr.dsts) {
+				return cr.dsts[offset], true
+			}
+			return "", false
+		}
+		if len(cr.dst) < 2 {
+			return "", false
+		}
+		// Increment the last UTF-16 unit of the destination
+		dst := append([]byte(nil), cr.dst...)
+		last := uint32(dst[len(dst)-2])<<8 | uint32(dst[len(dst)-1])
+		last += offset
+		dst[len(dst)-2], dst[len(dst)-1] = byte(last>>8), byte(last)
+		return decodeUTF16(dst), true
+	}
+	return "", false
+}
@@ -0,0 +1,743 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrNoText is returned by Extract for documents without a usable text
+// layer, typically scanned pages or fonts without a Unicode mapping
+var ErrNoText = errors.New("pdf: document has no extractable text")
+
+// maxFormDepth limits how deeply nested form XObjects are followed
+const maxFormDepth = 8
+
+// maxHeadingLength is the longest line still treated as a heading
+const maxHeadingLength = 120
+
+// headingRatio is how much larger than body text a line must be set to be
+// treated as a heading
+const headingRatio = 1.08
+
+// Content is the text and structure extracted from a document
+type Content struct {
+	Title    string
+	Author   string
+	Language string // BCP 47 tag from the catalog, if any
+	Pages    []PageContent
+	Outline  []OutlineEntry // Bookmarks, in document order
+}
+
+// PageContent is the text of one page in reading order
+type PageContent struct {
+	Blocks []Block
+}
+
+// Block is a paragraph, list item or heading
+type Block struct {
+	Level    int  // 1 to 3 for headings, 0 for paragraphs and list items
+	ListItem bool // Started with a bullet, which is removed from Text
+	Text     string
+}
+
+// OutlineEntry is a document bookmark
+type OutlineEntry struct {
+	Title string
+	Level int // 1 for top-level bookmarks
+	Page  int // Index into Pages, or -1 when the target is unknown
+}
+
+// Extract reads the text of a document along with the structure that can be
+// recovered from it: headings inferred from font sizes, paragraphs inferred
+// from line spacing, and the bookmark outline. Text is read from the
+// content streams; scanned pages would need OCR and yield ErrNoText.
+func Extract(src []byte) (*Content, error) {
+	r, catalog, pages, err := openDocument(src)
+	if err != nil {
+		return nil, err
+	}
+
+	content := &Content{Pages: make([]PageContent, len(pages))}
+	if info, ok := r.resolve(r.trailer["Info"]).(dict); ok {
+		content.Title = cleanText(r.textString(info["Title"]))
+		content.Author = cleanText(r.textString(info["Author"]))
+	}
+	content.Language = strings.TrimSpace(r.textString(catalog["Lang"]))
+
+	e := &textExtractor{r: r, fonts: make(map[objRef]*textFont)}
+	pageLines := make([][]line, len(pages))
+	for i, p := range pages {
+		e.spans = e.spans[:0]
+		data := r.pageContents(p.dict["Contents"])
+		m, _, _ := displayTransform(p.box, p.rotate)
+		e.run(data, p.resources, gstate{ctm: matrix(m).inverse(), text: textState{scale: 1}}, 0)
+		pageLines[i] = buildLines(e.spans)
+	}
+
+	body, levels := fontSizes(pageLines)
+	letters := 0
+	for i, lines := range pageLines {
+		content.Pages[i].Blocks = buildBlocks(lines, body, levels)
+		for _, b := range content.Pages[i].Blocks {
+			for _, c := range b.Text {
+				if unicode.IsLetter(c) || unicode.IsDigit(c) {
+					letters++
+				}
+			}
+		}
+	}
+	if letters < 10*len(pages) {
+		return nil, ErrNoText
+	}
+
+	content.Outline = r.outline(catalog, pages)
+	return content, nil
+}
+
+// openDocument parses a document and its page tree
+func openDocument(src []byte) (*reader, dict, []page, error) {
+	r, err := newReader(src)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if _, ok := r.trailer["Encrypt"]; ok {
+		return nil, nil, nil, ErrEncrypted
+	}
+
+	catalog, ok := r.resolve(r.trailer["Root"]).(dict)
+	if !ok {
+		return nil, nil, nil, errors.New("pdf: document has no catalog")
+	}
+	var pages []page
+	if err := r.collectPages(catalog["Pages"], page{box: [4]float64{0, 0, A4Width, A4Height}}, 0, map[int]bool{}, &pages); err != nil {
+		return nil, nil, nil, err
+	}
+	if len(pages) == 0 {
+		return nil, nil, nil, errors.New("pdf: document has no pages")
+	}
+	return r, catalog, pages, nil
+}
+
+// textString reads a text string object
+func (r *reader) textString(obj interface{}) string {
+	s, _ := r.resolve(obj).(pdfString)
+	return decodeTextString(s)
+}
+
+// pageContents returns the decoded content streams of a page, concatenated.
+// Streams with unsupported filters are skipped.
+func (r *reader) pageContents(obj interface{}) []byte {
+	var refs array
+	switch c := r.resolve(obj).(type) {
+	case array:
+		refs = c
+	case *stream:
+		refs = array{c}
+	}
+
+	var out []byte
+	for _, ref := range refs {
+		st, ok := r.resolve(ref).(*stream)
+		if !ok {
+			continue
+		}
+		data, err := decodeStream(st)
+		if err != nil {
+			continue
+		}
+		out = append(out, data...)
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// matrix is an affine transformation [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the transformation m followed by n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// apply transforms a point
+func (m matrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// inverse returns the inverse transformation, or the identity when m is singular
+func (m matrix) inverse() matrix {
+	det := m[0]*m[3] - m[1]*m[2]
+	if det == 0 {
+		return identity
+	}
+	return matrix{
+		m[3] / det, -m[1] / det, -m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det,
+	}
+}
+
+// textState holds the text parameters of the graphics state
+type textState struct {
+	font      *textFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64 // Horizontal scaling, 1 = 100%
+	leading   float64
+	rise      float64
+}
+
+type gstate struct {
+	ctm  matrix
+	text textState
+}
+
+// span is a run of text shown at once, positioned on the displayed page
+type span struct {
+	x, y, endX float64
+	size       float64
+	text       string
+}
+
+// textExtractor interprets content streams, collecting the text they show
+type textExtractor struct {
+	r     *reader
+	fonts map[objRef]*textFont
+	spans []span
+}
+
+// font returns the font a resource dictionary names
+func (e *textExtractor) font(resources dict, key name) *textFont {
+	fonts, _ := e.r.resolve(resources["Font"]).(dict)
+	obj := fonts[key]
+	ref, isRef := obj.(objRef)
+	if isRef {
+		if f, ok := e.fonts[ref]; ok {
+			return f
+		}
+	}
+	f := e.r.loadFont(obj)
+	if isRef {
+		e.fonts[ref] = f
+	}
+	return f
+}
+
+// run interprets a content stream
+func (e *textExtractor) run(data []byte, resources dict, gs gstate, depth int) {
+	l := &lexer{data: data}
+	var (
+		stack    []gstate
+		operands []interface{}
+		tm, tlm  = identity, identity
+	)
+
+	numArg := func(i int) float64 {
+		if i < len(operands) {
+			v, _ := e.r.number(operands[i])
+			return v
+		}
+		return 0
+	}
+	moveLine := func(tx, ty float64) {
+		tlm = matrix{1, 0, 0, 1, tx, ty}.mul(tlm)
+		tm = tlm
+	}
+	show := func(s pdfString) {
+		ts := gs.text
+		if ts.font == nil {
+			ts.font = e.r.loadFont(nil)
+		}
+		trm := tm.mul(gs.ctm)
+		x, y := trm.apply(0, ts.rise)
+		size := ts.size * math.Hypot(trm[2], trm[3])
+
+		var b strings.Builder
+		for _, g := range ts.font.decode(s) {
+			b.WriteString(g.text)
+			tx := g.width / 1000 * ts.size
+			tx += ts.charSpace
+			if g.space {
+				tx += ts.wordSpace
+			}
+			tm = matrix{1, 0, 0, 1, tx * ts.scale, 0}.mul(tm)
+		}
+		endX, _ := tm.mul(gs.ctm).apply(0, ts.rise)
+		if b.Len() > 0 {
+			e.spans = append(e.spans, span{x: x, y: y, endX: endX, size: math.Abs(size), text: b.String()})
+		}
+	}
+
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return
+		}
+		obj, err := l.object()
+		if err != nil {
+			// Skip anything we can't parse, such as stray delimiters
+			l.pos++
+			operands = operands[:0]
+			continue
+		}
+		op, ok := obj.(keyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch op {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if len(operands) == 6 {
+				gs.ctm = matrix{numArg(0), numArg(1), numArg(2), numArg(3), numArg(4), numArg(5)}.mul(gs.ctm)
+			}
+		case "BT":
+			tm, tlm = identity, identity
+		case "Tf":
+			if len(operands) == 2 {
+				if key, ok := operands[0].(name); ok {
+					gs.text.font = e.font(resources, key)
+				}
+				gs.text.size = numArg(1)
+			}
+		case "Tc":
+			gs.text.charSpace = numArg(0)
+		case "Tw":
+			gs.text.wordSpace = numArg(0)
+		case "Tz":
+			gs.text.scale = numArg(0) / 100
+		case "TL":
+			gs.text.leading = numArg(0)
+		case "Ts":
+			gs.text.rise = numArg(0)
+		case "Td":
+			moveLine(numArg(0), numArg(1))
+		case "TD":
+			gs.text.leading = -numArg(1)
+			moveLine(numArg(0), numArg(1))
+		case "Tm":
+			if len(operands) == 6 {
+				tlm = matrix{numArg(0), numArg(1), numArg(2), numArg(3), numArg(4), numArg(5)}
+				tm = tlm
+			}
+		case "T*":
+			moveLine(0, -gs.text.leading)
+		case "Tj":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'", "\"":
+			moveLine(0, -gs.text.leading)
+			if op == "\"" && len(operands) == 3 {
+				gs.text.wordSpace = numArg(0)
+				gs.text.charSpace = numArg(1)
+			}
+			if len(operands) > 0 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				items, _ := operands[0].(array)
+				for _, item := range items {
+					if s, ok := item.(pdfString); ok {
+						show(s)
+						continue
+					}
+					if v, ok := e.r.number(item); ok {
+						tx := -v / 1000 * gs.text.size * gs.text.scale
+						tm = matrix{1, 0, 0, 1, tx, 0}.mul(tm)
+					}
+				}
+			}
+		case "Do":
+			if len(operands) > 0 && depth < maxFormDepth {
+				if key, ok := operands[0].(name); ok {
+					e.runForm(resources, key, gs, depth)
+				}
+			}
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+// runForm interprets a form XObject drawn with the Do operator
+func (e *textExtractor) runForm(resources dict, key name, gs gstate, depth int) {
+	xobjects, _ := e.r.resolve(resources["XObject"]).(dict)
+	st, ok := e.r.resolve(xobjects[key]).(*stream)
+	if !ok || st.dict["Subtype"] != name("Form") {
+		return
+	}
+	data, err := decodeStream(st)
+	if err != nil {
+		return
+	}
+	formResources, ok := e.r.resolve(st.dict["Resources"]).(dict)
+	if !ok {
+		formResources = resources
+	}
+	if m, ok := e.r.resolve(st.dict["Matrix"]).(array); ok && len(m) == 6 {
+		var fm matrix
+		for i := range fm {
+			fm[i], _ = e.r.number(m[i])
+		}
+		gs.ctm = fm.mul(gs.ctm)
+	}
+	e.run(data, formResources, gs, depth+1)
+}
+
+// skipInlineImage skips an inline image after its BI operator
+func skipInlineImage(l *lexer) {
+	for {
+		obj, err := l.object()
+		if err != nil {
+			l.pos = len(l.data)
+			return
+		}
+		if obj == keyword("ID") {
+			break
+		}
+	}
+	l.pos++
+	// The image data ends at an EI surrounded by whitespace
+	for {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + i
+		l.pos = end + 2
+		if end > 0 && isWhite(l.data[end-1]) && (l.pos >= len(l.data) || isWhite(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+// line is a line of text on a page
+type line struct {
+	x, y, endX float64
+	size       float64
+	text       string
+}
+
+// buildLines joins spans into lines, inserting spaces where the gap between
+// spans is wide enough to separate words
+func buildLines(spans []span) []line {
+	var lines []line
+	var cur *line
+	var b strings.Builder
+	flush := func() {
+		if cur != nil {
+			cur.text = strings.Join(strings.Fields(b.String()), " ")
+			if cur.text != "" {
+				lines = append(lines, *cur)
+			}
+		}
+		b.Reset()
+	}
+
+	for _, s := range spans {
+		if cur != nil {
+			size := math.Max(math.Max(s.size, cur.size), 1)
+			sameLine := math.Abs(s.y-cur.y) <= size/2 && s.x >= cur.endX-size
+			if sameLine {
+				text := b.String()
+				if s.x-cur.endX > size*0.2 && !strings.HasSuffix(text, " ") && !strings.HasPrefix(s.text, " ") {
+					b.WriteByte(' ')
+				}
+				b.WriteString(s.text)
+				cur.endX = math.Max(cur.endX, s.endX)
+				if strings.TrimSpace(s.text) != "" {
+					cur.size = math.Max(cur.size, s.size)
+				}
+				continue
+			}
+			flush()
+		}
+		cur = &line{x: s.x, y: s.y, endX: s.endX, size: s.size}
+		if strings.TrimSpace(s.text) == "" {
+			cur.size = 0
+		}
+		b.WriteString(s.text)
+	}
+	flush()
+	return lines
+}
+
+// roundSize rounds a font size to the half point, so sizes that differ only
+// by rounding are grouped
+func roundSize(v float64) float64 {
+	return math.Round(v*2) / 2
+}
+
+// fontSizes finds the body text size, the size most text is set in, and the
+// larger sizes used for short lines, which are treated as heading levels
+func fontSizes(pages [][]line) (float64, []float64) {
+	chars := make(map[float64]int)
+	for _, lines := range pages {
+		for _, l := range lines {
+			chars[roundSize(l.size)] += len([]rune(l.text))
+		}
+	}
+	body, most := 0.0, -1
+	for size, n := range chars {
+		if n > most || (n == most && size < body) {
+			body, most = size, n
+		}
+	}
+
+	seen := make(map[float64]bool)
+	var levels []float64
+	for _, lines := range pages {
+		for _, l := range lines {
+			size := roundSize(l.size)
+			if size >= body*headingRatio && len([]rune(l.text)) <= maxHeadingLength && !seen[size] {
+				seen[size] = true
+				levels = append(levels, size)
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(levels)))
+	return body, levels
+}
+
+// headingLevel returns the heading level of a line, or 0 for body text
+func headingLevel(l line, levels []float64) int {
+	if len([]rune(l.text)) > maxHeadingLength {
+		return 0
+	}
+	size := roundSize(l.size)
+	for i, s := range levels {
+		if s == size {
+			return min(i+1, 3)
+		}
+	}
+	return 0
+}
+
+// pageNumber matches lines that only hold a page number
+var pageNumber = regexp.MustCompile(`^(?i)(page\s+)?\d{1,4}(\s+of\s+\d{1,4})?$`)
+
+// bullet matches the bullet starting a list item
+var bullet = regexp.MustCompile(`^[•◦▪▫‣∙●○■□➢➤✓✔–*-]\s+`)
+
+// buildBlocks groups a page's lines into headings and paragraphs
+func buildBlocks(lines []line, body float64, levels []float64) []Block {
+	// Drop page numbers printed above or below the text
+	if len(lines) > 1 && pageNumber.MatchString(lines[len(lines)-1].text) {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) > 1 && pageNumber.MatchString(lines[0].text) {
+		lines = lines[1:]
+	}
+
+	var blocks []Block
+	var prev line
+	for i, l := range lines {
+		level := headingLevel(l, levels)
+		text := l.text
+		item := false
+		if level == 0 {
+			if m := bullet.FindString(text); m != "" {
+				item, text = true, text[len(m):]
+			}
+		}
+		if i > 0 && !item && len(blocks) > 0 {
+			last := &blocks[len(blocks)-1]
+			if last.Level == level && continuesBlock(prev, l, level) {
+				last.Text = joinLines(last.Text, text)
+				prev = l
+				continue
+			}
+		}
+		blocks = append(blocks, Block{Level: level, ListItem: item, Text: text})
+		prev = l
+	}
+
+	for i := range blocks {
+		blocks[i].Text = cleanText(blocks[i].Text)
+	}
+	return blocks
+}
+
+// continuesBlock reports whether line b continues the block ending with line a
+func continuesBlock(a, b line, level int) bool {
+	size := math.Max(math.Max(a.size, b.size), 1)
+	gap := a.y - b.y
+	if gap <= 0 || gap > size*1.8 {
+		// Moved up (a new column) or a paragraph gap
+		return false
+	}
+	if math.Abs(a.size-b.size) > size*0.08 {
+		return false
+	}
+	if level > 0 {
+		// Wrapped headings are set tighter than the gap after a heading
+		return gap <= size*1.35
+	}
+	// An indented line after a finished sentence starts a new paragraph
+	last, _ := utf8.DecodeLastRuneInString(a.text)
+	if b.x-a.x > size && strings.ContainsRune(".?!:\"”", last) {
+		return false
+	}
+	return true
+}
+
+// joinLines joins two lines of a paragraph, undoing hyphenation at the line
+// break
+func joinLines(a, b string) string {
+	ar, br := []rune(a), []rune(b)
+	if len(ar) > 1 && ar[len(ar)-1] == '-' && unicode.IsLetter(ar[len(ar)-2]) && len(br) > 0 && unicode.IsLower(br[0]) {
+		return string(ar[:len(ar)-1]) + b
+	}
+	return a + " " + b
+}
+
+// cleanText removes control characters and collapses whitespace
+func cleanText(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\u00ad' || r == '\ufffd': // Soft hyphens and replacement characters
+			return -1
+		case unicode.IsSpace(r):
+			return ' '
+		case unicode.IsControl(r):
+			return -1
+		}
+		return r
+	}, s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// outline reads the document's bookmarks
+func (r *reader) outline(catalog dict, pages []page) []OutlineEntry {
+	root, ok := r.resolve(catalog["Outlines"]).(dict)
+	if !ok {
+		return nil
+	}
+	pageIndex := make(map[int]int, len(pages))
+	for i, p := range pages {
+		pageIndex[p.ref.num] = i
+	}
+
+	var entries []OutlineEntry
+	seen := make(map[int]bool)
+	var walk func(item interface{}, level int)
+	walk = func(item interface{}, level int) {
+		if level > maxPageTreeDepth {
+			return
+		}
+		for {
+			ref, ok := item.(objRef)
+			if !ok || seen[ref.num] {
+				return
+			}
+			seen[ref.num] = true
+			d, ok := r.resolve(ref).(dict)
+			if !ok {
+				return
+			}
+
+			if title := cleanText(r.textString(d["Title"])); title != "" {
+				dest := d["Dest"]
+				if action, ok := r.resolve(d["A"]).(dict); ok && action["S"] == name("GoTo") {
+					dest = action["D"]
+				}
+				target := -1
+				if pageRef, ok := r.destPage(catalog, dest); ok {
+					if i, ok := pageIndex[pageRef.num]; ok {
+						target = i
+					}
+				}
+				entries = append(entries, OutlineEntry{Title: title, Level: level, Page: target})
+			}
+			walk(d["First"], level+1)
+			item = d["Next"]
+		}
+	}
+	walk(root["First"], 1)
+	return entries
+}
+
+// destPage returns the page an explicit or named destination points at
+func (r *reader) destPage(catalog dict, dest interface{}) (objRef, bool) {
+	for i := 0; i < 4; i++ {
+		switch d := r.resolve(dest).(type) {
+		case array:
+			if len(d) > 0 {
+				ref, ok := d[0].(objRef)
+				return ref, ok
+			}
+			return objRef{}, false
+		case dict:
+			dest = d["D"]
+		case name:
+			dests, _ := r.resolve(catalog["Dests"]).(dict)
+			dest = dests[d]
+		case pdfString:
+			names, _ := r.resolve(catalog["Names"]).(dict)
+			dest = r.nameTreeLookup(names["Dests"], string(d), 0)
+		default:
+			return objRef{}, false
+		}
+	}
+	return objRef{}, false
+}
+
+// nameTreeLookup finds a key in a name tree
+func (r *reader) nameTreeLookup(node interface{}, key string, depth int) interface{} {
+	d, ok := r.resolve(node).(dict)
+	if !ok || depth > maxPageTreeDepth {
+		return nil
+	}
+	if names, ok := r.resolve(d["Names"]).(array); ok {
+		for i := 0; i+1 < len(names); i += 2 {
+			if k, ok := r.resolve(names[i]).(pdfString); ok && string(k) == key {
+				return names[i+1]
+			}
+		}
+	}
+	kids, _ := r.resolve(d["Kids"]).(array)
+	for _, kid := range kids {
+		kd, ok := r.resolve(kid).(dict)
+		if !ok {
+			continue
+		}
+		if limits, ok := r.resolve(kd["Limits"]).(array); ok && len(limits) == 2 {
+			lo, _ := r.resolve(limits[0]).(pdfString)
+			hi, _ := r.resolve(limits[1]).(pdfString)
+			if key < string(lo) || key > string(hi) {
+				continue
+			}
+		}
+		if v := r.nameTreeLookup(kid, key, depth+1); v != nil {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package pdf
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtract(t *testing.T) {
+	doc := New()
+	doc.SetInfo("Title", "Algebra Notes")
+	doc.SetInfo("Author", "R. Sharma")
+
+	p := doc.AddPage()
+	p.Text(50, 80, Helvetica, 20, Black, "Chapter 1")
+	p.Text(50, 110, Helvetica, 11, Black, "Linear equations have one unknown. They are solved by iso-")
+	p.Text(50, 124, Helvetica, 11, Black, "lating the unknown on one side.")
+	p.Text(50, 154, Helvetica, 11, Black, "A second paragraph follows a wider gap.")
+	p.Text(50, 180, Helvetica, 11, Black, "- First point")
+	p.Text(50, 194, Helvetica, 11, Black, "- Second point")
+	// Words drawn separately on one line are joined with a space
+	p.Text(50, 220, Helvetica, 11, Black, "Split")
+	p.Text(50+TextWidth(Helvetica, 11, "Split ")+2, 220, Helvetica, 11, Black, "words")
+	p.Text(290, 800, Helvetica, 9, Black, "1")
+
+	p = doc.AddPage()
+	p.Text(50, 80, Helvetica, 14, Black, "1.1 Worked examples")
+	p.Text(50, 110, Helvetica, 11, Black, "Solve 2x + 3 = 7 to find x = 2.")
+	p.Text(290, 800, Helvetica, 9, Black, "2")
+
+	src, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	content, err := Extract(src)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	if content.Title != "Algebra Notes" || content.Author != "R. Sharma" {
+		t.Errorf("Title, Author = %q, %q", content.Title, content.Author)
+	}
+	if len(content.Pages) != 2 {
+		t.Fatalf("len(Pages) = %d, want 2", len(content.Pages))
+	}
+
+	want := [][]Block{
+		{
+			{Level: 1, Text: "Chapter 1"},
+			{Text: "Linear equations have one unknown. They are solved by isolating the unknown on one side."},
+			{Text: "A second paragraph follows a wider gap."},
+			{ListItem: true, Text: "First point"},
+			{ListItem: true, Text: "Second point"},
+			{Text: "Split words"},
+		},
+		{
+			{Level: 2, Text: "1.1 Worked examples"},
+			{Text: "Solve 2x + 3 = 7 to find x = 2."},
+		},
+	}
+	for i, blocks := range want {
+		if !reflect.DeepEqual(content.Pages[i].Blocks, blocks) {
+			t.Errorf("Page %d blocks:\n got %+v\nwant %+v", i+1, content.Pages[i].Blocks, blocks)
+		}
+	}
+}
+
+func TestExtractNoText(t *testing.T) {
+	doc := New()
+	doc.AddPage().FillRect(10, 10, 100, 100, Black)
+	src, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if _, err := Extract(src); !errors.Is(err, ErrNoText) {
+		t.Errorf("Extract() error = %v, want ErrNoText", err)
+	}
+}
+
+func TestExtractEncrypted(t *testing.T) {
+	doc := New()
+	doc.AddPage().Text(50, 80, Helvetica, 12, Black, "Secret")
+	src, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	src = []byte(strings.Replace(string(src), "trailer\n<<", "trailer\n<< /Encrypt 99 0 R", 1))
+	if _, err := Extract(src); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("Extract() error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestTextExtractorOperators(t *testing.T) {
+	// A composite font mapped through ToUnicode, kerning in TJ, an inline
+	// image and text drawn from a form XObject
+	cmapData := []byte(`/CIDInit /ProcSet findresource begin 12 dict begin begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <0048> <0002> <0069> endbfchar
+1 beginbfrange <0010> <0012> <0061> endbfrange
+endcmap CMapName currentdict /CMap defineresource pop end end`)
+	r := &reader{objects: map[int]interface{}{
+		1: dict{"Subtype": name("Type0"), "ToUnicode": objRef{2, 0}},
+		2: &stream{dict: dict{}, data: cmapData},
+		3: &stream{dict: dict{"Subtype": name("Form")}, data: []byte("BT /F1 10 Tf 0 -20 Td <00100011> Tj ET")},
+	}}
+	r.xref = map[int]xrefEntry{}
+	resources := dict{
+		"Font":    dict{"F1": objRef{1, 0}},
+		"XObject": dict{"X1": objRef{3, 0}},
+	}
+
+	e := &textExtractor{r: r, fonts: make(map[objRef]*textFont)}
+	content := []byte(`BT /F1 10 Tf 100 700 Td [<0001> -50 <0002> -3000 <0012>] TJ ET
+BI /W 2 /H 1 /BPC 8 /CS /G ID ` + "\x00EI\xff" + ` EI
+q 1 0 0 1 100 700 cm /X1 Do Q`)
+	e.run(content, resources, gstate{ctm: identity, text: textState{scale: 1}}, 0)
+
+	lines := buildLines(e.spans)
+	var got []string
+	for _, l := range lines {
+		got = append(got, l.text)
+	}
+	if want := []string{"Hi c", "ab"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("lines = %q, want %q", got, want)
+	}
+}
+
+func TestGlyphText(t *testing.T) {
+	tests := []struct {
+		glyph string
+		want  string
+	}{
+		{"A", "A"},
+		{"quoteright", "’"},
+		{"eacute", "é"},
+		{"fi", "fi"},
+		{"uni20B9", "₹"},
+		{"u1F600", "😀"},
+		{"a.sc", "a"},
+		{"f_f_i", "ffi"},
+		{"g123", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glyph, func(t *testing.T) {
+			if got := glyphText(tt.glyph); got != tt.want {
+				t.Errorf("glyphText(%q) = %q, want %q", tt.glyph, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeTextString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   pdfString
+		want string
+	}{
+		{"pdfdoc", pdfString("Caf\xe9"), "Café"},
+		{"utf16", pdfString("\xfe\xff\x00H\x00i\x20\xb9"), "Hi₹"},
+		{"utf8", pdfString("\xef\xbb\xbfHi ₹"), "Hi ₹"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeTextString(tt.in); got != tt.want {
+				t.Errorf("decodeTextString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if n := len([]rune(macRomanHigh)); n != 128 {
+		t.Errorf("macRomanHigh has %d characters, want 128", n)
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"iso-", "lating", "isolating"},
+		{"well-", "Known", "well- Known"},
+		{"end.", "Next", "end. Next"},
+		{"-", "x", "- x"},
+	}
+	for _, tt := range tests {
+		if got := joinLines(tt.a, tt.b); got != tt.want {
+			t.Errorf("joinLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
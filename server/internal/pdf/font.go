@@ -0,0 +1,205 @@
+package pdf
+
+import (
+	"strings"
+)
+
+// textFont turns the codes shown with a font into text and glyph widths
+type textFont struct {
+	composite bool        // Type0 font with multi-byte codes
+	encoding  *cmap       // Code space of a composite font
+	toUnicode *cmap       // Text of each code, when the font provides it
+	simple    [256]string // Text of each code of a simple font
+	widths    map[uint32]float64
+	dw        float64 // Width of codes missing from widths, in 1/1000 text space
+}
+
+// loadFont reads a font resource
+func (r *reader) loadFont(obj interface{}) *textFont {
+	d, _ := r.resolve(obj).(dict)
+	f := &textFont{widths: make(map[uint32]float64), dw: 500}
+	if d == nil {
+		for c := 0x20; c < 0x7f; c++ {
+			f.simple[c] = string(rune(c))
+		}
+		return f
+	}
+
+	if st, ok := r.resolve(d["ToUnicode"]).(*stream); ok {
+		if data, err := decodeStream(st); err == nil {
+			f.toUnicode = parseCMap(data)
+		}
+	}
+
+	if d["Subtype"] == name("Type0") {
+		f.composite = true
+		f.dw = 1000
+		switch enc := r.resolve(d["Encoding"]).(type) {
+		case *stream:
+			if data, err := decodeStream(enc); err == nil {
+				f.encoding = parseCMap(data)
+			}
+		}
+		if f.encoding == nil {
+			// Identity-H and the other predefined CMaps mostly use two-byte codes
+			f.encoding = &cmap{space: []codeRange{{lo: []byte{0, 0}, hi: []byte{0xff, 0xff}}}}
+		}
+		if kids, ok := r.resolve(d["DescendantFonts"]).(array); ok && len(kids) > 0 {
+			if desc, ok := r.resolve(kids[0]).(dict); ok {
+				if dw, ok := r.number(desc["DW"]); ok {
+					f.dw = dw
+				}
+				r.readCIDWidths(desc["W"], f.widths)
+			}
+		}
+		return f
+	}
+
+	// Simple fonts: start from the base encoding and apply /Differences
+	base := decodeWinAnsi
+	var differences array
+	switch enc := r.resolve(d["Encoding"]).(type) {
+	case name:
+		if enc == "MacRomanEncoding" {
+			base = decodeMacRoman
+		}
+	case dict:
+		if r.resolve(enc["BaseEncoding"]) == name("MacRomanEncoding") {
+			base = decodeMacRoman
+		}
+		differences, _ = r.resolve(enc["Differences"]).(array)
+	}
+	for c := 0; c < 256; c++ {
+		if v := base(byte(c)); v != 0 {
+			f.simple[c] = string(v)
+		}
+	}
+	code := 0
+	for _, item := range differences {
+		switch v := r.resolve(item).(type) {
+		case int64:
+			code = int(v)
+		case name:
+			if code >= 0 && code < 256 {
+				f.simple[code] = glyphText(string(v))
+			}
+			code++
+		}
+	}
+
+	first, _ := r.number(d["FirstChar"])
+	if widths, ok := r.resolve(d["Widths"]).(array); ok {
+		for i, w := range widths {
+			if v, ok := r.number(w); ok {
+				f.widths[uint32(int(first)+i)] = v
+			}
+		}
+		if desc, ok := r.resolve(d["FontDescriptor"]).(dict); ok {
+			if mw, ok := r.number(desc["MissingWidth"]); ok {
+				f.dw = mw
+			}
+		}
+	} else {
+		// The standard fonts may omit widths; Helvetica's are close enough
+		// to place words
+		for c := 32; c < 127; c++ {
+			f.widths[uint32(c)] = float64(helveticaWidths[c-32])
+		}
+	}
+	return f
+}
+
+// readCIDWidths reads the /W array of a CID font
+func (r *reader) readCIDWidths(obj interface{}, widths map[uint32]float64) {
+	w, ok := r.resolve(obj).(array)
+	if !ok {
+		return
+	}
+	for i := 0; i < len(w); {
+		first, ok := r.number(w[i])
+		if !ok || i+1 >= len(w) {
+			return
+		}
+		if list, ok := r.resolve(w[i+1]).(array); ok {
+			for j, v := range list {
+				if n, ok := r.number(v); ok {
+					widths[uint32(int(first)+j)] = n
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, ok1 := r.number(w[i+1])
+		n, ok2 := r.number(w[i+2])
+		if !ok1 || !ok2 || last < first || last-first > 0xffff {
+			return
+		}
+		for c := int(first); c <= int(last); c++ {
+			widths[uint32(c)] = n
+		}
+		i += 3
+	}
+}
+
+// number reads an integer or real
+func (r *reader) number(obj interface{}) (float64, bool) {
+	switch v := r.resolve(obj).(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// glyph is a code shown with a font
+type glyph struct {
+	text  string
+	width float64 // In 1/1000 text space
+	space bool    // Single-byte code 32, which word spacing applies to
+}
+
+// decode splits a shown string into glyphs
+func (f *textFont) decode(s []byte) []glyph {
+	var glyphs []glyph
+	for len(s) > 0 {
+		n := 1
+		if f.composite {
+			n = f.encoding.codeLength(s, 2)
+		} else if f.toUnicode != nil && len(f.toUnicode.space) > 0 {
+			n = f.toUnicode.codeLength(s, 1)
+		}
+		if n < 1 {
+			n = 1
+		}
+		code := s[:n]
+		s = s[n:]
+
+		g := glyph{width: f.dw, space: n == 1 && code[0] == ' '}
+		v := codeValue(code)
+		if w, ok := f.widths[v]; ok {
+			g.width = w
+		}
+		if text, ok := f.lookup(code); ok {
+			g.text = text
+		}
+		glyphs = append(glyphs, g)
+	}
+	return glyphs
+}
+
+// lookup returns the text of a code, preferring the font's ToUnicode map
+func (f *textFont) lookup(code []byte) (string, bool) {
+	if f.toUnicode != nil {
+		if text, ok := f.toUnicode.lookup(code); ok {
+			return strings.ReplaceAll(text, "\x00", ""), true
+		}
+	}
+	if !f.composite && len(code) == 1 && f.simple[code[0]] != "" {
+		return f.simple[code[0]], true
+	}
+	return "", false
+}
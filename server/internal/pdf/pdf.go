@@ -0,0 +1,279 @@
+// Package pdf writes simple PDF documents (text, lines and filled rectangles
+// using the standard fonts) without any external dependencies.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/server/internal/clock"
+)
+
+// A4 page size in points
+const (
+	A4Width  = 595.28
+	A4Height = 841.89
+)
+
+// Color is an RGB color with components between 0 and 1
+type Color struct {
+	R, G, B float64
+}
+
+// Common colors
+var (
+	Black     = Color{0, 0, 0}
+	White     = Color{1, 1, 1}
+	Gray      = Color{0.45, 0.45, 0.45}
+	LightGray = Color{0.92, 0.92, 0.92}
+)
+
+// RGB returns a color from 0-255 components
+func RGB(r, g, b int) Color {
+	return Color{float64(r) / 255, float64(g) / 255, float64(b) / 255}
+}
+
+// Document is a PDF document being built in memory
+type Document struct {
+	pages   []*Page
+	info    map[string]string
+	created time.Time
+}
+
+// Page is a single page. Coordinates are in points from the top-left corner.
+type Page struct {
+	Width   float64
+	Height  float64
+	content bytes.Buffer
+}
+
+// New creates an empty document
+func New() *Document {
+	return &Document{
+		info:    make(map[string]string),
+		created: clock.Now(),
+	}
+}
+
+// SetInfo sets a document information entry such as Title, Author, Subject,
+// Keywords or Creator. Custom keys are allowed and are shown by most viewers.
+func (d *Document) SetInfo(key, value string) {
+	d.info[key] = value
+}
+
+// SetCreationDate overrides the creation timestamp recorded in the document
+func (d *Document) SetCreationDate(t time.Time) {
+	d.created = t
+}
+
+// AddPage appends an A4 page
+func (d *Document) AddPage() *Page {
+	p := &Page{Width: A4Width, Height: A4Height}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Page returns the page at index i
+func (d *Document) Page(i int) *Page {
+	return d.pages[i]
+}
+
+// PageCount returns the number of pages
+func (d *Document) PageCount() int {
+	return len(d.pages)
+}
+
+// Text draws s with its baseline starting at (x, y)
+func (p *Page) Text(x, y float64, font Font, size float64, c Color, s string) {
+	fmt.Fprintf(&p.content, "BT %s rg /%s %s Tf %s %s Td (%s) Tj ET\n",
+		colorOp(c), font.resourceName(), num(size), num(x), num(p.Height-y), escape(encodeWinAnsi(s)))
+}
+
+// TextRight draws s so that it ends at x
+func (p *Page) TextRight(x, y float64, font Font, size float64, c Color, s string) {
+	p.Text(x-TextWidth(font, size, s), y, font, size, c, s)
+}
+
+// TextCenter draws s centered on x
+func (p *Page) TextCenter(x, y float64, font Font, size float64, c Color, s string) {
+	p.Text(x-TextWidth(font, size, s)/2, y, font, size, c, s)
+}
+
+// FillRect fills the rectangle with top-left corner (x, y)
+func (p *Page) FillRect(x, y, w, h float64, c Color) {
+	fmt.Fprintf(&p.content, "%s rg %s %s %s %s re f\n",
+		colorOp(c), num(x), num(p.Height-y-h), num(w), num(h))
+}
+
+// Line draws a straight line
+func (p *Page) Line(x1, y1, x2, y2, width float64, c Color) {
+	fmt.Fprintf(&p.content, "%s RG %s w %s %s m %s %s l S\n",
+		colorOp(c), num(width), num(x1), num(p.Height-y1), num(x2), num(p.Height-y2))
+}
+
+// Bytes serializes the document
+func (d *Document) Bytes() ([]byte, error) {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+
+	var buf bytes.Buffer
+	var offsets []int
+
+	// Object numbers: 1 catalog, 2 page tree, 3-4 fonts, 5 info, then a page
+	// object and a content stream per page
+	pageObj := func(i int) int { return 6 + i*2 }
+	objCount := 5 + len(d.pages)*2
+
+	writeObj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	writeObj("<< /Type /Catalog /Pages 2 0 R >>")
+
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", pageObj(i))
+	}
+	writeObj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+
+	for _, f := range []Font{Helvetica, HelveticaBold} {
+		writeObj(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.baseFont()))
+	}
+
+	writeObj(d.infoDict())
+
+	for i, p := range d.pages {
+		writeObj(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(p.Width), num(p.Height), pageObj(i)+1))
+
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(p.content.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", len(offsets), compressed.Len())
+		buf.Write(compressed.Bytes())
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+
+	if len(offsets) != objCount {
+		return nil, fmt.Errorf("pdf: wrote %d objects, expected %d", len(offsets), objCount)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", objCount+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n", objCount+1, xref)
+
+	return buf.Bytes(), nil
+}
+
+// infoDict builds the document information dictionary
+func (d *Document) infoDict() string {
+	keys := make([]string, 0, len(d.info))
+	for k := range d.info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("<< ")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "/%s %s ", nameEscape(k), TextString(d.info[k]))
+	}
+	fmt.Fprintf(&b, "/Producer (ODI Server) /CreationDate (%s) >>", Date(d.created))
+	return b.String()
+}
+
+// Date formats t as a PDF date string
+func Date(t time.Time) string {
+	_, offset := t.Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("D:%s%c%02d'%02d'", t.Format("20060102150405"), sign, offset/3600, (offset%3600)/60)
+}
+
+// TextString encodes s as a PDF text string, using UTF-16 for non-ASCII text
+func TextString(s string) string {
+	ascii := true
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return "(" + escape([]byte(s)) + ")"
+	}
+
+	var b strings.Builder
+	b.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(s)) {
+		fmt.Fprintf(&b, "%04X", u)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// escape escapes the special characters of a literal string
+func escape(b []byte) string {
+	var out strings.Builder
+	for _, c := range b {
+		switch c {
+		case '\\', '(', ')':
+			out.WriteByte('\\')
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// nameEscape makes s safe to use as a PDF name
+func nameEscape(s string) string {
+	var out strings.Builder
+	for _, c := range []byte(s) {
+		if c < 33 || c > 126 || strings.IndexByte("()<>[]{}/%#", c) >= 0 {
+			fmt.Fprintf(&out, "#%02X", c)
+		} else {
+			out.WriteByte(c)
+		}
+	}
+	return out.String()
+}
+
+// colorOp formats a color as three operands
+func colorOp(c Color) string {
+	return num(c.R) + " " + num(c.G) + " " + num(c.B)
+}
+
+// num formats a number compactly
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+	return s
+}
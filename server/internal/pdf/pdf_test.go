@@ -0,0 +1,125 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDocumentBytesStructure(t *testing.T) {
+	doc := New()
+	doc.SetInfo("Title", "Statement (March)")
+	doc.SetInfo("Author", "Priya Sharma")
+	doc.SetCreationDate(time.Date(2026, 3, 31, 18, 30, 0, 0, time.FixedZone("IST", 5*3600+1800)))
+
+	for i := 0; i < 2; i++ {
+		page := doc.AddPage()
+		page.FillRect(40, 40, 515, 60, RGB(30, 64, 175))
+		page.Text(50, 80, HelveticaBold, 18, White, "Ride Statement")
+		page.TextRight(555, 120, Helvetica, 10, Black, "Rs. 1,250.00")
+		page.Line(40, 130, 555, 130, 0.5, Gray)
+	}
+
+	data, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4")) {
+		t.Error("Expected PDF header")
+	}
+	if !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Error("Expected EOF marker")
+	}
+	if !bytes.Contains(data, []byte("/Count 2")) {
+		t.Error("Expected two pages in the page tree")
+	}
+	if !bytes.Contains(data, []byte(`/Title (Statement \(March\))`)) {
+		t.Error("Expected escaped title in info dictionary")
+	}
+	if !bytes.Contains(data, []byte("/CreationDate (D:20260331183000+05'30')")) {
+		t.Error("Expected creation date with offset")
+	}
+
+	// Every xref entry must point at the start of its object
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if startxref == nil {
+		t.Fatal("Missing startxref")
+	}
+	xrefOffset, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(data[xrefOffset:], []byte("xref\n")) {
+		t.Fatal("startxref does not point at the xref table")
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xrefOffset:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("Expected 9 objects, got %d", len(entries))
+	}
+	for i, e := range entries {
+		off, _ := strconv.Atoi(string(e[1]))
+		want := fmt.Sprintf("%d 0 obj", i+1)
+		if !bytes.HasPrefix(data[off:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q, want %q", i+1, data[off:off+10], want)
+		}
+	}
+}
+
+func TestEmptyDocumentHasOnePage(t *testing.T) {
+	data, err := New().Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	if !bytes.Contains(data, []byte("/Count 1")) {
+		t.Error("Expected a blank page")
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	if w := TextWidth(Helvetica, 10, "0000"); w != 22.24 {
+		t.Errorf("TextWidth() = %v, want 22.24", w)
+	}
+	if regular, bold := TextWidth(Helvetica, 12, "Invoice"), TextWidth(HelveticaBold, 12, "Invoice"); bold <= regular {
+		t.Errorf("Expected bold text to be wider: regular=%v bold=%v", regular, bold)
+	}
+	if w := TextWidth(Helvetica, 12, ""); w != 0 {
+		t.Errorf("TextWidth(\"\") = %v, want 0", w)
+	}
+}
+
+func TestEncodeWinAnsi(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Hello", "Hello"},
+		{"₹100", "Rs.100"},
+		{"café", "caf\xe9"},
+		{"line\nbreak", "linebreak"},
+		{"日本", "??"},
+	}
+
+	for _, tt := range tests {
+		if result := string(encodeWinAnsi(tt.input)); result != tt.expected {
+			t.Errorf("encodeWinAnsi(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestTextString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", "(plain)"},
+		{`a\b(c)`, `(a\\b\(c\))`},
+		{"é", "<FEFF00E9>"},
+	}
+
+	for _, tt := range tests {
+		if result := TextString(tt.input); result != tt.expected {
+			t.Errorf("TextString(%q) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,797 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The reader understands just enough of the PDF format to modify existing
+// documents with an incremental update: the object syntax, classic and
+// stream cross-reference sections, object streams and Flate compressed
+// streams with PNG predictors. Objects are represented as:
+//
+//	null → nil, booleans → bool, integers → int64, reals → float64,
+//	names → name, strings → pdfString, arrays → array, dictionaries → dict,
+//	indirect references → objRef and streams → *stream
+
+type (
+	name      string
+	pdfString []byte
+	array     []interface{}
+	dict      map[name]interface{}
+	keyword   string
+)
+
+// objRef is an indirect reference to an object
+type objRef struct {
+	num, gen int
+}
+
+// stream is a stream object with its raw (still encoded) data
+type stream struct {
+	dict dict
+	data []byte
+}
+
+// maxResolveDepth guards against reference cycles in malformed files
+const maxResolveDepth = 32
+
+var errMalformed = errors.New("pdf: malformed document")
+
+// lexer reads PDF objects from a byte slice
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips whitespace and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// regular reads a run of regular characters (a number or keyword)
+func (l *lexer) regular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isWhite(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+// hasPrefix reports whether the unread data starts with s
+func (l *lexer) hasPrefix(s string) bool {
+	return bytes.HasPrefix(l.data[l.pos:], []byte(s))
+}
+
+// object reads the next object. Keywords such as obj, stream and R are
+// returned as keyword values.
+func (l *lexer) object() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	switch l.data[l.pos] {
+	case '/':
+		l.pos++
+		return l.name(), nil
+	case '(':
+		l.pos++
+		return l.literalString()
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dict()
+		}
+		l.pos++
+		return l.hexString()
+	case '[':
+		l.pos++
+		return l.array()
+	}
+
+	start := l.pos
+	tok := l.regular()
+	switch tok {
+	case "":
+		return nil, fmt.Errorf("pdf: unexpected %q at offset %d", l.data[start], start)
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+
+	if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+		// An integer may start an indirect reference: "num gen R"
+		save := l.pos
+		l.skipSpace()
+		if gen, err := strconv.Atoi(l.regular()); err == nil {
+			l.skipSpace()
+			if l.regular() == "R" {
+				return objRef{int(n), gen}, nil
+			}
+		}
+		l.pos = save
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(tok, 64); err == nil {
+		return f, nil
+	}
+	return keyword(tok), nil
+}
+
+// name reads a name after its leading slash, decoding #xx escapes
+func (l *lexer) name() name {
+	raw := l.regular()
+	var out []byte
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			if v, err := strconv.ParseUint(raw[i+1:i+3], 16, 8); err == nil {
+				out = append(out, byte(v))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return name(out)
+}
+
+// literalString reads a (string) after its opening parenthesis
+func (l *lexer) literalString() (pdfString, error) {
+	var out []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out, nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// hexString reads a <hex string> after its opening bracket
+func (l *lexer) hexString() (pdfString, error) {
+	var out []byte
+	var digits []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			for i := 0; i < len(digits); i += 2 {
+				v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+				if err != nil {
+					return nil, fmt.Errorf("pdf: invalid hex string")
+				}
+				out = append(out, byte(v))
+			}
+			return out, nil
+		}
+		if !isWhite(c) {
+			digits = append(digits, c)
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+// array reads an array after its opening bracket
+func (l *lexer) array() (array, error) {
+	arr := array{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+		obj, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := obj.(keyword); ok {
+			return nil, errMalformed
+		}
+		arr = append(arr, obj)
+	}
+}
+
+// dict reads a dictionary after its opening brackets
+func (l *lexer) dict() (dict, error) {
+	d := dict{}
+	for {
+		l.skipSpace()
+		if l.hasPrefix(">>") {
+			l.pos += 2
+			return d, nil
+		}
+		key, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		k, ok := key.(name)
+		if !ok {
+			return nil, errMalformed
+		}
+		value, err := l.object()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := value.(keyword); ok {
+			return nil, errMalformed
+		}
+		d[k] = value
+	}
+}
+
+// xrefEntry locates an object, either at a file offset or inside an object stream
+type xrefEntry struct {
+	offset   int
+	gen      int
+	inStream bool
+	stream   int // Object stream number
+	index    int // Index within the object stream
+}
+
+// objectStream is a decoded object stream
+type objectStream struct {
+	data    []byte
+	offsets []int // Offset of each object, relative to data
+}
+
+// reader gives access to the objects of an existing document
+type reader struct {
+	data         []byte
+	xref         map[int]xrefEntry
+	trailer      dict
+	startxref    int  // Offset of the newest cross-reference section
+	xrefIsStream bool // Whether the newest section is a cross-reference stream
+	objects      map[int]interface{}
+	streams      map[int]*objectStream
+}
+
+// newReader parses the cross-reference sections of a document
+func newReader(data []byte) (*reader, error) {
+	r := &reader{
+		data:    data,
+		xref:    make(map[int]xrefEntry),
+		objects: make(map[int]interface{}),
+		streams: make(map[int]*objectStream),
+	}
+
+	i := bytes.LastIndex(data, []byte("startxref"))
+	if i < 0 {
+		return nil, fmt.Errorf("pdf: startxref not found")
+	}
+	l := &lexer{data: data, pos: i + len("startxref")}
+	l.skipSpace()
+	off, err := strconv.Atoi(l.regular())
+	if err != nil || off < 0 || off >= len(data) {
+		return nil, fmt.Errorf("pdf: invalid startxref")
+	}
+	r.startxref = off
+
+	// Newer sections come first and take precedence over the older sections
+	// they point to with /Prev
+	seen := make(map[int]bool)
+	for first := true; off >= 0 && !seen[off]; first = false {
+		seen[off] = true
+		trailer, isStream, err := r.readXrefSection(off)
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			r.trailer = trailer
+			r.xrefIsStream = isStream
+		}
+		off = -1
+		if prev, ok := trailer["Prev"].(int64); ok && prev >= 0 && int(prev) < len(data) {
+			off = int(prev)
+		}
+	}
+
+	if _, ok := r.trailer["Root"].(objRef); !ok {
+		return nil, fmt.Errorf("pdf: document has no catalog")
+	}
+	return r, nil
+}
+
+// readXrefSection reads the cross-reference table or stream at off
+func (r *reader) readXrefSection(off int) (dict, bool, error) {
+	l := &lexer{data: r.data, pos: off}
+	l.skipSpace()
+	if !l.hasPrefix("xref") {
+		trailer, err := r.readXrefStream(l.pos)
+		return trailer, true, err
+	}
+	l.pos += len("xref")
+
+	for {
+		l.skipSpace()
+		if l.hasPrefix("trailer") {
+			l.pos += len("trailer")
+			obj, err := l.object()
+			if err != nil {
+				return nil, false, err
+			}
+			trailer, ok := obj.(dict)
+			if !ok {
+				return nil, false, errMalformed
+			}
+			// Hybrid files list compressed objects in an additional stream
+			if stm, ok := trailer["XRefStm"].(int64); ok && stm > 0 && int(stm) < len(r.data) {
+				if _, err := r.readXrefStream(int(stm)); err != nil {
+					return nil, false, err
+				}
+			}
+			return trailer, false, nil
+		}
+
+		start, err1 := strconv.Atoi(l.regular())
+		l.skipSpace()
+		count, err2 := strconv.Atoi(l.regular())
+		if err1 != nil || err2 != nil || start < 0 || count < 0 {
+			return nil, false, fmt.Errorf("pdf: invalid xref table at offset %d", off)
+		}
+		for i := 0; i < count; i++ {
+			l.skipSpace()
+			offset, err1 := strconv.Atoi(l.regular())
+			l.skipSpace()
+			gen, err2 := strconv.Atoi(l.regular())
+			l.skipSpace()
+			kind := l.regular()
+			if err1 != nil || err2 != nil || (kind != "n" && kind != "f") {
+				return nil, false, fmt.Errorf("pdf: invalid xref entry at offset %d", l.pos)
+			}
+			if _, ok := r.xref[start+i]; !ok && kind == "n" {
+				r.xref[start+i] = xrefEntry{offset: offset, gen: gen}
+			}
+		}
+	}
+}
+
+// readXrefStream reads a cross-reference stream object at off
+func (r *reader) readXrefStream(off int) (dict, error) {
+	_, _, obj, err := r.parseIndirect(off)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := obj.(*stream)
+	if !ok || st.dict["Type"] != name("XRef") {
+		return nil, fmt.Errorf("pdf: no cross-reference section at offset %d", off)
+	}
+
+	data, err := decodeStream(st)
+	if err != nil {
+		return nil, err
+	}
+
+	w, ok := st.dict["W"].(array)
+	if !ok || len(w) != 3 {
+		return nil, fmt.Errorf("pdf: invalid cross-reference stream")
+	}
+	var widths [3]int
+	rowLen := 0
+	for i := range widths {
+		n, ok := w[i].(int64)
+		if !ok || n < 0 || n > 8 {
+			return nil, fmt.Errorf("pdf: invalid cross-reference stream")
+		}
+		widths[i] = int(n)
+		rowLen += int(n)
+	}
+	if rowLen == 0 {
+		return nil, fmt.Errorf("pdf: invalid cross-reference stream")
+	}
+
+	size, _ := st.dict["Size"].(int64)
+	index, ok := st.dict["Index"].(array)
+	if !ok {
+		index = array{int64(0), size}
+	}
+
+	field := func(row []byte, i int) int {
+		start := 0
+		for j := 0; j < i; j++ {
+			start += widths[j]
+		}
+		v := 0
+		for _, b := range row[start : start+widths[i]] {
+			v = v<<8 | int(b)
+		}
+		return v
+	}
+
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, ok1 := index[i].(int64)
+		count, ok2 := index[i+1].(int64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("pdf: invalid cross-reference stream index")
+		}
+		for j := 0; j < int(count); j++ {
+			if pos+rowLen > len(data) {
+				return nil, fmt.Errorf("pdf: truncated cross-reference stream")
+			}
+			row := data[pos : pos+rowLen]
+			pos += rowLen
+
+			num := int(start) + j
+			if _, ok := r.xref[num]; ok {
+				continue
+			}
+			kind := 1
+			if widths[0] > 0 {
+				kind = field(row, 0)
+			}
+			switch kind {
+			case 1:
+				r.xref[num] = xrefEntry{offset: field(row, 1), gen: field(row, 2)}
+			case 2:
+				r.xref[num] = xrefEntry{inStream: true, stream: field(row, 1), index: field(row, 2)}
+			}
+		}
+	}
+	return st.dict, nil
+}
+
+// parseIndirect parses the "num gen obj ... endobj" object at off
+func (r *reader) parseIndirect(off int) (int, int, interface{}, error) {
+	l := &lexer{data: r.data, pos: off}
+	num, err1 := l.object()
+	gen, err2 := l.object()
+	kw, err3 := l.object()
+	n, ok1 := num.(int64)
+	g, ok2 := gen.(int64)
+	if err1 != nil || err2 != nil || err3 != nil || !ok1 || !ok2 || kw != keyword("obj") {
+		return 0, 0, nil, fmt.Errorf("pdf: no object at offset %d", off)
+	}
+
+	obj, err := l.object()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	d, ok := obj.(dict)
+	if !ok {
+		return int(n), int(g), obj, nil
+	}
+
+	l.skipSpace()
+	if !l.hasPrefix("stream") {
+		return int(n), int(g), d, nil
+	}
+	l.pos += len("stream")
+	if l.hasPrefix("\r\n") {
+		l.pos += 2
+	} else if l.hasPrefix("\n") || l.hasPrefix("\r") {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust /Length when it ends at endstream, otherwise search for it
+	end := -1
+	if length, ok := r.resolveDepth(d["Length"], 1).(int64); ok && length >= 0 && start+int(length) <= len(r.data) {
+		after := &lexer{data: r.data, pos: start + int(length)}
+		after.skipSpace()
+		if after.hasPrefix("endstream") {
+			end = start + int(length)
+		}
+	}
+	if end < 0 {
+		i := bytes.Index(r.data[start:], []byte("endstream"))
+		if i < 0 {
+			return 0, 0, nil, fmt.Errorf("pdf: unterminated stream at offset %d", off)
+		}
+		end = start + i
+		if end > start && r.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && r.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return int(n), int(g), &stream{dict: d, data: r.data[start:end]}, nil
+}
+
+// object returns an object by number. Missing objects are null.
+func (r *reader) object(num int) (interface{}, error) {
+	if obj, ok := r.objects[num]; ok {
+		return obj, nil
+	}
+	entry, ok := r.xref[num]
+	if !ok {
+		return nil, nil
+	}
+
+	var obj interface{}
+	if entry.inStream {
+		objStm, err := r.objectStream(entry.stream)
+		if err != nil {
+			return nil, err
+		}
+		if entry.index < 0 || entry.index >= len(objStm.offsets) {
+			return nil, fmt.Errorf("pdf: object %d not in its object stream", num)
+		}
+		l := &lexer{data: objStm.data, pos: objStm.offsets[entry.index]}
+		if obj, err = l.object(); err != nil {
+			return nil, err
+		}
+	} else {
+		n, _, o, err := r.parseIndirect(entry.offset)
+		if err != nil {
+			return nil, err
+		}
+		if n != num {
+			return nil, fmt.Errorf("pdf: xref entry for object %d points at object %d", num, n)
+		}
+		obj = o
+	}
+
+	r.objects[num] = obj
+	return obj, nil
+}
+
+// objectStream decodes an object stream
+func (r *reader) objectStream(num int) (*objectStream, error) {
+	if objStm, ok := r.streams[num]; ok {
+		return objStm, nil
+	}
+	entry, ok := r.xref[num]
+	if !ok || entry.inStream {
+		return nil, fmt.Errorf("pdf: object stream %d not found", num)
+	}
+	_, _, obj, err := r.parseIndirect(entry.offset)
+	if err != nil {
+		return nil, err
+	}
+	st, ok := obj.(*stream)
+	if !ok {
+		return nil, fmt.Errorf("pdf: object %d is not an object stream", num)
+	}
+	data, err := decodeStream(st)
+	if err != nil {
+		return nil, err
+	}
+
+	n, _ := st.dict["N"].(int64)
+	first, _ := st.dict["First"].(int64)
+	if n < 0 || first < 0 || int(first) > len(data) {
+		return nil, fmt.Errorf("pdf: invalid object stream %d", num)
+	}
+	objStm := &objectStream{data: data}
+	l := &lexer{data: data[:first]}
+	for i := 0; i < int(n); i++ {
+		l.skipSpace()
+		l.regular() // Object number
+		l.skipSpace()
+		off, err := strconv.Atoi(l.regular())
+		if err != nil || int(first)+off > len(data) {
+			return nil, fmt.Errorf("pdf: invalid object stream %d", num)
+		}
+		objStm.offsets = append(objStm.offsets, int(first)+off)
+	}
+
+	r.streams[num] = objStm
+	return objStm, nil
+}
+
+// resolve follows indirect references until it reaches a direct object.
+// Unresolvable references are treated as null.
+func (r *reader) resolve(obj interface{}) interface{} {
+	return r.resolveDepth(obj, 0)
+}
+
+func (r *reader) resolveDepth(obj interface{}, depth int) interface{} {
+	for ref, ok := obj.(objRef); ok; ref, ok = obj.(objRef) {
+		if depth++; depth > maxResolveDepth {
+			return nil
+		}
+		var err error
+		if obj, err = r.object(ref.num); err != nil {
+			return nil
+		}
+	}
+	return obj
+}
+
+// decodeStream returns the decoded data of a stream. Only FlateDecode is
+// supported, which is what cross-reference and object streams use.
+func decodeStream(st *stream) ([]byte, error) {
+	var filters array
+	switch f := st.dict["Filter"].(type) {
+	case nil:
+		return st.data, nil
+	case name:
+		filters = array{f}
+	case array:
+		filters = f
+	}
+	var params []dict
+	switch p := st.dict["DecodeParms"].(type) {
+	case dict:
+		params = []dict{p}
+	case array:
+		for _, v := range p {
+			d, _ := v.(dict)
+			params = append(params, d)
+		}
+	}
+
+	data := st.data
+	for i, f := range filters {
+		if f != name("FlateDecode") && f != name("Fl") {
+			return nil, fmt.Errorf("pdf: unsupported stream filter %v", f)
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		out, err := io.ReadAll(zr)
+		// Accept streams with a damaged checksum or trailer, as viewers do
+		if err != nil && len(out) == 0 {
+			return nil, err
+		}
+		data = out
+
+		if i < len(params) && params[i] != nil {
+			if data, err = unpredict(data, params[i]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return data, nil
+}
+
+// unpredict reverses the PNG predictors applied before compression
+func unpredict(data []byte, params dict) ([]byte, error) {
+	predictor, _ := params["Predictor"].(int64)
+	if predictor <= 1 {
+		return data, nil
+	}
+	if predictor < 10 {
+		return nil, fmt.Errorf("pdf: unsupported predictor %d", predictor)
+	}
+
+	intParam := func(key name, def int64) int {
+		if v, ok := params[key].(int64); ok && v > 0 {
+			return int(v)
+		}
+		return int(def)
+	}
+	colors := intParam("Colors", 1)
+	bpc := intParam("BitsPerComponent", 8)
+	columns := intParam("Columns", 1)
+	bpp := (colors*bpc + 7) / 8
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	var out []byte
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		filter := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left = row[i-bpp]
+				upLeft = prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 0:
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			default:
+				return nil, fmt.Errorf("pdf: invalid PNG filter %d", filter)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+// paeth is the PNG Paeth predictor
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
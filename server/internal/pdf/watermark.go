@@ -0,0 +1,478 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/server/internal/clock"
+)
+
+// ErrEncrypted is returned for encrypted documents, which can't be modified
+// without their password
+var ErrEncrypted = errors.New("pdf: document is encrypted")
+
+// Resource names used by the watermark, chosen not to clash with existing ones
+const (
+	watermarkFont  = "ODIWatermarkFont"
+	watermarkState = "ODIWatermarkGS"
+)
+
+// watermarkOpacity is the opacity of the diagonal watermark text
+const watermarkOpacity = 0.18
+
+// maxPageTreeDepth guards against cycles in malformed page trees
+const maxPageTreeDepth = 64
+
+// Watermark is stamped on every page of a document
+type Watermark struct {
+	Text   string            // Large translucent text across each page
+	Footer string            // Small line along the bottom of each page
+	Info   map[string]string // Added to the document information dictionary
+	Date   time.Time         // Recorded as the modification date
+}
+
+// page is a leaf of the page tree with its inherited attributes resolved
+type page struct {
+	ref       objRef
+	dict      dict
+	resources dict
+	box       [4]float64
+	rotate    int
+}
+
+// AddWatermark stamps a watermark on every page of an existing document. The
+// original bytes are kept as they are and the watermark is appended as an
+// incremental update, so any PDF a viewer can open keeps working.
+func AddWatermark(src []byte, wm Watermark) ([]byte, error) {
+	r, _, pages, err := openDocument(src)
+	if err != nil {
+		return nil, err
+	}
+
+	size, _ := r.trailer["Size"].(int64)
+	next := int(size)
+	for num := range r.xref {
+		if num >= next {
+			next = num + 1
+		}
+	}
+	alloc := func() int {
+		next++
+		return next - 1
+	}
+
+	u := &update{buf: bytes.NewBuffer(append([]byte(nil), src...)), offsets: make(map[int]int), gens: make(map[int]int)}
+	if !bytes.HasSuffix(src, []byte("\n")) {
+		u.buf.WriteByte('\n')
+	}
+
+	fontRef := objRef{alloc(), 0}
+	u.writeObject(fontRef, dict{
+		"Type":     name("Font"),
+		"Subtype":  name("Type1"),
+		"BaseFont": name("Helvetica"),
+		"Encoding": name("WinAnsiEncoding"),
+	})
+	stateRef := objRef{alloc(), 0}
+	u.writeObject(stateRef, dict{
+		"Type": name("ExtGState"),
+		"ca":   watermarkOpacity,
+		"CA":   watermarkOpacity,
+	})
+	// Page content is wrapped in q ... Q so the watermark starts from a clean
+	// graphics state whatever the page leaves behind
+	saveRef := objRef{alloc(), 0}
+	if err := u.writeStream(saveRef, []byte("q\n"), false); err != nil {
+		return nil, err
+	}
+
+	for _, p := range pages {
+		markRef := objRef{alloc(), 0}
+		if err := u.writeStream(markRef, watermarkContent(p.box, p.rotate, wm), true); err != nil {
+			return nil, err
+		}
+
+		contents := array{saveRef}
+		switch c := p.dict["Contents"].(type) {
+		case objRef:
+			if arr, ok := r.resolve(c).(array); ok {
+				contents = append(contents, arr...)
+			} else {
+				contents = append(contents, c)
+			}
+		case array:
+			contents = append(contents, c...)
+		}
+		contents = append(contents, markRef)
+
+		resources := copyDict(p.resources)
+		fonts := copyDict(r.resolve(resources["Font"]))
+		fonts[watermarkFont] = fontRef
+		resources["Font"] = fonts
+		states := copyDict(r.resolve(resources["ExtGState"]))
+		states[watermarkState] = stateRef
+		resources["ExtGState"] = states
+
+		pageDict := copyDict(p.dict)
+		pageDict["Contents"] = contents
+		pageDict["Resources"] = resources
+		u.writeObject(p.ref, pageDict)
+	}
+
+	info := copyDict(r.resolve(r.trailer["Info"]))
+	for k, v := range wm.Info {
+		info[name(k)] = textString(v)
+	}
+	date := wm.Date
+	if date.IsZero() {
+		date = clock.Now()
+	}
+	info["ModDate"] = pdfString(Date(date))
+	infoRef := objRef{alloc(), 0}
+	u.writeObject(infoRef, info)
+
+	trailer := dict{
+		"Root": r.trailer["Root"],
+		"Info": infoRef,
+		"Prev": int64(r.startxref),
+	}
+	if id, ok := r.trailer["ID"]; ok {
+		trailer["ID"] = id
+	}
+	if r.xrefIsStream {
+		u.finishWithStream(trailer, alloc())
+	} else {
+		u.finishWithTable(trailer, next)
+	}
+	return u.buf.Bytes(), nil
+}
+
+// collectPages walks the page tree, resolving inherited page attributes
+func (r *reader) collectPages(node interface{}, inherited page, depth int, seen map[int]bool, pages *[]page) error {
+	if depth > maxPageTreeDepth {
+		return fmt.Errorf("pdf: page tree too deep")
+	}
+	ref, ok := node.(objRef)
+	if !ok {
+		return fmt.Errorf("pdf: page tree node is not an indirect object")
+	}
+	if seen[ref.num] {
+		return fmt.Errorf("pdf: cycle in page tree")
+	}
+	seen[ref.num] = true
+
+	d, ok := r.resolve(ref).(dict)
+	if !ok {
+		return fmt.Errorf("pdf: invalid page tree node %d", ref.num)
+	}
+
+	attrs := inherited
+	if res, ok := r.resolve(d["Resources"]).(dict); ok {
+		attrs.resources = res
+	}
+	if box, ok := r.rect(d["MediaBox"]); ok {
+		attrs.box = box
+	}
+	if box, ok := r.rect(d["CropBox"]); ok {
+		attrs.box = box
+	}
+	if rotate, ok := r.resolve(d["Rotate"]).(int64); ok {
+		attrs.rotate = int(((rotate % 360) + 360) % 360)
+	}
+
+	kids, isTree := r.resolve(d["Kids"]).(array)
+	if d["Type"] == name("Page") || !isTree {
+		attrs.ref = ref
+		attrs.dict = d
+		*pages = append(*pages, attrs)
+		return nil
+	}
+	for _, kid := range kids {
+		if err := r.collectPages(kid, attrs, depth+1, seen, pages); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rect reads a rectangle such as a MediaBox, normalizing its corners
+func (r *reader) rect(obj interface{}) ([4]float64, bool) {
+	arr, ok := r.resolve(obj).(array)
+	if !ok || len(arr) != 4 {
+		return [4]float64{}, false
+	}
+	var v [4]float64
+	for i, o := range arr {
+		switch n := r.resolve(o).(type) {
+		case int64:
+			v[i] = float64(n)
+		case float64:
+			v[i] = n
+		default:
+			return [4]float64{}, false
+		}
+	}
+	return [4]float64{math.Min(v[0], v[2]), math.Min(v[1], v[3]), math.Max(v[0], v[2]), math.Max(v[1], v[3])}, true
+}
+
+// displayTransform returns the matrix mapping coordinates on the page as it
+// is displayed (after /Rotate) to user space, and the displayed size
+func displayTransform(box [4]float64, rotate int) ([6]float64, float64, float64) {
+	w, h := box[2]-box[0], box[3]-box[1]
+	switch rotate {
+	case 90:
+		return [6]float64{0, 1, -1, 0, box[0] + w, box[1]}, h, w
+	case 180:
+		return [6]float64{-1, 0, 0, -1, box[0] + w, box[1] + h}, w, h
+	case 270:
+		return [6]float64{0, -1, 1, 0, box[0], box[1] + h}, h, w
+	}
+	return [6]float64{1, 0, 0, 1, box[0], box[1]}, w, h
+}
+
+// watermarkContent draws the watermark on a page. It first closes the q
+// opened before the page's own content.
+func watermarkContent(box [4]float64, rotate int, wm Watermark) []byte {
+	m, w, h := displayTransform(box, rotate)
+
+	var b bytes.Buffer
+	b.WriteString("Q\nq\n")
+	fmt.Fprintf(&b, "%s %s %s %s %s %s cm\n", fnum(m[0]), fnum(m[1]), fnum(m[2]), fnum(m[3]), fnum(m[4]), fnum(m[5]))
+
+	if wm.Footer != "" {
+		size := 7.0
+		if unit := TextWidth(Helvetica, 1, wm.Footer); unit*size > w-20 && unit > 0 {
+			size = math.Max((w-20)/unit, 3)
+		}
+		x := (w - TextWidth(Helvetica, size, wm.Footer)) / 2
+		fmt.Fprintf(&b, "BT /%s %s Tf 0.35 0.35 0.35 rg 1 0 0 1 %s %s Tm (%s) Tj ET\n",
+			watermarkFont, num(size), num(x), num(size+3), escape(encodeWinAnsi(wm.Footer)))
+	}
+
+	if wm.Text != "" {
+		// Center the text along the page diagonal, sized to span most of it
+		angle := math.Atan2(h, w)
+		cos, sin := math.Cos(angle), math.Sin(angle)
+		size := 60.0
+		if unit := TextWidth(Helvetica, 1, wm.Text); unit > 0 {
+			size = math.Min(size, math.Hypot(w, h)*0.7/unit)
+		}
+		tw := TextWidth(Helvetica, size, wm.Text)
+		// Shift the baseline down by a third of the font size to center vertically
+		x := w/2 - cos*tw/2 + sin*size/3
+		y := h/2 - sin*tw/2 - cos*size/3
+		fmt.Fprintf(&b, "/%s gs BT /%s %s Tf 0.5 0.5 0.5 rg %s %s %s %s %s %s Tm (%s) Tj ET\n",
+			watermarkState, watermarkFont, num(size),
+			fnum(cos), fnum(sin), fnum(-sin), fnum(cos), num(x), num(y), escape(encodeWinAnsi(wm.Text)))
+	}
+
+	b.WriteString("Q\n")
+	return b.Bytes()
+}
+
+// update appends objects and a cross-reference section to a document
+type update struct {
+	buf     *bytes.Buffer
+	offsets map[int]int
+	gens    map[int]int
+}
+
+// writeObject appends an indirect object
+func (u *update) writeObject(ref objRef, obj interface{}) {
+	u.offsets[ref.num] = u.buf.Len()
+	u.gens[ref.num] = ref.gen
+	fmt.Fprintf(u.buf, "%d %d obj\n", ref.num, ref.gen)
+	writeObject(u.buf, obj)
+	u.buf.WriteString("\nendobj\n")
+}
+
+// writeStream appends a stream object, optionally compressed
+func (u *update) writeStream(ref objRef, data []byte, compress bool) error {
+	d := dict{}
+	if compress {
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		if _, err := zw.Write(data); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		data = compressed.Bytes()
+		d["Filter"] = name("FlateDecode")
+	}
+	d["Length"] = int64(len(data))
+
+	u.offsets[ref.num] = u.buf.Len()
+	u.gens[ref.num] = ref.gen
+	fmt.Fprintf(u.buf, "%d %d obj\n", ref.num, ref.gen)
+	writeObject(u.buf, d)
+	u.buf.WriteString("\nstream\n")
+	u.buf.Write(data)
+	u.buf.WriteString("\nendstream\nendobj\n")
+	return nil
+}
+
+// sortedNums returns the numbers of the written objects in order
+func (u *update) sortedNums() []int {
+	nums := make([]int, 0, len(u.offsets))
+	for num := range u.offsets {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// finishWithTable appends a classic cross-reference table and trailer
+func (u *update) finishWithTable(trailer dict, size int) {
+	nums := u.sortedNums()
+	start := u.buf.Len()
+	u.buf.WriteString("xref\n")
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		fmt.Fprintf(u.buf, "%d %d\n", nums[i], j-i+1)
+		for _, num := range nums[i : j+1] {
+			fmt.Fprintf(u.buf, "%010d %05d n \n", u.offsets[num], u.gens[num])
+		}
+		i = j + 1
+	}
+
+	trailer["Size"] = int64(size)
+	u.buf.WriteString("trailer\n")
+	writeObject(u.buf, trailer)
+	fmt.Fprintf(u.buf, "\nstartxref\n%d\n%%%%EOF\n", start)
+}
+
+// finishWithStream appends a cross-reference stream, for documents whose
+// newest section is one
+func (u *update) finishWithStream(trailer dict, xrefNum int) {
+	start := u.buf.Len()
+	u.offsets[xrefNum] = start
+	u.gens[xrefNum] = 0
+
+	nums := u.sortedNums()
+	var index array
+	var data []byte
+	for i := 0; i < len(nums); {
+		j := i
+		for j+1 < len(nums) && nums[j+1] == nums[j]+1 {
+			j++
+		}
+		index = append(index, int64(nums[i]), int64(j-i+1))
+		for _, num := range nums[i : j+1] {
+			off, gen := u.offsets[num], u.gens[num]
+			data = append(data, 1,
+				byte(off>>56), byte(off>>48), byte(off>>40), byte(off>>32),
+				byte(off>>24), byte(off>>16), byte(off>>8), byte(off),
+				byte(gen>>8), byte(gen))
+		}
+		i = j + 1
+	}
+
+	trailer["Type"] = name("XRef")
+	trailer["Size"] = int64(xrefNum + 1)
+	trailer["Index"] = index
+	trailer["W"] = array{int64(1), int64(8), int64(2)}
+	trailer["Length"] = int64(len(data))
+
+	fmt.Fprintf(u.buf, "%d 0 obj\n", xrefNum)
+	writeObject(u.buf, trailer)
+	u.buf.WriteString("\nstream\n")
+	u.buf.Write(data)
+	fmt.Fprintf(u.buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", start)
+}
+
+// writeObject serializes a direct object
+func writeObject(b *bytes.Buffer, obj interface{}) {
+	switch v := obj.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case int64:
+		b.WriteString(strconv.FormatInt(v, 10))
+	case float64:
+		b.WriteString(fnum(v))
+	case name:
+		b.WriteString("/" + nameEscape(string(v)))
+	case pdfString:
+		fmt.Fprintf(b, "<%X>", []byte(v))
+	case objRef:
+		fmt.Fprintf(b, "%d %d R", v.num, v.gen)
+	case array:
+		b.WriteByte('[')
+		for i, o := range v {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			writeObject(b, o)
+		}
+		b.WriteByte(']')
+	case dict:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		b.WriteString("<<")
+		for _, k := range keys {
+			b.WriteString(" /" + nameEscape(k) + " ")
+			writeObject(b, v[name(k)])
+		}
+		b.WriteString(" >>")
+	default:
+		// Streams and keywords never appear as direct objects
+		b.WriteString("null")
+	}
+}
+
+// copyDict returns a shallow copy of obj if it is a dictionary, or an empty one
+func copyDict(obj interface{}) dict {
+	out := dict{}
+	if d, ok := obj.(dict); ok {
+		for k, v := range d {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// textString encodes s as the bytes of a PDF text string
+func textString(s string) pdfString {
+	ascii := true
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		return pdfString(s)
+	}
+	out := []byte{0xFE, 0xFF}
+	for _, u := range utf16.Encode([]rune(s)) {
+		out = append(out, byte(u>>8), byte(u))
+	}
+	return out
+}
+
+// fnum formats a number with enough precision for transformation matrices
+func fnum(v float64) string {
+	s := strconv.FormatFloat(v, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "" || s == "-0" {
+		return "0"
+	}
+	return s
+}
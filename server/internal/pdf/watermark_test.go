@@ -0,0 +1,274 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// watermarkedPage reopens a watermarked document and returns its pages
+func watermarkedPages(t *testing.T, data []byte) (*reader, []page) {
+	t.Helper()
+	r, err := newReader(data)
+	if err != nil {
+		t.Fatalf("newReader() error = %v", err)
+	}
+	catalog, ok := r.resolve(r.trailer["Root"]).(dict)
+	if !ok {
+		t.Fatal("Missing catalog")
+	}
+	var pages []page
+	if err := r.collectPages(catalog["Pages"], page{}, 0, map[int]bool{}, &pages); err != nil {
+		t.Fatalf("collectPages() error = %v", err)
+	}
+	return r, pages
+}
+
+// checkWatermarkedPage checks a page draws its original content and the watermark
+func checkWatermarkedPage(t *testing.T, r *reader, p page, original objRef, text string) {
+	t.Helper()
+	contents, ok := p.dict["Contents"].(array)
+	if !ok || len(contents) != 3 {
+		t.Fatalf("Contents = %v, want original content between save and watermark streams", p.dict["Contents"])
+	}
+	if contents[1] != original {
+		t.Errorf("Contents[1] = %v, want original content %v", contents[1], original)
+	}
+	mark, ok := r.resolve(contents[2]).(*stream)
+	if !ok {
+		t.Fatal("Watermark stream not found")
+	}
+	data, err := decodeStream(mark)
+	if err != nil {
+		t.Fatalf("decodeStream() error = %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("Q\nq\n")) || !bytes.Contains(data, []byte("("+text+") Tj")) {
+		t.Errorf("Unexpected watermark content:\n%s", data)
+	}
+
+	fonts, _ := r.resolve(p.resources["Font"]).(dict)
+	if _, ok := fonts[watermarkFont]; !ok {
+		t.Error("Watermark font missing from page resources")
+	}
+	if states, _ := r.resolve(p.resources["ExtGState"]).(dict); states[watermarkState] == nil {
+		t.Error("Watermark graphics state missing from page resources")
+	}
+}
+
+func TestAddWatermark(t *testing.T) {
+	doc := New()
+	doc.SetInfo("Title", "Algebra")
+	for i := 0; i < 2; i++ {
+		doc.AddPage().Text(50, 80, Helvetica, 12, Black, "Chapter")
+	}
+	src, err := doc.Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+
+	out, err := AddWatermark(src, Watermark{
+		Text:   "Asha Rao (EN123)",
+		Footer: "Licensed to Asha Rao",
+		Info:   map[string]string{"LicensedTo": "Asha Rao (EN123)"},
+		Date:   time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+	})
+	if err != nil {
+		t.Fatalf("AddWatermark() error = %v", err)
+	}
+	if !bytes.HasPrefix(out, src) {
+		t.Error("Expected the original document to be kept as is")
+	}
+
+	r, pages := watermarkedPages(t, out)
+	if r.xrefIsStream {
+		t.Error("Expected a classic xref table for a document using one")
+	}
+	if prev, _ := r.trailer["Prev"].(int64); prev <= 0 {
+		t.Error("Expected the update to point at the original xref table")
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Got %d pages, want 2", len(pages))
+	}
+	for i, p := range pages {
+		checkWatermarkedPage(t, r, p, objRef{pageObjNum(i) + 1, 0}, "Asha Rao \\(EN123\\)")
+	}
+
+	info, _ := r.resolve(r.trailer["Info"]).(dict)
+	if string(info["Title"].(pdfString)) != "Algebra" {
+		t.Error("Expected the original document information to be kept")
+	}
+	if string(info["LicensedTo"].(pdfString)) != "Asha Rao (EN123)" {
+		t.Error("Expected LicensedTo in document information")
+	}
+	if string(info["ModDate"].(pdfString)) != "D:20260301100000+00'00'" {
+		t.Errorf("ModDate = %s", info["ModDate"])
+	}
+}
+
+// pageObjNum is the object number of page i in documents written by Bytes
+func pageObjNum(i int) int {
+	return 6 + i*2
+}
+
+// xrefStreamDocument builds a document whose objects live in a compressed
+// object stream, indexed by a predicted cross-reference stream. Its single
+// page is rotated and inherits its resources and media box.
+func xrefStreamDocument(t *testing.T) []byte {
+	t.Helper()
+	compress := func(data []byte) []byte {
+		var b bytes.Buffer
+		zw := zlib.NewWriter(&b)
+		zw.Write(data)
+		zw.Close()
+		return b.Bytes()
+	}
+
+	var buf bytes.Buffer
+	offsets := map[int]int{}
+	buf.WriteString("%PDF-1.5\n")
+
+	offsets[4] = buf.Len()
+	content := "BT /F1 12 Tf 10 10 Td (Hi) Tj ET"
+	fmt.Fprintf(&buf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 /MediaBox [0 0 200 400] /Rotate 90 /Resources << /Font << /F1 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+	}
+	var header, body strings.Builder
+	for i, o := range objs {
+		fmt.Fprintf(&header, "%d %d ", i+1, body.Len())
+		body.WriteString(o + "\n")
+	}
+	objStm := compress([]byte(header.String() + body.String()))
+	offsets[5] = buf.Len()
+	fmt.Fprintf(&buf, "5 0 obj\n<< /Type /ObjStm /N 3 /First %d /Filter /FlateDecode /Length %d >>\nstream\n", header.Len(), len(objStm))
+	buf.Write(objStm)
+	buf.WriteString("\nendstream\nendobj\n")
+
+	offsets[6] = buf.Len()
+	buf.WriteString("6 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Times-Roman >>\nendobj\n")
+
+	offsets[7] = buf.Len()
+	rows := [][4]byte{{0, 0, 0, 255}, {2, 0, 5, 0}, {2, 0, 5, 1}, {2, 0, 5, 2}}
+	for num := 4; num <= 7; num++ {
+		off := offsets[num]
+		rows = append(rows, [4]byte{1, byte(off >> 8), byte(off), 0})
+	}
+	// PNG Up predictor: each row stores the difference from the row above
+	var predicted []byte
+	var prev [4]byte
+	for _, row := range rows {
+		predicted = append(predicted, 2)
+		for i := range row {
+			predicted = append(predicted, row[i]-prev[i])
+		}
+		prev = row
+	}
+	xref := compress(predicted)
+	fmt.Fprintf(&buf, "7 0 obj\n<< /Type /XRef /Size 8 /W [1 2 1] /Root 1 0 R /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 4 >> /Length %d >>\nstream\n", len(xref))
+	buf.Write(xref)
+	fmt.Fprintf(&buf, "\nendstream\nendobj\nstartxref\n%d\n%%%%EOF\n", offsets[7])
+	return buf.Bytes()
+}
+
+func TestAddWatermarkXrefStream(t *testing.T) {
+	src := xrefStreamDocument(t)
+	out, err := AddWatermark(src, Watermark{Text: "Asha Rao", Footer: "Licensed to Asha Rao"})
+	if err != nil {
+		t.Fatalf("AddWatermark() error = %v", err)
+	}
+
+	r, pages := watermarkedPages(t, out)
+	if !r.xrefIsStream {
+		t.Error("Expected a cross-reference stream for a document using one")
+	}
+	if len(pages) != 1 {
+		t.Fatalf("Got %d pages, want 1", len(pages))
+	}
+	p := pages[0]
+	if p.rotate != 90 || p.box != [4]float64{0, 0, 200, 400} {
+		t.Errorf("Inherited rotate %d and box %v, want 90 and [0 0 200 400]", p.rotate, p.box)
+	}
+	checkWatermarkedPage(t, r, p, objRef{4, 0}, "Asha Rao")
+	if fonts, _ := r.resolve(p.resources["Font"]).(dict); fonts["F1"] != (objRef{6, 0}) {
+		t.Error("Expected the inherited page fonts to be kept")
+	}
+}
+
+func TestAddWatermarkEncrypted(t *testing.T) {
+	src, err := New().Bytes()
+	if err != nil {
+		t.Fatalf("Bytes() error = %v", err)
+	}
+	src = bytes.Replace(src, []byte("/Root"), []byte("/Encrypt 9 0 R /Root"), 1)
+	if _, err := AddWatermark(src, Watermark{Text: "x"}); err != ErrEncrypted {
+		t.Errorf("AddWatermark() error = %v, want ErrEncrypted", err)
+	}
+}
+
+func TestAddWatermarkInvalid(t *testing.T) {
+	if _, err := AddWatermark([]byte("not a pdf"), Watermark{Text: "x"}); err == nil {
+		t.Error("Expected an error for data that isn't a PDF")
+	}
+}
+
+func TestDisplayTransform(t *testing.T) {
+	box := [4]float64{10, 20, 110, 220} // 100 x 200
+	tests := []struct {
+		rotate    int
+		w, h      float64
+		origin    [2]float64 // User space position of the displayed bottom-left corner
+		farCorner [2]float64 // User space position of the displayed top-right corner
+	}{
+		{0, 100, 200, [2]float64{10, 20}, [2]float64{110, 220}},
+		{90, 200, 100, [2]float64{110, 20}, [2]float64{10, 220}},
+		{180, 100, 200, [2]float64{110, 220}, [2]float64{10, 20}},
+		{270, 200, 100, [2]float64{10, 220}, [2]float64{110, 20}},
+	}
+
+	apply := func(m [6]float64, x, y float64) [2]float64 {
+		return [2]float64{m[0]*x + m[2]*y + m[4], m[1]*x + m[3]*y + m[5]}
+	}
+	for _, tt := range tests {
+		m, w, h := displayTransform(box, tt.rotate)
+		if w != tt.w || h != tt.h {
+			t.Errorf("rotate %d: size = %vx%v, want %vx%v", tt.rotate, w, h, tt.w, tt.h)
+		}
+		if got := apply(m, 0, 0); got != tt.origin {
+			t.Errorf("rotate %d: origin maps to %v, want %v", tt.rotate, got, tt.origin)
+		}
+		if got := apply(m, w, h); got != tt.farCorner {
+			t.Errorf("rotate %d: far corner maps to %v, want %v", tt.rotate, got, tt.farCorner)
+		}
+	}
+}
+
+func TestLexerObjects(t *testing.T) {
+	l := &lexer{data: []byte(`<< /A#20B (a\(b\)\101) /C [1 -2.5 3 0 R true null] /D <48 69> >>`)}
+	obj, err := l.object()
+	if err != nil {
+		t.Fatalf("object() error = %v", err)
+	}
+	d := obj.(dict)
+	if string(d["A B"].(pdfString)) != "a(b)A" {
+		t.Errorf("literal string = %q", d["A B"])
+	}
+	arr := d["C"].(array)
+	if arr[0] != int64(1) || arr[1] != -2.5 || arr[2] != (objRef{3, 0}) || arr[3] != true || arr[4] != nil {
+		t.Errorf("array = %v", arr)
+	}
+	if string(d["D"].(pdfString)) != "Hi" {
+		t.Errorf("hex string = %q", d["D"])
+	}
+
+	var b bytes.Buffer
+	writeObject(&b, d)
+	if got := b.String(); got != "<< /A#20B <6128622941> /C [1 -2.5 3 0 R true null] /D <4869> >>" {
+		t.Errorf("writeObject() = %s", got)
+	}
+}
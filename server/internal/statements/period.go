@@ -0,0 +1,38 @@
+package statements
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/server/internal/clock"
+)
+
+// MonthStart returns midnight on the first day of t's month in the institution timezone
+func MonthStart(t time.Time) time.Time {
+	t = t.In(clock.Location())
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// PreviousMonth returns the start of the month before the one containing t
+func PreviousMonth(t time.Time) time.Time {
+	return MonthStart(t).AddDate(0, -1, 0)
+}
+
+// ParsePeriod parses a YYYY-MM period into the start of that month
+func ParsePeriod(period string) (time.Time, error) {
+	t, err := time.ParseInLocation("2006-01", period, clock.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid period %q. Use YYYY-MM", period)
+	}
+	return t, nil
+}
+
+// PeriodEnd returns the exclusive end of the month starting at periodStart
+func PeriodEnd(periodStart time.Time) time.Time {
+	return periodStart.AddDate(0, 1, 0)
+}
+
+// FormatPeriod formats a period start as YYYY-MM
+func FormatPeriod(periodStart time.Time) string {
+	return periodStart.In(clock.Location()).Format("2006-01")
+}
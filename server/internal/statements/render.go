@@ -0,0 +1,308 @@
+package statements
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+	"github.com/server/internal/pdf"
+)
+
+// Branding is the institution information printed on statements
+type Branding struct {
+	Name     string
+	Address  string
+	Contact  string
+	Currency string
+}
+
+var (
+	brandColor  = pdf.RGB(30, 58, 138)
+	accentColor = pdf.RGB(219, 234, 254)
+)
+
+const (
+	marginX      = 40.0
+	contentRight = pdf.A4Width - marginX
+	bottomLimit  = pdf.A4Height - 70
+	rowHeight    = 18.0
+)
+
+// column describes a table column
+type column struct {
+	title string
+	x     float64
+	width float64
+	right bool
+}
+
+// FormatAmount formats a monetary amount with thousands separators
+func FormatAmount(currency string, v float64) string {
+	sign := ""
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+
+	cents := int64(math.Round(v * 100))
+	whole := strconv.FormatInt(cents/100, 10)
+	var grouped strings.Builder
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			grouped.WriteByte(',')
+		}
+		grouped.WriteRune(d)
+	}
+
+	return fmt.Sprintf("%s%s %s.%02d", sign, currency, grouped.String(), cents%100)
+}
+
+// fit shortens s with an ellipsis so that it fits in width
+func fit(font pdf.Font, size float64, s string, width float64) string {
+	if pdf.TextWidth(font, size, s) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		candidate := strings.TrimSpace(string(runes)) + "..."
+		if pdf.TextWidth(font, size, candidate) <= width {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// renderer lays out a statement across pages
+type renderer struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+// newPage starts a page with a slim continuation header
+func (r *renderer) newPage(b Branding, invoiceNumber string) {
+	r.page = r.doc.AddPage()
+	r.page.FillRect(0, 0, pdf.A4Width, 36, brandColor)
+	r.page.Text(marginX, 23, pdf.HelveticaBold, 11, pdf.White, b.Name)
+	r.page.TextRight(contentRight, 23, pdf.Helvetica, 9, pdf.White, "Invoice "+invoiceNumber)
+	r.y = 66
+}
+
+// ensureSpace starts a new page when fewer than h points remain
+func (r *renderer) ensureSpace(h float64, b Branding, invoiceNumber string) bool {
+	if r.y+h <= bottomLimit {
+		return false
+	}
+	r.newPage(b, invoiceNumber)
+	return true
+}
+
+// tableHeader draws a shaded header row
+func (r *renderer) tableHeader(cols []column) {
+	r.page.FillRect(marginX, r.y-12, contentRight-marginX, rowHeight, accentColor)
+	for _, c := range cols {
+		if c.right {
+			r.page.TextRight(c.x+c.width, r.y+1, pdf.HelveticaBold, 8.5, brandColor, c.title)
+		} else {
+			r.page.Text(c.x, r.y+1, pdf.HelveticaBold, 8.5, brandColor, c.title)
+		}
+	}
+	r.y += rowHeight
+}
+
+// tableRow draws one row of cells
+func (r *renderer) tableRow(cols []column, cells []string) {
+	for i, c := range cols {
+		text := fit(pdf.Helvetica, 8.5, cells[i], c.width)
+		if c.right {
+			r.page.TextRight(c.x+c.width, r.y, pdf.Helvetica, 8.5, pdf.Black, text)
+		} else {
+			r.page.Text(c.x, r.y, pdf.Helvetica, 8.5, pdf.Black, text)
+		}
+	}
+	r.page.Line(marginX, r.y+6, contentRight, r.y+6, 0.3, pdf.LightGray)
+	r.y += rowHeight
+}
+
+// section draws a section title
+func (r *renderer) section(title string) {
+	r.page.Text(marginX, r.y, pdf.HelveticaBold, 12, brandColor, title)
+	r.y += 20
+}
+
+// Render produces the PDF for a statement
+func Render(st *database.Statement, invoiceNumber string, issuedAt time.Time, b Branding) ([]byte, error) {
+	loc := clock.Location()
+	periodLabel := st.PeriodStart.In(loc).Format("January 2006")
+
+	doc := pdf.New()
+	doc.SetInfo("Title", "Ride statement "+periodLabel+" - "+st.Name)
+	doc.SetInfo("Author", b.Name)
+	doc.SetInfo("Subject", "Invoice "+invoiceNumber)
+	doc.SetCreationDate(issuedAt.In(loc))
+
+	r := &renderer{doc: doc}
+	r.page = doc.AddPage()
+
+	// Branded header
+	r.page.FillRect(0, 0, pdf.A4Width, 96, brandColor)
+	r.page.Text(marginX, 42, pdf.HelveticaBold, 20, pdf.White, b.Name)
+	if b.Address != "" {
+		r.page.Text(marginX, 62, pdf.Helvetica, 9, pdf.White, b.Address)
+	}
+	if b.Contact != "" {
+		r.page.Text(marginX, 76, pdf.Helvetica, 9, pdf.White, b.Contact)
+	}
+	r.page.TextRight(contentRight, 42, pdf.HelveticaBold, 14, pdf.White, "RIDE STATEMENT")
+	r.page.TextRight(contentRight, 62, pdf.Helvetica, 9, pdf.White, "Invoice No. "+invoiceNumber)
+	r.page.TextRight(contentRight, 76, pdf.Helvetica, 9, pdf.White, "Issued "+issuedAt.In(loc).Format("02 Jan 2006"))
+
+	// Student and period details
+	r.y = 128
+	r.page.Text(marginX, r.y, pdf.HelveticaBold, 9, pdf.Gray, "BILLED TO")
+	r.page.Text(330, r.y, pdf.HelveticaBold, 9, pdf.Gray, "STATEMENT PERIOD")
+	r.y += 16
+	r.page.Text(marginX, r.y, pdf.HelveticaBold, 12, pdf.Black, st.Name)
+	lastDay := st.PeriodEnd.Add(-time.Second).In(loc)
+	r.page.Text(330, r.y, pdf.HelveticaBold, 12, pdf.Black,
+		st.PeriodStart.In(loc).Format("02 Jan 2006")+" - "+lastDay.Format("02 Jan 2006"))
+
+	details := []string{}
+	if st.EnrollmentNumber != nil && *st.EnrollmentNumber != "" {
+		details = append(details, "Enrollment No. "+*st.EnrollmentNumber)
+	}
+	if st.Programme != nil && *st.Programme != "" {
+		details = append(details, "Programme: "+*st.Programme)
+	}
+	if st.Hostel != nil && *st.Hostel != "" {
+		details = append(details, "Hostel: "+*st.Hostel)
+	}
+	details = append(details, st.Email)
+	for _, line := range details {
+		r.y += 14
+		r.page.Text(marginX, r.y, pdf.Helvetica, 9, pdf.Black, line)
+	}
+
+	// Account summary
+	r.y += 30
+	r.section("Account summary")
+	summary := []struct {
+		label string
+		value float64
+	}{
+		{"Opening balance", st.OpeningBalance},
+		{"Ride charges", st.TotalCharges},
+		{"Payments received", -st.TotalPayments},
+		{"Refunds issued", st.TotalRefunds},
+	}
+	for _, line := range summary {
+		r.page.Text(marginX, r.y, pdf.Helvetica, 10, pdf.Black, line.label)
+		r.page.TextRight(contentRight, r.y, pdf.Helvetica, 10, pdf.Black, FormatAmount(b.Currency, line.value))
+		r.y += 16
+	}
+	r.page.FillRect(marginX, r.y-8, contentRight-marginX, 24, accentColor)
+	closingLabel := "Closing balance (amount due)"
+	if st.ClosingBalance < 0 {
+		closingLabel = "Closing balance (in credit)"
+	}
+	r.page.Text(marginX+8, r.y+8, pdf.HelveticaBold, 11, brandColor, closingLabel)
+	r.page.TextRight(contentRight-8, r.y+8, pdf.HelveticaBold, 11, brandColor, FormatAmount(b.Currency, st.ClosingBalance))
+	r.y += 50
+
+	// Rides
+	rideCols := []column{
+		{"Date", marginX, 60, false},
+		{"Bill #", marginX + 64, 40, false},
+		{"Route", marginX + 108, 190, false},
+		{"Driver", marginX + 302, 90, false},
+		{"Status", marginX + 396, 55, false},
+		{"Fare", marginX + 455, contentRight - marginX - 455, true},
+	}
+	r.ensureSpace(60, b, invoiceNumber)
+	r.section(fmt.Sprintf("Rides (%d)", len(st.Rides)))
+	if len(st.Rides) == 0 {
+		r.page.Text(marginX, r.y, pdf.Helvetica, 9, pdf.Gray, "No rides during this period.")
+		r.y += rowHeight
+	} else {
+		r.tableHeader(rideCols)
+		for _, ride := range st.Rides {
+			if r.ensureSpace(rowHeight, b, invoiceNumber) {
+				r.tableHeader(rideCols)
+			}
+			driver := "-"
+			if ride.Driver != nil && *ride.Driver != "" {
+				driver = *ride.Driver
+			}
+			fare := FormatAmount(b.Currency, ride.Fare)
+			if ride.Status == "cancelled" {
+				fare = "(" + fare + ")"
+			}
+			r.tableRow(rideCols, []string{
+				ride.Date.In(loc).Format("02 Jan 2006"),
+				strconv.Itoa(ride.BillID),
+				ride.From + " to " + ride.To,
+				driver,
+				strings.ReplaceAll(ride.Status, "_", " "),
+				fare,
+			})
+		}
+	}
+
+	// Payments and refunds
+	paymentCols := []column{
+		{"Date", marginX, 60, false},
+		{"Bill #", marginX + 64, 40, false},
+		{"Type", marginX + 108, 55, false},
+		{"Method", marginX + 167, 80, false},
+		{"Reference", marginX + 251, 180, false},
+		{"Amount", marginX + 435, contentRight - marginX - 435, true},
+	}
+	r.y += 20
+	r.ensureSpace(60, b, invoiceNumber)
+	r.section(fmt.Sprintf("Payments and refunds (%d)", len(st.Payments)))
+	if len(st.Payments) == 0 {
+		r.page.Text(marginX, r.y, pdf.Helvetica, 9, pdf.Gray, "No payments during this period.")
+		r.y += rowHeight
+	} else {
+		r.tableHeader(paymentCols)
+		for _, p := range st.Payments {
+			if r.ensureSpace(rowHeight, b, invoiceNumber) {
+				r.tableHeader(paymentCols)
+			}
+			reference := "-"
+			if p.Reference != nil && *p.Reference != "" {
+				reference = *p.Reference
+			}
+			amount := -p.Amount
+			if p.Kind == database.PaymentKindRefund {
+				amount = p.Amount
+			}
+			r.tableRow(paymentCols, []string{
+				p.Date.In(loc).Format("02 Jan 2006"),
+				strconv.Itoa(p.BillID),
+				p.Kind,
+				strings.ReplaceAll(p.Method, "_", " "),
+				reference,
+				FormatAmount(b.Currency, amount),
+			})
+		}
+	}
+
+	// Footer on every page
+	total := doc.PageCount()
+	for i := 0; i < total; i++ {
+		page := doc.Page(i)
+		page.Line(marginX, pdf.A4Height-48, contentRight, pdf.A4Height-48, 0.5, pdf.LightGray)
+		page.Text(marginX, pdf.A4Height-34, pdf.Helvetica, 8, pdf.Gray,
+			"This is a computer generated statement and does not require a signature.")
+		page.TextRight(contentRight, pdf.A4Height-34, pdf.Helvetica, 8, pdf.Gray,
+			fmt.Sprintf("Page %d of %d", i+1, total))
+	}
+
+	return doc.Bytes()
+}
@@ -0,0 +1,276 @@
+// Package statements generates monthly ride statements with PDF invoices and
+// runs the month-end bulk generation job.
+package statements
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/config"
+	"github.com/server/internal/database"
+	"github.com/server/internal/email"
+	"github.com/server/internal/storage"
+)
+
+// StorageCategory is the storage category statement PDFs are saved under
+const StorageCategory = "statements"
+
+// RunStaleAfter is how long a bulk run can go without progress before it is
+// considered interrupted. Each student takes at most a minute.
+const RunStaleAfter = 10 * time.Minute
+
+// DraftInvoiceNumber is shown instead of an invoice number on statements of
+// a month that hasn't ended yet
+const DraftInvoiceNumber = "DRAFT"
+
+var (
+	// ErrPeriodOpen is returned when generating a statement for a month that
+	// hasn't ended yet. Only drafts can be rendered for it.
+	ErrPeriodOpen = errors.New("statement period has not ended")
+	// ErrNoActivity is returned when a student has no balance and no activity
+	// in the month, so there is nothing to invoice
+	ErrNoActivity = errors.New("no activity in statement period")
+)
+
+// Result is a generated statement
+type Result struct {
+	Record    *database.RideStatement
+	Statement *database.Statement
+	PDF       []byte
+}
+
+// BrandingFromConfig returns the configured institution branding
+func BrandingFromConfig() Branding {
+	return Branding{
+		Name:     config.InstitutionName(),
+		Address:  config.InstitutionAddress(),
+		Contact:  config.InstitutionContact(),
+		Currency: config.PaymentCurrency(),
+	}
+}
+
+// Generate builds, renders and stores a student's statement for the month
+// starting at periodStart. Invoice numbers are only allocated for months that
+// have ended and have a balance or activity; regenerating keeps the number.
+func Generate(ctx context.Context, userID int, periodStart time.Time) (*Result, error) {
+	periodStart = MonthStart(periodStart)
+	if PeriodEnd(periodStart).After(clock.Now()) {
+		return nil, ErrPeriodOpen
+	}
+
+	st, err := database.BuildStatement(ctx, userID, periodStart, PeriodEnd(periodStart))
+	if err != nil {
+		return nil, fmt.Errorf("build statement: %w", err)
+	}
+	if st.IsEmpty() {
+		// Keep serving statements numbered before their bills were removed
+		_, err := database.GetUserStatement(ctx, userID, periodStart)
+		if err == database.ErrStatementNotFound {
+			return nil, ErrNoActivity
+		}
+		if err != nil {
+			return nil, fmt.Errorf("look up statement: %w", err)
+		}
+	}
+
+	record, err := database.ReserveStatement(ctx, userID, periodStart, config.InvoicePrefix())
+	if err != nil {
+		return nil, fmt.Errorf("reserve invoice number: %w", err)
+	}
+
+	data, err := Render(st, record.InvoiceNumber, clock.Now(), BrandingFromConfig())
+	if err != nil {
+		return nil, fmt.Errorf("render statement: %w", err)
+	}
+
+	// Statement file names must not be guessable
+	fileName := record.InvoiceNumber + "_" + uuid.NewString() + ".pdf"
+	if record.FileName != nil {
+		fileName = *record.FileName
+	}
+	fileURL, err := storage.Save(ctx, StorageCategory, fileName, data, "application/pdf")
+	if err != nil {
+		return nil, fmt.Errorf("store statement: %w", err)
+	}
+
+	record, err = database.CompleteStatement(ctx, record.ID, st, fileName, fileURL)
+	if err != nil {
+		return nil, fmt.Errorf("save statement: %w", err)
+	}
+
+	return &Result{Record: record, Statement: st, PDF: data}, nil
+}
+
+// Draft renders a student's statement for the current month so far. Drafts
+// have no invoice number and are not stored.
+func Draft(ctx context.Context, userID int, periodStart time.Time) ([]byte, error) {
+	periodStart = MonthStart(periodStart)
+	st, err := database.BuildStatement(ctx, userID, periodStart, PeriodEnd(periodStart))
+	if err != nil {
+		return nil, fmt.Errorf("build statement: %w", err)
+	}
+	return Render(st, DraftInvoiceNumber, clock.Now(), BrandingFromConfig())
+}
+
+// Load returns the stored PDF for a generated statement
+func Load(ctx context.Context, record *database.RideStatement) ([]byte, error) {
+	if record.FileName == nil {
+		return nil, storage.ErrNotFound
+	}
+	return storage.Read(ctx, StorageCategory, *record.FileName)
+}
+
+// DownloadName returns the file name offered when downloading a statement
+func DownloadName(record *database.RideStatement) string {
+	return fmt.Sprintf("ride-statement-%s-%s.pdf", FormatPeriod(record.PeriodStart), record.InvoiceNumber)
+}
+
+// DraftDownloadName returns the file name offered when downloading a draft
+func DraftDownloadName(periodStart time.Time) string {
+	return fmt.Sprintf("ride-statement-%s-draft.pdf", FormatPeriod(periodStart))
+}
+
+// Email sends a generated statement to the student as a PDF attachment
+func Email(ctx context.Context, result *Result) error {
+	st := result.Statement
+	b := BrandingFromConfig()
+	periodLabel := st.PeriodStart.In(clock.Location()).Format("January 2006")
+
+	body := fmt.Sprintf(`Hello %s,
+
+Please find attached your ride statement for %s.
+
+Invoice number: %s
+Opening balance: %s
+Ride charges: %s
+Payments received: %s
+Refunds issued: %s
+Closing balance: %s
+
+You can also download your statements at any time from your account.
+
+Best regards,
+%s
+`, st.Name, periodLabel, result.Record.InvoiceNumber,
+		FormatAmount(b.Currency, st.OpeningBalance),
+		FormatAmount(b.Currency, st.TotalCharges),
+		FormatAmount(b.Currency, st.TotalPayments),
+		FormatAmount(b.Currency, st.TotalRefunds),
+		FormatAmount(b.Currency, st.ClosingBalance),
+		b.Name)
+
+	userID := st.UserID
+	err := email.Send(ctx, email.Message{
+		To:      st.Email,
+		UserID:  &userID,
+		Subject: fmt.Sprintf("Your ride statement for %s (%s)", periodLabel, result.Record.InvoiceNumber),
+		Body:    body,
+		Type:    "statement",
+		Attachments: []email.Attachment{
+			{Filename: DownloadName(result.Record), ContentType: "application/pdf", Data: result.PDF},
+		},
+	})
+
+	if markErr := database.MarkStatementEmailed(ctx, result.Record.ID, err); markErr != nil {
+		log.Printf("[statements] Failed to record email status for statement %d: %v", result.Record.ID, markErr)
+	}
+	return err
+}
+
+// RunBulk generates (and optionally emails) statements for every student with
+// ride history up to the end of the run's period. Students with no balance and
+// no activity in the period are skipped. Progress is stored on the run after
+// each student. Scheduled runs don't email a statement twice, so a run
+// interrupted by a restart or by ctx ending can be resumed.
+func RunBulk(ctx context.Context, run *database.StatementRun) error {
+	periodStart := MonthStart(run.PeriodStart)
+	log.Printf("[statements] Run %d started for %s", run.ID, FormatPeriod(periodStart))
+
+	// The run's records must be updated even when ctx ends
+	recordCtx := context.WithoutCancel(ctx)
+
+	listCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	userIDs, err := database.GetStatementRecipients(listCtx, PeriodEnd(periodStart))
+	cancel()
+	if err != nil {
+		log.Printf("[statements] Run %d failed to list students: %v", run.ID, err)
+		_ = database.FinishStatementRun(recordCtx, run.ID, err)
+		return err
+	}
+
+	var generated, emailed, failed int
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			log.Printf("[statements] Run %d interrupted after %d of %d students", run.ID, generated+failed, len(userIDs))
+			return ctx.Err()
+		}
+		userCtx, cancel := context.WithTimeout(ctx, 60*time.Second)
+
+		result, err := Generate(userCtx, userID, periodStart)
+		if errors.Is(err, ErrNoActivity) {
+			cancel()
+			continue
+		}
+		if err != nil {
+			log.Printf("[statements] Run %d: statement for user %d failed: %v", run.ID, userID, err)
+			failed++
+		} else {
+			generated++
+			if run.SendEmail && run.Trigger == "scheduled" && result.Record.EmailedAt != nil {
+				emailed++
+			} else if run.SendEmail {
+				if err := Email(userCtx, result); err != nil {
+					failed++
+				} else {
+					emailed++
+				}
+			}
+		}
+		cancel()
+
+		_ = database.UpdateStatementRunProgress(recordCtx, run.ID, len(userIDs), generated, emailed, failed)
+	}
+
+	_ = database.UpdateStatementRunProgress(recordCtx, run.ID, len(userIDs), generated, emailed, failed)
+	if err := database.FinishStatementRun(recordCtx, run.ID, nil); err != nil {
+		log.Printf("[statements] Run %d failed to finish: %v", run.ID, err)
+	}
+	log.Printf("[statements] Run %d completed: %d generated, %d emailed, %d failed",
+		run.ID, generated, emailed, failed)
+	return nil
+}
+
+// RunMonthEnd runs the scheduled bulk job for the previous month. Each month
+// is scheduled at most once; a run interrupted while its server was down is
+// resumed instead.
+func RunMonthEnd(ctx context.Context) (string, error) {
+	periodStart := PreviousMonth(clock.Now())
+	period := FormatPeriod(periodStart)
+
+	run, err := database.CreateStatementRun(ctx, periodStart, "scheduled", true, nil)
+	if err != nil {
+		return "", fmt.Errorf("create run: %w", err)
+	}
+	if run == nil {
+		// Already scheduled; take it over if its server stopped mid-run
+		run, err = database.ResumeStatementRun(ctx, periodStart, RunStaleAfter)
+		if err != nil {
+			return "", fmt.Errorf("check run: %w", err)
+		}
+		if run == nil {
+			return "statements for " + period + " already scheduled", nil
+		}
+		log.Printf("[statements] Resuming interrupted run %d", run.ID)
+	}
+
+	if err := RunBulk(ctx, run); err != nil {
+		return "", fmt.Errorf("run %d: %w", run.ID, err)
+	}
+	return fmt.Sprintf("sent statements for %s in run %d", period, run.ID), nil
+}
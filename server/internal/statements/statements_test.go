@@ -0,0 +1,132 @@
+package statements
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/server/internal/clock"
+	"github.com/server/internal/database"
+)
+
+func TestFormatAmount(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{0, "INR 0.00"},
+		{5.5, "INR 5.50"},
+		{999.999, "INR 1,000.00"},
+		{1234567.8, "INR 1,234,567.80"},
+		{-250, "-INR 250.00"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatAmount("INR", tt.value); result != tt.expected {
+			t.Errorf("FormatAmount(%v) = %q, want %q", tt.value, result, tt.expected)
+		}
+	}
+}
+
+func TestPeriods(t *testing.T) {
+	start, err := ParsePeriod("2026-02")
+	if err != nil {
+		t.Fatalf("ParsePeriod() error = %v", err)
+	}
+	if FormatPeriod(start) != "2026-02" {
+		t.Errorf("FormatPeriod() = %s, want 2026-02", FormatPeriod(start))
+	}
+	if end := PeriodEnd(start); FormatPeriod(end) != "2026-03" || end.Day() != 1 {
+		t.Errorf("PeriodEnd() = %v, want 1 March 2026", end)
+	}
+
+	if _, err := ParsePeriod("2026-13"); err == nil {
+		t.Error("Expected error for invalid month")
+	}
+	if _, err := ParsePeriod("March 2026"); err == nil {
+		t.Error("Expected error for invalid format")
+	}
+
+	// 31 Jan 20:00 UTC is already 1 Feb in IST
+	utc := time.Date(2026, 1, 31, 20, 0, 0, 0, time.UTC)
+	if FormatPeriod(MonthStart(utc)) != "2026-02" {
+		t.Errorf("MonthStart() = %v, want February in IST", MonthStart(utc))
+	}
+	if FormatPeriod(PreviousMonth(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))) != "2025-12" {
+		t.Error("PreviousMonth() should cross the year boundary")
+	}
+}
+
+func TestFit(t *testing.T) {
+	if result := fit(0, 10, "Short", 100); result != "Short" {
+		t.Errorf("fit() = %q, want unchanged text", result)
+	}
+	result := fit(0, 10, "Main Gate to Central Library via Academic Block", 80)
+	if len(result) == 0 || result[len(result)-3:] != "..." {
+		t.Errorf("fit() = %q, want truncated text with ellipsis", result)
+	}
+}
+
+func TestRenderPaginatesLongStatements(t *testing.T) {
+	start, _ := ParsePeriod("2026-03")
+	driver := "Ravi Kumar"
+	reference := "pay_123"
+
+	st := &database.Statement{
+		UserID:         1,
+		Name:           "Priya Sharma",
+		Email:          "priya@test.com",
+		PeriodStart:    start,
+		PeriodEnd:      PeriodEnd(start),
+		OpeningBalance: 120,
+		TotalCharges:   60 * 35,
+		TotalPayments:  500,
+		ClosingBalance: database.ClosingBalance(120, 60*35, 500, 0),
+	}
+	for i := 0; i < 60; i++ {
+		st.Rides = append(st.Rides, database.StatementRide{
+			BillID: i + 1, Date: start.AddDate(0, 0, i%28), From: "Hostel A", To: "Main Gate",
+			Driver: &driver, Fare: 35, Status: "paid",
+		})
+	}
+	st.Payments = append(st.Payments, database.StatementPayment{
+		PaymentID: 1, BillID: 1, Date: start, Kind: "payment", Method: "upi", Amount: 500, Reference: &reference,
+	})
+
+	data, err := Render(st, "INV-2026-000001", start.AddDate(0, 1, 0), Branding{Name: "Test Institute", Currency: "INR"})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		t.Fatal("Expected a PDF document")
+	}
+	if bytes.Contains(data, []byte("/Count 1 ")) {
+		t.Error("Expected 60 rides to span several pages")
+	}
+	if !bytes.Contains(data, []byte("(Invoice INV-2026-000001)")) {
+		t.Error("Expected invoice number in document subject")
+	}
+}
+
+func TestClosingBalance(t *testing.T) {
+	if result := database.ClosingBalance(100, 50.5, 120, 10); result != 40.5 {
+		t.Errorf("ClosingBalance() = %v, want 40.5", result)
+	}
+	if result := database.ClosingBalance(0, 0, 30, 0); result != -30 {
+		t.Errorf("ClosingBalance() = %v, want -30 (credit)", result)
+	}
+}
+
+func TestGenerateRejectsOpenPeriod(t *testing.T) {
+	restore := clock.Set(clock.Fixed(time.Date(2026, 3, 15, 12, 0, 0, 0, clock.Location())))
+	defer restore()
+
+	for _, period := range []string{"2026-03", "2026-04"} {
+		start, _ := ParsePeriod(period)
+		if _, err := Generate(context.Background(), 1, start); !errors.Is(err, ErrPeriodOpen) {
+			t.Errorf("Generate(%s) error = %v, want ErrPeriodOpen", period, err)
+		}
+	}
+}
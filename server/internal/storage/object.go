@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/server/internal/config"
+)
+
+// Object is a stored file that can be read piece by piece without loading
+// it into memory
+type Object struct {
+	Size int64
+	// ETag is a strong validator recorded when the file was written: the
+	// ETag S3 keeps for the object, or the size and modification time of
+	// a local file
+	ETag string
+
+	path string     // Local file
+	key  string     // S3 object key
+	data []byte     // Contents held in memory
+	s3   *s3.Client // Client for S3 objects
+}
+
+// Open returns a stored file for reading, checking local storage first like
+// Read does
+func Open(ctx context.Context, category, filename string) (*Object, error) {
+	if !validName(category) || !validName(filename) {
+		return nil, ErrNotFound
+	}
+
+	path := filepath.Join(localRoot, category, filename)
+	info, err := os.Stat(path)
+	if err == nil {
+		return &Object{
+			Size: info.Size(),
+			ETag: fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+			path: path,
+		}, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if config.StorageType() != "s3" {
+		return nil, ErrNotFound
+	}
+
+	client, err := newS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/%s", category, filename)
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(config.S3BucketName()),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		log.Printf("[storage] Error looking up %s in S3: %v", key, err)
+		return nil, ErrNotFound
+	}
+	return &Object{
+		Size: aws.ToInt64(head.ContentLength),
+		ETag: s3ETag(aws.ToString(head.ETag)),
+		key:  key,
+		s3:   client,
+	}, nil
+}
+
+// NewObject wraps contents held in memory, such as a generated file that
+// couldn't be stored
+func NewObject(data []byte) *Object {
+	return &Object{
+		Size: int64(len(data)),
+		ETag: fmt.Sprintf(`"%08x-%x"`, crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)), len(data)),
+		data: data,
+	}
+}
+
+// s3ETag quotes an ETag returned by S3. Multipart ETags are still strong
+// validators for the object they belong to.
+func s3ETag(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	return `"` + etag + `"`
+}
+
+// NewRangeReader returns a reader for length bytes of the object starting at
+// offset. The reader outlives ctx's cancellation so it can be handed to the
+// response writer; closing it releases the file or connection.
+func (o *Object) NewRangeReader(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 || offset+length > o.Size {
+		return nil, fmt.Errorf("range %d+%d out of bounds for %d bytes", offset, length, o.Size)
+	}
+
+	switch {
+	case o.data != nil:
+		return io.NopCloser(bytes.NewReader(o.data[offset : offset+length])), nil
+
+	case o.path != "":
+		f, err := os.Open(o.path)
+		if err != nil {
+			return nil, err
+		}
+		return &sectionFile{SectionReader: io.NewSectionReader(f, offset, length), file: f}, nil
+
+	case length == 0:
+		return io.NopCloser(bytes.NewReader(nil)), nil
+
+	default:
+		result, err := o.s3.GetObject(context.WithoutCancel(ctx), &s3.GetObjectInput{
+			Bucket:  aws.String(config.S3BucketName()),
+			Key:     aws.String(o.key),
+			Range:   aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+			IfMatch: aws.String(o.ETag),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch %s from S3: %w", o.key, err)
+		}
+		return result.Body, nil
+	}
+}
+
+// sectionFile reads part of a local file and closes the file when done
+type sectionFile struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (s *sectionFile) Close() error {
+	return s.file.Close()
+}
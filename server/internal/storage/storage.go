@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+
+	"github.com/server/internal/config"
+)
+
+// Server generated files (statements, converted documents, ...) are stored the
+// same way as uploads in handlers/files.go: under ./uploads/<category>/<filename>
+// locally, or at <category>/<filename> in the S3 bucket when STORAGE_TYPE=s3.
+
+const localRoot = "./uploads"
+
+// ErrNotFound is returned when a stored file does not exist
+var ErrNotFound = fmt.Errorf("file not found")
+
+// URL returns the API path used to fetch a stored file
+func URL(category, filename string) string {
+	return fmt.Sprintf("/api/files/%s/%s", category, filename)
+}
+
+// Locate returns the category and filename of a stored file from any of the
+// references the server records for it: its API path, local path, s3:// path
+// or S3 object URL. ok is false for files stored elsewhere.
+func Locate(ref string) (category, filename string, ok bool) {
+	ref = strings.TrimSpace(ref)
+	var rest string
+	switch {
+	case strings.HasPrefix(ref, "/api/files/"):
+		rest = strings.TrimPrefix(ref, "/api/files/")
+	case strings.HasPrefix(ref, localRoot+"/"):
+		rest = strings.TrimPrefix(ref, localRoot+"/")
+	case strings.HasPrefix(ref, "s3://"):
+		bucketAndKey := strings.SplitN(strings.TrimPrefix(ref, "s3://"), "/", 2)
+		if len(bucketAndKey) != 2 {
+			return "", "", false
+		}
+		rest = bucketAndKey[1]
+	case strings.HasPrefix(ref, "https://"):
+		u, err := url.Parse(ref)
+		if err != nil || !strings.HasSuffix(u.Host, ".amazonaws.com") || !strings.Contains(u.Host, ".s3.") {
+			return "", "", false
+		}
+		rest = strings.TrimPrefix(u.Path, "/")
+	default:
+		return "", "", false
+	}
+
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	parts := strings.SplitN(rest, "/", 2)
+	if len(parts) != 2 || !validName(parts[0]) || !validName(parts[1]) {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// validName rejects path components that could escape the storage root
+func validName(name string) bool {
+	return name != "" && !strings.Contains(name, "..") && !strings.Contains(name, "/") && !strings.Contains(name, "\\")
+}
+
+// newS3Client creates an S3 client from the configured credentials
+func newS3Client(ctx context.Context) (*s3.Client, error) {
+	accessKeyID := config.AWSAccessKeyID()
+	secretKey := config.AWSSecretKey()
+
+	if accessKeyID == "" || secretKey == "" || config.S3BucketName() == "" {
+		return nil, fmt.Errorf("AWS credentials not configured")
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(config.AWSRegion()),
+		awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			accessKeyID,
+			secretKey,
+			"",
+		)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return s3.NewFromConfig(awsCfg), nil
+}
+
+// Save stores data and returns its API path. With S3 storage it falls back to
+// local storage if the upload fails, like file uploads do.
+func Save(ctx context.Context, category, filename string, data []byte, contentType string) (string, error) {
+	if !validName(category) || !validName(filename) {
+		return "", fmt.Errorf("invalid file name")
+	}
+
+	if config.StorageType() == "s3" {
+		err := saveToS3(ctx, category, filename, data, contentType)
+		if err == nil {
+			return URL(category, filename), nil
+		}
+		log.Printf("[storage] S3 upload failed, falling back to local storage: %v", err)
+	}
+
+	if err := saveToLocal(category, filename, data); err != nil {
+		return "", err
+	}
+	return URL(category, filename), nil
+}
+
+// saveToS3 uploads data to the configured bucket
+func saveToS3(ctx context.Context, category, filename string, data []byte, contentType string) error {
+	client, err := newS3Client(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(config.S3BucketName()),
+		Key:         aws.String(fmt.Sprintf("%s/%s", category, filename)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to S3: %w", err)
+	}
+	return nil
+}
+
+// saveToLocal writes data below the local uploads directory
+func saveToLocal(category, filename string, data []byte) error {
+	dir := filepath.Join(localRoot, category)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, filename), data, 0644); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	return nil
+}
+
+// Read returns the contents of a stored file, checking local storage first
+func Read(ctx context.Context, category, filename string) ([]byte, error) {
+	if !validName(category) || !validName(filename) {
+		return nil, ErrNotFound
+	}
+
+	data, err := os.ReadFile(filepath.Join(localRoot, category, filename))
+	if err == nil {
+		return data, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if config.StorageType() != "s3" {
+		return nil, ErrNotFound
+	}
+
+	client, err := newS3Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(config.S3BucketName()),
+		Key:    aws.String(fmt.Sprintf("%s/%s", category, filename)),
+	})
+	if err != nil {
+		log.Printf("[storage] Error fetching %s/%s from S3: %v", category, filename, err)
+		return nil, ErrNotFound
+	}
+	defer result.Body.Close()
+
+	return io.ReadAll(result.Body)
+}
+
+// Delete removes a stored file from local storage and S3
+func Delete(ctx context.Context, category, filename string) error {
+	if !validName(category) || !validName(filename) {
+		return fmt.Errorf("invalid file name")
+	}
+
+	if err := os.Remove(filepath.Join(localRoot, category, filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if config.StorageType() == "s3" {
+		client, err := newS3Client(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+			Bucket: aws.String(config.S3BucketName()),
+			Key:    aws.String(fmt.Sprintf("%s/%s", category, filename)),
+		})
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestLocate(t *testing.T) {
+	tests := []struct {
+		ref      string
+		category string
+		filename string
+		ok       bool
+	}{
+		{"/api/files/courses/course_1.pdf", "courses", "course_1.pdf", true},
+		{"./uploads/courses/course_1.pdf", "courses", "course_1.pdf", true},
+		{"s3://odi-bucket/courses/course_1.pdf", "courses", "course_1.pdf", true},
+		{"https://odi-bucket.s3.ap-south-1.amazonaws.com/courses/course_1.pdf", "courses", "course_1.pdf", true},
+		{"/api/files/courses/course_1.pdf?download=1", "courses", "course_1.pdf", true},
+		{"https://example.com/courses/course_1.pdf", "", "", false},
+		{"/api/files/courses/../../etc/passwd", "", "", false},
+		{"/api/files/courses", "", "", false},
+		{"s3://odi-bucket", "", "", false},
+		{"", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			category, filename, ok := Locate(tt.ref)
+			if category != tt.category || filename != tt.filename || ok != tt.ok {
+				t.Errorf("Locate(%q) = %q, %q, %v; want %q, %q, %v", tt.ref, category, filename, ok, tt.category, tt.filename, tt.ok)
+			}
+		})
+	}
+}
+
+func TestObjectRanges(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	data := []byte("%PDF-1.7 personal copy")
+	if err := saveToLocal("books", "copy.pdf", data); err != nil {
+		t.Fatalf("saveToLocal() error = %v", err)
+	}
+
+	stored, err := Open(context.Background(), "books", "copy.pdf")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, obj := range []*Object{stored, NewObject(data)} {
+		if obj.Size != int64(len(data)) || obj.ETag == "" {
+			t.Errorf("object size = %d, etag = %q", obj.Size, obj.ETag)
+		}
+		r, err := obj.NewRangeReader(context.Background(), 9, 8)
+		if err != nil {
+			t.Fatalf("NewRangeReader() error = %v", err)
+		}
+		got, _ := io.ReadAll(r)
+		r.Close()
+		if string(got) != "personal" {
+			t.Errorf("range = %q, want %q", got, "personal")
+		}
+		if _, err := obj.NewRangeReader(context.Background(), 20, 10); err == nil {
+			t.Error("Expected error for a range past the end")
+		}
+	}
+
+	if NewObject([]byte("%PDF-1.6")).ETag == NewObject(data).ETag {
+		t.Error("ETag should differ for different content")
+	}
+	if _, err := Open(context.Background(), "books", "../copy.pdf"); err != ErrNotFound {
+		t.Errorf("Open() invalid name error = %v, want ErrNotFound", err)
+	}
+}
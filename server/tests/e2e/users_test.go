@@ -4,9 +4,12 @@
 package e2e
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func loginAsAdmin(t *testing.T) []*http.Cookie {
@@ -180,6 +183,54 @@ func TestUpdateUserStatus(t *testing.T) {
 	}
 }
 
+func TestBulkReactivateRefreshesSessions(t *testing.T) {
+	cleanupTestData(t)
+	cookies := loginAsAdmin(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A student whose access ends tomorrow, signed in before the renewal
+	userID := createTestUser(t, "renewing", "renewing@example.com", "pass123", "student")
+	if _, err := testDB.Exec(ctx, `UPDATE users SET expiry_date = CURRENT_DATE + 1 WHERE id = $1`, userID); err != nil {
+		t.Fatalf("Failed to set expiry date: %v", err)
+	}
+	login := doRequest(t, "POST", "/api/auth/login", map[string]string{
+		"identifier": "renewing",
+		"password":   "pass123",
+	}, nil)
+	assertStatus(t, login, 200)
+	sessionCookie := getSessionCookie(login.Cookies)
+	if sessionCookie == nil {
+		t.Fatal("student login should set a session cookie")
+	}
+
+	newExpiry := time.Now().AddDate(0, 6, 0)
+	resp := doRequest(t, "POST", "/api/users/reactivate", map[string]interface{}{
+		"userIds":    []int{userID},
+		"expiryDate": newExpiry.Format("2006-01-02"),
+	}, cookies)
+	assertStatus(t, resp, 200)
+
+	data, err := testRedis.Get(ctx, "session:"+sessionCookie.Value).Result()
+	if err != nil {
+		t.Fatalf("student session should still exist: %v", err)
+	}
+	var session struct {
+		AccountExpiresAt *time.Time `json:"account_expires_at"`
+	}
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		t.Fatalf("Failed to decode session: %v", err)
+	}
+	if session.AccountExpiresAt == nil || session.AccountExpiresAt.Before(newExpiry.AddDate(0, 0, -2)) {
+		t.Errorf("session expires at %v, want the renewed expiry %s", session.AccountExpiresAt, newExpiry.Format("2006-01-02"))
+	}
+
+	// The refreshed session is still accepted
+	me := doRequest(t, "GET", "/api/auth/me", nil, login.Cookies)
+	assertStatus(t, me, 200)
+}
+
 func TestUpdateUserInvalidStatus(t *testing.T) {
 	cleanupTestData(t)
 	cookies := loginAsAdmin(t)